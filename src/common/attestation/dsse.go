@@ -0,0 +1,115 @@
+// Package attestation provides in-toto provenance statements, DSSE envelopes and minisign detached signatures shared by ldfd and ldfctl.
+package attestation
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PayloadTypeInToto is the DSSE payload type of in-toto statements
+const PayloadTypeInToto = "application/vnd.in-toto+json"
+
+// ErrInvalidSignature is returned when a signature does not verify
+var ErrInvalidSignature = errors.New("signature verification failed")
+
+// Envelope is a Dead Simple Signing Envelope
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"` // base64-encoded
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a single DSSE signature over an envelope payload
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"` // base64-encoded
+}
+
+// PAE returns the DSSE pre-authentication encoding of a payload
+func PAE(payloadType string, payload []byte) []byte {
+	buf := []byte("DSSEv1 ")
+	buf = strconv.AppendInt(buf, int64(len(payloadType)), 10)
+	buf = append(buf, ' ')
+	buf = append(buf, payloadType...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(len(payload)), 10)
+	buf = append(buf, ' ')
+	return append(buf, payload...)
+}
+
+// Sign wraps payload in an envelope signed with priv
+func Sign(priv ed25519.PrivateKey, keyID, payloadType string, payload []byte) *Envelope {
+	sig := ed25519.Sign(priv, PAE(payloadType, payload))
+	return &Envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}
+}
+
+// Verify checks the envelope against pub and returns the decoded payload
+func Verify(env *Envelope, pub ed25519.PublicKey) ([]byte, error) {
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope payload: %w", err)
+	}
+
+	pae := PAE(env.PayloadType, payload)
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(pub, pae, sig) {
+			return payload, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
+
+// KeyID returns the fingerprint of a public key: the first 16 bytes of the
+// SHA-256 of its PKIX encoding, hex-encoded
+func KeyID(pub ed25519.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:16])
+}
+
+// MarshalPublicKeyPEM encodes an ed25519 public key as a PKIX PEM block
+func MarshalPublicKeyPEM(pub ed25519.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParsePublicKeyPEM decodes a PKIX PEM block holding an ed25519 public key
+func ParsePublicKeyPEM(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("no PEM public key found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not ed25519")
+	}
+	return pub, nil
+}
@@ -0,0 +1,212 @@
+package attestation
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// SignatureSuffix is appended to an artifact name to form its detached signature name
+const SignatureSuffix = ".minisig"
+
+// Minisign signature algorithms: legacy signs the raw file, prehashed signs
+// its BLAKE2b-512 digest
+const (
+	minisignAlgLegacy    = "Ed"
+	minisignAlgPrehashed = "ED"
+)
+
+const (
+	untrustedPrefix = "untrusted comment: "
+	trustedPrefix   = "trusted comment: "
+)
+
+// MinisignKeyID returns the 8-byte minisign key id of a public key, derived
+// from the same digest as KeyID so both identify the key consistently
+func MinisignKeyID(pub ed25519.PublicKey) [8]byte {
+	var id [8]byte
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return id
+	}
+	sum := sha256.Sum256(der)
+	copy(id[:], sum[:8])
+	return id
+}
+
+// FormatMinisignPublicKey encodes a public key in minisign's public key file format
+func FormatMinisignPublicKey(pub ed25519.PublicKey) string {
+	id := MinisignKeyID(pub)
+	blob := make([]byte, 0, 42)
+	blob = append(blob, minisignAlgLegacy...)
+	blob = append(blob, id[:]...)
+	blob = append(blob, pub...)
+
+	return fmt.Sprintf("%sminisign public key %016X\n%s\n",
+		untrustedPrefix, binary.LittleEndian.Uint64(id[:]), base64.StdEncoding.EncodeToString(blob))
+}
+
+// ParsePublicKey decodes an ed25519 public key in either PEM or minisign format
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		return ParsePublicKeyPEM(data)
+	}
+
+	lines := commentFreeLines(data)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no public key found")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil || len(blob) != 42 || string(blob[:2]) != minisignAlgLegacy {
+		return nil, fmt.Errorf("invalid minisign public key")
+	}
+	return ed25519.PublicKey(blob[10:]), nil
+}
+
+// SignDetached produces a minisign-compatible prehashed signature of r. The
+// trusted comment is covered by the signature and must be a single line.
+func SignDetached(priv ed25519.PrivateKey, r io.Reader, trustedComment string) ([]byte, error) {
+	if strings.ContainsAny(trustedComment, "\r\n") {
+		return nil, fmt.Errorf("trusted comment must be a single line")
+	}
+
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to hash signed data: %w", err)
+	}
+
+	pub := priv.Public().(ed25519.PublicKey)
+	id := MinisignKeyID(pub)
+
+	sig := ed25519.Sign(priv, h.Sum(nil))
+	blob := make([]byte, 0, 74)
+	blob = append(blob, minisignAlgPrehashed...)
+	blob = append(blob, id[:]...)
+	blob = append(blob, sig...)
+
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), trustedComment...))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%ssignature from ldfd key %016X\n", untrustedPrefix, binary.LittleEndian.Uint64(id[:]))
+	fmt.Fprintf(&out, "%s\n", base64.StdEncoding.EncodeToString(blob))
+	fmt.Fprintf(&out, "%s%s\n", trustedPrefix, trustedComment)
+	fmt.Fprintf(&out, "%s\n", base64.StdEncoding.EncodeToString(global))
+	return out.Bytes(), nil
+}
+
+// DetachedSignature is a parsed minisign signature file
+type DetachedSignature struct {
+	Algorithm      string
+	KeyID          [8]byte
+	Signature      []byte
+	TrustedComment string
+	GlobalSig      []byte
+}
+
+// ParseDetachedSignature decodes a minisign signature file
+func ParseDetachedSignature(data []byte) (*DetachedSignature, error) {
+	var sigLine, trusted, globalLine string
+	var sawTrusted bool
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, untrustedPrefix), line == "":
+		case strings.HasPrefix(line, trustedPrefix):
+			trusted = strings.TrimPrefix(line, trustedPrefix)
+			sawTrusted = true
+		case sigLine == "":
+			sigLine = line
+		case sawTrusted && globalLine == "":
+			globalLine = line
+		}
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(sigLine)
+	if err != nil || len(blob) != 74 {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+	alg := string(blob[:2])
+	if alg != minisignAlgLegacy && alg != minisignAlgPrehashed {
+		return nil, fmt.Errorf("unsupported minisign signature algorithm: %s", alg)
+	}
+
+	global, err := base64.StdEncoding.DecodeString(globalLine)
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign trusted comment signature")
+	}
+
+	sig := &DetachedSignature{
+		Algorithm:      alg,
+		Signature:      blob[10:],
+		TrustedComment: trusted,
+		GlobalSig:      global,
+	}
+	copy(sig.KeyID[:], blob[2:10])
+	return sig, nil
+}
+
+// VerifyDetached checks a minisign signature of r against pub and returns
+// the verified trusted comment
+func VerifyDetached(pub ed25519.PublicKey, r io.Reader, sigData []byte) (string, error) {
+	sig, err := ParseDetachedSignature(sigData)
+	if err != nil {
+		return "", err
+	}
+	if sig.KeyID != MinisignKeyID(pub) {
+		return "", fmt.Errorf("signature was made by key %016X: %w",
+			binary.LittleEndian.Uint64(sig.KeyID[:]), ErrInvalidSignature)
+	}
+
+	var message []byte
+	if sig.Algorithm == minisignAlgPrehashed {
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, r); err != nil {
+			return "", fmt.Errorf("failed to hash signed data: %w", err)
+		}
+		message = h.Sum(nil)
+	} else {
+		if message, err = io.ReadAll(r); err != nil {
+			return "", fmt.Errorf("failed to read signed data: %w", err)
+		}
+	}
+
+	if !ed25519.Verify(pub, message, sig.Signature) {
+		return "", ErrInvalidSignature
+	}
+	if !ed25519.Verify(pub, append(append([]byte{}, sig.Signature...), sig.TrustedComment...), sig.GlobalSig) {
+		return "", fmt.Errorf("trusted comment was modified: %w", ErrInvalidSignature)
+	}
+
+	return sig.TrustedComment, nil
+}
+
+// commentFreeLines returns the non-empty lines of data that are not comments
+func commentFreeLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, untrustedPrefix) || strings.HasPrefix(line, trustedPrefix) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
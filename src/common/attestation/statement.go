@@ -0,0 +1,97 @@
+package attestation
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// StatementType is the in-toto statement type
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateSLSAProvenance is the SLSA provenance predicate type
+	PredicateSLSAProvenance = "https://slsa.dev/provenance/v1"
+	// BuildTypeLDF identifies ldfd builds in provenance build definitions
+	BuildTypeLDF = "https://github.com/bitswalk/ldf/build/v1"
+)
+
+// Statement is an in-toto v1 statement carrying a SLSA provenance predicate
+type Statement struct {
+	Type          string     `json:"_type"`
+	Subject       []Subject  `json:"subject"`
+	PredicateType string     `json:"predicateType"`
+	Predicate     Provenance `json:"predicate"`
+}
+
+// Subject identifies an artifact the statement is about
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is the SLSA v1 provenance predicate
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of a build
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies,omitempty"`
+}
+
+// RunDetails describes the builder and a single build invocation
+type RunDetails struct {
+	Builder    Builder              `json:"builder"`
+	Metadata   BuildMetadata        `json:"metadata"`
+	Byproducts []ResourceDescriptor `json:"byproducts,omitempty"`
+}
+
+// Builder identifies the platform that ran the build
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// BuildMetadata records when and as which invocation a build ran
+type BuildMetadata struct {
+	InvocationID string `json:"invocationId"`
+	StartedOn    string `json:"startedOn,omitempty"`
+	FinishedOn   string `json:"finishedOn,omitempty"`
+}
+
+// ResourceDescriptor references an artifact consumed or produced by a build
+type ResourceDescriptor struct {
+	Name        string                 `json:"name,omitempty"`
+	URI         string                 `json:"uri,omitempty"`
+	Digest      map[string]string      `json:"digest,omitempty"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+}
+
+// ParseStatement decodes an in-toto statement and checks its types
+func ParseStatement(data []byte) (*Statement, error) {
+	var st Statement
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid statement: %w", err)
+	}
+	if st.Type != StatementType {
+		return nil, fmt.Errorf("unsupported statement type: %s", st.Type)
+	}
+	if st.PredicateType != PredicateSLSAProvenance {
+		return nil, fmt.Errorf("unsupported predicate type: %s", st.PredicateType)
+	}
+	return &st, nil
+}
+
+// VerifySubject checks that the statement covers an artifact with the given
+// SHA-256 digest and returns the matching subject
+func (st *Statement) VerifySubject(sha256Hex string) (*Subject, error) {
+	for i := range st.Subject {
+		if st.Subject[i].Digest["sha256"] == sha256Hex {
+			return &st.Subject[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no attestation subject matches sha256:%s", sha256Hex)
+}
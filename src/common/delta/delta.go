@@ -0,0 +1,401 @@
+// Package delta creates and applies binary deltas between two build images, shared by ldfd and ldfctl.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// A delta starts with Magic, a big-endian uint32 length and the JSON
+// Header, readable without decompressing anything. An xz stream of
+// operations follows that rebuild the target from the source image:
+//
+//	'C' offset:uint64 length:uint64   copy a range of the source
+//	'Z' length:uint64                 write zeros
+//	'D' length:uint32 data            write literal bytes
+//	'E'                               end of the delta
+//
+// Matching works on fixed-size chunks, which suits disk images whose
+// filesystems keep unchanged files at the same block-aligned positions.
+const (
+	// Magic identifies delta files
+	Magic = "LDFDELTA"
+	// FormatName identifies deltas in the header
+	FormatName = "ldf-delta"
+	// FormatVersion is the format version written by this package
+	FormatVersion = 1
+	// Extension is the file extension of deltas
+	Extension = ".ldfdelta"
+	// ContentType is the media type deltas are stored with
+	ContentType = "application/vnd.ldf.delta"
+	// DefaultChunkSize is the matching granularity used by Create
+	DefaultChunkSize = 64 * 1024
+
+	opCopy = 'C'
+	opZero = 'Z'
+	opData = 'D'
+	opEnd  = 'E'
+
+	// maxHeaderSize bounds the header a reader accepts
+	maxHeaderSize = 64 * 1024
+)
+
+var (
+	// ErrSourceMismatch is returned when the source image is not the one the delta was created from
+	ErrSourceMismatch = errors.New("source image does not match the delta")
+	// ErrTargetMismatch is returned when the reconstructed image fails verification
+	ErrTargetMismatch = errors.New("reconstructed image does not match the target checksum")
+)
+
+// Header describes the images a delta connects
+type Header struct {
+	Format       string `json:"format"`
+	Version      int    `json:"version"`
+	ChunkSize    int    `json:"chunk_size"`
+	SourceSize   int64  `json:"source_size"`
+	SourceSHA256 string `json:"source_sha256"`
+	TargetSize   int64  `json:"target_size"`
+	TargetSHA256 string `json:"target_sha256"`
+}
+
+// Stats summarizes how a delta rebuilds its target
+type Stats struct {
+	CopiedBytes  int64 `json:"copied_bytes"`
+	ZeroBytes    int64 `json:"zero_bytes"`
+	LiteralBytes int64 `json:"literal_bytes"`
+}
+
+// Create writes a delta rebuilding target from source to w
+func Create(w io.Writer, source io.ReaderAt, sourceSize int64, target io.ReaderAt, targetSize int64) (*Header, *Stats, error) {
+	chunkSize := DefaultChunkSize
+
+	// Index every full source chunk by content
+	index := make(map[[sha256.Size]byte]int64)
+	var chunkSums [][sha256.Size]byte
+	sourceHash := sha256.New()
+	buf := make([]byte, chunkSize)
+	for off := int64(0); off < sourceSize; off += int64(chunkSize) {
+		n, err := readChunk(source, buf, off, sourceSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read source: %w", err)
+		}
+		sourceHash.Write(buf[:n])
+		if n == chunkSize {
+			sum := sha256.Sum256(buf)
+			if _, ok := index[sum]; !ok {
+				index[sum] = off
+			}
+			chunkSums = append(chunkSums, sum)
+		}
+	}
+
+	targetSum, err := hashRange(target, targetSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read target: %w", err)
+	}
+
+	header := &Header{
+		Format:       FormatName,
+		Version:      FormatVersion,
+		ChunkSize:    chunkSize,
+		SourceSize:   sourceSize,
+		SourceSHA256: hex.EncodeToString(sourceHash.Sum(nil)),
+		TargetSize:   targetSize,
+		TargetSHA256: targetSum,
+	}
+	if err := writeHeader(w, header); err != nil {
+		return nil, nil, err
+	}
+
+	xw, err := xz.NewWriter(w)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start compression: %w", err)
+	}
+	enc := &encoder{w: bufio.NewWriter(xw)}
+
+	zero := make([]byte, chunkSize)
+	for off := int64(0); off < targetSize; off += int64(chunkSize) {
+		n, err := readChunk(target, buf, off, targetSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read target: %w", err)
+		}
+		chunk := buf[:n]
+
+		if bytes.Equal(chunk, zero[:n]) {
+			enc.zero(int64(n))
+			continue
+		}
+		if n == chunkSize {
+			sum := sha256.Sum256(chunk)
+			// Prefer the chunk right after the previous copy so runs merge
+			if next := enc.copyEnd / int64(chunkSize); enc.last == opCopy && next < int64(len(chunkSums)) && chunkSums[next] == sum {
+				enc.copy(enc.copyEnd, int64(n))
+				continue
+			}
+			if srcOff, ok := index[sum]; ok {
+				enc.copy(srcOff, int64(n))
+				continue
+			}
+		}
+		enc.data(chunk)
+	}
+
+	if err := enc.end(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write delta: %w", err)
+	}
+	if err := xw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to finish compression: %w", err)
+	}
+
+	return header, &enc.stats, nil
+}
+
+// ReadHeader reads the header at the start of a delta
+func ReadHeader(r io.Reader) (*Header, error) {
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != Magic {
+		return nil, fmt.Errorf("not an LDF delta")
+	}
+
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read delta header: %w", err)
+	}
+	if size > maxHeaderSize {
+		return nil, fmt.Errorf("delta header too large (%d bytes)", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read delta header: %w", err)
+	}
+
+	var h Header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("invalid delta header: %w", err)
+	}
+	if h.Format != FormatName {
+		return nil, fmt.Errorf("not an LDF delta (format %q)", h.Format)
+	}
+	if h.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported delta version %d", h.Version)
+	}
+	return &h, nil
+}
+
+// Apply rebuilds the target image of a delta read from r into w. The
+// source is verified before anything is written and the output after.
+func Apply(w io.Writer, source io.ReaderAt, sourceSize int64, r io.Reader) (*Header, error) {
+	header, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if sourceSize != header.SourceSize {
+		return nil, ErrSourceMismatch
+	}
+	sourceSum, err := hashRange(source, sourceSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	if sourceSum != header.SourceSHA256 {
+		return nil, ErrSourceMismatch
+	}
+
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta: %w", err)
+	}
+	ops := bufio.NewReader(xr)
+
+	targetHash := sha256.New()
+	out := io.MultiWriter(w, targetHash)
+	var written int64
+
+	for {
+		op, err := ops.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated delta: %w", err)
+		}
+
+		switch op {
+		case opCopy:
+			var args [2]uint64
+			if err := binary.Read(ops, binary.BigEndian, &args); err != nil {
+				return nil, fmt.Errorf("truncated delta: %w", err)
+			}
+			off, length := int64(args[0]), int64(args[1])
+			if off < 0 || length < 0 || off+length > sourceSize {
+				return nil, fmt.Errorf("delta copies outside the source image")
+			}
+			if length > header.TargetSize-written {
+				return nil, ErrTargetMismatch
+			}
+			if _, err := io.Copy(out, io.NewSectionReader(source, off, length)); err != nil {
+				return nil, fmt.Errorf("failed to copy source range: %w", err)
+			}
+			written += length
+
+		case opZero:
+			var length uint64
+			if err := binary.Read(ops, binary.BigEndian, &length); err != nil {
+				return nil, fmt.Errorf("truncated delta: %w", err)
+			}
+			if int64(length) < 0 || int64(length) > header.TargetSize-written {
+				return nil, ErrTargetMismatch
+			}
+			if err := writeZeros(out, int64(length)); err != nil {
+				return nil, err
+			}
+			written += int64(length)
+
+		case opData:
+			var length uint32
+			if err := binary.Read(ops, binary.BigEndian, &length); err != nil {
+				return nil, fmt.Errorf("truncated delta: %w", err)
+			}
+			if int64(length) > header.TargetSize-written {
+				return nil, ErrTargetMismatch
+			}
+			if _, err := io.CopyN(out, ops, int64(length)); err != nil {
+				return nil, fmt.Errorf("truncated delta: %w", err)
+			}
+			written += int64(length)
+
+		case opEnd:
+			if written != header.TargetSize || hex.EncodeToString(targetHash.Sum(nil)) != header.TargetSHA256 {
+				return nil, ErrTargetMismatch
+			}
+			return header, nil
+
+		default:
+			return nil, fmt.Errorf("invalid delta operation %q", op)
+		}
+	}
+}
+
+// encoder emits delta operations, merging adjacent copies and zero runs
+type encoder struct {
+	w       *bufio.Writer
+	last    byte
+	copyOff int64
+	copyEnd int64
+	zeroLen int64
+	stats   Stats
+	err     error
+}
+
+func (e *encoder) copy(off, length int64) {
+	if e.last == opCopy && off == e.copyEnd {
+		e.copyEnd += length
+	} else {
+		e.flush()
+		e.last, e.copyOff, e.copyEnd = opCopy, off, off+length
+	}
+	e.stats.CopiedBytes += length
+}
+
+func (e *encoder) zero(length int64) {
+	if e.last != opZero {
+		e.flush()
+		e.last = opZero
+	}
+	e.zeroLen += length
+	e.stats.ZeroBytes += length
+}
+
+func (e *encoder) data(b []byte) {
+	e.flush()
+	e.write([]byte{opData})
+	e.write(binary.BigEndian.AppendUint32(nil, uint32(len(b))))
+	e.write(b)
+	e.stats.LiteralBytes += int64(len(b))
+}
+
+// flush writes the pending copy or zero run
+func (e *encoder) flush() {
+	switch e.last {
+	case opCopy:
+		buf := []byte{opCopy}
+		buf = binary.BigEndian.AppendUint64(buf, uint64(e.copyOff))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(e.copyEnd-e.copyOff))
+		e.write(buf)
+	case opZero:
+		e.write(binary.BigEndian.AppendUint64([]byte{opZero}, uint64(e.zeroLen)))
+		e.zeroLen = 0
+	}
+	e.last = 0
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) end() error {
+	e.flush()
+	e.write([]byte{opEnd})
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// writeHeader writes the magic and the length-prefixed JSON header
+func writeHeader(w io.Writer, h *Header) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to encode delta header: %w", err)
+	}
+	buf := append([]byte(Magic), binary.BigEndian.AppendUint32(nil, uint32(len(data)))...)
+	if _, err := w.Write(append(buf, data...)); err != nil {
+		return fmt.Errorf("failed to write delta header: %w", err)
+	}
+	return nil
+}
+
+// readChunk reads the chunk at off, shorter at the end of the image
+func readChunk(r io.ReaderAt, buf []byte, off, size int64) (int, error) {
+	n := len(buf)
+	if rest := size - off; rest < int64(n) {
+		n = int(rest)
+	}
+	if _, err := r.ReadAt(buf[:n], off); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	return n, nil
+}
+
+// hashRange returns the hex SHA-256 of the first size bytes of r
+func hashRange(r io.ReaderAt, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeZeros writes length zero bytes to w
+func writeZeros(w io.Writer, length int64) error {
+	zero := make([]byte, DefaultChunkSize)
+	for length > 0 {
+		n := int64(len(zero))
+		if length < n {
+			n = length
+		}
+		if _, err := w.Write(zero[:n]); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		length -= n
+	}
+	return nil
+}
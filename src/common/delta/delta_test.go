@@ -0,0 +1,111 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// testImage returns size pseudo-random bytes
+func testImage(seed int64, size int) []byte {
+	img := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(img)
+	return img
+}
+
+func TestCreateApply(t *testing.T) {
+	source := testImage(1, 40*DefaultChunkSize+123)
+	clear(source[20*DefaultChunkSize : 23*DefaultChunkSize])
+
+	// The target changes one chunk, moves another and grows the image
+	target := append([]byte(nil), source...)
+	copy(target[5*DefaultChunkSize:], bytes.Repeat([]byte{0xab}, 100))
+	copy(target[30*DefaultChunkSize:31*DefaultChunkSize], source[2*DefaultChunkSize:3*DefaultChunkSize])
+	target = append(target, testImage(2, 2*DefaultChunkSize)...)
+
+	var d bytes.Buffer
+	header, stats, err := Create(&d, bytes.NewReader(source), int64(len(source)), bytes.NewReader(target), int64(len(target)))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if header.TargetSize != int64(len(target)) {
+		t.Errorf("TargetSize = %d, want %d", header.TargetSize, len(target))
+	}
+	if stats.CopiedBytes+stats.ZeroBytes+stats.LiteralBytes != int64(len(target)) {
+		t.Errorf("stats %+v do not cover the target", stats)
+	}
+	if stats.LiteralBytes > 4*DefaultChunkSize {
+		t.Errorf("expected mostly copied chunks, got %d literal bytes", stats.LiteralBytes)
+	}
+	if d.Len() > len(target)/4 {
+		t.Errorf("delta is %d bytes for a %d byte image", d.Len(), len(target))
+	}
+
+	var out bytes.Buffer
+	applied, err := Apply(&out, bytes.NewReader(source), int64(len(source)), bytes.NewReader(d.Bytes()))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), target) {
+		t.Error("reconstructed image differs from the target")
+	}
+	if applied.TargetSHA256 != header.TargetSHA256 {
+		t.Errorf("Apply() header = %+v", applied)
+	}
+}
+
+func TestApply_WrongSource(t *testing.T) {
+	source := testImage(1, 8*DefaultChunkSize)
+	target := testImage(2, 8*DefaultChunkSize)
+
+	var d bytes.Buffer
+	if _, _, err := Create(&d, bytes.NewReader(source), int64(len(source)), bytes.NewReader(target), int64(len(target))); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	other := testImage(3, len(source))
+	var out bytes.Buffer
+	_, err := Apply(&out, bytes.NewReader(other), int64(len(other)), bytes.NewReader(d.Bytes()))
+	if !errors.Is(err, ErrSourceMismatch) {
+		t.Errorf("Apply() error = %v, want ErrSourceMismatch", err)
+	}
+	if out.Len() != 0 {
+		t.Error("nothing should be written for a mismatching source")
+	}
+}
+
+func TestApply_TamperedTarget(t *testing.T) {
+	source := testImage(1, 8*DefaultChunkSize)
+	target := testImage(2, 8*DefaultChunkSize)
+
+	var d bytes.Buffer
+	if _, _, err := Create(&d, bytes.NewReader(source), int64(len(source)), bytes.NewReader(target), int64(len(target))); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Rewrite the header with a different target checksum
+	header, err := ReadHeader(bytes.NewReader(d.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadHeader() error = %v", err)
+	}
+	var tampered bytes.Buffer
+	header.TargetSHA256 = header.SourceSHA256
+	if err := writeHeader(&tampered, header); err != nil {
+		t.Fatal(err)
+	}
+	rest := d.Bytes()[len(Magic)+4:]
+	rest = rest[bytes.IndexByte(rest, '}')+1:]
+	tampered.Write(rest)
+
+	_, err = Apply(&bytes.Buffer{}, bytes.NewReader(source), int64(len(source)), &tampered)
+	if !errors.Is(err, ErrTargetMismatch) {
+		t.Errorf("Apply() error = %v, want ErrTargetMismatch", err)
+	}
+}
+
+func TestReadHeader_NotDelta(t *testing.T) {
+	if _, err := ReadHeader(bytes.NewReader([]byte("not a delta file"))); err == nil {
+		t.Error("expected error for non-delta input")
+	}
+}
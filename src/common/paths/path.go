@@ -2,8 +2,10 @@
 package paths
 
 import (
+	"fmt"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -43,6 +45,25 @@ func ExpandHome(path string) string {
 	return path
 }
 
+// CleanRelative normalizes a slash-separated path that must stay below
+// the directory it is relative to, rejecting absolute paths, ".."
+// elements and paths naming the directory itself
+func CleanRelative(p string) (string, error) {
+	if strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("invalid relative path %q", p)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid relative path %q", p)
+		}
+	}
+	cleaned := path.Clean("/" + p)[1:]
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid relative path %q", p)
+	}
+	return cleaned, nil
+}
+
 // EnsureDir ensures that the directory for the given path exists.
 // If the path is a file path, it creates the parent directory.
 func EnsureDir(path string) error {
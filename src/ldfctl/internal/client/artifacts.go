@@ -32,6 +32,16 @@ type StorageStatusResponse struct {
 	Endpoint  string `json:"endpoint,omitempty"`
 }
 
+// ArtifactVerifyResponse represents a server-side signature check of an artifact
+type ArtifactVerifyResponse struct {
+	Path           string `json:"path"`
+	Valid          bool   `json:"valid"`
+	KeyID          string `json:"key_id,omitempty"`
+	KeyName        string `json:"key_name,omitempty"`
+	TrustedComment string `json:"trusted_comment,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
 // ListArtifacts returns artifacts for a distribution
 func (c *Client) ListArtifacts(ctx context.Context, distID string) (*ArtifactListResponse, error) {
 	var resp ArtifactListResponse
@@ -128,3 +138,12 @@ func (c *Client) GetStorageStatus(ctx context.Context) (*StorageStatusResponse,
 	}
 	return &resp, nil
 }
+
+// VerifyArtifact asks the server to check an artifact against its detached signature
+func (c *Client) VerifyArtifact(ctx context.Context, distID, artifactPath string) (*ArtifactVerifyResponse, error) {
+	var resp ArtifactVerifyResponse
+	if err := c.Get(ctx, fmt.Sprintf("/v1/distributions/%s/artifacts-verify/%s", distID, artifactPath), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
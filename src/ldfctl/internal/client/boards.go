@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BoardProfile represents a board profile
+type BoardProfile struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"display_name"`
+	Description string          `json:"description"`
+	Arch        string          `json:"arch"`
+	Config      json.RawMessage `json:"config"`
+	IsSystem    bool            `json:"is_system"`
+	OwnerID     string          `json:"owner_id,omitempty"`
+	ParentID    string          `json:"parent_id,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// BoardProfileListResponse represents a list of board profiles
+type BoardProfileListResponse struct {
+	Count    int            `json:"count"`
+	Profiles []BoardProfile `json:"profiles"`
+}
+
+// ResolvedBoardProfileResponse is a board profile with its ancestors' configuration merged in
+type ResolvedBoardProfileResponse struct {
+	Profile BoardProfile `json:"profile"`
+	Chain   []string     `json:"chain"`
+}
+
+// BoardProfileFile is a file attached to a board profile
+type BoardProfileFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// BoardProfileFileListResponse represents the files attached to a board profile
+type BoardProfileFileListResponse struct {
+	Count int                `json:"count"`
+	Files []BoardProfileFile `json:"files"`
+}
+
+// ImportBoardProfileResponse reports the profiles an imported bundle created
+type ImportBoardProfileResponse struct {
+	Profile BoardProfile `json:"profile"`
+	Created []string     `json:"created"`
+	Reused  []string     `json:"reused"`
+}
+
+// ListBoardProfiles returns all board profiles, optionally filtered by architecture
+func (c *Client) ListBoardProfiles(ctx context.Context, arch string) (*BoardProfileListResponse, error) {
+	path := "/v1/board/profiles"
+	if arch != "" {
+		path += "?arch=" + url.QueryEscape(arch)
+	}
+	var resp BoardProfileListResponse
+	if err := c.Get(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetBoardProfile returns a single board profile by ID
+func (c *Client) GetBoardProfile(ctx context.Context, id string) (*BoardProfile, error) {
+	var resp BoardProfile
+	if err := c.Get(ctx, fmt.Sprintf("/v1/board/profiles/%s", id), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ResolveBoardProfile returns a board profile with its parent chain merged in
+func (c *Client) ResolveBoardProfile(ctx context.Context, id string) (*ResolvedBoardProfileResponse, error) {
+	var resp ResolvedBoardProfileResponse
+	if err := c.Get(ctx, fmt.Sprintf("/v1/board/profiles/%s/resolved", id), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteBoardProfile deletes a board profile
+func (c *Client) DeleteBoardProfile(ctx context.Context, id string) error {
+	return c.Delete(ctx, fmt.Sprintf("/v1/board/profiles/%s", id), nil)
+}
+
+// ListBoardProfileFiles returns the files attached to a board profile
+func (c *Client) ListBoardProfileFiles(ctx context.Context, id string) (*BoardProfileFileListResponse, error) {
+	var resp BoardProfileFileListResponse
+	if err := c.Get(ctx, fmt.Sprintf("/v1/board/profiles/%s/files", id), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AttachBoardProfileFile uploads a local file to a board profile at filePath
+func (c *Client) AttachBoardProfileFile(ctx context.Context, id, filePath, localPath string) (*BoardProfileFile, error) {
+	var resp BoardProfileFile
+	if err := c.uploadMultipart(ctx, http.MethodPut, fmt.Sprintf("/v1/board/profiles/%s/files/%s", id, filePath), localPath, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DetachBoardProfileFile removes a file attached to a board profile
+func (c *Client) DetachBoardProfileFile(ctx context.Context, id, filePath string) error {
+	return c.Delete(ctx, fmt.Sprintf("/v1/board/profiles/%s/files/%s", id, filePath), nil)
+}
+
+// ExportBoardProfile downloads a board profile bundle to a local file
+func (c *Client) ExportBoardProfile(ctx context.Context, id, destPath string) error {
+	resp, err := c.RawGet(ctx, fmt.Sprintf("/v1/board/profiles/%s/export", id))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// ImportBoardProfile uploads a board profile bundle
+func (c *Client) ImportBoardProfile(ctx context.Context, bundlePath string) (*ImportBoardProfileResponse, error) {
+	var resp ImportBoardProfileResponse
+	if err := c.uploadMultipart(ctx, http.MethodPost, "/v1/board/profiles/import", bundlePath, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// uploadMultipart streams a local file as the "file" form field of a request
+func (c *Client) uploadMultipart(ctx context.Context, method, path, localPath string, result interface{}) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		defer pw.Close()
+		part, err := writer.CreateFormFile("file", filepath.Base(localPath))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		writer.Close()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, pr)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return c.Do(req, result)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+)
+
+// BuilderImage represents a builder image variant for a target architecture
+type BuilderImage struct {
+	TargetArch   string   `json:"target_arch"`
+	Image        string   `json:"image"`
+	Digest       string   `json:"digest,omitempty"`
+	Status       string   `json:"status"`
+	MissingTools []string `json:"missing_tools,omitempty"`
+	ErrorMessage string   `json:"error_message,omitempty"`
+	StartedAt    string   `json:"started_at,omitempty"`
+	CompletedAt  string   `json:"completed_at,omitempty"`
+}
+
+// BuilderImagesListResponse represents the builder image variants
+type BuilderImagesListResponse struct {
+	Count  int            `json:"count"`
+	Images []BuilderImage `json:"images"`
+}
+
+// BuildBuilderImageRequest represents the request to build a builder image
+type BuildBuilderImageRequest struct {
+	Arch    string `json:"arch,omitempty"`
+	NoCache bool   `json:"no_cache,omitempty"`
+}
+
+// ListBuilderImages returns the builder image variants
+func (c *Client) ListBuilderImages(ctx context.Context) (*BuilderImagesListResponse, error) {
+	var resp BuilderImagesListResponse
+	if err := c.Get(ctx, "/v1/builder-images", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BuildBuilderImage starts building the builder image for an architecture
+func (c *Client) BuildBuilderImage(ctx context.Context, req *BuildBuilderImageRequest) (*BuilderImage, error) {
+	var resp BuilderImage
+	if err := c.Post(ctx, "/v1/builder-images", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
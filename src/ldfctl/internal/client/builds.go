@@ -3,6 +3,11 @@ package client
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
 )
 
 // BuildJob represents a build job
@@ -22,6 +27,11 @@ type BuildJob struct {
 	ErrorStage       string       `json:"error_stage,omitempty"`
 	RetryCount       int          `json:"retry_count"`
 	MaxRetries       int          `json:"max_retries"`
+	BuilderImage     string       `json:"builder_image,omitempty"`
+	BuilderDigest    string       `json:"builder_image_digest,omitempty"`
+	VerifyOf         string       `json:"verify_of,omitempty"`
+	VerifyResult     string       `json:"verify_result,omitempty"`
+	VerifyDiff       []string     `json:"verify_diff,omitempty"`
 	CreatedAt        string       `json:"created_at"`
 	StartedAt        string       `json:"started_at,omitempty"`
 	CompletedAt      string       `json:"completed_at,omitempty"`
@@ -61,6 +71,64 @@ type BuildLogsResponse struct {
 	Logs  []BuildLogEntry `json:"logs"`
 }
 
+// RecoveryKey is the recovery key of a build's encrypted root
+type RecoveryKey struct {
+	BuildID     string `json:"build_id"`
+	LUKSUUID    string `json:"luks_uuid"`
+	RecoveryKey string `json:"recovery_key"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// UpdateBundle represents an OTA update bundle published by a build
+type UpdateBundle struct {
+	ID             string `json:"id"`
+	BuildID        string `json:"build_id"`
+	DistributionID string `json:"distribution_id"`
+	TargetArch     string `json:"target_arch"`
+	Compatible     string `json:"compatible"`
+	Version        string `json:"version"`
+	ArtifactPath   string `json:"artifact_path"`
+	Checksum       string `json:"checksum"`
+	SizeBytes      int64  `json:"size_bytes"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// UpdatesListResponse represents the update bundles a device can install
+type UpdatesListResponse struct {
+	From    string         `json:"from,omitempty"`
+	Count   int            `json:"count"`
+	Updates []UpdateBundle `json:"updates"`
+}
+
+// BuildDelta represents a binary delta between the images of two builds
+type BuildDelta struct {
+	ID             string `json:"id"`
+	DistributionID string `json:"distribution_id"`
+	SourceBuildID  string `json:"source_build_id"`
+	TargetBuildID  string `json:"target_build_id"`
+	Status         string `json:"status"`
+	ArtifactPath   string `json:"artifact_path,omitempty"`
+	Checksum       string `json:"checksum,omitempty"`
+	SizeBytes      int64  `json:"size_bytes"`
+	SourceChecksum string `json:"source_checksum,omitempty"`
+	TargetChecksum string `json:"target_checksum,omitempty"`
+	ErrorMessage   string `json:"error_message,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	CompletedAt    string `json:"completed_at,omitempty"`
+}
+
+// DeltasListResponse represents the binary deltas of a distribution
+type DeltasListResponse struct {
+	Count  int          `json:"count"`
+	Deltas []BuildDelta `json:"deltas"`
+}
+
+// CreateDeltaRequest represents the request to compute a binary delta
+type CreateDeltaRequest struct {
+	FromBuild string `json:"from_build"`
+	ToBuild   string `json:"to_build"`
+}
+
 // StartBuildRequest represents the request to start a build
 type StartBuildRequest struct {
 	Arch   string `json:"arch,omitempty"`
@@ -94,6 +162,21 @@ func (c *Client) ListDistributionBuilds(ctx context.Context, distID string, opts
 	return &resp, nil
 }
 
+// ListDistributionUpdates returns the update bundles of a distribution.
+// A non-empty from build ID limits them to bundles installable on it.
+func (c *Client) ListDistributionUpdates(ctx context.Context, distID, from string) (*UpdatesListResponse, error) {
+	path := fmt.Sprintf("/v1/distributions/%s/updates", distID)
+	if from != "" {
+		path += "?from=" + url.QueryEscape(from)
+	}
+
+	var resp UpdatesListResponse
+	if err := c.Get(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // GetBuildLogs returns log entries for a build
 func (c *Client) GetBuildLogs(ctx context.Context, buildID string) (*BuildLogsResponse, error) {
 	var resp BuildLogsResponse
@@ -113,6 +196,115 @@ func (c *Client) RetryBuild(ctx context.Context, buildID string) error {
 	return c.Post(ctx, fmt.Sprintf("/v1/builds/%s/retry", buildID), nil, nil)
 }
 
+// VerifyReproducible rebuilds a reproducible build and compares the result
+func (c *Client) VerifyReproducible(ctx context.Context, buildID string) (*BuildJob, error) {
+	var resp BuildJob
+	if err := c.Post(ctx, fmt.Sprintf("/v1/builds/%s/verify-reproducible", buildID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DownloadBuildSBOM downloads the SBOM of a build in the given format
+// (spdx or cyclonedx) to a local file
+func (c *Client) DownloadBuildSBOM(ctx context.Context, buildID, format, destPath string) error {
+	resp, err := c.RawGet(ctx, fmt.Sprintf("/v1/builds/%s/sbom?format=%s", buildID, url.QueryEscape(format)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// BuildArtifactDir returns the artifact path, relative to the build's
+// distribution, of the directory holding the files a build published
+func BuildArtifactDir(build *BuildJob) (string, error) {
+	i := strings.Index(build.ArtifactPath, "/builds/")
+	if i < 0 {
+		return "", fmt.Errorf("build %s has no published image", build.ID)
+	}
+	return path.Dir(build.ArtifactPath[i+1:]), nil
+}
+
+// DownloadBuildFile downloads a file published next to a build's image,
+// such as its VM launch script, to a local file
+func (c *Client) DownloadBuildFile(ctx context.Context, build *BuildJob, name, destPath string) error {
+	dir, err := BuildArtifactDir(build)
+	if err != nil {
+		return err
+	}
+	return c.DownloadArtifact(ctx, build.DistributionID, path.Join(dir, name), destPath)
+}
+
+// GetBuildRecoveryKey returns the recovery key of a build's encrypted root
+func (c *Client) GetBuildRecoveryKey(ctx context.Context, buildID string) (*RecoveryKey, error) {
+	var resp RecoveryKey
+	if err := c.Get(ctx, fmt.Sprintf("/v1/builds/%s/recovery-key", buildID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DownloadBuildRecoveryKey downloads the recovery key artifact a build
+// exported to a local file readable only by the current user
+func (c *Client) DownloadBuildRecoveryKey(ctx context.Context, buildID, destPath string) error {
+	resp, err := c.RawGet(ctx, fmt.Sprintf("/v1/builds/%s/recovery-key/artifact", buildID))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// CreateDelta starts computing the binary delta between two builds
+func (c *Client) CreateDelta(ctx context.Context, distID string, req *CreateDeltaRequest) (*BuildDelta, error) {
+	var resp BuildDelta
+	if err := c.Post(ctx, fmt.Sprintf("/v1/distributions/%s/deltas", distID), req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListDeltas returns the binary deltas of a distribution
+func (c *Client) ListDeltas(ctx context.Context, distID string) (*DeltasListResponse, error) {
+	var resp DeltasListResponse
+	if err := c.Get(ctx, fmt.Sprintf("/v1/distributions/%s/deltas", distID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDelta returns a single binary delta
+func (c *Client) GetDelta(ctx context.Context, distID, deltaID string) (*BuildDelta, error) {
+	var resp BuildDelta
+	if err := c.Get(ctx, fmt.Sprintf("/v1/distributions/%s/deltas/%s", distID, deltaID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // ListActiveBuilds returns all active builds
 func (c *Client) ListActiveBuilds(ctx context.Context) (*BuildJobsListResponse, error) {
 	var resp BuildJobsListResponse
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// SecureBootKeySet represents a server-managed PK/KEK/db hierarchy
+type SecureBootKeySet struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	OwnerGUID string `json:"owner_guid"`
+	PKCert    string `json:"pk_cert"`
+	KEKCert   string `json:"kek_cert"`
+	DBCert    string `json:"db_cert"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+}
+
+// SecureBootKeySetListResponse represents a list of Secure Boot key sets
+type SecureBootKeySetListResponse struct {
+	Count   int                `json:"count"`
+	KeySets []SecureBootKeySet `json:"key_sets"`
+}
+
+// SecureBootKeyPair is a PEM certificate with its RSA private key
+type SecureBootKeyPair struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// CreateSecureBootKeySetRequest represents the request to generate or import a key set
+type CreateSecureBootKeySetRequest struct {
+	Name      string             `json:"name"`
+	OwnerGUID string             `json:"owner_guid,omitempty"`
+	PK        *SecureBootKeyPair `json:"pk,omitempty"`
+	KEK       *SecureBootKeyPair `json:"kek,omitempty"`
+	DB        *SecureBootKeyPair `json:"db,omitempty"`
+	Activate  bool               `json:"activate"`
+}
+
+// ListSecureBootKeySets returns the server's Secure Boot key sets
+func (c *Client) ListSecureBootKeySets(ctx context.Context) (*SecureBootKeySetListResponse, error) {
+	var resp SecureBootKeySetListResponse
+	if err := c.Get(ctx, "/v1/secureboot/keys", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateSecureBootKeySet generates a new key set, or imports one when PK, KEK and DB are set
+func (c *Client) CreateSecureBootKeySet(ctx context.Context, req *CreateSecureBootKeySetRequest) (*SecureBootKeySet, error) {
+	var resp SecureBootKeySet
+	if err := c.Post(ctx, "/v1/secureboot/keys", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ActivateSecureBootKeySet makes a key set the default for builds
+func (c *Client) ActivateSecureBootKeySet(ctx context.Context, id string) (*SecureBootKeySet, error) {
+	var resp SecureBootKeySet
+	if err := c.Post(ctx, fmt.Sprintf("/v1/secureboot/keys/%s/activate", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteSecureBootKeySet removes a key set
+func (c *Client) DeleteSecureBootKeySet(ctx context.Context, id string) error {
+	return c.Delete(ctx, fmt.Sprintf("/v1/secureboot/keys/%s", id), nil)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// SigningKey represents a server attestation signing key
+type SigningKey struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+	RetiredAt string `json:"retired_at,omitempty"`
+}
+
+// SigningKeyListResponse represents a list of signing keys
+type SigningKeyListResponse struct {
+	Count int          `json:"count"`
+	Keys  []SigningKey `json:"signing_keys"`
+}
+
+// ListSigningKeys returns the server's public signing keys
+func (c *Client) ListSigningKeys(ctx context.Context) (*SigningKeyListResponse, error) {
+	var resp SigningKeyListResponse
+	if err := c.Get(ctx, "/v1/signing-keys", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetActiveSigningKey returns the key new attestations are signed with
+func (c *Client) GetActiveSigningKey(ctx context.Context) (*SigningKey, error) {
+	resp, err := c.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp.Keys {
+		if resp.Keys[i].Active {
+			return &resp.Keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("server has no active signing key")
+}
+
+// CreateSigningKeyRequest represents the request to generate or import a signing key
+type CreateSigningKeyRequest struct {
+	Name       string `json:"name"`
+	PrivateKey string `json:"private_key,omitempty"`
+	Activate   bool   `json:"activate"`
+}
+
+// CreateSigningKey generates a new signing key, or imports one when PrivateKey is set
+func (c *Client) CreateSigningKey(ctx context.Context, req *CreateSigningKeyRequest) (*SigningKey, error) {
+	var resp SigningKey
+	if err := c.Post(ctx, "/v1/signing-keys", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RotateSigningKey replaces the active signing key with a newly generated one
+func (c *Client) RotateSigningKey(ctx context.Context, name string) (*SigningKey, error) {
+	var resp SigningKey
+	if err := c.Post(ctx, "/v1/signing-keys/rotate", map[string]string{"name": name}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -2,9 +2,18 @@ package cmd
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/bitswalk/ldf/src/common/attestation"
+	"github.com/bitswalk/ldf/src/common/delta"
 	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -61,6 +70,44 @@ var artifactListAllCmd = &cobra.Command{
 	RunE:  runArtifactListAll,
 }
 
+var artifactPublicKeyCmd = &cobra.Command{
+	Use:   "public-key [dest]",
+	Short: "Save the server's active signing key",
+	Long: `Downloads the public key the server signs artifacts and build attestations
+with, as PEM or in minisign's public key format. Pass the saved file to
+'ldfctl artifact verify --public-key' to check signatures offline.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runArtifactPublicKey,
+}
+
+var artifactVerifyCmd = &cobra.Command{
+	Use:   "verify <file> <signature-file> | --distribution <id> <path>",
+	Short: "Verify an artifact signature or build attestation",
+	Long: `Checks offline that a file matches its detached minisign signature
+(<file>.minisig) or signed provenance attestation (provenance.intoto.json),
+using the public key given with --public-key. With --distribution, the
+server verifies a stored artifact against its signature instead.`,
+	Example: `  ldfctl artifact public-key ldfd.pub
+  ldfctl artifact verify disk.img disk.img.minisig --public-key ldfd.pub
+  ldfctl artifact verify disk.img provenance.intoto.json --public-key ldfd.pub
+  ldfctl artifact verify --distribution <dist-id> builds/<build-id>/disk.img`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runArtifactVerify,
+}
+
+var artifactApplyDeltaCmd = &cobra.Command{
+	Use:   "apply-delta <source-image> <delta-file> <output>",
+	Short: "Rebuild a build image from an older image and a binary delta",
+	Long: `Reconstructs the target image of a delta computed with 'ldfctl build delta'
+from the source image it was computed against. The source image is checked
+before anything is written and the output is verified against the target
+checksum recorded in the delta; nothing is left at <output> on failure.`,
+	Example: `  ldfctl artifact download <dist-id> builds/<build-id>/deltas/<from-build-id>.ldfdelta update.ldfdelta
+  ldfctl artifact apply-delta old.img update.ldfdelta new.img`,
+	Args: cobra.ExactArgs(3),
+	RunE: runArtifactApplyDelta,
+}
+
 func init() {
 	artifactCmd.AddCommand(artifactListCmd)
 	artifactCmd.AddCommand(artifactUploadCmd)
@@ -69,6 +116,14 @@ func init() {
 	artifactCmd.AddCommand(artifactURLCmd)
 	artifactCmd.AddCommand(artifactStorageStatusCmd)
 	artifactCmd.AddCommand(artifactListAllCmd)
+	artifactCmd.AddCommand(artifactPublicKeyCmd)
+	artifactCmd.AddCommand(artifactVerifyCmd)
+	artifactCmd.AddCommand(artifactApplyDeltaCmd)
+
+	artifactPublicKeyCmd.Flags().String("format", "pem", "Public key format (pem, minisign)")
+
+	artifactVerifyCmd.Flags().String("public-key", "", "Public key file (PEM or minisign) for offline verification")
+	artifactVerifyCmd.Flags().String("distribution", "", "Verify a stored artifact of this distribution on the server")
 }
 
 func runArtifactList(cmd *cobra.Command, args []string) error {
@@ -228,3 +283,239 @@ func runArtifactListAll(cmd *cobra.Command, args []string) error {
 		return nil
 	})
 }
+
+func runArtifactPublicKey(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "pem" && format != "minisign" {
+		return fmt.Errorf("unsupported public key format: %s (supported: pem, minisign)", format)
+	}
+
+	c := getClient()
+	ctx := context.Background()
+
+	key, err := c.GetActiveSigningKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	content := key.PublicKey
+	destPath := "ldfd-" + key.ID + ".pub"
+	if format == "minisign" {
+		pub, err := attestation.ParsePublicKeyPEM([]byte(key.PublicKey))
+		if err != nil {
+			return err
+		}
+		content = attestation.FormatMinisignPublicKey(pub)
+		destPath = "ldfd-" + key.ID + ".minisign.pub"
+	}
+	if len(args) > 0 {
+		destPath = args[0]
+	}
+
+	if err := os.WriteFile(destPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return output.PrintFormatted(getOutputFormat(), map[string]string{"message": "Public key saved", "key_id": key.ID, "path": destPath}, func() error {
+		output.PrintMessage(fmt.Sprintf("Public key %s saved to %s.", key.ID, destPath))
+		return nil
+	})
+}
+
+func runArtifactVerify(cmd *cobra.Command, args []string) error {
+	if distID, _ := cmd.Flags().GetString("distribution"); distID != "" {
+		return verifyArtifactRemote(distID, args[0])
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("offline verification requires <file> and <signature-file>")
+	}
+	keyPath, _ := cmd.Flags().GetString("public-key")
+	if keyPath == "" {
+		return fmt.Errorf("--public-key is required for offline verification")
+	}
+
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %w", err)
+	}
+	pub, err := attestation.ParsePublicKey(keyData)
+	if err != nil {
+		return err
+	}
+
+	sigData, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(sigData)), "{") {
+		return verifyAttestation(args[0], sigData, pub)
+	}
+	return verifyDetached(args[0], sigData, pub)
+}
+
+// verifyDetached checks a file against a minisign signature
+func verifyDetached(filePath string, sigData []byte, pub ed25519.PublicKey) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	comment, err := attestation.VerifyDetached(pub, f, sigData)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]string{
+		"message":         "Signature verified",
+		"file":            filePath,
+		"key_id":          attestation.KeyID(pub),
+		"trusted_comment": comment,
+	}
+
+	return output.PrintFormatted(getOutputFormat(), result, func() error {
+		output.PrintMessage(fmt.Sprintf("Verified %s, signed by key %s.", filepath.Base(filePath), result["key_id"]))
+		output.PrintMessage("Trusted comment: " + comment)
+		return nil
+	})
+}
+
+// verifyAttestation checks a file against a signed provenance envelope
+func verifyAttestation(filePath string, envData []byte, pub ed25519.PublicKey) error {
+	var env attestation.Envelope
+	if err := json.Unmarshal(envData, &env); err != nil {
+		return fmt.Errorf("invalid attestation envelope: %w", err)
+	}
+
+	payload, err := attestation.Verify(&env, pub)
+	if err != nil {
+		return err
+	}
+	statement, err := attestation.ParseStatement(payload)
+	if err != nil {
+		return err
+	}
+
+	digest, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	subject, err := statement.VerifySubject(digest)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]string{
+		"message":  "Attestation verified",
+		"subject":  subject.Name,
+		"sha256":   digest,
+		"key_id":   attestation.KeyID(pub),
+		"build_id": statement.Predicate.RunDetails.Metadata.InvocationID,
+	}
+
+	return output.PrintFormatted(getOutputFormat(), result, func() error {
+		output.PrintMessage(fmt.Sprintf("Verified %s (sha256:%s) from build %s, signed by key %s.",
+			subject.Name, digest, result["build_id"], result["key_id"]))
+		return nil
+	})
+}
+
+// verifyArtifactRemote asks the server to verify a stored artifact
+func verifyArtifactRemote(distID, artifactPath string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.VerifyArtifact(ctx, distID, artifactPath)
+	if err != nil {
+		return err
+	}
+
+	if err := output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Valid {
+			output.PrintMessage(fmt.Sprintf("Verified %s, signed by key %s (%s).", resp.Path, resp.KeyID, resp.KeyName))
+			output.PrintMessage("Trusted comment: " + resp.TrustedComment)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if !resp.Valid {
+		return fmt.Errorf("signature verification failed for %s: %s", resp.Path, resp.Error)
+	}
+	return nil
+}
+
+// runArtifactApplyDelta rebuilds a target image from a local source image
+// and a delta file, and verifies its SHA-256 digest
+func runArtifactApplyDelta(cmd *cobra.Command, args []string) error {
+	sourcePath, deltaPath, outputPath := args[0], args[1], args[2]
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open source image: %w", err)
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source image: %w", err)
+	}
+
+	deltaFile, err := os.Open(deltaPath)
+	if err != nil {
+		return fmt.Errorf("failed to open delta: %w", err)
+	}
+	defer deltaFile.Close()
+
+	// Write next to the output and rename only once the image verifies
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+
+	header, err := delta.Apply(tmp, source, info.Size(), deltaFile)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write output: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), outputPath); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	result := map[string]string{
+		"message": "Delta applied",
+		"path":    outputPath,
+		"sha256":  header.TargetSHA256,
+		"size":    fmt.Sprintf("%d", header.TargetSize),
+	}
+
+	return output.PrintFormatted(getOutputFormat(), result, func() error {
+		output.PrintMessage(fmt.Sprintf("Rebuilt %s (%d bytes) from %s.", outputPath, header.TargetSize, filepath.Base(sourcePath)))
+		output.PrintMessage("Verified SHA-256: " + header.TargetSHA256)
+		return nil
+	})
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 digest of a local file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var boardCmd = &cobra.Command{
+	Use:     "board",
+	Aliases: []string{"bp"},
+	Short:   "Manage board profiles",
+}
+
+var boardListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List board profiles",
+	RunE:  runBoardList,
+}
+
+var boardGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Get a board profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBoardGet,
+}
+
+var boardResolveCmd = &cobra.Command{
+	Use:   "resolve <id>",
+	Short: "Show a board profile with its parent chain merged in",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBoardResolve,
+}
+
+var boardDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a board profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBoardDelete,
+}
+
+var boardFilesCmd = &cobra.Command{
+	Use:   "files <id>",
+	Short: "List the files attached to a board profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBoardFiles,
+}
+
+var boardAttachCmd = &cobra.Command{
+	Use:   "attach <id> <path> <file>",
+	Short: "Attach a firmware or device tree file to a board profile at path",
+	Args:  cobra.ExactArgs(3),
+	RunE:  runBoardAttach,
+}
+
+var boardDetachCmd = &cobra.Command{
+	Use:   "detach <id> <path>",
+	Short: "Remove a file attached to a board profile",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runBoardDetach,
+}
+
+var boardExportCmd = &cobra.Command{
+	Use:   "export <id> [dest]",
+	Short: "Export a board profile, its ancestors and their files as a bundle",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runBoardExport,
+}
+
+var boardImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a board profile bundle",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBoardImport,
+}
+
+func init() {
+	boardCmd.AddCommand(boardListCmd)
+	boardCmd.AddCommand(boardGetCmd)
+	boardCmd.AddCommand(boardResolveCmd)
+	boardCmd.AddCommand(boardDeleteCmd)
+	boardCmd.AddCommand(boardFilesCmd)
+	boardCmd.AddCommand(boardAttachCmd)
+	boardCmd.AddCommand(boardDetachCmd)
+	boardCmd.AddCommand(boardExportCmd)
+	boardCmd.AddCommand(boardImportCmd)
+
+	boardListCmd.Flags().String("arch", "", "Filter by architecture (x86_64, aarch64)")
+}
+
+func runBoardList(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	arch, _ := cmd.Flags().GetString("arch")
+	resp, err := c.ListBoardProfiles(ctx, arch)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+
+		if len(resp.Profiles) == 0 {
+			output.PrintMessage("No board profiles found.")
+			return nil
+		}
+
+		names := make(map[string]string, len(resp.Profiles))
+		for _, bp := range resp.Profiles {
+			names[bp.ID] = bp.Name
+		}
+
+		rows := make([][]string, len(resp.Profiles))
+		for i, bp := range resp.Profiles {
+			parent := names[bp.ParentID]
+			if parent == "" {
+				parent = bp.ParentID
+			}
+			rows[i] = []string{bp.ID, bp.Name, bp.Arch, parent, fmt.Sprintf("%v", bp.IsSystem)}
+		}
+		output.PrintTable([]string{"ID", "NAME", "ARCH", "PARENT", "SYSTEM"}, rows)
+		return nil
+	})
+}
+
+func runBoardGet(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.GetBoardProfile(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+
+		output.PrintTable(
+			[]string{"FIELD", "VALUE"},
+			[][]string{
+				{"ID", resp.ID},
+				{"Name", resp.Name},
+				{"Display Name", resp.DisplayName},
+				{"Arch", resp.Arch},
+				{"Parent", resp.ParentID},
+				{"System", fmt.Sprintf("%v", resp.IsSystem)},
+				{"Config", string(resp.Config)},
+			},
+		)
+		return nil
+	})
+}
+
+func runBoardResolve(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.ResolveBoardProfile(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+
+		output.PrintTable(
+			[]string{"FIELD", "VALUE"},
+			[][]string{
+				{"Name", resp.Profile.Name},
+				{"Arch", resp.Profile.Arch},
+				{"Chain", strings.Join(resp.Chain, " -> ")},
+				{"Config", string(resp.Profile.Config)},
+			},
+		)
+		return nil
+	})
+}
+
+func runBoardDelete(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	if err := c.DeleteBoardProfile(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), map[string]string{"message": "Board profile deleted", "id": args[0]}, func() error {
+
+		output.PrintMessage(fmt.Sprintf("Board profile %s deleted.", args[0]))
+		return nil
+	})
+}
+
+func runBoardFiles(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.ListBoardProfileFiles(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+
+		if len(resp.Files) == 0 {
+			output.PrintMessage("No files attached.")
+			return nil
+		}
+
+		rows := make([][]string, len(resp.Files))
+		for i, f := range resp.Files {
+			rows[i] = []string{f.Path, fmt.Sprintf("%d", f.Size)}
+		}
+		output.PrintTable([]string{"PATH", "SIZE"}, rows)
+		return nil
+	})
+}
+
+func runBoardAttach(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.AttachBoardProfileFile(ctx, args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+
+		output.PrintMessage(fmt.Sprintf("Attached %s (%d bytes).", resp.Path, resp.Size))
+		return nil
+	})
+}
+
+func runBoardDetach(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	if err := c.DetachBoardProfileFile(ctx, args[0], args[1]); err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), map[string]string{"message": "Board profile file removed", "path": args[1]}, func() error {
+
+		output.PrintMessage(fmt.Sprintf("Removed %s.", args[1]))
+		return nil
+	})
+}
+
+func runBoardExport(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	destPath := args[0] + ".ldfboard.tar.gz"
+	if len(args) > 1 {
+		destPath = args[1]
+	}
+
+	if err := c.ExportBoardProfile(ctx, args[0], destPath); err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), map[string]string{"message": "Board profile exported", "path": destPath}, func() error {
+
+		output.PrintMessage(fmt.Sprintf("Board profile exported to %s.", destPath))
+		return nil
+	})
+}
+
+func runBoardImport(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.ImportBoardProfile(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+
+		output.PrintMessage(fmt.Sprintf("Board profile %s imported (%s).", resp.Profile.Name, resp.Profile.ID))
+		if len(resp.Created) > 1 {
+			output.PrintMessage("Created: " + strings.Join(resp.Created, ", "))
+		}
+		if len(resp.Reused) > 0 {
+			output.PrintMessage("Reused existing: " + strings.Join(resp.Reused, ", "))
+		}
+		return nil
+	})
+}
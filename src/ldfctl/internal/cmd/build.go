@@ -3,6 +3,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
 
 	"github.com/bitswalk/ldf/src/ldfctl/internal/client"
 	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
@@ -57,6 +61,64 @@ var buildRetryCmd = &cobra.Command{
 	RunE:  runBuildRetry,
 }
 
+var buildVerifyCmd = &cobra.Command{
+	Use:   "verify <build-id>",
+	Short: "Rebuild a reproducible build and compare checksums",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBuildVerify,
+}
+
+var buildSBOMCmd = &cobra.Command{
+	Use:   "sbom <build-id> [dest]",
+	Short: "Download the SBOM of a completed build",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runBuildSBOM,
+}
+
+var buildRecoveryKeyCmd = &cobra.Command{
+	Use:   "recovery-key <build-id>",
+	Short: "Show the recovery key of a build's encrypted root",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBuildRecoveryKey,
+}
+
+var buildUpdatesCmd = &cobra.Command{
+	Use:   "updates <distribution-id>",
+	Short: "List OTA update bundles for a distribution",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBuildUpdates,
+}
+
+var buildDeltaCmd = &cobra.Command{
+	Use:   "delta <distribution-id> --from <build-id> --to <build-id>",
+	Short: "Compute a binary delta between the images of two builds",
+	Long: `Starts computing a binary delta that turns the image of the --from build
+into the image of the --to build. Both builds must have completed for the same
+distribution, architecture and image format. The delta is stored next to the
+target image; apply it with 'ldfctl artifact apply-delta'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBuildDelta,
+}
+
+var buildDeltasCmd = &cobra.Command{
+	Use:   "deltas <distribution-id> [delta-id]",
+	Short: "List binary deltas for a distribution, or show one",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runBuildDeltas,
+}
+
+var buildRunCmd = &cobra.Command{
+	Use:   "run <build-id> [-- qemu options...]",
+	Short: "Download the image of a build and boot it in QEMU",
+	Long: `Downloads the image of a completed build with its VM launch descriptors and
+boots it with the published run-qemu.sh script, which matches the build's
+architecture, UEFI firmware, disk bus and console settings. Arguments after --
+are passed to QEMU. An image already downloaded with the right checksum is
+reused. The libvirt domain XML is downloaded next to the image as well.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runBuildRun,
+}
+
 var buildActiveCmd = &cobra.Command{
 	Use:   "active",
 	Short: "List all active builds",
@@ -70,17 +132,51 @@ func init() {
 	buildCmd.AddCommand(buildLogsCmd)
 	buildCmd.AddCommand(buildCancelCmd)
 	buildCmd.AddCommand(buildRetryCmd)
+	buildCmd.AddCommand(buildVerifyCmd)
+	buildCmd.AddCommand(buildSBOMCmd)
+	buildCmd.AddCommand(buildRecoveryKeyCmd)
 	buildCmd.AddCommand(buildActiveCmd)
+	buildCmd.AddCommand(buildUpdatesCmd)
+	buildCmd.AddCommand(buildDeltaCmd)
+	buildCmd.AddCommand(buildDeltasCmd)
+	buildCmd.AddCommand(buildRunCmd)
 
 	// Start flags
 	buildStartCmd.Flags().String("arch", "x86_64", "Target architecture (x86_64, aarch64)")
-	buildStartCmd.Flags().String("format", "raw", "Image format (raw, qcow2, iso)")
+	buildStartCmd.Flags().String("format", "raw", "Image format (raw, qcow2, iso, oci, vmdk, vhdx, tar.zst, cpio, netboot)")
+
+	// SBOM flags
+	buildSBOMCmd.Flags().String("format", "spdx", "SBOM format (spdx, cyclonedx)")
+
+	// Recovery key flags
+	buildRecoveryKeyCmd.Flags().String("save", "", "Download the recovery key artifact exported by the build to this file")
 
 	// List flags
 	buildListCmd.Flags().Int("limit", 0, "Maximum number of results")
 	buildListCmd.Flags().Int("offset", 0, "Number of results to skip")
+
+	// Updates flags
+	buildUpdatesCmd.Flags().String("from", "", "Only list bundles a device running this build can install")
+
+	// Delta flags
+	buildDeltaCmd.Flags().String("from", "", "Build whose image the delta starts from")
+	buildDeltaCmd.Flags().String("to", "", "Build whose image the delta produces")
+	_ = buildDeltaCmd.MarkFlagRequired("from")
+	_ = buildDeltaCmd.MarkFlagRequired("to")
+
+	// Run flags
+	buildRunCmd.Flags().String("dir", "", "Directory to download the image into (default: ./<build-id>)")
+	buildRunCmd.Flags().Bool("download-only", false, "Download the image and launch descriptors without booting")
 }
 
+// Files the package stage publishes to boot an image in a virtual machine
+const (
+	vmScriptName = "run-qemu.sh"
+	vmDomainName = "libvirt-domain.xml"
+	// cloudSeedName is the NoCloud seed cloud images boot with locally
+	cloudSeedName = "nocloud-seed.iso"
+)
+
 func runBuildStart(cmd *cobra.Command, args []string) error {
 	c := getClient()
 	ctx := context.Background()
@@ -123,23 +219,39 @@ func runBuildGet(cmd *cobra.Command, args []string) error {
 	}
 
 	return output.PrintFormatted(getOutputFormat(), resp, func() error {
-		output.PrintTable(
-			[]string{"FIELD", "VALUE"},
-			[][]string{
-				{"ID", resp.ID},
-				{"Distribution", resp.DistributionID},
-				{"Status", resp.Status},
-				{"Current Stage", resp.CurrentStage},
-				{"Progress", fmt.Sprintf("%d%%", resp.ProgressPercent)},
-				{"Architecture", resp.TargetArch},
-				{"Format", resp.ImageFormat},
-				{"Error", resp.ErrorMessage},
-				{"Error Stage", resp.ErrorStage},
-				{"Created", resp.CreatedAt},
-				{"Started", resp.StartedAt},
-				{"Completed", resp.CompletedAt},
-			},
-		)
+		fields := [][]string{
+			{"ID", resp.ID},
+			{"Distribution", resp.DistributionID},
+			{"Status", resp.Status},
+			{"Current Stage", resp.CurrentStage},
+			{"Progress", fmt.Sprintf("%d%%", resp.ProgressPercent)},
+			{"Architecture", resp.TargetArch},
+			{"Format", resp.ImageFormat},
+			{"Builder Image", resp.BuilderImage},
+			{"Builder Digest", resp.BuilderDigest},
+			{"Error", resp.ErrorMessage},
+			{"Error Stage", resp.ErrorStage},
+			{"Created", resp.CreatedAt},
+			{"Started", resp.StartedAt},
+			{"Completed", resp.CompletedAt},
+		}
+		if resp.VerifyOf != "" {
+			fields = append(fields,
+				[]string{"Verifies", resp.VerifyOf},
+				[]string{"Verify Result", resp.VerifyResult},
+			)
+		}
+		output.PrintTable([]string{"FIELD", "VALUE"}, fields)
+
+		if len(resp.VerifyDiff) > 0 {
+			fmt.Println()
+			output.PrintMessage("Differing files:")
+			rows := make([][]string, len(resp.VerifyDiff))
+			for i, p := range resp.VerifyDiff {
+				rows[i] = []string{p}
+			}
+			output.PrintTable([]string{"PATH"}, rows)
+		}
 
 		if len(resp.Stages) > 0 {
 			fmt.Println()
@@ -186,6 +298,101 @@ func runBuildList(cmd *cobra.Command, args []string) error {
 	})
 }
 
+func runBuildUpdates(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	from, _ := cmd.Flags().GetString("from")
+
+	resp, err := c.ListDistributionUpdates(ctx, args[0], from)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Count == 0 {
+			output.PrintMessage("No update bundles found.")
+			return nil
+		}
+
+		rows := make([][]string, len(resp.Updates))
+		for i, u := range resp.Updates {
+			rows[i] = []string{u.BuildID, u.Version, u.Compatible, u.TargetArch, fmt.Sprintf("%d", u.SizeBytes), u.CreatedAt}
+		}
+		output.PrintTable([]string{"BUILD", "VERSION", "COMPATIBLE", "ARCH", "SIZE", "CREATED"}, rows)
+		return nil
+	})
+}
+
+func runBuildDelta(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+
+	resp, err := c.CreateDelta(ctx, args[0], &client.CreateDeltaRequest{FromBuild: from, ToBuild: to})
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Status == "completed" {
+			output.PrintMessage(fmt.Sprintf("Delta %s is available at %s.", resp.ID, resp.ArtifactPath))
+			return nil
+		}
+		output.PrintMessage(fmt.Sprintf("Delta %s from build %s to build %s is %s.", resp.ID, from, to, resp.Status))
+		output.PrintMessage(fmt.Sprintf("Run 'ldfctl build deltas %s %s' to follow it.", args[0], resp.ID))
+		return nil
+	})
+}
+
+func runBuildDeltas(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	if len(args) > 1 {
+		resp, err := c.GetDelta(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return output.PrintFormatted(getOutputFormat(), resp, func() error {
+			output.PrintTable([]string{"FIELD", "VALUE"}, [][]string{
+				{"ID", resp.ID},
+				{"Status", resp.Status},
+				{"From Build", resp.SourceBuildID},
+				{"To Build", resp.TargetBuildID},
+				{"Path", resp.ArtifactPath},
+				{"Checksum", resp.Checksum},
+				{"Size", fmt.Sprintf("%d", resp.SizeBytes)},
+				{"Error", resp.ErrorMessage},
+				{"Created", resp.CreatedAt},
+				{"Completed", resp.CompletedAt},
+			})
+			return nil
+		})
+	}
+
+	resp, err := c.ListDeltas(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Count == 0 {
+			output.PrintMessage("No deltas found.")
+			return nil
+		}
+
+		rows := make([][]string, len(resp.Deltas))
+		for i, d := range resp.Deltas {
+			rows[i] = []string{d.ID, d.SourceBuildID, d.TargetBuildID, d.Status, fmt.Sprintf("%d", d.SizeBytes), d.CreatedAt}
+		}
+		output.PrintTable([]string{"ID", "FROM", "TO", "STATUS", "SIZE", "CREATED"}, rows)
+		return nil
+	})
+}
+
 func runBuildLogs(cmd *cobra.Command, args []string) error {
 	c := getClient()
 	ctx := context.Background()
@@ -238,6 +445,72 @@ func runBuildRetry(cmd *cobra.Command, args []string) error {
 	})
 }
 
+func runBuildVerify(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.VerifyReproducible(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		output.PrintMessage(fmt.Sprintf("Verification build %s started for build %s.", resp.ID, args[0]))
+		output.PrintMessage(fmt.Sprintf("Run 'ldfctl build get %s' once it completes to see the result.", resp.ID))
+		return nil
+	})
+}
+
+func runBuildSBOM(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	format, _ := cmd.Flags().GetString("format")
+	destPath := fmt.Sprintf("%s-sbom.%s.json", args[0], format)
+	if len(args) > 1 {
+		destPath = args[1]
+	}
+
+	if err := c.DownloadBuildSBOM(ctx, args[0], format, destPath); err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), map[string]string{"message": "SBOM downloaded", "path": destPath}, func() error {
+		output.PrintMessage(fmt.Sprintf("SBOM downloaded to %s.", destPath))
+		return nil
+	})
+}
+
+func runBuildRecoveryKey(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	if destPath, _ := cmd.Flags().GetString("save"); destPath != "" {
+		if err := c.DownloadBuildRecoveryKey(ctx, args[0], destPath); err != nil {
+			return err
+		}
+		return output.PrintFormatted(getOutputFormat(), map[string]string{"message": "Recovery key downloaded", "path": destPath}, func() error {
+			output.PrintMessage(fmt.Sprintf("Recovery key downloaded to %s.", destPath))
+			return nil
+		})
+	}
+
+	resp, err := c.GetBuildRecoveryKey(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		output.PrintTable([]string{"FIELD", "VALUE"}, [][]string{
+			{"Build", resp.BuildID},
+			{"LUKS UUID", resp.LUKSUUID},
+			{"Recovery Key", resp.RecoveryKey},
+			{"Created", resp.CreatedAt},
+		})
+		return nil
+	})
+}
+
 func runBuildActive(cmd *cobra.Command, args []string) error {
 	c := getClient()
 	ctx := context.Background()
@@ -261,3 +534,72 @@ func runBuildActive(cmd *cobra.Command, args []string) error {
 		return nil
 	})
 }
+
+func runBuildRun(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	job, err := c.GetBuild(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if job.Status != "completed" || job.ArtifactPath == "" {
+		return fmt.Errorf("build %s has not completed (status: %s)", job.ID, job.Status)
+	}
+
+	dir, _ := cmd.Flags().GetString("dir")
+	if dir == "" {
+		dir = job.ID
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	image := filepath.Join(dir, path.Base(job.ArtifactPath))
+	if sum, err := fileSHA256(image); err != nil || sum != job.ArtifactChecksum {
+		fmt.Fprintf(os.Stderr, "Downloading %s...\n", path.Base(job.ArtifactPath))
+		if err := c.DownloadBuildFile(ctx, job, path.Base(job.ArtifactPath), image); err != nil {
+			return err
+		}
+		if job.ArtifactChecksum != "" {
+			sum, err := fileSHA256(image)
+			if err != nil {
+				return err
+			}
+			if sum != job.ArtifactChecksum {
+				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", image, job.ArtifactChecksum, sum)
+			}
+		}
+	}
+
+	script := filepath.Join(dir, vmScriptName)
+	if err := c.DownloadBuildFile(ctx, job, vmScriptName, script); err != nil {
+		return fmt.Errorf("build %s has no VM launch descriptors (%s images cannot be booted locally): %w", job.ID, job.ImageFormat, err)
+	}
+	if err := os.Chmod(script, 0755); err != nil {
+		return err
+	}
+	if err := c.DownloadBuildFile(ctx, job, vmDomainName, filepath.Join(dir, vmDomainName)); err != nil {
+		return err
+	}
+	// Only cloud images publish a seed; the launch script attaches it when present
+	if err := c.DownloadBuildFile(ctx, job, cloudSeedName, filepath.Join(dir, cloudSeedName)); err == nil {
+		fmt.Fprintf(os.Stderr, "Downloaded %s\n", cloudSeedName)
+	}
+
+	downloadOnly, _ := cmd.Flags().GetBool("download-only")
+	if downloadOnly {
+		return output.PrintFormatted(getOutputFormat(), map[string]string{"image": image, "script": script}, func() error {
+			output.PrintMessage(fmt.Sprintf("Image and launch descriptors of build %s downloaded to %s.", job.ID, dir))
+			output.PrintMessage(fmt.Sprintf("Boot it with '%s'.", script))
+			return nil
+		})
+	}
+
+	fmt.Fprintf(os.Stderr, "Booting build %s (%s, %s)...\n", job.ID, job.TargetArch, job.ImageFormat)
+	run := exec.CommandContext(ctx, "bash", append([]string{script, image}, args[1:]...)...)
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	return run.Run()
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfctl/internal/client"
+	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var builderCmd = &cobra.Command{
+	Use:   "builder",
+	Short: "Manage builder images",
+}
+
+var builderListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List builder images per architecture",
+	RunE:  runBuilderList,
+}
+
+var builderBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build the builder image for an architecture",
+	RunE:  runBuilderBuild,
+}
+
+func init() {
+	builderCmd.AddCommand(builderListCmd)
+	builderCmd.AddCommand(builderBuildCmd)
+
+	// Build flags
+	builderBuildCmd.Flags().String("arch", "", "Target architecture (x86_64, aarch64; default: server host)")
+	builderBuildCmd.Flags().Bool("no-cache", false, "Do not use cached layers")
+}
+
+func runBuilderList(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.ListBuilderImages(ctx)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Count == 0 {
+			output.PrintMessage("No builder images found.")
+			return nil
+		}
+
+		rows := make([][]string, len(resp.Images))
+		for i, img := range resp.Images {
+			rows[i] = []string{img.TargetArch, img.Image, img.Status, img.Digest, strings.Join(img.MissingTools, ", ")}
+		}
+		output.PrintTable([]string{"ARCH", "IMAGE", "STATUS", "DIGEST", "MISSING TOOLS"}, rows)
+		return nil
+	})
+}
+
+func runBuilderBuild(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	arch, _ := cmd.Flags().GetString("arch")
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+
+	req := &client.BuildBuilderImageRequest{
+		Arch:    arch,
+		NoCache: noCache,
+	}
+
+	resp, err := c.BuildBuilderImage(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		output.PrintMessage(fmt.Sprintf("Builder image %s build started.", resp.Image))
+		output.PrintTable(
+			[]string{"FIELD", "VALUE"},
+			[][]string{
+				{"Image", resp.Image},
+				{"Architecture", resp.TargetArch},
+				{"Status", resp.Status},
+			},
+		)
+		return nil
+	})
+}
@@ -2,12 +2,22 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/bitswalk/ldf/src/common/attestation"
+	"github.com/bitswalk/ldf/src/common/delta"
 	"github.com/bitswalk/ldf/src/ldfctl/internal/client"
 )
 
@@ -39,7 +49,8 @@ func TestRootCommand_HasSubcommands(t *testing.T) {
 		"version", "health", "login", "logout", "whoami",
 		"distribution", "component", "source", "download",
 		"artifact", "setting", "role", "forge", "branding",
-		"langpack", "release",
+		"langpack", "release", "signing-key", "secureboot",
+		"board",
 	}
 
 	commands := make(map[string]bool)
@@ -128,6 +139,19 @@ func TestArtifactCommand_HasSubcommands(t *testing.T) {
 	}
 }
 
+func TestBoardCommand_HasSubcommands(t *testing.T) {
+	expected := []string{"list", "get", "resolve", "delete", "files", "attach", "detach", "export", "import"}
+	commands := make(map[string]bool)
+	for _, cmd := range boardCmd.Commands() {
+		commands[cmd.Name()] = true
+	}
+	for _, name := range expected {
+		if !commands[name] {
+			t.Errorf("expected board subcommand %q not found", name)
+		}
+	}
+}
+
 func TestSettingCommand_HasSubcommands(t *testing.T) {
 	expected := []string{"list", "get", "set", "reset-db"}
 	commands := make(map[string]bool)
@@ -167,6 +191,19 @@ func TestReleaseCommand_HasSubcommands(t *testing.T) {
 	}
 }
 
+func TestBuilderCommand_HasSubcommands(t *testing.T) {
+	expected := []string{"list", "build"}
+	commands := make(map[string]bool)
+	for _, cmd := range builderCmd.Commands() {
+		commands[cmd.Name()] = true
+	}
+	for _, name := range expected {
+		if !commands[name] {
+			t.Errorf("expected builder subcommand %q not found", name)
+		}
+	}
+}
+
 // =============================================================================
 // Command Aliases Tests
 // =============================================================================
@@ -308,6 +345,23 @@ func TestReleaseConfigureCmd_HasConfigFlags(t *testing.T) {
 		"kernel", "bootloader", "init", "filesystem",
 		"security", "container", "virtualization",
 		"target-type", "package-manager",
+		"hostname", "locales", "timezone", "keymap", "ntp-servers", "dns", "dns-search", "network-interfaces",
+		"logging", "logging-version", "journal-storage", "journal-max-use", "journal-max-retention",
+		"log-rule", "log-remote", "log-remote-port", "log-remote-protocol", "resource-manager", "cgroup-hierarchy",
+		"cloud-provider", "cloud-datasources", "cloud-default-user", "cloud-no-growpart", "cloud-seed-ssh-key", "cloud-init-version",
+		"reproducible", "source-date-epoch",
+		"selinux-policy", "selinux-enforcing", "refpolicy-version", "apparmor-profiles", "apparmor-complain",
+		"secure-boot", "secure-boot-keys", "export-enrollment",
+		"verity", "verity-fs", "var-size",
+		"encrypt", "encrypt-recovery", "encrypt-tpm2", "encrypt-tpm2-pcrs", "encrypt-reencrypt",
+		"ab-slots", "slot-size", "data-size", "update-bundle", "compatible", "update-hooks",
+		"boot-test", "boot-test-timeout", "boot-test-marker", "boot-test-memory", "boot-test-command",
+		"oci-repository", "oci-tag", "oci-plain-http",
+		"netboot-base-url", "netboot-root", "netboot-nfs-export", "netboot-kernel-args",
+		"vm-memory", "vm-cpus", "vm-disk-bus", "vm-serial-console",
+		"live-installer", "live-answers", "live-persistence",
+		"initramfs-generator", "initramfs-hooks", "initramfs-compression", "no-microcode",
+		"firmware-drivers", "firmware-modules", "firmware-files", "firmware-version",
 	}
 	for _, name := range expected {
 		if flags.Lookup(name) == nil {
@@ -594,6 +648,604 @@ func TestStorageStatus_MockServer(t *testing.T) {
 	}
 }
 
+func TestBuilderList_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builder-images", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": 1,
+			"images": []map[string]interface{}{
+				{"target_arch": "x86_64", "image": "ldf-builder:x86_64", "status": "ready", "digest": "sha256:abc"},
+			},
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	outputFormat = "table"
+	err := runBuilderList(builderListCmd, []string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildVerify_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builds/build-1/verify-reproducible", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "build-2", "status": "pending", "verify_of": "build-1",
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	outputFormat = "table"
+	err := runBuildVerify(buildVerifyCmd, []string{"build-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildUpdates_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/distributions/dist-1/updates", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("from"); got != "build-1" {
+			t.Errorf("expected from=build-1, got %q", got)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":  "build-1",
+			"count": 1,
+			"updates": []map[string]interface{}{
+				{"id": "u2", "build_id": "build-2", "version": "1.1.0", "compatible": "gateway", "target_arch": "x86_64", "size_bytes": 1024},
+			},
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	_ = buildUpdatesCmd.Flags().Set("from", "build-1")
+	defer func() { _ = buildUpdatesCmd.Flags().Set("from", "") }()
+
+	outputFormat = "table"
+	if err := runBuildUpdates(buildUpdatesCmd, []string{"dist-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildDelta_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/distributions/dist-1/deltas", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"count": 0, "deltas": []interface{}{}})
+			return
+		}
+		var req client.CreateDeltaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.FromBuild != "build-1" || req.ToBuild != "build-2" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "delta-1", "source_build_id": "build-1", "target_build_id": "build-2", "status": "pending",
+		})
+	})
+	mux.HandleFunc("/v1/distributions/dist-1/deltas/delta-1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "delta-1", "status": "completed", "artifact_path": "builds/build-2/deltas/build-1.ldfdelta", "size_bytes": 2048,
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	_ = buildDeltaCmd.Flags().Set("from", "build-1")
+	_ = buildDeltaCmd.Flags().Set("to", "build-2")
+	defer func() {
+		_ = buildDeltaCmd.Flags().Set("from", "")
+		_ = buildDeltaCmd.Flags().Set("to", "")
+	}()
+
+	outputFormat = "table"
+	if err := runBuildDelta(buildDeltaCmd, []string{"dist-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runBuildDeltas(buildDeltasCmd, []string{"dist-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runBuildDeltas(buildDeltasCmd, []string{"dist-1", "delta-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildSBOM_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builds/build-1/sbom", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("format"); got != "cyclonedx" {
+			t.Errorf("expected format=cyclonedx, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/vnd.cyclonedx+json")
+		_, _ = w.Write([]byte(`{"bomFormat":"CycloneDX"}`))
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "sbom.json")
+	_ = buildSBOMCmd.Flags().Set("format", "cyclonedx")
+	defer func() { _ = buildSBOMCmd.Flags().Set("format", "spdx") }()
+
+	outputFormat = "table"
+	if err := runBuildSBOM(buildSBOMCmd, []string{"build-1", dest}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("expected SBOM file: %v", err)
+	}
+	if !strings.Contains(string(data), "CycloneDX") {
+		t.Errorf("unexpected SBOM content: %s", data)
+	}
+}
+
+func TestBuildRun_DownloadOnly(t *testing.T) {
+	defer resetGlobals()
+
+	image := []byte("qcow2 image")
+	sum := sha256.Sum256(image)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builds/build-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "build-1", "distribution_id": "dist-1", "status": "completed",
+			"target_arch": "x86_64", "image_format": "qcow2",
+			"artifact_path":     "distribution/owner-1/dist-1/builds/build-1/ldf.qcow2",
+			"artifact_checksum": hex.EncodeToString(sum[:]),
+		})
+	})
+	mux.HandleFunc("/v1/distributions/dist-1/artifacts/builds/build-1/", func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "ldf.qcow2":
+			_, _ = w.Write(image)
+		case "run-qemu.sh":
+			_, _ = w.Write([]byte("#!/usr/bin/env bash\n"))
+		case "libvirt-domain.xml":
+			_, _ = w.Write([]byte("<domain/>"))
+		case "nocloud-seed.iso":
+			_, _ = w.Write([]byte("seed"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	_ = buildRunCmd.Flags().Set("dir", dir)
+	_ = buildRunCmd.Flags().Set("download-only", "true")
+	defer func() {
+		_ = buildRunCmd.Flags().Set("dir", "")
+		_ = buildRunCmd.Flags().Set("download-only", "false")
+	}()
+
+	outputFormat = "table"
+	if err := runBuildRun(buildRunCmd, []string{"build-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "ldf.qcow2")); err != nil || string(data) != string(image) {
+		t.Errorf("expected image downloaded, got %q, %v", data, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "run-qemu.sh"))
+	if err != nil || info.Mode()&0111 == 0 {
+		t.Errorf("expected executable launch script: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "libvirt-domain.xml")); err != nil {
+		t.Errorf("expected libvirt domain: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nocloud-seed.iso")); err != nil {
+		t.Errorf("expected NoCloud seed: %v", err)
+	}
+}
+
+func TestBuildRecoveryKey_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builds/build-1/recovery-key", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"build_id":     "build-1",
+			"luks_uuid":    "5f2b0c1e-0000-4000-8000-000000000001",
+			"recovery_key": "cbdefghi-jklnrtuv-cbdefghi-jklnrtuv-cbdefghi-jklnrtuv-cbdefghi-jklnrtuv",
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	outputFormat = "table"
+	if err := runBuildRecoveryKey(buildRecoveryKeyCmd, []string{"build-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildRecoveryKey_Save(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builds/build-1/recovery-key/artifact", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("cbdefghi-jklnrtuv\n"))
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "recovery-key")
+	if err := buildRecoveryKeyCmd.Flags().Set("save", dest); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = buildRecoveryKeyCmd.Flags().Set("save", "") }()
+
+	outputFormat = "table"
+	if err := runBuildRecoveryKey(buildRecoveryKeyCmd, []string{"build-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatalf("expected recovery key file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("recovery key file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestArtifactPublicKey_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/signing-keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": 2,
+			"signing_keys": []map[string]interface{}{
+				{"id": "new", "name": "ldfd-default", "algorithm": "ed25519", "public_key": "NEW KEY", "active": true},
+				{"id": "old", "name": "ldfd-old", "algorithm": "ed25519", "public_key": "OLD KEY", "active": false},
+			},
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "ldfd.pub")
+	outputFormat = "table"
+	if err := runArtifactPublicKey(artifactPublicKeyCmd, []string{dest}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("expected public key file: %v", err)
+	}
+	if string(data) != "NEW KEY" {
+		t.Errorf("expected active key to be saved, got %q", data)
+	}
+}
+
+func TestArtifactVerify(t *testing.T) {
+	defer resetGlobals()
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "disk.img")
+	if err := os.WriteFile(image, []byte("image contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("image contents"))
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := attestation.MarshalPublicKeyPEM(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "ldfd.pub")
+	if err := os.WriteFile(keyPath, []byte(pubPEM), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	statement := attestation.Statement{
+		Type:          attestation.StatementType,
+		Subject:       []attestation.Subject{{Name: "disk.img", Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}}},
+		PredicateType: attestation.PredicateSLSAProvenance,
+	}
+	statement.Predicate.RunDetails.Metadata.InvocationID = "build-1"
+	payload, _ := json.Marshal(statement)
+	envData, _ := json.Marshal(attestation.Sign(priv, attestation.KeyID(pub), attestation.PayloadTypeInToto, payload))
+	envPath := filepath.Join(dir, "provenance.intoto.json")
+	if err := os.WriteFile(envPath, envData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = artifactVerifyCmd.Flags().Set("public-key", keyPath)
+	defer func() { _ = artifactVerifyCmd.Flags().Set("public-key", "") }()
+
+	outputFormat = "table"
+	if err := runArtifactVerify(artifactVerifyCmd, []string{image, envPath}); err != nil {
+		t.Fatalf("expected attestation to verify: %v", err)
+	}
+
+	// A modified image no longer matches the attested digest
+	if err := os.WriteFile(image, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runArtifactVerify(artifactVerifyCmd, []string{image, envPath}); err == nil {
+		t.Error("expected verification of a modified image to fail")
+	}
+
+	// A different key does not verify the signature
+	if err := os.WriteFile(image, []byte("image contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherPEM, _ := attestation.MarshalPublicKeyPEM(otherPub)
+	if err := os.WriteFile(keyPath, []byte(otherPEM), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runArtifactVerify(artifactVerifyCmd, []string{image, envPath}); err == nil {
+		t.Error("expected verification with the wrong key to fail")
+	}
+}
+
+func TestArtifactVerify_DetachedSignature(t *testing.T) {
+	defer resetGlobals()
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "disk.img")
+	if err := os.WriteFile(image, []byte("image contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "ldfd.minisign.pub")
+	if err := os.WriteFile(keyPath, []byte(attestation.FormatMinisignPublicKey(pub)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := attestation.SignDetached(priv, strings.NewReader("image contents"), "timestamp:1700000000\tfile:disk.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigPath := image + attestation.SignatureSuffix
+	if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = artifactVerifyCmd.Flags().Set("public-key", keyPath)
+	defer func() { _ = artifactVerifyCmd.Flags().Set("public-key", "") }()
+
+	outputFormat = "table"
+	if err := runArtifactVerify(artifactVerifyCmd, []string{image, sigPath}); err != nil {
+		t.Fatalf("expected signature to verify: %v", err)
+	}
+
+	// Editing the trusted comment invalidates the global signature
+	tampered := strings.Replace(string(sig), "file:disk.img", "file:other.img", 1)
+	if err := os.WriteFile(sigPath, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runArtifactVerify(artifactVerifyCmd, []string{image, sigPath}); err == nil {
+		t.Error("expected a modified trusted comment to fail verification")
+	}
+
+	if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(image, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runArtifactVerify(artifactVerifyCmd, []string{image, sigPath}); err == nil {
+		t.Error("expected verification of a modified image to fail")
+	}
+}
+
+func TestArtifactApplyDelta(t *testing.T) {
+	defer resetGlobals()
+
+	dir := t.TempDir()
+	source := bytes.Repeat([]byte("old image block "), 16*1024)
+	target := append([]byte(nil), source...)
+	copy(target[1000:], "new package")
+
+	sourcePath := filepath.Join(dir, "old.img")
+	if err := os.WriteFile(sourcePath, source, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var d bytes.Buffer
+	if _, _, err := delta.Create(&d, bytes.NewReader(source), int64(len(source)), bytes.NewReader(target), int64(len(target))); err != nil {
+		t.Fatal(err)
+	}
+	deltaPath := filepath.Join(dir, "update"+delta.Extension)
+	if err := os.WriteFile(deltaPath, d.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFormat = "table"
+	outPath := filepath.Join(dir, "new.img")
+	if err := runArtifactApplyDelta(artifactApplyDeltaCmd, []string{sourcePath, deltaPath, outPath}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, target) {
+		t.Error("reconstructed image differs from the target")
+	}
+
+	// A delta against a different source image leaves no output behind
+	otherPath := filepath.Join(dir, "other.img")
+	if err := os.WriteFile(otherPath, target, 0644); err != nil {
+		t.Fatal(err)
+	}
+	failedPath := filepath.Join(dir, "failed.img")
+	if err := runArtifactApplyDelta(artifactApplyDeltaCmd, []string{otherPath, deltaPath, failedPath}); err == nil {
+		t.Error("expected a mismatching source image to fail")
+	}
+	if _, err := os.Stat(failedPath); !os.IsNotExist(err) {
+		t.Error("expected no output for a failed apply")
+	}
+}
+
+func TestArtifactVerify_Remote(t *testing.T) {
+	defer resetGlobals()
+
+	valid := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/distributions/dist-1/artifacts-verify/builds/b1/disk.img", func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]interface{}{"path": "builds/b1/disk.img", "valid": valid}
+		if valid {
+			resp["key_id"] = "abc"
+			resp["key_name"] = "ldfd-default"
+		} else {
+			resp["error"] = "signature verification failed"
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	_ = artifactVerifyCmd.Flags().Set("distribution", "dist-1")
+	defer func() { _ = artifactVerifyCmd.Flags().Set("distribution", "") }()
+
+	outputFormat = "table"
+	if err := runArtifactVerify(artifactVerifyCmd, []string{"builds/b1/disk.img"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	valid = false
+	if err := runArtifactVerify(artifactVerifyCmd, []string{"builds/b1/disk.img"}); err == nil {
+		t.Error("expected an invalid signature to return an error")
+	}
+}
+
+func TestSigningKeyRotate_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/signing-keys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["name"] != "release-2027" {
+			t.Errorf("expected name release-2027, got %q", body["name"])
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "new", "name": "release-2027", "algorithm": "ed25519", "active": true,
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	_ = signingKeyRotateCmd.Flags().Set("name", "release-2027")
+	defer func() { _ = signingKeyRotateCmd.Flags().Set("name", "") }()
+
+	outputFormat = "table"
+	if err := runSigningKeyRotate(signingKeyRotateCmd, []string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSecurebootList_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/secureboot/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": 1,
+			"key_sets": []map[string]interface{}{
+				{"id": "ks1", "name": "ldf-2026", "owner_guid": "8be4df61-93ca-11d2-aa0d-00e098032b8c", "active": true},
+			},
+		})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	outputFormat = "table"
+	if err := runSecurebootList(securebootListCmd, []string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSecurebootImport_MockServer(t *testing.T) {
+	defer resetGlobals()
+
+	dir := t.TempDir()
+	for _, role := range []string{"pk", "kek", "db"} {
+		if err := os.WriteFile(filepath.Join(dir, role+".crt"), []byte(role+"-cert"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, role+".key"), []byte(role+"-key"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/secureboot/keys", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		var body client.CreateSecureBootKeySetRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.KEK == nil || body.KEK.Certificate != "kek-cert" || body.KEK.PrivateKey != "kek-key" {
+			t.Errorf("unexpected KEK pair: %+v", body.KEK)
+		}
+		if body.PK == nil || body.DB == nil {
+			t.Error("expected PK and db pairs")
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "ks2", "name": body.Name})
+	})
+	srv := setupTestClient(t, mux)
+	defer srv.Close()
+
+	flags := map[string]string{"name": "imported"}
+	for _, role := range []string{"pk", "kek", "db"} {
+		flags[role+"-cert"] = filepath.Join(dir, role+".crt")
+		flags[role+"-key"] = filepath.Join(dir, role+".key")
+	}
+	for name, value := range flags {
+		_ = securebootImportCmd.Flags().Set(name, value)
+	}
+	defer func() {
+		for name := range flags {
+			_ = securebootImportCmd.Flags().Set(name, "")
+		}
+	}()
+
+	outputFormat = "table"
+	if err := runSecurebootImport(securebootImportCmd, []string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestRoleList_MockServer(t *testing.T) {
 	defer resetGlobals()
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/bitswalk/ldf/src/ldfctl/internal/client"
 	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
@@ -62,10 +63,18 @@ func init() {
 
 	// Configure flags -- core
 	releaseConfigureCmd.Flags().String("kernel", "", "Kernel version")
-	releaseConfigureCmd.Flags().String("bootloader", "", "Bootloader (e.g., grub, systemd-boot)")
+	releaseConfigureCmd.Flags().String("bootloader", "", "Bootloader (e.g., grub, systemd-boot, uboot)")
 	releaseConfigureCmd.Flags().String("bootloader-version", "", "Bootloader version")
 	releaseConfigureCmd.Flags().String("partitioning-type", "", "Partitioning type (e.g., gpt, mbr)")
 	releaseConfigureCmd.Flags().String("partitioning-mode", "", "Partitioning mode (e.g., auto, manual)")
+	releaseConfigureCmd.Flags().String("initramfs-generator", "", "Initramfs generator (builtin, dracut, mkinitcpio)")
+	releaseConfigureCmd.Flags().StringSlice("initramfs-hooks", nil, "Initramfs hooks (lvm, mdraid, luks, nfs, network, plymouth)")
+	releaseConfigureCmd.Flags().String("initramfs-compression", "", "Initramfs compression (gzip, xz, zstd, lz4)")
+	releaseConfigureCmd.Flags().Bool("no-microcode", false, "Do not prepend early CPU microcode to the initramfs")
+	releaseConfigureCmd.Flags().StringSlice("firmware-drivers", nil, "linux-firmware drivers to install firmware for (e.g., iwlwifi, amdgpu)")
+	releaseConfigureCmd.Flags().StringSlice("firmware-modules", nil, "Kernel modules whose referenced firmware is installed")
+	releaseConfigureCmd.Flags().StringSlice("firmware-files", nil, "linux-firmware paths or glob patterns to install")
+	releaseConfigureCmd.Flags().String("firmware-version", "", "linux-firmware release (e.g., 20240909)")
 
 	// Configure flags -- system
 	releaseConfigureCmd.Flags().String("init", "", "Init system (e.g., systemd, openrc)")
@@ -75,10 +84,47 @@ func init() {
 	releaseConfigureCmd.Flags().String("filesystem-version", "", "Filesystem version")
 	releaseConfigureCmd.Flags().String("package-manager", "", "Package manager (e.g., apt, dnf, pacman)")
 	releaseConfigureCmd.Flags().String("package-manager-version", "", "Package manager version")
+	releaseConfigureCmd.Flags().String("logging", "", "System logger (journald, syslog, rsyslog, none)")
+	releaseConfigureCmd.Flags().String("logging-version", "", "System logger version (syslog, rsyslog)")
+	releaseConfigureCmd.Flags().String("journal-storage", "", "Journal storage (persistent, volatile, auto)")
+	releaseConfigureCmd.Flags().String("journal-max-use", "", "Disk space the journal may use (e.g., 500M)")
+	releaseConfigureCmd.Flags().String("journal-max-retention", "", "Time journal entries are kept (e.g., 1month)")
+	releaseConfigureCmd.Flags().StringArray("log-rule", nil, "rsyslog rule replacing the defaults, e.g. \"kern.* /var/log/kern.log\" (repeatable)")
+	releaseConfigureCmd.Flags().String("log-remote", "", "Log host syslog and rsyslog forward every message to")
+	releaseConfigureCmd.Flags().Int("log-remote-port", 0, "Log host port (default: 514)")
+	releaseConfigureCmd.Flags().String("log-remote-protocol", "", "Log forwarding protocol: udp, tcp (rsyslog only)")
+	releaseConfigureCmd.Flags().String("resource-manager", "", "Resource management (cgroups, none)")
+	releaseConfigureCmd.Flags().String("cgroup-hierarchy", "", "cgroup hierarchy (unified, hybrid, legacy)")
 
 	// Configure flags -- security
 	releaseConfigureCmd.Flags().String("security", "", "Security system (e.g., selinux, apparmor)")
 	releaseConfigureCmd.Flags().String("security-version", "", "Security system version")
+	releaseConfigureCmd.Flags().String("selinux-policy", "", "SELinux policy: targeted, mls, custom (default: targeted)")
+	releaseConfigureCmd.Flags().Bool("selinux-enforcing", false, "Boot SELinux in enforcing mode instead of permissive")
+	releaseConfigureCmd.Flags().String("refpolicy-version", "", "SELinux reference policy version")
+	releaseConfigureCmd.Flags().StringSlice("apparmor-profiles", nil, "AppArmor profile sets to install (base, extras)")
+	releaseConfigureCmd.Flags().Bool("apparmor-complain", false, "Load every AppArmor profile in complain mode")
+	releaseConfigureCmd.Flags().Bool("secure-boot", false, "Sign EFI binaries and kernels for UEFI Secure Boot")
+	releaseConfigureCmd.Flags().String("secure-boot-keys", "", "Secure Boot key set ID (default: the active key set)")
+	releaseConfigureCmd.Flags().Bool("export-enrollment", false, "Publish PK/KEK/db enrollment files (.esl, .auth) with each build")
+	releaseConfigureCmd.Flags().Bool("verity", false, "Build a read-only root protected by dm-verity with a writable /var")
+	releaseConfigureCmd.Flags().String("verity-fs", "", "Read-only root filesystem for dm-verity images (erofs, squashfs)")
+	releaseConfigureCmd.Flags().Int("var-size", 0, "Minimum /var partition size in MB for dm-verity images")
+	releaseConfigureCmd.Flags().Bool("encrypt", false, "Encrypt the root partition with LUKS2 using a per-build key")
+	releaseConfigureCmd.Flags().Bool("encrypt-recovery", false, "Export each build's recovery key as a private artifact only the owner and admins can download")
+	releaseConfigureCmd.Flags().Bool("encrypt-tpm2", false, "Enroll a TPM2 key slot on first boot (systemd init only)")
+	releaseConfigureCmd.Flags().String("encrypt-tpm2-pcrs", "", "PCRs the TPM2 key slot is bound to (default: 7)")
+	releaseConfigureCmd.Flags().Bool("encrypt-reencrypt", false, "Re-encrypt the root and replace the build key on first boot (systemd init only)")
+
+	// Configure flags -- system settings
+	releaseConfigureCmd.Flags().String("hostname", "", "Hostname of the installed system")
+	releaseConfigureCmd.Flags().StringSlice("locales", nil, "Locales to generate; the first is the default (e.g., en_US.UTF-8,fr_FR.UTF-8)")
+	releaseConfigureCmd.Flags().String("timezone", "", "Time zone (e.g., Europe/Paris)")
+	releaseConfigureCmd.Flags().String("keymap", "", "Console keymap (e.g., us, fr)")
+	releaseConfigureCmd.Flags().StringSlice("ntp-servers", nil, "NTP servers")
+	releaseConfigureCmd.Flags().StringSlice("dns", nil, "DNS server addresses")
+	releaseConfigureCmd.Flags().StringSlice("dns-search", nil, "DNS search domains")
+	releaseConfigureCmd.Flags().String("network-interfaces", "", "Path to a JSON array of network interfaces (DHCP or static, VLANs, bonds)")
 
 	// Configure flags -- runtime
 	releaseConfigureCmd.Flags().String("container", "", "Container runtime (e.g., docker, podman)")
@@ -87,11 +133,48 @@ func init() {
 	releaseConfigureCmd.Flags().String("virtualization-version", "", "Virtualization system version")
 
 	// Configure flags -- target
-	releaseConfigureCmd.Flags().String("target-type", "", "Target type (server, desktop)")
+	releaseConfigureCmd.Flags().String("target-type", "", "Target type (server, desktop, cloud)")
 	releaseConfigureCmd.Flags().String("desktop-env", "", "Desktop environment (e.g., gnome, kde)")
 	releaseConfigureCmd.Flags().String("desktop-env-version", "", "Desktop environment version")
 	releaseConfigureCmd.Flags().String("display-server", "", "Display server (e.g., wayland, x11)")
 	releaseConfigureCmd.Flags().String("display-server-version", "", "Display server version")
+	releaseConfigureCmd.Flags().String("cloud-provider", "", "Cloud provider profile: generic, aws, gce")
+	releaseConfigureCmd.Flags().StringSlice("cloud-datasources", nil, "cloud-init datasources, overriding the provider's (e.g., NoCloud,OpenStack)")
+	releaseConfigureCmd.Flags().String("cloud-default-user", "", "Account cloud-init creates with the instance's SSH keys")
+	releaseConfigureCmd.Flags().Bool("cloud-no-growpart", false, "Keep the root partition at its image size")
+	releaseConfigureCmd.Flags().StringArray("cloud-seed-ssh-key", nil, "SSH public key of the NoCloud seed ISO (repeatable)")
+	releaseConfigureCmd.Flags().String("cloud-init-version", "", "cloud-init version")
+
+	// Configure flags -- build
+	releaseConfigureCmd.Flags().Bool("reproducible", false, "Produce bit-for-bit reproducible images")
+	releaseConfigureCmd.Flags().Int64("source-date-epoch", 0, "Override the SOURCE_DATE_EPOCH derived from the configuration")
+	releaseConfigureCmd.Flags().Bool("boot-test", false, "Boot each image in QEMU after packaging and fail the build if it does not come up")
+	releaseConfigureCmd.Flags().Int("boot-test-timeout", 0, "Seconds to wait for the image to boot (default 300)")
+	releaseConfigureCmd.Flags().String("boot-test-marker", "", "Console output, as a regular expression, that marks a successful boot (default: login prompt)")
+	releaseConfigureCmd.Flags().Int("boot-test-memory", 0, "Memory in MB given to the boot test VM (default 1024)")
+	releaseConfigureCmd.Flags().StringArray("boot-test-command", nil, "Command to run as root over the serial console once booted (repeatable)")
+	releaseConfigureCmd.Flags().String("oci-repository", "", "Registry repository OCI images are pushed to (e.g., registry.example.com/team/base)")
+	releaseConfigureCmd.Flags().StringArray("oci-tag", nil, "Tag pushed OCI images get (repeatable, default: the distribution version)")
+	releaseConfigureCmd.Flags().Bool("oci-plain-http", false, "Push OCI images over plain HTTP, for local registries")
+	releaseConfigureCmd.Flags().String("netboot-base-url", "", "ldfd URL network-booted machines fetch from (default: the server's public URL)")
+	releaseConfigureCmd.Flags().String("netboot-root", "", "How network-booted machines reach their root: http, nfs")
+	releaseConfigureCmd.Flags().String("netboot-nfs-export", "", "NFS export holding the rootfs when the netboot root is nfs (server:/path)")
+	releaseConfigureCmd.Flags().String("netboot-kernel-args", "", "Extra kernel command line arguments for network boot")
+	releaseConfigureCmd.Flags().Int("vm-memory", 0, "Memory in MB of the VM launch descriptors published with disk images (default 2048)")
+	releaseConfigureCmd.Flags().Int("vm-cpus", 0, "Virtual CPUs of the VM launch descriptors (default 2)")
+	releaseConfigureCmd.Flags().String("vm-disk-bus", "", "Bus the VM attaches the image disk to: virtio, scsi, sata")
+	releaseConfigureCmd.Flags().Bool("vm-serial-console", false, "Put the kernel console on the serial port and launch VMs headless")
+	releaseConfigureCmd.Flags().Bool("live-installer", false, "Embed the text-mode installer in live ISO images")
+	releaseConfigureCmd.Flags().String("live-answers", "", "Path to an answer file baked into the ISO for unattended installs")
+	releaseConfigureCmd.Flags().Bool("live-persistence", false, "Add a live boot entry keeping changes on a partition labelled LDF_PERSIST")
+
+	// Configure flags -- update
+	releaseConfigureCmd.Flags().Bool("ab-slots", false, "Use an A/B layout with two root slots and a shared /data partition")
+	releaseConfigureCmd.Flags().Int("slot-size", 0, "Root slot size in MB (default: split the image between both slots)")
+	releaseConfigureCmd.Flags().Int("data-size", 0, "Minimum /data partition size in MB")
+	releaseConfigureCmd.Flags().Bool("update-bundle", false, "Publish a signed OTA update bundle with each build")
+	releaseConfigureCmd.Flags().String("compatible", "", "Compatible string devices must match to install bundles")
+	releaseConfigureCmd.Flags().String("update-hooks", "", "Path to a shell script the updater runs around slot installation")
 }
 
 func runReleaseCreate(cmd *cobra.Command, args []string) error {
@@ -179,6 +262,57 @@ func runReleaseConfigure(cmd *cobra.Command, args []string) error {
 		coreMap["partitioning"] = partMap
 		changed = true
 	}
+	if cmd.Flags().Changed("initramfs-generator") || cmd.Flags().Changed("initramfs-hooks") ||
+		cmd.Flags().Changed("initramfs-compression") || cmd.Flags().Changed("no-microcode") {
+		ensureMap(config, "core")
+		coreMap := config["core"].(map[string]interface{})
+		ensureMap(coreMap, "initramfs")
+		initramfsMap := coreMap["initramfs"].(map[string]interface{})
+		if cmd.Flags().Changed("initramfs-generator") {
+			v, _ := cmd.Flags().GetString("initramfs-generator")
+			initramfsMap["generator"] = v
+		}
+		if cmd.Flags().Changed("initramfs-hooks") {
+			v, _ := cmd.Flags().GetStringSlice("initramfs-hooks")
+			initramfsMap["hooks"] = v
+		}
+		if cmd.Flags().Changed("initramfs-compression") {
+			v, _ := cmd.Flags().GetString("initramfs-compression")
+			initramfsMap["compression"] = v
+		}
+		if cmd.Flags().Changed("no-microcode") {
+			v, _ := cmd.Flags().GetBool("no-microcode")
+			initramfsMap["no_microcode"] = v
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("firmware-drivers") || cmd.Flags().Changed("firmware-modules") ||
+		cmd.Flags().Changed("firmware-files") {
+		ensureMap(config, "core")
+		coreMap := config["core"].(map[string]interface{})
+		ensureMap(coreMap, "firmware")
+		firmwareMap := coreMap["firmware"].(map[string]interface{})
+		if cmd.Flags().Changed("firmware-drivers") {
+			v, _ := cmd.Flags().GetStringSlice("firmware-drivers")
+			firmwareMap["drivers"] = v
+		}
+		if cmd.Flags().Changed("firmware-modules") {
+			v, _ := cmd.Flags().GetStringSlice("firmware-modules")
+			firmwareMap["modules"] = v
+		}
+		if cmd.Flags().Changed("firmware-files") {
+			v, _ := cmd.Flags().GetStringSlice("firmware-files")
+			firmwareMap["files"] = v
+		}
+		changed = true
+	}
+	if cmd.Flags().Changed("firmware-version") {
+		v, _ := cmd.Flags().GetString("firmware-version")
+		ensureMap(config, "core")
+		config["core"].(map[string]interface{})["firmware_version"] = v
+		changed = true
+	}
 
 	// System
 	if cmd.Flags().Changed("init") {
@@ -230,6 +364,64 @@ func runReleaseConfigure(cmd *cobra.Command, args []string) error {
 		changed = true
 	}
 
+	if cmd.Flags().Changed("logging") || cmd.Flags().Changed("logging-version") || cmd.Flags().Changed("journal-storage") ||
+		cmd.Flags().Changed("journal-max-use") || cmd.Flags().Changed("journal-max-retention") || cmd.Flags().Changed("log-rule") ||
+		cmd.Flags().Changed("log-remote") || cmd.Flags().Changed("log-remote-port") || cmd.Flags().Changed("log-remote-protocol") {
+		ensureMap(config, "system")
+		systemMap := config["system"].(map[string]interface{})
+		ensureMap(systemMap, "logging")
+		loggingMap := systemMap["logging"].(map[string]interface{})
+		for flag, key := range map[string]string{
+			"logging":               "system",
+			"logging-version":       "version",
+			"journal-storage":       "storage",
+			"journal-max-use":       "max_use",
+			"journal-max-retention": "max_retention",
+		} {
+			if cmd.Flags().Changed(flag) {
+				v, _ := cmd.Flags().GetString(flag)
+				loggingMap[key] = v
+			}
+		}
+		if cmd.Flags().Changed("log-rule") {
+			v, _ := cmd.Flags().GetStringArray("log-rule")
+			loggingMap["rules"] = v
+		}
+		if cmd.Flags().Changed("log-remote") || cmd.Flags().Changed("log-remote-port") || cmd.Flags().Changed("log-remote-protocol") {
+			ensureMap(loggingMap, "remote")
+			remoteMap := loggingMap["remote"].(map[string]interface{})
+			if cmd.Flags().Changed("log-remote") {
+				v, _ := cmd.Flags().GetString("log-remote")
+				remoteMap["host"] = v
+			}
+			if cmd.Flags().Changed("log-remote-port") {
+				v, _ := cmd.Flags().GetInt("log-remote-port")
+				remoteMap["port"] = v
+			}
+			if cmd.Flags().Changed("log-remote-protocol") {
+				v, _ := cmd.Flags().GetString("log-remote-protocol")
+				remoteMap["protocol"] = v
+			}
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("resource-manager") || cmd.Flags().Changed("cgroup-hierarchy") {
+		ensureMap(config, "system")
+		systemMap := config["system"].(map[string]interface{})
+		ensureMap(systemMap, "resources")
+		resourcesMap := systemMap["resources"].(map[string]interface{})
+		if cmd.Flags().Changed("resource-manager") {
+			v, _ := cmd.Flags().GetString("resource-manager")
+			resourcesMap["manager"] = v
+		}
+		if cmd.Flags().Changed("cgroup-hierarchy") {
+			v, _ := cmd.Flags().GetString("cgroup-hierarchy")
+			resourcesMap["hierarchy"] = v
+		}
+		changed = true
+	}
+
 	// Security
 	if cmd.Flags().Changed("security") {
 		v, _ := cmd.Flags().GetString("security")
@@ -244,6 +436,165 @@ func runReleaseConfigure(cmd *cobra.Command, args []string) error {
 		changed = true
 	}
 
+	if cmd.Flags().Changed("secure-boot") || cmd.Flags().Changed("secure-boot-keys") ||
+		cmd.Flags().Changed("export-enrollment") {
+		ensureMap(config, "security")
+		securityMap := config["security"].(map[string]interface{})
+		sbMap, ok := securityMap["secure_boot"].(map[string]interface{})
+		if !ok {
+			sbMap = make(map[string]interface{})
+		}
+		if cmd.Flags().Changed("secure-boot") {
+			v, _ := cmd.Flags().GetBool("secure-boot")
+			sbMap["enabled"] = v
+		}
+		if cmd.Flags().Changed("secure-boot-keys") {
+			v, _ := cmd.Flags().GetString("secure-boot-keys")
+			sbMap["key_set_id"] = v
+		}
+		if cmd.Flags().Changed("export-enrollment") {
+			v, _ := cmd.Flags().GetBool("export-enrollment")
+			sbMap["export_enrollment"] = v
+		}
+		securityMap["secure_boot"] = sbMap
+		changed = true
+	}
+
+	if cmd.Flags().Changed("selinux-policy") || cmd.Flags().Changed("selinux-enforcing") || cmd.Flags().Changed("refpolicy-version") {
+		ensureMap(config, "security")
+		securityMap := config["security"].(map[string]interface{})
+		ensureMap(securityMap, "selinux")
+		selinuxMap := securityMap["selinux"].(map[string]interface{})
+		if cmd.Flags().Changed("selinux-policy") {
+			v, _ := cmd.Flags().GetString("selinux-policy")
+			selinuxMap["policy"] = v
+		}
+		if cmd.Flags().Changed("selinux-enforcing") {
+			v, _ := cmd.Flags().GetBool("selinux-enforcing")
+			selinuxMap["enforcing"] = v
+		}
+		if cmd.Flags().Changed("refpolicy-version") {
+			v, _ := cmd.Flags().GetString("refpolicy-version")
+			selinuxMap["refpolicy_version"] = v
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("apparmor-profiles") || cmd.Flags().Changed("apparmor-complain") {
+		ensureMap(config, "security")
+		securityMap := config["security"].(map[string]interface{})
+		ensureMap(securityMap, "apparmor")
+		apparmorMap := securityMap["apparmor"].(map[string]interface{})
+		if cmd.Flags().Changed("apparmor-profiles") {
+			v, _ := cmd.Flags().GetStringSlice("apparmor-profiles")
+			apparmorMap["profile_sets"] = v
+		}
+		if cmd.Flags().Changed("apparmor-complain") {
+			v, _ := cmd.Flags().GetBool("apparmor-complain")
+			apparmorMap["complain"] = v
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("verity") || cmd.Flags().Changed("verity-fs") || cmd.Flags().Changed("var-size") {
+		ensureMap(config, "security")
+		securityMap := config["security"].(map[string]interface{})
+		verityMap, ok := securityMap["verity"].(map[string]interface{})
+		if !ok {
+			verityMap = make(map[string]interface{})
+		}
+		if cmd.Flags().Changed("verity") {
+			v, _ := cmd.Flags().GetBool("verity")
+			verityMap["enabled"] = v
+		}
+		if cmd.Flags().Changed("verity-fs") {
+			v, _ := cmd.Flags().GetString("verity-fs")
+			verityMap["filesystem"] = v
+		}
+		if cmd.Flags().Changed("var-size") {
+			v, _ := cmd.Flags().GetInt("var-size")
+			verityMap["var_size_mb"] = v
+		}
+		securityMap["verity"] = verityMap
+		changed = true
+	}
+
+	if cmd.Flags().Changed("encrypt") || cmd.Flags().Changed("encrypt-recovery") || cmd.Flags().Changed("encrypt-tpm2") ||
+		cmd.Flags().Changed("encrypt-tpm2-pcrs") || cmd.Flags().Changed("encrypt-reencrypt") {
+		ensureMap(config, "security")
+		securityMap := config["security"].(map[string]interface{})
+		ensureMap(securityMap, "encryption")
+		encMap := securityMap["encryption"].(map[string]interface{})
+		for flag, key := range map[string]string{
+			"encrypt":           "enabled",
+			"encrypt-recovery":  "export_recovery",
+			"encrypt-tpm2":      "tpm2",
+			"encrypt-reencrypt": "reencrypt",
+		} {
+			if cmd.Flags().Changed(flag) {
+				v, _ := cmd.Flags().GetBool(flag)
+				encMap[key] = v
+			}
+		}
+		if cmd.Flags().Changed("encrypt-tpm2-pcrs") {
+			v, _ := cmd.Flags().GetString("encrypt-tpm2-pcrs")
+			encMap["tpm2_pcrs"] = v
+		}
+		changed = true
+	}
+
+	// System settings
+	if cmd.Flags().Changed("hostname") || cmd.Flags().Changed("timezone") || cmd.Flags().Changed("keymap") ||
+		cmd.Flags().Changed("locales") || cmd.Flags().Changed("ntp-servers") {
+		ensureMap(config, "settings")
+		settingsMap := config["settings"].(map[string]interface{})
+		for _, flag := range []string{"hostname", "timezone", "keymap"} {
+			if cmd.Flags().Changed(flag) {
+				v, _ := cmd.Flags().GetString(flag)
+				settingsMap[flag] = v
+			}
+		}
+		if cmd.Flags().Changed("locales") {
+			v, _ := cmd.Flags().GetStringSlice("locales")
+			settingsMap["locales"] = v
+		}
+		if cmd.Flags().Changed("ntp-servers") {
+			v, _ := cmd.Flags().GetStringSlice("ntp-servers")
+			settingsMap["ntp_servers"] = v
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("dns") || cmd.Flags().Changed("dns-search") || cmd.Flags().Changed("network-interfaces") {
+		ensureMap(config, "settings")
+		settingsMap := config["settings"].(map[string]interface{})
+		ensureMap(settingsMap, "network")
+		networkMap := settingsMap["network"].(map[string]interface{})
+		if cmd.Flags().Changed("dns") {
+			v, _ := cmd.Flags().GetStringSlice("dns")
+			networkMap["dns"] = v
+		}
+		if cmd.Flags().Changed("dns-search") {
+			v, _ := cmd.Flags().GetStringSlice("dns-search")
+			networkMap["search_domains"] = v
+		}
+		if cmd.Flags().Changed("network-interfaces") {
+			interfacesPath, _ := cmd.Flags().GetString("network-interfaces")
+			var interfaces []interface{}
+			if interfacesPath != "" {
+				data, err := os.ReadFile(interfacesPath)
+				if err != nil {
+					return fmt.Errorf("failed to read network interfaces: %w", err)
+				}
+				if err := json.Unmarshal(data, &interfaces); err != nil {
+					return fmt.Errorf("failed to parse network interfaces: %w", err)
+				}
+			}
+			networkMap["interfaces"] = interfaces
+		}
+		changed = true
+	}
+
 	// Runtime
 	if cmd.Flags().Changed("container") {
 		v, _ := cmd.Flags().GetString("container")
@@ -304,6 +655,217 @@ func runReleaseConfigure(cmd *cobra.Command, args []string) error {
 		targetMap["desktop"] = deskMap
 		changed = true
 	}
+	if cmd.Flags().Changed("cloud-provider") || cmd.Flags().Changed("cloud-datasources") ||
+		cmd.Flags().Changed("cloud-default-user") || cmd.Flags().Changed("cloud-no-growpart") ||
+		cmd.Flags().Changed("cloud-seed-ssh-key") || cmd.Flags().Changed("cloud-init-version") {
+		ensureMap(config, "target")
+		targetMap := config["target"].(map[string]interface{})
+		cloudMap, ok := targetMap["cloud"].(map[string]interface{})
+		if !ok {
+			cloudMap = make(map[string]interface{})
+		}
+		if cmd.Flags().Changed("cloud-provider") {
+			v, _ := cmd.Flags().GetString("cloud-provider")
+			cloudMap["provider"] = v
+		}
+		if cmd.Flags().Changed("cloud-datasources") {
+			v, _ := cmd.Flags().GetStringSlice("cloud-datasources")
+			cloudMap["datasources"] = v
+		}
+		if cmd.Flags().Changed("cloud-default-user") {
+			v, _ := cmd.Flags().GetString("cloud-default-user")
+			cloudMap["default_user"] = v
+		}
+		if cmd.Flags().Changed("cloud-no-growpart") {
+			v, _ := cmd.Flags().GetBool("cloud-no-growpart")
+			cloudMap["no_growpart"] = v
+		}
+		if cmd.Flags().Changed("cloud-seed-ssh-key") {
+			v, _ := cmd.Flags().GetStringArray("cloud-seed-ssh-key")
+			cloudMap["seed_ssh_keys"] = v
+		}
+		if cmd.Flags().Changed("cloud-init-version") {
+			v, _ := cmd.Flags().GetString("cloud-init-version")
+			cloudMap["cloud_init_version"] = v
+		}
+		targetMap["cloud"] = cloudMap
+		changed = true
+	}
+
+	// Build
+	if cmd.Flags().Changed("reproducible") {
+		v, _ := cmd.Flags().GetBool("reproducible")
+		ensureMap(config, "build")
+		config["build"].(map[string]interface{})["reproducible"] = v
+		changed = true
+	}
+	if cmd.Flags().Changed("source-date-epoch") {
+		v, _ := cmd.Flags().GetInt64("source-date-epoch")
+		ensureMap(config, "build")
+		config["build"].(map[string]interface{})["source_date_epoch"] = v
+		changed = true
+	}
+	if cmd.Flags().Changed("boot-test") || cmd.Flags().Changed("boot-test-timeout") || cmd.Flags().Changed("boot-test-marker") ||
+		cmd.Flags().Changed("boot-test-memory") || cmd.Flags().Changed("boot-test-command") {
+		ensureMap(config, "build")
+		buildMap := config["build"].(map[string]interface{})
+		ensureMap(buildMap, "boot_test")
+		testMap := buildMap["boot_test"].(map[string]interface{})
+		if cmd.Flags().Changed("boot-test") {
+			v, _ := cmd.Flags().GetBool("boot-test")
+			testMap["enabled"] = v
+		}
+		if cmd.Flags().Changed("boot-test-timeout") {
+			v, _ := cmd.Flags().GetInt("boot-test-timeout")
+			testMap["timeout_seconds"] = v
+		}
+		if cmd.Flags().Changed("boot-test-marker") {
+			v, _ := cmd.Flags().GetString("boot-test-marker")
+			testMap["success_marker"] = v
+		}
+		if cmd.Flags().Changed("boot-test-memory") {
+			v, _ := cmd.Flags().GetInt("boot-test-memory")
+			testMap["memory_mb"] = v
+		}
+		if cmd.Flags().Changed("boot-test-command") {
+			v, _ := cmd.Flags().GetStringArray("boot-test-command")
+			testMap["commands"] = v
+		}
+		changed = true
+	}
+	if cmd.Flags().Changed("oci-repository") || cmd.Flags().Changed("oci-tag") || cmd.Flags().Changed("oci-plain-http") {
+		ensureMap(config, "build")
+		buildMap := config["build"].(map[string]interface{})
+		ensureMap(buildMap, "oci")
+		ociMap := buildMap["oci"].(map[string]interface{})
+		if cmd.Flags().Changed("oci-repository") {
+			v, _ := cmd.Flags().GetString("oci-repository")
+			ociMap["repository"] = v
+		}
+		if cmd.Flags().Changed("oci-tag") {
+			v, _ := cmd.Flags().GetStringArray("oci-tag")
+			ociMap["tags"] = v
+		}
+		if cmd.Flags().Changed("oci-plain-http") {
+			v, _ := cmd.Flags().GetBool("oci-plain-http")
+			ociMap["plain_http"] = v
+		}
+		changed = true
+	}
+	if cmd.Flags().Changed("netboot-base-url") || cmd.Flags().Changed("netboot-root") ||
+		cmd.Flags().Changed("netboot-nfs-export") || cmd.Flags().Changed("netboot-kernel-args") {
+		ensureMap(config, "build")
+		buildMap := config["build"].(map[string]interface{})
+		ensureMap(buildMap, "netboot")
+		netbootMap := buildMap["netboot"].(map[string]interface{})
+		for flag, key := range map[string]string{
+			"netboot-base-url":    "base_url",
+			"netboot-root":        "root",
+			"netboot-nfs-export":  "nfs_export",
+			"netboot-kernel-args": "kernel_args",
+		} {
+			if cmd.Flags().Changed(flag) {
+				v, _ := cmd.Flags().GetString(flag)
+				netbootMap[key] = v
+			}
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("vm-memory") || cmd.Flags().Changed("vm-cpus") ||
+		cmd.Flags().Changed("vm-disk-bus") || cmd.Flags().Changed("vm-serial-console") {
+		ensureMap(config, "build")
+		buildMap := config["build"].(map[string]interface{})
+		ensureMap(buildMap, "vm")
+		vmMap := buildMap["vm"].(map[string]interface{})
+		if cmd.Flags().Changed("vm-memory") {
+			v, _ := cmd.Flags().GetInt("vm-memory")
+			vmMap["memory_mb"] = v
+		}
+		if cmd.Flags().Changed("vm-cpus") {
+			v, _ := cmd.Flags().GetInt("vm-cpus")
+			vmMap["cpus"] = v
+		}
+		if cmd.Flags().Changed("vm-disk-bus") {
+			v, _ := cmd.Flags().GetString("vm-disk-bus")
+			vmMap["disk_bus"] = v
+		}
+		if cmd.Flags().Changed("vm-serial-console") {
+			v, _ := cmd.Flags().GetBool("vm-serial-console")
+			vmMap["serial_console"] = v
+		}
+		changed = true
+	}
+
+	if cmd.Flags().Changed("live-installer") || cmd.Flags().Changed("live-answers") || cmd.Flags().Changed("live-persistence") {
+		ensureMap(config, "build")
+		buildMap := config["build"].(map[string]interface{})
+		ensureMap(buildMap, "live")
+		liveMap := buildMap["live"].(map[string]interface{})
+		if cmd.Flags().Changed("live-installer") {
+			v, _ := cmd.Flags().GetBool("live-installer")
+			liveMap["installer"] = v
+		}
+		if cmd.Flags().Changed("live-answers") {
+			answersPath, _ := cmd.Flags().GetString("live-answers")
+			var answers string
+			if answersPath != "" {
+				data, err := os.ReadFile(answersPath)
+				if err != nil {
+					return fmt.Errorf("failed to read installer answers: %w", err)
+				}
+				answers = string(data)
+			}
+			liveMap["answers"] = answers
+		}
+		if cmd.Flags().Changed("live-persistence") {
+			v, _ := cmd.Flags().GetBool("live-persistence")
+			liveMap["persistence"] = v
+		}
+		changed = true
+	}
+
+	// Update
+	if cmd.Flags().Changed("ab-slots") || cmd.Flags().Changed("slot-size") || cmd.Flags().Changed("data-size") ||
+		cmd.Flags().Changed("update-bundle") || cmd.Flags().Changed("compatible") {
+		ensureMap(config, "update")
+		updateMap := config["update"].(map[string]interface{})
+		if cmd.Flags().Changed("ab-slots") {
+			v, _ := cmd.Flags().GetBool("ab-slots")
+			updateMap["ab_slots"] = v
+		}
+		if cmd.Flags().Changed("slot-size") {
+			v, _ := cmd.Flags().GetInt("slot-size")
+			updateMap["slot_size_mb"] = v
+		}
+		if cmd.Flags().Changed("data-size") {
+			v, _ := cmd.Flags().GetInt("data-size")
+			updateMap["data_size_mb"] = v
+		}
+		if cmd.Flags().Changed("update-bundle") {
+			v, _ := cmd.Flags().GetBool("update-bundle")
+			updateMap["bundle"] = v
+		}
+		if cmd.Flags().Changed("compatible") {
+			v, _ := cmd.Flags().GetString("compatible")
+			updateMap["compatible"] = v
+		}
+		changed = true
+	}
+	if cmd.Flags().Changed("update-hooks") {
+		hooksPath, _ := cmd.Flags().GetString("update-hooks")
+		var hooks string
+		if hooksPath != "" {
+			data, err := os.ReadFile(hooksPath)
+			if err != nil {
+				return fmt.Errorf("failed to read update hooks: %w", err)
+			}
+			hooks = string(data)
+		}
+		ensureMap(config, "update")
+		config["update"].(map[string]interface{})["hooks"] = hooks
+		changed = true
+	}
 
 	if !changed {
 		output.PrintMessage("No configuration flags specified. Use --help to see available options.")
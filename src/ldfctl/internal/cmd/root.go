@@ -96,6 +96,10 @@ func init() {
 	rootCmd.AddCommand(langpackCmd)
 	rootCmd.AddCommand(releaseCmd)
 	rootCmd.AddCommand(buildCmd)
+	rootCmd.AddCommand(builderCmd)
+	rootCmd.AddCommand(signingKeyCmd)
+	rootCmd.AddCommand(securebootCmd)
+	rootCmd.AddCommand(boardCmd)
 
 	registerCompletions()
 }
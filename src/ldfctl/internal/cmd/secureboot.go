@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bitswalk/ldf/src/ldfctl/internal/client"
+	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var securebootCmd = &cobra.Command{
+	Use:   "secureboot",
+	Short: "Manage UEFI Secure Boot key sets",
+	Long: `Manages the PK/KEK/db key sets used to sign EFI binaries of releases
+configured with --secure-boot.`,
+}
+
+var securebootListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List Secure Boot key sets",
+	RunE:  runSecurebootList,
+}
+
+var securebootGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a new PK/KEK/db key set",
+	RunE:  runSecurebootGenerate,
+}
+
+var securebootImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import an existing PK/KEK/db key set from PEM files",
+	RunE:  runSecurebootImport,
+}
+
+var securebootActivateCmd = &cobra.Command{
+	Use:   "activate <key-set-id>",
+	Short: "Make a key set the default for builds",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSecurebootActivate,
+}
+
+var securebootDeleteCmd = &cobra.Command{
+	Use:   "delete <key-set-id>",
+	Short: "Delete a key set",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSecurebootDelete,
+}
+
+func init() {
+	securebootCmd.AddCommand(securebootListCmd)
+	securebootCmd.AddCommand(securebootGenerateCmd)
+	securebootCmd.AddCommand(securebootImportCmd)
+	securebootCmd.AddCommand(securebootActivateCmd)
+	securebootCmd.AddCommand(securebootDeleteCmd)
+
+	securebootGenerateCmd.Flags().String("name", "", "Key set name (required)")
+	securebootGenerateCmd.Flags().Bool("activate", false, "Make the new key set the default")
+	_ = securebootGenerateCmd.MarkFlagRequired("name")
+
+	securebootImportCmd.Flags().String("name", "", "Key set name (required)")
+	securebootImportCmd.Flags().String("owner-guid", "", "EFI signature owner GUID (generated when empty)")
+	securebootImportCmd.Flags().Bool("activate", false, "Make the imported key set the default")
+	for _, role := range []string{"pk", "kek", "db"} {
+		securebootImportCmd.Flags().String(role+"-cert", "", fmt.Sprintf("%s certificate PEM file (required)", role))
+		securebootImportCmd.Flags().String(role+"-key", "", fmt.Sprintf("%s private key PEM file (required)", role))
+		_ = securebootImportCmd.MarkFlagRequired(role + "-cert")
+		_ = securebootImportCmd.MarkFlagRequired(role + "-key")
+	}
+	_ = securebootImportCmd.MarkFlagRequired("name")
+}
+
+func runSecurebootList(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.ListSecureBootKeySets(ctx)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Count == 0 {
+			output.PrintMessage("No Secure Boot key sets found.")
+			return nil
+		}
+
+		rows := make([][]string, len(resp.KeySets))
+		for i, k := range resp.KeySets {
+			status := "inactive"
+			if k.Active {
+				status = "active"
+			}
+			rows[i] = []string{k.ID, k.Name, k.OwnerGUID, status, k.CreatedAt}
+		}
+		output.PrintTable([]string{"ID", "NAME", "OWNER GUID", "STATUS", "CREATED"}, rows)
+		return nil
+	})
+}
+
+func runSecurebootGenerate(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	activate, _ := cmd.Flags().GetBool("activate")
+
+	return createSecureBootKeySet(&client.CreateSecureBootKeySetRequest{Name: name, Activate: activate}, "generated")
+}
+
+func runSecurebootImport(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	ownerGUID, _ := cmd.Flags().GetString("owner-guid")
+	activate, _ := cmd.Flags().GetBool("activate")
+
+	req := &client.CreateSecureBootKeySetRequest{Name: name, OwnerGUID: ownerGUID, Activate: activate}
+	for role, dst := range map[string]**client.SecureBootKeyPair{"pk": &req.PK, "kek": &req.KEK, "db": &req.DB} {
+		pair, err := readSecureBootKeyPair(cmd, role)
+		if err != nil {
+			return err
+		}
+		*dst = pair
+	}
+
+	return createSecureBootKeySet(req, "imported")
+}
+
+// readSecureBootKeyPair loads the certificate and key files named by the
+// --<role>-cert and --<role>-key flags
+func readSecureBootKeyPair(cmd *cobra.Command, role string) (*client.SecureBootKeyPair, error) {
+	certPath, _ := cmd.Flags().GetString(role + "-cert")
+	keyPath, _ := cmd.Flags().GetString(role + "-key")
+
+	cert, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s certificate: %w", role, err)
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s private key: %w", role, err)
+	}
+
+	return &client.SecureBootKeyPair{Certificate: string(cert), PrivateKey: string(key)}, nil
+}
+
+// createSecureBootKeySet submits a generate or import request and prints the result
+func createSecureBootKeySet(req *client.CreateSecureBootKeySetRequest, verb string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	set, err := c.CreateSecureBootKeySet(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), set, func() error {
+		msg := fmt.Sprintf("Secure Boot key set %s (%s) %s.", set.ID, set.Name, verb)
+		if set.Active {
+			msg += " It is now the default key set."
+		}
+		output.PrintMessage(msg)
+		return nil
+	})
+}
+
+func runSecurebootActivate(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	set, err := c.ActivateSecureBootKeySet(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), set, func() error {
+		output.PrintMessage(fmt.Sprintf("Secure Boot key set %s (%s) is now the default.", set.ID, set.Name))
+		return nil
+	})
+}
+
+func runSecurebootDelete(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	if err := c.DeleteSecureBootKeySet(ctx, args[0]); err != nil {
+		return err
+	}
+
+	output.PrintMessage(fmt.Sprintf("Secure Boot key set %s deleted.", args[0]))
+	return nil
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bitswalk/ldf/src/ldfctl/internal/client"
+	"github.com/bitswalk/ldf/src/ldfctl/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var signingKeyCmd = &cobra.Command{
+	Use:   "signing-key",
+	Short: "Manage artifact signing keys",
+}
+
+var signingKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List signing keys",
+	RunE:  runSigningKeyList,
+}
+
+var signingKeyGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a new signing key",
+	RunE:  runSigningKeyGenerate,
+}
+
+var signingKeyImportCmd = &cobra.Command{
+	Use:   "import <private-key-file>",
+	Short: "Import a PKCS#8 PEM ed25519 private key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSigningKeyImport,
+}
+
+var signingKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the active signing key with a new one",
+	Long: `Generates a new active signing key and retires the current one. Retired
+keys no longer sign but still verify artifacts signed before the rotation.`,
+	RunE: runSigningKeyRotate,
+}
+
+func init() {
+	signingKeyCmd.AddCommand(signingKeyListCmd)
+	signingKeyCmd.AddCommand(signingKeyGenerateCmd)
+	signingKeyCmd.AddCommand(signingKeyImportCmd)
+	signingKeyCmd.AddCommand(signingKeyRotateCmd)
+
+	signingKeyGenerateCmd.Flags().String("name", "", "Key name (required)")
+	signingKeyGenerateCmd.Flags().Bool("activate", false, "Make the new key the active signing key")
+	_ = signingKeyGenerateCmd.MarkFlagRequired("name")
+
+	signingKeyImportCmd.Flags().String("name", "", "Key name (required)")
+	signingKeyImportCmd.Flags().Bool("activate", false, "Make the imported key the active signing key")
+	_ = signingKeyImportCmd.MarkFlagRequired("name")
+
+	signingKeyRotateCmd.Flags().String("name", "", "Name of the new key (required)")
+	_ = signingKeyRotateCmd.MarkFlagRequired("name")
+}
+
+func runSigningKeyList(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	resp, err := c.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), resp, func() error {
+		if resp.Count == 0 {
+			output.PrintMessage("No signing keys found.")
+			return nil
+		}
+
+		rows := make([][]string, len(resp.Keys))
+		for i, k := range resp.Keys {
+			status := "retired"
+			if k.Active {
+				status = "active"
+			} else if k.RetiredAt == "" {
+				status = "inactive"
+			}
+			rows[i] = []string{k.ID, k.Name, k.Algorithm, status, k.CreatedAt}
+		}
+		output.PrintTable([]string{"ID", "NAME", "ALGORITHM", "STATUS", "CREATED"}, rows)
+		return nil
+	})
+}
+
+func runSigningKeyGenerate(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	activate, _ := cmd.Flags().GetBool("activate")
+
+	return createSigningKey(&client.CreateSigningKeyRequest{Name: name, Activate: activate}, "generated")
+}
+
+func runSigningKeyImport(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	activate, _ := cmd.Flags().GetBool("activate")
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	return createSigningKey(&client.CreateSigningKeyRequest{Name: name, PrivateKey: string(data), Activate: activate}, "imported")
+}
+
+// createSigningKey submits a generate or import request and prints the result
+func createSigningKey(req *client.CreateSigningKeyRequest, verb string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	key, err := c.CreateSigningKey(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), key, func() error {
+		msg := fmt.Sprintf("Signing key %s (%s) %s.", key.ID, key.Name, verb)
+		if key.Active {
+			msg += " It is now the active key."
+		}
+		output.PrintMessage(msg)
+		return nil
+	})
+}
+
+func runSigningKeyRotate(cmd *cobra.Command, args []string) error {
+	c := getClient()
+	ctx := context.Background()
+
+	name, _ := cmd.Flags().GetString("name")
+
+	key, err := c.RotateSigningKey(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return output.PrintFormatted(getOutputFormat(), key, func() error {
+		output.PrintMessage(fmt.Sprintf("Signing key rotated. New active key: %s (%s).", key.ID, key.Name))
+		return nil
+	})
+}
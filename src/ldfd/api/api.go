@@ -15,7 +15,9 @@ import (
 	"github.com/bitswalk/ldf/src/ldfd/api/downloads"
 	apiforge "github.com/bitswalk/ldf/src/ldfd/api/forge"
 	"github.com/bitswalk/ldf/src/ldfd/api/langpacks"
+	"github.com/bitswalk/ldf/src/ldfd/api/securebootkeys"
 	"github.com/bitswalk/ldf/src/ldfd/api/settings"
+	"github.com/bitswalk/ldf/src/ldfd/api/signingkeys"
 	"github.com/bitswalk/ldf/src/ldfd/api/sources"
 	"github.com/bitswalk/ldf/src/ldfd/api/toolchains"
 	"github.com/bitswalk/ldf/src/ldfd/build"
@@ -81,12 +83,14 @@ func New(cfg Config) *API {
 		Builds: builds.NewHandler(builds.Config{
 			DistRepo:     cfg.DistRepo,
 			BuildManager: cfg.BuildManager,
+			DiskKeys:     cfg.DiskKeyService,
 		}),
 
 		Artifacts: artifacts.NewHandler(artifacts.Config{
-			DistRepo:   cfg.DistRepo,
-			Storage:    cfg.Storage,
-			JWTService: cfg.JWTService,
+			DistRepo:       cfg.DistRepo,
+			Storage:        cfg.Storage,
+			JWTService:     cfg.JWTService,
+			SigningService: cfg.SigningService,
 		}),
 
 		Branding: branding.NewHandler(branding.Config{
@@ -108,12 +112,21 @@ func New(cfg Config) *API {
 
 		BoardProfiles: boardprofiles.NewHandler(boardprofiles.Config{
 			BoardProfileRepo: cfg.BoardProfileRepo,
+			Storage:          cfg.Storage,
 		}),
 
 		ToolchainProfiles: toolchains.NewHandler(toolchains.Config{
 			ToolchainProfileRepo: cfg.ToolchainProfileRepo,
 		}),
 
+		SigningKeys: signingkeys.NewHandler(signingkeys.Config{
+			SigningService: cfg.SigningService,
+		}),
+
+		SecureBootKeys: securebootkeys.NewHandler(securebootkeys.Config{
+			SecureBootService: cfg.SecureBootService,
+		}),
+
 		jwtService:    cfg.JWTService,
 		rateLimiter:   NewRateLimiter(cfg.RateLimitConfig),
 		storage:       cfg.Storage,
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bitswalk/ldf/src/common/attestation"
 	"github.com/bitswalk/ldf/src/common/logs"
 	"github.com/bitswalk/ldf/src/ldfd/api/common"
 	"github.com/gin-gonic/gin"
@@ -22,6 +23,7 @@ func NewHandler(cfg Config) *Handler {
 		distRepo:   cfg.DistRepo,
 		storage:    cfg.Storage,
 		jwtService: cfg.JWTService,
+		signing:    cfg.SigningService,
 	}
 }
 
@@ -30,9 +32,11 @@ func getArtifactPrefix(ownerID, distributionID string) string {
 	return fmt.Sprintf("distribution/%s/%s/", ownerID, distributionID)
 }
 
-// getArtifactKey returns the full S3 key for an artifact
+// getArtifactKey returns the full S3 key for an artifact. The path is
+// cleaned as an absolute path first so ".." segments cannot climb out of
+// the distribution's prefix, e.g. into private build keys.
 func getArtifactKey(ownerID, distributionID, path string) string {
-	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+path)), "/")
 	return fmt.Sprintf("distribution/%s/%s/%s", ownerID, distributionID, path)
 }
 
@@ -364,6 +368,81 @@ func (h *Handler) HandleGetURL(c *gin.Context) {
 	})
 }
 
+// HandleVerify checks an artifact against its detached minisign signature
+// @Summary      Verify artifact signature
+// @Description  Verifies an artifact against the detached signature stored next to it ({path}.minisig) using the server's current and retired signing keys
+// @Tags         Artifacts
+// @Produce      json
+// @Param        id    path      string  true  "Distribution ID"
+// @Param        path  path      string  true  "Artifact path"
+// @Success      200   {object}  ArtifactVerifyResponse
+// @Failure      400   {object}  common.ErrorResponse
+// @Failure      404   {object}  common.ErrorResponse
+// @Failure      500   {object}  common.ErrorResponse
+// @Failure      503   {object}  common.ErrorResponse
+// @Router       /v1/distributions/{id}/artifacts-verify/{path} [get]
+func (h *Handler) HandleVerify(c *gin.Context) {
+	if h.storage == nil {
+		common.ServiceUnavailable(c, "Storage service not configured")
+		return
+	}
+	if h.signing == nil {
+		common.ServiceUnavailable(c, "Signing is not configured")
+		return
+	}
+
+	distID := c.Param("id")
+	if distID == "" {
+		common.BadRequest(c, "Distribution ID required")
+		return
+	}
+
+	distInfo, ok := h.checkDistributionAccess(c, distID)
+	if !ok {
+		return
+	}
+
+	artifactPath := strings.TrimPrefix(c.Param("path"), "/")
+	if artifactPath == "" {
+		common.BadRequest(c, "Artifact path required")
+		return
+	}
+
+	key := getArtifactKey(distInfo.OwnerID, distInfo.ID, artifactPath)
+
+	sigReader, _, err := h.storage.Download(c.Request.Context(), key+attestation.SignatureSuffix)
+	if err != nil {
+		common.NotFound(c, "Artifact signature not found")
+		return
+	}
+	sig, err := io.ReadAll(sigReader)
+	sigReader.Close()
+	if err != nil {
+		common.InternalError(c, "Failed to read signature: "+err.Error())
+		return
+	}
+
+	reader, _, err := h.storage.Download(c.Request.Context(), key)
+	if err != nil {
+		common.NotFound(c, "Artifact not found")
+		return
+	}
+	defer reader.Close()
+
+	resp := ArtifactVerifyResponse{Path: artifactPath}
+	signer, comment, err := h.signing.VerifyDetached(reader, sig)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Valid = true
+		resp.KeyID = signer.ID
+		resp.KeyName = signer.Name
+		resp.TrustedComment = comment
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // HandleListAll lists all artifacts across all accessible distributions
 // @Summary      List all artifacts
 // @Description  Lists all artifacts across all accessible distributions
@@ -5,6 +5,7 @@ import (
 
 	"github.com/bitswalk/ldf/src/ldfd/auth"
 	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/signing"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
 )
 
@@ -13,13 +14,15 @@ type Handler struct {
 	distRepo   *db.DistributionRepository
 	storage    storage.Backend
 	jwtService *auth.JWTService
+	signing    *signing.Service
 }
 
 // Config contains configuration options for the Handler
 type Config struct {
-	DistRepo   *db.DistributionRepository
-	Storage    storage.Backend
-	JWTService *auth.JWTService
+	DistRepo       *db.DistributionRepository
+	Storage        storage.Backend
+	JWTService     *auth.JWTService
+	SigningService *signing.Service
 }
 
 // ArtifactUploadResponse represents the response after uploading an artifact
@@ -43,6 +46,16 @@ type ArtifactURLResponse struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// ArtifactVerifyResponse represents the result of checking an artifact's detached signature
+type ArtifactVerifyResponse struct {
+	Path           string `json:"path" example:"builds/4f1c2a/disk.img"`
+	Valid          bool   `json:"valid" example:"true"`
+	KeyID          string `json:"key_id,omitempty" example:"9b2e61d04c7a83f15e0b6d2a4c8f1e37"`
+	KeyName        string `json:"key_name,omitempty" example:"ldfd-default"`
+	TrustedComment string `json:"trusted_comment,omitempty" example:"timestamp:1700000000	file:disk.img	build:4f1c2a"`
+	Error          string `json:"error,omitempty"`
+}
+
 // StorageStatusResponse represents the storage status
 type StorageStatusResponse struct {
 	Available bool   `json:"available" example:"true"`
@@ -0,0 +1,764 @@
+package profiles
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/common/logs"
+	"github.com/bitswalk/ldf/src/ldfd/api/common"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/gin-gonic/gin"
+)
+
+var log = logs.NewDefault()
+
+const (
+	// bundleManifestName is the first entry of a board profile bundle
+	bundleManifestName = "manifest.json"
+
+	// bundleFilesDir holds the attached files of bundled profiles
+	bundleFilesDir = "files"
+
+	// maxBundleManifestSize bounds the manifest read during import
+	maxBundleManifestSize = 1 << 20
+)
+
+// HandleResolve returns a board profile with its ancestors' configuration merged in
+// @Summary      Preview a resolved board profile
+// @Description  Returns a board profile with the configuration of its parent chain deep-merged under its own
+// @Tags         Board Profiles
+// @Produce      json
+// @Param        id   path      string  true  "Board Profile ID"
+// @Success      200  {object}  ResolvedBoardProfileResponse
+// @Failure      400  {object}  common.ErrorResponse
+// @Failure      404  {object}  common.ErrorResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Router       /v1/board/profiles/{id}/resolved [get]
+func (h *Handler) HandleResolve(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		common.BadRequest(c, "Board profile ID required")
+		return
+	}
+
+	chain, err := h.boardProfileRepo.GetChain(id)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if chain == nil {
+		common.NotFound(c, "Board profile not found")
+		return
+	}
+
+	names := make([]string, 0, len(chain))
+	for _, bp := range chain {
+		names = append(names, bp.Name)
+	}
+
+	c.JSON(http.StatusOK, ResolvedBoardProfileResponse{
+		Profile: *db.ResolveBoardProfile(chain),
+		Chain:   names,
+	})
+}
+
+// HandleListFiles lists the files attached to a board profile
+// @Summary      List board profile files
+// @Description  Lists the firmware and device tree files attached to a board profile
+// @Tags         Board Profiles
+// @Produce      json
+// @Param        id   path      string  true  "Board Profile ID"
+// @Success      200  {object}  BoardProfileFileListResponse
+// @Failure      400  {object}  common.ErrorResponse
+// @Failure      404  {object}  common.ErrorResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Failure      503  {object}  common.ErrorResponse
+// @Router       /v1/board/profiles/{id}/files [get]
+func (h *Handler) HandleListFiles(c *gin.Context) {
+	if h.storage == nil {
+		common.ServiceUnavailable(c, "Storage service not configured")
+		return
+	}
+
+	profile, ok := h.getProfile(c)
+	if !ok {
+		return
+	}
+
+	files, err := h.listFiles(c, profile.ID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, BoardProfileFileListResponse{
+		Count: len(files),
+		Files: files,
+	})
+}
+
+// HandleUploadFile attaches a file to a board profile
+// @Summary      Upload a board profile file
+// @Description  Attaches a firmware blob or device tree overlay to a board profile, replacing any file at the same path
+// @Tags         Board Profiles
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id    path      string  true  "Board Profile ID"
+// @Param        path  path      string  true  "File path within the profile"
+// @Param        file  formData  file    true  "File contents"
+// @Success      201   {object}  BoardProfileFile
+// @Failure      400   {object}  common.ErrorResponse
+// @Failure      401   {object}  common.ErrorResponse
+// @Failure      403   {object}  common.ErrorResponse
+// @Failure      404   {object}  common.ErrorResponse
+// @Failure      500   {object}  common.ErrorResponse
+// @Failure      503   {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/board/profiles/{id}/files/{path} [put]
+func (h *Handler) HandleUploadFile(c *gin.Context) {
+	if h.storage == nil {
+		common.ServiceUnavailable(c, "Storage service not configured")
+		return
+	}
+
+	profile, ok := h.getModifiableProfile(c)
+	if !ok {
+		return
+	}
+
+	filePath, err := db.CleanBoardProfileFilePath(strings.TrimPrefix(c.Param("path"), "/"))
+	if err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		common.BadRequest(c, "No file provided: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	key := db.BoardProfileFileKey(profile.ID, filePath)
+	if err := h.storage.Upload(c.Request.Context(), key, file, header.Size, "application/octet-stream"); err != nil {
+		common.InternalError(c, "Failed to upload board profile file: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, BoardProfileFile{
+		Path: filePath,
+		Size: header.Size,
+	})
+}
+
+// HandleDeleteFile removes a file attached to a board profile
+// @Summary      Delete a board profile file
+// @Description  Removes a file attached to a board profile
+// @Tags         Board Profiles
+// @Param        id    path      string  true  "Board Profile ID"
+// @Param        path  path      string  true  "File path within the profile"
+// @Success      204   "No Content"
+// @Failure      400   {object}  common.ErrorResponse
+// @Failure      401   {object}  common.ErrorResponse
+// @Failure      403   {object}  common.ErrorResponse
+// @Failure      404   {object}  common.ErrorResponse
+// @Failure      500   {object}  common.ErrorResponse
+// @Failure      503   {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/board/profiles/{id}/files/{path} [delete]
+func (h *Handler) HandleDeleteFile(c *gin.Context) {
+	if h.storage == nil {
+		common.ServiceUnavailable(c, "Storage service not configured")
+		return
+	}
+
+	profile, ok := h.getModifiableProfile(c)
+	if !ok {
+		return
+	}
+
+	filePath, err := db.CleanBoardProfileFilePath(strings.TrimPrefix(c.Param("path"), "/"))
+	if err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	key := db.BoardProfileFileKey(profile.ID, filePath)
+	exists, err := h.storage.Exists(c.Request.Context(), key)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if !exists {
+		common.NotFound(c, "Board profile file not found: "+filePath)
+		return
+	}
+
+	if err := h.storage.Delete(c.Request.Context(), key); err != nil {
+		common.InternalError(c, "Failed to delete board profile file: "+err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleExport exports a board profile as a self-contained bundle
+// @Summary      Export a board profile bundle
+// @Description  Exports a board profile, its ancestors and their attached files as a gzipped tar bundle
+// @Tags         Board Profiles
+// @Produce      application/gzip
+// @Param        id   path      string  true  "Board Profile ID"
+// @Success      200  {file}    binary
+// @Failure      400  {object}  common.ErrorResponse
+// @Failure      404  {object}  common.ErrorResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Router       /v1/board/profiles/{id}/export [get]
+func (h *Handler) HandleExport(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		common.BadRequest(c, "Board profile ID required")
+		return
+	}
+
+	chain, err := h.boardProfileRepo.GetChain(id)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if chain == nil {
+		common.NotFound(c, "Board profile not found")
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "board-bundle-*")
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Fetch every attached file first so the manifest can carry checksums
+	bundle := BoardProfileBundle{
+		FormatVersion: BoardProfileBundleFormatVersion,
+		Profile:       chain[0].Name,
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		bp := chain[i]
+		bundled := BundledBoardProfile{
+			Name:        bp.Name,
+			DisplayName: bp.DisplayName,
+			Description: bp.Description,
+			Arch:        string(bp.Arch),
+			Config:      bp.Config,
+		}
+		if i < len(chain)-1 {
+			bundled.Parent = chain[i+1].Name
+		}
+		if h.storage != nil {
+			files, err := h.fetchFiles(c, bp, filepath.Join(tmpDir, bp.Name))
+			if err != nil {
+				common.InternalError(c, err.Error())
+				return
+			}
+			bundled.Files = files
+		}
+		bundle.Profiles = append(bundle.Profiles, bundled)
+	}
+
+	manifest, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", chain[0].Name+".ldfboard.tar.gz"))
+	c.Header("Content-Type", "application/gzip")
+	c.Status(http.StatusOK)
+
+	if err := writeBundle(c.Writer, manifest, bundle, tmpDir); err != nil {
+		log.Warn("Failed to stream board profile bundle", "profile", chain[0].Name, "error", err)
+	}
+}
+
+// HandleImport creates board profiles from an exported bundle
+// @Summary      Import a board profile bundle
+// @Description  Creates the board profile in a bundle along with any ancestors that do not exist yet and their attached files. Existing ancestors are reused only when their parent, configuration and files match the bundle.
+// @Tags         Board Profiles
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file  formData  file  true  "Board profile bundle (.tar.gz)"
+// @Success      201   {object}  ImportBoardProfileResponse
+// @Failure      400   {object}  common.ErrorResponse
+// @Failure      401   {object}  common.ErrorResponse
+// @Failure      409   {object}  common.ErrorResponse
+// @Failure      500   {object}  common.ErrorResponse
+// @Failure      503   {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/board/profiles/import [post]
+func (h *Handler) HandleImport(c *gin.Context) {
+	if h.storage == nil {
+		common.ServiceUnavailable(c, "Storage service not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		common.BadRequest(c, "No file provided: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	tmpDir, err := os.MkdirTemp("", "board-bundle-*")
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bundle, err := readBundle(file, tmpDir)
+	if err != nil {
+		common.BadRequest(c, "Invalid board profile bundle: "+err.Error())
+		return
+	}
+
+	// Reuse ancestors that already exist, refuse to overwrite the profile
+	// itself, and drop whatever was created if the import fails midway
+	resp := ImportBoardProfileResponse{Created: []string{}, Reused: []string{}}
+	parentID := ""
+	var created []string
+	committed := false
+	defer func() {
+		if !committed {
+			h.rollbackImport(c, created)
+		}
+	}()
+	for i, bundled := range bundle.Profiles {
+		existing, err := h.boardProfileRepo.GetByName(bundled.Name)
+		if err != nil {
+			common.InternalError(c, err.Error())
+			return
+		}
+		if existing != nil {
+			if i == len(bundle.Profiles)-1 {
+				common.Conflict(c, "Board profile name already exists: "+bundled.Name)
+				return
+			}
+			if string(existing.Arch) != bundled.Arch {
+				common.Conflict(c, fmt.Sprintf("Existing board profile %s targets %s", existing.Name, existing.Arch))
+				return
+			}
+			// A profile is only reused when it sits in the same inheritance
+			// tree and holds what the bundle does
+			if existing.ParentID != parentID {
+				common.Conflict(c, fmt.Sprintf("Existing board profile %s extends a different parent than in the bundle", existing.Name))
+				return
+			}
+			mismatch, err := h.bundleMismatch(c, existing, bundled)
+			if err != nil {
+				common.InternalError(c, err.Error())
+				return
+			}
+			if mismatch != "" {
+				common.Conflict(c, fmt.Sprintf("Existing board profile %s differs from the bundle: %s", existing.Name, mismatch))
+				return
+			}
+			resp.Reused = append(resp.Reused, existing.Name)
+			parentID = existing.ID
+			continue
+		}
+
+		profile := &db.BoardProfile{
+			Name:        bundled.Name,
+			DisplayName: bundled.DisplayName,
+			Description: bundled.Description,
+			Arch:        db.TargetArch(bundled.Arch),
+			ParentID:    parentID,
+			Config:      bundled.Config,
+			IsSystem:    false,
+			OwnerID:     claims.UserID,
+		}
+		if err := h.boardProfileRepo.Create(profile); err != nil {
+			common.InternalError(c, err.Error())
+			return
+		}
+		created = append(created, profile.ID)
+
+		for _, f := range bundled.Files {
+			if err := h.uploadBundledFile(c, profile.ID, filepath.Join(tmpDir, bundled.Name), f); err != nil {
+				common.InternalError(c, err.Error())
+				return
+			}
+		}
+
+		resp.Created = append(resp.Created, profile.Name)
+		parentID = profile.ID
+		resp.Profile = *profile
+	}
+
+	committed = true
+	c.JSON(http.StatusCreated, resp)
+}
+
+// bundleMismatch describes how an existing profile differs from its
+// bundled counterpart in configuration or attached files, or returns ""
+// when they match
+func (h *Handler) bundleMismatch(c *gin.Context, existing *db.BoardProfile, bundled BundledBoardProfile) (string, error) {
+	have, err := json.Marshal(existing.Config)
+	if err != nil {
+		return "", err
+	}
+	want, err := json.Marshal(bundled.Config)
+	if err != nil {
+		return "", err
+	}
+	if string(have) != string(want) {
+		return "configuration", nil
+	}
+
+	files, err := h.listFiles(c, existing.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(files) != len(bundled.Files) {
+		return "attached files", nil
+	}
+	sizes := make(map[string]int64, len(files))
+	for _, f := range files {
+		sizes[f.Path] = f.Size
+	}
+	for _, f := range bundled.Files {
+		if size, ok := sizes[f.Path]; !ok || size != f.Size {
+			return "file " + f.Path, nil
+		}
+		reader, _, err := h.storage.Download(c.Request.Context(), db.BoardProfileFileKey(existing.ID, f.Path))
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s file %s: %w", existing.Name, f.Path, err)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, reader)
+		reader.Close()
+		if err != nil {
+			return "", err
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != f.SHA256 {
+			return "file " + f.Path, nil
+		}
+	}
+	return "", nil
+}
+
+// rollbackImport removes the profiles and files created by a failed import,
+// children before their parents
+func (h *Handler) rollbackImport(c *gin.Context, ids []string) {
+	for i := len(ids) - 1; i >= 0; i-- {
+		prefix := db.BoardProfileFilesPrefix(ids[i])
+		if objects, err := h.storage.List(c.Request.Context(), prefix); err == nil {
+			for _, obj := range objects {
+				_ = h.storage.Delete(c.Request.Context(), obj.Key)
+			}
+		}
+		if err := h.boardProfileRepo.Delete(ids[i]); err != nil {
+			log.Warn("Failed to roll back imported board profile", "profile_id", ids[i], "error", err)
+		}
+	}
+}
+
+// getProfile loads the board profile named by the id path parameter,
+// writing the error response when it cannot
+func (h *Handler) getProfile(c *gin.Context) (*db.BoardProfile, bool) {
+	id := c.Param("id")
+	if id == "" {
+		common.BadRequest(c, "Board profile ID required")
+		return nil, false
+	}
+
+	profile, err := h.boardProfileRepo.GetByID(id)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return nil, false
+	}
+	if profile == nil {
+		common.NotFound(c, "Board profile not found")
+		return nil, false
+	}
+	return profile, true
+}
+
+// getModifiableProfile loads the board profile named by the id path
+// parameter and checks that the caller may modify it
+func (h *Handler) getModifiableProfile(c *gin.Context) (*db.BoardProfile, bool) {
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return nil, false
+	}
+
+	profile, ok := h.getProfile(c)
+	if !ok {
+		return nil, false
+	}
+
+	if profile.IsSystem && !claims.HasAdminAccess() {
+		common.Forbidden(c, "Admin access required to modify system profiles")
+		return nil, false
+	}
+	if !profile.IsSystem && profile.OwnerID != claims.UserID && !claims.HasAdminAccess() {
+		common.Forbidden(c, "You can only modify your own profiles")
+		return nil, false
+	}
+	return profile, true
+}
+
+// listFiles returns the files attached to a board profile
+func (h *Handler) listFiles(c *gin.Context, profileID string) ([]BoardProfileFile, error) {
+	prefix := db.BoardProfileFilesPrefix(profileID)
+	objects, err := h.storage.List(c.Request.Context(), prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list board profile files: %w", err)
+	}
+
+	files := []BoardProfileFile{}
+	for _, obj := range objects {
+		files = append(files, BoardProfileFile{
+			Path: strings.TrimPrefix(obj.Key, prefix),
+			Size: obj.Size,
+		})
+	}
+	return files, nil
+}
+
+// fetchFiles downloads the files attached to a board profile into dir
+func (h *Handler) fetchFiles(c *gin.Context, bp db.BoardProfile, dir string) ([]BundledFile, error) {
+	files, err := h.listFiles(c, bp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundled []BundledFile
+	for _, f := range files {
+		reader, _, err := h.storage.Download(c.Request.Context(), db.BoardProfileFileKey(bp.ID, f.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s file %s: %w", bp.Name, f.Path, err)
+		}
+		sum, size, err := writeFileHashed(filepath.Join(dir, filepath.FromSlash(f.Path)), reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		bundled = append(bundled, BundledFile{Path: f.Path, Size: size, SHA256: sum})
+	}
+	return bundled, nil
+}
+
+// uploadBundledFile stores a file extracted from a bundle on a profile
+func (h *Handler) uploadBundledFile(c *gin.Context, profileID, dir string, f BundledFile) error {
+	src, err := os.Open(filepath.Join(dir, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	key := db.BoardProfileFileKey(profileID, f.Path)
+	if err := h.storage.Upload(c.Request.Context(), key, src, f.Size, "application/octet-stream"); err != nil {
+		return fmt.Errorf("failed to upload board profile file %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// writeBundle writes a gzipped tar bundle holding the manifest followed by
+// the files of each bundled profile, read from dir/<profile name>
+func writeBundle(w io.Writer, manifest []byte, bundle BoardProfileBundle, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     bundleManifestName,
+		Mode:     0644,
+		Size:     int64(len(manifest)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, bp := range bundle.Profiles {
+		for _, f := range bp.Files {
+			if err := tw.WriteHeader(&tar.Header{
+				Name:     path.Join(bundleFilesDir, bp.Name, f.Path),
+				Mode:     0644,
+				Size:     f.Size,
+				Typeflag: tar.TypeReg,
+			}); err != nil {
+				return err
+			}
+			src, err := os.Open(filepath.Join(dir, bp.Name, filepath.FromSlash(f.Path)))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, src)
+			src.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readBundle reads and validates a gzipped tar bundle, extracting the
+// files of each bundled profile into dir/<profile name>
+func readBundle(r io.Reader, dir string) (*BoardProfileBundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if hdr.Name != bundleManifestName {
+		return nil, fmt.Errorf("first entry must be %s, got %s", bundleManifestName, hdr.Name)
+	}
+	data, err := io.ReadAll(io.LimitReader(tr, maxBundleManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if len(data) > maxBundleManifestSize {
+		return nil, fmt.Errorf("manifest exceeds %d bytes", maxBundleManifestSize)
+	}
+
+	var bundle BoardProfileBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	expected, err := validateBundle(&bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		f, ok := expected[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+		delete(expected, hdr.Name)
+
+		sum, size, err := writeFileHashed(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(hdr.Name, bundleFilesDir+"/"))), io.LimitReader(tr, f.Size+1))
+		if err != nil {
+			return nil, err
+		}
+		if size != f.Size || sum != f.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", hdr.Name)
+		}
+	}
+
+	for name := range expected {
+		return nil, fmt.Errorf("missing entry %s", name)
+	}
+	return &bundle, nil
+}
+
+// validateBundle checks a bundle manifest's profile chain and file paths,
+// returning the archive entries it references keyed by name
+func validateBundle(bundle *BoardProfileBundle) (map[string]BundledFile, error) {
+	if bundle.FormatVersion != BoardProfileBundleFormatVersion {
+		return nil, fmt.Errorf("unsupported format version %d", bundle.FormatVersion)
+	}
+	if len(bundle.Profiles) == 0 {
+		return nil, fmt.Errorf("bundle contains no profiles")
+	}
+	if len(bundle.Profiles) > db.MaxBoardProfileDepth {
+		return nil, fmt.Errorf("bundle inheritance deeper than %d levels", db.MaxBoardProfileDepth)
+	}
+	if last := bundle.Profiles[len(bundle.Profiles)-1]; last.Name != bundle.Profile {
+		return nil, fmt.Errorf("bundle profile %s is not the last of its chain", bundle.Profile)
+	}
+
+	expected := make(map[string]BundledFile)
+	arch := bundle.Profiles[0].Arch
+	for i, bp := range bundle.Profiles {
+		if bp.Name == "" || strings.ContainsAny(bp.Name, "/\\") || bp.Name == "." || bp.Name == ".." {
+			return nil, fmt.Errorf("invalid profile name %q", bp.Name)
+		}
+		if bp.Arch != string(db.ArchX86_64) && bp.Arch != string(db.ArchAARCH64) {
+			return nil, fmt.Errorf("profile %s has unsupported arch %q", bp.Name, bp.Arch)
+		}
+		if bp.Arch != arch {
+			return nil, fmt.Errorf("profile %s targets %s, its ancestors %s", bp.Name, bp.Arch, arch)
+		}
+		parent := ""
+		if i > 0 {
+			parent = bundle.Profiles[i-1].Name
+		}
+		if bp.Parent != parent {
+			return nil, fmt.Errorf("profile %s extends %q, expected %q", bp.Name, bp.Parent, parent)
+		}
+		for _, f := range bp.Files {
+			cleaned, err := db.CleanBoardProfileFilePath(f.Path)
+			if err != nil || cleaned != f.Path {
+				return nil, fmt.Errorf("profile %s has invalid file path %q", bp.Name, f.Path)
+			}
+			name := path.Join(bundleFilesDir, bp.Name, f.Path)
+			if _, dup := expected[name]; dup {
+				return nil, fmt.Errorf("profile %s lists %s twice", bp.Name, f.Path)
+			}
+			expected[name] = f
+		}
+	}
+	return expected, nil
+}
+
+// writeFileHashed writes r to dest, creating parent directories, and
+// returns the SHA-256 and size of the written contents
+func writeFileHashed(dest string, r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", 0, err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
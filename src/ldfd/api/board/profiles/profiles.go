@@ -1,6 +1,7 @@
 package profiles
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/bitswalk/ldf/src/ldfd/api/common"
@@ -12,6 +13,7 @@ import (
 func NewHandler(cfg Config) *Handler {
 	return &Handler{
 		boardProfileRepo: cfg.BoardProfileRepo,
+		storage:          cfg.Storage,
 	}
 }
 
@@ -120,11 +122,22 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		return
 	}
 
+	if req.ParentID != "" {
+		if msg, err := h.validateParent("", arch, req.ParentID); err != nil {
+			common.InternalError(c, err.Error())
+			return
+		} else if msg != "" {
+			common.BadRequest(c, msg)
+			return
+		}
+	}
+
 	profile := &db.BoardProfile{
 		Name:        req.Name,
 		DisplayName: req.DisplayName,
 		Description: req.Description,
 		Arch:        arch,
+		ParentID:    req.ParentID,
 		Config:      req.Config,
 		IsSystem:    false,
 		OwnerID:     claims.UserID,
@@ -215,6 +228,18 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 	if req.Description != nil {
 		profile.Description = *req.Description
 	}
+	if req.ParentID != nil && *req.ParentID != profile.ParentID {
+		if *req.ParentID != "" {
+			if msg, err := h.validateParent(profile.ID, profile.Arch, *req.ParentID); err != nil {
+				common.InternalError(c, err.Error())
+				return
+			} else if msg != "" {
+				common.BadRequest(c, msg)
+				return
+			}
+		}
+		profile.ParentID = *req.ParentID
+	}
 	if req.Config != nil {
 		profile.Config = *req.Config
 	}
@@ -276,10 +301,63 @@ func (h *Handler) HandleDelete(c *gin.Context) {
 		return
 	}
 
+	// Profiles extended by others cannot be deleted
+	children, err := h.boardProfileRepo.ListChildren(id)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if len(children) > 0 {
+		common.Conflict(c, "Board profile is extended by "+children[0].Name)
+		return
+	}
+
 	if err := h.boardProfileRepo.Delete(id); err != nil {
 		common.InternalError(c, err.Error())
 		return
 	}
 
+	if h.storage != nil {
+		prefix := db.BoardProfileFilesPrefix(id)
+		if objects, err := h.storage.List(c.Request.Context(), prefix); err == nil {
+			for _, obj := range objects {
+				_ = h.storage.Delete(c.Request.Context(), obj.Key)
+			}
+		}
+	}
+
 	c.Status(http.StatusNoContent)
 }
+
+// validateParent checks that parentID can be the parent of the profile
+// profileID (empty for a new profile) built for arch. It returns a
+// client-facing message when the parent is unsuitable.
+func (h *Handler) validateParent(profileID string, arch db.TargetArch, parentID string) (string, error) {
+	if parentID == profileID {
+		return "Board profile cannot extend itself", nil
+	}
+	parent, err := h.boardProfileRepo.GetByID(parentID)
+	if err != nil {
+		return "", err
+	}
+	if parent == nil {
+		return "Parent board profile not found: " + parentID, nil
+	}
+	if parent.Arch != arch {
+		return "Parent board profile " + parent.Name + " targets " + string(parent.Arch), nil
+	}
+
+	chain, err := h.boardProfileRepo.GetChain(parentID)
+	if err != nil {
+		return err.Error(), nil
+	}
+	for _, ancestor := range chain {
+		if ancestor.ID == profileID {
+			return "Board profile inheritance would loop through " + parent.Name, nil
+		}
+	}
+	if len(chain) >= db.MaxBoardProfileDepth {
+		return fmt.Sprintf("Board profile inheritance deeper than %d levels", db.MaxBoardProfileDepth), nil
+	}
+	return "", nil
+}
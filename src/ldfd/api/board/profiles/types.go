@@ -2,16 +2,19 @@ package profiles
 
 import (
 	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/storage"
 )
 
 // Handler handles board profile HTTP requests
 type Handler struct {
 	boardProfileRepo *db.BoardProfileRepository
+	storage          storage.Backend
 }
 
 // Config contains configuration options for the Handler
 type Config struct {
 	BoardProfileRepo *db.BoardProfileRepository
+	Storage          storage.Backend
 }
 
 // CreateBoardProfileRequest represents the request to create a board profile
@@ -20,6 +23,7 @@ type CreateBoardProfileRequest struct {
 	DisplayName string         `json:"display_name" binding:"required" example:"NVIDIA Jetson Orin"`
 	Description string         `json:"description" example:"NVIDIA Jetson Orin developer kit"`
 	Arch        string         `json:"arch" binding:"required,oneof=x86_64 aarch64" example:"aarch64"`
+	ParentID    string         `json:"parent_id" example:""`
 	Config      db.BoardConfig `json:"config"`
 }
 
@@ -28,6 +32,7 @@ type UpdateBoardProfileRequest struct {
 	Name        *string         `json:"name" example:"jetson-orin"`
 	DisplayName *string         `json:"display_name" example:"NVIDIA Jetson Orin"`
 	Description *string         `json:"description" example:"NVIDIA Jetson Orin developer kit"`
+	ParentID    *string         `json:"parent_id" example:""`
 	Config      *db.BoardConfig `json:"config"`
 }
 
@@ -36,3 +41,61 @@ type BoardProfileListResponse struct {
 	Count    int               `json:"count" example:"2"`
 	Profiles []db.BoardProfile `json:"profiles"`
 }
+
+// ResolvedBoardProfileResponse is a board profile with its ancestors'
+// configuration merged in
+type ResolvedBoardProfileResponse struct {
+	Profile db.BoardProfile `json:"profile"`
+	Chain   []string        `json:"chain" example:"rpi4-hat,rpi4"` // profile names, the profile itself first
+}
+
+// BoardProfileFile is a file attached to a board profile
+type BoardProfileFile struct {
+	Path string `json:"path" example:"overlays/my-hat-overlay.dts"`
+	Size int64  `json:"size" example:"2048"`
+}
+
+// BoardProfileFileListResponse represents the files attached to a board profile
+type BoardProfileFileListResponse struct {
+	Count int                `json:"count" example:"1"`
+	Files []BoardProfileFile `json:"files"`
+}
+
+// ImportBoardProfileResponse reports the profiles an imported bundle created
+type ImportBoardProfileResponse struct {
+	Profile db.BoardProfile `json:"profile"`
+	Created []string        `json:"created"` // profile names created from the bundle
+	Reused  []string        `json:"reused"`  // ancestor names that already existed
+}
+
+// BoardProfileBundleFormatVersion is the bundle manifest format produced by export
+const BoardProfileBundleFormatVersion = 1
+
+// BoardProfileBundle is the manifest of an exported board profile bundle.
+// Profiles lists the exported profile and its ancestors, root first; each
+// profile's attached files are stored in the archive under
+// files/<profile name>/<path>.
+type BoardProfileBundle struct {
+	FormatVersion int                   `json:"format_version" example:"1"`
+	Profile       string                `json:"profile" example:"rpi4-hat"`
+	Profiles      []BundledBoardProfile `json:"profiles"`
+}
+
+// BundledBoardProfile is a board profile as stored in a bundle, referring
+// to its parent by name
+type BundledBoardProfile struct {
+	Name        string         `json:"name" example:"rpi4-hat"`
+	DisplayName string         `json:"display_name" example:"Raspberry Pi 4 with sensor HAT"`
+	Description string         `json:"description"`
+	Arch        string         `json:"arch" example:"aarch64"`
+	Parent      string         `json:"parent,omitempty" example:"rpi4"`
+	Config      db.BoardConfig `json:"config"`
+	Files       []BundledFile  `json:"files,omitempty"`
+}
+
+// BundledFile describes a file attached to a bundled board profile
+type BundledFile struct {
+	Path   string `json:"path" example:"overlays/sensor-hat.dts"`
+	Size   int64  `json:"size" example:"2048"`
+	SHA256 string `json:"sha256"`
+}
@@ -2,15 +2,21 @@ package builds
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"strconv"
 	"time"
 
 	"github.com/bitswalk/ldf/src/ldfd/api/common"
+	"github.com/bitswalk/ldf/src/ldfd/auth"
 	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/sbom"
+	"github.com/bitswalk/ldf/src/ldfd/build/stages"
 	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/diskenc"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,6 +25,7 @@ func NewHandler(cfg Config) *Handler {
 	return &Handler{
 		distRepo:     cfg.DistRepo,
 		buildManager: cfg.BuildManager,
+		diskKeys:     cfg.DiskKeys,
 	}
 }
 
@@ -84,8 +91,20 @@ func (h *Handler) HandleStartBuild(c *gin.Context) {
 			format = db.ImageFormatQCOW2
 		case "iso":
 			format = db.ImageFormatISO
+		case "oci":
+			format = db.ImageFormatOCI
+		case "vmdk":
+			format = db.ImageFormatVMDK
+		case "vhdx":
+			format = db.ImageFormatVHDX
+		case "tar.zst":
+			format = db.ImageFormatTarZst
+		case "cpio":
+			format = db.ImageFormatCpio
+		case "netboot":
+			format = db.ImageFormatNetboot
 		default:
-			common.BadRequest(c, fmt.Sprintf("Unsupported image format: %s (supported: raw, qcow2, iso)", req.Format))
+			common.BadRequest(c, fmt.Sprintf("Unsupported image format: %s (supported: raw, qcow2, iso, oci, vmdk, vhdx, tar.zst, cpio, netboot)", req.Format))
 			return
 		}
 	}
@@ -97,6 +116,13 @@ func (h *Handler) HandleStartBuild(c *gin.Context) {
 		return
 	}
 
+	// Pre-flight: reject encrypted root settings before the worker creates
+	// a disk key for a build the package stage would refuse
+	if err := stages.ValidateEncryptionConfig(dist.Config, format); err != nil {
+		common.BadRequest(c, fmt.Sprintf("Invalid encryption settings: %v", err))
+		return
+	}
+
 	job, err := h.buildManager.SubmitBuild(dist, claims.UserID, arch, format, req.ClearCache)
 	if err != nil {
 		common.InternalError(c, err.Error())
@@ -160,6 +186,85 @@ func (h *Handler) HandleListDistributionBuilds(c *gin.Context) {
 	})
 }
 
+// HandleListDistributionUpdates lists the update bundles of a distribution,
+// newest first. With ?from=<build> only bundles a device running that build
+// can install are returned: same architecture and compatible string,
+// published after it.
+func (h *Handler) HandleListDistributionUpdates(c *gin.Context) {
+	distID := c.Param("id")
+	if distID == "" {
+		common.BadRequest(c, "Distribution ID required")
+		return
+	}
+
+	dist, err := h.distRepo.GetByID(distID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if dist == nil {
+		common.NotFound(c, "Distribution not found")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if dist.Visibility == db.VisibilityPrivate {
+		if claims == nil || (dist.OwnerID != claims.UserID && !claims.HasAdminAccess()) {
+			common.Forbidden(c, "Access denied to private distribution")
+			return
+		}
+	}
+
+	var arch db.TargetArch
+	var compatible string
+	var after time.Time
+
+	from := c.Query("from")
+	if from != "" {
+		job, err := h.buildManager.BuildJobRepo().GetByID(from)
+		if err != nil {
+			common.InternalError(c, err.Error())
+			return
+		}
+		if job == nil || job.DistributionID != distID {
+			common.NotFound(c, "Build not found in this distribution")
+			return
+		}
+
+		arch = job.TargetArch
+		after = job.CreatedAt
+		if job.CompletedAt != nil {
+			after = *job.CompletedAt
+		}
+
+		// Builds without a bundle match on architecture alone
+		current, err := h.buildManager.UpdateBundleRepo().GetByBuild(from)
+		if err != nil {
+			common.InternalError(c, err.Error())
+			return
+		}
+		if current != nil {
+			compatible = current.Compatible
+			after = current.CreatedAt
+		}
+	}
+
+	bundles, err := h.buildManager.UpdateBundleRepo().ListByDistribution(distID, arch, compatible, after)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if bundles == nil {
+		bundles = []db.UpdateBundle{}
+	}
+
+	c.JSON(http.StatusOK, UpdatesListResponse{
+		From:    from,
+		Count:   len(bundles),
+		Updates: bundles,
+	})
+}
+
 // HandleGetBuild returns a single build job with stages
 func (h *Handler) HandleGetBuild(c *gin.Context) {
 	buildID := c.Param("buildId")
@@ -201,6 +306,173 @@ func (h *Handler) HandleGetBuild(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// HandleGetBuildSBOM streams the SBOM of a completed build in the format
+// selected by the format query parameter (spdx or cyclonedx)
+func (h *Handler) HandleGetBuildSBOM(c *gin.Context) {
+	buildID := c.Param("buildId")
+	if buildID == "" {
+		common.BadRequest(c, "Build ID required")
+		return
+	}
+
+	format, err := sbom.ParseFormat(c.Query("format"))
+	if err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	job, err := h.buildManager.BuildJobRepo().GetByID(buildID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if job == nil {
+		common.NotFound(c, "Build not found")
+		return
+	}
+
+	// Check access
+	dist, err := h.distRepo.GetByID(job.DistributionID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if dist != nil && dist.Visibility == db.VisibilityPrivate {
+		if claims == nil || (dist.OwnerID != claims.UserID && !claims.HasAdminAccess()) {
+			common.Forbidden(c, "Access denied")
+			return
+		}
+	}
+
+	if job.Status != db.BuildStatusCompleted || job.ArtifactPath == "" {
+		common.NotFound(c, "SBOM is only available for completed builds")
+		return
+	}
+
+	key := path.Join(path.Dir(job.ArtifactPath), format.FileName())
+	reader, info, err := h.buildManager.Storage().Download(c.Request.Context(), key)
+	if err != nil {
+		common.NotFound(c, "SBOM not found: "+err.Error())
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", buildID+"-"+format.FileName()))
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
+
+// HandleGetBuildRecoveryKey returns the recovery key a build's encrypted
+// root was formatted with. Only the distribution owner and admins may read
+// it, whatever the distribution's visibility.
+func (h *Handler) HandleGetBuildRecoveryKey(c *gin.Context) {
+	buildID := c.Param("buildId")
+	if buildID == "" {
+		common.BadRequest(c, "Build ID required")
+		return
+	}
+	if h.diskKeys == nil {
+		common.ServiceUnavailable(c, "Disk encryption key storage is not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if _, ok := h.authorizeRecoveryKey(c, claims, buildID); !ok {
+		return
+	}
+
+	record, recoveryKey, err := h.diskKeys.RecoveryKey(buildID)
+	if err != nil {
+		if errors.Is(err, diskenc.ErrKeyNotFound) {
+			common.NotFound(c, "Build has no encrypted root")
+			return
+		}
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "build.recovery_key", UserID: claims.UserID, UserName: claims.UserName, Resource: "build:" + buildID, Success: true})
+
+	c.JSON(http.StatusOK, RecoveryKeyResponse{
+		BuildID:     record.BuildID,
+		LUKSUUID:    record.LUKSUUID,
+		RecoveryKey: recoveryKey,
+		CreatedAt:   record.CreatedAt,
+	})
+}
+
+// HandleDownloadBuildRecoveryKey streams the recovery key artifact a build
+// exported with export_recovery. The artifact is stored outside the
+// distribution's artifacts, so only the owner and admins can read it.
+func (h *Handler) HandleDownloadBuildRecoveryKey(c *gin.Context) {
+	buildID := c.Param("buildId")
+	if buildID == "" {
+		common.BadRequest(c, "Build ID required")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	job, ok := h.authorizeRecoveryKey(c, claims, buildID)
+	if !ok {
+		return
+	}
+
+	key := build.RecoveryArtifactKey(job.OwnerID, job.DistributionID, job.ID)
+	reader, info, err := h.buildManager.Storage().Download(c.Request.Context(), key)
+	if err != nil {
+		common.NotFound(c, "Recovery key artifact not found: "+err.Error())
+		return
+	}
+	defer reader.Close()
+
+	common.AuditLog(c, common.AuditEvent{Action: "build.recovery_key_artifact", UserID: claims.UserID, UserName: claims.UserName, Resource: "build:" + buildID, Success: true})
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", buildID+"-recovery-key"))
+	c.Header("Content-Type", "text/plain")
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
+
+// authorizeRecoveryKey loads a build and checks that the caller owns its
+// distribution or is an admin, writing the error response otherwise
+func (h *Handler) authorizeRecoveryKey(c *gin.Context, claims *auth.TokenClaims, buildID string) (*db.BuildJob, bool) {
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return nil, false
+	}
+
+	job, err := h.buildManager.BuildJobRepo().GetByID(buildID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return nil, false
+	}
+	if job == nil {
+		common.NotFound(c, "Build not found")
+		return nil, false
+	}
+
+	// Check ownership
+	dist, err := h.distRepo.GetByID(job.DistributionID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return nil, false
+	}
+	// Without its distribution the key has no owner: only admins get it
+	if (dist == nil || dist.OwnerID != claims.UserID) && !claims.HasAdminAccess() {
+		common.Forbidden(c, "Access denied")
+		return nil, false
+	}
+
+	return job, true
+}
+
 // HandleGetBuildLogs returns log entries for a build
 func (h *Handler) HandleGetBuildLogs(c *gin.Context) {
 	buildID := c.Param("buildId")
@@ -454,6 +726,57 @@ func (h *Handler) HandleRetryBuild(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// HandleVerifyReproducible rebuilds a completed reproducible build and
+// compares the resulting artifact against the original
+func (h *Handler) HandleVerifyReproducible(c *gin.Context) {
+	buildID := c.Param("buildId")
+	if buildID == "" {
+		common.BadRequest(c, "Build ID required")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	job, err := h.buildManager.BuildJobRepo().GetByID(buildID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if job == nil {
+		common.NotFound(c, "Build not found")
+		return
+	}
+
+	// Check ownership
+	dist, err := h.distRepo.GetByID(job.DistributionID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if dist != nil && dist.OwnerID != claims.UserID && !claims.HasAdminAccess() {
+		common.Forbidden(c, "Write access required")
+		return
+	}
+
+	verifyJob, err := h.buildManager.SubmitVerification(buildID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, build.ErrNotReproducible) {
+			common.BadRequest(c, "Build was not produced in reproducible mode (enable build.reproducible in the distribution config)")
+			return
+		}
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "build.verify_reproducible", UserID: claims.UserID, UserName: claims.UserName, Resource: "build:" + buildID, Success: true})
+
+	c.JSON(http.StatusAccepted, BuildJobResponse{BuildJob: *verifyJob})
+}
+
 // HandleClearDistributionBuilds removes all build jobs for a distribution
 func (h *Handler) HandleClearDistributionBuilds(c *gin.Context) {
 	distID := c.Param("id")
@@ -508,3 +831,56 @@ func (h *Handler) HandleListActiveBuilds(c *gin.Context) {
 		Builds: response,
 	})
 }
+
+// HandleListBuilderImages lists builder image variants per architecture (admin only)
+func (h *Handler) HandleListBuilderImages(c *gin.Context) {
+	images := h.buildManager.ListBuilderImages(c.Request.Context())
+
+	c.JSON(http.StatusOK, BuilderImagesListResponse{
+		Count:  len(images),
+		Images: images,
+	})
+}
+
+// HandleBuildBuilderImage builds the builder image for an architecture (admin only)
+func (h *Handler) HandleBuildBuilderImage(c *gin.Context) {
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	// The body is optional: an empty one builds for the host architecture
+	var req BuildBuilderImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	arch := db.TargetArch(build.DetectHostArch())
+	if req.Arch != "" {
+		switch req.Arch {
+		case "x86_64":
+			arch = db.ArchX86_64
+		case "aarch64":
+			arch = db.ArchAARCH64
+		default:
+			common.BadRequest(c, fmt.Sprintf("Unsupported architecture: %s (supported: x86_64, aarch64)", req.Arch))
+			return
+		}
+	}
+
+	img, err := h.buildManager.StartBuilderImageBuild(arch, req.NoCache)
+	if err != nil {
+		if errors.Is(err, build.ErrBuilderImageBusy) {
+			common.Conflict(c, fmt.Sprintf("Builder image for %s is already being built", arch))
+			return
+		}
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "builder_image.build", UserID: claims.UserID, UserName: claims.UserName, Resource: "builder_image:" + img.Image, Success: true})
+
+	c.JSON(http.StatusAccepted, img)
+}
@@ -0,0 +1,144 @@
+package builds
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bitswalk/ldf/src/ldfd/api/common"
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleCreateDelta starts computing the binary delta between two completed
+// builds of a distribution
+func (h *Handler) HandleCreateDelta(c *gin.Context) {
+	distID := c.Param("id")
+	if distID == "" {
+		common.BadRequest(c, "Distribution ID required")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	var req CreateDeltaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, "from_build and to_build are required")
+		return
+	}
+
+	dist, err := h.distRepo.GetByID(distID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if dist == nil {
+		common.NotFound(c, "Distribution not found")
+		return
+	}
+	if dist.OwnerID != claims.UserID && !claims.HasAdminAccess() {
+		common.Forbidden(c, "Write access required")
+		return
+	}
+
+	for _, buildID := range []string{req.FromBuild, req.ToBuild} {
+		job, err := h.buildManager.BuildJobRepo().GetByID(buildID)
+		if err != nil {
+			common.InternalError(c, err.Error())
+			return
+		}
+		if job == nil || job.DistributionID != distID {
+			common.NotFound(c, "Build not found in this distribution: "+buildID)
+			return
+		}
+	}
+
+	delta, err := h.buildManager.StartDelta(req.FromBuild, req.ToBuild)
+	if err != nil {
+		if errors.Is(err, build.ErrDeltaBuilds) {
+			common.BadRequest(c, err.Error())
+			return
+		}
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "build.delta", UserID: claims.UserID, UserName: claims.UserName, Resource: "distribution:" + distID, Success: true})
+
+	c.JSON(http.StatusAccepted, delta)
+}
+
+// HandleListDistributionDeltas lists the binary deltas of a distribution
+func (h *Handler) HandleListDistributionDeltas(c *gin.Context) {
+	distID := c.Param("id")
+	if !h.checkDeltaReadAccess(c, distID) {
+		return
+	}
+
+	deltas, err := h.buildManager.DeltaRepo().ListByDistribution(distID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if deltas == nil {
+		deltas = []db.BuildDelta{}
+	}
+
+	c.JSON(http.StatusOK, DeltasListResponse{
+		Count:  len(deltas),
+		Deltas: deltas,
+	})
+}
+
+// HandleGetDelta returns a single binary delta
+func (h *Handler) HandleGetDelta(c *gin.Context) {
+	distID := c.Param("id")
+	if !h.checkDeltaReadAccess(c, distID) {
+		return
+	}
+
+	delta, err := h.buildManager.DeltaRepo().GetByID(c.Param("deltaId"))
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if delta == nil || delta.DistributionID != distID {
+		common.NotFound(c, "Delta not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, delta)
+}
+
+// checkDeltaReadAccess writes an error response and returns false unless
+// the caller may read the deltas of the distribution
+func (h *Handler) checkDeltaReadAccess(c *gin.Context, distID string) bool {
+	if distID == "" {
+		common.BadRequest(c, "Distribution ID required")
+		return false
+	}
+
+	dist, err := h.distRepo.GetByID(distID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return false
+	}
+	if dist == nil {
+		common.NotFound(c, "Distribution not found")
+		return false
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if dist.Visibility == db.VisibilityPrivate {
+		if claims == nil || (dist.OwnerID != claims.UserID && !claims.HasAdminAccess()) {
+			common.Forbidden(c, "Access denied to private distribution")
+			return false
+		}
+	}
+
+	return true
+}
@@ -5,18 +5,21 @@ import (
 
 	"github.com/bitswalk/ldf/src/ldfd/build"
 	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/diskenc"
 )
 
 // Handler handles build-related HTTP requests
 type Handler struct {
 	distRepo     *db.DistributionRepository
 	buildManager *build.Manager
+	diskKeys     *diskenc.Service
 }
 
 // Config contains configuration options for the Handler
 type Config struct {
 	DistRepo     *db.DistributionRepository
 	BuildManager *build.Manager
+	DiskKeys     *diskenc.Service
 }
 
 // StartBuildRequest represents the request to start a build
@@ -39,6 +42,21 @@ type BuildJobsListResponse struct {
 	Builds []BuildJobResponse `json:"builds"`
 }
 
+// UpdatesListResponse lists the update bundles a device can install
+type UpdatesListResponse struct {
+	From    string            `json:"from,omitempty"`
+	Count   int               `json:"count"`
+	Updates []db.UpdateBundle `json:"updates"`
+}
+
+// RecoveryKeyResponse carries the recovery key of a build's encrypted root
+type RecoveryKeyResponse struct {
+	BuildID     string    `json:"build_id"`
+	LUKSUUID    string    `json:"luks_uuid"`
+	RecoveryKey string    `json:"recovery_key"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 // BuildLogsResponse represents build log entries
 type BuildLogsResponse struct {
 	Count int           `json:"count"`
@@ -56,3 +74,27 @@ type BuildStatusEvent struct {
 	ErrorStage      string            `json:"error_stage,omitempty"`
 	ArtifactSize    int64             `json:"artifact_size,omitempty"`
 }
+
+// BuildBuilderImageRequest represents the request to build a builder image
+type BuildBuilderImageRequest struct {
+	Arch    string `json:"arch,omitempty"`
+	NoCache bool   `json:"no_cache,omitempty"`
+}
+
+// BuilderImagesListResponse represents the builder image variants
+type BuilderImagesListResponse struct {
+	Count  int                  `json:"count"`
+	Images []build.BuilderImage `json:"images"`
+}
+
+// CreateDeltaRequest selects the builds a delta connects
+type CreateDeltaRequest struct {
+	FromBuild string `json:"from_build" binding:"required"`
+	ToBuild   string `json:"to_build" binding:"required"`
+}
+
+// DeltasListResponse lists the binary deltas of a distribution
+type DeltasListResponse struct {
+	Count  int             `json:"count"`
+	Deltas []db.BuildDelta `json:"deltas"`
+}
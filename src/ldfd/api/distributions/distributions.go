@@ -98,6 +98,12 @@ func (h *Handler) HandleCreate(c *gin.Context) {
 		common.BadRequest(c, err.Error())
 		return
 	}
+	if req.Config != nil {
+		if err := db.ValidateSystemSettings(req.Config.Settings); err != nil {
+			common.BadRequest(c, err.Error())
+			return
+		}
+	}
 
 	existing, err := h.distRepo.GetByName(req.Name)
 	if err != nil {
@@ -260,6 +266,12 @@ func (h *Handler) HandleUpdate(c *gin.Context) {
 		common.BadRequest(c, err.Error())
 		return
 	}
+	if req.Config != nil {
+		if err := db.ValidateSystemSettings(req.Config.Settings); err != nil {
+			common.BadRequest(c, err.Error())
+			return
+		}
+	}
 
 	if req.Name != "" {
 		dist.Name = req.Name
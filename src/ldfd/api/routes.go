@@ -54,6 +54,7 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 				distributions.GET("/:id/artifacts", a.Artifacts.HandleList)
 				distributions.GET("/:id/artifacts/*path", a.Artifacts.HandleDownload)
 				distributions.GET("/:id/artifacts-url/*path", a.Artifacts.HandleGetURL)
+				distributions.GET("/:id/artifacts-verify/*path", a.Artifacts.HandleVerify)
 			}
 		}
 
@@ -137,6 +138,11 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 			{
 				boardProfilesRead.GET("", a.BoardProfiles.HandleList)
 				boardProfilesRead.GET("/:id", a.BoardProfiles.HandleGet)
+				boardProfilesRead.GET("/:id/resolved", a.BoardProfiles.HandleResolve)
+				boardProfilesRead.GET("/:id/export", a.BoardProfiles.HandleExport)
+				if a.HasStorage() {
+					boardProfilesRead.GET("/:id/files", a.BoardProfiles.HandleListFiles)
+				}
 			}
 
 			// Board profile routes - write operations (requires write access)
@@ -146,6 +152,11 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 				boardProfilesWrite.POST("", a.BoardProfiles.HandleCreate)
 				boardProfilesWrite.PUT("/:id", a.BoardProfiles.HandleUpdate)
 				boardProfilesWrite.DELETE("/:id", a.BoardProfiles.HandleDelete)
+				if a.HasStorage() {
+					boardProfilesWrite.POST("/import", a.BoardProfiles.HandleImport)
+					boardProfilesWrite.PUT("/:id/files/*path", a.BoardProfiles.HandleUploadFile)
+					boardProfilesWrite.DELETE("/:id/files/*path", a.BoardProfiles.HandleDeleteFile)
+				}
 			}
 		}
 
@@ -165,6 +176,27 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 			toolchainsWrite.DELETE("/:id", a.ToolchainProfiles.HandleDelete)
 		}
 
+		// Signing key routes - public keys for offline attestation verification
+		v1.GET("/signing-keys", a.SigningKeys.HandleList)
+
+		// Signing key routes - key management (admin only)
+		signingKeysAdmin := v1.Group("/signing-keys")
+		signingKeysAdmin.Use(a.adminAccessRequired())
+		{
+			signingKeysAdmin.POST("", a.SigningKeys.HandleCreate)
+			signingKeysAdmin.POST("/rotate", a.SigningKeys.HandleRotate)
+		}
+
+		// Secure Boot key set routes (admin only)
+		securebootAdmin := v1.Group("/secureboot/keys")
+		securebootAdmin.Use(a.adminAccessRequired())
+		{
+			securebootAdmin.GET("", a.SecureBootKeys.HandleList)
+			securebootAdmin.POST("", a.SecureBootKeys.HandleCreate)
+			securebootAdmin.POST("/:id/activate", a.SecureBootKeys.HandleActivate)
+			securebootAdmin.DELETE("/:id", a.SecureBootKeys.HandleDelete)
+		}
+
 		// Sources routes - unified API (authenticated)
 		// All sources use the same endpoints with permission checks based on is_system/owner_id
 		sourcesGroup := v1.Group("/sources")
@@ -264,9 +296,25 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 			distBuildsRead.GET("", a.Builds.HandleListDistributionBuilds)
 		}
 
+		// Update bundle discovery - read (auth required)
+		distUpdatesRead := v1.Group("/distributions/:id/updates")
+		distUpdatesRead.Use(a.authRequired())
+		{
+			distUpdatesRead.GET("", a.Builds.HandleListDistributionUpdates)
+		}
+
+		// Binary deltas between builds - read (auth required)
+		distDeltasRead := v1.Group("/distributions/:id/deltas")
+		distDeltasRead.Use(a.authRequired())
+		{
+			distDeltasRead.GET("", a.Builds.HandleListDistributionDeltas)
+			distDeltasRead.GET("/:deltaId", a.Builds.HandleGetDelta)
+		}
+
 		// Build trigger and management - write access (registered alongside distribution write routes)
 		distributionsWrite.POST("/:id/build", a.Builds.HandleStartBuild)
 		distributionsWrite.DELETE("/:id/builds", a.Builds.HandleClearDistributionBuilds)
+		distributionsWrite.POST("/:id/deltas", a.Builds.HandleCreateDelta)
 
 		// Build job routes - read (auth required)
 		buildsRead := v1.Group("/builds")
@@ -275,6 +323,9 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 			buildsRead.GET("/:buildId", a.Builds.HandleGetBuild)
 			buildsRead.GET("/:buildId/logs", a.Builds.HandleGetBuildLogs)
 			buildsRead.GET("/:buildId/logs/stream", a.Builds.HandleStreamBuildLogs)
+			buildsRead.GET("/:buildId/sbom", a.Builds.HandleGetBuildSBOM)
+			buildsRead.GET("/:buildId/recovery-key", a.Builds.HandleGetBuildRecoveryKey)
+			buildsRead.GET("/:buildId/recovery-key/artifact", a.Builds.HandleDownloadBuildRecoveryKey)
 		}
 
 		// Build job routes - write (write access)
@@ -283,6 +334,7 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 		{
 			buildsWrite.POST("/:buildId/cancel", a.Builds.HandleCancelBuild)
 			buildsWrite.POST("/:buildId/retry", a.Builds.HandleRetryBuild)
+			buildsWrite.POST("/:buildId/verify-reproducible", a.Builds.HandleVerifyReproducible)
 		}
 
 		// Active builds - admin only
@@ -291,5 +343,13 @@ func (a *API) RegisterRoutes(router *gin.Engine) {
 		{
 			buildsAdmin.GET("/active", a.Builds.HandleListActiveBuilds)
 		}
+
+		// Builder image routes - admin only
+		builderImagesAdmin := v1.Group("/builder-images")
+		builderImagesAdmin.Use(a.adminAccessRequired())
+		{
+			builderImagesAdmin.GET("", a.Builds.HandleListBuilderImages)
+			builderImagesAdmin.POST("", a.Builds.HandleBuildBuilderImage)
+		}
 	}
 }
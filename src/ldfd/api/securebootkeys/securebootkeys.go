@@ -0,0 +1,210 @@
+package securebootkeys
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bitswalk/ldf/src/ldfd/api/common"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/secureboot"
+	"github.com/gin-gonic/gin"
+)
+
+// NewHandler creates a new Secure Boot handler
+func NewHandler(cfg Config) *Handler {
+	return &Handler{
+		service: cfg.SecureBootService,
+	}
+}
+
+// HandleList returns the stored Secure Boot key sets
+// @Summary      List Secure Boot key sets
+// @Description  Returns the PK/KEK/db certificates of every Secure Boot key set. Private keys are never returned. Requires admin access.
+// @Tags         Secure Boot
+// @Produce      json
+// @Success      200  {object}  KeySetListResponse
+// @Failure      401  {object}  common.ErrorResponse
+// @Failure      403  {object}  common.ErrorResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Failure      503  {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/secureboot/keys [get]
+func (h *Handler) HandleList(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Secure Boot key storage is not configured")
+		return
+	}
+
+	sets, err := h.service.List()
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	if sets == nil {
+		sets = []db.SecureBootKeySet{}
+	}
+
+	c.JSON(http.StatusOK, KeySetListResponse{
+		Count:   len(sets),
+		KeySets: sets,
+	})
+}
+
+// HandleCreate generates a new key set or imports an existing one
+// @Summary      Create a Secure Boot key set
+// @Description  Generates a self-signed RSA-2048 PK/KEK/db hierarchy, or imports one when pk, kek and db are all provided. Private keys are stored encrypted. Requires admin access.
+// @Tags         Secure Boot
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CreateKeySetRequest  true  "Key set"
+// @Success      201      {object}  db.SecureBootKeySet
+// @Failure      400      {object}  common.ErrorResponse
+// @Failure      401      {object}  common.ErrorResponse
+// @Failure      403      {object}  common.ErrorResponse
+// @Failure      409      {object}  common.ErrorResponse
+// @Failure      500      {object}  common.ErrorResponse
+// @Failure      503      {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/secureboot/keys [post]
+func (h *Handler) HandleCreate(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Secure Boot key storage is not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	var req CreateKeySetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	imported := req.PK != nil || req.KEK != nil || req.DB != nil
+	if imported && (req.PK == nil || req.KEK == nil || req.DB == nil) {
+		common.BadRequest(c, "Importing a key set requires pk, kek and db")
+		return
+	}
+
+	action := "secureboot_keys.generate"
+	var set *db.SecureBootKeySet
+	var err error
+	if imported {
+		action = "secureboot_keys.import"
+		set, err = h.service.Import(req.Name, req.OwnerGUID,
+			secureboot.KeyPair{Certificate: req.PK.Certificate, PrivateKey: req.PK.PrivateKey},
+			secureboot.KeyPair{Certificate: req.KEK.Certificate, PrivateKey: req.KEK.PrivateKey},
+			secureboot.KeyPair{Certificate: req.DB.Certificate, PrivateKey: req.DB.PrivateKey},
+			req.Activate)
+	} else {
+		set, err = h.service.Generate(req.Name, req.Activate)
+	}
+
+	switch {
+	case errors.Is(err, secureboot.ErrInvalidKeySet):
+		common.BadRequest(c, err.Error())
+		return
+	case errors.Is(err, secureboot.ErrKeySetExists):
+		common.Conflict(c, err.Error())
+		return
+	case err != nil:
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: action, UserID: claims.UserID, UserName: claims.UserName, Resource: "secureboot_keys:" + set.ID, Success: true})
+
+	c.JSON(http.StatusCreated, set)
+}
+
+// HandleActivate makes a key set the default for builds
+// @Summary      Activate a Secure Boot key set
+// @Description  Makes the key set the one used by builds that do not name a key set. Requires admin access.
+// @Tags         Secure Boot
+// @Produce      json
+// @Param        id   path      string  true  "Key set ID"
+// @Success      200  {object}  db.SecureBootKeySet
+// @Failure      401  {object}  common.ErrorResponse
+// @Failure      403  {object}  common.ErrorResponse
+// @Failure      404  {object}  common.ErrorResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Failure      503  {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/secureboot/keys/{id}/activate [post]
+func (h *Handler) HandleActivate(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Secure Boot key storage is not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.Activate(id); err != nil {
+		if errors.Is(err, secureboot.ErrKeySetNotFound) {
+			common.NotFound(c, err.Error())
+			return
+		}
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	set, err := h.service.Get(id)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "secureboot_keys.activate", UserID: claims.UserID, UserName: claims.UserName, Resource: "secureboot_keys:" + id, Success: true})
+
+	c.JSON(http.StatusOK, set)
+}
+
+// HandleDelete removes a key set
+// @Summary      Delete a Secure Boot key set
+// @Description  Deletes the key set and its encrypted private keys. Images already signed with it are unaffected. Requires admin access.
+// @Tags         Secure Boot
+// @Param        id   path  string  true  "Key set ID"
+// @Success      204
+// @Failure      401  {object}  common.ErrorResponse
+// @Failure      403  {object}  common.ErrorResponse
+// @Failure      404  {object}  common.ErrorResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Failure      503  {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/secureboot/keys/{id} [delete]
+func (h *Handler) HandleDelete(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Secure Boot key storage is not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.Delete(id); err != nil {
+		if errors.Is(err, secureboot.ErrKeySetNotFound) {
+			common.NotFound(c, err.Error())
+			return
+		}
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "secureboot_keys.delete", UserID: claims.UserID, UserName: claims.UserName, Resource: "secureboot_keys:" + id, Success: true})
+
+	c.Status(http.StatusNoContent)
+}
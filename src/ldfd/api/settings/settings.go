@@ -68,6 +68,8 @@ var settingsRegistry = []SettingMeta{
 	{"build.workers", "int", "Number of concurrent build workers", true, "build", false},
 	{"build.container_runtime", "string", "Container runtime for build isolation: podman, docker, nerdctl, or chroot", false, "build", false},
 	{"build.container_image", "string", "Container image for build environment (ignored for chroot: sysroot is auto-resolved from build workspace)", false, "build", false},
+	{"build.registry.username", "string", "Username for pushing OCI images to container registries", true, "build", false},
+	{"build.registry.password", "string", "Password or token for pushing OCI images to container registries", true, "build", true},
 
 	// Download cache settings
 	{"download.cache.enabled", "bool", "Enable artifact caching across distributions", false, "download", false},
@@ -97,6 +99,7 @@ var settingsRegistry = []SettingMeta{
 	{"server.tls.enabled", "bool", "Enable native HTTPS/TLS support", true, "server", false},
 	{"server.tls.cert_path", "string", "Path to TLS certificate file (PEM)", true, "server", false},
 	{"server.tls.key_path", "string", "Path to TLS private key file (PEM)", true, "server", false},
+	{"server.public_url", "string", "URL clients reach ldfd at, used in netboot configurations (e.g., http://ldfd.example.com:8443)", true, "server", false},
 }
 
 // GetSettingsRegistry returns the settings registry for use by core/config.go
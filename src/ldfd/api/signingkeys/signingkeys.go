@@ -0,0 +1,154 @@
+package signingkeys
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bitswalk/ldf/src/ldfd/api/common"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/signing"
+	"github.com/gin-gonic/gin"
+)
+
+// NewHandler creates a new signing keys handler
+func NewHandler(cfg Config) *Handler {
+	return &Handler{
+		service: cfg.SigningService,
+	}
+}
+
+// HandleList returns the public signing keys
+// @Summary      List signing keys
+// @Description  Returns the PEM-encoded public keys build attestations are signed with. The active key is generated by the first signed build or by an admin.
+// @Tags         Signing Keys
+// @Produce      json
+// @Success      200  {object}  SigningKeyListResponse
+// @Failure      500  {object}  common.ErrorResponse
+// @Failure      503  {object}  common.ErrorResponse
+// @Router       /v1/signing-keys [get]
+func (h *Handler) HandleList(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Signing is not configured")
+		return
+	}
+
+	keys, err := h.service.PublicKeys()
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	if keys == nil {
+		keys = []db.SigningKey{}
+	}
+
+	c.JSON(http.StatusOK, SigningKeyListResponse{
+		Count: len(keys),
+		Keys:  keys,
+	})
+}
+
+// HandleCreate generates a new signing key or imports an existing one
+// @Summary      Create a signing key
+// @Description  Generates a new ed25519 signing key, or imports a PKCS#8 PEM private key when private_key is set. The private key is stored encrypted. Requires admin access.
+// @Tags         Signing Keys
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CreateSigningKeyRequest  true  "Signing key"
+// @Success      201      {object}  db.SigningKey
+// @Failure      400      {object}  common.ErrorResponse
+// @Failure      401      {object}  common.ErrorResponse
+// @Failure      403      {object}  common.ErrorResponse
+// @Failure      409      {object}  common.ErrorResponse
+// @Failure      500      {object}  common.ErrorResponse
+// @Failure      503      {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/signing-keys [post]
+func (h *Handler) HandleCreate(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Signing is not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	var req CreateSigningKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	action := "signing_key.generate"
+	var key *db.SigningKey
+	var err error
+	if req.PrivateKey != "" {
+		action = "signing_key.import"
+		key, err = h.service.Import(req.Name, req.PrivateKey, req.Activate)
+	} else {
+		key, err = h.service.Generate(req.Name, req.Activate)
+	}
+
+	switch {
+	case errors.Is(err, signing.ErrInvalidKey):
+		common.BadRequest(c, err.Error())
+		return
+	case errors.Is(err, signing.ErrKeyExists):
+		common.Conflict(c, err.Error())
+		return
+	case err != nil:
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: action, UserID: claims.UserID, UserName: claims.UserName, Resource: "signing_key:" + key.ID, Success: true})
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// HandleRotate replaces the active signing key with a newly generated one
+// @Summary      Rotate the signing key
+// @Description  Generates a new active signing key and retires the current one. Retired keys remain available for verification. Requires admin access.
+// @Tags         Signing Keys
+// @Accept       json
+// @Produce      json
+// @Param        request  body      RotateSigningKeyRequest  true  "New key name"
+// @Success      201      {object}  db.SigningKey
+// @Failure      400      {object}  common.ErrorResponse
+// @Failure      401      {object}  common.ErrorResponse
+// @Failure      403      {object}  common.ErrorResponse
+// @Failure      500      {object}  common.ErrorResponse
+// @Failure      503      {object}  common.ErrorResponse
+// @Security     BearerAuth
+// @Router       /v1/signing-keys/rotate [post]
+func (h *Handler) HandleRotate(c *gin.Context) {
+	if h.service == nil {
+		common.ServiceUnavailable(c, "Signing is not configured")
+		return
+	}
+
+	claims := common.GetClaimsFromContext(c)
+	if claims == nil {
+		common.Unauthorized(c, "Authentication required")
+		return
+	}
+
+	var req RotateSigningKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+
+	key, err := h.service.Rotate(req.Name)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+
+	common.AuditLog(c, common.AuditEvent{Action: "signing_key.rotate", UserID: claims.UserID, UserName: claims.UserName, Resource: "signing_key:" + key.ID, Success: true})
+
+	c.JSON(http.StatusCreated, key)
+}
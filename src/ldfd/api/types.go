@@ -13,15 +13,20 @@ import (
 	"github.com/bitswalk/ldf/src/ldfd/api/downloads"
 	apiforge "github.com/bitswalk/ldf/src/ldfd/api/forge"
 	"github.com/bitswalk/ldf/src/ldfd/api/langpacks"
+	"github.com/bitswalk/ldf/src/ldfd/api/securebootkeys"
 	"github.com/bitswalk/ldf/src/ldfd/api/settings"
+	"github.com/bitswalk/ldf/src/ldfd/api/signingkeys"
 	"github.com/bitswalk/ldf/src/ldfd/api/sources"
 	"github.com/bitswalk/ldf/src/ldfd/api/toolchains"
 	"github.com/bitswalk/ldf/src/ldfd/auth"
 	"github.com/bitswalk/ldf/src/ldfd/build"
 	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/diskenc"
 	"github.com/bitswalk/ldf/src/ldfd/download"
 	"github.com/bitswalk/ldf/src/ldfd/forge"
+	"github.com/bitswalk/ldf/src/ldfd/secureboot"
 	"github.com/bitswalk/ldf/src/ldfd/security"
+	"github.com/bitswalk/ldf/src/ldfd/signing"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
 )
 
@@ -46,6 +51,8 @@ type API struct {
 	Forge             *apiforge.Handler
 	BoardProfiles     *boardprofiles.Handler
 	ToolchainProfiles *toolchains.Handler
+	SigningKeys       *signingkeys.Handler
+	SecureBootKeys    *securebootkeys.Handler
 
 	// Direct dependencies for middleware
 	jwtService    *auth.JWTService
@@ -75,4 +82,7 @@ type Config struct {
 	BuildManager         *build.Manager
 	VersionDiscovery     *download.VersionDiscovery
 	ForgeRegistry        *forge.Registry
+	SigningService       *signing.Service
+	SecureBootService    *secureboot.Service
+	DiskKeyService       *diskenc.Service
 }
@@ -162,14 +162,8 @@ func DetectQEMUSupport(target db.TargetArch) QEMUSupport {
 // if it exists locally, otherwise falls back to the base image with :latest tag.
 // The binaryName parameter specifies which runtime to query (e.g. "podman", "docker").
 func ContainerImageForArch(binaryName, baseImage string, target db.TargetArch) string {
-	// Strip any existing tag from the base image
-	base := baseImage
-	if idx := strings.LastIndex(baseImage, ":"); idx > 0 {
-		base = baseImage[:idx]
-	}
-
 	// Try architecture-specific image
-	archImage := fmt.Sprintf("%s:%s", base, string(target))
+	archImage := BuilderImageTag(baseImage, target)
 	cmd := exec.CommandContext(context.Background(), binaryName, "image", "exists", archImage)
 	if cmd.Run() == nil {
 		return archImage
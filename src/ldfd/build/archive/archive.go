@@ -0,0 +1,189 @@
+// Package archive writes root filesystem trees as deterministic tar and cpio streams.
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Options control which files are archived and how
+type Options struct {
+	// ExcludeContents lists root-relative directories whose contents are
+	// left out. The directories themselves are kept.
+	ExcludeContents []string
+
+	// ClampMtime caps file modification times when non-zero, for
+	// reproducible archives
+	ClampMtime time.Time
+
+	// Xattrs records extended attributes, such as SELinux labels and file
+	// capabilities, as PAX records
+	Xattrs bool
+}
+
+// entry is a file of the tree being archived
+type entry struct {
+	path string // Absolute path on disk
+	rel  string // Slash-separated path inside the archive
+	info fs.FileInfo
+}
+
+// walk calls fn for every file below root in lexical order, honouring the
+// exclusions in opts
+func walk(root string, opts Options, fn func(e entry) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, excluded := range opts.ExcludeContents {
+			if strings.HasPrefix(rel, strings.Trim(excluded, "/")+"/") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		return fn(entry{path: path, rel: rel, info: info})
+	})
+}
+
+// modTime returns the modification time recorded for info
+func (o Options) modTime(info fs.FileInfo) time.Time {
+	if !o.ClampMtime.IsZero() && info.ModTime().After(o.ClampMtime) {
+		return o.ClampMtime
+	}
+	return info.ModTime()
+}
+
+// WriteTar writes the tree below root as a tar stream with numeric
+// ownership, preserving symlinks, hard links and device nodes
+func WriteTar(w io.Writer, root string, opts Options) error {
+	tw := tar.NewWriter(w)
+	type inode struct{ dev, ino uint64 }
+	links := make(map[inode]string)
+
+	err := walk(root, opts, func(e entry) error {
+		var target string
+		if e.info.Mode()&os.ModeSymlink != 0 {
+			var err error
+			if target, err = os.Readlink(e.path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(e.info, target)
+		if err != nil {
+			return fmt.Errorf("failed to describe %s: %w", e.rel, err)
+		}
+		hdr.Name = e.rel
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		hdr.ModTime = opts.modTime(e.info)
+
+		if st, ok := e.info.Sys().(*syscall.Stat_t); ok && e.info.Mode().IsRegular() && st.Nlink > 1 {
+			key := inode{uint64(st.Dev), uint64(st.Ino)}
+			if first, seen := links[key]; seen {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				links[key] = e.rel
+			}
+		}
+
+		if opts.Xattrs && hdr.Typeflag != tar.TypeLink {
+			xattrs, err := readXattrs(e.path)
+			if err != nil {
+				return fmt.Errorf("failed to read extended attributes of %s: %w", e.rel, err)
+			}
+			for name, value := range xattrs {
+				if hdr.PAXRecords == nil {
+					hdr.PAXRecords = make(map[string]string)
+				}
+				hdr.PAXRecords[paxXattrPrefix+name] = value
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", e.rel, err)
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			if err := copyFile(tw, e.path); err != nil {
+				return fmt.Errorf("failed to write %s: %w", e.rel, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// paxXattrPrefix prefixes extended attributes in PAX records, as GNU tar
+// and bsdtar write and restore them
+const paxXattrPrefix = "SCHILY.xattr."
+
+// readXattrs returns the extended attributes of path, without following
+// symlinks. Filesystems without extended attributes report none.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if err == unix.ENOTSUP {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		vsize, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, vsize)
+		if vsize, err = unix.Lgetxattr(path, name, value); err != nil {
+			return nil, err
+		}
+		xattrs[name] = string(value[:vsize])
+	}
+	return xattrs, nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpioTrailer terminates a cpio archive
+const cpioTrailer = "TRAILER!!!"
+
+// cpioHeader holds the fields of a newc header
+type cpioHeader struct {
+	ino, mode, uid, gid, nlink uint32
+	mtime                      int64
+	size                       int64
+	rdevMajor, rdevMinor       uint32
+	name                       string
+}
+
+// WriteCpio writes the tree below root as a newc cpio archive, the format
+// the kernel unpacks into its initial root filesystem. Hard links are
+// stored as independent copies. Symlinks maps additional link names to
+// targets, written after the tree unless a file of that name exists.
+func WriteCpio(w io.Writer, root string, opts Options, symlinks map[string]string) error {
+	cw := &cpioWriter{w: w}
+	written := make(map[string]bool)
+
+	err := walk(root, opts, func(e entry) error {
+		hdr := cpioHeader{
+			mode:  cpioMode(e.info),
+			nlink: 1,
+			mtime: opts.modTime(e.info).Unix(),
+			name:  e.rel,
+		}
+		if st, ok := e.info.Sys().(*syscall.Stat_t); ok {
+			hdr.uid, hdr.gid = st.Uid, st.Gid
+			if e.info.Mode()&(os.ModeDevice|os.ModeCharDevice) != 0 {
+				hdr.rdevMajor, hdr.rdevMinor = unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev))
+			}
+		}
+		if e.info.IsDir() {
+			hdr.nlink = 2
+		}
+		written[e.rel] = true
+
+		switch {
+		case e.info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			return cw.writeData(hdr, []byte(target))
+		case e.info.Mode().IsRegular():
+			if e.info.Size() > 0xFFFFFFFF {
+				return fmt.Errorf("%s is too large for a cpio archive", e.rel)
+			}
+			hdr.size = e.info.Size()
+			if err := cw.writeHeader(hdr); err != nil {
+				return err
+			}
+			if err := copyFile(cw, e.path); err != nil {
+				return fmt.Errorf("failed to write %s: %w", e.rel, err)
+			}
+			return cw.pad()
+		default:
+			return cw.writeHeader(hdr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(symlinks))
+	for name := range symlinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var linkMtime int64
+	if !opts.ClampMtime.IsZero() {
+		linkMtime = opts.ClampMtime.Unix()
+	}
+	for _, name := range names {
+		if written[name] {
+			continue
+		}
+		hdr := cpioHeader{mode: syscall.S_IFLNK | 0777, nlink: 1, mtime: linkMtime, name: name}
+		if err := cw.writeData(hdr, []byte(symlinks[name])); err != nil {
+			return err
+		}
+	}
+
+	return cw.writeHeader(cpioHeader{nlink: 1, name: cpioTrailer})
+}
+
+// cpioMode returns the st_mode of a file
+func cpioMode(info os.FileInfo) uint32 {
+	mode := uint32(info.Mode().Perm())
+	if info.Mode()&os.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if info.Mode()&os.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if info.Mode()&os.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+	switch m := info.Mode(); {
+	case m.IsDir():
+		mode |= syscall.S_IFDIR
+	case m&os.ModeSymlink != 0:
+		mode |= syscall.S_IFLNK
+	case m&os.ModeCharDevice != 0:
+		mode |= syscall.S_IFCHR
+	case m&os.ModeDevice != 0:
+		mode |= syscall.S_IFBLK
+	case m&os.ModeNamedPipe != 0:
+		mode |= syscall.S_IFIFO
+	case m&os.ModeSocket != 0:
+		mode |= syscall.S_IFSOCK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	return mode
+}
+
+// cpioWriter writes newc records, numbering inodes in archive order
+type cpioWriter struct {
+	w   io.Writer
+	n   int64
+	ino uint32
+}
+
+func (cw *cpioWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (cw *cpioWriter) writeHeader(h cpioHeader) error {
+	if h.name != cpioTrailer {
+		cw.ino++
+		h.ino = cw.ino
+	}
+	_, err := fmt.Fprintf(cw, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%s\x00",
+		h.ino, h.mode, h.uid, h.gid, h.nlink, uint32(h.mtime), uint32(h.size),
+		0, 0, h.rdevMajor, h.rdevMinor, len(h.name)+1, 0, h.name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", h.name, err)
+	}
+	return cw.pad()
+}
+
+func (cw *cpioWriter) writeData(h cpioHeader, data []byte) error {
+	h.size = int64(len(data))
+	if err := cw.writeHeader(h); err != nil {
+		return err
+	}
+	if _, err := cw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", h.name, err)
+	}
+	return cw.pad()
+}
+
+// pad aligns the stream to four bytes
+func (cw *cpioWriter) pad() error {
+	if rem := cw.n % 4; rem != 0 {
+		_, err := cw.Write(make([]byte, 4-rem))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// cpioRecord is a parsed newc record
+type cpioRecord struct {
+	mode  uint64
+	mtime uint64
+	data  string
+}
+
+// readCpio parses a newc archive up to its trailer
+func readCpio(t *testing.T, data []byte) map[string]cpioRecord {
+	t.Helper()
+	records := make(map[string]cpioRecord)
+	align := func(n int) int { return (n + 3) &^ 3 }
+	field := func(hdr []byte, i int) uint64 {
+		v, err := strconv.ParseUint(string(hdr[6+8*i:14+8*i]), 16, 32)
+		if err != nil {
+			t.Fatalf("bad header field %d: %v", i, err)
+		}
+		return v
+	}
+
+	for off := 0; ; {
+		if off+110 > len(data) || string(data[off:off+6]) != "070701" {
+			t.Fatalf("bad header at offset %d", off)
+		}
+		hdr := data[off : off+110]
+		nameSize, size := int(field(hdr, 11)), int(field(hdr, 6))
+		name := string(data[off+110 : off+110+nameSize-1])
+		off = align(off + 110 + nameSize)
+		if name == cpioTrailer {
+			return records
+		}
+		records[name] = cpioRecord{mode: field(hdr, 1), mtime: field(hdr, 5), data: string(data[off : off+size])}
+		off = align(off + size)
+	}
+}
+
+func TestWriteCpio(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		"etc/hostname": "ldf\n",
+		"boot/vmlinuz": "kernel",
+		"sbin/init":    "init binary",
+	} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("sbin", filepath.Join(root, "bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	epoch := time.Unix(1700000000, 0)
+	var buf bytes.Buffer
+	opts := Options{ExcludeContents: []string{"boot"}, ClampMtime: epoch}
+	if err := WriteCpio(&buf, root, opts, map[string]string{"init": "sbin/init", "bin": "usr/bin"}); err != nil {
+		t.Fatalf("WriteCpio() error = %v", err)
+	}
+	if buf.Len()%4 != 0 {
+		t.Errorf("archive length %d is not aligned", buf.Len())
+	}
+
+	records := readCpio(t, buf.Bytes())
+	if r, ok := records["etc/hostname"]; !ok || r.data != "ldf\n" || r.mode&0170000 != 0100000 {
+		t.Errorf("etc/hostname = %+v", r)
+	}
+	if r := records["init"]; r.data != "sbin/init" || r.mode&0170000 != 0120000 {
+		t.Errorf("init = %+v, want symlink to sbin/init", r)
+	}
+	// Files in the tree take precedence over extra symlinks
+	if r := records["bin"]; r.data != "sbin" {
+		t.Errorf("bin = %+v, want the rootfs symlink", r)
+	}
+	if _, ok := records["boot"]; !ok {
+		t.Error("excluded directory itself is missing")
+	}
+	if _, ok := records["boot/vmlinuz"]; ok {
+		t.Error("excluded contents were archived")
+	}
+	for name, r := range records {
+		if r.mtime > uint64(epoch.Unix()) {
+			t.Errorf("%s mtime %d was not clamped", name, r.mtime)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+// WithdrawArtifacts deletes everything a build published under storageDir,
+// except the objects whose base name is listed in keep, and returns the
+// number of objects removed
+func WithdrawArtifacts(ctx context.Context, backend storage.Backend, storageDir string, keep ...string) (int, error) {
+	objects, err := backend.List(ctx, storageDir+"/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	removed := 0
+	for _, obj := range objects {
+		if slices.Contains(keep, path.Base(obj.Key)) {
+			continue
+		}
+		if err := backend.Delete(ctx, obj.Key); err != nil {
+			return removed, fmt.Errorf("failed to delete %s: %w", obj.Key, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
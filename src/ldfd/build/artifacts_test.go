@@ -0,0 +1,42 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+func TestWithdrawArtifactsKeepsListedFiles(t *testing.T) {
+	backend, err := storage.NewLocal(storage.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	dir := "distribution/owner/dist/builds/build"
+	keys := []string{
+		dir + "/disk.img",
+		dir + "/disk.img.sig",
+		dir + "/boot-test.log",
+		"distribution/owner/dist/builds/other/disk.img",
+	}
+	for _, key := range keys {
+		if err := backend.Upload(ctx, key, strings.NewReader("x"), 1, "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := WithdrawArtifacts(ctx, backend, dir, "boot-test.log")
+	if err != nil {
+		t.Fatalf("WithdrawArtifacts() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d artifacts, want 2", removed)
+	}
+	for key, want := range map[string]bool{keys[0]: false, keys[1]: false, keys[2]: true, keys[3]: true} {
+		if exists, _ := backend.Exists(ctx, key); exists != want {
+			t.Errorf("%s exists = %v, want %v", key, exists, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 
+	"github.com/bitswalk/ldf/src/common/attestation"
 	"github.com/bitswalk/ldf/src/ldfd/db"
 )
 
@@ -23,11 +24,23 @@ type Stage interface {
 // ProgressFunc reports stage progress (0-100) with an optional message
 type ProgressFunc func(percent int, message string)
 
+// Signer signs build outputs on behalf of the server
+type Signer interface {
+	// Sign wraps an attestation payload in a signed DSSE envelope
+	Sign(payloadType string, payload []byte) (*attestation.Envelope, error)
+
+	// SignDetached returns a minisign signature of the data read from r
+	SignDetached(r io.Reader, trustedComment string) ([]byte, error)
+}
+
 // StageContext holds shared state passed through the pipeline
 type StageContext struct {
 	BuildID        string
 	DistributionID string
 	OwnerID        string
+	VerifyOf       string // Build a verification rebuild reproduces; such builds publish nothing
+	DistName       string // Distribution name and version, used in boot entries and bundle metadata
+	DistVersion    string
 	Config         *db.DistributionConfig
 	TargetArch     db.TargetArch
 	ImageFormat    db.ImageFormat
@@ -41,14 +54,31 @@ type StageContext struct {
 	BoardProfile   *db.BoardProfile    // Populated by resolve stage when board_profile_id is set
 	BuildEnv       *BuildEnvironment   // Populated by worker before pipeline starts
 	Executor       Executor            // Populated by worker before pipeline starts
+	Signer         Signer              // Signs published artifacts; nil when signing is unavailable
+	SecureBoot     *SecureBootKeys     // Populated by worker when Secure Boot signing is enabled
+	DiskKey        *DiskKey            // Populated by worker when the root partition is encrypted
+	Registry       RegistryCredentials // Used when pushing OCI images
+	PublicURL      string              // URL ldfd is reachable at, written into netboot configurations
+
+	// SourceDateEpoch pins timestamps when reproducible builds are enabled (0 = disabled)
+	SourceDateEpoch int64
 
 	// Toolchain info populated by prepare stage
 	ToolchainDir string // Path to extracted toolchain bin/ directory
 
 	// Artifact info populated by package stage
-	ArtifactPath     string // Storage key of final artifact
-	ArtifactChecksum string // SHA256 checksum
-	ArtifactSize     int64  // Size in bytes
+	ImagePath        string           // Local path of the packaged image
+	ArtifactPath     string           // Storage key of final artifact
+	ArtifactChecksum string           // SHA256 checksum
+	ArtifactSize     int64            // Size in bytes
+	VerityRootHash   string           // dm-verity root hash when the root is read-only
+	UpdateBundle     *db.UpdateBundle // OTA update bundle, when the configuration publishes one
+}
+
+// RegistryCredentials authenticate pushes to container registries
+type RegistryCredentials struct {
+	Username string
+	Password string
 }
 
 // ResolvedComponent holds a resolved component with its source artifact
@@ -57,4 +87,9 @@ type ResolvedComponent struct {
 	Version      string
 	ArtifactPath string // Storage key of downloaded source
 	LocalPath    string // Extracted path in workspace
+
+	// Download provenance recorded in the SBOM (empty when resolved from storage only)
+	SourceURL       string // Upstream URL the source was retrieved from
+	SourceChecksum  string // SHA256 of the downloaded source artifact
+	RetrievalMethod string // "release" or "git"
 }
@@ -0,0 +1,182 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// builderContainerfile is the Containerfile shipped with ldfd for producing
+// builder images
+//
+//go:embed builder/Containerfile
+var builderContainerfile []byte
+
+// BuilderImageStatus represents the state of a builder image variant
+type BuilderImageStatus string
+
+const (
+	BuilderImageMissing  BuilderImageStatus = "missing"
+	BuilderImageBuilding BuilderImageStatus = "building"
+	BuilderImageReady    BuilderImageStatus = "ready"
+	BuilderImageFailed   BuilderImageStatus = "failed"
+)
+
+// BuilderImage describes a builder image variant for a target architecture
+type BuilderImage struct {
+	TargetArch   db.TargetArch      `json:"target_arch"`
+	Image        string             `json:"image"`
+	Digest       string             `json:"digest,omitempty"`
+	Status       BuilderImageStatus `json:"status"`
+	MissingTools []string           `json:"missing_tools,omitempty"`
+	ErrorMessage string             `json:"error_message,omitempty"`
+	StartedAt    *time.Time         `json:"started_at,omitempty"`
+	CompletedAt  *time.Time         `json:"completed_at,omitempty"`
+}
+
+// BuilderImageBuildOpts holds options for building a builder image variant
+type BuilderImageBuildOpts struct {
+	Runtime    RuntimeType
+	BaseImage  string // configured builder image, e.g. "ldf-builder:latest"
+	TargetArch db.TargetArch
+	NoCache    bool
+	Output     io.Writer
+}
+
+// BuilderContainerfile returns the embedded builder Containerfile
+func BuilderContainerfile() []byte {
+	return builderContainerfile
+}
+
+// stripImageTag removes the tag and digest from an image reference. Only a
+// colon after the last slash separates a tag; one before it belongs to a
+// registry port.
+func stripImageTag(image string) string {
+	if idx := strings.Index(image, "@"); idx > 0 {
+		image = image[:idx]
+	}
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		return image[:idx]
+	}
+	return image
+}
+
+// BuilderImageTag returns the architecture-specific builder image name.
+// This is the same name ContainerImageForArch looks up before falling back
+// to the generic image.
+func BuilderImageTag(baseImage string, target db.TargetArch) string {
+	return fmt.Sprintf("%s:%s", stripImageTag(baseImage), string(target))
+}
+
+// BuildBuilderImage builds the builder image variant for the target
+// architecture from the embedded Containerfile and returns its tag and digest
+func BuildBuilderImage(ctx context.Context, opts BuilderImageBuildOpts) (*BuilderImage, error) {
+	if !opts.Runtime.IsContainerRuntime() {
+		return nil, fmt.Errorf("builder images require a container runtime, got %s", opts.Runtime)
+	}
+
+	buildDir, err := os.MkdirTemp("", "ldf-builder-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build context: %w", err)
+	}
+	defer os.RemoveAll(buildDir)
+
+	containerfile := filepath.Join(buildDir, "Containerfile")
+	if err := os.WriteFile(containerfile, builderContainerfile, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write Containerfile: %w", err)
+	}
+
+	tag := BuilderImageTag(opts.BaseImage, opts.TargetArch)
+	args := []string{"build", "-t", tag, "-f", containerfile,
+		"--build-arg", fmt.Sprintf("TARGET_ARCH=%s", opts.TargetArch)}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, buildDir)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, string(opts.Runtime), args...)
+	if opts.Output != nil {
+		cmd.Stdout = opts.Output
+		cmd.Stderr = io.MultiWriter(&stderr, opts.Output)
+	} else {
+		cmd.Stderr = &stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("builder image build failed: %w\nstderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	digest, err := ImageDigest(ctx, opts.Runtime, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BuilderImage{
+		TargetArch: opts.TargetArch,
+		Image:      tag,
+		Digest:     digest,
+		Status:     BuilderImageReady,
+	}, nil
+}
+
+// ImageDigest returns the content-addressed ID of a local image in
+// "sha256:<hex>" form. The result can be used in place of the image name to
+// pin a build to the exact image it was validated against.
+func ImageDigest(ctx context.Context, runtime RuntimeType, image string) (string, error) {
+	if !runtime.IsContainerRuntime() {
+		return "", fmt.Errorf("image digests require a container runtime, got %s", runtime)
+	}
+
+	out, err := exec.CommandContext(ctx, string(runtime), "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+
+	digest := strings.TrimSpace(string(out))
+	if digest == "" {
+		return "", fmt.Errorf("image %s has no digest", image)
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		digest = "sha256:" + digest
+	}
+	return digest, nil
+}
+
+// CheckBuilderImageTools runs a preflight inside the image and returns the
+// toolchain binaries that cannot be found on its PATH
+func CheckBuilderImageTools(ctx context.Context, executor Executor, image, platform string, deps ToolchainDeps) ([]string, error) {
+	script := `for bin in "$@"; do command -v "$bin" >/dev/null 2>&1 || echo "$bin"; done`
+	command := append([]string{"/bin/sh", "-c", script, "preflight"}, deps.All()...)
+
+	var stdout bytes.Buffer
+	opts := ContainerRunOpts{
+		Image:    image,
+		Platform: platform,
+		Command:  command,
+		Stdout:   &stdout,
+		Stderr:   io.Discard,
+	}
+	if err := executor.Run(ctx, opts); err != nil {
+		return nil, fmt.Errorf("toolchain preflight failed: %w", err)
+	}
+
+	var missing []string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if bin := strings.TrimSpace(scanner.Text()); bin != "" {
+			missing = append(missing, bin)
+		}
+	}
+	return missing, nil
+}
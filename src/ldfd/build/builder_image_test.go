@@ -0,0 +1,76 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestBuilderImageTag(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		target db.TargetArch
+		want   string
+	}{
+		{"tagged base", "ldf-builder:latest", db.ArchX86_64, "ldf-builder:x86_64"},
+		{"untagged base", "ldf-builder", db.ArchAARCH64, "ldf-builder:aarch64"},
+		{"registry base", "registry.example.com/ldf/builder:1.0", db.ArchAARCH64, "registry.example.com/ldf/builder:aarch64"},
+		{"registry port", "registry:5000/ldf-builder", db.ArchX86_64, "registry:5000/ldf-builder:x86_64"},
+		{"registry port and tag", "registry:5000/ldf-builder:latest", db.ArchX86_64, "registry:5000/ldf-builder:x86_64"},
+		{"digest", "ldf-builder@sha256:0123456789abcdef", db.ArchAARCH64, "ldf-builder:aarch64"},
+		{"tag and digest", "registry:5000/ldf-builder:latest@sha256:0123456789abcdef", db.ArchAARCH64, "registry:5000/ldf-builder:aarch64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuilderImageTag(tt.base, tt.target)
+			if got != tt.want {
+				t.Errorf("BuilderImageTag(%q, %s) = %q, want %q", tt.base, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderContainerfile(t *testing.T) {
+	content := string(BuilderContainerfile())
+	if content == "" {
+		t.Fatal("expected embedded Containerfile")
+	}
+	if !strings.Contains(content, "ARG TARGET_ARCH") {
+		t.Error("expected Containerfile to accept a TARGET_ARCH build argument")
+	}
+}
+
+func TestBuildBuilderImage_RequiresContainerRuntime(t *testing.T) {
+	_, err := BuildBuilderImage(context.Background(), BuilderImageBuildOpts{
+		Runtime:    RuntimeChroot,
+		BaseImage:  "ldf-builder:latest",
+		TargetArch: db.ArchX86_64,
+	})
+	if err == nil {
+		t.Fatal("expected error for chroot runtime")
+	}
+}
+
+func TestCheckBuilderImageTools(t *testing.T) {
+	executor, err := NewExecutor(RuntimeChroot, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deps := ToolchainDeps{
+		Compiler: []string{"sh"},
+		Common:   []string{"ldf-nonexistent-tool"},
+	}
+
+	missing, err := CheckBuilderImageTools(context.Background(), executor, "", "", deps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(missing) != 1 || missing[0] != "ldf-nonexistent-tool" {
+		t.Errorf("expected [ldf-nonexistent-tool], got %v", missing)
+	}
+}
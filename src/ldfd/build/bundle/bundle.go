@@ -0,0 +1,212 @@
+// Package bundle reads and writes LDF update bundles, the signed archives A/B devices install into their inactive root slot.
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitswalk/ldf/src/common/attestation"
+)
+
+// A bundle is an uncompressed tar archive. The first member is the JSON
+// manifest, the second the DSSE envelope signing it; the files the manifest
+// lists follow in manifest order. Installers verify the envelope, then check
+// every file against its manifest digest while streaming it to the slot.
+const (
+	// FormatName identifies LDF bundles in the manifest
+	FormatName = "ldf-bundle"
+	// FormatVersion is the manifest schema version written by this package
+	FormatVersion = 1
+	// Extension is the file extension of bundles
+	Extension = ".ldfb"
+	// ContentType is the media type bundles are served with
+	ContentType = "application/vnd.ldf.bundle"
+	// PayloadType is the DSSE payload type of the signed manifest
+	PayloadType = "application/vnd.ldf.bundle.manifest+json"
+
+	// ManifestName is the archive member holding the manifest
+	ManifestName = "manifest.json"
+	// SignatureName is the archive member holding the manifest envelope
+	SignatureName = "manifest.json.dsse"
+)
+
+// Slot classes of bundle images
+const (
+	SlotRootfs    = "rootfs"    // Written to the inactive root partition
+	SlotKernel    = "kernel"    // Installed to the slot's directory on the ESP
+	SlotInitramfs = "initramfs" // Installed next to the slot's kernel
+)
+
+// Hook names the updater passes as the first argument of the hooks script,
+// followed by the slot being installed ("a" or "b")
+const (
+	HookPreInstall  = "pre-install"
+	HookPostInstall = "post-install"
+)
+
+// Manifest describes the contents of a bundle and the devices it installs on
+type Manifest struct {
+	Format         string    `json:"format"`
+	FormatVersion  int       `json:"format_version"`
+	Compatible     string    `json:"compatible"` // Must equal the compatible string of the running system
+	Version        string    `json:"version"`
+	BuildID        string    `json:"build_id"`
+	DistributionID string    `json:"distribution_id"`
+	Arch           string    `json:"arch"`
+	Created        time.Time `json:"created"`
+	Images         []File    `json:"images"`
+	Hooks          *File     `json:"hooks,omitempty"` // Script run with HookPreInstall/HookPostInstall
+}
+
+// File is an archive member listed in the manifest
+type File struct {
+	Slot     string `json:"slot,omitempty"`
+	Filename string `json:"filename"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	FSType   string `json:"fs_type,omitempty"`
+}
+
+// Describe returns the manifest entry of a local file, stored in the
+// bundle under its base name
+func Describe(slot, path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to hash %s: %w", filepath.Base(path), err)
+	}
+
+	return File{
+		Slot:     slot,
+		Filename: filepath.Base(path),
+		SHA256:   hex.EncodeToString(h.Sum(nil)),
+		Size:     size,
+	}, nil
+}
+
+// Files returns every file of the manifest in archive order
+func (m *Manifest) Files() []File {
+	files := append([]File(nil), m.Images...)
+	if m.Hooks != nil {
+		files = append(files, *m.Hooks)
+	}
+	return files
+}
+
+// Write streams a bundle to w. manifest is the encoded manifest that
+// envelope signs, and dir holds the files it lists.
+func Write(w io.Writer, manifest []byte, envelope *attestation.Envelope, dir string) error {
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	signature, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest signature: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+	header := func(name string, size int64) *tar.Header {
+		return &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    size,
+			ModTime: m.Created.UTC().Truncate(time.Second),
+			Format:  tar.FormatPAX,
+		}
+	}
+
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{{ManifestName, manifest}, {SignatureName, signature}} {
+		if err := tw.WriteHeader(header(member.name, int64(len(member.data)))); err != nil {
+			return fmt.Errorf("failed to write %s: %w", member.name, err)
+		}
+		if _, err := tw.Write(member.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", member.name, err)
+		}
+	}
+
+	for _, file := range m.Files() {
+		if err := writeFile(tw, header(file.Filename, file.Size), filepath.Join(dir, file.Filename)); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// writeFile copies a local file into the archive
+func writeFile(tw *tar.Writer, hdr *tar.Header, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", hdr.Name, err)
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest and its signature envelope from the head
+// of a bundle. The signature is not verified.
+func ReadManifest(r io.Reader) (*Manifest, *attestation.Envelope, error) {
+	tr := tar.NewReader(r)
+
+	next := func(name string) ([]byte, error) {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("bundle is missing %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if hdr.Name != name {
+			return nil, fmt.Errorf("unexpected bundle member %q, want %s", hdr.Name, name)
+		}
+		return io.ReadAll(tr)
+	}
+
+	data, err := next(ManifestName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if m.Format != FormatName {
+		return nil, nil, fmt.Errorf("not an LDF bundle (format %q)", m.Format)
+	}
+
+	data, err = next(SignatureName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var env attestation.Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest signature: %w", err)
+	}
+
+	return &m, &env, nil
+}
@@ -0,0 +1,124 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitswalk/ldf/src/common/attestation"
+)
+
+func TestWriteReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rootfs.img"), []byte("root filesystem"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hooks.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rootfs, err := Describe(SlotRootfs, filepath.Join(dir, "rootfs.img"))
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+	if rootfs.Filename != "rootfs.img" || rootfs.Size != 15 || len(rootfs.SHA256) != 64 {
+		t.Errorf("Describe() = %+v", rootfs)
+	}
+	rootfs.FSType = "ext4"
+	hooks, err := Describe("", filepath.Join(dir, "hooks.sh"))
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+
+	m := Manifest{
+		Format:        FormatName,
+		FormatVersion: FormatVersion,
+		Compatible:    "board-a",
+		Version:       "1.2.0",
+		BuildID:       "build-1",
+		Arch:          "x86_64",
+		Created:       time.Unix(1700000000, 0).UTC(),
+		Images:        []File{rootfs},
+		Hooks:         &hooks,
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := attestation.Sign(priv, attestation.KeyID(pub), PayloadType, payload)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, payload, env, dir); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// Members appear in the documented order with the manifest timestamp
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.ModTime.Equal(m.Created) {
+			t.Errorf("%s mtime = %v, want %v", hdr.Name, hdr.ModTime, m.Created)
+		}
+		names = append(names, hdr.Name)
+	}
+	want := []string{ManifestName, SignatureName, "rootfs.img", "hooks.sh"}
+	if len(names) != len(want) {
+		t.Fatalf("members = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("member %d = %s, want %s", i, names[i], want[i])
+		}
+	}
+
+	got, gotEnv, err := ReadManifest(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	if got.Compatible != "board-a" || got.Images[0].SHA256 != rootfs.SHA256 || got.Hooks == nil {
+		t.Errorf("ReadManifest() = %+v", got)
+	}
+	verified, err := attestation.Verify(gotEnv, pub)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !bytes.Equal(verified, payload) {
+		t.Error("signed payload does not match the manifest member")
+	}
+}
+
+func TestReadManifest_NotBundle(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	data := []byte(`{"format":"something-else"}`)
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ReadManifest(&buf); err == nil {
+		t.Error("ReadManifest() accepted a foreign manifest")
+	}
+}
@@ -0,0 +1,138 @@
+package cloud
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestProfileFor(t *testing.T) {
+	p, err := ProfileFor("")
+	if err != nil || p.Provider != db.CloudProviderGeneric {
+		t.Fatalf("ProfileFor(\"\") = %v, %v", p.Provider, err)
+	}
+	if _, err := ProfileFor("azure"); err == nil {
+		t.Error("expected error for unsupported provider")
+	}
+
+	aws, _ := ProfileFor(db.CloudProviderAWS)
+	if got := aws.KernelArgs(db.ArchAARCH64); got != "console=tty0 console=ttyS0,115200n8 nvme_core.io_timeout=4294967295" {
+		t.Errorf("aws aarch64 kernel args = %q", got)
+	}
+	if !aws.SupportsFormat(db.ImageFormatVMDK) || aws.SupportsFormat(db.ImageFormatQCOW2) {
+		t.Errorf("unexpected aws image formats: %v", aws.ImageFormats)
+	}
+
+	gce, _ := ProfileFor(db.CloudProviderGCE)
+	if got := gce.KernelArgs(db.ArchX86_64); got != "console=ttyS0,38400n8" {
+		t.Errorf("gce x86_64 kernel args = %q", got)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	cfg := Settings(&db.DistributionConfig{Target: db.TargetConfig{Type: TargetType}})
+	if cfg.Provider != db.CloudProviderGeneric || cfg.DefaultUser != DefaultUser {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if Enabled(&db.DistributionConfig{Target: db.TargetConfig{Type: "server"}}) {
+		t.Error("server targets are not cloud images")
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	p, _ := ProfileFor(db.CloudProviderGeneric)
+	data, err := RenderConfig(db.CloudConfig{DefaultUser: "admin"}, p, []string{"/"})
+	if err != nil {
+		t.Fatalf("RenderConfig() error = %v", err)
+	}
+
+	var got cloudCfg
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("rendered configuration does not parse: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(got.DatasourceList, []string{"NoCloud", "ConfigDrive", "OpenStack", "None"}) {
+		t.Errorf("datasource_list = %v", got.DatasourceList)
+	}
+	if got.SystemInfo.DefaultUser.Name != "admin" || !got.SystemInfo.DefaultUser.LockPasswd {
+		t.Errorf("unexpected default user: %+v", got.SystemInfo.DefaultUser)
+	}
+	if got.Growpart.Mode != "auto" || !reflect.DeepEqual(got.Growpart.Devices, []string{"/"}) || !got.ResizeRootfs {
+		t.Errorf("unexpected growpart settings: %+v", got.Growpart)
+	}
+	if got.SSHPwauth || !got.DisableRoot {
+		t.Error("password and root logins should be disabled")
+	}
+
+	data, err = RenderConfig(db.CloudConfig{NoGrowpart: true, Datasources: []string{"Ec2"}}, p, []string{"/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = cloudCfg{}
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Growpart.Mode != "off" || got.ResizeRootfs {
+		t.Errorf("growpart should be off: %+v", got.Growpart)
+	}
+	if !reflect.DeepEqual(got.DatasourceList, []string{"Ec2"}) {
+		t.Errorf("configured datasources not used: %v", got.DatasourceList)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	generic, _ := ProfileFor(db.CloudProviderGeneric)
+	aws, _ := ProfileFor(db.CloudProviderAWS)
+	if !SeedEnabled(db.CloudConfig{}, generic) || SeedEnabled(db.CloudConfig{}, aws) {
+		t.Error("only NoCloud datasources read a seed")
+	}
+
+	data, err := SeedUserData(db.CloudConfig{SeedSSHKeys: []string{"ssh-ed25519 AAAA test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "#cloud-config\n") || !strings.Contains(string(data), "ssh-ed25519 AAAA test") {
+		t.Errorf("unexpected user-data:\n%s", data)
+	}
+	if data, _ := SeedUserData(db.CloudConfig{}); string(data) != "#cloud-config\n" {
+		t.Errorf("expected empty user-data, got:\n%s", data)
+	}
+}
+
+func TestWriteGCETarball(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "ldf.img")
+	if err := os.WriteFile(image, []byte("disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := image + GCETarballSuffix
+	epoch := time.Unix(1700000000, 0)
+	if err := WriteGCETarball(image, dest, epoch); err != nil {
+		t.Fatalf("WriteGCETarball() error = %v", err)
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := tar.NewReader(gz).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "disk.raw" || hdr.Size != 4 || !hdr.ModTime.Equal(epoch) {
+		t.Errorf("unexpected tar entry: %+v", hdr)
+	}
+}
@@ -0,0 +1,113 @@
+package cloud
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// ConfigPath is where the image's cloud-init settings are installed
+	ConfigPath = "/etc/cloud/cloud.cfg.d/90_ldf.cfg"
+	// ModulesLoadPath lists the provider's kernel modules for modules-load.d
+	ModulesLoadPath = "/etc/modules-load.d/cloud.conf"
+
+	// SeedName is the name the NoCloud seed ISO is published under
+	SeedName = "nocloud-seed.iso"
+	// SeedVolumeID is the volume label the NoCloud datasource looks for
+	SeedVolumeID = "cidata"
+)
+
+// Services are the cloud-init units, in the order they run at boot
+var Services = []string{"cloud-init-local", "cloud-init", "cloud-config", "cloud-final"}
+
+type cloudCfg struct {
+	DatasourceList []string   `yaml:"datasource_list"`
+	SystemInfo     systemInfo `yaml:"system_info"`
+	Growpart       growpart   `yaml:"growpart"`
+	ResizeRootfs   bool       `yaml:"resize_rootfs"`
+	DisableRoot    bool       `yaml:"disable_root"`
+	SSHPwauth      bool       `yaml:"ssh_pwauth"`
+}
+
+type systemInfo struct {
+	DefaultUser defaultUser `yaml:"default_user"`
+}
+
+type defaultUser struct {
+	Name       string `yaml:"name"`
+	LockPasswd bool   `yaml:"lock_passwd"`
+	Sudo       string `yaml:"sudo"`
+	Shell      string `yaml:"shell"`
+}
+
+type growpart struct {
+	Mode    string   `yaml:"mode"`
+	Devices []string `yaml:"devices"`
+}
+
+// RenderConfig returns the cloud-init configuration of the image. Instances
+// log in as the default user with the keys of their metadata; root and
+// password logins stay disabled. growDevices are the mount points growpart
+// extends to the end of the instance's disk.
+func RenderConfig(cfg db.CloudConfig, p Profile, growDevices []string) ([]byte, error) {
+	c := cloudCfg{
+		DatasourceList: p.DatasourceList(cfg),
+		SystemInfo: systemInfo{DefaultUser: defaultUser{
+			Name:       cfg.DefaultUser,
+			LockPasswd: true,
+			Sudo:       "ALL=(ALL) NOPASSWD:ALL",
+			Shell:      "/bin/sh",
+		}},
+		Growpart:     growpart{Mode: "auto", Devices: growDevices},
+		ResizeRootfs: true,
+		DisableRoot:  true,
+	}
+	if cfg.NoGrowpart {
+		c.Growpart = growpart{Mode: "off"}
+		c.ResizeRootfs = false
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-init configuration: %w", err)
+	}
+	return append([]byte("# Generated by LDF for "+string(p.Provider)+" instances\n"), data...), nil
+}
+
+type seedUserData struct {
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+}
+
+// SeedUserData returns the user-data of the NoCloud seed: the configured
+// keys, authorized for the default user
+func SeedUserData(cfg db.CloudConfig) ([]byte, error) {
+	data, err := yaml.Marshal(seedUserData{SSHAuthorizedKeys: cfg.SeedSSHKeys})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode seed user-data: %w", err)
+	}
+	if bytes.Equal(bytes.TrimSpace(data), []byte("{}")) {
+		data = nil
+	}
+	return append([]byte("#cloud-config\n"), data...), nil
+}
+
+// SeedMetaData returns the meta-data of the NoCloud seed. The instance ID
+// is the build's, so cloud-init runs once per image.
+func SeedMetaData(instanceID, hostname string) []byte {
+	return []byte(fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", instanceID, hostname))
+}
+
+// SeedEnabled reports whether instances of the profile read a NoCloud
+// seed, so a seed ISO is published with the image for local testing
+func SeedEnabled(cfg db.CloudConfig, p Profile) bool {
+	for _, ds := range p.DatasourceList(cfg) {
+		if ds == "NoCloud" {
+			return true
+		}
+	}
+	return false
+}
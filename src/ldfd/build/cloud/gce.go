@@ -0,0 +1,62 @@
+package cloud
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// gceDiskName is the name Compute Engine expects the raw disk under
+const gceDiskName = "disk.raw"
+
+// GCETarballSuffix is appended to raw image names for the Compute Engine
+// import tarball
+const GCETarballSuffix = ".tar.gz"
+
+// WriteGCETarball packs the raw image at imagePath into the tar.gz layout
+// Compute Engine imports, dated modTime so reproducible builds yield
+// identical archives
+func WriteGCETarball(imagePath, destPath string, modTime time.Time) error {
+	src, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	gz := gzip.NewWriter(dest)
+	tw := tar.NewWriter(gz)
+	hdr := &tar.Header{
+		Name:    gceDiskName,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: modTime,
+		Format:  tar.FormatGNU,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+	if _, err := io.Copy(tw, src); err != nil {
+		return fmt.Errorf("failed to write %s: %w", gceDiskName, err)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return dest.Close()
+}
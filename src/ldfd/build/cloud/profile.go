@@ -0,0 +1,171 @@
+// Package cloud holds the provider profiles of cloud images and renders
+// the cloud-init configuration and NoCloud seeds they boot with.
+package cloud
+
+import (
+	"fmt"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// TargetType is the distribution target type of cloud images
+const TargetType = "cloud"
+
+// DefaultUser is the account cloud-init creates when the configuration
+// does not name one
+const DefaultUser = "ldf"
+
+// Profile holds the conventions of a cloud provider's instances
+type Profile struct {
+	Provider db.CloudProvider
+	// Datasources is the cloud-init datasource list, most specific first
+	Datasources []string
+	// KernelModules are loaded at boot for the provider's disks and NICs
+	KernelModules []string
+	// KernelOptions are the CONFIG_ options the provider's hardware needs
+	KernelOptions map[string]string
+	// ImageFormats are the image formats the provider imports
+	ImageFormats []db.ImageFormat
+	// consoles is the console kernel argument per architecture
+	consoles map[db.TargetArch]string
+	// extraArgs are appended to the kernel command line on every architecture
+	extraArgs string
+}
+
+// virtioOptions are the kernel options of guests on KVM hypervisors
+var virtioOptions = map[string]string{
+	"CONFIG_VIRTIO":           "y",
+	"CONFIG_VIRTIO_PCI":       "y",
+	"CONFIG_VIRTIO_BLK":       "y",
+	"CONFIG_VIRTIO_NET":       "y",
+	"CONFIG_VIRTIO_CONSOLE":   "y",
+	"CONFIG_SCSI_VIRTIO":      "y",
+	"CONFIG_HW_RANDOM_VIRTIO": "y",
+}
+
+var profiles = map[db.CloudProvider]Profile{
+	db.CloudProviderGeneric: {
+		Provider:      db.CloudProviderGeneric,
+		Datasources:   []string{"NoCloud", "ConfigDrive", "OpenStack", "None"},
+		KernelModules: []string{"virtio_net", "virtio_blk", "virtio_scsi", "virtio_rng"},
+		KernelOptions: merge(virtioOptions, map[string]string{
+			// NoCloud seeds and config drives are ISO 9660 volumes
+			"CONFIG_ISO9660_FS": "y",
+			"CONFIG_JOLIET":     "y",
+		}),
+		ImageFormats: []db.ImageFormat{db.ImageFormatQCOW2, db.ImageFormatRaw},
+		consoles: map[db.TargetArch]string{
+			db.ArchX86_64:  "console=tty0 console=ttyS0,115200n8",
+			db.ArchAARCH64: "console=tty0 console=ttyAMA0,115200n8",
+		},
+	},
+	db.CloudProviderAWS: {
+		Provider:      db.CloudProviderAWS,
+		Datasources:   []string{"Ec2", "None"},
+		KernelModules: []string{"ena", "nvme"},
+		KernelOptions: map[string]string{
+			"CONFIG_PCI_MSI":           "y",
+			"CONFIG_BLK_DEV_NVME":      "y",
+			"CONFIG_NVME_CORE":         "y",
+			"CONFIG_ENA_ETHERNET":      "m",
+			"CONFIG_NET_VENDOR_AMAZON": "y",
+		},
+		ImageFormats: []db.ImageFormat{db.ImageFormatRaw, db.ImageFormatVMDK, db.ImageFormatVHDX},
+		consoles: map[db.TargetArch]string{
+			db.ArchX86_64:  "console=tty0 console=ttyS0,115200n8",
+			db.ArchAARCH64: "console=tty0 console=ttyS0,115200n8",
+		},
+		// EBS volumes detach rather than time out under the default NVMe timeout
+		extraArgs: "nvme_core.io_timeout=4294967295",
+	},
+	db.CloudProviderGCE: {
+		Provider:      db.CloudProviderGCE,
+		Datasources:   []string{"GCE", "None"},
+		KernelModules: []string{"gve", "virtio_net", "virtio_scsi", "nvme"},
+		KernelOptions: merge(virtioOptions, map[string]string{
+			"CONFIG_BLK_DEV_NVME":      "y",
+			"CONFIG_NET_VENDOR_GOOGLE": "y",
+			"CONFIG_GVE":               "m",
+		}),
+		// Compute Engine imports a raw disk named disk.raw packed in a tar.gz
+		ImageFormats: []db.ImageFormat{db.ImageFormatRaw},
+		consoles: map[db.TargetArch]string{
+			db.ArchX86_64:  "console=ttyS0,38400n8",
+			db.ArchAARCH64: "console=ttyAMA0,115200n8",
+		},
+	},
+}
+
+// Enabled reports whether config builds a cloud image
+func Enabled(config *db.DistributionConfig) bool {
+	return config != nil && config.Target.Type == TargetType
+}
+
+// Settings returns the cloud settings of config with defaults applied
+func Settings(config *db.DistributionConfig) db.CloudConfig {
+	var cfg db.CloudConfig
+	if config != nil && config.Target.Cloud != nil {
+		cfg = *config.Target.Cloud
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = db.CloudProviderGeneric
+	}
+	if cfg.DefaultUser == "" {
+		cfg.DefaultUser = DefaultUser
+	}
+	return cfg
+}
+
+// ProfileFor returns the profile of provider; an empty provider is generic
+func ProfileFor(provider db.CloudProvider) (Profile, error) {
+	if provider == "" {
+		provider = db.CloudProviderGeneric
+	}
+	p, ok := profiles[provider]
+	if !ok {
+		return Profile{}, fmt.Errorf("unsupported cloud provider %q (supported: generic, aws, gce)", provider)
+	}
+	return p, nil
+}
+
+// KernelArgs returns the kernel arguments of the provider's instances on
+// arch: the provider's console, which the instance's serial log captures
+func (p Profile) KernelArgs(arch db.TargetArch) string {
+	args := p.consoles[arch]
+	if args == "" {
+		args = p.consoles[db.ArchX86_64]
+	}
+	if p.extraArgs != "" {
+		args += " " + p.extraArgs
+	}
+	return args
+}
+
+// SupportsFormat reports whether the provider imports images of format
+func (p Profile) SupportsFormat(format db.ImageFormat) bool {
+	for _, f := range p.ImageFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// DatasourceList returns the datasources cloud-init probes: the
+// configured list, or the provider's
+func (p Profile) DatasourceList(cfg db.CloudConfig) []string {
+	if len(cfg.Datasources) > 0 {
+		return cfg.Datasources
+	}
+	return p.Datasources
+}
+
+func merge(maps ...map[string]string) map[string]string {
+	out := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,265 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/bitswalk/ldf/src/common/attestation"
+	"github.com/bitswalk/ldf/src/common/delta"
+	"github.com/bitswalk/ldf/src/common/paths"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+// ErrDeltaBuilds is returned when two builds cannot be connected by a delta
+var ErrDeltaBuilds = errors.New("builds cannot be connected by a delta")
+
+// DeltaKey returns the storage key of the delta from sourceBuildID to the
+// build whose image is stored at targetArtifact
+func DeltaKey(targetArtifact, sourceBuildID string) string {
+	return path.Join(path.Dir(targetArtifact), "deltas", sourceBuildID+delta.Extension)
+}
+
+// StartDelta computes the binary delta between the images of two completed
+// builds of a distribution in the background. An existing delta for the
+// pair is returned unless it failed, in which case it is computed again.
+func (m *Manager) StartDelta(sourceBuildID, targetBuildID string) (*db.BuildDelta, error) {
+	if sourceBuildID == targetBuildID {
+		return nil, fmt.Errorf("%w: source and target are the same build", ErrDeltaBuilds)
+	}
+
+	source, err := m.completedBuild(sourceBuildID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := m.completedBuild(targetBuildID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case source.DistributionID != target.DistributionID:
+		return nil, fmt.Errorf("%w: builds belong to different distributions", ErrDeltaBuilds)
+	case source.TargetArch != target.TargetArch:
+		return nil, fmt.Errorf("%w: builds target different architectures", ErrDeltaBuilds)
+	case source.ImageFormat != target.ImageFormat:
+		return nil, fmt.Errorf("%w: builds produced different image formats", ErrDeltaBuilds)
+	}
+
+	existing, err := m.deltaRepo.GetByBuilds(source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := existing
+	switch {
+	case existing == nil:
+		d = &db.BuildDelta{
+			DistributionID: target.DistributionID,
+			SourceBuildID:  source.ID,
+			TargetBuildID:  target.ID,
+			SourceChecksum: source.ArtifactChecksum,
+			TargetChecksum: target.ArtifactChecksum,
+		}
+		if err := m.deltaRepo.Create(d); err != nil {
+			return nil, err
+		}
+	case existing.Status == db.DeltaStatusFailed:
+		if err := m.deltaRepo.Reset(existing.ID); err != nil {
+			return nil, err
+		}
+		d.Status = db.DeltaStatusPending
+		d.ErrorMessage = ""
+		d.CompletedAt = nil
+	default:
+		return existing, nil
+	}
+
+	m.mu.RLock()
+	ctx := m.ctx
+	m.mu.RUnlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	log.Info("Build delta started", "delta_id", d.ID, "source", source.ID, "target", target.ID)
+
+	go m.runDelta(ctx, d, source, target)
+
+	snapshot := *d
+	return &snapshot, nil
+}
+
+// completedBuild loads a build that a delta can be computed from
+func (m *Manager) completedBuild(id string) (*db.BuildJob, error) {
+	job, err := m.buildJobRepo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build: %w", err)
+	}
+	if job == nil {
+		return nil, fmt.Errorf("build not found: %s", id)
+	}
+	if job.Status != db.BuildStatusCompleted || job.ArtifactPath == "" {
+		return nil, fmt.Errorf("%w: build %s has not completed with an image", ErrDeltaBuilds, id)
+	}
+	return job, nil
+}
+
+// runDelta computes a delta, stores it next to the target image and
+// records the outcome
+func (m *Manager) runDelta(ctx context.Context, d *db.BuildDelta, source, target *db.BuildJob) {
+	if err := m.deltaRepo.MarkRunning(d.ID); err != nil {
+		log.Error("Failed to mark delta running", "delta_id", d.ID, "error", err)
+		return
+	}
+
+	key, checksum, size, err := m.computeDelta(ctx, source, target)
+	if err != nil {
+		log.Error("Build delta failed", "delta_id", d.ID, "error", err)
+		if markErr := m.deltaRepo.MarkFailed(d.ID, err.Error()); markErr != nil {
+			log.Error("Failed to mark delta failed", "delta_id", d.ID, "error", markErr)
+		}
+		return
+	}
+
+	if err := m.deltaRepo.MarkCompleted(d.ID, key, checksum, size); err != nil {
+		log.Error("Failed to mark delta completed", "delta_id", d.ID, "error", err)
+		return
+	}
+
+	log.Info("Build delta completed",
+		"delta_id", d.ID,
+		"path", key,
+		"size", size,
+		"target_size", target.ArtifactSize,
+	)
+}
+
+// computeDelta writes the delta between two build images and uploads it
+// with its checksum and, when a signer is configured, its signature
+func (m *Manager) computeDelta(ctx context.Context, source, target *db.BuildJob) (string, string, int64, error) {
+	base := paths.Expand(m.config.WorkspaceBase)
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return "", "", 0, fmt.Errorf("failed to create workspace base: %w", err)
+	}
+	workDir, err := os.MkdirTemp(base, "delta-")
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create delta workspace: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	sourceFile, err := m.openArtifact(ctx, source.ArtifactPath, filepath.Join(workDir, "source"))
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer sourceFile.Close()
+	targetFile, err := m.openArtifact(ctx, target.ArtifactPath, filepath.Join(workDir, "target"))
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer targetFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to stat source image: %w", err)
+	}
+	targetInfo, err := targetFile.Stat()
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to stat target image: %w", err)
+	}
+
+	deltaPath := filepath.Join(workDir, source.ID+delta.Extension)
+	out, err := os.Create(deltaPath)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create delta: %w", err)
+	}
+	hash := sha256.New()
+	header, stats, err := delta.Create(io.MultiWriter(out, hash), sourceFile, sourceInfo.Size(), targetFile, targetInfo.Size())
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create delta: %w", err)
+	}
+	if target.ArtifactChecksum != "" && header.TargetSHA256 != target.ArtifactChecksum {
+		return "", "", 0, fmt.Errorf("target image does not match its recorded checksum")
+	}
+	log.Debug("Delta computed",
+		"source", source.ID,
+		"target", target.ID,
+		"copied_bytes", stats.CopiedBytes,
+		"literal_bytes", stats.LiteralBytes,
+	)
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	key := DeltaKey(target.ArtifactPath, source.ID)
+
+	f, err := os.Open(deltaPath)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to open delta: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to stat delta: %w", err)
+	}
+	if err := m.storage.Upload(ctx, key, f, info.Size(), delta.ContentType); err != nil {
+		return "", "", 0, fmt.Errorf("failed to upload delta: %w", err)
+	}
+	checksumContent := []byte(fmt.Sprintf("%s  %s\n", checksum, path.Base(key)))
+	if err := m.storage.Upload(ctx, key+".sha256", bytes.NewReader(checksumContent), int64(len(checksumContent)), "text/plain"); err != nil {
+		return "", "", 0, fmt.Errorf("failed to upload delta checksum: %w", err)
+	}
+
+	if m.signer != nil {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", "", 0, fmt.Errorf("failed to rewind delta: %w", err)
+		}
+		comment := fmt.Sprintf("timestamp:%d\tfile:%s\tbuild:%s", time.Now().Unix(), path.Base(key), target.ID)
+		sig, err := m.signer.SignDetached(f, comment)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("failed to sign delta: %w", err)
+		}
+		if err := m.storage.Upload(ctx, key+attestation.SignatureSuffix, bytes.NewReader(sig), int64(len(sig)), "text/plain"); err != nil {
+			return "", "", 0, fmt.Errorf("failed to upload delta signature: %w", err)
+		}
+	}
+
+	return key, checksum, info.Size(), nil
+}
+
+// openArtifact opens a stored build image, reading local storage in place
+// and downloading to localPath otherwise
+func (m *Manager) openArtifact(ctx context.Context, key, localPath string) (*os.File, error) {
+	if resolver, ok := m.storage.(storage.LocalPathResolver); ok {
+		f, err := os.Open(resolver.ResolvePath(key))
+		if err != nil {
+			return nil, fmt.Errorf("build image not found: %w", err)
+		}
+		return f, nil
+	}
+
+	reader, _, err := m.storage.Download(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	f, err := os.Create(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return f, nil
+}
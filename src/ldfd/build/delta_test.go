@@ -0,0 +1,142 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bitswalk/ldf/src/common/delta"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+// setupDeltaManager returns a manager backed by an in-memory database and
+// local storage
+func setupDeltaManager(t *testing.T) (*Manager, *db.Distribution) {
+	t.Helper()
+	database, err := db.New(db.Config{PersistPath: "", LoadOnStart: false})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Shutdown() })
+
+	backend, err := storage.NewLocal(storage.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	dist := &db.Distribution{Name: "delta-distro", Version: "1.0.0", Status: db.StatusReady, Visibility: db.VisibilityPrivate}
+	if err := db.NewDistributionRepository(database).Create(dist); err != nil {
+		t.Fatalf("failed to create distribution: %v", err)
+	}
+
+	return NewManager(database, backend, nil, Config{WorkspaceBase: t.TempDir()}), dist
+}
+
+// completeBuild records a completed build whose stored image is data
+func completeBuild(t *testing.T, m *Manager, distID string, data []byte) *db.BuildJob {
+	t.Helper()
+	job := &db.BuildJob{DistributionID: distID, OwnerID: "owner-1", TargetArch: db.ArchX86_64, ImageFormat: db.ImageFormatRaw}
+	if err := m.buildJobRepo.Create(job); err != nil {
+		t.Fatalf("failed to create build job: %v", err)
+	}
+
+	key := "distribution/owner-1/" + distID + "/builds/" + job.ID + "/image.img"
+	if err := m.storage.Upload(context.Background(), key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatalf("failed to upload image: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if err := m.buildJobRepo.MarkCompleted(job.ID, key, hex.EncodeToString(sum[:]), int64(len(data))); err != nil {
+		t.Fatalf("failed to complete build: %v", err)
+	}
+
+	job, err := m.buildJobRepo.GetByID(job.ID)
+	if err != nil {
+		t.Fatalf("failed to reload build: %v", err)
+	}
+	return job
+}
+
+func TestStartDelta(t *testing.T) {
+	m, dist := setupDeltaManager(t)
+
+	sourceImage := make([]byte, 32*delta.DefaultChunkSize)
+	rand.New(rand.NewSource(1)).Read(sourceImage)
+	targetImage := append([]byte(nil), sourceImage...)
+	copy(targetImage[7*delta.DefaultChunkSize:], "updated package contents")
+
+	source := completeBuild(t, m, dist.ID, sourceImage)
+	target := completeBuild(t, m, dist.ID, targetImage)
+
+	started, err := m.StartDelta(source.ID, target.ID)
+	if err != nil {
+		t.Fatalf("StartDelta() error = %v", err)
+	}
+
+	var d *db.BuildDelta
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		d, err = m.DeltaRepo().GetByID(started.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if d.Status == db.DeltaStatusCompleted || d.Status == db.DeltaStatusFailed {
+			break
+		}
+	}
+	if d.Status != db.DeltaStatusCompleted {
+		t.Fatalf("delta status = %s (%s), want completed", d.Status, d.ErrorMessage)
+	}
+	if d.ArtifactPath != DeltaKey(target.ArtifactPath, source.ID) {
+		t.Errorf("ArtifactPath = %s", d.ArtifactPath)
+	}
+	if d.SizeBytes >= int64(len(targetImage)) {
+		t.Errorf("delta of %d bytes is not smaller than the image", d.SizeBytes)
+	}
+
+	reader, _, err := m.storage.Download(context.Background(), d.ArtifactPath)
+	if err != nil {
+		t.Fatalf("failed to download delta: %v", err)
+	}
+	defer reader.Close()
+	var out bytes.Buffer
+	if _, err := delta.Apply(&out, bytes.NewReader(sourceImage), int64(len(sourceImage)), reader); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), targetImage) {
+		t.Error("reconstructed image differs from the target build")
+	}
+	if exists, _ := m.storage.Exists(context.Background(), d.ArtifactPath+".sha256"); !exists {
+		t.Error("expected checksum file next to the delta")
+	}
+
+	// Requesting the same pair again returns the stored delta
+	again, err := m.StartDelta(source.ID, target.ID)
+	if err != nil {
+		t.Fatalf("StartDelta() error = %v", err)
+	}
+	if again.ID != d.ID || again.Status != db.DeltaStatusCompleted {
+		t.Errorf("expected existing delta, got %+v", again)
+	}
+}
+
+func TestStartDelta_RejectsUnrelatedBuilds(t *testing.T) {
+	m, dist := setupDeltaManager(t)
+	source := completeBuild(t, m, dist.ID, []byte("source"))
+
+	pending := &db.BuildJob{DistributionID: dist.ID, OwnerID: "owner-1"}
+	if err := m.buildJobRepo.Create(pending); err != nil {
+		t.Fatalf("failed to create build job: %v", err)
+	}
+
+	if _, err := m.StartDelta(source.ID, source.ID); !errors.Is(err, ErrDeltaBuilds) {
+		t.Errorf("same build: error = %v, want ErrDeltaBuilds", err)
+	}
+	if _, err := m.StartDelta(source.ID, pending.ID); !errors.Is(err, ErrDeltaBuilds) {
+		t.Errorf("pending target: error = %v, want ErrDeltaBuilds", err)
+	}
+}
@@ -0,0 +1,36 @@
+package build
+
+import "fmt"
+
+// DiskKeyDir names the directory holding a build's LUKS2 key file in the
+// workspace
+const DiskKeyDir = "diskkey"
+
+// RecoveryArtifactKey returns the storage key a build's recovery key is
+// exported to. It lives outside the "distribution/" prefix so the artifacts
+// API never lists or serves it; only the builds API hands it out.
+func RecoveryArtifactKey(ownerID, distributionID, buildID string) string {
+	return fmt.Sprintf("private/%s/%s/builds/%s/recovery-key", ownerID, distributionID, buildID)
+}
+
+// DiskKey locates the key an encrypted root partition is formatted with.
+// KeyFile lives inside Dir, which the worker removes when the build finishes.
+type DiskKey struct {
+	Dir         string
+	KeyFile     string
+	LUKSUUID    string
+	RecoveryKey string
+}
+
+// DiskKeyProvider creates and stores the per-build keys of encrypted roots
+type DiskKeyProvider interface {
+	// CreateDiskKey generates and records the key of a build and writes its
+	// key file into dir
+	CreateDiskKey(buildID, distributionID, dir string) (*DiskKey, error)
+}
+
+// SetDiskKeyProvider sets the key store used by builds with an encrypted
+// root. Such builds fail when no provider is configured.
+func (m *Manager) SetDiskKeyProvider(p DiskKeyProvider) {
+	m.diskKeys = p
+}
@@ -0,0 +1,199 @@
+package firmware
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const testWhence = `
+linux-firmware WHENCE
+
+--------------------------------------------------------------------------
+
+Driver: iwlwifi - Intel Wireless Wifi
+
+File: iwlwifi-8000C-36.ucode
+File: "intel/iwl fw.pnvm"
+Link: iwlwifi-8000C-latest.ucode -> iwlwifi-8000C-36.ucode
+
+Licence: Redistributable. See LICENCE.iwlwifi_firmware for details.
+
+--------------------------------------------------------------------------
+
+Driver: amdgpu - AMD Radeon
+Driver: radeon - legacy AMD Radeon
+
+File: amdgpu/navi10_sos.bin
+RawFile: amdgpu/navi10_smc.bin
+
+Licence: Redistributable. See LICENSE.amdgpu
+ for details.
+
+--------------------------------------------------------------------------
+`
+
+func writeTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		WhenceFile:                   testWhence,
+		"iwlwifi-8000C-36.ucode":     "iwl",
+		"intel/iwl fw.pnvm":          "pnvm",
+		"amdgpu/navi10_sos.bin":      "sos",
+		"amdgpu/navi10_smc.bin":      "smc",
+		"LICENCE.iwlwifi_firmware":   "iwlwifi licence",
+		"LICENSE.amdgpu":             "amdgpu licence",
+		"unlisted/not-in-whence.bin": "x",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseWhence(t *testing.T) {
+	entries, err := ParseWhence(strings.NewReader(testWhence))
+	if err != nil {
+		t.Fatalf("ParseWhence() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	iwl := entries[0]
+	if iwl.Driver != "iwlwifi" || iwl.Description != "Intel Wireless Wifi" {
+		t.Fatalf("unexpected iwlwifi entry: %+v", iwl)
+	}
+	if !reflect.DeepEqual(iwl.Files, []string{"iwlwifi-8000C-36.ucode", "intel/iwl fw.pnvm"}) {
+		t.Fatalf("unexpected iwlwifi files: %v", iwl.Files)
+	}
+	if len(iwl.Links) != 1 || iwl.Links[0] != (Link{Name: "iwlwifi-8000C-latest.ucode", Target: "iwlwifi-8000C-36.ucode"}) {
+		t.Fatalf("unexpected iwlwifi links: %v", iwl.Links)
+	}
+
+	// Drivers sharing a section share its files
+	if entries[1].Driver != "amdgpu" || entries[2].Driver != "radeon" {
+		t.Fatalf("expected amdgpu and radeon entries, got %s and %s", entries[1].Driver, entries[2].Driver)
+	}
+	if len(entries[2].Files) != 2 {
+		t.Fatalf("expected radeon to share amdgpu files, got %v", entries[2].Files)
+	}
+	if entries[1].License != "Redistributable. See LICENSE.amdgpu for details." {
+		t.Fatalf("unexpected multi-line licence: %q", entries[1].License)
+	}
+}
+
+func TestIndexSelectAndInstall(t *testing.T) {
+	dir := writeTree(t)
+	ix, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+
+	modules := []Module{
+		{Name: "iwlwifi", Firmware: []string{"iwlwifi-8000C-latest.ucode", "iwlwifi-9000-missing.ucode"}},
+	}
+	sel, err := ix.Select(db.FirmwareSelection{
+		Modules: []string{"iwlwifi"},
+		Files:   []string{"amdgpu/navi10_s*.bin"},
+	}, modules)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	// The link pulls in its target
+	wantFiles := []string{"amdgpu/navi10_smc.bin", "amdgpu/navi10_sos.bin", "iwlwifi-8000C-36.ucode"}
+	if !reflect.DeepEqual(sel.Files, wantFiles) {
+		t.Fatalf("Files = %v, want %v", sel.Files, wantFiles)
+	}
+	if len(sel.Links) != 1 || sel.Links[0].Name != "iwlwifi-8000C-latest.ucode" {
+		t.Fatalf("unexpected links: %v", sel.Links)
+	}
+	if !reflect.DeepEqual(sel.Licenses, []string{"LICENCE.iwlwifi_firmware", "LICENSE.amdgpu"}) {
+		t.Fatalf("unexpected licences: %v", sel.Licenses)
+	}
+	if !reflect.DeepEqual(sel.Unresolved, []string{"iwlwifi-9000-missing.ucode"}) {
+		t.Fatalf("unexpected unresolved firmware: %v", sel.Unresolved)
+	}
+
+	rootfs := t.TempDir()
+	if err := ix.Install(sel, rootfs); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	for _, f := range append(wantFiles, "iwlwifi-8000C-latest.ucode") {
+		if _, err := os.Stat(filepath.Join(rootfs, InstallDir, f)); err != nil {
+			t.Fatalf("expected %s installed: %v", f, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, InstallDir, "intel")); !os.IsNotExist(err) {
+		t.Fatal("expected unselected firmware to be left out")
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, LicenseDir, WhenceFile)); err != nil {
+		t.Fatalf("expected WHENCE installed with the licences: %v", err)
+	}
+
+	report := NewReport(ix, sel, "20240909", modules, nil, filepath.Join(rootfs, InstallDir))
+	if len(report.Installed) != 4 || report.Installed[0].Driver != "amdgpu" {
+		t.Fatalf("unexpected installed firmware: %+v", report.Installed)
+	}
+	if len(report.Missing) != 1 || !reflect.DeepEqual(report.Missing[0].Firmware, []string{"iwlwifi-9000-missing.ucode"}) {
+		t.Fatalf("unexpected missing firmware: %+v", report.Missing)
+	}
+}
+
+func TestIndexSelect_Errors(t *testing.T) {
+	ix, err := LoadIndex(writeTree(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		sel     db.FirmwareSelection
+		wantErr string
+	}{
+		{name: "unknown driver", sel: db.FirmwareSelection{Drivers: []string{"nouveau"}}, wantErr: "unknown firmware driver"},
+		{name: "module not built", sel: db.FirmwareSelection{Modules: []string{"ath10k_pci"}}, wantErr: "is not built"},
+		{name: "unmatched file", sel: db.FirmwareSelection{Files: []string{"unlisted/*.bin"}}, wantErr: "no linux-firmware file matches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ix.Select(tt.sel, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Select() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanModules_Unscanned(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "kernel", "drivers"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kernel", "drivers", "foo.ko.zst"), []byte("zstd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "modules.dep"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	modules, unscanned, err := ScanModules(dir)
+	if err != nil {
+		t.Fatalf("ScanModules() error = %v", err)
+	}
+	if len(modules) != 0 || !reflect.DeepEqual(unscanned, []string{"kernel/drivers/foo.ko.zst"}) {
+		t.Fatalf("unexpected scan result: %v, %v", modules, unscanned)
+	}
+}
@@ -0,0 +1,127 @@
+package firmware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Module is a kernel module and the firmware its modinfo references
+type Module struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"` // relative to the modules directory
+	Firmware []string `json:"firmware,omitempty"`
+}
+
+// moduleSuffixes lists the kernel module file suffixes ScanModules reads
+var moduleSuffixes = []string{".ko", ".ko.xz", ".ko.gz"}
+
+// ScanModules reads the firmware references of every kernel module below
+// modulesDir. Modules in a compression it cannot read, such as zstd, are
+// returned in unscanned.
+func ScanModules(modulesDir string) (modules []Module, unscanned []string, err error) {
+	err = filepath.Walk(modulesDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.Contains(info.Name(), ".ko") {
+			return nil
+		}
+		rel, _ := filepath.Rel(modulesDir, p)
+
+		suffix := ""
+		for _, s := range moduleSuffixes {
+			if strings.HasSuffix(info.Name(), s) {
+				suffix = s
+			}
+		}
+		if suffix == "" {
+			unscanned = append(unscanned, filepath.ToSlash(rel))
+			return nil
+		}
+
+		name, fw, err := readModinfo(p, suffix)
+		if err != nil {
+			return fmt.Errorf("failed to read module %s: %w", rel, err)
+		}
+		if name == "" {
+			name = strings.TrimSuffix(info.Name(), suffix)
+		}
+		modules = append(modules, Module{Name: name, Path: filepath.ToSlash(rel), Firmware: fw})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Name < modules[j].Name })
+	return modules, unscanned, nil
+}
+
+// readModinfo returns the name and firmware entries of a module's
+// .modinfo section
+func readModinfo(p, suffix string) (string, []string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch suffix {
+	case ".ko.xz":
+		if r, err = xz.NewReader(f); err != nil {
+			return "", nil, err
+		}
+	case ".ko.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	obj, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+	section := obj.Section(".modinfo")
+	if section == nil {
+		return "", nil, nil
+	}
+	info, err := section.Data()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var name string
+	var fw []string
+	for _, field := range bytes.Split(info, []byte{0}) {
+		key, value, ok := strings.Cut(string(field), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "name":
+			name = value
+		case "firmware":
+			if !containsString(fw, value) {
+				fw = append(fw, value)
+			}
+		}
+	}
+	return name, fw, nil
+}
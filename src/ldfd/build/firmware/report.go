@@ -0,0 +1,95 @@
+package firmware
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Report describes the firmware of an image: what was installed from
+// linux-firmware and which kernel modules reference firmware it lacks
+type Report struct {
+	FirmwareVersion string              `json:"firmware_version,omitempty"`
+	Installed       []InstalledFirmware `json:"installed"`
+	Missing         []MissingFirmware   `json:"missing"`
+	Unscanned       []string            `json:"unscanned,omitempty"` // modules whose compression could not be read
+}
+
+// InstalledFirmware is a file or link installed from linux-firmware
+type InstalledFirmware struct {
+	Path    string `json:"path"`
+	Driver  string `json:"driver,omitempty"`
+	License string `json:"license,omitempty"`
+}
+
+// MissingFirmware lists the firmware a module references that is not
+// present in the image
+type MissingFirmware struct {
+	Module   string   `json:"module"`
+	Path     string   `json:"path"`
+	Firmware []string `json:"firmware"`
+}
+
+// NewReport builds the firmware report of an image. The index and
+// selection are nil when no linux-firmware tree was used; firmwareDirs are
+// the image's firmware directories, searched in order.
+func NewReport(ix *Index, sel *Selection, version string, modules []Module, unscanned []string, firmwareDirs ...string) *Report {
+	report := &Report{
+		FirmwareVersion: version,
+		Installed:       []InstalledFirmware{},
+		Missing:         []MissingFirmware{},
+		Unscanned:       unscanned,
+	}
+
+	if ix != nil && sel != nil {
+		names := append([]string(nil), sel.Files...)
+		for _, l := range sel.Links {
+			names = append(names, l.Name)
+		}
+		for _, name := range names {
+			installed := InstalledFirmware{Path: name}
+			if e, ok := ix.Owner(name); ok {
+				installed.Driver = e.Driver
+				installed.License = e.License
+			}
+			report.Installed = append(report.Installed, installed)
+		}
+	}
+
+	for _, mod := range modules {
+		var missing []string
+		for _, ref := range mod.Firmware {
+			if !firmwarePresent(ref, firmwareDirs) {
+				missing = append(missing, ref)
+			}
+		}
+		if len(missing) > 0 {
+			report.Missing = append(report.Missing, MissingFirmware{
+				Module:   mod.Name,
+				Path:     mod.Path,
+				Firmware: missing,
+			})
+		}
+	}
+
+	return report
+}
+
+// firmwarePresent reports whether a firmware reference, which may be a
+// glob pattern, resolves to a file in one of dirs
+func firmwarePresent(ref string, dirs []string) bool {
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(ref)))
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && !info.IsDir() {
+				return true
+			}
+		}
+		// Firmware may be installed compressed
+		for _, ext := range []string{".xz", ".zst"} {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(ref)) + ext); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
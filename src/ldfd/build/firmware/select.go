@@ -0,0 +1,183 @@
+package firmware
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// InstallDir is where firmware is installed in the root filesystem
+	InstallDir = "lib/firmware"
+
+	// LicenseDir is where the licences of installed firmware are installed
+	LicenseDir = "usr/share/licenses/linux-firmware"
+
+	// ReportName is the artifact name of the firmware report
+	ReportName = "firmware-report.json"
+)
+
+// Selection is the part of a linux-firmware tree a build installs
+type Selection struct {
+	Files      []string // regular files, relative to the tree
+	Links      []Link
+	Licenses   []string // licence files the selected entries refer to
+	Unresolved []string // module firmware references the tree does not provide
+}
+
+// Select resolves a firmware selection against the index. Modules are the
+// kernel modules built for the image, used to look up the firmware of
+// modules the selection names. Unknown drivers and modules, and file
+// patterns matching nothing, are errors.
+func (ix *Index) Select(sel db.FirmwareSelection, modules []Module) (*Selection, error) {
+	files := make(map[string]bool)
+	links := make(map[string]string)
+	owners := make(map[int]bool)
+
+	var add func(name string, depth int)
+	add = func(name string, depth int) {
+		if i, ok := ix.owners[name]; ok {
+			owners[i] = true
+		}
+		if target, ok := ix.links[name]; ok {
+			links[name] = target
+			if depth < 8 {
+				add(path.Join(path.Dir(name), target), depth+1)
+			}
+			return
+		}
+		if _, ok := ix.owners[name]; ok {
+			files[name] = true
+		}
+	}
+
+	for _, driver := range sel.Drivers {
+		entries, ok := ix.drivers[driver]
+		if !ok {
+			return nil, fmt.Errorf("unknown firmware driver %q", driver)
+		}
+		for _, i := range entries {
+			for _, f := range ix.Entries[i].Files {
+				add(f, 0)
+			}
+			for _, l := range ix.Entries[i].Links {
+				add(l.Name, 0)
+			}
+		}
+	}
+
+	var unresolved []string
+	for _, name := range sel.Modules {
+		mod := findModule(modules, name)
+		if mod == nil {
+			return nil, fmt.Errorf("kernel module %q selected for firmware is not built", name)
+		}
+		for _, ref := range mod.Firmware {
+			matches := ix.Match(ref)
+			if len(matches) == 0 && !containsString(unresolved, ref) {
+				unresolved = append(unresolved, ref)
+			}
+			for _, m := range matches {
+				add(m, 0)
+			}
+		}
+	}
+
+	for _, pattern := range sel.Files {
+		matches := ix.Match(strings.TrimPrefix(pattern, "/"))
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no linux-firmware file matches %q", pattern)
+		}
+		for _, m := range matches {
+			add(m, 0)
+		}
+	}
+
+	result := &Selection{Unresolved: unresolved}
+	for f := range files {
+		result.Files = append(result.Files, f)
+	}
+	sort.Strings(result.Files)
+	for name, target := range links {
+		result.Links = append(result.Links, Link{Name: name, Target: target})
+	}
+	sort.Slice(result.Links, func(i, j int) bool { return result.Links[i].Name < result.Links[j].Name })
+	for i := range owners {
+		for _, lic := range ix.LicenseFiles(&ix.Entries[i]) {
+			if !containsString(result.Licenses, lic) {
+				result.Licenses = append(result.Licenses, lic)
+			}
+		}
+	}
+	sort.Strings(result.Licenses)
+
+	return result, nil
+}
+
+// Install copies the selected files, links and licences from the tree
+// into the root filesystem at rootfs, along with the WHENCE manifest
+func (ix *Index) Install(sel *Selection, rootfs string) error {
+	fwDir := filepath.Join(rootfs, InstallDir)
+	for _, f := range sel.Files {
+		if err := copyFile(filepath.Join(ix.Dir, filepath.FromSlash(f)), filepath.Join(fwDir, filepath.FromSlash(f))); err != nil {
+			return fmt.Errorf("failed to install firmware %s: %w", f, err)
+		}
+	}
+	for _, l := range sel.Links {
+		dest := filepath.Join(fwDir, filepath.FromSlash(l.Name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		_ = os.Remove(dest)
+		if err := os.Symlink(l.Target, dest); err != nil {
+			return fmt.Errorf("failed to link firmware %s: %w", l.Name, err)
+		}
+	}
+
+	licDir := filepath.Join(rootfs, LicenseDir)
+	for _, name := range append([]string{WhenceFile}, sel.Licenses...) {
+		if err := copyFile(filepath.Join(ix.Dir, name), filepath.Join(licDir, name)); err != nil {
+			return fmt.Errorf("failed to install firmware licence %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// findModule returns the module named name, treating dashes and
+// underscores alike as modprobe does
+func findModule(modules []Module, name string) *Module {
+	want := strings.ReplaceAll(name, "-", "_")
+	for i := range modules {
+		if strings.ReplaceAll(modules[i].Name, "-", "_") == want {
+			return &modules[i]
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst, creating dst's directory
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
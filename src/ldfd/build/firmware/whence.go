@@ -0,0 +1,221 @@
+// Package firmware indexes linux-firmware trees, selects the blobs a build
+// needs and reports kernel modules whose firmware is missing from an image.
+package firmware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// WhenceFile is the linux-firmware manifest describing every blob, the
+// driver using it and its licence
+const WhenceFile = "WHENCE"
+
+// Entry is a WHENCE section: the files and links one driver uses
+type Entry struct {
+	Driver      string   `json:"driver"`
+	Description string   `json:"description,omitempty"`
+	Files       []string `json:"files"`
+	Links       []Link   `json:"links,omitempty"`
+	License     string   `json:"license,omitempty"`
+}
+
+// Link is a symlink in the firmware tree, Target relative to its directory
+type Link struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
+
+// licenseFileRe matches the licence files WHENCE licences refer to
+var licenseFileRe = regexp.MustCompile(`\b(LICEN[CS]E[.\w-]*|GPL-[23])\b`)
+
+// ParseWhence parses a WHENCE manifest. Sections are separated by dashed
+// lines; a section naming several drivers yields an entry per driver.
+func ParseWhence(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var drivers, descriptions, files []string
+	var links []Link
+	var license []string
+	inLicense := false
+
+	flush := func() {
+		for i, driver := range drivers {
+			entries = append(entries, Entry{
+				Driver:      driver,
+				Description: descriptions[i],
+				Files:       append([]string(nil), files...),
+				Links:       append([]Link(nil), links...),
+				License:     strings.Join(license, " "),
+			})
+		}
+		drivers, descriptions, files, links, license = nil, nil, nil, nil, nil
+		inLicense = false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		key, value, hasKey := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(line, "-----"):
+			flush()
+		case line == "":
+			inLicense = false
+		case hasKey && key == "Driver":
+			name, desc, _ := strings.Cut(value, " ")
+			drivers = append(drivers, strings.TrimSuffix(name, ":"))
+			descriptions = append(descriptions, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(desc), "-")))
+			inLicense = false
+		case hasKey && (key == "File" || key == "RawFile"):
+			files = append(files, unquote(value))
+			inLicense = false
+		case hasKey && key == "Link":
+			name, target, ok := strings.Cut(value, "->")
+			if !ok {
+				return nil, fmt.Errorf("invalid WHENCE link: %s", line)
+			}
+			links = append(links, Link{Name: unquote(strings.TrimSpace(name)), Target: unquote(strings.TrimSpace(target))})
+			inLicense = false
+		case hasKey && (key == "Licence" || key == "License"):
+			license = append(license, value)
+			inLicense = true
+		case inLicense:
+			license = append(license, strings.TrimSpace(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return entries, nil
+}
+
+// unquote strips the double quotes WHENCE puts around names with spaces
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Index is a searchable WHENCE manifest of one linux-firmware tree
+type Index struct {
+	Dir     string
+	Entries []Entry
+
+	drivers map[string][]int // driver name -> entries
+	owners  map[string]int   // file or link name -> entry
+	links   map[string]string
+}
+
+// LoadIndex indexes the linux-firmware tree extracted at dir
+func LoadIndex(dir string) (*Index, error) {
+	f, err := os.Open(filepath.Join(dir, WhenceFile))
+	if err != nil {
+		return nil, fmt.Errorf("linux-firmware tree has no %s: %w", WhenceFile, err)
+	}
+	defer f.Close()
+
+	entries, err := ParseWhence(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", WhenceFile, err)
+	}
+	return NewIndex(dir, entries), nil
+}
+
+// NewIndex indexes WHENCE entries of the tree at dir
+func NewIndex(dir string, entries []Entry) *Index {
+	ix := &Index{
+		Dir:     dir,
+		Entries: entries,
+		drivers: make(map[string][]int),
+		owners:  make(map[string]int),
+		links:   make(map[string]string),
+	}
+	for i, e := range entries {
+		ix.drivers[e.Driver] = append(ix.drivers[e.Driver], i)
+		for _, f := range e.Files {
+			if _, ok := ix.owners[f]; !ok {
+				ix.owners[f] = i
+			}
+		}
+		for _, l := range e.Links {
+			if _, ok := ix.owners[l.Name]; !ok {
+				ix.owners[l.Name] = i
+			}
+			ix.links[l.Name] = l.Target
+		}
+	}
+	return ix
+}
+
+// Drivers returns the driver names in the index, sorted
+func (ix *Index) Drivers() []string {
+	names := make([]string, 0, len(ix.drivers))
+	for name := range ix.drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Owner returns the entry a firmware file or link belongs to
+func (ix *Index) Owner(name string) (*Entry, bool) {
+	i, ok := ix.owners[name]
+	if !ok {
+		return nil, false
+	}
+	return &ix.Entries[i], true
+}
+
+// Match returns the indexed files and links matching a path or glob pattern
+func (ix *Index) Match(pattern string) []string {
+	if _, ok := ix.owners[pattern]; ok {
+		return []string{pattern}
+	}
+	var matches []string
+	for name := range ix.owners {
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// LicenseFiles returns the licence files an entry's licence refers to that
+// exist in the tree
+func (ix *Index) LicenseFiles(e *Entry) []string {
+	var files []string
+	for _, name := range licenseFileRe.FindAllString(e.License, -1) {
+		name = strings.TrimRight(name, ".")
+		if containsString(files, name) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(ix.Dir, name)); err == nil {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// containsString reports whether list includes s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/bitswalk/ldf/src/common/logs"
 	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
 	"github.com/bitswalk/ldf/src/ldfd/db"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
 )
@@ -295,22 +296,24 @@ func GetRecommendedKernelOptions(config *db.DistributionConfig, arch db.TargetAr
 		options["CONFIG_SYSVIPC"] = "y"
 	}
 
+	// Resource management options
+	if strings.EqualFold(config.System.Resources.Manager, "cgroups") {
+		options["CONFIG_CGROUPS"] = "y"
+		options["CONFIG_MEMCG"] = "y"
+		options["CONFIG_BLK_CGROUP"] = "y"
+		options["CONFIG_CGROUP_SCHED"] = "y"
+		options["CONFIG_FAIR_GROUP_SCHED"] = "y"
+		options["CONFIG_CGROUP_PIDS"] = "y"
+		options["CONFIG_CGROUP_FREEZER"] = "y"
+		options["CONFIG_CGROUP_CPUACCT"] = "y"
+		options["CONFIG_CGROUP_DEVICE"] = "y"
+		options["CONFIG_CGROUP_BPF"] = "y"
+		options["CONFIG_CPUSETS"] = "y"
+	}
+
 	// Security options
-	secSystem := config.Security.System
-	switch strings.ToLower(secSystem) {
-	case "selinux":
-		options["CONFIG_SECURITY"] = "y"
-		options["CONFIG_SECURITY_NETWORK"] = "y"
-		options["CONFIG_SECURITY_SELINUX"] = "y"
-		options["CONFIG_SECURITY_SELINUX_BOOTPARAM"] = "y"
-		options["CONFIG_AUDIT"] = "y"
-		options["CONFIG_AUDITSYSCALL"] = "y"
-	case "apparmor":
-		options["CONFIG_SECURITY"] = "y"
-		options["CONFIG_SECURITY_NETWORK"] = "y"
-		options["CONFIG_SECURITY_APPARMOR"] = "y"
-		options["CONFIG_SECURITY_APPARMOR_BOOTPARAM_VALUE"] = "1"
-		options["CONFIG_AUDIT"] = "y"
+	for key, value := range SecurityOptions(config.Security.System) {
+		options[key] = value
 	}
 
 	// Virtualization options
@@ -360,9 +363,51 @@ func GetRecommendedKernelOptions(config *db.DistributionConfig, arch db.TargetAr
 	options["CONFIG_BLK_DEV"] = "y"
 	options["CONFIG_BLK_DEV_LOOP"] = "y"
 
+	// Cloud images boot on the provider's virtual disks and NICs
+	if cloud.Enabled(config) {
+		if profile, err := cloud.ProfileFor(cloud.Settings(config).Provider); err == nil {
+			for key, value := range profile.KernelOptions {
+				options[key] = value
+			}
+		}
+	}
+
 	return options
 }
 
+// SecurityOptions returns the kernel options of a security system. SELinux
+// labels live in extended attributes, so the read-only filesystems of live
+// and dm-verity images must keep them.
+func SecurityOptions(system string) map[string]string {
+	options := make(map[string]string)
+	for _, key := range RequiredSecurityOptions(system) {
+		options[key] = "y"
+	}
+	switch strings.ToLower(system) {
+	case "selinux":
+		options["CONFIG_SECURITY_SELINUX_BOOTPARAM"] = "y"
+		options["CONFIG_AUDITSYSCALL"] = "y"
+		options["CONFIG_SQUASHFS_XATTR"] = "y"
+		options["CONFIG_EROFS_FS_XATTR"] = "y"
+		options["CONFIG_EROFS_FS_SECURITY"] = "y"
+	case "apparmor":
+		options["CONFIG_SECURITY_APPARMOR_BOOTPARAM_VALUE"] = "1"
+	}
+	return options
+}
+
+// RequiredSecurityOptions returns the options a kernel must have built in
+// for the security system to load its policy at boot
+func RequiredSecurityOptions(system string) []string {
+	switch strings.ToLower(system) {
+	case "selinux":
+		return []string{"CONFIG_SECURITY", "CONFIG_SECURITY_NETWORK", "CONFIG_SECURITY_SELINUX", "CONFIG_AUDIT"}
+	case "apparmor":
+		return []string{"CONFIG_SECURITY", "CONFIG_SECURITY_NETWORK", "CONFIG_SECURITYFS", "CONFIG_SECURITY_APPARMOR", "CONFIG_AUDIT"}
+	}
+	return nil
+}
+
 // ParseConfigFile parses a kernel .config file into a map
 func ParseConfigFile(path string) (map[string]string, error) {
 	file, err := os.Open(path)
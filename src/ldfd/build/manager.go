@@ -3,7 +3,9 @@ package build
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -11,10 +13,15 @@ import (
 	"github.com/bitswalk/ldf/src/ldfd/db"
 	"github.com/bitswalk/ldf/src/ldfd/download"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
+	"github.com/spf13/viper"
 )
 
 var log = logs.NewDefault()
 
+// ErrBuilderImageBusy is returned when a builder image build is already
+// running for the requested architecture
+var ErrBuilderImageBusy = errors.New("builder image build already in progress")
+
 // SetLogger sets the logger for the build package
 func SetLogger(l *logs.Logger) {
 	if l != nil {
@@ -30,6 +37,10 @@ type Config struct {
 	ContainerRuntime string        // Container runtime: podman, docker, nerdctl, or chroot
 	RetryDelay       time.Duration // Base delay between retries
 	MaxRetries       int           // Default max retries per job
+	Version          string        // ldfd version recorded in build provenance
+	RegistryUsername string        // Credentials for pushing OCI images to registries
+	RegistryPassword string
+	PublicURL        string // URL clients such as network-booted machines reach ldfd at
 }
 
 // DefaultConfig returns sensible default configuration
@@ -54,14 +65,20 @@ type Manager struct {
 	componentRepo    *db.ComponentRepository
 	sourceRepo       *db.SourceRepository
 	boardProfileRepo *db.BoardProfileRepository
+	updateBundleRepo *db.UpdateBundleRepository
+	deltaRepo        *db.BuildDeltaRepository
 	downloadManager  *download.Manager
 	config           Config
 	stages           []Stage
+	signer           Signer
+	secureBoot       SecureBootProvider
+	diskKeys         DiskKeyProvider
 
-	jobQueue    chan *db.BuildJob
-	cancelFuncs map[string]context.CancelFunc
-	mu          sync.RWMutex
-	wg          sync.WaitGroup
+	jobQueue      chan *db.BuildJob
+	cancelFuncs   map[string]context.CancelFunc
+	builderImages map[db.TargetArch]*BuilderImage
+	mu            sync.RWMutex
+	wg            sync.WaitGroup
 
 	running bool
 	ctx     context.Context
@@ -100,10 +117,13 @@ func NewManager(database *db.Database, storageBackend storage.Backend,
 		componentRepo:    db.NewComponentRepository(database),
 		sourceRepo:       db.NewSourceRepository(database),
 		boardProfileRepo: db.NewBoardProfileRepository(database),
+		updateBundleRepo: db.NewUpdateBundleRepository(database),
+		deltaRepo:        db.NewBuildDeltaRepository(database),
 		downloadManager:  downloadMgr,
 		config:           cfg,
 		jobQueue:         make(chan *db.BuildJob, cfg.Workers*2),
 		cancelFuncs:      make(map[string]context.CancelFunc),
+		builderImages:    make(map[db.TargetArch]*BuilderImage),
 	}
 
 	return m
@@ -325,11 +345,170 @@ func (m *Manager) BuildJobRepo() *db.BuildJobRepository {
 	return m.buildJobRepo
 }
 
+// UpdateBundleRepo returns the update bundle repository
+func (m *Manager) UpdateBundleRepo() *db.UpdateBundleRepository {
+	return m.updateBundleRepo
+}
+
+// DeltaRepo returns the build delta repository
+func (m *Manager) DeltaRepo() *db.BuildDeltaRepository {
+	return m.deltaRepo
+}
+
 // DistRepo returns the distribution repository
 func (m *Manager) DistRepo() *db.DistributionRepository {
 	return m.distRepo
 }
 
+// liveBuilderConfig returns the container runtime and builder image from
+// the live settings, falling back to the manager configuration
+func (m *Manager) liveBuilderConfig() (RuntimeType, string) {
+	runtimeName := viper.GetString("build.container_runtime")
+	if runtimeName == "" {
+		runtimeName = m.config.ContainerRuntime
+	}
+	image := viper.GetString("build.container_image")
+	if image == "" {
+		image = m.config.ContainerImage
+	}
+	return RuntimeType(runtimeName), image
+}
+
+// StartBuilderImageBuild builds the builder image variant for a target
+// architecture in the background and returns its initial state
+func (m *Manager) StartBuilderImageBuild(arch db.TargetArch, noCache bool) (*BuilderImage, error) {
+	runtime, baseImage := m.liveBuilderConfig()
+	if !runtime.IsContainerRuntime() {
+		return nil, fmt.Errorf("builder images require a container runtime (current: %s)", runtime)
+	}
+
+	m.mu.Lock()
+	if current, ok := m.builderImages[arch]; ok && current.Status == BuilderImageBuilding {
+		m.mu.Unlock()
+		return nil, ErrBuilderImageBusy
+	}
+	now := time.Now()
+	img := &BuilderImage{
+		TargetArch: arch,
+		Image:      BuilderImageTag(baseImage, arch),
+		Status:     BuilderImageBuilding,
+		StartedAt:  &now,
+	}
+	m.builderImages[arch] = img
+	snapshot := *img
+	ctx := m.ctx
+	m.mu.Unlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	log.Info("Builder image build started", "image", img.Image, "arch", arch, "runtime", runtime)
+
+	go m.runBuilderImageBuild(ctx, BuilderImageBuildOpts{
+		Runtime:    runtime,
+		BaseImage:  baseImage,
+		TargetArch: arch,
+		NoCache:    noCache,
+	})
+
+	return &snapshot, nil
+}
+
+// runBuilderImageBuild builds a builder image, runs the toolchain preflight
+// against it and records the outcome
+func (m *Manager) runBuilderImageBuild(ctx context.Context, opts BuilderImageBuildOpts) {
+	result, err := BuildBuilderImage(ctx, opts)
+	if err == nil {
+		result.MissingTools, err = m.builderImagePreflight(ctx, opts.Runtime, result.Digest, opts.TargetArch)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	img := m.builderImages[opts.TargetArch]
+	now := time.Now()
+	img.CompletedAt = &now
+
+	if err != nil {
+		img.Status = BuilderImageFailed
+		img.ErrorMessage = err.Error()
+		log.Error("Builder image build failed", "image", img.Image, "error", err)
+		return
+	}
+
+	img.Status = BuilderImageReady
+	img.Digest = result.Digest
+	img.MissingTools = result.MissingTools
+	log.Info("Builder image build completed",
+		"image", img.Image,
+		"digest", img.Digest,
+		"missing_tools", img.MissingTools,
+	)
+}
+
+// builderImagePreflight reports the toolchain binaries missing from a builder
+// image for both supported toolchains
+func (m *Manager) builderImagePreflight(ctx context.Context, runtime RuntimeType, image string, arch db.TargetArch) ([]string, error) {
+	tc, err := GetToolchain(DetectHostArch(), arch)
+	if err != nil {
+		return nil, err
+	}
+
+	executor, err := NewExecutor(runtime, image, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, toolchain := range []db.ToolchainType{db.ToolchainGCC, db.ToolchainLLVM} {
+		deps := GetToolchainDeps(toolchain, tc.CrossCompilePrefix)
+		tools, err := CheckBuilderImageTools(ctx, executor, image, "", deps)
+		if err != nil {
+			return nil, err
+		}
+		for _, tool := range tools {
+			if !slices.Contains(missing, tool) {
+				missing = append(missing, tool)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// ListBuilderImages returns the state of the builder image variant for each
+// supported target architecture
+func (m *Manager) ListBuilderImages(ctx context.Context) []BuilderImage {
+	runtime, baseImage := m.liveBuilderConfig()
+
+	images := make([]BuilderImage, 0, 2)
+	for _, arch := range []db.TargetArch{db.ArchX86_64, db.ArchAARCH64} {
+		m.mu.RLock()
+		tracked, ok := m.builderImages[arch]
+		var img BuilderImage
+		if ok {
+			img = *tracked
+		}
+		m.mu.RUnlock()
+
+		if !ok {
+			img = BuilderImage{
+				TargetArch: arch,
+				Image:      BuilderImageTag(baseImage, arch),
+				Status:     BuilderImageMissing,
+			}
+			if runtime.IsContainerRuntime() {
+				if digest, err := ImageDigest(ctx, runtime, img.Image); err == nil {
+					img.Digest = digest
+					img.Status = BuilderImageReady
+				}
+			}
+		}
+		images = append(images, img)
+	}
+	return images
+}
+
 // registerCancel registers a cancel function for a build
 func (m *Manager) registerCancel(buildID string, cancel context.CancelFunc) {
 	m.mu.Lock()
@@ -0,0 +1,366 @@
+// Package oci writes OCI image layouts from a root filesystem and pushes them to container registries.
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build/archive"
+)
+
+// Media types of the documents and blobs in an image
+const (
+	MediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// AnnotationRefName names a manifest in the layout index
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+	// AnnotationCreated records when an image was created
+	AnnotationCreated = "org.opencontainers.image.created"
+
+	layoutVersion = "1.0.0"
+)
+
+// Descriptor references a blob by digest
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Platform is the platform an image runs on
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// Manifest is an OCI image manifest
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Index is the entry point of an image layout
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// ImageConfig is the OCI image configuration
+type ImageConfig struct {
+	Created      time.Time       `json:"created"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Config       ContainerConfig `json:"config"`
+	RootFS       RootFS          `json:"rootfs"`
+	History      []HistoryEntry  `json:"history,omitempty"`
+}
+
+// ContainerConfig holds the runtime defaults of containers started from
+// an image
+type ContainerConfig struct {
+	Entrypoint []string          `json:"Entrypoint,omitempty"`
+	Env        []string          `json:"Env,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+	StopSignal string            `json:"StopSignal,omitempty"`
+}
+
+// RootFS lists the uncompressed digests of an image's layers
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// HistoryEntry describes how a layer was created
+type HistoryEntry struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// Options describe the image WriteLayout builds
+type Options struct {
+	Architecture string // OCI architecture name, e.g. amd64
+	Entrypoint   []string
+	Env          []string
+	Labels       map[string]string
+	StopSignal   string
+	CreatedBy    string // Recorded in the layer history
+	Tag          string // Reference name of the manifest in the layout index
+
+	// Created is the image creation time. When Reproducible is set, file
+	// modification times later than Created are clamped to it.
+	Created      time.Time
+	Reproducible bool
+
+	// ExcludeContents lists rootfs directories whose contents are left out
+	// of the layer. The directories themselves are kept.
+	ExcludeContents []string
+}
+
+// Image is an image written to a layout directory
+type Image struct {
+	Dir      string
+	Manifest Descriptor
+	Config   Descriptor
+	Layers   []Descriptor
+}
+
+// Blobs returns the config and layer descriptors, the blobs a registry
+// needs before it accepts the manifest
+func (img *Image) Blobs() []Descriptor {
+	return append([]Descriptor{img.Config}, img.Layers...)
+}
+
+// BlobPath returns the path of a blob in the layout
+func (img *Image) BlobPath(digest string) string {
+	return blobPath(img.Dir, digest)
+}
+
+func blobPath(dir, digest string) string {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	return filepath.Join(dir, "blobs", algorithm, encoded)
+}
+
+// WriteLayout writes a single-layer image of rootfs as an OCI image layout
+// in dir
+func WriteLayout(dir, rootfs string, opts Options) (*Image, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create layout: %w", err)
+	}
+
+	layer, diffID, err := writeLayer(dir, rootfs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	created := opts.Created.UTC()
+	config := ImageConfig{
+		Created:      created,
+		Architecture: opts.Architecture,
+		OS:           "linux",
+		Config: ContainerConfig{
+			Entrypoint: opts.Entrypoint,
+			Env:        opts.Env,
+			Labels:     opts.Labels,
+			StopSignal: opts.StopSignal,
+		},
+		RootFS:  RootFS{Type: "layers", DiffIDs: []string{diffID}},
+		History: []HistoryEntry{{Created: created, CreatedBy: opts.CreatedBy}},
+	}
+	configDesc, err := writeJSONBlob(dir, MediaTypeConfig, config)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        configDesc,
+		Layers:        []Descriptor{layer},
+		Annotations:   map[string]string{AnnotationCreated: created.Format(time.RFC3339)},
+	}
+	manifestDesc, err := writeJSONBlob(dir, MediaTypeManifest, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	indexDesc := manifestDesc
+	indexDesc.Platform = &Platform{Architecture: opts.Architecture, OS: "linux"}
+	if opts.Tag != "" {
+		indexDesc.Annotations = map[string]string{AnnotationRefName: opts.Tag}
+	}
+	index := Index{SchemaVersion: 2, MediaType: MediaTypeIndex, Manifests: []Descriptor{indexDesc}}
+	if err := writeJSON(filepath.Join(dir, "index.json"), index); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(dir, "oci-layout"), map[string]string{"imageLayoutVersion": layoutVersion}); err != nil {
+		return nil, err
+	}
+
+	return &Image{Dir: dir, Manifest: manifestDesc, Config: configDesc, Layers: manifest.Layers}, nil
+}
+
+// Open reads the first image of the layout in dir
+func Open(dir string) (*Image, error) {
+	var index Index
+	if err := readJSON(filepath.Join(dir, "index.json"), &index); err != nil {
+		return nil, err
+	}
+	if len(index.Manifests) == 0 {
+		return nil, fmt.Errorf("image layout has no manifests")
+	}
+
+	img := &Image{Dir: dir, Manifest: index.Manifests[0]}
+	img.Manifest.Platform = nil
+	img.Manifest.Annotations = nil
+
+	var manifest Manifest
+	if err := readJSON(blobPath(dir, img.Manifest.Digest), &manifest); err != nil {
+		return nil, err
+	}
+	img.Config = manifest.Config
+	img.Layers = manifest.Layers
+	return img, nil
+}
+
+// Archive writes the layout in dir as a tar archive, the form
+// `podman load` and `skopeo copy oci-archive:` accept
+func Archive(w io.Writer, dir string, mtime time.Time) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read layout: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, path := range files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: filepath.ToSlash(rel), ModTime: mtime, Mode: 0644, Typeflag: tar.TypeReg, Size: info.Size()}
+		if info.IsDir() {
+			hdr.Name += "/"
+			hdr.Mode = 0755
+			hdr.Typeflag = tar.TypeDir
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		if err := copyFileTo(tw, path); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+	}
+	return tw.Close()
+}
+
+// writeLayer writes rootfs as a gzip-compressed layer blob and returns its
+// descriptor and the digest of the uncompressed tar stream
+func writeLayer(dir, rootfs string, opts Options) (Descriptor, string, error) {
+	tmp, err := os.CreateTemp(filepath.Join(dir, "blobs", "sha256"), ".layer-")
+	if err != nil {
+		return Descriptor{}, "", fmt.Errorf("failed to create layer: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	compressed := &countingHash{Hash: sha256.New()}
+	gz := gzip.NewWriter(io.MultiWriter(tmp, compressed))
+	uncompressed := sha256.New()
+	tarOpts := archive.Options{ExcludeContents: opts.ExcludeContents}
+	if opts.Reproducible {
+		tarOpts.ClampMtime = opts.Created
+	}
+	if err := archive.WriteTar(io.MultiWriter(gz, uncompressed), rootfs, tarOpts); err != nil {
+		return Descriptor{}, "", fmt.Errorf("failed to write layer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return Descriptor{}, "", fmt.Errorf("failed to compress layer: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Descriptor{}, "", fmt.Errorf("failed to write layer: %w", err)
+	}
+
+	desc := Descriptor{
+		MediaType: MediaTypeLayer,
+		Digest:    "sha256:" + hex.EncodeToString(compressed.Sum(nil)),
+		Size:      compressed.n,
+	}
+	if err := os.Rename(tmp.Name(), blobPath(dir, desc.Digest)); err != nil {
+		return Descriptor{}, "", fmt.Errorf("failed to store layer: %w", err)
+	}
+	return desc, "sha256:" + hex.EncodeToString(uncompressed.Sum(nil)), nil
+}
+
+// writeJSONBlob stores v as a blob and returns its descriptor
+func writeJSONBlob(dir, mediaType string, v interface{}) (Descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	sum := sha256.Sum256(data)
+	desc := Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	if err := os.WriteFile(blobPath(dir, desc.Digest), data, 0644); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to write blob: %w", err)
+	}
+	return desc, nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// countingHash hashes and counts the bytes written to it
+type countingHash struct {
+	hash.Hash
+	n int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	n, err := c.Hash.Write(p)
+	c.n += int64(n)
+	return n, err
+}
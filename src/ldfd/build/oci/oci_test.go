@@ -0,0 +1,204 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func testRootfs(t *testing.T) string {
+	t.Helper()
+	rootfs := t.TempDir()
+	for path, content := range map[string]string{
+		"etc/os-release":            "NAME=LDF\n",
+		"usr/bin/sh":                "#!binary",
+		"boot/vmlinuz":              "kernel",
+		"usr/lib/modules/6.12/a.ko": "module",
+	} {
+		full := filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(rootfs, "bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(rootfs, "usr/bin/sh"), filepath.Join(rootfs, "usr/bin/ash")); err != nil {
+		t.Fatal(err)
+	}
+	return rootfs
+}
+
+func testOptions() Options {
+	return Options{
+		Architecture:    "amd64",
+		Entrypoint:      []string{"/sbin/init"},
+		Env:             []string{"PATH=/usr/bin"},
+		Labels:          map[string]string{"io.ldf.build.id": "build-1"},
+		Tag:             "1.0",
+		Created:         time.Unix(1700000000, 0),
+		Reproducible:    true,
+		ExcludeContents: []string{"boot", "usr/lib/modules"},
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	dir := t.TempDir()
+	img, err := WriteLayout(dir, testRootfs(t), testOptions())
+	if err != nil {
+		t.Fatalf("WriteLayout() error = %v", err)
+	}
+
+	// Every descriptor must match its blob
+	for _, desc := range append(img.Blobs(), img.Manifest) {
+		data, err := os.ReadFile(img.BlobPath(desc.Digest))
+		if err != nil {
+			t.Fatalf("blob %s: %v", desc.Digest, err)
+		}
+		sum := sha256.Sum256(data)
+		if "sha256:"+hex.EncodeToString(sum[:]) != desc.Digest || int64(len(data)) != desc.Size {
+			t.Errorf("blob %s does not match its descriptor", desc.Digest)
+		}
+	}
+
+	var config ImageConfig
+	if err := readJSON(img.BlobPath(img.Config.Digest), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Architecture != "amd64" || config.OS != "linux" || config.Config.Labels["io.ldf.build.id"] != "build-1" {
+		t.Errorf("config = %+v", config)
+	}
+
+	// The diff ID is the digest of the uncompressed layer
+	layerFile, err := os.Open(img.BlobPath(img.Layers[0].Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layerFile.Close()
+	gz, err := gzip.NewReader(layerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(layer)
+	if config.RootFS.DiffIDs[0] != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("diff ID %s does not match the layer", config.RootFS.DiffIDs[0])
+	}
+
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(bytes.NewReader(layer))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = hdr
+	}
+	for _, name := range []string{"boot/", "etc/os-release", "usr/lib/modules/", "usr/bin/ash", "usr/bin/sh"} {
+		if entries[name] == nil {
+			t.Errorf("layer is missing %s", name)
+		}
+	}
+	for _, name := range []string{"boot/vmlinuz", "usr/lib/modules/6.12/", "usr/lib/modules/6.12/a.ko"} {
+		if entries[name] != nil {
+			t.Errorf("layer contains excluded %s", name)
+		}
+	}
+	if hdr := entries["bin"]; hdr == nil || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "usr/bin" {
+		t.Errorf("bin = %+v, want symlink to usr/bin", hdr)
+	}
+	if hdr := entries["usr/bin/sh"]; hdr.Typeflag != tar.TypeLink || hdr.Linkname != "usr/bin/ash" {
+		t.Errorf("usr/bin/sh = %+v, want hard link to usr/bin/ash", hdr)
+	}
+	if hdr := entries["etc/os-release"]; hdr.ModTime.After(time.Unix(1700000000, 0)) {
+		t.Errorf("modification time %v was not clamped", hdr.ModTime)
+	}
+
+	opened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if opened.Manifest.Digest != img.Manifest.Digest || opened.Config.Digest != img.Config.Digest {
+		t.Errorf("Open() = %+v, want %+v", opened, img)
+	}
+}
+
+func TestWriteLayout_Reproducible(t *testing.T) {
+	rootfs := testRootfs(t)
+	first, err := WriteLayout(t.TempDir(), rootfs, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := WriteLayout(t.TempDir(), rootfs, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Manifest.Digest != second.Manifest.Digest {
+		t.Errorf("manifest digests differ: %s, %s", first.Manifest.Digest, second.Manifest.Digest)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	img, err := WriteLayout(dir, testRootfs(t), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Archive(&buf, dir, time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name == "index.json" {
+			var index Index
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				t.Fatal(err)
+			}
+			if index.Manifests[0].Digest != img.Manifest.Digest || index.Manifests[0].Annotations[AnnotationRefName] != "1.0" {
+				t.Errorf("index = %+v", index)
+			}
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("archive members are not sorted: %v", names)
+	}
+	for _, want := range []string{"oci-layout", "index.json", "blobs/sha256/" + img.Manifest.Digest[len("sha256:"):]} {
+		found := false
+		for _, name := range names {
+			found = found || name == want
+		}
+		if !found {
+			t.Errorf("archive is missing %s", want)
+		}
+	}
+}
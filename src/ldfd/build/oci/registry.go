@@ -0,0 +1,262 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// tagPattern is the set of valid image tags
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidTag reports whether tag can name an image in a registry
+func ValidTag(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+// ParseRepository splits a repository reference such as
+// registry.example.com/team/base into its registry host and name
+func ParseRepository(repository string) (host, name string, err error) {
+	host, name, ok := strings.Cut(repository, "/")
+	if !ok || host == "" || name == "" || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return "", "", fmt.Errorf("repository %q must include the registry host", repository)
+	}
+	if strings.ContainsAny(name, ":@") {
+		return "", "", fmt.Errorf("repository %q must not include a tag or digest", repository)
+	}
+	return host, name, nil
+}
+
+// Registry pushes images over the OCI distribution API
+type Registry struct {
+	Username  string
+	Password  string
+	PlainHTTP bool // Use HTTP instead of HTTPS, for local registries
+	Client    *http.Client
+
+	authorization string
+}
+
+// Push uploads the image's blobs, then tags its manifest with every tag.
+// Blobs the registry already has are skipped.
+func (r *Registry) Push(ctx context.Context, img *Image, repository string, tags []string) error {
+	host, name, err := ParseRepository(repository)
+	if err != nil {
+		return err
+	}
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	base := &url.URL{Scheme: scheme, Host: host}
+
+	if err := r.authenticate(ctx, base, name); err != nil {
+		return err
+	}
+
+	for _, blob := range img.Blobs() {
+		if err := r.pushBlob(ctx, base, name, img.BlobPath(blob.Digest), blob); err != nil {
+			return fmt.Errorf("failed to push blob %s: %w", blob.Digest, err)
+		}
+	}
+
+	manifest, err := os.ReadFile(img.BlobPath(img.Manifest.Digest))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	for _, tag := range tags {
+		u := base.ResolveReference(&url.URL{Path: "/v2/" + name + "/manifests/" + tag})
+		resp, err := r.do(ctx, http.MethodPut, u.String(), MediaTypeManifest, bytes.NewReader(manifest), int64(len(manifest)))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			return fmt.Errorf("failed to push manifest %s:%s: %s", name, tag, resp.Status)
+		}
+	}
+	return nil
+}
+
+// pushBlob uploads a blob in a single monolithic request
+func (r *Registry) pushBlob(ctx context.Context, base *url.URL, name, path string, blob Descriptor) error {
+	u := base.ResolveReference(&url.URL{Path: "/v2/" + name + "/blobs/" + blob.Digest})
+	resp, err := r.do(ctx, http.MethodHead, u.String(), "", nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	u = base.ResolveReference(&url.URL{Path: "/v2/" + name + "/blobs/uploads/"})
+	resp, err = r.do(ctx, http.MethodPost, u.String(), "", nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to start upload: %s", resp.Status)
+	}
+	location, err := u.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("registry returned no upload location")
+	}
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	resp, err = r.do(ctx, http.MethodPut, location.String(), "application/octet-stream", f, blob.Size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload: %s", resp.Status)
+	}
+	return nil
+}
+
+// authenticate probes the registry and, when it challenges, obtains the
+// credentials every later request carries. Basic challenges use the
+// configured credentials directly; bearer challenges exchange them for a
+// push token scoped to the repository.
+func (r *Registry) authenticate(ctx context.Context, base *url.URL, name string) error {
+	u := base.ResolveReference(&url.URL{Path: "/v2/"})
+	resp, err := r.do(ctx, http.MethodGet, u.String(), "", nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+	default:
+		return fmt.Errorf("registry %s is not an OCI registry: %s", base.Host, resp.Status)
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.Username == "" {
+			return fmt.Errorf("registry %s requires credentials", base.Host)
+		}
+		r.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(r.Username+":"+r.Password))
+		return nil
+	case "bearer":
+		return r.fetchToken(ctx, params, "repository:"+name+":pull,push")
+	default:
+		return fmt.Errorf("registry %s uses unsupported authentication %q", base.Host, scheme)
+	}
+}
+
+// fetchToken requests a bearer token from the realm of a challenge
+func (r *Registry) fetchToken(ctx context.Context, params map[string]string, scope string) error {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("registry returned an invalid token realm")
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("invalid registry token response: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return fmt.Errorf("registry returned an empty token")
+	}
+	r.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// do sends a request carrying the current authorization
+func (r *Registry) do(ctx context.Context, method, target, contentType string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func (r *Registry) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return http.DefaultClient
+}
+
+// parseChallenge splits a WWW-Authenticate header into its scheme and
+// parameters
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return scheme, params
+}
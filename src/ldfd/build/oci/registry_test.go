@@ -0,0 +1,173 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry is an in-memory registry implementing the parts of the
+// distribution API pushes use
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	auth      func(r *http.Request) bool
+	challenge string
+}
+
+func newTestRegistry() *testRegistry {
+	return &testRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.auth != nil && !reg.auth(r) {
+		w.Header().Set("WWW-Authenticate", reg.challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodHead && strings.Contains(path, "/blobs/sha256:"):
+		if _, ok := reg.blobs[path[strings.LastIndex(path, "/")+1:]]; ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/blobs/uploads/"):
+		reg.uploads++
+		w.Header().Set("Location", fmt.Sprintf("%s%d?state=abc", path, reg.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && strings.Contains(path, "/blobs/uploads/"):
+		data, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(data)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		if r.URL.Query().Get("state") != "abc" || r.URL.Query().Get("digest") != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[digest] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && strings.Contains(path, "/manifests/"):
+		data, _ := io.ReadAll(r.Body)
+		var manifest Manifest
+		if r.Header.Get("Content-Type") != MediaTypeManifest || json.Unmarshal(data, &manifest) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, desc := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+			if _, ok := reg.blobs[desc.Digest]; !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		reg.manifests[path] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPush(t *testing.T) {
+	reg := newTestRegistry()
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	img, err := WriteLayout(t.TempDir(), testRootfs(t), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	r := &Registry{PlainHTTP: true}
+	if err := r.Push(context.Background(), img, host+"/ldf/base", []string{"1.0", "latest"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if len(reg.blobs) != 2 {
+		t.Errorf("registry has %d blobs, want 2", len(reg.blobs))
+	}
+	for _, tag := range []string{"1.0", "latest"} {
+		if reg.manifests["/v2/ldf/base/manifests/"+tag] == nil {
+			t.Errorf("tag %s was not pushed", tag)
+		}
+	}
+
+	// Blobs already present are not uploaded again
+	uploads := reg.uploads
+	if err := r.Push(context.Background(), img, host+"/ldf/base", []string{"1.0"}); err != nil {
+		t.Fatalf("second Push() error = %v", err)
+	}
+	if reg.uploads != uploads {
+		t.Errorf("second push uploaded %d blobs", reg.uploads-uploads)
+	}
+}
+
+func TestPush_BearerToken(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "ci" || pass != "secret" || r.URL.Query().Get("scope") != "repository:ldf/base:pull,push" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "push-token"})
+	}))
+	defer tokens.Close()
+
+	reg := newTestRegistry()
+	reg.auth = func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer push-token" }
+	reg.challenge = fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, tokens.URL)
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	img, err := WriteLayout(t.TempDir(), testRootfs(t), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	r := &Registry{Username: "ci", Password: "secret", PlainHTTP: true}
+	if err := r.Push(context.Background(), img, host+"/ldf/base", []string{"1.0"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	r = &Registry{Username: "ci", Password: "wrong", PlainHTTP: true}
+	if err := r.Push(context.Background(), img, host+"/ldf/base", []string{"1.0"}); err == nil {
+		t.Error("expected push with bad credentials to fail")
+	}
+}
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		host, name string
+		wantErr    bool
+	}{
+		{"registry.example.com/team/base", "registry.example.com", "team/base", false},
+		{"localhost:5000/base", "localhost:5000", "base", false},
+		{"localhost/base", "localhost", "base", false},
+		{"team/base", "", "", true},
+		{"registry.example.com/base:1.0", "", "", true},
+		{"registry.example.com", "", "", true},
+	}
+	for _, tt := range tests {
+		host, name, err := ParseRepository(tt.repository)
+		if (err != nil) != tt.wantErr || host != tt.host || name != tt.name {
+			t.Errorf("ParseRepository(%q) = %q, %q, %v", tt.repository, host, name, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/bitswalk/ldf/src/common/attestation"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// ProvenanceName is the file name signed provenance is stored under next to the image
+const ProvenanceName = "provenance.intoto.json"
+
+// builderID identifies ldfd as the SLSA builder
+const builderID = "https://github.com/bitswalk/ldf/ldfd"
+
+// StageTiming records how long a pipeline stage ran
+type StageTiming struct {
+	Stage      db.BuildStageName
+	StartedAt  time.Time
+	DurationMs int64
+}
+
+// provenanceRun captures the worker-side facts of a build that the stage
+// context does not carry
+type provenanceRun struct {
+	Runtime       RuntimeType
+	BuilderImage  string
+	BuilderDigest string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Stages        []StageTiming
+}
+
+// SetSigner sets the signer used for build attestations. Builds are left
+// unsigned when no signer is configured.
+func (m *Manager) SetSigner(s Signer) {
+	m.signer = s
+}
+
+// buildProvenance assembles the SLSA provenance statement for a completed build
+func buildProvenance(job *db.BuildJob, sc *StageContext, run provenanceRun, version string) *attestation.Statement {
+	configSum := sha256.Sum256([]byte(job.ConfigSnapshot))
+
+	internal := map[string]interface{}{
+		"executor_runtime": string(run.Runtime),
+	}
+	if run.BuilderImage != "" {
+		internal["builder_image"] = run.BuilderImage
+		internal["builder_image_digest"] = run.BuilderDigest
+	}
+	if sc.SourceDateEpoch != 0 {
+		internal["source_date_epoch"] = sc.SourceDateEpoch
+	}
+
+	var deps []attestation.ResourceDescriptor
+	for _, c := range sc.Components {
+		dep := attestation.ResourceDescriptor{
+			Name: c.Component.Name,
+			URI:  c.SourceURL,
+			Annotations: map[string]interface{}{
+				"version":       c.Version,
+				"artifact_path": c.ArtifactPath,
+			},
+		}
+		if c.SourceChecksum != "" {
+			dep.Digest = map[string]string{"sha256": c.SourceChecksum}
+		}
+		deps = append(deps, dep)
+	}
+
+	var stages []attestation.ResourceDescriptor
+	for _, t := range run.Stages {
+		stages = append(stages, attestation.ResourceDescriptor{
+			Name: "stage:" + string(t.Stage),
+			Annotations: map[string]interface{}{
+				"started_on":  t.StartedAt.UTC().Format(time.RFC3339),
+				"duration_ms": t.DurationMs,
+			},
+		})
+	}
+
+	return &attestation.Statement{
+		Type: attestation.StatementType,
+		Subject: []attestation.Subject{{
+			Name:   path.Base(sc.ArtifactPath),
+			Digest: map[string]string{"sha256": sc.ArtifactChecksum},
+		}},
+		PredicateType: attestation.PredicateSLSAProvenance,
+		Predicate: attestation.Provenance{
+			BuildDefinition: attestation.BuildDefinition{
+				BuildType: attestation.BuildTypeLDF,
+				ExternalParameters: map[string]interface{}{
+					"distribution_id": job.DistributionID,
+					"target_arch":     string(job.TargetArch),
+					"image_format":    string(job.ImageFormat),
+					"config_sha256":   hex.EncodeToString(configSum[:]),
+				},
+				InternalParameters:   internal,
+				ResolvedDependencies: deps,
+			},
+			RunDetails: attestation.RunDetails{
+				Builder: attestation.Builder{
+					ID:      builderID,
+					Version: map[string]string{"ldfd": version},
+				},
+				Metadata: attestation.BuildMetadata{
+					InvocationID: job.ID,
+					StartedOn:    run.StartedAt.UTC().Format(time.RFC3339),
+					FinishedOn:   run.FinishedAt.UTC().Format(time.RFC3339),
+				},
+				Byproducts: stages,
+			},
+		},
+	}
+}
+
+// publishProvenance signs the provenance statement of a completed build and
+// uploads the envelope next to the image
+func (w *Worker) publishProvenance(ctx context.Context, job *db.BuildJob, sc *StageContext, run provenanceRun) error {
+	statement := buildProvenance(job, sc, run, w.manager.config.Version)
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to encode provenance: %w", err)
+	}
+
+	envelope, err := w.manager.signer.Sign(attestation.PayloadTypeInToto, payload)
+	if err != nil {
+		return fmt.Errorf("failed to sign provenance: %w", err)
+	}
+
+	data, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode attestation: %w", err)
+	}
+
+	key := path.Join(path.Dir(sc.ArtifactPath), ProvenanceName)
+	if err := w.manager.storage.Upload(ctx, key, bytes.NewReader(data), int64(len(data)), attestation.PayloadTypeInToto); err != nil {
+		return fmt.Errorf("failed to upload attestation: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestBuildProvenance(t *testing.T) {
+	job := &db.BuildJob{
+		ID:             "build-1",
+		DistributionID: "dist-1",
+		TargetArch:     db.ArchX86_64,
+		ImageFormat:    db.ImageFormatRaw,
+		ConfigSnapshot: `{"core":{}}`,
+	}
+	sc := &StageContext{
+		ArtifactPath:     "distribution/owner/dist-1/builds/build-1/disk.img",
+		ArtifactChecksum: "abc123",
+		Components: []ResolvedComponent{
+			{Component: db.Component{Name: "linux-kernel"}, Version: "6.6.1",
+				SourceURL: "https://cdn.kernel.org/linux-6.6.1.tar.xz", SourceChecksum: "def456"},
+		},
+	}
+	start := time.Unix(1700000000, 0)
+	run := provenanceRun{
+		Runtime:       RuntimePodman,
+		BuilderImage:  "ldf-builder:latest",
+		BuilderDigest: "sha256:feed",
+		StartedAt:     start,
+		FinishedAt:    start.Add(time.Minute),
+		Stages:        []StageTiming{{Stage: "compile", StartedAt: start, DurationMs: 1200}},
+	}
+
+	st := buildProvenance(job, sc, run, "1.2.3")
+
+	if len(st.Subject) != 1 || st.Subject[0].Name != "disk.img" || st.Subject[0].Digest["sha256"] != "abc123" {
+		t.Errorf("unexpected subject %+v", st.Subject)
+	}
+	if _, err := st.VerifySubject("abc123"); err != nil {
+		t.Error(err)
+	}
+
+	def := st.Predicate.BuildDefinition
+	if def.ExternalParameters["config_sha256"] == "" {
+		t.Error("expected config snapshot hash")
+	}
+	if def.InternalParameters["builder_image_digest"] != "sha256:feed" {
+		t.Errorf("unexpected builder digest %v", def.InternalParameters["builder_image_digest"])
+	}
+	if len(def.ResolvedDependencies) != 1 || def.ResolvedDependencies[0].Digest["sha256"] != "def456" {
+		t.Errorf("unexpected dependencies %+v", def.ResolvedDependencies)
+	}
+
+	details := st.Predicate.RunDetails
+	if details.Builder.Version["ldfd"] != "1.2.3" {
+		t.Errorf("unexpected builder version %v", details.Builder.Version)
+	}
+	if details.Metadata.InvocationID != "build-1" {
+		t.Errorf("unexpected invocation id %s", details.Metadata.InvocationID)
+	}
+	if len(details.Byproducts) != 1 || details.Byproducts[0].Name != "stage:compile" {
+		t.Errorf("unexpected stage timings %+v", details.Byproducts)
+	}
+}
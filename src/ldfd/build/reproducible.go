@@ -0,0 +1,233 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/google/uuid"
+	"golang.org/x/sys/unix"
+)
+
+// RootfsManifestName is the artifact name of the rootfs manifest uploaded
+// alongside images built in reproducible mode
+const RootfsManifestName = "rootfs-manifest.json"
+
+// sourceDateEpochBase is the lower bound for derived SOURCE_DATE_EPOCH values
+// (2020-01-01T00:00:00Z), keeping derived timestamps in a plausible range
+const sourceDateEpochBase int64 = 1577836800
+
+// ErrNotReproducible is returned when verifying a build that was not
+// produced in reproducible mode
+var ErrNotReproducible = errors.New("build was not produced in reproducible mode")
+
+// reproducibleNamespace scopes deterministic UUIDs generated by ldfd
+var reproducibleNamespace = uuid.MustParse("6b1f6c1e-4f3a-5d2b-9a57-3c0e2f8d4b10")
+
+// ManifestEntry describes a single path in an assembled rootfs
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// SourceDateEpoch returns the SOURCE_DATE_EPOCH for a configuration.
+// An explicit value in the build options wins; otherwise the epoch is
+// derived from a hash of the configuration so identical configurations
+// always produce identical timestamps.
+func SourceDateEpoch(config *db.DistributionConfig) int64 {
+	if config.Build.SourceDateEpoch > 0 {
+		return config.Build.SourceDateEpoch
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return sourceDateEpochBase
+	}
+	sum := sha256.Sum256(data)
+	return sourceDateEpochBase + int64(binary.BigEndian.Uint32(sum[:4])%(5*365*24*3600))
+}
+
+// DeterministicUUID returns a UUID derived from the epoch and a purpose
+// label, e.g. "root" or "esp", so filesystem and partition identifiers are
+// stable across rebuilds of the same configuration
+func DeterministicUUID(epoch int64, label string) string {
+	return uuid.NewSHA1(reproducibleNamespace, []byte(strconv.FormatInt(epoch, 10)+"/"+label)).String()
+}
+
+// DeterministicVolumeID returns a FAT volume serial derived from the epoch
+// and a purpose label, formatted for mkfs.fat -i
+func DeterministicVolumeID(epoch int64, label string) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(epoch, 10) + "/" + label))
+	return hex.EncodeToString(sum[:4])
+}
+
+// ReproducibleEnv returns the environment variables that pin timestamps
+// and build identity for reproducible builds
+func ReproducibleEnv(epoch int64) map[string]string {
+	return map[string]string{
+		"SOURCE_DATE_EPOCH":      strconv.FormatInt(epoch, 10),
+		"KBUILD_BUILD_TIMESTAMP": time.Unix(epoch, 0).UTC().Format(time.UnixDate),
+		"KBUILD_BUILD_USER":      "ldf",
+		"KBUILD_BUILD_HOST":      "ldf",
+		"KBUILD_BUILD_VERSION":   "1",
+		"E2FSPROGS_FAKE_TIME":    strconv.FormatInt(epoch, 10),
+		"TZ":                     "UTC",
+		"LC_ALL":                 "C",
+	}
+}
+
+// NormalizeTree clamps ownership and mtimes of every path under root so the
+// tree hashes identically across rebuilds. Ownership is only reset when
+// running as root, as unprivileged builds cannot change it.
+func NormalizeTree(root string, epoch int64) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(epoch * 1e9), unix.NsecToTimespec(epoch * 1e9)}
+	chown := os.Geteuid() == 0
+
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if chown {
+			if err := os.Lchown(path, 0, 0); err != nil {
+				return fmt.Errorf("failed to reset ownership of %s: %w", path, err)
+			}
+		}
+		if d.IsDir() {
+			// Directory mtimes change as children are touched, so set them last
+			dirs = append(dirs, path)
+			return nil
+		}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return fmt.Errorf("failed to reset mtime of %s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, dirs[i], ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return fmt.Errorf("failed to reset mtime of %s: %w", dirs[i], err)
+		}
+	}
+	return nil
+}
+
+// BuildManifest walks root in lexical order and records the mode, size,
+// content hash and link target of every path
+func BuildManifest(root string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := ManifestEntry{
+			Path: filepath.ToSlash(rel),
+			Mode: info.Mode().String(),
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if entry.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			if entry.SHA256, err = hashFile(path); err != nil {
+				return err
+			}
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// WriteManifest writes manifest entries as JSON to path
+func WriteManifest(path string, entries []ManifestEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadManifest decodes manifest entries from r
+func ReadManifest(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// DiffManifests returns the sorted list of paths that were added, removed
+// or changed between two manifests
+func DiffManifests(a, b []ManifestEntry) []string {
+	index := make(map[string]ManifestEntry, len(a))
+	for _, e := range a {
+		index[e.Path] = e
+	}
+
+	var diff []string
+	for _, e := range b {
+		prev, ok := index[e.Path]
+		if !ok || prev != e {
+			diff = append(diff, e.Path)
+		}
+		delete(index, e.Path)
+	}
+	for path := range index {
+		diff = append(diff, path)
+	}
+
+	sort.Strings(diff)
+	return diff
+}
+
+// hashFile returns the hex-encoded SHA256 of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,120 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	config := &db.DistributionConfig{
+		Core:  db.CoreConfig{Bootloader: "grub"},
+		Build: db.BuildConfig{Reproducible: true},
+	}
+
+	first := SourceDateEpoch(config)
+	if first < sourceDateEpochBase {
+		t.Errorf("derived epoch %d is before base %d", first, sourceDateEpochBase)
+	}
+	if again := SourceDateEpoch(config); again != first {
+		t.Errorf("expected stable epoch, got %d then %d", first, again)
+	}
+
+	changed := *config
+	changed.Core.Bootloader = "systemd-boot"
+	if SourceDateEpoch(&changed) == first {
+		t.Error("expected a different configuration to derive a different epoch")
+	}
+
+	config.Build.SourceDateEpoch = 1700000000
+	if got := SourceDateEpoch(config); got != 1700000000 {
+		t.Errorf("expected explicit epoch 1700000000, got %d", got)
+	}
+}
+
+func TestDeterministicUUID(t *testing.T) {
+	a := DeterministicUUID(1700000000, "root")
+	if a != DeterministicUUID(1700000000, "root") {
+		t.Error("expected identical inputs to produce identical UUIDs")
+	}
+	if a == DeterministicUUID(1700000000, "esp") {
+		t.Error("expected different labels to produce different UUIDs")
+	}
+	if a == DeterministicUUID(1700000001, "root") {
+		t.Error("expected different epochs to produce different UUIDs")
+	}
+
+	if id := DeterministicVolumeID(1700000000, "esp"); len(id) != 8 {
+		t.Errorf("expected 8 hex digit volume ID, got %q", id)
+	}
+}
+
+func TestNormalizeTree(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "hostname"), []byte("ldf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("hostname", filepath.Join(root, "etc", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	const epoch = 1700000000
+	if err := NormalizeTree(root, epoch); err != nil {
+		t.Fatalf("NormalizeTree failed: %v", err)
+	}
+
+	for _, rel := range []string{".", "etc", "etc/hostname", "etc/link"} {
+		info, err := os.Lstat(filepath.Join(root, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ModTime().Unix() != epoch {
+			t.Errorf("%s: expected mtime %d, got %d", rel, epoch, info.ModTime().Unix())
+		}
+	}
+}
+
+func TestManifestDiff(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "b"), []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := BuildManifest(root)
+	if err != nil {
+		t.Fatalf("BuildManifest failed: %v", err)
+	}
+	if len(DiffManifests(before, before)) != 0 {
+		t.Error("expected identical manifests to have no differences")
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "b"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "c"), []byte("three"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := BuildManifest(root)
+	if err != nil {
+		t.Fatalf("BuildManifest failed: %v", err)
+	}
+
+	got := DiffManifests(before, after)
+	want := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffManifests = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cdxSerialNamespace scopes the serial numbers of generated CycloneDX BOMs
+var cdxSerialNamespace = uuid.MustParse("0d5d2c1a-8f5e-5b7a-9c43-6e1f4a2b7d90")
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp"`
+	Tools      cdxTools      `json:"tools"`
+	Component  cdxComponent  `json:"component"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Type               string                 `json:"type"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Description        string                 `json:"description,omitempty"`
+	PURL               string                 `json:"purl,omitempty"`
+	Hashes             []cdxHash              `json:"hashes,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty          `json:"properties,omitempty"`
+	Pedigree           *cdxPedigree           `json:"pedigree,omitempty"`
+}
+
+type cdxPedigree struct {
+	Patches []cdxPatch `json:"patches"`
+}
+
+type cdxPatch struct {
+	Type string  `json:"type"`
+	Diff cdxDiff `json:"diff"`
+}
+
+type cdxDiff struct {
+	URL string `json:"url"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// GenerateCycloneDX renders a CycloneDX 1.5 JSON document
+func GenerateCycloneDX(in *Input) ([]byte, error) {
+	imageRef := "image:" + in.BuildID
+	image := cdxComponent{
+		BOMRef:  imageRef,
+		Type:    "operating-system",
+		Name:    in.imageName(),
+		Version: in.BuildID,
+		Properties: []cdxProperty{
+			{Name: "ldf:target_arch", Value: in.TargetArch},
+			{Name: "ldf:image_format", Value: in.ImageFormat},
+		},
+	}
+	if in.ImageSHA256 != "" {
+		image.Hashes = []cdxHash{{Alg: "SHA-256", Content: in.ImageSHA256}}
+	}
+
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.NewSHA1(cdxSerialNamespace, []byte(in.BuildID)).String(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: in.Created.UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{
+				{Type: "application", Name: "ldfd"},
+			}},
+			Component: image,
+			Properties: []cdxProperty{
+				{Name: "ldf:distribution_id", Value: in.DistributionID},
+				{Name: "ldf:build_id", Value: in.BuildID},
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	imageDeps := cdxDependency{Ref: imageRef}
+	var patches []cdxComponent
+	var deps []cdxDependency
+	seen := make(map[string]int)
+	for _, c := range in.Components {
+		ref := purl(c)
+		if n := seen[ref]; n > 0 {
+			ref = fmt.Sprintf("%s#%d", ref, n)
+		}
+		seen[ref]++
+
+		comp := cdxComponent{
+			BOMRef:      ref,
+			Type:        cdxComponentType(c),
+			Name:        c.Name,
+			Version:     c.Version,
+			Description: c.Description,
+			PURL:        purl(c),
+		}
+		if c.SHA256 != "" {
+			comp.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.SHA256}}
+		}
+		if c.SourceURL != "" {
+			refType := "distribution"
+			if c.RetrievalMethod == "git" {
+				refType = "vcs"
+			}
+			comp.ExternalReferences = []cdxExternalReference{{Type: refType, URL: c.SourceURL}}
+		}
+		if c.Category != "" {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "ldf:category", Value: c.Category})
+		}
+
+		// Patches are listed in the component's pedigree and, to carry
+		// their checksums, as file components it depends on
+		var patchDeps []string
+		for _, p := range c.Patches {
+			if comp.Pedigree == nil {
+				comp.Pedigree = &cdxPedigree{}
+			}
+			comp.Pedigree.Patches = append(comp.Pedigree.Patches, cdxPatch{Type: "unofficial", Diff: cdxDiff{URL: p.Name}})
+
+			patchRef := "patch:" + ref + "/" + p.Name
+			patches = append(patches, cdxComponent{
+				BOMRef:     patchRef,
+				Type:       "file",
+				Name:       p.Name,
+				Hashes:     cdxFileHashes(p),
+				Properties: []cdxProperty{{Name: "ldf:role", Value: "patch"}},
+			})
+			patchDeps = append(patchDeps, patchRef)
+		}
+		if len(patchDeps) > 0 {
+			deps = append(deps, cdxDependency{Ref: ref, DependsOn: patchDeps})
+		}
+
+		bom.Components = append(bom.Components, comp)
+		imageDeps.DependsOn = append(imageDeps.DependsOn, ref)
+	}
+	bom.Components = append(bom.Components, patches...)
+
+	if in.KernelConfig != nil {
+		ref := "file:" + in.KernelConfig.Name
+		bom.Components = append(bom.Components, cdxComponent{
+			BOMRef:     ref,
+			Type:       "file",
+			Name:       in.KernelConfig.Name,
+			Hashes:     cdxFileHashes(*in.KernelConfig),
+			Properties: []cdxProperty{{Name: "ldf:role", Value: "kernel-config"}},
+		})
+		imageDeps.DependsOn = append(imageDeps.DependsOn, ref)
+	}
+
+	bom.Dependencies = append([]cdxDependency{imageDeps}, deps...)
+
+	return json.MarshalIndent(bom, "", "  ")
+}
+
+// cdxFileHashes returns the hashes of a file
+func cdxFileHashes(f File) []cdxHash {
+	return []cdxHash{
+		{Alg: "SHA-1", Content: f.SHA1},
+		{Alg: "SHA-256", Content: f.SHA256},
+	}
+}
+
+// cdxComponentType maps an ldf component onto a CycloneDX component type
+func cdxComponentType(c Component) string {
+	switch {
+	case strings.Contains(strings.ToLower(c.Name), "kernel"):
+		return "operating-system"
+	case c.Category == "bootloader" || c.Category == "firmware":
+		return "firmware"
+	default:
+		return "application"
+	}
+}
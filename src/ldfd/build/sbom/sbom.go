@@ -0,0 +1,121 @@
+// Package sbom generates SPDX and CycloneDX software bills of materials for build artifacts.
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Format identifies an SBOM document format
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// Formats lists the supported SBOM formats in generation order
+var Formats = []Format{FormatSPDX, FormatCycloneDX}
+
+// ParseFormat validates an SBOM format name, defaulting to SPDX when empty
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "spdx", "spdx-json":
+		return FormatSPDX, nil
+	case "cyclonedx", "cdx", "cyclonedx-json":
+		return FormatCycloneDX, nil
+	default:
+		return "", fmt.Errorf("unsupported SBOM format: %s (supported: spdx, cyclonedx)", s)
+	}
+}
+
+// FileName returns the artifact name an SBOM format is stored under
+func (f Format) FileName() string {
+	if f == FormatCycloneDX {
+		return "sbom.cdx.json"
+	}
+	return "sbom.spdx.json"
+}
+
+// ContentType returns the media type of an SBOM format
+func (f Format) ContentType() string {
+	if f == FormatCycloneDX {
+		return "application/vnd.cyclonedx+json"
+	}
+	return "application/spdx+json"
+}
+
+// Input describes the build an SBOM is generated for
+type Input struct {
+	BuildID        string
+	DistributionID string
+	TargetArch     string
+	ImageFormat    string
+	ImageName      string // File name of the image artifact
+	ImageSHA256    string
+	Created        time.Time
+	Components     []Component
+	KernelConfig   *File // Kernel .config the image was built with, if any
+}
+
+// Component describes a source component that went into an image
+type Component struct {
+	Name            string
+	Version         string
+	Category        string
+	Description     string
+	SourceURL       string // Upstream URL the source was retrieved from
+	SHA256          string // Checksum of the downloaded source archive
+	RetrievalMethod string // "release" or "git"
+	Patches         []File // Patches applied to the source, in application order
+}
+
+// File describes a configuration file that influenced the build
+type File struct {
+	Name   string
+	SHA1   string
+	SHA256 string
+}
+
+// Generate renders the SBOM for in in the requested format
+func Generate(format Format, in *Input) ([]byte, error) {
+	switch format {
+	case FormatSPDX:
+		return GenerateSPDX(in)
+	case FormatCycloneDX:
+		return GenerateCycloneDX(in)
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format: %s", format)
+	}
+}
+
+// purl returns a package URL for a component, using the GitHub type when
+// the source is hosted there and the generic type otherwise
+func purl(c Component) string {
+	name := url.PathEscape(strings.ToLower(c.Name))
+	version := url.PathEscape(c.Version)
+
+	if u, err := url.Parse(c.SourceURL); err == nil && u.Host == "github.com" {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) >= 2 {
+			return fmt.Sprintf("pkg:github/%s/%s@%s",
+				strings.ToLower(parts[0]), strings.ToLower(strings.TrimSuffix(parts[1], ".git")), version)
+		}
+	}
+
+	p := fmt.Sprintf("pkg:generic/%s@%s", name, version)
+	if c.SourceURL != "" {
+		p += "?download_url=" + url.QueryEscape(c.SourceURL)
+	}
+	return p
+}
+
+// imageName returns the name used for the image package
+func (in *Input) imageName() string {
+	if in.ImageName != "" {
+		return in.ImageName
+	}
+	return "ldf-image"
+}
@@ -0,0 +1,206 @@
+package sbom
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testInput() *Input {
+	return &Input{
+		BuildID:        "build-1",
+		DistributionID: "dist-1",
+		TargetArch:     "x86_64",
+		ImageFormat:    "raw",
+		ImageName:      "disk.img",
+		ImageSHA256:    "aa",
+		Created:        time.Unix(1700000000, 0),
+		Components: []Component{
+			{Name: "linux-kernel", Version: "6.6.1", Category: "core", SourceURL: "https://cdn.kernel.org/pub/linux/kernel/v6.x/linux-6.6.1.tar.xz", SHA256: "bb", RetrievalMethod: "release"},
+			{Name: "systemd", Version: "255", Category: "init", SourceURL: "https://github.com/systemd/systemd.git", SHA256: "cc", RetrievalMethod: "git"},
+		},
+		KernelConfig: &File{Name: "kernel/.config", SHA1: "dd", SHA256: "ee"},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{"", FormatSPDX, false},
+		{"spdx", FormatSPDX, false},
+		{"CycloneDX", FormatCycloneDX, false},
+		{"cdx", FormatCycloneDX, false},
+		{"swid", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateSPDX(t *testing.T) {
+	data, err := GenerateSPDX(testInput())
+	if err != nil {
+		t.Fatalf("GenerateSPDX failed: %v", err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if doc.SPDXVersion != "SPDX-2.3" {
+		t.Errorf("expected SPDX-2.3, got %s", doc.SPDXVersion)
+	}
+	if doc.CreationInfo.Created != "2023-11-14T22:13:20Z" {
+		t.Errorf("unexpected created timestamp %s", doc.CreationInfo.Created)
+	}
+	// Image package plus one per component
+	if len(doc.Packages) != 3 {
+		t.Fatalf("expected 3 packages, got %d", len(doc.Packages))
+	}
+	if doc.Packages[1].DownloadLocation != "https://cdn.kernel.org/pub/linux/kernel/v6.x/linux-6.6.1.tar.xz" {
+		t.Errorf("unexpected download location %s", doc.Packages[1].DownloadLocation)
+	}
+	if len(doc.Files) != 1 || doc.Files[0].FileName != "./kernel/.config" {
+		t.Errorf("expected kernel config file entry, got %+v", doc.Files)
+	}
+	// DESCRIBES + two GENERATED_FROM + kernel config
+	if len(doc.Relationships) != 4 {
+		t.Errorf("expected 4 relationships, got %d", len(doc.Relationships))
+	}
+}
+
+func TestGenerateSPDX_DuplicateNames(t *testing.T) {
+	in := testInput()
+	in.Components = []Component{
+		{Name: "firmware", Version: "1"},
+		{Name: "firmware", Version: "2"},
+		{Name: "firmware", Version: "3"},
+		{Name: "firmware-1", Version: "4"},
+	}
+	data, err := GenerateSPDX(in)
+	if err != nil {
+		t.Fatalf("GenerateSPDX failed: %v", err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, pkg := range doc.Packages {
+		if ids[pkg.SPDXID] {
+			t.Errorf("duplicate SPDXID %s", pkg.SPDXID)
+		}
+		ids[pkg.SPDXID] = true
+	}
+	if len(ids) != 5 {
+		t.Errorf("expected 5 distinct SPDXIDs, got %d", len(ids))
+	}
+}
+
+func TestGenerateCycloneDX(t *testing.T) {
+	data, err := GenerateCycloneDX(testInput())
+	if err != nil {
+		t.Fatalf("GenerateCycloneDX failed: %v", err)
+	}
+
+	var bom cdxBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.5" {
+		t.Errorf("unexpected format %s %s", bom.BOMFormat, bom.SpecVersion)
+	}
+	if !strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		t.Errorf("unexpected serial number %s", bom.SerialNumber)
+	}
+	// Two components plus the kernel config file
+	if len(bom.Components) != 3 {
+		t.Fatalf("expected 3 components, got %d", len(bom.Components))
+	}
+	if bom.Components[1].PURL != "pkg:github/systemd/systemd@255" {
+		t.Errorf("unexpected purl %s", bom.Components[1].PURL)
+	}
+	if bom.Components[1].ExternalReferences[0].Type != "vcs" {
+		t.Errorf("expected vcs reference for git source, got %s", bom.Components[1].ExternalReferences[0].Type)
+	}
+	if len(bom.Dependencies) != 1 || len(bom.Dependencies[0].DependsOn) != 3 {
+		t.Errorf("expected image to depend on 3 refs, got %+v", bom.Dependencies)
+	}
+}
+
+func TestGenerate_Patches(t *testing.T) {
+	in := testInput()
+	in.Components[0].Patches = []File{
+		{Name: "patches/linux-kernel/0001-fix.patch", SHA1: "p1", SHA256: "p256"},
+	}
+
+	data, err := GenerateSPDX(in)
+	if err != nil {
+		t.Fatalf("GenerateSPDX failed: %v", err)
+	}
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	var patchID string
+	for _, f := range doc.Files {
+		if f.FileName == "./patches/linux-kernel/0001-fix.patch" {
+			patchID = f.SPDXID
+			if len(f.Checksums) != 2 || f.Checksums[1].ChecksumValue != "p256" {
+				t.Errorf("unexpected patch checksums %+v", f.Checksums)
+			}
+		}
+	}
+	if patchID == "" {
+		t.Fatalf("patch file missing from %+v", doc.Files)
+	}
+	found := false
+	for _, r := range doc.Relationships {
+		if r.SPDXElementID == patchID && r.RelationshipType == "PATCH_FOR" && r.RelatedSPDXElement == doc.Packages[1].SPDXID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected PATCH_FOR relationship, got %+v", doc.Relationships)
+	}
+
+	data, err = GenerateCycloneDX(in)
+	if err != nil {
+		t.Fatalf("GenerateCycloneDX failed: %v", err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	kernel := bom.Components[0]
+	if kernel.Pedigree == nil || len(kernel.Pedigree.Patches) != 1 || kernel.Pedigree.Patches[0].Diff.URL != "patches/linux-kernel/0001-fix.patch" {
+		t.Errorf("expected kernel pedigree patch, got %+v", kernel.Pedigree)
+	}
+	var patch *cdxComponent
+	for i := range bom.Components {
+		if bom.Components[i].Name == "patches/linux-kernel/0001-fix.patch" {
+			patch = &bom.Components[i]
+		}
+	}
+	if patch == nil || len(patch.Hashes) != 2 || patch.Hashes[1].Content != "p256" {
+		t.Errorf("expected patch file component with hashes, got %+v", patch)
+	}
+	if len(bom.Dependencies) != 2 || bom.Dependencies[1].Ref != kernel.BOMRef {
+		t.Errorf("expected kernel to depend on its patch, got %+v", bom.Dependencies)
+	}
+}
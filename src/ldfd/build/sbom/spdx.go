@@ -0,0 +1,187 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// spdxNamespaceBase prefixes the document namespace of generated SPDX documents
+const spdxNamespaceBase = "https://github.com/bitswalk/ldf/spdx"
+
+// spdxNoAssertion marks fields whose value ldfd cannot determine
+const spdxNoAssertion = "NOASSERTION"
+
+var spdxIDInvalid = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name                  string            `json:"name"`
+	SPDXID                string            `json:"SPDXID"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	CopyrightText         string            `json:"copyrightText"`
+	Description           string            `json:"description,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxFile struct {
+	FileName         string         `json:"fileName"`
+	SPDXID           string         `json:"SPDXID"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// GenerateSPDX renders an SPDX 2.3 JSON document
+func GenerateSPDX(in *Input) ([]byte, error) {
+	imageID := "SPDXRef-Image"
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              in.imageName(),
+		DocumentNamespace: fmt.Sprintf("%s/%s/%s", spdxNamespaceBase, in.DistributionID, in.BuildID),
+		CreationInfo: spdxCreationInfo{
+			Created:  in.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: ldfd", "Organization: LDF"},
+		},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: imageID},
+		},
+	}
+
+	image := spdxPackage{
+		Name:                  in.imageName(),
+		SPDXID:                imageID,
+		VersionInfo:           in.BuildID,
+		DownloadLocation:      spdxNoAssertion,
+		LicenseConcluded:      spdxNoAssertion,
+		LicenseDeclared:       spdxNoAssertion,
+		CopyrightText:         spdxNoAssertion,
+		Description:           fmt.Sprintf("%s %s image", in.TargetArch, in.ImageFormat),
+		PrimaryPackagePurpose: "OPERATING-SYSTEM",
+	}
+	if in.ImageSHA256 != "" {
+		image.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: in.ImageSHA256}}
+	}
+	doc.Packages = append(doc.Packages, image)
+
+	// Components sharing a name get numbered identifiers, skipping any
+	// already taken by a component named like a numbered one
+	seen := map[string]bool{imageID: true}
+	for _, c := range in.Components {
+		base := spdxID("SPDXRef-Package-", c.Name)
+		id := base
+		for n := 1; seen[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		seen[id] = true
+
+		pkg := spdxPackage{
+			Name:                  c.Name,
+			SPDXID:                id,
+			VersionInfo:           c.Version,
+			DownloadLocation:      spdxNoAssertion,
+			LicenseConcluded:      spdxNoAssertion,
+			LicenseDeclared:       spdxNoAssertion,
+			CopyrightText:         spdxNoAssertion,
+			Description:           c.Description,
+			PrimaryPackagePurpose: "SOURCE",
+			ExternalRefs: []spdxExternalRef{
+				{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl(c)},
+			},
+		}
+		if c.SourceURL != "" {
+			pkg.DownloadLocation = c.SourceURL
+		}
+		if c.SHA256 != "" {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: c.SHA256}}
+		}
+
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships,
+			spdxRelationship{SPDXElementID: imageID, RelationshipType: "GENERATED_FROM", RelatedSPDXElement: id})
+
+		for i, p := range c.Patches {
+			fileID := fmt.Sprintf("SPDXRef-File-%s-patch-%d", strings.TrimPrefix(id, "SPDXRef-Package-"), i+1)
+			doc.Files = append(doc.Files, spdxFile{
+				FileName:         "./" + p.Name,
+				SPDXID:           fileID,
+				Checksums:        spdxFileChecksums(p),
+				LicenseConcluded: spdxNoAssertion,
+				CopyrightText:    spdxNoAssertion,
+			})
+			doc.Relationships = append(doc.Relationships,
+				spdxRelationship{SPDXElementID: fileID, RelationshipType: "PATCH_FOR", RelatedSPDXElement: id})
+		}
+	}
+
+	if in.KernelConfig != nil {
+		fileID := "SPDXRef-File-kernel-config"
+		doc.Files = append(doc.Files, spdxFile{
+			FileName:         "./" + in.KernelConfig.Name,
+			SPDXID:           fileID,
+			Checksums:        spdxFileChecksums(*in.KernelConfig),
+			LicenseConcluded: spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+		})
+		doc.Relationships = append(doc.Relationships,
+			spdxRelationship{SPDXElementID: fileID, RelationshipType: "BUILD_DEPENDENCY_OF", RelatedSPDXElement: imageID})
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// spdxFileChecksums returns the checksums of a file; SPDX requires SHA1
+func spdxFileChecksums(f File) []spdxChecksum {
+	return []spdxChecksum{
+		{Algorithm: "SHA1", ChecksumValue: f.SHA1},
+		{Algorithm: "SHA256", ChecksumValue: f.SHA256},
+	}
+}
+
+// spdxID builds a valid SPDX element identifier from an arbitrary name
+func spdxID(prefix, name string) string {
+	return prefix + spdxIDInvalid.ReplaceAllString(name, "-")
+}
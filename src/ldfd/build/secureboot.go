@@ -0,0 +1,33 @@
+package build
+
+// SecureBootDir names the directory holding a build's decrypted Secure Boot
+// keys in the workspace, and its published enrollment files in storage
+const SecureBootDir = "secureboot"
+
+// SecureBootKeys locates the decrypted key material of a Secure Boot key set.
+// Paths point at PEM files inside Dir, which the worker removes when the
+// build finishes.
+type SecureBootKeys struct {
+	KeySetID  string
+	Dir       string
+	OwnerGUID string
+	PKKey     string
+	PKCert    string
+	KEKKey    string
+	KEKCert   string
+	DBKey     string
+	DBCert    string
+}
+
+// SecureBootProvider resolves Secure Boot key sets for builds
+type SecureBootProvider interface {
+	// Materialize writes the key set with the given ID (the active set when
+	// empty) into dir
+	Materialize(keySetID, dir string) (*SecureBootKeys, error)
+}
+
+// SetSecureBootProvider sets the key store used by builds with Secure Boot
+// enabled. Such builds fail when no provider is configured.
+func (m *Manager) SetSecureBootProvider(p SecureBootProvider) {
+	m.secureBoot = p
+}
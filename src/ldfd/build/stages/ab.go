@@ -0,0 +1,410 @@
+package stages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultDataSizeMB is the minimum /data size when none is configured
+	defaultDataSizeMB = 1024
+	// abBootDir is the ESP directory holding one kernel directory per slot
+	abBootDir = "ldf"
+)
+
+// abSlots are the root slot names, in partition order
+var abSlots = [2]string{"a", "b"}
+
+// slotPartLabel returns the GPT partition name of a root slot. Boot entries
+// and updaters find slots by name so the identifiers survive reinstalls.
+func slotPartLabel(slot string) string {
+	return "root_" + slot
+}
+
+// abLayout identifies the filesystems and partitions of an A/B image
+type abLayout struct {
+	rootFSUUID   [2]string
+	rootPartUUID [2]string
+	dataFSUUID   string
+	dataPartUUID string
+	espPartUUID  string
+	diskGUID     string
+}
+
+// newABLayout picks the image identifiers, deterministic for reproducible builds
+func newABLayout(epoch int64) *abLayout {
+	id := func(label string) string {
+		if epoch != 0 {
+			return build.DeterministicUUID(epoch, label)
+		}
+		return uuid.NewString()
+	}
+	return &abLayout{
+		rootFSUUID:   [2]string{id("rootfs-a"), id("rootfs-b")},
+		rootPartUUID: [2]string{id("root-a"), id("root-b")},
+		dataFSUUID:   id("data"),
+		dataPartUUID: id("data-part"),
+		espPartUUID:  id("esp"),
+		diskGUID:     id("disk"),
+	}
+}
+
+// ValidateUpdateConfig reports A/B and update bundle settings the image
+// layout cannot produce
+func ValidateUpdateConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	update := config.Update
+	if update.Bundle && !update.ABSlots {
+		return fmt.Errorf("update bundles require the A/B slot layout")
+	}
+	if !update.ABSlots {
+		return nil
+	}
+	if !isDiskImageFormat(format) {
+		return fmt.Errorf("A/B slot layout is not supported for %s images", strings.ToUpper(string(format)))
+	}
+	if config.Security.Verity.Enabled {
+		return fmt.Errorf("A/B slot layout cannot be combined with a dm-verity root")
+	}
+	// Each slot boots its own kernel from the shared ESP, selected by
+	// systemd-boot's default entry
+	if _, ok := GetBootloaderInstaller(config.Core.Bootloader, "", "").(*SystemdBootInstaller); !ok {
+		return fmt.Errorf("A/B slot layout requires the systemd-boot bootloader")
+	}
+	return nil
+}
+
+// abSlotSizeMB returns the configured slot size, or splits what an image
+// of totalMB leaves after the ESP and the minimum /data between two slots
+func abSlotSizeMB(cfg db.UpdateConfig, totalMB int) (int, error) {
+	dataMB := cfg.DataSizeMB
+	if dataMB <= 0 {
+		dataMB = defaultDataSizeMB
+	}
+	// 1 MiB alignment at the start plus the backup GPT at the end
+	free := totalMB - 2 - espSizeMB - dataMB
+
+	slotMB := cfg.SlotSizeMB
+	if slotMB <= 0 {
+		slotMB = free / 2
+	}
+	if slotMB <= 0 || 2*slotMB > free {
+		return 0, fmt.Errorf("image size %d MB cannot hold two %d MB root slots and %d MB of /data", totalMB, slotMB, dataMB)
+	}
+	return slotMB, nil
+}
+
+// generateAB creates a raw disk image with two root slots sharing an ESP
+// and a writable /data partition. Partitions: ESP, root_a, root_b, data.
+// Both slots start with the same root filesystem so either one boots.
+func (g *RawImageGenerator) generateAB(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	layout := newABLayout(sc.SourceDateEpoch)
+	totalMB := g.sizeGB * 1024
+
+	slotMB, err := abSlotSizeMB(sc.Config.Update, totalMB)
+	if err != nil {
+		return "", err
+	}
+	if needMB, err := rootfsImageSizeMB(sc.RootfsDir); err != nil {
+		return "", err
+	} else if needMB > slotMB {
+		return "", fmt.Errorf("root filesystem needs %d MB but root slots are %d MB", needMB, slotMB)
+	}
+
+	progress(5, "Preparing root filesystem for A/B slots")
+
+	if err := writeABFstab(sc.RootfsDir, layout); err != nil {
+		return "", fmt.Errorf("failed to write fstab: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(sc.RootfsDir, "data"), 0755); err != nil {
+		return "", fmt.Errorf("failed to create /data mount point: %w", err)
+	}
+
+	progress(10, "Creating partitioned disk image")
+
+	imagePath := filepath.Join(sc.OutputDir, "disk.img")
+	if err := g.createSparseImage(imagePath, totalMB); err != nil {
+		return "", fmt.Errorf("failed to create image: %w", err)
+	}
+	if err := createABPartitionTable(ctx, imagePath, sc.TargetArch, layout, slotMB); err != nil {
+		return "", fmt.Errorf("failed to create partitions: %w", err)
+	}
+
+	loopDev, err := g.setupLoopDevice(ctx, imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to setup loop device: %w", err)
+	}
+	defer func() {
+		if err := g.detachLoopDevice(ctx, loopDev); err != nil {
+			log.Warn("Failed to detach loop device", "device", loopDev, "error", err)
+		}
+	}()
+
+	// Slots are populated at mkfs time; nothing needs to be mounted
+	for i, slot := range abSlots {
+		progress(20+i*20, fmt.Sprintf("Writing root slot %s", strings.ToUpper(slot)))
+		dev := loopDev + "p" + strconv.Itoa(i+2)
+		if err := mkfsRootSlot(ctx, dev, slotPartLabel(slot), layout.rootFSUUID[i], sc.RootfsDir, sc.SourceDateEpoch); err != nil {
+			return "", fmt.Errorf("failed to write slot %s: %w", slot, err)
+		}
+	}
+
+	progress(60, "Formatting ESP and /data")
+
+	if err := formatABPartitions(ctx, loopDev, layout, sc.SourceDateEpoch); err != nil {
+		return "", fmt.Errorf("failed to format partitions: %w", err)
+	}
+
+	progress(70, "Installing bootloader to ESP")
+
+	espMount, err := os.MkdirTemp("", "ldf-esp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create mount point: %w", err)
+	}
+	defer os.RemoveAll(espMount)
+
+	if output, err := exec.CommandContext(ctx, "mount", loopDev+"p1", espMount).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("mount ESP failed: %s: %s", err, output)
+	}
+	mounted := true
+	defer func() {
+		if mounted {
+			if err := exec.CommandContext(ctx, "umount", espMount).Run(); err != nil {
+				log.Warn("Failed to unmount ESP", "mount_point", espMount, "error", err)
+			}
+		}
+	}()
+
+	if err := installABBoot(ctx, sc, espMount); err != nil {
+		return "", fmt.Errorf("failed to install bootloader: %w", err)
+	}
+
+	progress(85, "Syncing and unmounting")
+
+	if err := g.syncFilesystem(ctx, espMount); err != nil {
+		log.Warn("Failed to sync filesystem", "error", err)
+	}
+	if err := exec.CommandContext(ctx, "umount", espMount).Run(); err != nil {
+		return "", fmt.Errorf("failed to unmount ESP: %w", err)
+	}
+	mounted = false
+
+	progress(100, "A/B image created successfully")
+	return imagePath, nil
+}
+
+// writeABFstab drops the root entry, which differs per slot and comes from
+// the kernel command line, and adds the shared /data partition
+func writeABFstab(rootfsDir string, layout *abLayout) error {
+	fstabPath := filepath.Join(rootfsDir, "etc", "fstab")
+	data, err := os.ReadFile(fstabPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && (fields[1] == "/" || fields[1] == "/data") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines,
+		"",
+		"# Root is the booted A/B slot; /data is shared by both slots",
+		fmt.Sprintf("UUID=%s /data ext4 defaults,noatime 0 2", layout.dataFSUUID),
+	)
+
+	if err := os.MkdirAll(filepath.Dir(fstabPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fstabPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// createABPartitionTable lays out the ESP, both root slots and /data
+func createABPartitionTable(ctx context.Context, imagePath string, arch db.TargetArch, layout *abLayout, slotMB int) error {
+	rootType := "8300"
+	if types, ok := verityPartitionTypes[arch]; ok {
+		rootType = types[0]
+	}
+
+	args := []string{
+		"--zap-all",
+		"--new=1:2048:+" + strconv.Itoa(espSizeMB) + "M", "--typecode=1:EF00", "--change-name=1:ESP",
+		"--partition-guid=1:" + layout.espPartUUID,
+	}
+	for i, slot := range abSlots {
+		n := strconv.Itoa(i + 2)
+		args = append(args,
+			"--new="+n+":0:+"+strconv.Itoa(slotMB)+"M", "--typecode="+n+":"+rootType,
+			"--change-name="+n+":"+slotPartLabel(slot),
+			"--partition-guid="+n+":"+layout.rootPartUUID[i])
+	}
+	args = append(args,
+		"--new=4:0:0", "--typecode=4:8300", "--change-name=4:data",
+		"--partition-guid=4:"+layout.dataPartUUID,
+		"--disk-guid="+layout.diskGUID,
+		imagePath)
+
+	if output, err := exec.CommandContext(ctx, "sgdisk", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("sgdisk failed: %s: %s", err, output)
+	}
+	return nil
+}
+
+// mkfsRootSlot creates an ext4 filesystem populated from rootfsDir on a
+// slot partition or a pre-sized image file
+func mkfsRootSlot(ctx context.Context, target, label, fsUUID, rootfsDir string, epoch int64) error {
+	args := []string{"-L", label, "-F", "-U", fsUUID, "-d", rootfsDir}
+	if epoch != 0 {
+		args = append(args, "-E", "hash_seed="+fsUUID+",root_owner=0:0")
+	}
+	cmd := exec.CommandContext(ctx, "mkfs.ext4", append(args, target)...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.ext4 failed: %s: %s", err, output)
+	}
+	return nil
+}
+
+// formatABPartitions formats the ESP and the empty /data partition
+func formatABPartitions(ctx context.Context, loopDev string, layout *abLayout, epoch int64) error {
+	fatArgs := []string{"-F32", "-n", "ESP"}
+	if epoch != 0 {
+		fatArgs = append(fatArgs, "-i", build.DeterministicVolumeID(epoch, "esp"), "--invariant")
+	}
+	cmd := exec.CommandContext(ctx, "mkfs.fat", append(fatArgs, loopDev+"p1")...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.fat failed: %s: %s", err, output)
+	}
+
+	extArgs := []string{"-L", "data", "-F", "-U", layout.dataFSUUID}
+	if epoch != 0 {
+		extArgs = append(extArgs, "-E", "hash_seed="+layout.dataFSUUID+",root_owner=0:0")
+	}
+	cmd = exec.CommandContext(ctx, "mkfs.ext4", append(extArgs, loopDev+"p4")...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.ext4 failed: %s: %s", err, output)
+	}
+
+	return nil
+}
+
+// abKernelArgs returns the kernel arguments booting a slot. The root is
+// found by partition name, which the LDF init script resolves through sysfs.
+func abKernelArgs(slot string) string {
+	return fmt.Sprintf("root=PARTLABEL=%s rootfstype=ext4 rw quiet ldf.slot=%s", slotPartLabel(slot), slot)
+}
+
+// abEntryName returns the systemd-boot entry file of a slot. Updaters
+// switch slots with bootctl set-default on this name.
+func abEntryName(slot string) string {
+	return "ldf-" + slot + ".conf"
+}
+
+// installABBoot populates the ESP with systemd-boot, one kernel directory
+// and loader entry per slot, and a loader.conf defaulting to slot A
+func installABBoot(ctx context.Context, sc *build.StageContext, espDir string) error {
+	title := sc.DistName
+	if title == "" {
+		title = "LDF Linux"
+	}
+	_, err := os.Stat(filepath.Join(sc.RootfsDir, "boot", "initramfs.img"))
+	initramfs := err == nil
+
+	entriesDir := filepath.Join(espDir, "loader", "entries")
+	if err := os.MkdirAll(entriesDir, 0755); err != nil {
+		return err
+	}
+
+	for _, slot := range abSlots {
+		slotDir := filepath.Join(espDir, abBootDir, slot)
+		if err := os.MkdirAll(slotDir, 0755); err != nil {
+			return err
+		}
+		files := []string{"vmlinuz"}
+		if initramfs {
+			files = append(files, "initramfs.img")
+		}
+		for _, name := range files {
+			if err := copyFile(filepath.Join(sc.RootfsDir, "boot", name), filepath.Join(slotDir, name)); err != nil {
+				return fmt.Errorf("failed to install %s for slot %s: %w", name, slot, err)
+			}
+		}
+		if sc.SecureBoot != nil {
+			if err := signKernels(ctx, sc.SecureBoot, slotDir, sc.SourceDateEpoch); err != nil {
+				return fmt.Errorf("failed to sign kernel: %w", err)
+			}
+		}
+
+		entry := fmt.Sprintf("title %s (slot %s)\nlinux /%s/%s/vmlinuz\n", title, strings.ToUpper(slot), abBootDir, slot)
+		if initramfs {
+			entry += fmt.Sprintf("initrd /%s/%s/initramfs.img\n", abBootDir, slot)
+		}
+		entry += "options " + abKernelArgs(slot) + imageKernelArgs(sc) + "\n"
+		if err := os.WriteFile(filepath.Join(entriesDir, abEntryName(slot)), []byte(entry), 0644); err != nil {
+			return fmt.Errorf("failed to write boot entry: %w", err)
+		}
+	}
+
+	loaderConf := fmt.Sprintf("default %s\ntimeout 3\nconsole-mode max\neditor no\n", abEntryName(abSlots[0]))
+	if err := os.WriteFile(filepath.Join(espDir, "loader", "loader.conf"), []byte(loaderConf), 0644); err != nil {
+		return fmt.Errorf("failed to write loader.conf: %w", err)
+	}
+
+	if err := installSystemdBootBinary(sc, espDir); err != nil {
+		return err
+	}
+
+	if sc.SecureBoot != nil {
+		signed, err := signESP(ctx, sc.SecureBoot, espDir, sc.SourceDateEpoch)
+		if err != nil {
+			return fmt.Errorf("failed to sign EFI binaries: %w", err)
+		}
+		log.Info("Signed EFI binaries", "files", signed)
+	}
+
+	if sc.SourceDateEpoch != 0 {
+		if err := build.NormalizeTree(espDir, sc.SourceDateEpoch); err != nil {
+			return fmt.Errorf("failed to normalize ESP: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// rootfsImageSizeMB estimates the ext4 image size holding rootfsDir: its
+// content plus a quarter for metadata and free space, rounded up to MiB
+func rootfsImageSizeMB(rootfsDir string) (int, error) {
+	var total int64
+	err := filepath.Walk(rootfsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure root filesystem: %w", err)
+	}
+
+	return int((total*5/4+1<<20-1)>>20) + 64, nil
+}
@@ -0,0 +1,177 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateUpdateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  db.DistributionConfig
+		format  db.ImageFormat
+		wantErr string
+	}{
+		{
+			name:   "disabled",
+			config: db.DistributionConfig{},
+			format: db.ImageFormatISO,
+		},
+		{
+			name: "systemd-boot raw",
+			config: db.DistributionConfig{
+				Core:   db.CoreConfig{Bootloader: "systemd-boot"},
+				Update: db.UpdateConfig{ABSlots: true, Bundle: true},
+			},
+			format: db.ImageFormatRaw,
+		},
+		{
+			name:    "bundle without slots",
+			config:  db.DistributionConfig{Update: db.UpdateConfig{Bundle: true}},
+			format:  db.ImageFormatRaw,
+			wantErr: "require the A/B slot layout",
+		},
+		{
+			name: "iso",
+			config: db.DistributionConfig{
+				Core:   db.CoreConfig{Bootloader: "systemd-boot"},
+				Update: db.UpdateConfig{ABSlots: true},
+			},
+			format:  db.ImageFormatISO,
+			wantErr: "ISO",
+		},
+		{
+			name: "verity",
+			config: db.DistributionConfig{
+				Core:     db.CoreConfig{Bootloader: "systemd-boot"},
+				Security: db.SecurityConfig{Verity: db.VerityConfig{Enabled: true}},
+				Update:   db.UpdateConfig{ABSlots: true},
+			},
+			format:  db.ImageFormatRaw,
+			wantErr: "dm-verity",
+		},
+		{
+			name: "grub",
+			config: db.DistributionConfig{
+				Core:   db.CoreConfig{Bootloader: "grub2"},
+				Update: db.UpdateConfig{ABSlots: true},
+			},
+			format:  db.ImageFormatQCOW2,
+			wantErr: "systemd-boot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUpdateConfig(&tt.config, tt.format)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestABSlotSizeMB(t *testing.T) {
+	// 8 GB image: 8192 - 2 - 512 ESP - 1024 /data leaves 6654 MB for two slots
+	slot, err := abSlotSizeMB(db.UpdateConfig{}, 8192)
+	if err != nil {
+		t.Fatalf("abSlotSizeMB failed: %v", err)
+	}
+	if slot != 3327 {
+		t.Errorf("expected derived slot size 3327, got %d", slot)
+	}
+
+	slot, err = abSlotSizeMB(db.UpdateConfig{SlotSizeMB: 2048, DataSizeMB: 512}, 8192)
+	if err != nil || slot != 2048 {
+		t.Errorf("expected configured slot size 2048, got %d (%v)", slot, err)
+	}
+
+	if _, err := abSlotSizeMB(db.UpdateConfig{SlotSizeMB: 4096}, 8192); err == nil {
+		t.Error("expected error when two slots do not fit")
+	}
+}
+
+func TestWriteABFstab(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fstab := `UUID=ROOT_UUID   /              ext4     defaults,noatime     0       1
+proc             /proc          proc    defaults          0       0
+`
+	if err := os.WriteFile(filepath.Join(rootfs, "etc", "fstab"), []byte(fstab), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	layout := newABLayout(1700000000)
+	if err := writeABFstab(rootfs, layout); err != nil {
+		t.Fatalf("writeABFstab failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootfs, "etc", "fstab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if strings.Contains(got, "ROOT_UUID") {
+		t.Errorf("root entry should be dropped:\n%s", got)
+	}
+	if !strings.Contains(got, "proc") {
+		t.Errorf("unrelated entries should be kept:\n%s", got)
+	}
+	if !strings.Contains(got, "UUID="+layout.dataFSUUID+" /data ext4") {
+		t.Errorf("missing /data entry:\n%s", got)
+	}
+
+	if layout.rootFSUUID[0] == layout.rootFSUUID[1] || layout.rootPartUUID[0] == layout.rootPartUUID[1] {
+		t.Error("slots must not share identifiers")
+	}
+}
+
+func TestABKernelArgs(t *testing.T) {
+	args := abKernelArgs("b")
+	for _, want := range []string{"root=PARTLABEL=root_b", "rootfstype=ext4", "ldf.slot=b"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("kernel args %q missing %q", args, want)
+		}
+	}
+	if abEntryName("b") != "ldf-b.conf" {
+		t.Errorf("unexpected entry name %s", abEntryName("b"))
+	}
+}
+
+func TestBundleCompatible(t *testing.T) {
+	sc := &build.StageContext{
+		DistributionID: "dist-1",
+		Config:         &db.DistributionConfig{},
+	}
+	if got := bundleCompatible(sc); got != "dist-1" {
+		t.Errorf("expected distribution ID fallback, got %s", got)
+	}
+
+	sc.DistName = "edge-os"
+	if got := bundleCompatible(sc); got != "edge-os" {
+		t.Errorf("expected distribution name, got %s", got)
+	}
+
+	sc.BoardProfile = &db.BoardProfile{Name: "rpi4"}
+	if got := bundleCompatible(sc); got != "rpi4" {
+		t.Errorf("expected board profile name, got %s", got)
+	}
+
+	sc.Config.Update.Compatible = "acme-gateway-v2"
+	if got := bundleCompatible(sc); got != "acme-gateway-v2" {
+		t.Errorf("expected configured compatible string, got %s", got)
+	}
+}
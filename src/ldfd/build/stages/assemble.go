@@ -35,7 +35,22 @@ func (s *AssembleStage) Validate(ctx context.Context, sc *build.StageContext) er
 	if sc.Config == nil {
 		return fmt.Errorf("distribution config not set")
 	}
-	return nil
+	if err := ValidateInitramfsConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateSecurityConfig(sc.Config); err != nil {
+		return err
+	}
+	if err := ValidateLoggingConfig(sc.Config); err != nil {
+		return err
+	}
+	if err := ValidateResourceConfig(sc.Config); err != nil {
+		return err
+	}
+	if err := db.ValidateSystemSettings(sc.Config.Settings); err != nil {
+		return err
+	}
+	return ValidateBoardImageLayout(sc.Config, sc.BoardProfile, sc.ImageFormat)
 }
 
 // Execute assembles the root filesystem
@@ -82,9 +97,21 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 	}
 	progress(35, fmt.Sprintf("Init system (%s) installed", initInstaller.Name()))
 
+	// Step 3.5: Configure the system logger and resource management
+	progress(36, "Configuring logging and resource management")
+	if err := s.configureLogging(sc); err != nil {
+		return fmt.Errorf("failed to configure logging: %w", err)
+	}
+	if err := s.configureResources(sc); err != nil {
+		return fmt.Errorf("failed to configure resource management: %w", err)
+	}
+
 	// Step 4: Install bootloader (50%)
 	progress(37, "Installing bootloader")
 	bootloaderInstaller := GetBootloaderInstaller(sc.Config.Core.Bootloader, distName, distVersion)
+	if uboot, ok := bootloaderInstaller.(*UBootInstaller); ok {
+		uboot.SetBoard(sc.BoardProfile)
+	}
 	bootloaderComponent := s.findComponentByType(sc.Components, "bootloader")
 	if err := bootloaderInstaller.Install(sc.RootfsDir, bootloaderComponent); err != nil {
 		return fmt.Errorf("failed to install bootloader: %w", err)
@@ -94,6 +121,11 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 	if err := bootloaderInstaller.Configure(sc.RootfsDir, kernelVersion, sc.TargetArch, true); err != nil {
 		return fmt.Errorf("failed to configure bootloader: %w", err)
 	}
+	if args := imageKernelArgs(sc); args != "" {
+		if err := appendKernelArgs(sc.RootfsDir, args); err != nil {
+			return fmt.Errorf("failed to set kernel arguments: %w", err)
+		}
+	}
 	progress(50, fmt.Sprintf("Bootloader (%s) installed", bootloaderInstaller.Name()))
 
 	// Step 4.5: Apply board-specific configuration (55%)
@@ -112,9 +144,20 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 			return fmt.Errorf("failed to install board firmware: %w", err)
 		}
 
+		if err := s.installUBoot(sc); err != nil {
+			return err
+		}
+
 		progress(55, fmt.Sprintf("Board configuration applied: %s", sc.BoardProfile.DisplayName))
 	}
 
+	// Step 4.6: Install selected linux-firmware blobs and report modules
+	// whose firmware the image lacks
+	progress(55, "Installing firmware")
+	if err := s.installLinuxFirmware(sc); err != nil {
+		return fmt.Errorf("failed to install firmware: %w", err)
+	}
+
 	// Step 5: Install filesystem tools (60%)
 	progress(52, "Installing filesystem tools")
 	// Filesystem tools are optional (userspace)
@@ -128,8 +171,9 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 
 	// Step 6: Configure security framework (70%)
 	progress(62, "Configuring security framework")
-	securitySetup := GetSecuritySetup(sc.Config.Security.System)
-	securityComponent := s.findComponentByType(sc.Components, "security")
+	securitySetup := GetSecuritySetup(sc.Config.Security)
+	// Looked up by name: the reference policy shares the security category
+	securityComponent := s.findComponentByType(sc.Components, securitySetup.Name())
 	if err := securitySetup.Install(sc.RootfsDir, securityComponent); err != nil {
 		return fmt.Errorf("failed to install security framework: %w", err)
 	}
@@ -138,15 +182,41 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 	}
 	progress(70, fmt.Sprintf("Security framework (%s) configured", securitySetup.Name()))
 
+	// Step 6.5: Configure cloud-init for cloud images
+	if err := s.configureCloud(sc); err != nil {
+		return fmt.Errorf("failed to configure cloud-init: %w", err)
+	}
+
+	// Step 6.6: Embed the installer in live ISO images
+	if err := s.installInstaller(sc); err != nil {
+		return fmt.Errorf("failed to install live installer: %w", err)
+	}
+
 	// Step 7: Generate initramfs (80%)
-	progress(72, "Generating initramfs")
+	generator := initramfsGenerator(sc.Config)
+	progress(72, fmt.Sprintf("Generating initramfs (%s)", generator))
 	initramfsPath := filepath.Join(sc.RootfsDir, "boot", "initramfs.img")
-	initramfsGen := NewInitramfsGenerator(sc.RootfsDir, initramfsPath, sc.Config, sc.TargetArch)
-	if err := initramfsGen.Generate(); err != nil {
+	if generator == db.InitramfsGeneratorBuiltin {
+		initramfsGen := NewInitramfsGenerator(sc.RootfsDir, initramfsPath, sc.Config, sc.TargetArch)
+		initramfsGen.SetSourceDateEpoch(sc.SourceDateEpoch)
+		initramfsGen.SetNetboot(sc.ImageFormat == db.ImageFormatNetboot)
+		initramfsGen.SetLive(sc.ImageFormat == db.ImageFormatISO)
+		if sc.DiskKey != nil && sc.Config.Security.Encryption.Reencrypt {
+			initramfsGen.SetEncryptionKeyFile(sc.DiskKey.KeyFile)
+		}
+		if err := initramfsGen.Generate(ctx); err != nil {
+			return fmt.Errorf("failed to generate initramfs: %w", err)
+		}
+	} else if err := generateExternalInitramfs(ctx, sc, initramfsPath); err != nil {
 		return fmt.Errorf("failed to generate initramfs: %w", err)
 	}
 	progress(80, "Initramfs generated")
 
+	// Step 7.5: Stage the board's firmware boot partition
+	if err := s.stageRPiBootPartition(sc); err != nil {
+		return fmt.Errorf("failed to stage boot partition: %w", err)
+	}
+
 	// Step 8: Configure system files (90%)
 	progress(82, "Generating fstab")
 	if err := builder.GenerateFstab(); err != nil {
@@ -159,7 +229,7 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 	}
 
 	progress(86, "Configuring hostname")
-	if err := builder.GenerateHostname(""); err != nil {
+	if err := builder.GenerateHostname(sc.Config.Settings.Hostname); err != nil {
 		return fmt.Errorf("failed to configure hostname: %w", err)
 	}
 
@@ -168,6 +238,14 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 		return fmt.Errorf("failed to configure networking: %w", err)
 	}
 
+	progress(88, "Configuring locale, keymap and time zone")
+	if err := builder.ConfigureLocalization(); err != nil {
+		return fmt.Errorf("failed to configure localization: %w", err)
+	}
+	if err := builder.ConfigureTimeSync(); err != nil {
+		return fmt.Errorf("failed to configure time synchronization: %w", err)
+	}
+
 	progress(89, "Configuring root account")
 	if err := builder.ConfigureRootAccount(); err != nil {
 		return fmt.Errorf("failed to configure root account: %w", err)
@@ -180,6 +258,20 @@ func (s *AssembleStage) Execute(ctx context.Context, sc *build.StageContext, pro
 		return fmt.Errorf("rootfs validation failed: %w", err)
 	}
 
+	// Step 9.5: Compile the security policy and label the root filesystem
+	progress(93, "Applying security policy")
+	if err := s.applySecurityPolicy(ctx, sc); err != nil {
+		return fmt.Errorf("failed to apply security policy: %w", err)
+	}
+
+	// Step 10: Normalize ownership and timestamps for reproducible builds
+	if sc.SourceDateEpoch != 0 {
+		progress(95, "Normalizing rootfs timestamps and ownership")
+		if err := build.NormalizeTree(sc.RootfsDir, sc.SourceDateEpoch); err != nil {
+			return fmt.Errorf("failed to normalize rootfs: %w", err)
+		}
+	}
+
 	progress(100, "Root filesystem assembly complete")
 	return nil
 }
@@ -262,8 +354,9 @@ func (s *AssembleStage) applyBoardBootConfig(sc *build.StageContext) error {
 
 	bootParams := sc.BoardProfile.Config.BootParams
 
-	// Write config.txt for Raspberry Pi boards
-	if bootParams.ConfigTxt != "" {
+	// Write config.txt for Raspberry Pi boards; the rpi image layout writes
+	// it to the boot partition instead
+	if bootParams.ConfigTxt != "" && boardImageLayout(sc.BoardProfile) != db.BoardImageLayoutRPi {
 		configTxtPath := filepath.Join(sc.RootfsDir, "boot", "config.txt")
 		if err := os.WriteFile(configTxtPath, []byte(bootParams.ConfigTxt), 0644); err != nil {
 			return fmt.Errorf("failed to write config.txt: %w", err)
@@ -296,7 +389,7 @@ func (s *AssembleStage) installBoardFirmware(sc *build.StageContext) error {
 		if fw.Path == "" {
 			continue
 		}
-		destDir := filepath.Join(sc.RootfsDir, fw.Path)
+		destDir := filepath.Join(sc.RootfsDir, rpiFirmwareDir(sc.BoardProfile, fw.Path))
 		if err := os.MkdirAll(destDir, 0755); err != nil {
 			return fmt.Errorf("failed to create firmware directory %s: %w", fw.Path, err)
 		}
@@ -318,6 +411,27 @@ func (s *AssembleStage) installBoardFirmware(sc *build.StageContext) error {
 			}
 		}
 
+		// Files attached to the board profile chain
+		if fw.Source != "" {
+			src := boardFile(sc, fw.Source)
+			if src == "" {
+				return fmt.Errorf("firmware %s source not attached to board profile: %s", fw.Name, fw.Source)
+			}
+			info, err := os.Stat(src)
+			if err != nil {
+				return fmt.Errorf("failed to install firmware %s: %w", fw.Name, err)
+			}
+			if info.IsDir() {
+				err = copyDir(src, destDir)
+			} else {
+				err = copyFile(src, filepath.Join(destDir, filepath.Base(src)))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to install firmware %s: %w", fw.Name, err)
+			}
+			log.Info("Installing firmware from board profile", "firmware", fw.Name, "source", fw.Source, "dest", destDir)
+		}
+
 		log.Info("Firmware directory prepared", "firmware", fw.Name, "path", destDir)
 	}
 
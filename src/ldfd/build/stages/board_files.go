@@ -0,0 +1,106 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// boardFilesDir is the workspace directory holding the files attached to
+// the board profile chain, such as firmware blobs and device tree sources
+const boardFilesDir = "board-files"
+
+// loadBoardProfile resolves the configured board profile through its
+// parent chain and fetches the files attached along the way
+func (s *ResolveStage) loadBoardProfile(ctx context.Context, sc *build.StageContext) (*db.BoardProfile, error) {
+	chain, err := s.boardProfileRepo.GetChain(sc.Config.BoardProfileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load board profile: %w", err)
+	}
+	if chain == nil {
+		return nil, fmt.Errorf("board profile not found: %s", sc.Config.BoardProfileID)
+	}
+	for _, bp := range chain[1:] {
+		if bp.Arch != chain[0].Arch {
+			return nil, fmt.Errorf("board profile %s extends %s which targets %s", chain[0].Name, bp.Name, bp.Arch)
+		}
+	}
+
+	if s.storage != nil {
+		// Ancestors first so that a child's file replaces its parent's
+		dest := filepath.Join(sc.WorkspacePath, boardFilesDir)
+		for i := len(chain) - 1; i >= 0; i-- {
+			if err := s.fetchBoardFiles(ctx, chain[i].ID, dest); err != nil {
+				return nil, fmt.Errorf("failed to fetch files of board profile %s: %w", chain[i].Name, err)
+			}
+		}
+	}
+
+	return db.ResolveBoardProfile(chain), nil
+}
+
+// fetchBoardFiles downloads the files attached to a board profile into dest
+func (s *ResolveStage) fetchBoardFiles(ctx context.Context, profileID, dest string) error {
+	prefix := db.BoardProfileFilesPrefix(profileID)
+	objects, err := s.storage.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		rel, err := db.CleanBoardProfileFilePath(strings.TrimPrefix(obj.Key, prefix))
+		if err != nil {
+			return err
+		}
+		localPath := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return err
+		}
+		if err := s.downloadToFile(ctx, obj.Key, localPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boardFile returns the workspace path of a file attached to the board
+// profile chain, or "" when no such file was fetched
+func boardFile(sc *build.StageContext, rel string) string {
+	cleaned, err := db.CleanBoardProfileFilePath(rel)
+	if err != nil {
+		return ""
+	}
+	localPath := filepath.Join(sc.WorkspacePath, boardFilesDir, filepath.FromSlash(cleaned))
+	if _, err := os.Stat(localPath); err != nil {
+		return ""
+	}
+	return localPath
+}
+
+// stageBoardDeviceTrees copies device tree sources and overlays attached
+// to the board profile into the kernel tree, at the paths the profile's
+// device tree entries name, so out-of-tree overlays build like in-tree ones
+func stageBoardDeviceTrees(sc *build.StageContext, kernelDir string) error {
+	for _, dt := range sc.BoardProfile.Config.DeviceTrees {
+		for _, src := range append([]string{dt.Source}, dt.Overlays...) {
+			localPath := boardFile(sc, src)
+			if localPath == "" {
+				continue
+			}
+			dest := filepath.Join(kernelDir, filepath.FromSlash(src))
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return fmt.Errorf("failed to stage device tree %s: %w", src, err)
+			}
+			if err := copyFile(localPath, dest); err != nil {
+				return fmt.Errorf("failed to stage device tree %s: %w", src, err)
+			}
+			log.Info("Staged board profile device tree", "source", src)
+		}
+	}
+	return nil
+}
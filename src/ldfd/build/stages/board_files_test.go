@@ -0,0 +1,46 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestStageBoardDeviceTrees(t *testing.T) {
+	workspace := t.TempDir()
+	kernelDir := t.TempDir()
+
+	overlay := filepath.Join(workspace, boardFilesDir, "arch", "arm64", "boot", "dts", "overlays", "hat.dts")
+	if err := os.MkdirAll(filepath.Dir(overlay), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(overlay, []byte("/plugin/;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := &build.StageContext{
+		WorkspacePath: workspace,
+		BoardProfile: &db.BoardProfile{Config: db.BoardConfig{
+			DeviceTrees: []db.DeviceTreeSpec{{
+				Source:   "arch/arm64/boot/dts/broadcom/bcm2711-rpi-4-b.dts",
+				Overlays: []string{"arch/arm64/boot/dts/overlays/hat.dts", "../escape.dts"},
+			}},
+		}},
+	}
+
+	if err := stageBoardDeviceTrees(sc, kernelDir); err != nil {
+		t.Fatalf("stageBoardDeviceTrees() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(kernelDir, "arch", "arm64", "boot", "dts", "overlays", "hat.dts"))
+	if err != nil || string(data) != "/plugin/;" {
+		t.Fatalf("expected attached overlay in kernel tree, got %q (%v)", data, err)
+	}
+	// In-tree sources without an attached file are left to the kernel tree
+	if _, err := os.Stat(filepath.Join(kernelDir, "arch", "arm64", "boot", "dts", "broadcom")); !os.IsNotExist(err) {
+		t.Fatal("expected no file staged for an unattached device tree")
+	}
+}
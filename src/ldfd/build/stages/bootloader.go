@@ -296,13 +296,86 @@ func (i *UKIInstaller) Configure(rootfsPath string, kernelVersion string, arch d
 	return nil
 }
 
-// GetInstallCommands returns commands to create and install UKI
+// GetInstallCommands returns no chroot commands; the image generator
+// assembles the UKI on the host with UKIArgs once the root UUID is known
 func (i *UKIInstaller) GetInstallCommands(devicePath string, arch db.TargetArch) []string {
-	ukiName := fmt.Sprintf("%s-%s.efi", strings.ToLower(i.distName), i.distVersion)
+	return nil
+}
 
-	return []string{
-		fmt.Sprintf("ukify build --linux=/boot/vmlinuz --initrd=/boot/initramfs.img --cmdline=@/etc/kernel/cmdline --output=/boot/efi/EFI/Linux/%s", ukiName),
+// UKIPath returns the UKI location relative to the ESP
+func (i *UKIInstaller) UKIPath() string {
+	return filepath.Join("EFI", "Linux",
+		fmt.Sprintf("%s-%s.efi", strings.ReplaceAll(strings.ToLower(i.distName), " ", "-"), i.distVersion))
+}
+
+// UKIArgs returns the ukify arguments that build a UKI at output from the
+// kernel, initramfs and os-release under rootfsPath and the command line
+// stored in cmdlinePath
+func (i *UKIInstaller) UKIArgs(rootfsPath, cmdlinePath, output string) []string {
+	args := []string{
+		"build",
+		"--linux=" + filepath.Join(rootfsPath, "boot", "vmlinuz"),
+	}
+	initramfs := filepath.Join(rootfsPath, "boot", "initramfs.img")
+	if _, err := os.Stat(initramfs); err == nil {
+		args = append(args, "--initrd="+initramfs)
+	}
+	args = append(args,
+		"--cmdline=@"+cmdlinePath,
+		"--os-release=@"+filepath.Join(rootfsPath, "etc", "os-release"),
+		"--output="+output,
+	)
+	return args
+}
+
+// rootUUIDPlaceholder marks where the root filesystem UUID belongs in
+// generated boot configuration until the image generator knows it
+const rootUUIDPlaceholder = "ROOT_UUID"
+
+// SubstituteRootUUID replaces the root UUID placeholder in fstab and every
+// bootloader configuration under rootfsPath
+func SubstituteRootUUID(rootfsPath, rootUUID string) error {
+	return replaceInFiles(bootConfigFiles(rootfsPath), rootUUIDPlaceholder, rootUUID)
+}
+
+// bootConfigFiles lists the generated files under rootfsPath that may
+// reference the root filesystem
+func bootConfigFiles(rootfsPath string) []string {
+	files := []string{
+		filepath.Join(rootfsPath, "etc", "fstab"),
+		filepath.Join(rootfsPath, "etc", "kernel", "cmdline"),
+		filepath.Join(rootfsPath, "boot", "grub", "grub.cfg"),
+		filepath.Join(rootfsPath, "boot", "extlinux", "extlinux.conf"),
 	}
+	entries, _ := filepath.Glob(filepath.Join(rootfsPath, "boot", "efi", "loader", "entries", "*.conf"))
+	return append(files, entries...)
+}
+
+// replaceInFiles replaces every occurrence of old with new in the given
+// files, skipping files that do not exist
+func replaceInFiles(files []string, old, new string) error {
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !strings.Contains(string(data), old) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		updated := strings.ReplaceAll(string(data), old, new)
+		if err := os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	return nil
 }
 
 // GetBootloaderInstaller returns the appropriate bootloader installer for the config
@@ -314,6 +387,8 @@ func GetBootloaderInstaller(bootloader, distName, distVersion string) Bootloader
 		return NewSystemdBootInstaller(distName, distVersion)
 	case "uki":
 		return NewUKIInstaller(distName, distVersion)
+	case "uboot", "u-boot":
+		return NewUBootInstaller(distName, distVersion)
 	default:
 		return NewGRUB2Installer(distName, distVersion)
 	}
@@ -0,0 +1,83 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestSubstituteRootUUID(t *testing.T) {
+	rootfs := t.TempDir()
+	uki := NewUKIInstaller("LDF Linux", "1.0")
+	sdboot := NewSystemdBootInstaller("LDF Linux", "1.0")
+
+	if err := uki.Configure(rootfs, "6.12.0", db.ArchX86_64, true); err != nil {
+		t.Fatalf("failed to configure UKI: %v", err)
+	}
+	if err := sdboot.Install(rootfs, nil); err != nil {
+		t.Fatalf("failed to install systemd-boot: %v", err)
+	}
+	if err := sdboot.Configure(rootfs, "6.12.0", db.ArchX86_64, true); err != nil {
+		t.Fatalf("failed to configure systemd-boot: %v", err)
+	}
+
+	const rootUUID = "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"
+	if err := SubstituteRootUUID(rootfs, rootUUID); err != nil {
+		t.Fatalf("SubstituteRootUUID failed: %v", err)
+	}
+
+	files := []string{
+		filepath.Join(rootfs, "etc", "kernel", "cmdline"),
+		filepath.Join(rootfs, "boot", "efi", "loader", "entries", "ldf linux.conf"),
+		filepath.Join(rootfs, "boot", "efi", "loader", "entries", "ldf linux-recovery.conf"),
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if strings.Contains(string(data), rootUUIDPlaceholder) {
+			t.Errorf("%s still contains the placeholder", filepath.Base(path))
+		}
+		if !strings.Contains(string(data), "root=UUID="+rootUUID) {
+			t.Errorf("%s does not reference the root UUID:\n%s", filepath.Base(path), data)
+		}
+	}
+}
+
+func TestUKIInstaller_UKIArgs(t *testing.T) {
+	rootfs := t.TempDir()
+	uki := NewUKIInstaller("LDF Linux", "1.0")
+
+	if got := uki.GetInstallCommands("/dev/loop0", db.ArchX86_64); len(got) != 0 {
+		t.Errorf("expected no chroot install commands, got %v", got)
+	}
+
+	cmdline := filepath.Join(rootfs, "etc", "kernel", "cmdline")
+	output := filepath.Join(rootfs, "boot", "efi", uki.UKIPath())
+	args := uki.UKIArgs(rootfs, cmdline, output)
+	joined := strings.Join(args, " ")
+	if args[0] != "build" {
+		t.Errorf("expected ukify build, got %v", args)
+	}
+	if strings.Contains(joined, "--initrd") {
+		t.Error("expected no --initrd without an initramfs")
+	}
+	wantOutput := "--output=" + filepath.Join(rootfs, "boot", "efi", "EFI", "Linux", "ldf-linux-1.0.efi")
+	if !strings.Contains(joined, wantOutput) {
+		t.Errorf("expected %s in %v", wantOutput, args)
+	}
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "boot"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "boot", "initramfs.img"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(uki.UKIArgs(rootfs, cmdline, output), " "), "--initrd="+filepath.Join(rootfs, "boot", "initramfs.img")) {
+		t.Error("expected --initrd when the initramfs exists")
+	}
+}
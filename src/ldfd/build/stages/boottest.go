@@ -0,0 +1,509 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+const (
+	// bootTestLogName is the name the serial console log is published under
+	bootTestLogName = "boot-test.log"
+
+	defaultBootTestTimeout  = 300 * time.Second
+	defaultBootTestMemoryMB = 1024
+	defaultSuccessMarker    = `login:`
+
+	// commandTimeout bounds each test command once the system is up
+	commandTimeout = 60 * time.Second
+	// exitMarker prefixes the exit status echoed after each test command
+	exitMarker = "LDF-TEST-RC="
+)
+
+// bootFailurePatterns end a boot test early: a kernel panic, or the LDF
+// initramfs giving up on the root filesystem
+var bootFailurePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`Kernel panic - not syncing[^\r\n]*`),
+	regexp.MustCompile(`ERROR: [^\r\n]*\r?\nDropping to shell`),
+}
+
+var (
+	errBootFailed  = errors.New("boot failed")
+	errBootTimeout = errors.New("timed out")
+	errVMExited    = errors.New("virtual machine exited")
+)
+
+// uefiFirmware is a UEFI firmware build QEMU can boot images with. Split
+// builds pair a read-only code image with a template for the variable store.
+type uefiFirmware struct {
+	code string
+	vars string
+}
+
+// uefiFirmwareCandidates lists where distributions install OVMF and AAVMF
+var uefiFirmwareCandidates = map[db.TargetArch][]uefiFirmware{
+	db.ArchX86_64: {
+		{"/usr/share/OVMF/OVMF_CODE_4M.fd", "/usr/share/OVMF/OVMF_VARS_4M.fd"},
+		{"/usr/share/OVMF/OVMF_CODE.fd", "/usr/share/OVMF/OVMF_VARS.fd"},
+		{"/usr/share/edk2/ovmf/OVMF_CODE.fd", "/usr/share/edk2/ovmf/OVMF_VARS.fd"},
+		{"/usr/share/edk2/x64/OVMF_CODE.4m.fd", "/usr/share/edk2/x64/OVMF_VARS.4m.fd"},
+		{"/usr/share/qemu/OVMF.fd", ""},
+	},
+	db.ArchAARCH64: {
+		{"/usr/share/AAVMF/AAVMF_CODE.fd", "/usr/share/AAVMF/AAVMF_VARS.fd"},
+		{"/usr/share/edk2/aarch64/QEMU_EFI.fd", ""},
+		{"/usr/share/qemu-efi-aarch64/QEMU_EFI.fd", ""},
+	},
+}
+
+// BootTestStage boots the packaged image in QEMU and fails the build when
+// it does not come up
+type BootTestStage struct {
+	storage storage.Backend
+}
+
+// NewBootTestStage creates a new boot test stage
+func NewBootTestStage(storage storage.Backend) *BootTestStage {
+	return &BootTestStage{storage: storage}
+}
+
+// Name returns the stage name
+func (s *BootTestStage) Name() db.BuildStageName {
+	return db.StageTest
+}
+
+// Validate checks whether this stage can run
+func (s *BootTestStage) Validate(ctx context.Context, sc *build.StageContext) error {
+	cfg := sc.Config.Build.BootTest
+	if !cfg.Enabled || sc.ImageFormat == db.ImageFormatOCI {
+		return nil
+	}
+
+	if err := ValidateBootTestConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(qemuBinary(sc.TargetArch)); err != nil {
+		return fmt.Errorf("boot test requires %s on the build host", qemuBinary(sc.TargetArch))
+	}
+	if _, err := findUEFIFirmware(sc.TargetArch); err != nil {
+		return err
+	}
+	if sc.ImagePath == "" {
+		return fmt.Errorf("no packaged image to boot")
+	}
+
+	return nil
+}
+
+// Execute boots the image, waits for the success marker and runs the
+// configured commands over the serial console
+func (s *BootTestStage) Execute(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) error {
+	cfg := sc.Config.Build.BootTest
+	if !cfg.Enabled {
+		progress(100, "Boot test disabled")
+		return nil
+	}
+	if sc.ImageFormat == db.ImageFormatOCI {
+		progress(100, "Boot test skipped for container images")
+		return nil
+	}
+
+	workDir := filepath.Join(sc.WorkspacePath, "boottest")
+	if err := os.RemoveAll(workDir); err != nil {
+		return fmt.Errorf("failed to clean boot test directory: %w", err)
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("failed to create boot test directory: %w", err)
+	}
+
+	fw, err := findUEFIFirmware(sc.TargetArch)
+	if err != nil {
+		return err
+	}
+	if fw.vars != "" {
+		// Each run gets a fresh copy of the variable store
+		vars := filepath.Join(workDir, "efivars.fd")
+		if err := copyFile(fw.vars, vars); err != nil {
+			return fmt.Errorf("failed to copy UEFI variable store: %w", err)
+		}
+		fw.vars = vars
+	}
+
+	accel := "tcg"
+	if kvmAvailable(sc.TargetArch) {
+		accel = "kvm"
+	}
+	// The test boots the image as its launch descriptors do, with the
+	// boot test's own memory size
+	launch := newVMLaunch(sc)
+	launch.memoryMB = cfg.MemoryMB
+	if launch.memoryMB <= 0 {
+		launch.memoryMB = defaultBootTestMemoryMB
+	}
+	args := qemuArgs(launch, sc.ImagePath, fw, accel)
+	if launch.seed {
+		args = append(args, seedArgs(filepath.Join(sc.OutputDir, cloud.SeedName))...)
+	}
+
+	timeout := defaultBootTestTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	// TCG runs guests several times slower than KVM
+	if accel == "tcg" {
+		timeout *= 3
+	}
+
+	progress(5, fmt.Sprintf("Booting %s image in QEMU (%s, timeout %s)", sc.ImageFormat, accel, timeout))
+	log.Info("Starting boot test", "binary", qemuBinary(sc.TargetArch), "args", args)
+
+	consoleLog := filepath.Join(workDir, bootTestLogName)
+	// Encrypted roots prompt for their key unless the first boot unlocks
+	// with the key embedded in the initramfs
+	var passphrase string
+	if sc.DiskKey != nil && !sc.Config.Security.Encryption.Reencrypt {
+		passphrase = sc.DiskKey.RecoveryKey
+	}
+	testErr := runBootTest(ctx, qemuBinary(sc.TargetArch), args, consoleLog, cfg, passphrase, timeout, progress)
+
+	// The console log is published whatever the outcome
+	if sc.ArtifactPath != "" {
+		key := path.Join(path.Dir(sc.ArtifactPath), bootTestLogName)
+		if err := uploadFile(ctx, s.storage, consoleLog, key, "text/plain"); err != nil {
+			log.Warn("Failed to upload boot test log", "error", err)
+		} else {
+			progress(98, "Console log published to "+key)
+		}
+	}
+
+	if testErr != nil {
+		// Packaging already published and signed the image; an image
+		// that does not boot must not stay available as a valid release
+		if sc.ArtifactPath != "" {
+			removed, err := build.WithdrawArtifacts(ctx, s.storage, path.Dir(sc.ArtifactPath), bootTestLogName)
+			if err != nil {
+				log.Warn("Failed to withdraw published artifacts", "error", err)
+			} else {
+				progress(99, fmt.Sprintf("Withdrew %d published artifacts", removed))
+			}
+		}
+		return fmt.Errorf("boot test failed: %w", testErr)
+	}
+
+	progress(100, "Boot test passed")
+	return nil
+}
+
+// runBootTest starts QEMU with its serial console on stdio, recording the
+// console to logPath, and drives the test. A non-empty passphrase answers
+// the encrypted root prompt.
+func runBootTest(ctx context.Context, binary string, args []string, logPath string, cfg db.BootTestConfig, passphrase string, timeout time.Duration, progress build.ProgressFunc) error {
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to create console log: %w", err)
+	}
+	defer logFile.Close()
+
+	vmCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(vmCtx, binary, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = logFile
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start QEMU: %w", err)
+	}
+	defer func() {
+		cancel()
+		_ = cmd.Wait()
+	}()
+
+	console := newSerialConsole(io.TeeReader(stdout, logFile), stdin)
+	if passphrase != "" {
+		if err := unlockEncryptedRoot(ctx, console, passphrase, timeout); err != nil {
+			return err
+		}
+		progress(30, "Unlocked encrypted root")
+	}
+	return driveBootTest(ctx, console, cfg, timeout, progress)
+}
+
+// ValidateBootTestConfig reports boot test settings that cannot be run
+// against the image format. Container images are not boot tested.
+func ValidateBootTestConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	cfg := config.Build.BootTest
+	if !cfg.Enabled || format == db.ImageFormatOCI {
+		return nil
+	}
+	switch format {
+	case db.ImageFormatRaw, db.ImageFormatQCOW2, db.ImageFormatVMDK, db.ImageFormatVHDX, db.ImageFormatISO:
+	default:
+		return fmt.Errorf("boot test does not support %s images", format)
+	}
+	if cfg.TimeoutSeconds < 0 || cfg.MemoryMB < 0 {
+		return fmt.Errorf("boot test timeout and memory must not be negative")
+	}
+	_, err := successMarker(cfg)
+	return err
+}
+
+// driveBootTest waits for the system to come up on the console and runs
+// the configured commands
+func driveBootTest(ctx context.Context, console *serialConsole, cfg db.BootTestConfig, timeout time.Duration, progress build.ProgressFunc) error {
+	marker, err := successMarker(cfg)
+	if err != nil {
+		return err
+	}
+
+	bootCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	match, err := console.expect(bootCtx, marker)
+	if err != nil {
+		return fmt.Errorf("waiting for %q: %w", marker.String(), err)
+	}
+	progress(60, fmt.Sprintf("System booted (matched %q)", strings.TrimSpace(match[0])))
+
+	if len(cfg.Commands) == 0 {
+		return nil
+	}
+
+	// Commands need a root shell; log in first when the marker was a login prompt
+	if strings.Contains(match[0], "login:") {
+		if err := console.send("root\n"); err != nil {
+			return err
+		}
+	}
+
+	exitRe := regexp.MustCompile(exitMarker + `(\d+)`)
+	for i, command := range cfg.Commands {
+		if err := console.send(fmt.Sprintf("%s; echo %s$?\n", command, exitMarker)); err != nil {
+			return err
+		}
+		cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout)
+		match, err := console.expect(cmdCtx, exitRe)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("command %q: %w", command, err)
+		}
+		if code, _ := strconv.Atoi(match[1]); code != 0 {
+			return fmt.Errorf("command %q exited with status %d", command, code)
+		}
+		progress(60+(i+1)*35/len(cfg.Commands), fmt.Sprintf("Test command passed: %s", command))
+	}
+
+	return nil
+}
+
+// unlockEncryptedRoot waits for the initramfs passphrase prompt and types
+// the key. The key is not written to the console, so it stays out of the
+// published log.
+func unlockEncryptedRoot(ctx context.Context, console *serialConsole, passphrase string, timeout time.Duration) error {
+	promptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := console.expect(promptCtx, regexp.MustCompile(regexp.QuoteMeta(luksPrompt))); err != nil {
+		return fmt.Errorf("waiting for encrypted root prompt: %w", err)
+	}
+	return console.send(passphrase + "\n")
+}
+
+// successMarker compiles the configured success marker
+func successMarker(cfg db.BootTestConfig) (*regexp.Regexp, error) {
+	marker := cfg.SuccessMarker
+	if marker == "" {
+		marker = defaultSuccessMarker
+	}
+	re, err := regexp.Compile(marker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid boot test success marker: %w", err)
+	}
+	return re, nil
+}
+
+// serialConsole reads a VM's serial output in the background and matches
+// patterns against what arrived since the previous match
+type serialConsole struct {
+	in     io.Writer
+	chunks chan []byte
+	buf    []byte
+	closed bool
+}
+
+func newSerialConsole(out io.Reader, in io.Writer) *serialConsole {
+	c := &serialConsole{in: in, chunks: make(chan []byte, 64)}
+	go func() {
+		defer close(c.chunks)
+		for {
+			b := make([]byte, 4096)
+			n, err := out.Read(b)
+			if n > 0 {
+				c.chunks <- b[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// expect waits for re to match the unread console output and returns its
+// submatches. Boot failures are reported as soon as they appear.
+func (c *serialConsole) expect(ctx context.Context, re *regexp.Regexp) ([]string, error) {
+	for {
+		for _, failure := range bootFailurePatterns {
+			if m := failure.Find(c.buf); m != nil {
+				return nil, fmt.Errorf("%w: %s", errBootFailed, bytes.TrimSpace(m))
+			}
+		}
+		if loc := re.FindSubmatchIndex(c.buf); loc != nil {
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(c.buf[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			c.buf = c.buf[loc[1]:]
+			return match, nil
+		}
+		if c.closed {
+			return nil, errVMExited
+		}
+
+		select {
+		case chunk, ok := <-c.chunks:
+			if !ok {
+				c.closed = true
+				continue
+			}
+			c.buf = append(c.buf, chunk...)
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, errBootTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send types text on the serial console
+func (c *serialConsole) send(text string) error {
+	if _, err := io.WriteString(c.in, text); err != nil {
+		return fmt.Errorf("failed to write to serial console: %w", err)
+	}
+	return nil
+}
+
+// qemuBinary returns the QEMU system emulator for arch
+func qemuBinary(arch db.TargetArch) string {
+	if arch == db.ArchAARCH64 {
+		return "qemu-system-aarch64"
+	}
+	return "qemu-system-x86_64"
+}
+
+// qemuArgs returns the QEMU arguments booting imagePath under UEFI with the
+// first serial port on stdio. Disk images are opened in snapshot mode so
+// the published image is never modified.
+func qemuArgs(l vmLaunch, imagePath string, fw uefiFirmware, accel string) []string {
+	args := []string{
+		"-nodefaults",
+		"-display", "none",
+		"-serial", "stdio",
+		"-no-reboot",
+	}
+	args = append(args, l.machineArgs(accel, qemuCPU(accel))...)
+	args = append(args, firmwareArgs(fw)...)
+	args = append(args, l.diskArgs(imagePath, true)...)
+	return append(args, netArgs()...)
+}
+
+// findUEFIFirmware returns the first installed UEFI firmware for arch
+func findUEFIFirmware(arch db.TargetArch) (uefiFirmware, error) {
+	for _, fw := range uefiFirmwareCandidates[arch] {
+		if _, err := os.Stat(fw.code); err != nil {
+			continue
+		}
+		if fw.vars != "" {
+			if _, err := os.Stat(fw.vars); err != nil {
+				fw.vars = ""
+			}
+		}
+		return fw, nil
+	}
+	return uefiFirmware{}, fmt.Errorf("boot test requires UEFI firmware (OVMF/AAVMF) for %s on the build host", arch)
+}
+
+// kvmAvailable reports whether guests of arch can use KVM on this host
+func kvmAvailable(arch db.TargetArch) bool {
+	native := (runtime.GOARCH == "amd64" && arch == db.ArchX86_64) ||
+		(runtime.GOARCH == "arm64" && arch == db.ArchAARCH64)
+	if !native {
+		return false
+	}
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// serialConsoleArgs returns the kernel arguments mirroring the console on
+// the serial port QEMU exposes for arch
+func serialConsoleArgs(arch db.TargetArch) string {
+	if arch == db.ArchAARCH64 {
+		return "console=tty0 console=ttyAMA0,115200"
+	}
+	return "console=tty0 console=ttyS0,115200"
+}
+
+// enableSerialConsole adds the serial console to the default boot entries
+// the bootloader installer generated under rootfsPath
+func enableSerialConsole(rootfsPath string, arch db.TargetArch) error {
+	return appendKernelArgs(rootfsPath, " "+serialConsoleArgs(arch))
+}
+
+// appendKernelArgs adds args, with a leading space, to the default boot
+// entries the bootloader installer generated under rootfsPath
+func appendKernelArgs(rootfsPath, args string) error {
+	return replaceInFiles(bootConfigFiles(rootfsPath), " ro quiet", " ro quiet"+args)
+}
+
+// uploadFile uploads a local file to storage under key
+func uploadFile(ctx context.Context, backend storage.Backend, localPath, key, contentType string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return backend.Upload(ctx, key, f, info.Size(), contentType)
+}
@@ -0,0 +1,207 @@
+package stages
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func noProgress(int, string) {}
+
+// startFakeVM returns a console that prints boot and answers each line
+// typed on it through respond
+func startFakeVM(t *testing.T, boot string, respond func(string) string) *serialConsole {
+	t.Helper()
+	outR, outW := io.Pipe()
+	inR, inW := io.Pipe()
+	t.Cleanup(func() {
+		outW.Close()
+		inW.Close()
+	})
+
+	go func() {
+		_, _ = io.WriteString(outW, boot)
+		buf := make([]byte, 1024)
+		var line string
+		for {
+			n, err := inR.Read(buf)
+			if err != nil {
+				return
+			}
+			line += string(buf[:n])
+			for {
+				i := strings.IndexByte(line, '\n')
+				if i < 0 {
+					break
+				}
+				if respond != nil {
+					_, _ = io.WriteString(outW, respond(line[:i]))
+				}
+				line = line[i+1:]
+			}
+		}
+	}()
+
+	return newSerialConsole(outR, inW)
+}
+
+func TestDriveBootTest_LoginPrompt(t *testing.T) {
+	console := startFakeVM(t, "[    1.0] Linux version 6.12\nWelcome to LDF\nldf login: ", nil)
+
+	err := driveBootTest(context.Background(), console, db.BootTestConfig{Enabled: true}, 5*time.Second, noProgress)
+	if err != nil {
+		t.Fatalf("driveBootTest() error = %v", err)
+	}
+}
+
+func TestDriveBootTest_KernelPanic(t *testing.T) {
+	console := startFakeVM(t, "VFS: Unable to mount root fs\nKernel panic - not syncing: VFS: Unable to mount root fs on unknown-block(0,0)\n", nil)
+
+	err := driveBootTest(context.Background(), console, db.BootTestConfig{Enabled: true}, 5*time.Second, noProgress)
+	if !errors.Is(err, errBootFailed) {
+		t.Fatalf("driveBootTest() error = %v, want boot failure", err)
+	}
+	if !strings.Contains(err.Error(), "Unable to mount root fs") {
+		t.Errorf("error %q does not include the panic message", err)
+	}
+}
+
+func TestDriveBootTest_InitramfsFailure(t *testing.T) {
+	console := startFakeVM(t, "ERROR: Root device not found: /dev/vda2\nDropping to shell...\n# ", nil)
+
+	err := driveBootTest(context.Background(), console, db.BootTestConfig{Enabled: true}, 5*time.Second, noProgress)
+	if !errors.Is(err, errBootFailed) {
+		t.Fatalf("driveBootTest() error = %v, want boot failure", err)
+	}
+}
+
+func TestDriveBootTest_Timeout(t *testing.T) {
+	console := startFakeVM(t, "Booting kernel...\n", nil)
+
+	err := driveBootTest(context.Background(), console, db.BootTestConfig{Enabled: true}, 100*time.Millisecond, noProgress)
+	if !errors.Is(err, errBootTimeout) {
+		t.Fatalf("driveBootTest() error = %v, want timeout", err)
+	}
+}
+
+func TestDriveBootTest_CustomMarker(t *testing.T) {
+	console := startFakeVM(t, "[  OK  ] Reached target Multi-User System.\n", nil)
+	cfg := db.BootTestConfig{Enabled: true, SuccessMarker: `Reached target .*Multi-User`}
+
+	if err := driveBootTest(context.Background(), console, cfg, 5*time.Second, noProgress); err != nil {
+		t.Fatalf("driveBootTest() error = %v", err)
+	}
+}
+
+func TestDriveBootTest_Commands(t *testing.T) {
+	respond := func(line string) string {
+		switch {
+		case line == "root":
+			return "# "
+		case strings.HasPrefix(line, "systemctl is-system-running"):
+			return "running\n" + exitMarker + "0\n# "
+		case strings.HasPrefix(line, "false"):
+			return exitMarker + "1\n# "
+		}
+		return ""
+	}
+
+	console := startFakeVM(t, "ldf login: ", respond)
+	cfg := db.BootTestConfig{Enabled: true, Commands: []string{"systemctl is-system-running"}}
+	if err := driveBootTest(context.Background(), console, cfg, 5*time.Second, noProgress); err != nil {
+		t.Fatalf("driveBootTest() error = %v", err)
+	}
+
+	console = startFakeVM(t, "ldf login: ", respond)
+	cfg.Commands = []string{"systemctl is-system-running", "false"}
+	err := driveBootTest(context.Background(), console, cfg, 5*time.Second, noProgress)
+	if err == nil || !strings.Contains(err.Error(), `"false" exited with status 1`) {
+		t.Fatalf("driveBootTest() error = %v, want failing command", err)
+	}
+}
+
+func TestValidateBootTestConfig(t *testing.T) {
+	config := &db.DistributionConfig{}
+	if err := ValidateBootTestConfig(config, db.ImageFormatISO); err != nil {
+		t.Errorf("disabled boot test: %v", err)
+	}
+
+	config.Build.BootTest = db.BootTestConfig{Enabled: true, SuccessMarker: "login:"}
+	for _, format := range []db.ImageFormat{db.ImageFormatRaw, db.ImageFormatQCOW2, db.ImageFormatVMDK, db.ImageFormatVHDX, db.ImageFormatISO, db.ImageFormatOCI} {
+		if err := ValidateBootTestConfig(config, format); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+	if err := ValidateBootTestConfig(config, db.ImageFormatCpio); err == nil {
+		t.Error("expected error for cpio archives")
+	}
+
+	config.Build.BootTest.SuccessMarker = "login(:"
+	if err := ValidateBootTestConfig(config, db.ImageFormatRaw); err == nil {
+		t.Error("expected error for invalid success marker")
+	}
+}
+
+func TestQemuArgs(t *testing.T) {
+	split := uefiFirmware{code: "/fw/OVMF_CODE.fd", vars: "/work/efivars.fd"}
+	launch := vmLaunch{arch: db.ArchX86_64, format: db.ImageFormatQCOW2, memoryMB: 2048, cpus: 2, diskBus: db.VMDiskBusVirtio}
+	args := strings.Join(qemuArgs(launch, "/out/ldf.qcow2", split, "tcg"), " ")
+	for _, want := range []string{
+		"-serial stdio",
+		"-m 2048",
+		"-accel tcg",
+		"-machine q35",
+		"if=pflash,format=raw,unit=0,readonly=on,file=/fw/OVMF_CODE.fd",
+		"if=pflash,format=raw,unit=1,file=/work/efivars.fd",
+		"if=virtio,format=qcow2,snapshot=on,file=/out/ldf.qcow2",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("x86_64 args missing %q: %s", want, args)
+		}
+	}
+
+	combined := uefiFirmware{code: "/fw/QEMU_EFI.fd"}
+	launch = vmLaunch{arch: db.ArchAARCH64, format: db.ImageFormatISO, memoryMB: 1024, cpus: 2, diskBus: db.VMDiskBusVirtio}
+	args = strings.Join(qemuArgs(launch, "/out/ldf.iso", combined, "kvm"), " ")
+	for _, want := range []string{
+		"-machine virt -accel kvm -cpu host",
+		"-bios /fw/QEMU_EFI.fd",
+		"media=cdrom,readonly=on,file=/out/ldf.iso",
+		"scsi-cd,drive=cd0",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("aarch64 args missing %q: %s", want, args)
+		}
+	}
+}
+
+func TestEnableSerialConsole(t *testing.T) {
+	rootfs := t.TempDir()
+	entryDir := filepath.Join(rootfs, "boot", "efi", "loader", "entries")
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	entry := filepath.Join(entryDir, "ldf.conf")
+	if err := os.WriteFile(entry, []byte("options root=UUID=ROOT_UUID ro quiet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enableSerialConsole(rootfs, db.ArchAARCH64); err != nil {
+		t.Fatalf("enableSerialConsole() error = %v", err)
+	}
+
+	data, err := os.ReadFile(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ro quiet console=tty0 console=ttyAMA0,115200\n"; !strings.HasSuffix(string(data), want) {
+		t.Errorf("entry = %q, want suffix %q", data, want)
+	}
+}
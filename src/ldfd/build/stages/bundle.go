@@ -0,0 +1,186 @@
+package stages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/bundle"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/google/uuid"
+)
+
+// bundleFileName is the name update bundles are published under
+const bundleFileName = "update" + bundle.Extension
+
+// bundleCompatible returns the compatible string of a build's update
+// bundle: the configured value, else the board profile or distribution name
+func bundleCompatible(sc *build.StageContext) string {
+	switch {
+	case sc.Config.Update.Compatible != "":
+		return sc.Config.Update.Compatible
+	case sc.BoardProfile != nil:
+		return sc.BoardProfile.Name
+	case sc.DistName != "":
+		return sc.DistName
+	default:
+		return sc.DistributionID
+	}
+}
+
+// publishBundle builds the signed update bundle of the assembled rootfs,
+// uploads it into storageDir and records it in the stage context
+func (s *PackageStage) publishBundle(ctx context.Context, sc *build.StageContext, storageDir string) (publishedFile, error) {
+	workDir := filepath.Join(sc.WorkspacePath, "bundle")
+	if err := os.RemoveAll(workDir); err != nil {
+		return publishedFile{}, fmt.Errorf("failed to clean bundle directory: %w", err)
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return publishedFile{}, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	created := time.Now().UTC()
+	if sc.SourceDateEpoch != 0 {
+		created = time.Unix(sc.SourceDateEpoch, 0).UTC()
+	}
+
+	// The root image is sized to its content; updaters grow the filesystem
+	// to the slot after writing it
+	sizeMB, err := rootfsImageSizeMB(sc.RootfsDir)
+	if err != nil {
+		return publishedFile{}, err
+	}
+	rootImg := filepath.Join(workDir, "rootfs.img")
+	f, err := os.Create(rootImg)
+	if err != nil {
+		return publishedFile{}, fmt.Errorf("failed to create root image: %w", err)
+	}
+	err = f.Truncate(int64(sizeMB) << 20)
+	f.Close()
+	if err != nil {
+		return publishedFile{}, fmt.Errorf("failed to size root image: %w", err)
+	}
+
+	fsUUID := uuid.NewString()
+	if sc.SourceDateEpoch != 0 {
+		fsUUID = build.DeterministicUUID(sc.SourceDateEpoch, "bundle-rootfs")
+	}
+	if err := mkfsRootSlot(ctx, rootImg, "root", fsUUID, sc.RootfsDir, sc.SourceDateEpoch); err != nil {
+		return publishedFile{}, fmt.Errorf("failed to create root image: %w", err)
+	}
+
+	rootfs, err := bundle.Describe(bundle.SlotRootfs, rootImg)
+	if err != nil {
+		return publishedFile{}, err
+	}
+	rootfs.FSType = "ext4"
+	images := []bundle.File{rootfs}
+
+	// Slot kernels live on the shared ESP, so the bundle carries them too
+	bootFiles := []struct{ slot, name string }{
+		{bundle.SlotKernel, "vmlinuz"},
+		{bundle.SlotInitramfs, "initramfs.img"},
+	}
+	for _, bf := range bootFiles {
+		src := filepath.Join(sc.RootfsDir, "boot", bf.name)
+		if _, err := os.Stat(src); os.IsNotExist(err) && bf.slot != bundle.SlotKernel {
+			continue
+		}
+		if err := copyFile(src, filepath.Join(workDir, bf.name)); err != nil {
+			return publishedFile{}, fmt.Errorf("failed to stage %s: %w", bf.name, err)
+		}
+	}
+	if sc.SecureBoot != nil {
+		if err := signKernels(ctx, sc.SecureBoot, workDir, sc.SourceDateEpoch); err != nil {
+			return publishedFile{}, fmt.Errorf("failed to sign kernel: %w", err)
+		}
+	}
+	for _, bf := range bootFiles {
+		p := filepath.Join(workDir, bf.name)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		file, err := bundle.Describe(bf.slot, p)
+		if err != nil {
+			return publishedFile{}, err
+		}
+		images = append(images, file)
+	}
+
+	manifest := bundle.Manifest{
+		Format:         bundle.FormatName,
+		FormatVersion:  bundle.FormatVersion,
+		Compatible:     bundleCompatible(sc),
+		Version:        sc.DistVersion,
+		BuildID:        sc.BuildID,
+		DistributionID: sc.DistributionID,
+		Arch:           string(sc.TargetArch),
+		Created:        created,
+		Images:         images,
+	}
+
+	if hooks := sc.Config.Update.Hooks; hooks != "" {
+		hooksPath := filepath.Join(workDir, "hooks.sh")
+		if err := os.WriteFile(hooksPath, []byte(hooks), 0755); err != nil {
+			return publishedFile{}, fmt.Errorf("failed to write hooks: %w", err)
+		}
+		file, err := bundle.Describe("", hooksPath)
+		if err != nil {
+			return publishedFile{}, err
+		}
+		manifest.Hooks = &file
+	}
+
+	payload, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return publishedFile{}, fmt.Errorf("failed to encode bundle manifest: %w", err)
+	}
+	envelope, err := sc.Signer.Sign(bundle.PayloadType, payload)
+	if err != nil {
+		return publishedFile{}, fmt.Errorf("failed to sign bundle manifest: %w", err)
+	}
+
+	bundlePath := filepath.Join(sc.OutputDir, bundleFileName)
+	out, err := os.Create(bundlePath)
+	if err != nil {
+		return publishedFile{}, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	if err := bundle.Write(out, payload, envelope, workDir); err != nil {
+		out.Close()
+		return publishedFile{}, err
+	}
+	if err := out.Close(); err != nil {
+		return publishedFile{}, fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	checksum, err := CalculateChecksum(bundlePath)
+	if err != nil {
+		return publishedFile{}, fmt.Errorf("failed to calculate bundle checksum: %w", err)
+	}
+	size, err := GetFileSize(bundlePath)
+	if err != nil {
+		return publishedFile{}, err
+	}
+
+	key := path.Join(storageDir, bundleFileName)
+	if err := s.uploadToStorage(ctx, bundlePath, key, nil); err != nil {
+		return publishedFile{}, fmt.Errorf("failed to upload bundle: %w", err)
+	}
+
+	sc.UpdateBundle = &db.UpdateBundle{
+		Compatible:   manifest.Compatible,
+		Version:      manifest.Version,
+		ArtifactPath: key,
+		Checksum:     checksum,
+		SizeBytes:    size,
+	}
+	log.Info("Published update bundle", "path", key, "compatible", manifest.Compatible, "size", size)
+
+	return publishedFile{localPath: bundlePath, storageKey: key}, nil
+}
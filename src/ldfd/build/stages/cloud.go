@@ -0,0 +1,185 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// ValidateCloudConfig checks that a cloud image names a known provider and
+// is built in an image format the provider imports
+func ValidateCloudConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	if !cloud.Enabled(config) {
+		return nil
+	}
+	cfg := cloud.Settings(config)
+	profile, err := cloud.ProfileFor(cfg.Provider)
+	if err != nil {
+		return err
+	}
+	if !profile.SupportsFormat(format) {
+		formats := make([]string, len(profile.ImageFormats))
+		for i, f := range profile.ImageFormats {
+			formats[i] = string(f)
+		}
+		return fmt.Errorf("%s cloud images cannot be built as %s (supported: %s)", cfg.Provider, format, strings.Join(formats, ", "))
+	}
+	for _, ds := range cfg.Datasources {
+		if strings.TrimSpace(ds) == "" {
+			return fmt.Errorf("cloud-init datasource names must not be empty")
+		}
+	}
+	return nil
+}
+
+// imageKernelArgs returns the extra kernel arguments, with a leading
+// space, of the build's boot entries: the console, then the cgroup
+// hierarchy selection
+func imageKernelArgs(sc *build.StageContext) string {
+	return consoleKernelArgs(sc) + cgroupKernelArgs(sc.Config)
+}
+
+// consoleKernelArgs returns the provider's console for cloud images,
+// otherwise the serial console when it is enabled, with a leading space
+func consoleKernelArgs(sc *build.StageContext) string {
+	if cloud.Enabled(sc.Config) {
+		if profile, err := cloud.ProfileFor(cloud.Settings(sc.Config).Provider); err == nil {
+			return " " + profile.KernelArgs(sc.TargetArch)
+		}
+	}
+	if !serialConsoleEnabled(sc.Config) {
+		return ""
+	}
+	return " " + serialConsoleArgs(sc.TargetArch)
+}
+
+// configureCloud installs the cloud-init configuration of cloud images,
+// loads the provider's drivers at boot and enables the cloud-init units
+func (s *AssembleStage) configureCloud(sc *build.StageContext) error {
+	if !cloud.Enabled(sc.Config) {
+		return nil
+	}
+	cfg := cloud.Settings(sc.Config)
+	profile, err := cloud.ProfileFor(cfg.Provider)
+	if err != nil {
+		return err
+	}
+
+	if component := s.findComponentByType(sc.Components, "cloud-init"); component != nil && component.LocalPath != "" {
+		log.Info("Installing cloud-init from source", "path", component.LocalPath, "version", component.Version)
+	}
+
+	// A dm-verity root is read-only; its writable /var takes the free space
+	growDevices := []string{"/"}
+	if sc.Config.Security.Verity.Enabled {
+		growDevices = []string{"/var"}
+	}
+	data, err := cloud.RenderConfig(cfg, profile, growDevices)
+	if err != nil {
+		return err
+	}
+	if err := writeRootfsFile(sc.RootfsDir, cloud.ConfigPath, data); err != nil {
+		return fmt.Errorf("failed to write cloud-init configuration: %w", err)
+	}
+
+	modules := "# Drivers of " + string(profile.Provider) + " instances\n" + strings.Join(profile.KernelModules, "\n") + "\n"
+	if err := writeRootfsFile(sc.RootfsDir, cloud.ModulesLoadPath, []byte(modules)); err != nil {
+		return fmt.Errorf("failed to write cloud kernel modules: %w", err)
+	}
+
+	initInstaller := GetInitInstaller(sc.Config.System.Init)
+	for _, svc := range cloud.Services {
+		if initInstaller.Name() == "systemd" {
+			svc += ".service"
+		}
+		if err := initInstaller.EnableService(sc.RootfsDir, svc); err != nil {
+			return fmt.Errorf("failed to enable %s: %w", svc, err)
+		}
+	}
+
+	log.Info("Configured cloud-init", "provider", profile.Provider, "datasources", profile.DatasourceList(cfg), "default_user", cfg.DefaultUser)
+	return nil
+}
+
+// writeRootfsFile writes data to the absolute path name inside rootfs
+func writeRootfsFile(rootfs, name string, data []byte) error {
+	p := filepath.Join(rootfs, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// cloudSeedEnabled reports whether the build publishes a NoCloud seed ISO
+func cloudSeedEnabled(config *db.DistributionConfig) bool {
+	if !cloud.Enabled(config) {
+		return false
+	}
+	cfg := cloud.Settings(config)
+	profile, err := cloud.ProfileFor(cfg.Provider)
+	return err == nil && cloud.SeedEnabled(cfg, profile)
+}
+
+// writeCloudSeed writes the NoCloud seed ISO instances of the image read
+// their user and SSH keys from when booted outside a cloud, and returns
+// its path
+func writeCloudSeed(ctx context.Context, sc *build.StageContext, dir string) (string, error) {
+	cfg := cloud.Settings(sc.Config)
+	staging := filepath.Join(sc.WorkspacePath, "nocloud-seed")
+	if err := os.RemoveAll(staging); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return "", err
+	}
+
+	userData, err := cloud.SeedUserData(cfg)
+	if err != nil {
+		return "", err
+	}
+	metaData := cloud.SeedMetaData("iid-"+sc.BuildID, strings.ToLower(vmDomainNameFor(sc)))
+	if err := os.WriteFile(filepath.Join(staging, "user-data"), userData, 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(staging, "meta-data"), metaData, 0644); err != nil {
+		return "", err
+	}
+
+	args := []string{"-as", "mkisofs", "-o", filepath.Join(dir, cloud.SeedName), "-V", cloud.SeedVolumeID, "-J", "-R"}
+	if sc.SourceDateEpoch != 0 {
+		if err := build.NormalizeTree(staging, sc.SourceDateEpoch); err != nil {
+			return "", fmt.Errorf("failed to normalize seed staging: %w", err)
+		}
+		args = append(args, "--modification-date="+time.Unix(sc.SourceDateEpoch, 0).UTC().Format("2006010215040500"))
+	}
+	args = append(args, staging)
+
+	cmd := exec.CommandContext(ctx, "xorriso", args...)
+	cmd.Env = reproducibleCmdEnv(sc.SourceDateEpoch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("xorriso failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return filepath.Join(dir, cloud.SeedName), nil
+}
+
+// writeGCETarball packs a Compute Engine raw image into the tar.gz it is
+// imported from and returns its path
+func writeGCETarball(sc *build.StageContext, imagePath string) (string, error) {
+	modTime := time.Unix(sc.SourceDateEpoch, 0)
+	if sc.SourceDateEpoch == 0 {
+		modTime = time.Now()
+	}
+	dest := imagePath + cloud.GCETarballSuffix
+	if err := cloud.WriteGCETarball(imagePath, dest, modTime); err != nil {
+		return "", fmt.Errorf("failed to write Compute Engine image: %w", err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,107 @@
+package stages
+
+import (
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func cloudConfig(provider db.CloudProvider) *db.DistributionConfig {
+	return &db.DistributionConfig{
+		System: db.SystemConfig{Init: "systemd"},
+		Target: db.TargetConfig{Type: cloud.TargetType, Cloud: &db.CloudConfig{Provider: provider}},
+	}
+}
+
+func TestValidateCloudConfig(t *testing.T) {
+	if err := ValidateCloudConfig(&db.DistributionConfig{}, db.ImageFormatISO); err != nil {
+		t.Errorf("non-cloud targets: %v", err)
+	}
+	if err := ValidateCloudConfig(cloudConfig(""), db.ImageFormatQCOW2); err != nil {
+		t.Errorf("generic qcow2: %v", err)
+	}
+	if err := ValidateCloudConfig(cloudConfig(db.CloudProviderGCE), db.ImageFormatQCOW2); err == nil {
+		t.Error("expected error for qcow2 Compute Engine images")
+	}
+	if err := ValidateCloudConfig(cloudConfig("azure"), db.ImageFormatRaw); err == nil {
+		t.Error("expected error for unsupported provider")
+	}
+}
+
+func TestConfigureCloud(t *testing.T) {
+	rootfs := t.TempDir()
+	config := cloudConfig(db.CloudProviderAWS)
+	config.Security.Verity.Enabled = true
+	sc := &build.StageContext{RootfsDir: rootfs, Config: config, TargetArch: db.ArchX86_64}
+
+	if err := (&AssembleStage{}).configureCloud(sc); err != nil {
+		t.Fatalf("configureCloud() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootfs, cloud.ConfigPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"- Ec2", "name: ldf", "- /var"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("cloud-init configuration missing %q:\n%s", want, data)
+		}
+	}
+	modules, err := os.ReadFile(filepath.Join(rootfs, cloud.ModulesLoadPath))
+	if err != nil || !strings.Contains(string(modules), "\nena\n") {
+		t.Errorf("unexpected modules-load.d file: %q, %v", modules, err)
+	}
+	for _, svc := range cloud.Services {
+		link := filepath.Join(rootfs, "etc/systemd/system/multi-user.target.wants", svc+".service")
+		if _, err := os.Lstat(link); err != nil {
+			t.Errorf("%s not enabled: %v", svc, err)
+		}
+	}
+
+	if got := imageKernelArgs(sc); got != " console=tty0 console=ttyS0,115200n8 nvme_core.io_timeout=4294967295" {
+		t.Errorf("imageKernelArgs() = %q", got)
+	}
+}
+
+func TestVMDescriptors_CloudSeed(t *testing.T) {
+	sc := &build.StageContext{
+		BuildID:     "0123456789abcdef",
+		TargetArch:  db.ArchX86_64,
+		ImageFormat: db.ImageFormatQCOW2,
+		Config:      cloudConfig(db.CloudProviderGeneric),
+	}
+	dir := t.TempDir()
+	if _, err := writeVMDescriptors(sc, "/out/ldf.qcow2", dir); err != nil {
+		t.Fatalf("writeVMDescriptors() error = %v", err)
+	}
+
+	script, _ := os.ReadFile(filepath.Join(dir, vmScriptName))
+	if !strings.Contains(string(script), `SEED="$(dirname "$IMAGE")"/nocloud-seed.iso`) ||
+		!strings.Contains(string(script), `-drive "if=virtio,format=raw,readonly=on,file=$SEED"`) {
+		t.Errorf("launch script does not attach the seed:\n%s", script)
+	}
+	if !strings.Contains(string(script), "-display none") {
+		t.Error("cloud images should launch headless")
+	}
+	if bash, err := exec.LookPath("bash"); err == nil {
+		if out, err := exec.Command(bash, "-n", filepath.Join(dir, vmScriptName)).CombinedOutput(); err != nil {
+			t.Errorf("launch script has syntax errors: %v\n%s", err, out)
+		}
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, vmDomainName))
+	var domain libvirtDomain
+	if err := xml.Unmarshal(data, &domain); err != nil {
+		t.Fatal(err)
+	}
+	if len(domain.Devices.Disks) != 2 || domain.Devices.Disks[1].Source.File != "/var/lib/libvirt/images/nocloud-seed.iso" || domain.Devices.Disks[1].Target.Dev != "vdb" {
+		t.Errorf("unexpected domain disks: %+v", domain.Devices.Disks)
+	}
+}
@@ -51,6 +51,15 @@ func (s *CompileStage) Validate(ctx context.Context, sc *build.StageContext) err
 		return fmt.Errorf("kernel config not found at %s - prepare stage must run first", configPath)
 	}
 
+	if err := ValidateUBootConfig(sc.Config, sc.BoardProfile, sc.TargetArch); err != nil {
+		return err
+	}
+	if usesUBoot(sc.Config) {
+		if comp := findUBootComponent(sc.Components); comp == nil || comp.LocalPath == "" {
+			return fmt.Errorf("U-Boot source component not resolved - add the u-boot bootloader component")
+		}
+	}
+
 	return nil
 }
 
@@ -171,6 +180,7 @@ func (s *CompileStage) executeInContainer(ctx context.Context, sc *build.StageCo
 	if _, ok := envVars["CROSS_COMPILE"]; !ok && crossCompile != "" {
 		envVars["CROSS_COMPILE"] = crossCompile
 	}
+	applyReproducibleEnv(envVars, sc.SourceDateEpoch)
 
 	// Prepend downloaded toolchain to PATH if mounted
 	if sc.ToolchainDir != "" {
@@ -208,12 +218,23 @@ func (s *CompileStage) executeInContainer(ctx context.Context, sc *build.StageCo
 		}
 	}
 
+	// Build U-Boot for the board when it is the bootloader
+	if usesUBoot(sc.Config) {
+		if err := s.compileUBoot(ctx, sc, crossCompile, progress); err != nil {
+			return err
+		}
+	}
+
 	progress(100, "Kernel compilation complete")
 	return nil
 }
 
 // compileDeviceTrees compiles device tree sources specified by the board profile (container mode)
 func (s *CompileStage) compileDeviceTrees(ctx context.Context, sc *build.StageContext, kernelComp *build.ResolvedComponent, outputDir, makeArch, crossCompile string, progress build.ProgressFunc) error {
+	if err := stageBoardDeviceTrees(sc, kernelComp.LocalPath); err != nil {
+		return err
+	}
+
 	dtbScript := s.generateDTBBuildScript(sc.BoardProfile.Config.DeviceTrees, makeArch, crossCompile)
 	dtbScriptPath := filepath.Join(sc.WorkspacePath, "scripts", "compile-dtbs.sh")
 	if err := os.WriteFile(dtbScriptPath, []byte(dtbScript), 0755); err != nil {
@@ -248,6 +269,7 @@ func (s *CompileStage) compileDeviceTrees(ctx context.Context, sc *build.StageCo
 	if _, ok := dtbEnv["CROSS_COMPILE"]; !ok && crossCompile != "" {
 		dtbEnv["CROSS_COMPILE"] = crossCompile
 	}
+	applyReproducibleEnv(dtbEnv, sc.SourceDateEpoch)
 
 	opts := build.ContainerRunOpts{
 		Image:    dtbContainerImage,
@@ -327,6 +349,7 @@ func (s *CompileStage) executeDirect(ctx context.Context, sc *build.StageContext
 	if _, ok := makeEnv["CROSS_COMPILE"]; !ok && crossCompile != "" {
 		makeEnv["CROSS_COMPILE"] = crossCompile
 	}
+	applyReproducibleEnv(makeEnv, sc.SourceDateEpoch)
 
 	// Prepend downloaded toolchain to PATH if available
 	if sc.ToolchainDir != "" {
@@ -477,6 +500,13 @@ func (s *CompileStage) executeDirect(ctx context.Context, sc *build.StageContext
 		}
 	}
 
+	// Build U-Boot for the board when it is the bootloader
+	if usesUBoot(sc.Config) {
+		if err := s.compileUBoot(ctx, sc, crossCompile, progress); err != nil {
+			return err
+		}
+	}
+
 	progress(100, "Kernel compilation complete")
 	return nil
 }
@@ -592,6 +622,10 @@ func (s *CompileStage) compileDeviceTreesDirect(ctx context.Context, sc *build.S
 	kernelDir := kernelComp.LocalPath
 	dtbsDir := filepath.Join(outputDir, "boot", "dtbs")
 
+	if err := stageBoardDeviceTrees(sc, kernelDir); err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(dtbsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create dtbs directory: %w", err)
 	}
@@ -613,6 +647,7 @@ func (s *CompileStage) compileDeviceTreesDirect(ctx context.Context, sc *build.S
 	if _, ok := dtbDirectEnv["CROSS_COMPILE"]; !ok && crossCompile != "" {
 		dtbDirectEnv["CROSS_COMPILE"] = crossCompile
 	}
+	applyReproducibleEnv(dtbDirectEnv, sc.SourceDateEpoch)
 
 	for i, dt := range sc.BoardProfile.Config.DeviceTrees {
 		dtbTarget := strings.TrimSuffix(dt.Source, ".dts") + ".dtb"
@@ -666,6 +701,17 @@ func (s *CompileStage) compileDeviceTreesDirect(ctx context.Context, sc *build.S
 	return nil
 }
 
+// applyReproducibleEnv pins build timestamps and identity in env when the
+// build runs in reproducible mode
+func applyReproducibleEnv(env map[string]string, epoch int64) {
+	if epoch == 0 {
+		return
+	}
+	for k, v := range build.ReproducibleEnv(epoch) {
+		env[k] = v
+	}
+}
+
 // generateBuildScript creates the kernel build script for container execution
 func (s *CompileStage) generateBuildScript(configMode, makeArch, crossCompile string) string {
 	script := `#!/bin/bash
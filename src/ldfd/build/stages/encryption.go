@@ -0,0 +1,307 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// defaultTPM2PCRs binds TPM2 key slots to the Secure Boot state
+	defaultTPM2PCRs = "7"
+	// luksBuildKeyPath is where the build key waits in the image for the
+	// first-boot service to enroll TPM2 or re-encrypt with
+	luksBuildKeyPath = "etc/ldf/luks-build.key"
+	// luksInitramfsKeyPath is where the initramfs carries the build key
+	// when the first boot must unlock the root unattended
+	luksInitramfsKeyPath = "etc/luks.key"
+	// luksFirstBootService finishes encrypted root setup on first boot
+	luksFirstBootService = "ldf-luks-firstboot.service"
+	// luksFirstBootScript is the script the first-boot service runs
+	luksFirstBootScript = "usr/lib/ldf/luks-firstboot"
+	// luksRecoveryKeyPath receives the recovery key enrolled on first boot
+	// when the volume is re-encrypted
+	luksRecoveryKeyPath = "/root/luks-recovery-key"
+	// luksPrompt is printed by the initramfs before asking for the
+	// passphrase; the boot test answers it with the recovery key
+	luksPrompt = "Enter the passphrase or recovery key for the root volume"
+)
+
+// tpm2PCRsPattern matches systemd-cryptenroll PCR lists such as "7" or "0+7"
+var tpm2PCRsPattern = regexp.MustCompile(`^[0-9]+([+,][0-9]+)*$`)
+
+// ValidateEncryptionConfig reports encrypted root settings that cannot
+// produce a bootable image
+func ValidateEncryptionConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	enc := config.Security.Encryption
+	if !enc.Enabled {
+		return nil
+	}
+	if !isDiskImageFormat(format) {
+		return fmt.Errorf("encrypted root is not supported for %s images", strings.ToUpper(string(format)))
+	}
+	if config.Security.Verity.Enabled {
+		return fmt.Errorf("encrypted root cannot be combined with a dm-verity root")
+	}
+	if config.Update.ABSlots {
+		return fmt.Errorf("encrypted root cannot be combined with the A/B slot layout")
+	}
+	if config.Build.Reproducible {
+		return fmt.Errorf("encrypted root cannot be built reproducibly: every build uses a fresh key")
+	}
+	if enc.TPM2PCRs != "" && !tpm2PCRsPattern.MatchString(enc.TPM2PCRs) {
+		return fmt.Errorf("invalid TPM2 PCR list %q (use e.g. 7 or 0+7)", enc.TPM2PCRs)
+	}
+	if (enc.TPM2 || enc.Reencrypt) && config.System.Init != "systemd" {
+		return fmt.Errorf("TPM2 enrollment and first-boot re-encryption require the systemd init system")
+	}
+	// Firmware cannot read the encrypted root, so the kernel and initramfs
+	// must live on the ESP
+	switch GetBootloaderInstaller(config.Core.Bootloader, "", "").(type) {
+	case *SystemdBootInstaller, *UKIInstaller:
+		return nil
+	default:
+		return fmt.Errorf("encrypted root requires the systemd-boot or uki bootloader")
+	}
+}
+
+// luksDeviceName returns the device-mapper name of an unlocked root, the
+// name systemd-cryptsetup uses for rd.luks.uuid volumes
+func luksDeviceName(luksUUID string) string {
+	return "luks-" + luksUUID
+}
+
+// openEncryptedRoot formats dev as LUKS2 with the build's key and unlocks
+// it, returning the mapped device the filesystem goes on
+func openEncryptedRoot(ctx context.Context, dev string, key *build.DiskKey) (string, error) {
+	cmd := exec.CommandContext(ctx, "cryptsetup", "luksFormat",
+		"--type", "luks2", "--batch-mode",
+		"--uuid", key.LUKSUUID,
+		"--label", "root",
+		"--key-file", key.KeyFile,
+		dev)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cryptsetup luksFormat failed: %s: %s", err, output)
+	}
+
+	name := luksDeviceName(key.LUKSUUID)
+	cmd = exec.CommandContext(ctx, "cryptsetup", "open", "--key-file", key.KeyFile, dev, name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cryptsetup open failed: %s: %s", err, output)
+	}
+	return filepath.Join("/dev/mapper", name), nil
+}
+
+// closeEncryptedRoot locks the root again; it is a no-op once closed
+func closeEncryptedRoot(ctx context.Context, key *build.DiskKey) error {
+	name := luksDeviceName(key.LUKSUUID)
+	if _, err := os.Stat(filepath.Join("/dev/mapper", name)); os.IsNotExist(err) {
+		return nil
+	}
+	if output, err := exec.CommandContext(ctx, "cryptsetup", "close", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("cryptsetup close failed: %s: %s", err, output)
+	}
+	return nil
+}
+
+// addLUKSKernelArgs makes every boot entry under rootfsPath unlock the
+// LUKS volume before mounting the root filesystem
+func addLUKSKernelArgs(rootfsPath, luksUUID, rootUUID string) error {
+	rootArg := "root=UUID=" + rootUUID
+	return replaceInFiles(bootConfigFiles(rootfsPath), rootArg, "rd.luks.uuid="+luksUUID+" "+rootArg)
+}
+
+// configureEncryptedRoot writes crypttab into the mounted image and, when
+// TPM2 enrollment or re-encryption is requested, the first-boot service
+// performing it along with the build key it unlocks with
+func configureEncryptedRoot(mountPoint string, config *db.DistributionConfig, key *build.DiskKey) error {
+	enc := config.Security.Encryption
+
+	options := "luks,discard"
+	if enc.TPM2 {
+		options += ",tpm2-device=auto"
+	}
+	crypttab := fmt.Sprintf("%s UUID=%s none %s\n", luksDeviceName(key.LUKSUUID), key.LUKSUUID, options)
+	if err := os.WriteFile(filepath.Join(mountPoint, "etc", "crypttab"), []byte(crypttab), 0644); err != nil {
+		return fmt.Errorf("failed to write crypttab: %w", err)
+	}
+
+	if !enc.TPM2 && !enc.Reencrypt {
+		return nil
+	}
+
+	keyPath := filepath.Join(mountPoint, luksBuildKeyPath)
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := copyFile(key.KeyFile, keyPath); err != nil {
+		return fmt.Errorf("failed to install build key: %w", err)
+	}
+	if err := os.Chmod(keyPath, 0400); err != nil {
+		return err
+	}
+
+	scriptPath := filepath.Join(mountPoint, luksFirstBootScript)
+	if err := os.MkdirAll(filepath.Dir(scriptPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(luksFirstBootScript), err)
+	}
+	if err := os.WriteFile(scriptPath, []byte(luksFirstBootScriptContent(enc, key.LUKSUUID)), 0755); err != nil {
+		return fmt.Errorf("failed to write first-boot script: %w", err)
+	}
+
+	unit := fmt.Sprintf(`[Unit]
+Description=Finish LDF encrypted root setup
+ConditionPathExists=/%s
+After=local-fs.target
+
+[Service]
+Type=oneshot
+ExecStart=/%s
+RemainAfterExit=yes
+
+[Install]
+WantedBy=multi-user.target
+`, luksBuildKeyPath, luksFirstBootScript)
+	unitPath := filepath.Join(mountPoint, "usr", "lib", "systemd", "system", luksFirstBootService)
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write first-boot unit: %w", err)
+	}
+	return NewSystemdInstaller().EnableService(mountPoint, luksFirstBootService)
+}
+
+// luksFirstBootScriptContent returns the first-boot script. Re-encryption
+// replaces the volume key the build host saw, TPM2 enrollment lets later
+// boots unlock unattended, and with re-encryption a new recovery key
+// finally takes the place of the build key, whose slot is wiped.
+func luksFirstBootScriptContent(enc db.EncryptionConfig, luksUUID string) string {
+	pcrs := enc.TPM2PCRs
+	if pcrs == "" {
+		pcrs = defaultTPM2PCRs
+	}
+
+	var steps strings.Builder
+	if enc.Reencrypt {
+		steps.WriteString(`echo "Re-encrypting root volume..."
+cryptsetup reencrypt --active-name "$NAME" --key-file "$KEY"
+`)
+	}
+	if enc.TPM2 {
+		fmt.Fprintf(&steps, `echo "Enrolling TPM2 (PCRs %[1]s)..."
+systemd-cryptenroll "$DEV" --unlock-key-file="$KEY" --tpm2-device=auto --tpm2-pcrs=%[1]s
+`, pcrs)
+	}
+	if enc.Reencrypt {
+		// The build key is also stored by ldfd and embedded in the
+		// initramfs; a new recovery key replaces it
+		fmt.Fprintf(&steps, `umask 077
+systemd-cryptenroll "$DEV" --unlock-key-file="$KEY" --recovery-key --wipe-slot=password > %[1]s
+echo "New recovery key saved to %[1]s; record it and remove the file"
+`, luksRecoveryKeyPath)
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# Finishes the LUKS2 root setup of an LDF image on its first boot
+set -e
+
+KEY=/%s
+NAME=%s
+DEV=/dev/disk/by-uuid/%s
+
+%s
+rm -f "$KEY"
+`, luksBuildKeyPath, luksDeviceName(luksUUID), luksUUID, steps.String())
+}
+
+// SetEncryptionKeyFile embeds the key an encrypted root was formatted
+// with, so the first boot unlocks it without a prompt
+func (g *InitramfsGenerator) SetEncryptionKeyFile(path string) {
+	g.encryptionKeyFile = path
+}
+
+// encryptionInitBlock returns the init script fragment of the luks hook,
+// unlocking a LUKS2 root named by rd.luks.uuid, or an empty string when
+// the hook is not included. An embedded key is tried first, then TPM2 when
+// systemd-cryptsetup is available, then a passphrase prompt accepting the
+// recovery key, shown by plymouth when the splash is up. The root becomes
+// the unlocked device unless root= names a device on it, such as an LVM
+// volume.
+func (g *InitramfsGenerator) encryptionInitBlock() string {
+	if !g.hasHook(db.InitramfsHookLUKS) {
+		return ""
+	}
+
+	return `# Unlock the LUKS2 encrypted root
+LUKS_UUID=""
+for param in $(cat /proc/cmdline); do
+    case "$param" in
+        rd.luks.uuid=*)
+            LUKS_UUID="${param#rd.luks.uuid=}"
+            LUKS_UUID="${LUKS_UUID#luks-}"
+            ;;
+    esac
+done
+
+if [ -n "$LUKS_UUID" ]; then
+    modprobe dm-crypt 2>/dev/null || true
+
+    LUKS_DEV=""
+    WAIT=0
+    while [ -z "$LUKS_DEV" ] && [ $WAIT -lt 30 ]; do
+        LUKS_DEV=$(findfs "UUID=$LUKS_UUID" 2>/dev/null || true)
+        if [ -z "$LUKS_DEV" ]; then
+            echo "Waiting for encrypted root $LUKS_UUID..."
+            sleep 1
+            WAIT=$((WAIT + 1))
+        fi
+    done
+    if [ -z "$LUKS_DEV" ]; then
+        echo "ERROR: Encrypted root $LUKS_UUID not found!"
+        echo "Dropping to shell..."
+        exec /bin/sh
+    fi
+
+    LUKS_NAME="luks-$LUKS_UUID"
+    UNLOCKED=""
+    if [ -f /` + luksInitramfsKeyPath + ` ] && cryptsetup open --key-file /` + luksInitramfsKeyPath + ` "$LUKS_DEV" "$LUKS_NAME" 2>/dev/null; then
+        UNLOCKED=1
+    fi
+    if [ -z "$UNLOCKED" ] && [ -x /lib/systemd/systemd-cryptsetup ]; then
+        if /lib/systemd/systemd-cryptsetup attach "$LUKS_NAME" "$LUKS_DEV" - tpm2-device=auto,headless=true 2>/dev/null; then
+            UNLOCKED=1
+        fi
+    fi
+    TRIES=0
+    while [ -z "$UNLOCKED" ] && [ $TRIES -lt 3 ]; do
+        echo "` + luksPrompt + `"
+        if plymouth --ping 2>/dev/null; then
+            if plymouth ask-for-password --prompt="` + luksPrompt + `" --command="cryptsetup open --key-file=- $LUKS_DEV $LUKS_NAME"; then
+                UNLOCKED=1
+            fi
+        elif cryptsetup open "$LUKS_DEV" "$LUKS_NAME"; then
+            UNLOCKED=1
+        fi
+        TRIES=$((TRIES + 1))
+    done
+    if [ -z "$UNLOCKED" ]; then
+        echo "ERROR: Failed to unlock encrypted root!"
+        echo "Dropping to shell..."
+        exec /bin/sh
+    fi
+    case "$ROOT" in
+        /dev/*) ;;
+        *) ROOT="/dev/mapper/$LUKS_NAME" ;;
+    esac
+fi
+
+`
+}
@@ -0,0 +1,217 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateEncryptionConfig(t *testing.T) {
+	enabled := func(mutate func(*db.DistributionConfig)) *db.DistributionConfig {
+		config := &db.DistributionConfig{}
+		config.Core.Bootloader = "systemd-boot"
+		config.System.Init = "systemd"
+		config.Security.Encryption.Enabled = true
+		if mutate != nil {
+			mutate(config)
+		}
+		return config
+	}
+
+	tests := []struct {
+		name    string
+		config  *db.DistributionConfig
+		format  db.ImageFormat
+		wantErr string
+	}{
+		{name: "disabled", config: &db.DistributionConfig{}, format: db.ImageFormatISO},
+		{name: "raw image", config: enabled(nil), format: db.ImageFormatRaw},
+		{name: "qcow2 image", config: enabled(nil), format: db.ImageFormatQCOW2},
+		{
+			name: "TPM2 and re-encryption",
+			config: enabled(func(c *db.DistributionConfig) {
+				c.Security.Encryption.TPM2 = true
+				c.Security.Encryption.TPM2PCRs = "0+7"
+				c.Security.Encryption.Reencrypt = true
+			}),
+			format: db.ImageFormatRaw,
+		},
+		{name: "ISO image", config: enabled(nil), format: db.ImageFormatISO, wantErr: "not supported for ISO images"},
+		{
+			name:    "dm-verity",
+			config:  enabled(func(c *db.DistributionConfig) { c.Security.Verity.Enabled = true }),
+			format:  db.ImageFormatRaw,
+			wantErr: "dm-verity",
+		},
+		{
+			name:    "A/B slots",
+			config:  enabled(func(c *db.DistributionConfig) { c.Update.ABSlots = true }),
+			format:  db.ImageFormatRaw,
+			wantErr: "A/B slot",
+		},
+		{
+			name:    "reproducible",
+			config:  enabled(func(c *db.DistributionConfig) { c.Build.Reproducible = true }),
+			format:  db.ImageFormatRaw,
+			wantErr: "reproducibly",
+		},
+		{
+			name:    "invalid PCRs",
+			config:  enabled(func(c *db.DistributionConfig) { c.Security.Encryption.TPM2PCRs = "7,secure" }),
+			format:  db.ImageFormatRaw,
+			wantErr: "invalid TPM2 PCR list",
+		},
+		{
+			name: "TPM2 without systemd",
+			config: enabled(func(c *db.DistributionConfig) {
+				c.System.Init = "openrc"
+				c.Security.Encryption.TPM2 = true
+			}),
+			format:  db.ImageFormatRaw,
+			wantErr: "systemd init",
+		},
+		{
+			name:    "GRUB",
+			config:  enabled(func(c *db.DistributionConfig) { c.Core.Bootloader = "grub2" }),
+			format:  db.ImageFormatRaw,
+			wantErr: "systemd-boot or uki",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEncryptionConfig(tt.config, tt.format)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAddLUKSKernelArgs(t *testing.T) {
+	rootfs := t.TempDir()
+	entries := filepath.Join(rootfs, "boot", "efi", "loader", "entries")
+	if err := os.MkdirAll(entries, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	entry := filepath.Join(entries, "ldf.conf")
+	if err := os.WriteFile(entry, []byte("options root=UUID=fs-uuid ro quiet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fstab := filepath.Join(rootfs, "etc", "fstab")
+	if err := os.WriteFile(fstab, []byte("UUID=fs-uuid / ext4 defaults 0 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := addLUKSKernelArgs(rootfs, "luks-uuid", "fs-uuid"); err != nil {
+		t.Fatalf("addLUKSKernelArgs() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(entry)
+	if !strings.Contains(string(data), "options rd.luks.uuid=luks-uuid root=UUID=fs-uuid ro quiet") {
+		t.Errorf("unexpected boot entry: %s", data)
+	}
+	data, _ = os.ReadFile(fstab)
+	if strings.Contains(string(data), "rd.luks") {
+		t.Errorf("fstab must not change: %s", data)
+	}
+}
+
+func TestConfigureEncryptedRoot(t *testing.T) {
+	keyDir := t.TempDir()
+	key := &build.DiskKey{Dir: keyDir, KeyFile: filepath.Join(keyDir, "root.key"), LUKSUUID: "luks-uuid"}
+	if err := os.WriteFile(key.KeyFile, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("prompt only", func(t *testing.T) {
+		mnt := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(mnt, "etc"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		config := &db.DistributionConfig{}
+		if err := configureEncryptedRoot(mnt, config, key); err != nil {
+			t.Fatalf("configureEncryptedRoot() error = %v", err)
+		}
+		data, _ := os.ReadFile(filepath.Join(mnt, "etc", "crypttab"))
+		if string(data) != "luks-luks-uuid UUID=luks-uuid none luks,discard\n" {
+			t.Errorf("unexpected crypttab: %q", data)
+		}
+		if _, err := os.Stat(filepath.Join(mnt, luksBuildKeyPath)); !os.IsNotExist(err) {
+			t.Error("build key must not be installed without first-boot steps")
+		}
+	})
+
+	t.Run("TPM2 and re-encryption", func(t *testing.T) {
+		mnt := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(mnt, "etc"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		config := &db.DistributionConfig{}
+		config.Security.Encryption = db.EncryptionConfig{Enabled: true, TPM2: true, Reencrypt: true}
+		if err := configureEncryptedRoot(mnt, config, key); err != nil {
+			t.Fatalf("configureEncryptedRoot() error = %v", err)
+		}
+
+		data, _ := os.ReadFile(filepath.Join(mnt, "etc", "crypttab"))
+		if !strings.Contains(string(data), "luks,discard,tpm2-device=auto") {
+			t.Errorf("crypttab missing TPM2 option: %q", data)
+		}
+		info, err := os.Stat(filepath.Join(mnt, luksBuildKeyPath))
+		if err != nil || info.Mode().Perm() != 0400 {
+			t.Errorf("expected read-only build key, got %v %v", info, err)
+		}
+		if _, err := os.Lstat(filepath.Join(mnt, "etc", "systemd", "system", "multi-user.target.wants", luksFirstBootService)); err != nil {
+			t.Errorf("first-boot service not enabled: %v", err)
+		}
+
+		script, _ := os.ReadFile(filepath.Join(mnt, luksFirstBootScript))
+		reencrypt := strings.Index(string(script), "cryptsetup reencrypt")
+		tpm2 := strings.Index(string(script), "--tpm2-device=auto --tpm2-pcrs=7")
+		wipe := strings.Index(string(script), "--recovery-key --wipe-slot=password")
+		if reencrypt < 0 || tpm2 < reencrypt || wipe < tpm2 {
+			t.Errorf("unexpected first-boot steps:\n%s", script)
+		}
+	})
+}
+
+func TestInitramfsGenerator_EncryptionInit(t *testing.T) {
+	config := &db.DistributionConfig{}
+	gen := NewInitramfsGenerator(t.TempDir(), "", config, db.ArchX86_64)
+	if block := gen.encryptionInitBlock(); block != "" {
+		t.Error("expected no unlock step for plain roots")
+	}
+
+	config.Security.Encryption = db.EncryptionConfig{Enabled: true, TPM2: true}
+	block := gen.encryptionInitBlock()
+	for _, want := range []string{
+		`findfs "UUID=$LUKS_UUID"`,
+		"cryptsetup open --key-file /" + luksInitramfsKeyPath,
+		"systemd-cryptsetup attach",
+		luksPrompt,
+		`ROOT="/dev/mapper/$LUKS_NAME"`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("init script missing %q", want)
+		}
+	}
+	modules := strings.Join(gen.getRequiredModules(), " ")
+	for _, want := range []string{"kernel/drivers/md/", "kernel/crypto/", "kernel/drivers/char/tpm/"} {
+		if !strings.Contains(modules, want) {
+			t.Errorf("encryption modules missing %s: %s", want, modules)
+		}
+	}
+}
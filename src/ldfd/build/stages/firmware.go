@@ -0,0 +1,101 @@
+package stages
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/firmware"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// linuxFirmwareComponent is the component providing the linux-firmware tree
+const linuxFirmwareComponent = "linux-firmware"
+
+// firmwareSelection returns the linux-firmware blobs a build installs: the
+// distribution's selection plus the board profile's
+func firmwareSelection(sc *build.StageContext) db.FirmwareSelection {
+	sel := sc.Config.Core.Firmware
+	if sc.BoardProfile != nil {
+		sel = db.MergeFirmwareSelection(sel, sc.BoardProfile.Config.LinuxFirmware)
+	}
+	return sel
+}
+
+// findLinuxFirmwareComponent returns the resolved linux-firmware component
+func findLinuxFirmwareComponent(components []build.ResolvedComponent) *build.ResolvedComponent {
+	for i := range components {
+		if components[i].Component.Name == linuxFirmwareComponent {
+			return &components[i]
+		}
+	}
+	return nil
+}
+
+// installLinuxFirmware installs the selected linux-firmware blobs and
+// writes the firmware report listing modules whose firmware is missing
+func (s *AssembleStage) installLinuxFirmware(sc *build.StageContext) error {
+	modulesDir := filepath.Join(sc.RootfsDir, "lib", "modules")
+	if resolved, err := filepath.EvalSymlinks(modulesDir); err == nil {
+		modulesDir = resolved
+	}
+
+	var modules []firmware.Module
+	var unscanned []string
+	if _, err := os.Stat(modulesDir); err == nil {
+		modules, unscanned, err = firmware.ScanModules(modulesDir)
+		if err != nil {
+			return fmt.Errorf("failed to scan kernel modules: %w", err)
+		}
+	}
+
+	var index *firmware.Index
+	var selection *firmware.Selection
+	var version string
+	if sel := firmwareSelection(sc); !sel.IsEmpty() {
+		comp := findLinuxFirmwareComponent(sc.Components)
+		if comp == nil || comp.LocalPath == "" {
+			return fmt.Errorf("firmware selected but the %s component is not resolved", linuxFirmwareComponent)
+		}
+		version = comp.Version
+
+		var err error
+		index, err = firmware.LoadIndex(comp.LocalPath)
+		if err != nil {
+			return err
+		}
+		selection, err = index.Select(sel, modules)
+		if err != nil {
+			return fmt.Errorf("linux-firmware %s: %w", version, err)
+		}
+		if err := index.Install(selection, sc.RootfsDir); err != nil {
+			return err
+		}
+		log.Info("Installed linux-firmware selection",
+			"version", version,
+			"files", len(selection.Files),
+			"links", len(selection.Links))
+		if len(selection.Unresolved) > 0 {
+			log.Warn("Selected modules reference firmware linux-firmware does not provide",
+				"version", version, "firmware", selection.Unresolved)
+		}
+	}
+
+	report := firmware.NewReport(index, selection, version, modules, unscanned,
+		filepath.Join(sc.RootfsDir, firmware.InstallDir),
+		filepath.Join(sc.RootfsDir, "usr", firmware.InstallDir))
+	if len(report.Missing) > 0 {
+		log.Warn("Kernel modules reference missing firmware", "modules", len(report.Missing))
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(sc.OutputDir, firmware.ReportName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write firmware report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package stages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/archive"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// VMDKImageGenerator creates VMware disk images
+type VMDKImageGenerator struct {
+	rawGenerator *RawImageGenerator
+}
+
+// NewVMDKImageGenerator creates a new VMDK image generator
+func NewVMDKImageGenerator(executor build.Executor, sizeGB int) *VMDKImageGenerator {
+	return &VMDKImageGenerator{rawGenerator: NewRawImageGenerator(executor, sizeGB)}
+}
+
+// Name returns the generator name
+func (g *VMDKImageGenerator) Name() string {
+	return "vmdk"
+}
+
+// Format returns the output image format
+func (g *VMDKImageGenerator) Format() db.ImageFormat {
+	return db.ImageFormatVMDK
+}
+
+// Generate creates a streamOptimized VMDK, the compressed subformat
+// vSphere imports and OVF packages reference
+func (g *VMDKImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	return convertRawImage(ctx, sc, g.rawGenerator, progress, "vmdk", []string{"-o", "subformat=streamOptimized"}, "disk.vmdk")
+}
+
+// VHDXImageGenerator creates Hyper-V disk images
+type VHDXImageGenerator struct {
+	rawGenerator *RawImageGenerator
+}
+
+// NewVHDXImageGenerator creates a new VHDX image generator
+func NewVHDXImageGenerator(executor build.Executor, sizeGB int) *VHDXImageGenerator {
+	return &VHDXImageGenerator{rawGenerator: NewRawImageGenerator(executor, sizeGB)}
+}
+
+// Name returns the generator name
+func (g *VHDXImageGenerator) Name() string {
+	return "vhdx"
+}
+
+// Format returns the output image format
+func (g *VHDXImageGenerator) Format() db.ImageFormat {
+	return db.ImageFormatVHDX
+}
+
+// Generate creates a dynamically sized VHDX
+func (g *VHDXImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	return convertRawImage(ctx, sc, g.rawGenerator, progress, "vhdx", []string{"-o", "subformat=dynamic"}, "disk.vhdx")
+}
+
+// TarballImageGenerator creates zstd-compressed rootfs tarballs for
+// containers and chroots
+type TarballImageGenerator struct{}
+
+// NewTarballImageGenerator creates a new rootfs tarball generator
+func NewTarballImageGenerator() *TarballImageGenerator {
+	return &TarballImageGenerator{}
+}
+
+// Name returns the generator name
+func (g *TarballImageGenerator) Name() string {
+	return "tar.zst"
+}
+
+// Format returns the output image format
+func (g *TarballImageGenerator) Format() db.ImageFormat {
+	return db.ImageFormatTarZst
+}
+
+// Generate writes the rootfs as a tar stream compressed by zstd. The
+// kernel and bootloader are left out.
+func (g *TarballImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	tarballPath := filepath.Join(sc.OutputDir, "ldf-linux-rootfs.tar.zst")
+
+	progress(10, "Archiving root filesystem")
+
+	// Reproducible builds compress single-threaded so the output does not
+	// depend on the build host's core count
+	threads := "-T0"
+	if sc.SourceDateEpoch != 0 {
+		threads = "-T1"
+	}
+	cmd := exec.CommandContext(ctx, "zstd", "-q", "-f", threads, "-12", "-o", tarballPath)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start zstd: %w", err)
+	}
+
+	// Extended attributes carry SELinux labels and file capabilities
+	opts := archiveOptions(sc, kernelContents)
+	opts.Xattrs = true
+	writeErr := archive.WriteTar(stdin, sc.RootfsDir, opts)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("zstd failed: %s: %s", err, stderr.String())
+	}
+	if writeErr != nil {
+		return "", fmt.Errorf("failed to archive rootfs: %w", writeErr)
+	}
+
+	progress(100, "Rootfs tarball created successfully")
+	return tarballPath, nil
+}
+
+// CpioImageGenerator creates gzip-compressed cpio archives of the full
+// system, booted entirely from RAM as the kernel's initramfs
+type CpioImageGenerator struct{}
+
+// NewCpioImageGenerator creates a new cpio image generator
+func NewCpioImageGenerator() *CpioImageGenerator {
+	return &CpioImageGenerator{}
+}
+
+// Name returns the generator name
+func (g *CpioImageGenerator) Name() string {
+	return "cpio"
+}
+
+// Format returns the output image format
+func (g *CpioImageGenerator) Format() db.ImageFormat {
+	return db.ImageFormatCpio
+}
+
+// Generate writes the rootfs as a newc archive. The kernel runs /init from
+// an initramfs, so one pointing at the init system is added when missing.
+func (g *CpioImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	cpioPath := filepath.Join(sc.OutputDir, "ldf-linux.cpio.gz")
+
+	progress(10, "Archiving root filesystem")
+
+	f, err := os.Create(cpioPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cpio archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	// The kernel is published next to the archive, see publishCpioKernel
+	if err := archive.WriteCpio(gz, sc.RootfsDir, archiveOptions(sc, []string{"boot"}), map[string]string{"init": "sbin/init"}); err != nil {
+		return "", fmt.Errorf("failed to archive rootfs: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress cpio archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write cpio archive: %w", err)
+	}
+
+	progress(100, "Cpio archive created successfully")
+	return cpioPath, nil
+}
+
+// publishCpioKernel uploads the kernel booting a cpio archive next to
+// it, as <image>.vmlinuz
+func (s *PackageStage) publishCpioKernel(ctx context.Context, sc *build.StageContext, imagePath, storageKey string) (publishedFile, error) {
+	f := publishedFile{localPath: imagePath + ".vmlinuz", storageKey: storageKey + ".vmlinuz"}
+	if err := copyFile(filepath.Join(sc.RootfsDir, "boot", "vmlinuz"), f.localPath); err != nil {
+		return f, fmt.Errorf("failed to copy kernel: %w", err)
+	}
+	if err := s.uploadToStorage(ctx, f.localPath, f.storageKey, nil); err != nil {
+		return f, fmt.Errorf("failed to upload kernel: %w", err)
+	}
+	return f, nil
+}
+
+// archiveOptions returns the archive options of a build, clamping
+// modification times when the build is reproducible
+func archiveOptions(sc *build.StageContext, exclude []string) archive.Options {
+	opts := archive.Options{ExcludeContents: exclude}
+	if sc.SourceDateEpoch != 0 {
+		opts.ClampMtime = time.Unix(sc.SourceDateEpoch, 0)
+	}
+	return opts
+}
+
+// isDiskImageFormat reports whether format is a partitioned disk image
+// built by the raw generator
+func isDiskImageFormat(format db.ImageFormat) bool {
+	switch format {
+	case db.ImageFormatRaw, db.ImageFormatQCOW2, db.ImageFormatVMDK, db.ImageFormatVHDX:
+		return true
+	}
+	return false
+}
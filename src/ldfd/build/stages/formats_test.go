@@ -0,0 +1,89 @@
+package stages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+func TestGetImageGenerator(t *testing.T) {
+	for _, format := range []db.ImageFormat{
+		db.ImageFormatRaw, db.ImageFormatQCOW2, db.ImageFormatISO, db.ImageFormatOCI,
+		db.ImageFormatVMDK, db.ImageFormatVHDX, db.ImageFormatTarZst, db.ImageFormatCpio,
+	} {
+		if got := GetImageGenerator(format, nil, 4).Format(); got != format {
+			t.Errorf("GetImageGenerator(%s).Format() = %s", format, got)
+		}
+	}
+}
+
+func TestCpioImageGenerator(t *testing.T) {
+	rootfs := t.TempDir()
+	for _, path := range []string{"boot/vmlinuz", "etc/os-release", "sbin/init"} {
+		full := filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc := &build.StageContext{RootfsDir: rootfs, OutputDir: t.TempDir(), SourceDateEpoch: 1700000000}
+	path, err := NewCpioImageGenerator().Generate(context.Background(), sc, func(int, string) {})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("archive is not gzip compressed: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"etc/os-release\x00", "init\x00", "sbin/init\x00"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("archive missing %q", want)
+		}
+	}
+	if bytes.Contains(data, []byte("boot/vmlinuz")) {
+		t.Error("kernel was archived")
+	}
+
+	backend, err := storage.NewLocal(storage.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stage := NewPackageStage(backend, 0)
+	key := "distribution/owner/dist/builds/build/" + filepath.Base(path)
+	published, err := stage.publishCpioKernel(context.Background(), sc, path, key)
+	if err != nil {
+		t.Fatalf("publishCpioKernel() error = %v", err)
+	}
+	if published.storageKey != key+".vmlinuz" {
+		t.Errorf("kernel published as %s", published.storageKey)
+	}
+	rc, _, err := backend.Download(context.Background(), key+".vmlinuz")
+	if err != nil {
+		t.Fatalf("kernel artifact missing: %v", err)
+	}
+	defer rc.Close()
+	if kernel, _ := io.ReadAll(rc); string(kernel) != "boot/vmlinuz" {
+		t.Errorf("unexpected kernel artifact %q", kernel)
+	}
+}
@@ -9,10 +9,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bitswalk/ldf/src/ldfd/build"
 	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/google/uuid"
 )
 
 // ImageGenerator defines the interface for generating bootable images
@@ -57,6 +60,16 @@ func (g *RawImageGenerator) Format() db.ImageFormat {
 
 // Generate creates a raw disk image
 func (g *RawImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	if sc.Config.Security.Verity.Enabled {
+		return g.generateVerity(ctx, sc, progress)
+	}
+	if sc.Config.Update.ABSlots {
+		return g.generateAB(ctx, sc, progress)
+	}
+	if boardImageLayout(sc.BoardProfile) == db.BoardImageLayoutRPi {
+		return g.generateRPi(ctx, sc, progress)
+	}
+
 	imagePath := filepath.Join(sc.OutputDir, "disk.img")
 	sizeMB := g.sizeGB * 1024
 
@@ -69,8 +82,24 @@ func (g *RawImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 
 	progress(10, "Creating partition table")
 
+	// U-Boot loader images sit at board-specific offsets in front of the
+	// first partition, which moves back to make room for them
+	bootloader := GetBootloaderInstaller(sc.Config.Core.Bootloader, "LDF Linux", "1.0")
+	var ubootDir string
+	var ubootImages []db.UBootImage
+	firstSector := int64(defaultFirstSector)
+	if _, ok := bootloader.(*UBootInstaller); ok && sc.BoardProfile != nil {
+		ubootDir = filepath.Join(sc.RootfsDir, ubootInstallDir, sc.BoardProfile.Config.BootParams.UBootBoard)
+		ubootImages = sc.BoardProfile.Config.BootParams.UBootImages
+		sector, err := ubootFirstSector(ubootDir, ubootImages)
+		if err != nil {
+			return "", err
+		}
+		firstSector = sector
+	}
+
 	// Create GPT partition table with ESP and root partitions
-	if err := g.createPartitionTable(ctx, imagePath, sc.TargetArch); err != nil {
+	if err := g.createPartitionTable(ctx, imagePath, firstSector, ubootDir != "", sc.SourceDateEpoch); err != nil {
 		return "", fmt.Errorf("failed to create partitions: %w", err)
 	}
 
@@ -89,23 +118,95 @@ func (g *RawImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 
 	progress(25, "Formatting partitions")
 
-	// Format partitions
-	if err := g.formatPartitions(ctx, loopDev); err != nil {
+	// Pick the root filesystem UUID up front so fstab and the boot
+	// configuration reference the real filesystem
+	rootUUID := uuid.NewString()
+	if sc.SourceDateEpoch != 0 {
+		rootUUID = build.DeterministicUUID(sc.SourceDateEpoch, "rootfs")
+	}
+	if err := SubstituteRootUUID(sc.RootfsDir, rootUUID); err != nil {
+		return "", fmt.Errorf("failed to set root UUID: %w", err)
+	}
+
+	// Encrypted roots put the filesystem inside a LUKS2 volume opened
+	// with the build's key
+	rootDev := loopDev + "p2"
+	if sc.DiskKey != nil {
+		progress(27, "Encrypting root partition")
+		if err := addLUKSKernelArgs(sc.RootfsDir, sc.DiskKey.LUKSUUID, rootUUID); err != nil {
+			return "", fmt.Errorf("failed to add LUKS kernel arguments: %w", err)
+		}
+		mapped, err := openEncryptedRoot(ctx, rootDev, sc.DiskKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt root partition: %w", err)
+		}
+		defer func() {
+			if err := closeEncryptedRoot(ctx, sc.DiskKey); err != nil {
+				log.Warn("Failed to close encrypted root", "device", mapped, "error", err)
+			}
+		}()
+		rootDev = mapped
+	}
+
+	if err := g.formatESP(ctx, loopDev+"p1", sc.SourceDateEpoch); err != nil {
 		return "", fmt.Errorf("failed to format partitions: %w", err)
 	}
 
+	// Reproducible builds never mount the root filesystem read-write: a
+	// mount records mount counts, times and journal state in the
+	// superblock, so boot files are written into the staging tree and the
+	// root is populated at mkfs time instead
+	populate := g.populateMounted
+	if sc.SourceDateEpoch != 0 {
+		populate = g.populateStaged
+	}
+	if err := populate(ctx, sc, bootloader, loopDev, rootDev, rootUUID, progress); err != nil {
+		return "", err
+	}
+
+	if sc.DiskKey != nil {
+		if err := closeEncryptedRoot(ctx, sc.DiskKey); err != nil {
+			return "", err
+		}
+	}
+
+	progress(90, "Detaching loop device")
+
+	// Detach loop device
+	if err := g.detachLoopDevice(ctx, loopDev); err != nil {
+		log.Warn("Failed to detach loop device", "error", err)
+	}
+
+	if len(ubootImages) > 0 {
+		progress(95, "Writing U-Boot images")
+		if err := writeUBootImages(imagePath, ubootDir, ubootImages); err != nil {
+			return "", fmt.Errorf("failed to write U-Boot images: %w", err)
+		}
+	}
+
+	progress(100, "Raw image created successfully")
+	return imagePath, nil
+}
+
+// populateMounted formats the root device, copies the rootfs onto it and
+// installs the boot files with both partitions mounted
+func (g *RawImageGenerator) populateMounted(ctx context.Context, sc *build.StageContext, bootloader BootloaderInstaller, loopDev, rootDev, rootUUID string, progress build.ProgressFunc) error {
+	if err := g.formatRoot(ctx, rootDev, "", rootUUID, 0); err != nil {
+		return fmt.Errorf("failed to format partitions: %w", err)
+	}
+
 	progress(30, "Mounting partitions")
 
 	// Create temporary mount point
 	mountPoint, err := os.MkdirTemp("", "ldf-mount-")
 	if err != nil {
-		return "", fmt.Errorf("failed to create mount point: %w", err)
+		return fmt.Errorf("failed to create mount point: %w", err)
 	}
 	defer os.RemoveAll(mountPoint)
 
 	// Mount root partition
-	if err := g.mountPartitions(ctx, loopDev, mountPoint); err != nil {
-		return "", fmt.Errorf("failed to mount partitions: %w", err)
+	if err := g.mountPartitions(ctx, loopDev+"p1", rootDev, mountPoint); err != nil {
+		return fmt.Errorf("failed to mount partitions: %w", err)
 	}
 	defer func() {
 		if err := g.unmountPartitions(ctx, mountPoint); err != nil {
@@ -117,14 +218,11 @@ func (g *RawImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 
 	// Copy rootfs to mounted image
 	if err := g.copyRootfs(ctx, sc.RootfsDir, mountPoint); err != nil {
-		return "", fmt.Errorf("failed to copy rootfs: %w", err)
+		return fmt.Errorf("failed to copy rootfs: %w", err)
 	}
 
-	progress(70, "Installing bootloader to disk")
-
-	// Install bootloader
-	if err := g.installBootloader(ctx, sc, loopDev, mountPoint); err != nil {
-		return "", fmt.Errorf("failed to install bootloader: %w", err)
+	if err := g.installBootFiles(ctx, sc, bootloader, loopDev, mountPoint, progress); err != nil {
+		return err
 	}
 
 	progress(85, "Syncing and unmounting")
@@ -136,18 +234,115 @@ func (g *RawImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 
 	// Unmount (deferred, but call explicitly for progress reporting)
 	if err := g.unmountPartitions(ctx, mountPoint); err != nil {
-		return "", fmt.Errorf("failed to unmount: %w", err)
+		return fmt.Errorf("failed to unmount: %w", err)
 	}
+	return nil
+}
 
-	progress(90, "Detaching loop device")
+// populateStaged installs the boot files into the staging rootfs with only
+// the ESP mounted, then builds the root filesystem from the finished tree
+// with mkfs.ext4 -d so the root is never mounted
+func (g *RawImageGenerator) populateStaged(ctx context.Context, sc *build.StageContext, bootloader BootloaderInstaller, loopDev, rootDev, rootUUID string, progress build.ProgressFunc) error {
+	progress(30, "Mounting ESP")
 
-	// Detach loop device
-	if err := g.detachLoopDevice(ctx, loopDev); err != nil {
-		log.Warn("Failed to detach loop device", "error", err)
+	espMount := filepath.Join(sc.RootfsDir, "boot", "efi")
+	if err := os.MkdirAll(espMount, 0755); err != nil {
+		return fmt.Errorf("failed to create ESP mount point: %w", err)
 	}
+	if output, err := exec.CommandContext(ctx, "mount", loopDev+"p1", espMount).CombinedOutput(); err != nil {
+		return fmt.Errorf("mount ESP failed: %s: %s", err, output)
+	}
+	mounted := true
+	defer func() {
+		if mounted {
+			if err := exec.CommandContext(ctx, "umount", espMount).Run(); err != nil {
+				log.Warn("Failed to unmount ESP", "mount_point", espMount, "error", err)
+			}
+		}
+	}()
 
-	progress(100, "Raw image created successfully")
-	return imagePath, nil
+	if err := g.installBootFiles(ctx, sc, bootloader, loopDev, sc.RootfsDir, progress); err != nil {
+		return err
+	}
+
+	progress(85, "Normalizing boot files and unmounting ESP")
+	if err := build.NormalizeTree(espMount, sc.SourceDateEpoch); err != nil {
+		return fmt.Errorf("failed to normalize ESP: %w", err)
+	}
+	if err := g.syncFilesystem(ctx, espMount); err != nil {
+		log.Warn("Failed to sync filesystem", "error", err)
+	}
+	if output, err := exec.CommandContext(ctx, "umount", espMount).CombinedOutput(); err != nil {
+		return fmt.Errorf("umount ESP failed: %s: %s", err, output)
+	}
+	mounted = false
+
+	// Boot file installation touched the staging tree after assembly
+	// normalized it
+	if err := build.NormalizeTree(sc.RootfsDir, sc.SourceDateEpoch); err != nil {
+		return fmt.Errorf("failed to normalize rootfs: %w", err)
+	}
+
+	progress(87, "Creating root filesystem")
+
+	// Populating the root at mkfs time makes inode allocation follow the
+	// sorted source tree
+	if err := g.formatRoot(ctx, rootDev, sc.RootfsDir, rootUUID, sc.SourceDateEpoch); err != nil {
+		return fmt.Errorf("failed to format partitions: %w", err)
+	}
+	return nil
+}
+
+// installBootFiles signs the kernel, configures the encrypted root and
+// installs the bootloader into a root tree with the ESP mounted on
+// /boot/efi
+func (g *RawImageGenerator) installBootFiles(ctx context.Context, sc *build.StageContext, bootloader BootloaderInstaller, loopDev, rootDir string, progress build.ProgressFunc) error {
+	if sc.SecureBoot != nil {
+		progress(65, "Signing kernel for Secure Boot")
+		if err := signKernels(ctx, sc.SecureBoot, filepath.Join(rootDir, "boot"), sc.SourceDateEpoch); err != nil {
+			return fmt.Errorf("failed to sign kernel: %w", err)
+		}
+	}
+
+	if sc.DiskKey != nil {
+		if err := configureEncryptedRoot(rootDir, sc.Config, sc.DiskKey); err != nil {
+			return fmt.Errorf("failed to configure encrypted root: %w", err)
+		}
+	}
+
+	progress(70, "Installing bootloader to disk")
+
+	// Install bootloader
+	if err := g.installBootloader(ctx, bootloader, loopDev, sc.TargetArch, rootDir); err != nil {
+		return fmt.Errorf("failed to install bootloader: %w", err)
+	}
+
+	if uki, ok := bootloader.(*UKIInstaller); ok {
+		progress(75, "Assembling unified kernel image")
+		if err := assembleUKI(ctx, sc, uki, rootDir, filepath.Join(rootDir, "etc", "kernel", "cmdline"),
+			filepath.Join(rootDir, "boot", "efi")); err != nil {
+			return fmt.Errorf("failed to assemble UKI: %w", err)
+		}
+	}
+
+	// Firmware cannot read an encrypted root, so systemd-boot loads the
+	// kernel and initramfs from the ESP
+	if _, ok := bootloader.(*SystemdBootInstaller); ok && sc.DiskKey != nil {
+		if err := copyKernelFiles(rootDir, filepath.Join(rootDir, "boot", "efi")); err != nil {
+			return fmt.Errorf("failed to install kernel to ESP: %w", err)
+		}
+	}
+
+	if sc.SecureBoot != nil {
+		progress(80, "Signing EFI binaries for Secure Boot")
+		signed, err := signESP(ctx, sc.SecureBoot, filepath.Join(rootDir, "boot", "efi"), sc.SourceDateEpoch)
+		if err != nil {
+			return fmt.Errorf("failed to sign EFI binaries: %w", err)
+		}
+		log.Info("Signed EFI binaries", "files", signed)
+	}
+
+	return nil
 }
 
 // createSparseImage creates a sparse disk image file
@@ -163,8 +358,10 @@ func (g *RawImageGenerator) createSparseImage(path string, sizeMB int) error {
 	return f.Truncate(int64(sizeMB) * 1024 * 1024)
 }
 
-// createPartitionTable creates GPT partition table with ESP and root
-func (g *RawImageGenerator) createPartitionTable(ctx context.Context, imagePath string, arch db.TargetArch) error {
+// createPartitionTable creates GPT partition table with ESP and root,
+// starting the ESP at firstSector. legacyBoot marks the root partition
+// for U-Boot distro boot, which scans it for extlinux.conf.
+func (g *RawImageGenerator) createPartitionTable(ctx context.Context, imagePath string, firstSector int64, legacyBoot bool, epoch int64) error {
 	// Use sgdisk for GPT partitioning
 	// Partition 1: EFI System Partition (512MB)
 	// Partition 2: Root partition (rest)
@@ -172,10 +369,22 @@ func (g *RawImageGenerator) createPartitionTable(ctx context.Context, imagePath
 		// Clear existing partition table
 		fmt.Sprintf("sgdisk --zap-all %s", imagePath),
 		// Create ESP (512MB, type EF00)
-		fmt.Sprintf("sgdisk --new=1:2048:+512M --typecode=1:EF00 --change-name=1:ESP %s", imagePath),
+		fmt.Sprintf("sgdisk --new=1:%d:+512M --typecode=1:EF00 --change-name=1:ESP %s", firstSector, imagePath),
 		// Create root partition (rest of disk, type 8300 for Linux)
 		fmt.Sprintf("sgdisk --new=2:0:0 --typecode=2:8300 --change-name=2:root %s", imagePath),
 	}
+	if legacyBoot {
+		commands = append(commands, fmt.Sprintf("sgdisk --attributes=2:set:2 %s", imagePath))
+	}
+
+	// Pin disk and partition GUIDs for reproducible builds
+	if epoch != 0 {
+		commands = append(commands, fmt.Sprintf("sgdisk --disk-guid=%s --partition-guid=1:%s --partition-guid=2:%s %s",
+			build.DeterministicUUID(epoch, "disk"),
+			build.DeterministicUUID(epoch, "esp"),
+			build.DeterministicUUID(epoch, "root"),
+			imagePath))
+	}
 
 	for _, cmd := range commands {
 		parts := strings.Fields(cmd)
@@ -211,31 +420,53 @@ func (g *RawImageGenerator) detachLoopDevice(ctx context.Context, loopDev string
 	return cmd.Run()
 }
 
-// formatPartitions formats the ESP and root partitions
-func (g *RawImageGenerator) formatPartitions(ctx context.Context, loopDev string) error {
-	espDev := loopDev + "p1"
-	rootDev := loopDev + "p2"
+// formatPartitions formats the ESP and the root device, which is the
+// unlocked LUKS volume when the root is encrypted. Reproducible builds
+// populate the root filesystem from rootfsDir at mkfs time.
+func (g *RawImageGenerator) formatPartitions(ctx context.Context, espDev, rootDev, rootfsDir, rootUUID string, epoch int64) error {
+	if err := g.formatESP(ctx, espDev, epoch); err != nil {
+		return err
+	}
+	if epoch == 0 {
+		rootfsDir = ""
+	}
+	return g.formatRoot(ctx, rootDev, rootfsDir, rootUUID, epoch)
+}
 
-	// Format ESP as FAT32
-	cmd := exec.CommandContext(ctx, "mkfs.fat", "-F32", "-n", "ESP", espDev)
+// formatESP formats the ESP as FAT32
+func (g *RawImageGenerator) formatESP(ctx context.Context, espDev string, epoch int64) error {
+	fatArgs := []string{"-F32", "-n", "ESP"}
+	if epoch != 0 {
+		fatArgs = append(fatArgs, "-i", build.DeterministicVolumeID(epoch, "esp"), "--invariant")
+	}
+	cmd := exec.CommandContext(ctx, "mkfs.fat", append(fatArgs, espDev)...)
+	cmd.Env = reproducibleCmdEnv(epoch)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("mkfs.fat failed: %s: %s", err, output)
 	}
+	return nil
+}
 
-	// Format root as ext4
-	cmd = exec.CommandContext(ctx, "mkfs.ext4", "-L", "root", "-F", rootDev)
+// formatRoot formats the root device as ext4, populating it from
+// rootfsDir when one is given
+func (g *RawImageGenerator) formatRoot(ctx context.Context, rootDev, rootfsDir, rootUUID string, epoch int64) error {
+	extArgs := []string{"-L", "root", "-F", "-U", rootUUID}
+	if epoch != 0 {
+		extArgs = append(extArgs, "-E", "hash_seed="+rootUUID+",root_owner=0:0")
+	}
+	if rootfsDir != "" {
+		extArgs = append(extArgs, "-d", rootfsDir)
+	}
+	cmd := exec.CommandContext(ctx, "mkfs.ext4", append(extArgs, rootDev)...)
+	cmd.Env = reproducibleCmdEnv(epoch)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("mkfs.ext4 failed: %s: %s", err, output)
 	}
-
 	return nil
 }
 
-// mountPartitions mounts the root and ESP partitions
-func (g *RawImageGenerator) mountPartitions(ctx context.Context, loopDev, mountPoint string) error {
-	rootDev := loopDev + "p2"
-	espDev := loopDev + "p1"
-
+// mountPartitions mounts the root device and the ESP
+func (g *RawImageGenerator) mountPartitions(ctx context.Context, espDev, rootDev, mountPoint string) error {
 	// Mount root partition
 	cmd := exec.CommandContext(ctx, "mount", rootDev, mountPoint)
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -269,10 +500,10 @@ func (g *RawImageGenerator) unmountPartitions(ctx context.Context, mountPoint st
 	return cmd.Run()
 }
 
-// copyRootfs copies the assembled rootfs to the mounted image
+// copyRootfs copies the assembled rootfs to the mounted image, keeping
+// hard links, ACLs and extended attributes such as SELinux labels
 func (g *RawImageGenerator) copyRootfs(ctx context.Context, srcDir, dstDir string) error {
-	// Use rsync for efficient copy preserving permissions
-	cmd := exec.CommandContext(ctx, "rsync", "-aAX", "--info=progress2",
+	cmd := exec.CommandContext(ctx, "rsync", "-aHAX", "--numeric-ids", "--info=progress2",
 		srcDir+"/", dstDir+"/")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -280,9 +511,8 @@ func (g *RawImageGenerator) copyRootfs(ctx context.Context, srcDir, dstDir strin
 }
 
 // installBootloader installs the bootloader to the disk image
-func (g *RawImageGenerator) installBootloader(ctx context.Context, sc *build.StageContext, loopDev, mountPoint string) error {
-	bootloader := GetBootloaderInstaller(sc.Config.Core.Bootloader, "LDF Linux", "1.0")
-	commands := bootloader.GetInstallCommands(loopDev, sc.TargetArch)
+func (g *RawImageGenerator) installBootloader(ctx context.Context, bootloader BootloaderInstaller, loopDev string, arch db.TargetArch, mountPoint string) error {
+	commands := bootloader.GetInstallCommands(loopDev, arch)
 
 	for _, cmdStr := range commands {
 		parts := strings.Fields(cmdStr)
@@ -333,28 +563,34 @@ func (g *QCOW2ImageGenerator) Format() db.ImageFormat {
 
 // Generate creates a QCOW2 image by first generating raw, then converting
 func (g *QCOW2ImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	var args []string
+	if g.compression {
+		args = append(args, "-c")
+	}
+	return convertRawImage(ctx, sc, g.rawGenerator, progress, "qcow2", args, "disk.qcow2")
+}
+
+// convertRawImage generates a raw disk image and converts it with qemu-img
+// to format, passing args to the conversion
+func convertRawImage(ctx context.Context, sc *build.StageContext, raw *RawImageGenerator, progress build.ProgressFunc, format string, args []string, filename string) (string, error) {
 	// Generate raw image first (scaled progress 0-80%)
 	rawProgress := func(percent int, msg string) {
 		scaledPercent := int(float64(percent) * 0.8)
 		progress(scaledPercent, msg)
 	}
 
-	rawPath, err := g.rawGenerator.Generate(ctx, sc, rawProgress)
+	rawPath, err := raw.Generate(ctx, sc, rawProgress)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate raw image: %w", err)
 	}
 
-	progress(82, "Converting to QCOW2 format")
+	progress(82, fmt.Sprintf("Converting to %s format", strings.ToUpper(format)))
 
-	// Convert to QCOW2
-	qcow2Path := filepath.Join(sc.OutputDir, "disk.qcow2")
-	args := []string{"convert", "-f", "raw", "-O", "qcow2"}
-	if g.compression {
-		args = append(args, "-c")
-	}
-	args = append(args, rawPath, qcow2Path)
+	outputPath := filepath.Join(sc.OutputDir, filename)
+	cmdArgs := append([]string{"convert", "-f", "raw", "-O", format}, args...)
+	cmdArgs = append(cmdArgs, rawPath, outputPath)
 
-	cmd := exec.CommandContext(ctx, "qemu-img", args...)
+	cmd := exec.CommandContext(ctx, "qemu-img", cmdArgs...)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return "", fmt.Errorf("qemu-img convert failed: %s: %s", err, output)
 	}
@@ -366,8 +602,8 @@ func (g *QCOW2ImageGenerator) Generate(ctx context.Context, sc *build.StageConte
 		log.Warn("Failed to remove raw image", "path", rawPath, "error", err)
 	}
 
-	progress(100, "QCOW2 image created successfully")
-	return qcow2Path, nil
+	progress(100, fmt.Sprintf("%s image created successfully", strings.ToUpper(format)))
+	return outputPath, nil
 }
 
 // ISOImageGenerator creates bootable ISO images
@@ -434,21 +670,35 @@ func (g *ISOImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 	if err := g.copyBootFiles(sc.RootfsDir, bootDir); err != nil {
 		return "", fmt.Errorf("failed to copy boot files: %w", err)
 	}
+	if sc.SecureBoot != nil {
+		if err := signKernels(ctx, sc.SecureBoot, bootDir, sc.SourceDateEpoch); err != nil {
+			return "", fmt.Errorf("failed to sign kernel: %w", err)
+		}
+	}
 
 	progress(25, "Creating squashfs image")
 
 	// Create squashfs of rootfs for LiveOS
 	squashfsPath := filepath.Join(isoStaging, "LiveOS", "squashfs.img")
-	if err := g.createSquashfs(ctx, sc.RootfsDir, squashfsPath); err != nil {
+	if err := g.createSquashfs(ctx, sc.RootfsDir, squashfsPath, sc.SourceDateEpoch); err != nil {
 		return "", fmt.Errorf("failed to create squashfs: %w", err)
 	}
 
 	progress(50, "Setting up GRUB for ISO boot")
 
 	// Create GRUB config for ISO
-	if err := g.createISOGrubConfig(isoStaging, sc.TargetArch); err != nil {
+	if err := g.createISOGrubConfig(isoStaging, sc.TargetArch, imageKernelArgs(sc), sc.Config.Build.Live); err != nil {
 		return "", fmt.Errorf("failed to create GRUB config: %w", err)
 	}
+	if sc.Config.Build.Live.Installer && sc.Config.Build.Live.Answers != "" {
+		answersPath := filepath.Join(isoStaging, filepath.FromSlash(installerAnswersPath))
+		if err := os.MkdirAll(filepath.Dir(answersPath), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(answersPath, []byte(sc.Config.Build.Live.Answers), 0644); err != nil {
+			return "", fmt.Errorf("failed to write installer answer file: %w", err)
+		}
+	}
 
 	progress(60, "Creating EFI boot image")
 
@@ -461,7 +711,7 @@ func (g *ISOImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 	progress(75, "Generating ISO image")
 
 	// Generate ISO using xorriso
-	if err := g.generateISO(ctx, isoStaging, isoPath, sc.TargetArch); err != nil {
+	if err := g.generateISO(ctx, isoStaging, isoPath, sc.TargetArch, sc.SourceDateEpoch); err != nil {
 		return "", fmt.Errorf("failed to generate ISO: %w", err)
 	}
 
@@ -476,6 +726,12 @@ func (g *ISOImageGenerator) Generate(ctx context.Context, sc *build.StageContext
 
 // copyBootFiles copies kernel and initramfs to ISO boot directory
 func (g *ISOImageGenerator) copyBootFiles(rootfsDir, bootDir string) error {
+	return copyKernelFiles(rootfsDir, bootDir)
+}
+
+// copyKernelFiles copies the kernel and initramfs from the rootfs to
+// bootDir as vmlinuz and initramfs.img
+func copyKernelFiles(rootfsDir, bootDir string) error {
 	files := map[string]string{
 		"boot/vmlinuz":       "vmlinuz",
 		"boot/initramfs.img": "initramfs.img",
@@ -505,23 +761,38 @@ func (g *ISOImageGenerator) copyBootFiles(rootfsDir, bootDir string) error {
 }
 
 // createSquashfs creates a squashfs image of the rootfs
-func (g *ISOImageGenerator) createSquashfs(ctx context.Context, rootfsDir, outputPath string) error {
-	cmd := exec.CommandContext(ctx, "mksquashfs", rootfsDir, outputPath,
-		"-comp", "xz", "-Xbcj", "x86", "-b", "1M", "-no-recovery")
+func (g *ISOImageGenerator) createSquashfs(ctx context.Context, rootfsDir, outputPath string, epoch int64) error {
+	return makeSquashfs(ctx, rootfsDir, outputPath, epoch)
+}
+
+// makeSquashfs packs rootfsDir into a compressed squashfs image, extended
+// attributes included. A non-zero epoch pins ownership and timestamps for
+// reproducible output.
+func makeSquashfs(ctx context.Context, rootfsDir, outputPath string, epoch int64) error {
+	args := []string{rootfsDir, outputPath, "-comp", "xz", "-Xbcj", "x86", "-b", "1M", "-no-recovery", "-xattrs"}
+	if epoch != 0 {
+		args = append(args, "-all-root", "-reproducible",
+			"-mkfs-time", strconv.FormatInt(epoch, 10),
+			"-all-time", strconv.FormatInt(epoch, 10))
+	}
+	cmd := exec.CommandContext(ctx, "mksquashfs", args...)
+	cmd.Env = reproducibleCmdEnv(epoch)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-// createISOGrubConfig creates GRUB configuration for ISO boot
-func (g *ISOImageGenerator) createISOGrubConfig(isoStaging string, arch db.TargetArch) error {
+// createISOGrubConfig creates GRUB configuration for ISO boot. kernelArgs
+// is appended to the default live entry; live adds the installer and
+// persistent session entries.
+func (g *ISOImageGenerator) createISOGrubConfig(isoStaging string, arch db.TargetArch, kernelArgs string, live db.LiveConfig) error {
 	grubCfg := `# GRUB configuration for LDF Linux Live ISO
 
 set timeout=10
 set default=0
 
 menuentry "LDF Linux (Live)" {
-    linux /boot/vmlinuz root=live:CDLABEL=%s rd.live.image quiet
+    linux /boot/vmlinuz root=live:CDLABEL=%s rd.live.image quiet%s
     initrd /boot/initramfs.img
 }
 
@@ -530,7 +801,26 @@ menuentry "LDF Linux (Live, Debug)" {
     initrd /boot/initramfs.img
 }
 `
-	grubCfg = fmt.Sprintf(grubCfg, g.volumeID, g.volumeID)
+	grubCfg = fmt.Sprintf(grubCfg, g.volumeID, kernelArgs, g.volumeID)
+
+	entry := func(title, args string) {
+		grubCfg += fmt.Sprintf(`
+menuentry "LDF Linux (%s)" {
+    linux /boot/vmlinuz root=live:CDLABEL=%s rd.live.image quiet%s %s
+    initrd /boot/initramfs.img
+}
+`, title, g.volumeID, kernelArgs, args)
+	}
+	if live.Persistence {
+		// Session changes go to LiveOS/overlay on the LDF_PERSIST partition
+		entry("Live, Persistent", "rd.live.overlay=LABEL="+livePersistLabel+" rd.live.overlay.overlayfs=1")
+	}
+	if live.Installer {
+		entry("Install", "ldf.install")
+		if live.Answers != "" {
+			entry("Install, Unattended", "ldf.install ldf.install.answers=/"+installerAnswersPath)
+		}
+	}
 
 	grubCfgPath := filepath.Join(isoStaging, "boot", "grub", "grub.cfg")
 	return os.WriteFile(grubCfgPath, []byte(grubCfg), 0644)
@@ -553,7 +843,12 @@ func (g *ISOImageGenerator) createEFIImage(ctx context.Context, sc *build.StageC
 	f.Close()
 
 	// Format as FAT
-	cmd := exec.CommandContext(ctx, "mkfs.fat", "-F12", outputPath)
+	fatArgs := []string{"-F12"}
+	if sc.SourceDateEpoch != 0 {
+		fatArgs = append(fatArgs, "-i", build.DeterministicVolumeID(sc.SourceDateEpoch, "iso-efi"), "--invariant")
+	}
+	cmd := exec.CommandContext(ctx, "mkfs.fat", append(fatArgs, outputPath)...)
+	cmd.Env = reproducibleCmdEnv(sc.SourceDateEpoch)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("mkfs.fat for EFI failed: %s: %s", err, output)
 	}
@@ -619,6 +914,16 @@ func (g *ISOImageGenerator) createEFIImage(ctx context.Context, sc *build.StageC
 		}
 		if err := copyFile(efiSrc, efiDst); err != nil {
 			log.Warn("Failed to copy EFI bootloader", "error", err)
+		} else if sc.SecureBoot != nil {
+			if err := signEFIBinary(ctx, sc.SecureBoot, efiDst, sc.SourceDateEpoch); err != nil {
+				return fmt.Errorf("failed to sign EFI bootloader: %w", err)
+			}
+		}
+	}
+
+	if sc.SourceDateEpoch != 0 {
+		if err := build.NormalizeTree(filepath.Join(mountPoint, "EFI"), sc.SourceDateEpoch); err != nil {
+			return fmt.Errorf("failed to normalize EFI image: %w", err)
 		}
 	}
 
@@ -626,7 +931,7 @@ func (g *ISOImageGenerator) createEFIImage(ctx context.Context, sc *build.StageC
 }
 
 // generateISO generates the final ISO image using xorriso
-func (g *ISOImageGenerator) generateISO(ctx context.Context, isoStaging, outputPath string, arch db.TargetArch) error {
+func (g *ISOImageGenerator) generateISO(ctx context.Context, isoStaging, outputPath string, arch db.TargetArch, epoch int64) error {
 	args := []string{
 		"-as", "mkisofs",
 		"-o", outputPath,
@@ -641,15 +946,37 @@ func (g *ISOImageGenerator) generateISO(ctx context.Context, isoStaging, outputP
 		"-e", "boot/efi.img",
 		"-no-emul-boot",
 		"-isohybrid-gpt-basdat",
-		isoStaging,
 	}
+	if epoch != 0 {
+		// xorriso honours SOURCE_DATE_EPOCH for volume timestamps and UUID;
+		// the staging tree still needs its own mtimes clamped
+		if err := build.NormalizeTree(isoStaging, epoch); err != nil {
+			return fmt.Errorf("failed to normalize ISO staging: %w", err)
+		}
+		args = append(args, "--modification-date="+time.Unix(epoch, 0).UTC().Format("2006010215040500"))
+	}
+	args = append(args, isoStaging)
 
 	cmd := exec.CommandContext(ctx, "xorriso", args...)
+	cmd.Env = reproducibleCmdEnv(epoch)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
+// reproducibleCmdEnv returns the environment for image tool commands,
+// adding the reproducible build variables when epoch is set
+func reproducibleCmdEnv(epoch int64) []string {
+	env := os.Environ()
+	if epoch == 0 {
+		return env
+	}
+	for k, v := range build.ReproducibleEnv(epoch) {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
 // GetImageGenerator returns the appropriate image generator for the format
 func GetImageGenerator(format db.ImageFormat, executor build.Executor, sizeGB int) ImageGenerator {
 	switch format {
@@ -657,6 +984,18 @@ func GetImageGenerator(format db.ImageFormat, executor build.Executor, sizeGB in
 		return NewQCOW2ImageGenerator(executor, sizeGB, true)
 	case db.ImageFormatISO:
 		return NewISOImageGenerator(executor, "", "")
+	case db.ImageFormatVMDK:
+		return NewVMDKImageGenerator(executor, sizeGB)
+	case db.ImageFormatVHDX:
+		return NewVHDXImageGenerator(executor, sizeGB)
+	case db.ImageFormatTarZst:
+		return NewTarballImageGenerator()
+	case db.ImageFormatCpio:
+		return NewCpioImageGenerator()
+	case db.ImageFormatOCI:
+		return NewOCIImageGenerator()
+	case db.ImageFormatNetboot:
+		return NewNetbootImageGenerator()
 	default:
 		return NewRawImageGenerator(executor, sizeGB)
 	}
@@ -87,7 +87,9 @@ func (i *SystemdInstaller) Install(rootfsPath string, component *build.ResolvedC
 	return nil
 }
 
-// Configure configures systemd
+// Configure configures systemd. The journal is configured with the
+// system logger by configureLogging; networking, locale and keymap from
+// the distribution's settings by the rootfs builder.
 func (i *SystemdInstaller) Configure(rootfsPath string) error {
 	defaultTarget := filepath.Join(rootfsPath, "etc", "systemd", "system", "default.target")
 	os.Remove(defaultTarget)
@@ -100,41 +102,6 @@ func (i *SystemdInstaller) Configure(rootfsPath string) error {
 		return fmt.Errorf("failed to create machine-id: %w", err)
 	}
 
-	journaldConf := `[Journal]
-Storage=persistent
-Compress=yes
-SystemMaxUse=500M
-`
-	journaldPath := filepath.Join(rootfsPath, "etc", "systemd", "journald.conf")
-	if err := os.WriteFile(journaldPath, []byte(journaldConf), 0644); err != nil {
-		return fmt.Errorf("failed to write journald.conf: %w", err)
-	}
-
-	networkConf := `[Match]
-Name=*
-
-[Network]
-DHCP=yes
-`
-	networkPath := filepath.Join(rootfsPath, "etc", "systemd", "network", "80-dhcp.network")
-	if err := os.WriteFile(networkPath, []byte(networkConf), 0644); err != nil {
-		return fmt.Errorf("failed to write network config: %w", err)
-	}
-
-	localeConf := `LANG=en_US.UTF-8
-`
-	localePath := filepath.Join(rootfsPath, "etc", "locale.conf")
-	if err := os.WriteFile(localePath, []byte(localeConf), 0644); err != nil {
-		return fmt.Errorf("failed to write locale.conf: %w", err)
-	}
-
-	vconsoleConf := `KEYMAP=us
-`
-	vconsolePath := filepath.Join(rootfsPath, "etc", "vconsole.conf")
-	if err := os.WriteFile(vconsolePath, []byte(vconsoleConf), 0644); err != nil {
-		return fmt.Errorf("failed to write vconsole.conf: %w", err)
-	}
-
 	log.Info("Configured systemd")
 	return nil
 }
@@ -282,7 +249,7 @@ stop() {
 // EnableService enables an OpenRC service
 func (i *OpenRCInstaller) EnableService(rootfsPath, serviceName string) error {
 	runlevel := "default"
-	if serviceName == "hostname" || serviceName == "network" {
+	if serviceName == "hostname" || serviceName == "network" || serviceName == "keymaps" {
 		runlevel = "boot"
 	}
 
@@ -1,11 +1,19 @@
 package stages
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/bitswalk/ldf/src/ldfd/build/archive"
 	"github.com/bitswalk/ldf/src/ldfd/db"
 )
 
@@ -15,6 +23,11 @@ type InitramfsGenerator struct {
 	outputPath string
 	config     *db.DistributionConfig
 	targetArch db.TargetArch
+	epoch      int64
+	netboot    bool
+	live       bool
+	// encryptionKeyFile is embedded to unlock an encrypted root unattended
+	encryptionKeyFile string
 }
 
 // NewInitramfsGenerator creates a new initramfs generator
@@ -27,8 +40,26 @@ func NewInitramfsGenerator(rootfsPath, outputPath string, config *db.Distributio
 	}
 }
 
+// SetSourceDateEpoch enables reproducible packing with timestamps clamped
+// to epoch
+func (g *InitramfsGenerator) SetSourceDateEpoch(epoch int64) {
+	g.epoch = epoch
+}
+
+// SetNetboot adds the network drivers and init logic needed to fetch or
+// mount the root filesystem over the network
+func (g *InitramfsGenerator) SetNetboot(netboot bool) {
+	g.netboot = netboot
+}
+
+// SetLive adds the init logic that boots the squashfs root of a live
+// ISO, optionally keeping session changes on a persistence partition
+func (g *InitramfsGenerator) SetLive(live bool) {
+	g.live = live
+}
+
 // Generate creates the initramfs image
-func (g *InitramfsGenerator) Generate() error {
+func (g *InitramfsGenerator) Generate(ctx context.Context) error {
 	// Create temporary directory for initramfs contents
 	initramfsDir, err := os.MkdirTemp("", "ldf-initramfs-")
 	if err != nil {
@@ -56,12 +87,12 @@ func (g *InitramfsGenerator) Generate() error {
 		return fmt.Errorf("failed to generate init: %w", err)
 	}
 
-	// Generate the cpio archive script
-	if err := g.generatePackScript(initramfsDir); err != nil {
-		return fmt.Errorf("failed to generate pack script: %w", err)
+	// Pack the cpio archive, behind the early microcode archive
+	if err := g.pack(ctx, initramfsDir); err != nil {
+		return fmt.Errorf("failed to pack initramfs: %w", err)
 	}
 
-	log.Info("Generated initramfs contents", "dir", initramfsDir)
+	log.Info("Generated initramfs", "path", g.outputPath, "compression", initramfsCompression(g.config))
 	return nil
 }
 
@@ -99,28 +130,13 @@ func (g *InitramfsGenerator) createStructure(initramfsDir string) error {
 
 // copyModules copies required kernel modules to initramfs
 func (g *InitramfsGenerator) copyModules(initramfsDir string) error {
-	// Find kernel modules directory
-	modulesBase := filepath.Join(g.rootfsPath, "lib", "modules")
-	entries, err := os.ReadDir(modulesBase)
-	if err != nil {
-		log.Warn("No kernel modules found", "error", err)
-		return nil
-	}
-
-	// Find the kernel version directory
-	var kernelVersion string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			kernelVersion = entry.Name()
-			break
-		}
-	}
-
+	kernelVersion := kernelModulesVersion(g.rootfsPath)
 	if kernelVersion == "" {
-		log.Warn("No kernel version directory found")
+		log.Warn("No kernel modules found in rootfs")
 		return nil
 	}
 
+	modulesBase := filepath.Join(g.rootfsPath, "lib", "modules")
 	srcModulesDir := filepath.Join(modulesBase, kernelVersion)
 	dstModulesDir := filepath.Join(initramfsDir, "lib", "modules", kernelVersion)
 
@@ -153,6 +169,21 @@ func (g *InitramfsGenerator) copyModules(initramfsDir string) error {
 	return nil
 }
 
+// kernelModulesVersion returns the kernel version the rootfs has modules
+// for, or an empty string when it has none
+func kernelModulesVersion(rootfsPath string) string {
+	entries, err := os.ReadDir(filepath.Join(rootfsPath, "lib", "modules"))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
 // getRequiredModules returns module patterns required for booting
 func (g *InitramfsGenerator) getRequiredModules() []string {
 	modules := []string{
@@ -166,6 +197,33 @@ func (g *InitramfsGenerator) getRequiredModules() []string {
 		"kernel/fs/ext4/*.ko*",
 	}
 
+	// dm-verity roots need device-mapper and the read-only filesystem
+	if g.config.Security.Verity.Enabled {
+		modules = append(modules, "kernel/drivers/md/*.ko*")
+		switch verityFilesystem(g.config.Security.Verity) {
+		case db.VerityFilesystemSquashFS:
+			modules = append(modules, "kernel/fs/squashfs/*.ko*")
+		default:
+			modules = append(modules, "kernel/fs/erofs/*.ko*")
+		}
+	}
+
+	for _, hook := range resolveInitramfsHooks(g.config, g.netboot) {
+		modules = append(modules, initramfsHooks[hook].modules...)
+	}
+
+	// Network roots are a squashfs image or NFS export (see the network
+	// and nfs hooks) made writable by an overlay
+	if g.netboot {
+		modules = append(modules, "kernel/fs/squashfs/*.ko*", "kernel/fs/overlayfs/*.ko*")
+	}
+
+	// Live roots are a squashfs image on an ISO 9660 medium
+	if g.live {
+		modules = append(modules, "kernel/fs/squashfs/*.ko*", "kernel/fs/overlayfs/*.ko*",
+			"kernel/fs/isofs/*.ko*", "kernel/drivers/cdrom/*.ko*", "kernel/fs/fat/*.ko*")
+	}
+
 	// Add filesystem-specific modules based on config
 	switch strings.ToLower(g.config.System.Filesystem.Type) {
 	case "xfs":
@@ -228,7 +286,16 @@ exit 1
 	essentialCommands := []string{
 		"sh", "mount", "umount", "switch_root",
 		"cat", "echo", "ls", "mkdir", "mknod",
-		"sleep", "modprobe", "insmod",
+		"sleep", "modprobe", "insmod", "findfs",
+	}
+	for _, hook := range resolveInitramfsHooks(g.config, g.netboot) {
+		essentialCommands = append(essentialCommands, initramfsHooks[hook].applets...)
+	}
+	if g.netboot {
+		essentialCommands = append(essentialCommands, "wget", "losetup", "cp")
+	}
+	if g.live {
+		essentialCommands = append(essentialCommands, "losetup")
 	}
 
 	binDir := filepath.Join(initramfsDir, "bin")
@@ -240,9 +307,73 @@ exit 1
 		}
 	}
 
+	// udhcpc leaves interface configuration to a script
+	if g.hasHook(db.InitramfsHookNetwork) {
+		scriptPath := filepath.Join(initramfsDir, "etc", "udhcpc.script")
+		if err := os.WriteFile(scriptPath, []byte(udhcpcScript), 0755); err != nil {
+			return fmt.Errorf("failed to write udhcpc script: %w", err)
+		}
+	}
+
+	// busybox has no dm-verity support; take veritysetup from the rootfs
+	if g.config.Security.Verity.Enabled {
+		copied, err := g.copyRootfsTool(initramfsDir, "veritysetup", "sbin/veritysetup")
+		if err != nil {
+			return err
+		}
+		if !copied {
+			log.Warn("veritysetup not found in rootfs; dm-verity root cannot be opened at boot")
+		}
+	}
+
+	// Tools and configuration of the selected hooks
+	if err := g.copyHookFiles(initramfsDir); err != nil {
+		return err
+	}
+
+	if g.hasHook(db.InitramfsHookLUKS) {
+		_, err := os.Stat(filepath.Join(initramfsDir, "lib", "systemd", "systemd-cryptsetup"))
+		if g.config.Security.Encryption.TPM2 && err != nil {
+			log.Warn("systemd-cryptsetup not found in rootfs; TPM2 unlocking is unavailable in the initramfs")
+		}
+		if g.encryptionKeyFile != "" {
+			dst := filepath.Join(initramfsDir, luksInitramfsKeyPath)
+			if err := copyFile(g.encryptionKeyFile, dst); err != nil {
+				return fmt.Errorf("failed to embed encryption key: %w", err)
+			}
+			if err := os.Chmod(dst, 0400); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
+// copyRootfsTool copies a binary busybox lacks, and the shared libraries
+// it needs, from the rootfs to dst in the initramfs, reporting whether it
+// was found
+func (g *InitramfsGenerator) copyRootfsTool(initramfsDir, name, dst string) (bool, error) {
+	for _, dir := range []string{"usr/sbin", "sbin", "usr/bin", "usr/lib/systemd", "lib/systemd"} {
+		src := filepath.Join(g.rootfsPath, dir, name)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dstPath := filepath.Join(initramfsDir, dst)
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+			return false, err
+		}
+		if err := copyFile(src, dstPath); err != nil {
+			return false, fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+		if err := g.copyLibraries(initramfsDir, dstPath); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
 // generateInit generates the init script
 func (g *InitramfsGenerator) generateInit(initramfsDir string) error {
 	// Determine root filesystem type
@@ -294,7 +425,7 @@ for param in $(cat /proc/cmdline); do
     esac
 done
 
-# Wait for root device
+%s# Wait for root device
 WAIT=0
 while [ ! -e "$ROOT" ] && [ $WAIT -lt 30 ]; do
     echo "Waiting for root device $ROOT..."
@@ -333,12 +464,13 @@ fi
 
 # Clean up and switch root
 echo "Switching to root filesystem..."
+%s
 umount /proc
 umount /sys
 
 # Use switch_root to pivot to real root
 exec switch_root /mnt/root /sbin/init
-`, fsType)
+`, fsType, g.hookInitBlocks()+g.netbootInitBlock()+g.liveInitBlock()+g.verityInitBlock()+g.slotInitBlock(), plymouthNewRoot)
 
 	initPath := filepath.Join(initramfsDir, "init")
 	if err := os.WriteFile(initPath, []byte(initScript), 0755); err != nil {
@@ -349,73 +481,413 @@ exec switch_root /mnt/root /sbin/init
 	return nil
 }
 
-// generatePackScript generates a script to create the cpio archive
-func (g *InitramfsGenerator) generatePackScript(initramfsDir string) error {
-	packScript := fmt.Sprintf(`#!/bin/bash
-# Pack initramfs into cpio archive
-# Run this script from within the initramfs directory
+// verityInitBlock returns the init script fragment that opens a dm-verity
+// protected root before it is mounted, or an empty string when the root is
+// writable. Parameters follow systemd-veritysetup-generator naming.
+func (g *InitramfsGenerator) verityInitBlock() string {
+	if !g.config.Security.Verity.Enabled {
+		return ""
+	}
 
-set -e
+	return fmt.Sprintf(`# Open the dm-verity protected root
+ROOTHASH=""
+VERITY_DATA=""
+VERITY_HASH=""
+for param in $(cat /proc/cmdline); do
+    case "$param" in
+        roothash=*)
+            ROOTHASH="${param#roothash=}"
+            ;;
+        systemd.verity_root_data=*)
+            VERITY_DATA="${param#systemd.verity_root_data=}"
+            ;;
+        systemd.verity_root_hash=*)
+            VERITY_HASH="${param#systemd.verity_root_hash=}"
+            ;;
+    esac
+done
+
+# Resolve PARTUUID=, UUID= and LABEL= specs to device paths
+resolve_device() {
+    case "$1" in
+        /dev/*) echo "$1" ;;
+        *) findfs "$1" 2>/dev/null || true ;;
+    esac
+}
+
+if [ -n "$ROOTHASH" ]; then
+    modprobe dm-verity 2>/dev/null || true
+    modprobe %s 2>/dev/null || true
+
+    DATA_DEV=""
+    HASH_DEV=""
+    WAIT=0
+    while [ $WAIT -lt 30 ]; do
+        DATA_DEV=$(resolve_device "$VERITY_DATA")
+        HASH_DEV=$(resolve_device "$VERITY_HASH")
+        [ -n "$DATA_DEV" ] && [ -n "$HASH_DEV" ] && break
+        echo "Waiting for verity devices..."
+        sleep 1
+        WAIT=$((WAIT + 1))
+    done
+
+    if [ -z "$DATA_DEV" ] || [ -z "$HASH_DEV" ]; then
+        echo "ERROR: dm-verity devices $VERITY_DATA / $VERITY_HASH not found!"
+        echo "Dropping to shell..."
+        exec /bin/sh
+    fi
+
+    echo "Opening dm-verity root ($ROOTHASH)..."
+    if ! veritysetup open "$DATA_DEV" %s "$HASH_DEV" "$ROOTHASH"; then
+        echo "ERROR: dm-verity root hash verification failed!"
+        echo "Dropping to shell..."
+        exec /bin/sh
+    fi
+    ROOTFLAGS="ro"
+fi
+
+`, verityFilesystem(g.config.Security.Verity), verityDeviceName)
+}
+
+// udhcpcScript applies the lease busybox udhcpc obtains to the interface
+const udhcpcScript = `#!/bin/sh
+case "$1" in
+    bound|renew)
+        ip addr flush dev "$interface"
+        ip addr add "$ip/${mask:-24}" dev "$interface"
+        for gw in $router; do
+            ip route add default via "$gw" dev "$interface"
+            break
+        done
+        : > /etc/resolv.conf
+        for ns in $dns; do
+            echo "nameserver $ns" >> /etc/resolv.conf
+        done
+        ;;
+esac
+`
+
+// netbootInitBlock returns the init script fragment that boots from a
+// network root, or an empty string for disk images. The network hook has
+// brought up an interface by then. root=live:<url> downloads a squashfs
+// image into RAM and root=nfs:<server>:<path> mounts an export; either
+// way a tmpfs overlay makes the root writable. The overlay lives under
+// /run, which is moved into the new root.
+func (g *InitramfsGenerator) netbootInitBlock() string {
+	if !g.netboot {
+		return ""
+	}
+
+	return `# Boot from a network root
+case "$ROOT" in
+    live:http://*|live:https://*|nfs:*)
+        modprobe squashfs 2>/dev/null || true
+        modprobe overlay 2>/dev/null || true
+
+        mount -t tmpfs -o mode=755 tmpfs /run
+        mkdir -p /run/netroot/lower /run/netroot/upper /run/netroot/work
+
+        case "$ROOT" in
+            live:*)
+                echo "Downloading root filesystem from ${ROOT#live:}..."
+                if ! wget -O /run/netroot/rootfs.squashfs "${ROOT#live:}"; then
+                    echo "ERROR: Failed to download root filesystem!"
+                    echo "Dropping to shell..."
+                    exec /bin/sh
+                fi
+                mount -t squashfs -o loop,ro /run/netroot/rootfs.squashfs /run/netroot/lower
+                ;;
+            nfs:*)
+                modprobe nfs 2>/dev/null || true
+                echo "Mounting root filesystem from ${ROOT#nfs:}..."
+                if ! mount -t nfs -o ro,nolock "${ROOT#nfs:}" /run/netroot/lower; then
+                    echo "ERROR: Failed to mount NFS root!"
+                    echo "Dropping to shell..."
+                    exec /bin/sh
+                fi
+                ;;
+        esac
+
+        mount -t overlay overlay -o lowerdir=/run/netroot/lower,upperdir=/run/netroot/upper,workdir=/run/netroot/work /mnt/root
+        cp /etc/resolv.conf /mnt/root/etc/resolv.conf 2>/dev/null || true
+
+        echo "Switching to root filesystem..."
+        ` + plymouthNewRoot + `
+        mkdir -p /mnt/root/run
+        mount --move /run /mnt/root/run
+        umount /proc
+        umount /sys
+        exec switch_root /mnt/root /sbin/init
+        ;;
+esac
+
+`
+}
 
-INITRAMFS_DIR="%s"
-OUTPUT="%s"
+// liveInitBlock returns the init script fragment that boots a live ISO,
+// or an empty string for other images. root=live:CDLABEL=<label> names
+// the medium carrying LiveOS/squashfs.img, mounted at the paths dracut's
+// dmsquash-live uses so ldf-install finds it either way. The overlay is
+// a tmpfs unless rd.live.overlay=LABEL=<label> names a partition keeping
+// session changes in its LiveOS directory.
+func (g *InitramfsGenerator) liveInitBlock() string {
+	if !g.live {
+		return ""
+	}
 
-cd "$INITRAMFS_DIR"
+	return `# Boot from a live medium
+case "$ROOT" in
+    live:CDLABEL=*|live:LABEL=*)
+        modprobe isofs 2>/dev/null || true
+        modprobe sr_mod 2>/dev/null || true
+        modprobe squashfs 2>/dev/null || true
+        modprobe overlay 2>/dev/null || true
+
+        LIVE_LABEL="${ROOT#live:*LABEL=}"
+        OVERLAY=""
+        for param in $(cat /proc/cmdline); do
+            case "$param" in
+                rd.live.overlay=LABEL=*) OVERLAY="${param#rd.live.overlay=}" ;;
+            esac
+        done
+
+        WAIT=0
+        LIVE_DEV=$(findfs "LABEL=$LIVE_LABEL" 2>/dev/null || true)
+        while [ -z "$LIVE_DEV" ] && [ $WAIT -lt 30 ]; do
+            echo "Waiting for live medium $LIVE_LABEL..."
+            sleep 1
+            WAIT=$((WAIT + 1))
+            LIVE_DEV=$(findfs "LABEL=$LIVE_LABEL" 2>/dev/null || true)
+        done
+        if [ -z "$LIVE_DEV" ]; then
+            echo "ERROR: Live medium $LIVE_LABEL not found!"
+            echo "Dropping to shell..."
+            exec /bin/sh
+        fi
+
+        mount -t tmpfs -o mode=755 tmpfs /run
+        mkdir -p /run/initramfs/live /run/initramfs/squashfs /run/initramfs/overlayfs
+        mount -o ro "$LIVE_DEV" /run/initramfs/live
+        mount -t squashfs -o loop,ro /run/initramfs/live/LiveOS/squashfs.img /run/initramfs/squashfs
+
+        UPPER=/run/initramfs/overlayfs/overlay
+        WORKDIR=/run/initramfs/overlayfs/ovlwork
+        if [ -n "$OVERLAY" ]; then
+            PERSIST_DEV=$(findfs "$OVERLAY" 2>/dev/null || true)
+            if [ -n "$PERSIST_DEV" ] && mount "$PERSIST_DEV" /run/initramfs/overlayfs; then
+                echo "Keeping session changes on $OVERLAY"
+                UPPER=/run/initramfs/overlayfs/LiveOS/overlay
+                WORKDIR=/run/initramfs/overlayfs/LiveOS/ovlwork
+            else
+                echo "WARNING: $OVERLAY not found, session changes will not persist"
+            fi
+        fi
+        mkdir -p "$UPPER" "$WORKDIR"
+
+        mount -t overlay overlay -o lowerdir=/run/initramfs/squashfs,upperdir="$UPPER",workdir="$WORKDIR" /mnt/root
+
+        echo "Switching to root filesystem..."
+        ` + plymouthNewRoot + `
+        mkdir -p /mnt/root/run
+        mount --move /run /mnt/root/run
+        umount /proc
+        umount /sys
+        exec switch_root /mnt/root /sbin/init
+        ;;
+esac
+
+`
+}
+
+// slotInitBlock returns the init script fragment that resolves an A/B
+// root given as root=PARTLABEL=<slot> to its device, or an empty string
+// for single-root images. busybox findfs has no PARTLABEL support, so the
+// partition names the kernel exports in sysfs are matched instead.
+func (g *InitramfsGenerator) slotInitBlock() string {
+	if !g.config.Update.ABSlots {
+		return ""
+	}
+
+	return `# Resolve the A/B root slot from its GPT partition name
+case "$ROOT" in
+    PARTLABEL=*)
+        SLOT_LABEL="${ROOT#PARTLABEL=}"
+        WAIT=0
+        while [ "${ROOT#PARTLABEL=}" = "$SLOT_LABEL" ] && [ $WAIT -lt 30 ]; do
+            for uevent in /sys/class/block/*/uevent; do
+                DEVNAME=""
+                PARTNAME=""
+                while IFS="=" read -r key value; do
+                    case "$key" in
+                        DEVNAME) DEVNAME="$value" ;;
+                        PARTNAME) PARTNAME="$value" ;;
+                    esac
+                done < "$uevent"
+                if [ "$PARTNAME" = "$SLOT_LABEL" ]; then
+                    ROOT="/dev/$DEVNAME"
+                fi
+            done
+            if [ "${ROOT#PARTLABEL=}" = "$SLOT_LABEL" ]; then
+                echo "Waiting for root slot $SLOT_LABEL..."
+                sleep 1
+                WAIT=$((WAIT + 1))
+            fi
+        done
+        ;;
+esac
+
+`
+}
+
+// pack writes the initramfs archive to the output path. The early cpio
+// carrying CPU microcode, which the kernel requires uncompressed, comes
+// first.
+func (g *InitramfsGenerator) pack(ctx context.Context, initramfsDir string) error {
+	if err := os.MkdirAll(filepath.Dir(g.outputPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(g.outputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-# Create cpio archive
-find . -print0 | cpio --null -ov --format=newc 2>/dev/null | gzip -9 > "$OUTPUT"
+	if !g.config.Core.Initramfs.NoMicrocode {
+		if err := g.writeEarlyMicrocode(f); err != nil {
+			return fmt.Errorf("failed to add early microcode: %w", err)
+		}
+	}
 
-echo "Created initramfs: $OUTPUT"
-ls -lh "$OUTPUT"
-`, initramfsDir, g.outputPath)
+	opts := archive.Options{}
+	if g.epoch != 0 {
+		opts.ClampMtime = time.Unix(g.epoch, 0)
+	}
+	err = compressStream(ctx, f, initramfsCompression(g.config), func(w io.Writer) error {
+		return archive.WriteCpio(w, initramfsDir, opts, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
 
-	scriptPath := filepath.Join(initramfsDir, "pack-initramfs.sh")
-	if err := os.WriteFile(scriptPath, []byte(packScript), 0755); err != nil {
-		return fmt.Errorf("failed to write pack script: %w", err)
+// initramfsCompression returns the configured compression, gzip by default
+func initramfsCompression(config *db.DistributionConfig) db.InitramfsCompression {
+	if config.Core.Initramfs.Compression == "" {
+		return db.InitramfsCompressionGzip
 	}
+	return config.Core.Initramfs.Compression
+}
 
+// compressorCommand returns the command compressing stdin to stdout in a
+// format the kernel can unpack: xz with CRC32 checks and lz4 in its legacy
+// frame format. xz and zstd run single-threaded so the output does not
+// depend on the build host's core count.
+func compressorCommand(compression db.InitramfsCompression) []string {
+	switch compression {
+	case db.InitramfsCompressionXZ:
+		return []string{"xz", "-9", "--check=crc32", "-T1", "-c"}
+	case db.InitramfsCompressionZstd:
+		return []string{"zstd", "-q", "-19", "-T1", "-c"}
+	case db.InitramfsCompressionLZ4:
+		return []string{"lz4", "-l", "-9", "-q", "-c"}
+	}
 	return nil
 }
 
-// GetInitramfsScript returns a script that can be run inside a container to create the initramfs
-func GetInitramfsScript(initramfsDir, outputPath, fsType string) string {
-	return fmt.Sprintf(`#!/bin/bash
-set -e
+// compressStream passes the stream produced by write through the
+// compressor into w. gzip is done in-process, without a header timestamp.
+func compressStream(ctx context.Context, w io.Writer, compression db.InitramfsCompression, write func(io.Writer) error) error {
+	args := compressorCommand(compression)
+	if args == nil {
+		gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		if err := write(gz); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
 
-INITRAMFS_DIR="%s"
-OUTPUT="%s"
-FSTYPE="%s"
+	writeErr := write(stdin)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %s: %s", args[0], err, stderr.String())
+	}
+	return writeErr
+}
 
-# Ensure initramfs directory structure exists
-mkdir -p "$INITRAMFS_DIR"/{bin,sbin,etc,lib,lib/modules,lib64,dev,proc,sys,run,mnt/root,usr/{bin,sbin,lib},tmp}
+// microcodeSources maps the early microcode file names the kernel loads
+// to the glob patterns of the firmware files bundled into them
+var microcodeSources = map[string][]string{
+	"GenuineIntel.bin": {"lib/firmware/intel-ucode/*", "usr/lib/firmware/intel-ucode/*"},
+	"AuthenticAMD.bin": {"lib/firmware/amd-ucode/microcode_amd*.bin", "usr/lib/firmware/amd-ucode/microcode_amd*.bin"},
+}
 
-# Create minimal init script
-cat > "$INITRAMFS_DIR/init" << 'INITEOF'
-#!/bin/sh
-set -e
-mount -t proc none /proc
-mount -t sysfs none /sys
-mount -t devtmpfs none /dev
-echo "LDF Initramfs starting..."
-ROOT=""
-for param in $(cat /proc/cmdline); do
-    case "$param" in
-        root=*) ROOT="${param#root=}" ;;
-    esac
-done
-WAIT=0
-while [ ! -e "$ROOT" ] && [ $WAIT -lt 30 ]; do
-    sleep 1
-    WAIT=$((WAIT + 1))
-done
-mount -t %s "$ROOT" /mnt/root
-exec switch_root /mnt/root /sbin/init
-INITEOF
-chmod 755 "$INITRAMFS_DIR/init"
-
-# Pack into cpio archive
-cd "$INITRAMFS_DIR"
-find . -print0 | cpio --null -ov --format=newc 2>/dev/null | gzip -9 > "$OUTPUT"
-echo "Created initramfs: $OUTPUT"
-`, initramfsDir, outputPath, fsType, fsType)
+// writeEarlyMicrocode writes an uncompressed cpio holding the rootfs CPU
+// microcode under kernel/x86/microcode, where the kernel applies it before
+// unpacking the rest of the initramfs. Nothing is written for other
+// architectures or when the rootfs has no microcode.
+func (g *InitramfsGenerator) writeEarlyMicrocode(w io.Writer) error {
+	if g.targetArch != db.ArchX86_64 {
+		return nil
+	}
+
+	earlyDir, err := os.MkdirTemp("", "ldf-microcode-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(earlyDir)
+
+	found := false
+	ucodeDir := filepath.Join(earlyDir, "kernel", "x86", "microcode")
+	for name, patterns := range microcodeSources {
+		var blobs []string
+		for _, pattern := range patterns {
+			matches, _ := filepath.Glob(filepath.Join(g.rootfsPath, pattern))
+			blobs = append(blobs, matches...)
+		}
+		if len(blobs) == 0 {
+			continue
+		}
+		sort.Strings(blobs)
+
+		var data []byte
+		for _, blob := range blobs {
+			content, err := os.ReadFile(blob)
+			if err != nil {
+				return err
+			}
+			data = append(data, content...)
+		}
+		if err := os.MkdirAll(ucodeDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(ucodeDir, name), data, 0644); err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+
+	opts := archive.Options{}
+	if g.epoch != 0 {
+		opts.ClampMtime = time.Unix(g.epoch, 0)
+	}
+	return archive.WriteCpio(w, earlyDir, opts, nil)
 }
@@ -0,0 +1,294 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// externalInitramfsScript is the script running an external initramfs
+// generator, written to the workspace scripts directory
+const externalInitramfsScript = "initramfs.sh"
+
+// dracutModules maps initramfs hooks to the dracut modules providing them
+var dracutModules = map[db.InitramfsHook]string{
+	db.InitramfsHookLVM:      "lvm",
+	db.InitramfsHookMDRAID:   "mdraid",
+	db.InitramfsHookLUKS:     "crypt",
+	db.InitramfsHookNFS:      "nfs",
+	db.InitramfsHookNetwork:  "network",
+	db.InitramfsHookPlymouth: "plymouth",
+}
+
+// mkinitcpioHooks maps initramfs hooks to the mkinitcpio hooks providing
+// them. luks selects the systemd-based hooks, which understand the
+// rd.luks.uuid argument LDF images boot with.
+var mkinitcpioHooks = map[db.InitramfsHook]string{
+	db.InitramfsHookLVM:      "lvm2",
+	db.InitramfsHookMDRAID:   "mdadm_udev",
+	db.InitramfsHookLUKS:     "sd-encrypt",
+	db.InitramfsHookNFS:      "net",
+	db.InitramfsHookNetwork:  "net",
+	db.InitramfsHookPlymouth: "plymouth",
+}
+
+// initramfsGenerator returns the configured initramfs generator, builtin
+// by default
+func initramfsGenerator(config *db.DistributionConfig) db.InitramfsGeneratorType {
+	if config.Core.Initramfs.Generator == "" {
+		return db.InitramfsGeneratorBuiltin
+	}
+	return config.Core.Initramfs.Generator
+}
+
+// ValidateInitramfsConfig reports initramfs settings that cannot produce a
+// bootable image
+func ValidateInitramfsConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	cfg := config.Core.Initramfs
+
+	generator := initramfsGenerator(config)
+	switch generator {
+	case db.InitramfsGeneratorBuiltin, db.InitramfsGeneratorDracut, db.InitramfsGeneratorMkinitcpio:
+	default:
+		return fmt.Errorf("unsupported initramfs generator %q (use builtin, dracut or mkinitcpio)", cfg.Generator)
+	}
+
+	switch cfg.Compression {
+	case "", db.InitramfsCompressionGzip, db.InitramfsCompressionXZ, db.InitramfsCompressionZstd, db.InitramfsCompressionLZ4:
+	default:
+		return fmt.Errorf("unsupported initramfs compression %q (use gzip, xz, zstd or lz4)", cfg.Compression)
+	}
+
+	for _, hook := range cfg.Hooks {
+		if _, ok := initramfsHooks[hook]; !ok {
+			return fmt.Errorf("unknown initramfs hook %q (use lvm, mdraid, luks, nfs, network or plymouth)", hook)
+		}
+	}
+
+	if generator == db.InitramfsGeneratorBuiltin {
+		return nil
+	}
+	// Only the builtin initramfs can carry the build key
+	if config.Security.Encryption.Enabled && config.Security.Encryption.Reencrypt {
+		return fmt.Errorf("first-boot re-encryption requires the builtin initramfs generator")
+	}
+	if config.Update.ABSlots {
+		return fmt.Errorf("the A/B slot layout requires the builtin initramfs generator")
+	}
+	if generator == db.InitramfsGeneratorMkinitcpio {
+		netboot := format == db.ImageFormatNetboot
+		if netboot {
+			return fmt.Errorf("mkinitcpio cannot boot network roots; use the builtin or dracut generator")
+		}
+		if config.Security.Verity.Enabled {
+			return fmt.Errorf("mkinitcpio cannot open dm-verity roots; use the builtin or dracut generator")
+		}
+		hooks := resolveInitramfsHooks(config, netboot)
+		if containsHook(hooks, db.InitramfsHookLUKS) && containsHook(hooks, db.InitramfsHookNetwork) {
+			return fmt.Errorf("mkinitcpio cannot combine the luks and network hooks: its net hook does not run with systemd hooks")
+		}
+	}
+	return nil
+}
+
+// containsHook reports whether hooks includes hook
+func containsHook(hooks []db.InitramfsHook, hook db.InitramfsHook) bool {
+	for _, h := range hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// generateExternalInitramfs builds the initramfs at outputPath with the
+// dracut or mkinitcpio installed in the rootfs, run chrooted into it by
+// the build executor
+func generateExternalInitramfs(ctx context.Context, sc *build.StageContext, outputPath string) error {
+	if sc.Executor == nil {
+		return fmt.Errorf("build executor not available - no executor configured")
+	}
+	kernelVersion := kernelModulesVersion(sc.RootfsDir)
+	if kernelVersion == "" {
+		return fmt.Errorf("no kernel modules found in rootfs")
+	}
+	target, err := filepath.Rel(sc.RootfsDir, outputPath)
+	if err != nil || strings.HasPrefix(target, "..") {
+		return fmt.Errorf("initramfs output %s is outside the rootfs", outputPath)
+	}
+
+	script, err := externalInitramfsCommand(sc.Config, sc.ImageFormat, kernelVersion, "/"+filepath.ToSlash(target), sc.SourceDateEpoch)
+	if err != nil {
+		return err
+	}
+	scriptsDir := filepath.Join(sc.WorkspacePath, "scripts")
+	if err := os.MkdirAll(scriptsDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(scriptsDir, externalInitramfsScript), []byte(script), 0755); err != nil {
+		return fmt.Errorf("failed to write initramfs script: %w", err)
+	}
+
+	env := map[string]string{"ROOTFS": sc.RootfsDir}
+	applyReproducibleEnv(env, sc.SourceDateEpoch)
+
+	var output bytes.Buffer
+	var logOutput io.Writer = &output
+	if sc.LogWriter != nil {
+		logOutput = io.MultiWriter(&output, sc.LogWriter)
+	}
+	opts := build.ContainerRunOpts{
+		Env:     env,
+		Command: []string{"/bin/sh", filepath.Join(scriptsDir, externalInitramfsScript)},
+		Stdout:  logOutput,
+		Stderr:  logOutput,
+	}
+	// The script mounts the API filesystems into the rootfs and chroots
+	if sc.Executor.RuntimeType().IsContainerRuntime() {
+		opts.Image = sc.Executor.DefaultImage()
+		if sc.BuildEnv != nil {
+			opts.Image = sc.BuildEnv.ContainerImage
+			opts.Platform = sc.BuildEnv.ContainerPlatformFlag
+		}
+		opts.Mounts = []build.Mount{
+			{Source: sc.RootfsDir, Target: "/rootfs"},
+			{Source: scriptsDir, Target: "/scripts", ReadOnly: true},
+		}
+		opts.Privileged = true
+		env["ROOTFS"] = "/rootfs"
+		opts.Command = []string{"/bin/sh", "/scripts/" + externalInitramfsScript}
+	}
+
+	generator := initramfsGenerator(sc.Config)
+	if err := sc.Executor.Run(ctx, opts); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", generator, err, strings.TrimSpace(output.String()))
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		return fmt.Errorf("%s did not produce %s", generator, target)
+	}
+	return nil
+}
+
+// externalInitramfsCommand returns the shell script running the configured
+// generator inside the rootfs at $ROOTFS, writing the initramfs for
+// kernelVersion to target, a path inside the rootfs
+func externalInitramfsCommand(config *db.DistributionConfig, format db.ImageFormat, kernelVersion, target string, epoch int64) (string, error) {
+	hooks := resolveInitramfsHooks(config, format == db.ImageFormatNetboot)
+	compression := initramfsCompression(config)
+	microcode := !config.Core.Initramfs.NoMicrocode
+
+	var run string
+	switch initramfsGenerator(config) {
+	case db.InitramfsGeneratorDracut:
+		var modules []string
+		for _, hook := range hooks {
+			modules = appendUnique(modules, dracutModules[hook])
+		}
+		switch format {
+		case db.ImageFormatNetboot:
+			modules = appendUnique(modules, "livenet", "dmsquash-live")
+		case db.ImageFormatISO:
+			modules = appendUnique(modules, "dmsquash-live")
+		}
+		if config.Security.Verity.Enabled {
+			modules = appendUnique(modules, "systemd-veritysetup")
+		}
+
+		args := []string{"--force", "--no-hostonly", "--kver", kernelVersion, "--" + string(compression)}
+		if len(modules) > 0 {
+			args = append(args, "--add", "'"+strings.Join(modules, " ")+"'")
+		}
+		if microcode {
+			args = append(args, "--early-microcode")
+		} else {
+			args = append(args, "--no-early-microcode")
+		}
+		if epoch != 0 {
+			args = append(args, "--reproducible")
+		}
+		run = fmt.Sprintf(`chroot "$ROOTFS" dracut %s %s`, strings.Join(args, " "), target)
+
+	case db.InitramfsGeneratorMkinitcpio:
+		run = fmt.Sprintf(`cat > "$ROOTFS/tmp/ldf-mkinitcpio.conf" << 'EOF'
+MODULES=()
+BINARIES=()
+FILES=()
+HOOKS=(%s)
+COMPRESSION="%s"
+EOF
+chroot "$ROOTFS" mkinitcpio -c /tmp/ldf-mkinitcpio.conf -k %s -g %s
+rm -f "$ROOTFS/tmp/ldf-mkinitcpio.conf"`, strings.Join(mkinitcpioHookList(hooks, microcode), " "), compression, kernelVersion, target)
+
+	default:
+		return "", fmt.Errorf("%s is not an external initramfs generator", initramfsGenerator(config))
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# Generated by LDF: builds the initramfs inside the rootfs
+set -e
+
+mkdir -p "$ROOTFS/proc" "$ROOTFS/sys" "$ROOTFS/dev" "$ROOTFS/tmp"
+mount -t proc proc "$ROOTFS/proc"
+mount -t sysfs sysfs "$ROOTFS/sys"
+mount --bind /dev "$ROOTFS/dev"
+trap 'umount "$ROOTFS/dev" "$ROOTFS/sys" "$ROOTFS/proc" 2>/dev/null || true' EXIT
+
+%s
+`, run), nil
+}
+
+// mkinitcpioHookList returns the HOOKS array of a generic (non-autodetect)
+// mkinitcpio configuration including hooks. The storage hooks go between
+// block and filesystems.
+func mkinitcpioHookList(hooks []db.InitramfsHook, microcode bool) []string {
+	systemd := containsHook(hooks, db.InitramfsHookLUKS)
+
+	list := []string{"base", "udev"}
+	if systemd {
+		list = []string{"base", "systemd"}
+	}
+	if microcode {
+		list = append(list, "microcode")
+	}
+	list = append(list, "modconf", "kms", "keyboard")
+	if systemd {
+		list = append(list, "sd-vconsole")
+	} else {
+		list = append(list, "keymap", "consolefont")
+	}
+	if containsHook(hooks, db.InitramfsHookPlymouth) {
+		list = append(list, "plymouth")
+	}
+
+	list = append(list, "block")
+	for _, hook := range hooks {
+		if hook != db.InitramfsHookPlymouth {
+			list = appendUnique(list, mkinitcpioHooks[hook])
+		}
+	}
+	return append(list, "filesystems", "fsck")
+}
+
+// appendUnique appends the values not already in list
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
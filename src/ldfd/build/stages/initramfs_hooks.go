@@ -0,0 +1,311 @@
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// initramfsTool is a binary busybox lacks, copied from the rootfs
+type initramfsTool struct {
+	name     string
+	dst      string // Path inside the initramfs
+	optional bool   // Copied when present, without warning otherwise
+}
+
+// initramfsHook is an optional initramfs module: the kernel modules,
+// busybox applets, rootfs tools and configuration files it needs, and the
+// init script fragment running it
+type initramfsHook struct {
+	modules []string
+	applets []string
+	tools   []initramfsTool
+	files   []string // Rootfs-relative files or directories, copied when present
+	init    func(g *InitramfsGenerator) string
+}
+
+// initramfsHookOrder is the order hook fragments run in: the splash comes
+// up first, then the network, then the storage stack from the bottom up
+// (RAID, LUKS, LVM on top)
+var initramfsHookOrder = []db.InitramfsHook{
+	db.InitramfsHookPlymouth,
+	db.InitramfsHookNetwork,
+	db.InitramfsHookNFS,
+	db.InitramfsHookMDRAID,
+	db.InitramfsHookLUKS,
+	db.InitramfsHookLVM,
+}
+
+// initramfsHooks describes every hook in initramfsHookOrder
+var initramfsHooks = map[db.InitramfsHook]initramfsHook{
+	db.InitramfsHookPlymouth: {
+		modules: []string{
+			"kernel/drivers/gpu/drm/*.ko*",
+			"kernel/drivers/gpu/drm/*/*.ko*",
+		},
+		tools: []initramfsTool{
+			{name: "plymouthd", dst: "sbin/plymouthd"},
+			{name: "plymouth", dst: "bin/plymouth"},
+		},
+		files: []string{
+			"etc/plymouth/plymouthd.conf",
+			"usr/share/plymouth",
+			"usr/lib/plymouth",
+		},
+		init: (*InitramfsGenerator).plymouthInitBlock,
+	},
+	db.InitramfsHookNetwork: {
+		modules: []string{
+			"kernel/drivers/net/*.ko*",
+			"kernel/drivers/net/ethernet/*/*.ko*",
+			"kernel/drivers/net/ethernet/*/*/*.ko*",
+		},
+		applets: []string{"ip", "udhcpc", "find"},
+		init:    (*InitramfsGenerator).networkInitBlock,
+	},
+	db.InitramfsHookNFS: {
+		modules: []string{
+			"kernel/fs/nfs/*.ko*",
+			"kernel/fs/nfs_common/*.ko*",
+			"kernel/fs/lockd/*.ko*",
+			"kernel/net/sunrpc/*.ko*",
+		},
+		init: (*InitramfsGenerator).nfsInitBlock,
+	},
+	db.InitramfsHookMDRAID: {
+		modules: []string{"kernel/drivers/md/*.ko*"},
+		tools:   []initramfsTool{{name: "mdadm", dst: "sbin/mdadm"}},
+		files:   []string{"etc/mdadm.conf", "etc/mdadm/mdadm.conf"},
+		init:    (*InitramfsGenerator).mdraidInitBlock,
+	},
+	db.InitramfsHookLUKS: {
+		modules: []string{
+			"kernel/drivers/md/*.ko*",
+			"kernel/crypto/*.ko*",
+			"kernel/drivers/char/tpm/*.ko*",
+		},
+		tools: []initramfsTool{
+			{name: "cryptsetup", dst: "sbin/cryptsetup"},
+			{name: "systemd-cryptsetup", dst: "lib/systemd/systemd-cryptsetup", optional: true},
+		},
+		init: (*InitramfsGenerator).encryptionInitBlock,
+	},
+	db.InitramfsHookLVM: {
+		modules: []string{"kernel/drivers/md/*.ko*"},
+		tools:   []initramfsTool{{name: "lvm", dst: "sbin/lvm"}},
+		files:   []string{"etc/lvm/lvm.conf"},
+		init:    (*InitramfsGenerator).lvmInitBlock,
+	},
+}
+
+// resolveInitramfsHooks returns the configured hooks together with those
+// the configuration implies, in initramfsHookOrder. Encrypted roots need
+// luks, network roots need network and nfs, and nfs needs network.
+func resolveInitramfsHooks(config *db.DistributionConfig, netboot bool) []db.InitramfsHook {
+	wanted := make(map[db.InitramfsHook]bool)
+	for _, hook := range config.Core.Initramfs.Hooks {
+		wanted[hook] = true
+	}
+	if config.Security.Encryption.Enabled {
+		wanted[db.InitramfsHookLUKS] = true
+	}
+	if netboot {
+		wanted[db.InitramfsHookNFS] = true
+	}
+	if wanted[db.InitramfsHookNFS] {
+		wanted[db.InitramfsHookNetwork] = true
+	}
+
+	var hooks []db.InitramfsHook
+	for _, hook := range initramfsHookOrder {
+		if wanted[hook] {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// hasHook reports whether the initramfs includes hook
+func (g *InitramfsGenerator) hasHook(hook db.InitramfsHook) bool {
+	for _, h := range resolveInitramfsHooks(g.config, g.netboot) {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// hookInitBlocks returns the init script fragments of the included hooks
+func (g *InitramfsGenerator) hookInitBlocks() string {
+	var blocks string
+	for _, hook := range resolveInitramfsHooks(g.config, g.netboot) {
+		blocks += initramfsHooks[hook].init(g)
+	}
+	return blocks
+}
+
+// copyHookFiles copies the tools and configuration files of the included
+// hooks from the rootfs
+func (g *InitramfsGenerator) copyHookFiles(initramfsDir string) error {
+	for _, hook := range resolveInitramfsHooks(g.config, g.netboot) {
+		for _, tool := range initramfsHooks[hook].tools {
+			copied, err := g.copyRootfsTool(initramfsDir, tool.name, tool.dst)
+			if err != nil {
+				return err
+			}
+			if !copied && !tool.optional {
+				log.Warn("Initramfs hook tool not found in rootfs", "hook", hook, "tool", tool.name)
+			}
+		}
+
+		for _, file := range initramfsHooks[hook].files {
+			src := filepath.Join(g.rootfsPath, file)
+			info, err := os.Stat(src)
+			if err != nil {
+				continue
+			}
+			dst := filepath.Join(initramfsDir, file)
+			if info.IsDir() {
+				err = copyDir(src, dst)
+			} else if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+				err = copyFile(src, dst)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy %s for the %s hook: %w", file, hook, err)
+			}
+		}
+	}
+	return nil
+}
+
+// plymouthInitBlock starts the boot splash. The daemon is handed over to
+// the real root right before switch_root.
+func (g *InitramfsGenerator) plymouthInitBlock() string {
+	return `# Start the boot splash
+if [ -x /sbin/plymouthd ]; then
+    modprobe simpledrm 2>/dev/null || true
+    mkdir -p /run/plymouth
+    plymouthd --mode=boot --attach-to-session --pid-file=/run/plymouth/pid
+    plymouth show-splash
+fi
+
+`
+}
+
+// networkInitBlock brings up the first interface obtaining a DHCP lease
+// when the root lives on the network or ip=dhcp is given
+func (g *InitramfsGenerator) networkInitBlock() string {
+	return `# Configure the network for network roots
+NETWORK=""
+case "$ROOT" in
+    live:http://*|live:https://*|nfs:*)
+        NETWORK=1
+        ;;
+esac
+for param in $(cat /proc/cmdline); do
+    case "$param" in
+        ip=dhcp|ip=on|ip=any)
+            NETWORK=1
+            ;;
+    esac
+done
+
+if [ -n "$NETWORK" ]; then
+    for mod in $(find /lib/modules -name '*.ko*' -path '*/drivers/net/*'); do
+        mod="${mod##*/}"
+        modprobe "${mod%%.ko*}" 2>/dev/null || true
+    done
+
+    echo "Configuring network..."
+    ip link set lo up
+    NETUP=""
+    WAIT=0
+    while [ -z "$NETUP" ] && [ $WAIT -lt 30 ]; do
+        for iface in /sys/class/net/*; do
+            iface="${iface##*/}"
+            [ "$iface" = "lo" ] && continue
+            ip link set "$iface" up
+            if udhcpc -i "$iface" -n -q -t 3 -s /etc/udhcpc.script; then
+                NETUP="$iface"
+                break
+            fi
+        done
+        if [ -z "$NETUP" ]; then
+            sleep 1
+            WAIT=$((WAIT + 1))
+        fi
+    done
+    if [ -z "$NETUP" ]; then
+        echo "ERROR: No network interface obtained a DHCP lease!"
+        echo "Dropping to shell..."
+        exec /bin/sh
+    fi
+fi
+
+`
+}
+
+// nfsInitBlock mounts a root=nfs:<server>:<path> root read-write. Netboot
+// bundles mount NFS roots read-only under an overlay instead.
+func (g *InitramfsGenerator) nfsInitBlock() string {
+	if g.netboot {
+		return ""
+	}
+
+	return `# Mount an NFS root
+case "$ROOT" in
+    nfs:*)
+        modprobe nfs 2>/dev/null || true
+        echo "Mounting root filesystem from ${ROOT#nfs:}..."
+        if ! mount -t nfs -o "$ROOTFLAGS,nolock" "${ROOT#nfs:}" /mnt/root; then
+            echo "ERROR: Failed to mount NFS root!"
+            echo "Dropping to shell..."
+            exec /bin/sh
+        fi
+        cp /etc/resolv.conf /mnt/root/etc/resolv.conf 2>/dev/null || true
+
+        echo "Switching to root filesystem..."
+        ` + plymouthNewRoot + `
+        umount /proc
+        umount /sys
+        exec switch_root /mnt/root /sbin/init
+        ;;
+esac
+
+`
+}
+
+// mdraidInitBlock assembles the MD RAID arrays listed in mdadm.conf, or
+// every array found when there is none
+func (g *InitramfsGenerator) mdraidInitBlock() string {
+	return `# Assemble MD RAID arrays
+if [ -x /sbin/mdadm ]; then
+    for mod in md_mod raid0 raid1 raid10 raid456; do
+        modprobe "$mod" 2>/dev/null || true
+    done
+    echo "Assembling RAID arrays..."
+    mdadm --assemble --scan --run 2>/dev/null || true
+fi
+
+`
+}
+
+// lvmInitBlock activates LVM volume groups, including those on the
+// unlocked LUKS device
+func (g *InitramfsGenerator) lvmInitBlock() string {
+	return `# Activate LVM volume groups
+if [ -x /sbin/lvm ]; then
+    modprobe dm-mod 2>/dev/null || true
+    echo "Activating LVM volume groups..."
+    lvm vgscan --mknodes 2>/dev/null || true
+    lvm vgchange -ay --sysinit 2>/dev/null || true
+fi
+
+`
+}
+
+// plymouthNewRoot hands the boot splash over to the real root; it is a
+// no-op when plymouth is not running
+const plymouthNewRoot = `plymouth --ping 2>/dev/null && plymouth update-root-fs --new-root-dir=/mnt/root || true`
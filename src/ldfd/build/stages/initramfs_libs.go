@@ -0,0 +1,171 @@
+package stages
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// libraryDirs are the rootfs directories the dynamic loader searches by
+// default, multiarch ones included
+var libraryDirs = []string{
+	"lib64", "lib", "usr/lib64", "usr/lib",
+	"lib/x86_64-linux-gnu", "usr/lib/x86_64-linux-gnu",
+	"lib/aarch64-linux-gnu", "usr/lib/aarch64-linux-gnu",
+}
+
+// copyLibraries copies the dynamic loader and the shared libraries binary
+// needs, and theirs in turn, from the rootfs into the initramfs. The ELF
+// headers are read rather than running ldd so foreign architectures work.
+// Static binaries and scripts need nothing.
+func (g *InitramfsGenerator) copyLibraries(initramfsDir, binary string) error {
+	queue := []string{binary}
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		interp, needed, runpaths, err := elfDependencies(current)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(current), err)
+		}
+
+		if interp != "" && !seen[interp] {
+			seen[interp] = true
+			src, ok := rootfsRealPath(g.rootfsPath, interp)
+			if !ok {
+				return fmt.Errorf("%s needs the dynamic loader %s, missing from the rootfs", filepath.Base(binary), interp)
+			}
+			if err := copyLibrary(src, filepath.Join(initramfsDir, interp)); err != nil {
+				return err
+			}
+		}
+
+		for _, lib := range needed {
+			if seen[lib] {
+				continue
+			}
+			seen[lib] = true
+
+			src, rel := g.findLibrary(lib, runpaths)
+			if src == "" {
+				return fmt.Errorf("%s needs %s, missing from the rootfs", filepath.Base(binary), lib)
+			}
+			dst := filepath.Join(initramfsDir, rel)
+			if err := copyLibrary(src, dst); err != nil {
+				return err
+			}
+			queue = append(queue, dst)
+		}
+	}
+	return nil
+}
+
+// findLibrary returns the rootfs file of a shared library, searching the
+// binary's absolute run paths before the default directories, along with
+// the path the loader finds it at
+func (g *InitramfsGenerator) findLibrary(lib string, runpaths []string) (string, string) {
+	for _, dir := range append(runpaths, libraryDirs...) {
+		rel := filepath.Join(dir, lib)
+		if src, ok := rootfsRealPath(g.rootfsPath, rel); ok {
+			return src, rel
+		}
+	}
+	return "", ""
+}
+
+// copyLibrary copies a library, dereferenced, to dst
+func copyLibrary(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", filepath.Base(dst), err)
+	}
+	return nil
+}
+
+// elfDependencies returns the interpreter, needed libraries and absolute
+// run paths of an ELF file; files that are not ELF have none
+func elfDependencies(path string) (string, []string, []string, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer r.Close()
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != elf.ELFMAG {
+		return "", nil, nil, nil
+	}
+
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var interp string
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return "", nil, nil, err
+		}
+		interp = strings.TrimRight(string(data), "\x00")
+	}
+
+	if f.Section(".dynamic") == nil {
+		return interp, nil, nil, nil
+	}
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var runpaths []string
+	for _, tag := range []elf.DynTag{elf.DT_RUNPATH, elf.DT_RPATH} {
+		values, _ := f.DynString(tag)
+		for _, value := range values {
+			for _, dir := range strings.Split(value, ":") {
+				// $ORIGIN paths stay relative to the binary, already copied
+				if strings.HasPrefix(dir, "/") && !strings.Contains(dir, "$") {
+					runpaths = append(runpaths, strings.TrimPrefix(dir, "/"))
+				}
+			}
+		}
+	}
+	return interp, needed, runpaths, nil
+}
+
+// rootfsRealPath resolves name inside the rootfs, following symlinks with
+// absolute targets relative to the rootfs rather than the host, and
+// reports whether it is a regular file
+func rootfsRealPath(rootfs, name string) (string, bool) {
+	root := filepath.Clean(rootfs)
+	p := filepath.Join(root, name)
+	for i := 0; i < 40; i++ {
+		info, err := os.Lstat(p)
+		if err != nil {
+			return "", false
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return p, info.Mode().IsRegular()
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return "", false
+		}
+		if filepath.IsAbs(target) {
+			p = filepath.Join(root, target)
+		} else {
+			p = filepath.Join(filepath.Dir(p), target)
+		}
+		if root != "/" && p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,284 @@
+package stages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateInitramfsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  db.DistributionConfig
+		format  db.ImageFormat
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			format: db.ImageFormatRaw,
+		},
+		{
+			name: "dracut with hooks",
+			config: db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{
+				Generator:   db.InitramfsGeneratorDracut,
+				Hooks:       []db.InitramfsHook{db.InitramfsHookLVM, db.InitramfsHookPlymouth},
+				Compression: db.InitramfsCompressionZstd,
+			}}},
+			format: db.ImageFormatNetboot,
+		},
+		{
+			name:    "unknown generator",
+			config:  db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{Generator: "booster"}}},
+			format:  db.ImageFormatRaw,
+			wantErr: "unsupported initramfs generator",
+		},
+		{
+			name:    "unknown compression",
+			config:  db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{Compression: "bzip2"}}},
+			format:  db.ImageFormatRaw,
+			wantErr: "unsupported initramfs compression",
+		},
+		{
+			name:    "unknown hook",
+			config:  db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{Hooks: []db.InitramfsHook{"iscsi"}}}},
+			format:  db.ImageFormatRaw,
+			wantErr: "unknown initramfs hook",
+		},
+		{
+			name: "external generator with re-encryption",
+			config: db.DistributionConfig{
+				Core:     db.CoreConfig{Initramfs: db.InitramfsConfig{Generator: db.InitramfsGeneratorDracut}},
+				Security: db.SecurityConfig{Encryption: db.EncryptionConfig{Enabled: true, Reencrypt: true}},
+			},
+			format:  db.ImageFormatRaw,
+			wantErr: "requires the builtin initramfs generator",
+		},
+		{
+			name:    "mkinitcpio netboot",
+			config:  db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{Generator: db.InitramfsGeneratorMkinitcpio}}},
+			format:  db.ImageFormatNetboot,
+			wantErr: "network roots",
+		},
+		{
+			name: "mkinitcpio luks and network",
+			config: db.DistributionConfig{
+				Core:     db.CoreConfig{Initramfs: db.InitramfsConfig{Generator: db.InitramfsGeneratorMkinitcpio, Hooks: []db.InitramfsHook{db.InitramfsHookNFS}}},
+				Security: db.SecurityConfig{Encryption: db.EncryptionConfig{Enabled: true}},
+			},
+			format:  db.ImageFormatRaw,
+			wantErr: "luks and network",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInitramfsConfig(&tt.config, tt.format)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestResolveInitramfsHooks(t *testing.T) {
+	config := &db.DistributionConfig{}
+	if hooks := resolveInitramfsHooks(config, false); len(hooks) != 0 {
+		t.Errorf("expected no hooks by default, got %v", hooks)
+	}
+
+	config.Core.Initramfs.Hooks = []db.InitramfsHook{db.InitramfsHookLVM, db.InitramfsHookPlymouth}
+	config.Security.Encryption.Enabled = true
+	want := []db.InitramfsHook{db.InitramfsHookPlymouth, db.InitramfsHookNetwork, db.InitramfsHookNFS, db.InitramfsHookLUKS, db.InitramfsHookLVM}
+	if hooks := resolveInitramfsHooks(config, true); !reflect.DeepEqual(hooks, want) {
+		t.Errorf("resolveInitramfsHooks() = %v, want %v", hooks, want)
+	}
+
+	gen := NewInitramfsGenerator(t.TempDir(), "", config, db.ArchX86_64)
+	gen.SetNetboot(true)
+	block := gen.hookInitBlocks()
+	splash := strings.Index(block, "plymouthd --mode=boot")
+	unlock := strings.Index(block, "cryptsetup open")
+	activate := strings.Index(block, "lvm vgchange -ay")
+	if splash < 0 || unlock < splash || activate < unlock {
+		t.Errorf("hook fragments out of order:\n%s", block)
+	}
+	modules := strings.Join(gen.getRequiredModules(), " ")
+	for _, want := range []string{"kernel/drivers/gpu/drm/", "kernel/fs/nfs/", "kernel/drivers/net/"} {
+		if !strings.Contains(modules, want) {
+			t.Errorf("hook modules missing %s: %s", want, modules)
+		}
+	}
+}
+
+func TestExternalInitramfsCommand(t *testing.T) {
+	config := &db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{
+		Generator:   db.InitramfsGeneratorDracut,
+		Hooks:       []db.InitramfsHook{db.InitramfsHookMDRAID},
+		Compression: db.InitramfsCompressionXZ,
+	}}}
+	config.Security.Encryption.Enabled = true
+
+	script, err := externalInitramfsCommand(config, db.ImageFormatRaw, "6.12.1", "/boot/initramfs.img", 1700000000)
+	if err != nil {
+		t.Fatalf("externalInitramfsCommand() error = %v", err)
+	}
+	want := `chroot "$ROOTFS" dracut --force --no-hostonly --kver 6.12.1 --xz --add 'mdraid crypt' --early-microcode --reproducible /boot/initramfs.img`
+	if !strings.Contains(script, want) {
+		t.Errorf("dracut script missing %q:\n%s", want, script)
+	}
+
+	config.Core.Initramfs.Generator = db.InitramfsGeneratorMkinitcpio
+	config.Core.Initramfs.NoMicrocode = true
+	script, err = externalInitramfsCommand(config, db.ImageFormatRaw, "6.12.1", "/boot/initramfs.img", 0)
+	if err != nil {
+		t.Fatalf("externalInitramfsCommand() error = %v", err)
+	}
+	for _, want := range []string{
+		"HOOKS=(base systemd modconf kms keyboard sd-vconsole block mdadm_udev sd-encrypt filesystems fsck)",
+		`COMPRESSION="xz"`,
+		`chroot "$ROOTFS" mkinitcpio -c /tmp/ldf-mkinitcpio.conf -k 6.12.1 -g /boot/initramfs.img`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("mkinitcpio script missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestInitramfsGenerator_Generate(t *testing.T) {
+	rootfs := t.TempDir()
+	for path, content := range map[string]string{
+		"lib/firmware/intel-ucode/06-55-04":             "intel",
+		"usr/lib/firmware/amd-ucode/microcode_amd.bin":  "amd",
+		"usr/lib/firmware/amd-ucode/microcode_amd2.bin": "amd2",
+	} {
+		full := filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(rootfs, "boot", "initramfs.img")
+	gen := NewInitramfsGenerator(rootfs, output, &db.DistributionConfig{}, db.ArchX86_64)
+	gen.SetSourceDateEpoch(1700000000)
+	if err := gen.Generate(context.Background()); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The uncompressed early cpio comes first, then the gzipped main one
+	trailer := bytes.Index(data, []byte("TRAILER!!!"))
+	if !bytes.HasPrefix(data, []byte("070701")) || trailer < 0 {
+		t.Fatal("initramfs does not start with an early microcode cpio")
+	}
+	early := string(data[:trailer])
+	for _, want := range []string{"kernel/x86/microcode/GenuineIntel.bin", "kernel/x86/microcode/AuthenticAMD.bin", "amdamd2"} {
+		if !strings.Contains(early, want) {
+			t.Errorf("early cpio missing %q", want)
+		}
+	}
+
+	gzStart := bytes.Index(data[trailer:], []byte{0x1f, 0x8b})
+	if gzStart < 0 {
+		t.Fatal("no compressed archive after the early cpio")
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data[trailer+gzStart:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"init", "bin/busybox", "LDF Initramfs starting"} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("main archive missing %q", want)
+		}
+	}
+
+	// Without microcode the archive is just the compressed cpio
+	gen = NewInitramfsGenerator(rootfs, output, &db.DistributionConfig{Core: db.CoreConfig{Initramfs: db.InitramfsConfig{NoMicrocode: true}}}, db.ArchX86_64)
+	if err := gen.Generate(context.Background()); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if data, _ := os.ReadFile(output); !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		t.Error("expected a gzip archive without microcode")
+	}
+}
+
+func TestInitramfsGenerator_CopyRootfsToolLibraries(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	sh, _ = filepath.EvalSymlinks(sh)
+	interp, needed, _, err := elfDependencies(sh)
+	if err != nil || interp == "" || len(needed) == 0 {
+		t.Skip("sh is not a dynamically linked ELF binary")
+	}
+
+	// A rootfs holding the tool but not its libraries cannot boot it
+	rootfs := t.TempDir()
+	tool := filepath.Join(rootfs, "usr", "sbin", "veritysetup")
+	if err := os.MkdirAll(filepath.Dir(tool), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(sh, tool); err != nil {
+		t.Fatal(err)
+	}
+	gen := NewInitramfsGenerator(rootfs, "", &db.DistributionConfig{}, db.ArchX86_64)
+	if _, err := gen.copyRootfsTool(t.TempDir(), "veritysetup", "sbin/veritysetup"); err == nil {
+		t.Error("expected an error for missing shared libraries")
+	}
+
+	// The host is a rootfs with every library sh needs
+	initramfsDir := t.TempDir()
+	gen = NewInitramfsGenerator("/", "", &db.DistributionConfig{}, db.ArchX86_64)
+	if err := gen.copyLibraries(initramfsDir, sh); err != nil {
+		t.Fatalf("copyLibraries() error = %v", err)
+	}
+	if info, err := os.Lstat(filepath.Join(initramfsDir, interp)); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("dynamic loader %s not copied: %v", interp, err)
+	}
+	copied := make(map[string]bool)
+	_ = filepath.Walk(initramfsDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			copied[info.Name()] = true
+		}
+		return nil
+	})
+	for _, lib := range needed {
+		if !copied[lib] {
+			t.Errorf("library %s not copied", lib)
+		}
+	}
+
+	// Scripts need no libraries
+	script := filepath.Join(t.TempDir(), "hook")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := gen.copyLibraries(t.TempDir(), script); err != nil {
+		t.Errorf("copyLibraries() on a script error = %v", err)
+	}
+}
@@ -0,0 +1,417 @@
+package stages
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// installerPath is where the live system carries the installer
+	installerPath = "usr/sbin/ldf-install"
+	// installerService starts the installer when the kernel command line
+	// has ldf.install
+	installerService = "ldf-installer"
+	// installerAnswersPath is where a baked-in answer file sits on the ISO
+	installerAnswersPath = "installer/answers.conf"
+	// livePersistLabel is the filesystem label of the partition a
+	// persistent live session keeps its changes on
+	livePersistLabel = "LDF_PERSIST"
+)
+
+// answerKeywords are the keywords of installer answer files, modelled on
+// kickstart. Each line holds a keyword and its value:
+//
+//	disk /dev/vda                      target disk, or auto for the first disk besides the live medium
+//	clearpart                          erase the disk without asking; unattended installs need it
+//	hostname <name>
+//	timezone <zone>                    a zoneinfo name such as Europe/Paris
+//	rootpw --iscrypted <hash>|--lock   root password hash, or a locked root account
+//	sshkey <public key>                authorized for root; may repeat
+//	reboot|poweroff|halt               what to do once installed; defaults to reboot
+var answerKeywords = map[string]bool{
+	"disk": true, "clearpart": false, "hostname": true, "timezone": true,
+	"rootpw": true, "sshkey": true, "reboot": false, "poweroff": false, "halt": false,
+}
+
+// ValidateLiveConfig reports live ISO settings that cannot be honoured.
+// The installer writes the single-root layout of raw images, so roots
+// that need a layout of their own are left to disk images.
+func ValidateLiveConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	live := config.Build.Live
+	if !live.Installer && !live.Persistence && live.Answers == "" {
+		return nil
+	}
+	if format != db.ImageFormatISO {
+		return fmt.Errorf("the live installer and persistence require the iso image format")
+	}
+	if live.Answers != "" && !live.Installer {
+		return fmt.Errorf("an installer answer file requires the live installer")
+	}
+	if !live.Installer {
+		return nil
+	}
+	switch {
+	case config.Update.ABSlots:
+		return fmt.Errorf("the live installer does not support the A/B slot layout")
+	case config.Security.Verity.Enabled:
+		return fmt.Errorf("the live installer does not support dm-verity roots")
+	case config.Security.Encryption.Enabled:
+		return fmt.Errorf("the live installer does not support encrypted roots")
+	case usesUBoot(config):
+		return fmt.Errorf("the live installer requires a UEFI bootloader")
+	case strings.EqualFold(config.Core.Bootloader, "uki"):
+		return fmt.Errorf("the live installer does not support unified kernel images")
+	}
+	return validateAnswers(live.Answers)
+}
+
+// validateAnswers checks an answer file for unknown keywords and missing
+// values, which the installer would only report on the target machine
+func validateAnswers(answers string) error {
+	scanner := bufio.NewScanner(strings.NewReader(answers))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyword, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		needsValue, ok := answerKeywords[keyword]
+		if !ok {
+			return fmt.Errorf("answer file line %d: unknown keyword %q", n, keyword)
+		}
+		if needsValue && value == "" {
+			return fmt.Errorf("answer file line %d: %s needs a value", n, keyword)
+		}
+		if keyword == "rootpw" && value != "--lock" && !strings.HasPrefix(value, "--iscrypted ") {
+			return fmt.Errorf("answer file line %d: rootpw takes --iscrypted <hash> or --lock", n)
+		}
+	}
+	return scanner.Err()
+}
+
+// installInstaller adds the installer and the service starting it to the
+// live system of ISO images
+func (s *AssembleStage) installInstaller(sc *build.StageContext) error {
+	if sc.ImageFormat != db.ImageFormatISO || !sc.Config.Build.Live.Installer {
+		return nil
+	}
+
+	script := installerScript(sc.Config, sc.TargetArch)
+	scriptPath := filepath.Join(sc.RootfsDir, installerPath)
+	if err := os.MkdirAll(filepath.Dir(scriptPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		return fmt.Errorf("failed to write installer: %w", err)
+	}
+
+	initInstaller := GetInitInstaller(sc.Config.System.Init)
+	service := installerService
+	var unitPath, unit string
+	var mode os.FileMode = 0644
+	if initInstaller.Name() == "openrc" {
+		unitPath = filepath.Join(sc.RootfsDir, "etc", "init.d", service)
+		unit = fmt.Sprintf(`#!/sbin/openrc-run
+description="LDF installer"
+
+depend() {
+	after local
+}
+
+start() {
+	grep -qw ldf.install /proc/cmdline || return 0
+	/%s </dev/console >/dev/console 2>&1
+}
+`, installerPath)
+		mode = 0755
+	} else {
+		service += ".service"
+		unitPath = filepath.Join(sc.RootfsDir, "usr", "lib", "systemd", "system", service)
+		unit = fmt.Sprintf(`[Unit]
+Description=LDF installer
+ConditionKernelCommandLine=ldf.install
+After=systemd-user-sessions.service
+
+[Service]
+Type=oneshot
+ExecStart=/%s
+StandardInput=tty-force
+StandardOutput=inherit
+StandardError=inherit
+TTYPath=/dev/console
+TTYReset=yes
+
+[Install]
+WantedBy=multi-user.target
+`, installerPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), mode); err != nil {
+		return fmt.Errorf("failed to write installer service: %w", err)
+	}
+	if err := initInstaller.EnableService(sc.RootfsDir, service); err != nil {
+		return err
+	}
+
+	log.Info("Installed live installer", "path", "/"+installerPath, "service", service)
+	return nil
+}
+
+// installerMkfs returns the command formatting the root partition $ROOT
+// with the distribution's filesystem
+func installerMkfs(config *db.DistributionConfig) string {
+	switch strings.ToLower(config.System.Filesystem.Type) {
+	case "xfs":
+		return `mkfs.xfs -f -L root "$ROOT"`
+	case "btrfs":
+		return `mkfs.btrfs -f -L root "$ROOT"`
+	case "f2fs":
+		return `mkfs.f2fs -f -l root "$ROOT"`
+	default:
+		return `mkfs.ext4 -F -L root "$ROOT"`
+	}
+}
+
+// installerScript returns ldf-install, the installer the live system runs.
+// It lays out the disk as raw images are, copies the pristine root
+// filesystem from the live medium's squashfs, fills in the filesystem
+// UUIDs the boot configuration and fstab were generated with and installs
+// the bootloader from the new root.
+func installerScript(config *db.DistributionConfig, arch db.TargetArch) string {
+	bootloader := GetBootloaderInstaller(config.Core.Bootloader, "LDF Linux", "1.0")
+	var bootCmds strings.Builder
+	for _, cmd := range bootloader.GetInstallCommands(`"$DISK"`, arch) {
+		fmt.Fprintf(&bootCmds, "chroot \"$TARGET\" %s || echo \"warning: '%s' failed\" >&2\n", cmd, strings.ReplaceAll(cmd, `"`, ""))
+	}
+
+	disableService := "rm -f \"$TARGET/etc/systemd/system/multi-user.target.wants/" + installerService + ".service\" \"$TARGET/usr/lib/systemd/system/" + installerService + ".service\""
+	if GetInitInstaller(config.System.Init).Name() == "openrc" {
+		disableService = "rm -f \"$TARGET/etc/runlevels/default/" + installerService + "\" \"$TARGET/etc/init.d/" + installerService + "\""
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# ldf-install: installs LDF Linux from the live medium to a disk
+#
+# Usage: ldf-install [answer-file]
+#
+# The answer file is taken from the argument or from ldf.install.answers=
+# on the kernel command line: a path on the live medium, a local path or
+# an http(s) URL. Without one, or without a disk in it, the installer asks
+# for the target disk. The disk is erased after confirmation unless the
+# answer file has clearpart.
+set -eu
+
+LIVE=/run/initramfs/live
+SQUASHFS="$LIVE/LiveOS/squashfs.img"
+WORK=/run/ldf-install
+TARGET="$WORK/target"
+
+DISK=""
+CLEARPART=no
+NEW_HOSTNAME=""
+TIMEZONE=""
+ROOTPW=""
+SSHKEYS=""
+FINISH=""
+
+die() {
+	echo "ldf-install: $*" >&2
+	exit 1
+}
+
+answers_source() {
+	if [ $# -gt 0 ]; then
+		echo "$1"
+		return
+	fi
+	for param in $(cat /proc/cmdline); do
+		case "$param" in
+			ldf.install.answers=*) echo "${param#ldf.install.answers=}" ;;
+		esac
+	done
+}
+
+fetch_answers() {
+	case "$1" in
+		http://*|https://*)
+			wget -q -O "$WORK/answers.conf" "$1" || die "failed to download answer file $1"
+			echo "$WORK/answers.conf"
+			;;
+		*)
+			if [ -f "$LIVE/${1#/}" ]; then
+				echo "$LIVE/${1#/}"
+			elif [ -f "$1" ]; then
+				echo "$1"
+			else
+				die "answer file $1 not found"
+			fi
+			;;
+	esac
+}
+
+read_answers() {
+	while read -r key value; do
+		case "$key" in
+			""|\#*) ;;
+			disk) DISK="$value" ;;
+			clearpart) CLEARPART=yes ;;
+			hostname) NEW_HOSTNAME="$value" ;;
+			timezone) TIMEZONE="$value" ;;
+			rootpw) ROOTPW="$value" ;;
+			sshkey) SSHKEYS="$SSHKEYS$value
+" ;;
+			reboot|poweroff|halt) FINISH="$key" ;;
+			*) die "unknown answer file keyword: $key" ;;
+		esac
+	done < "$1"
+}
+
+# live_disk prints the disk the live medium was booted from
+live_disk() {
+	dev=$(awk -v m="$LIVE" '$2 == m { print $1 }' /proc/mounts)
+	dev=$(basename "${dev:-none}")
+	if [ -e "/sys/class/block/$dev/partition" ]; then
+		dev=$(basename "$(readlink -f "/sys/class/block/$dev/..")")
+	fi
+	echo "$dev"
+}
+
+list_disks() {
+	skip=$(live_disk)
+	for sys in /sys/block/*; do
+		name=$(basename "$sys")
+		case "$name" in
+			loop*|ram*|sr*|zram*|dm-*|md*|"$skip") continue ;;
+		esac
+		size=$(( $(cat "$sys/size") / 2097152 ))
+		model=$(cat "$sys/device/model" 2>/dev/null || true)
+		echo "/dev/$name ${size}GiB $model"
+	done
+}
+
+# part prints partition $1 of the target disk
+part() {
+	case "$DISK" in
+		*[0-9]) echo "${DISK}p$1" ;;
+		*) echo "$DISK$1" ;;
+	esac
+}
+
+cleanup() {
+	for mnt in sys/firmware/efi/efivars sys proc dev boot/efi ""; do
+		umount "$TARGET/$mnt" 2>/dev/null || true
+	done
+	umount "$WORK/squashfs" 2>/dev/null || true
+}
+
+mkdir -p "$WORK/squashfs" "$TARGET"
+[ -f "$SQUASHFS" ] || die "no live root filesystem at $SQUASHFS"
+
+SOURCE=$(answers_source "$@")
+if [ -n "$SOURCE" ]; then
+	read_answers "$(fetch_answers "$SOURCE")"
+fi
+
+if [ -z "$DISK" ]; then
+	echo "Disks:"
+	list_disks
+	printf "Install to which disk? "
+	read -r DISK
+fi
+if [ "$DISK" = auto ]; then
+	DISK=$(list_disks | head -n 1 | cut -d " " -f 1)
+fi
+[ -b "$DISK" ] || die "$DISK is not a disk"
+if [ "$CLEARPART" != yes ]; then
+	printf "All data on %%s will be erased. Type yes to continue: " "$DISK"
+	read -r confirm
+	[ "$confirm" = yes ] || die "installation cancelled"
+fi
+
+trap cleanup EXIT
+
+echo "Partitioning $DISK..."
+sgdisk --zap-all "$DISK"
+sgdisk --new=1:0:+512M --typecode=1:EF00 --change-name=1:ESP \
+	--new=2:0:0 --typecode=2:8300 --change-name=2:root "$DISK"
+partprobe "$DISK" 2>/dev/null || blockdev --rereadpt "$DISK" 2>/dev/null || true
+udevadm settle 2>/dev/null || sleep 2
+ESP=$(part 1)
+ROOT=$(part 2)
+
+echo "Formatting partitions..."
+mkfs.fat -F32 -n ESP "$ESP"
+%s
+
+echo "Copying the root filesystem..."
+mount -t squashfs -o loop,ro "$SQUASHFS" "$WORK/squashfs"
+mount "$ROOT" "$TARGET"
+mkdir -p "$TARGET/boot/efi"
+mount "$ESP" "$TARGET/boot/efi"
+cp -a "$WORK/squashfs/." "$TARGET/"
+
+# fstab and the boot entries were generated with placeholders for the
+# filesystem UUIDs
+ROOT_FS_UUID=$(blkid -s UUID -o value "$ROOT")
+EFI_FS_UUID=$(blkid -s UUID -o value "$ESP")
+for f in "$TARGET/etc/fstab" "$TARGET/etc/kernel/cmdline" "$TARGET/boot/grub/grub.cfg" \
+	"$TARGET/boot/extlinux/extlinux.conf" "$TARGET"/boot/efi/loader/entries/*.conf; do
+	[ -f "$f" ] || continue
+	sed -i "s/%s/$ROOT_FS_UUID/g; s/EFI_UUID/$EFI_FS_UUID/g" "$f"
+done
+
+echo "Installing the bootloader..."
+for fs in dev proc sys; do
+	mount --bind "/$fs" "$TARGET/$fs"
+done
+if [ -d /sys/firmware/efi/efivars ]; then
+	mount -t efivarfs efivarfs "$TARGET/sys/firmware/efi/efivars" 2>/dev/null || true
+fi
+%s
+if [ -n "$NEW_HOSTNAME" ]; then
+	echo "$NEW_HOSTNAME" > "$TARGET/etc/hostname"
+fi
+if [ -n "$TIMEZONE" ]; then
+	[ -e "$TARGET/usr/share/zoneinfo/$TIMEZONE" ] || echo "warning: unknown timezone $TIMEZONE" >&2
+	ln -sf "/usr/share/zoneinfo/$TIMEZONE" "$TARGET/etc/localtime"
+fi
+case "$ROOTPW" in
+	--lock) sed -i 's|^root:\([^:]*\):|root:!\1:|' "$TARGET/etc/shadow" ;;
+	--iscrypted\ *) sed -i "s|^root:[^:]*:|root:${ROOTPW#--iscrypted }:|" "$TARGET/etc/shadow" ;;
+esac
+if [ -n "$SSHKEYS" ]; then
+	mkdir -p -m 0700 "$TARGET/root/.ssh"
+	printf "%%s" "$SSHKEYS" > "$TARGET/root/.ssh/authorized_keys"
+	chmod 0600 "$TARGET/root/.ssh/authorized_keys"
+fi
+
+# The installed system does not carry the installer
+%s
+rm -f "$TARGET/%s"
+
+sync
+cleanup
+trap - EXIT
+echo "LDF Linux is installed on $DISK."
+
+if [ -z "$FINISH" ]; then
+	if [ -n "$SOURCE" ]; then
+		FINISH=reboot
+	else
+		printf "Remove the installation medium and press Enter to reboot. "
+		read -r _
+		FINISH=reboot
+	fi
+fi
+$FINISH
+`, installerMkfs(config), rootUUIDPlaceholder, bootCmds.String(), disableService, installerPath)
+}
@@ -0,0 +1,166 @@
+package stages
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func liveConfig(live db.LiveConfig) *db.DistributionConfig {
+	return &db.DistributionConfig{
+		Core:   db.CoreConfig{Bootloader: "systemd-boot"},
+		System: db.SystemConfig{Init: "systemd"},
+		Build:  db.BuildConfig{Live: live},
+	}
+}
+
+func TestValidateLiveConfig(t *testing.T) {
+	if err := ValidateLiveConfig(liveConfig(db.LiveConfig{}), db.ImageFormatRaw); err != nil {
+		t.Errorf("no live settings: %v", err)
+	}
+	if err := ValidateLiveConfig(liveConfig(db.LiveConfig{Installer: true, Persistence: true}), db.ImageFormatISO); err != nil {
+		t.Errorf("installer with persistence: %v", err)
+	}
+	if err := ValidateLiveConfig(liveConfig(db.LiveConfig{Installer: true}), db.ImageFormatQCOW2); err == nil {
+		t.Error("expected error for the installer in a disk image")
+	}
+	if err := ValidateLiveConfig(liveConfig(db.LiveConfig{Answers: "disk auto"}), db.ImageFormatISO); err == nil {
+		t.Error("expected error for answers without the installer")
+	}
+
+	config := liveConfig(db.LiveConfig{Installer: true})
+	config.Update.ABSlots = true
+	if err := ValidateLiveConfig(config, db.ImageFormatISO); err == nil {
+		t.Error("expected error for A/B slots")
+	}
+	config = liveConfig(db.LiveConfig{Installer: true})
+	config.Core.Bootloader = "uki"
+	if err := ValidateLiveConfig(config, db.ImageFormatISO); err == nil {
+		t.Error("expected error for unified kernel images")
+	}
+}
+
+func TestValidateAnswers(t *testing.T) {
+	valid := `# unattended install
+disk auto
+clearpart
+hostname ldf-node
+rootpw --iscrypted $6$salt$hash
+sshkey ssh-ed25519 AAAA user@host
+poweroff
+`
+	if err := validateAnswers(valid); err != nil {
+		t.Errorf("validateAnswers() error = %v", err)
+	}
+	for _, answers := range []string{"partition /dev/sda", "disk", "rootpw secret"} {
+		if err := validateAnswers(answers); err == nil {
+			t.Errorf("expected error for %q", answers)
+		}
+	}
+}
+
+func TestInstallInstaller(t *testing.T) {
+	rootfs := t.TempDir()
+	sc := &build.StageContext{
+		RootfsDir:   rootfs,
+		ImageFormat: db.ImageFormatISO,
+		TargetArch:  db.ArchX86_64,
+		Config:      liveConfig(db.LiveConfig{Installer: true}),
+	}
+	if err := (&AssembleStage{}).installInstaller(sc); err != nil {
+		t.Fatalf("installInstaller() error = %v", err)
+	}
+
+	script := filepath.Join(rootfs, installerPath)
+	data, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--new=1:0:+512M --typecode=1:EF00",
+		`mkfs.ext4 -F -L root "$ROOT"`,
+		`sed -i "s/ROOT_UUID/$ROOT_FS_UUID/g; s/EFI_UUID/$EFI_FS_UUID/g" "$f"`,
+		`chroot "$TARGET" bootctl --path=/boot/efi install`,
+		"ldf.install.answers=*",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("installer missing %q", want)
+		}
+	}
+	if sh, err := exec.LookPath("sh"); err == nil {
+		if out, err := exec.Command(sh, "-n", script).CombinedOutput(); err != nil {
+			t.Errorf("installer has syntax errors: %v\n%s", err, out)
+		}
+	}
+
+	unit, err := os.ReadFile(filepath.Join(rootfs, "usr/lib/systemd/system", installerService+".service"))
+	if err != nil || !strings.Contains(string(unit), "ConditionKernelCommandLine=ldf.install") {
+		t.Errorf("unexpected installer unit: %q, %v", unit, err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "etc/systemd/system/multi-user.target.wants", installerService+".service")); err != nil {
+		t.Errorf("installer service not enabled: %v", err)
+	}
+
+	sc.ImageFormat = db.ImageFormatRaw
+	sc.RootfsDir = t.TempDir()
+	if err := (&AssembleStage{}).installInstaller(sc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(sc.RootfsDir, installerPath)); !os.IsNotExist(err) {
+		t.Error("installer should only be embedded in ISO images")
+	}
+}
+
+func TestCreateISOGrubConfig_Live(t *testing.T) {
+	staging := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(staging, "boot", "grub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	g := NewISOImageGenerator(nil, "", "")
+	live := db.LiveConfig{Installer: true, Answers: "disk auto\nclearpart\n", Persistence: true}
+	if err := g.createISOGrubConfig(staging, db.ArchX86_64, "", live); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(staging, "boot", "grub", "grub.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`menuentry "LDF Linux (Install)"`,
+		"rd.live.image quiet ldf.install\n",
+		"ldf.install ldf.install.answers=/installer/answers.conf",
+		"rd.live.overlay=LABEL=LDF_PERSIST rd.live.overlay.overlayfs=1",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("grub.cfg missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestInitramfsGenerator_LiveInit(t *testing.T) {
+	gen := NewInitramfsGenerator(t.TempDir(), "", &db.DistributionConfig{}, db.ArchX86_64)
+	if block := gen.liveInitBlock(); block != "" {
+		t.Error("expected no live root setup for disk images")
+	}
+
+	gen.SetLive(true)
+	block := gen.liveInitBlock()
+	for _, want := range []string{
+		"mount -t squashfs -o loop,ro /run/initramfs/live/LiveOS/squashfs.img /run/initramfs/squashfs",
+		"rd.live.overlay=LABEL=*",
+		"UPPER=/run/initramfs/overlayfs/LiveOS/overlay",
+		"mount --move /run /mnt/root/run",
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("init script missing %q", want)
+		}
+	}
+	if modules := strings.Join(gen.getRequiredModules(), " "); !strings.Contains(modules, "kernel/fs/isofs/") {
+		t.Errorf("live modules missing isofs: %s", modules)
+	}
+}
@@ -0,0 +1,280 @@
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	journaldConfPath = "/etc/systemd/journald.conf"
+	rsyslogConfPath  = "/etc/rsyslog.conf"
+	syslogConfPath   = "/etc/syslog.conf"
+	// defaultJournalMaxUse caps the journal when no limit is configured
+	defaultJournalMaxUse = "500M"
+	defaultSyslogPort    = 514
+)
+
+// defaultSyslogRules route messages the way most distributions do
+var defaultSyslogRules = []string{
+	"*.info;mail.none;authpriv.none;cron.none /var/log/messages",
+	"authpriv.* /var/log/secure",
+	"mail.* -/var/log/maillog",
+	"cron.* /var/log/cron",
+	"*.emerg :omusrmsg:*",
+}
+
+// loggingSystem returns the system logger: the configured one, journald
+// for systemd images, otherwise none
+func loggingSystem(config *db.DistributionConfig) db.LoggingSystem {
+	if config.System.Logging.System != "" {
+		return db.LoggingSystem(strings.ToLower(string(config.System.Logging.System)))
+	}
+	if GetInitInstaller(config.System.Init).Name() == "systemd" {
+		return db.LoggingJournald
+	}
+	return db.LoggingNone
+}
+
+// loggingComponentName returns the component providing the system
+// logger, or "" when the init system provides it or there is none
+func loggingComponentName(config *db.DistributionConfig) string {
+	switch loggingSystem(config) {
+	case db.LoggingSyslog:
+		return "sysklogd"
+	case db.LoggingRsyslog:
+		return "rsyslog"
+	}
+	return ""
+}
+
+// ValidateLoggingConfig reports logging settings the system logger and
+// init system cannot honour
+func ValidateLoggingConfig(config *db.DistributionConfig) error {
+	cfg := config.System.Logging
+	system := loggingSystem(config)
+	systemd := GetInitInstaller(config.System.Init).Name() == "systemd"
+
+	switch system {
+	case db.LoggingJournald:
+		if !systemd {
+			return fmt.Errorf("journald logging requires the systemd init system")
+		}
+	case db.LoggingSyslog, db.LoggingRsyslog, db.LoggingNone:
+	default:
+		return fmt.Errorf("unsupported logging system %q (supported: journald, syslog, rsyslog, none)", cfg.System)
+	}
+
+	if (cfg.Storage != "" || cfg.MaxUse != "" || cfg.MaxRetention != "") && !systemd {
+		return fmt.Errorf("journal settings require the systemd init system")
+	}
+	switch cfg.Storage {
+	case "", db.JournalStoragePersistent, db.JournalStorageVolatile, db.JournalStorageAuto:
+	default:
+		return fmt.Errorf("unsupported journal storage %q (supported: persistent, volatile, auto)", cfg.Storage)
+	}
+
+	if len(cfg.Rules) > 0 && system != db.LoggingRsyslog {
+		return fmt.Errorf("logging rules require rsyslog")
+	}
+	for _, rule := range cfg.Rules {
+		if strings.TrimSpace(rule) == "" || strings.ContainsAny(rule, "\r\n") {
+			return fmt.Errorf("invalid logging rule %q: rules are single non-empty lines", rule)
+		}
+	}
+
+	if remote := cfg.Remote; remote != nil {
+		if system != db.LoggingSyslog && system != db.LoggingRsyslog {
+			return fmt.Errorf("remote log forwarding requires syslog or rsyslog")
+		}
+		if remote.Host == "" || strings.ContainsAny(remote.Host, " \t\r\n\"'") {
+			return fmt.Errorf("invalid remote log host %q", remote.Host)
+		}
+		if remote.Port < 0 || remote.Port > 65535 {
+			return fmt.Errorf("invalid remote log port %d", remote.Port)
+		}
+		switch strings.ToLower(remote.Protocol) {
+		case "", "udp":
+		case "tcp":
+			if system != db.LoggingRsyslog {
+				return fmt.Errorf("forwarding over tcp requires rsyslog")
+			}
+		default:
+			return fmt.Errorf("unsupported remote log protocol %q (supported: udp, tcp)", remote.Protocol)
+		}
+	}
+	return nil
+}
+
+// configureLogging writes the configuration of the system logger and, on
+// systemd images, of the journal, and enables the syslog daemon
+func (s *AssembleStage) configureLogging(sc *build.StageContext) error {
+	cfg := sc.Config.System.Logging
+	system := loggingSystem(sc.Config)
+	initInstaller := GetInitInstaller(sc.Config.System.Init)
+
+	if initInstaller.Name() == "systemd" {
+		if err := writeRootfsFile(sc.RootfsDir, journaldConfPath, []byte(journaldConfig(cfg, system))); err != nil {
+			return fmt.Errorf("failed to write journald.conf: %w", err)
+		}
+	}
+
+	var service string
+	switch system {
+	case db.LoggingSyslog:
+		if err := writeRootfsFile(sc.RootfsDir, syslogConfPath, []byte(syslogConfig(cfg))); err != nil {
+			return fmt.Errorf("failed to write syslog.conf: %w", err)
+		}
+		service = "syslogd"
+	case db.LoggingRsyslog:
+		if err := writeRootfsFile(sc.RootfsDir, rsyslogConfPath, []byte(rsyslogConfig(cfg, initInstaller.Name() == "systemd"))); err != nil {
+			return fmt.Errorf("failed to write rsyslog.conf: %w", err)
+		}
+		service = "rsyslog"
+	default:
+		log.Info("Configured logging", "system", system)
+		return nil
+	}
+
+	if component := s.findComponentByType(sc.Components, loggingComponentName(sc.Config)); component != nil && component.LocalPath != "" {
+		log.Info("Installing system logger from source", "path", component.LocalPath, "version", component.Version)
+	}
+
+	if initInstaller.Name() == "systemd" {
+		service += ".service"
+	} else {
+		scriptPath := filepath.Join(sc.RootfsDir, "etc", "init.d", service)
+		if err := os.WriteFile(scriptPath, []byte(openRCLoggerScript(system)), 0755); err != nil {
+			return fmt.Errorf("failed to write %s init script: %w", service, err)
+		}
+	}
+	if err := initInstaller.EnableService(sc.RootfsDir, service); err != nil {
+		return fmt.Errorf("failed to enable %s: %w", service, err)
+	}
+
+	log.Info("Configured logging", "system", system, "rules", len(cfg.Rules), "remote", cfg.Remote != nil)
+	return nil
+}
+
+// journaldConfig returns journald.conf. A syslog daemon gets the journal
+// forwarded and the journal itself stays in memory, unless configured
+// otherwise; without a logger nothing is stored.
+func journaldConfig(cfg db.LoggingConfig, system db.LoggingSystem) string {
+	storage := string(cfg.Storage)
+	forward := false
+	switch system {
+	case db.LoggingSyslog, db.LoggingRsyslog:
+		forward = true
+		if storage == "" {
+			storage = string(db.JournalStorageVolatile)
+		}
+	case db.LoggingNone:
+		storage = "none"
+	}
+	if storage == "" {
+		storage = string(db.JournalStoragePersistent)
+	}
+	maxUse := cfg.MaxUse
+	if maxUse == "" {
+		maxUse = defaultJournalMaxUse
+	}
+
+	var b strings.Builder
+	b.WriteString("# journald configuration\n# Generated by Linux Distribution Factory\n\n[Journal]\n")
+	fmt.Fprintf(&b, "Storage=%s\nCompress=yes\nSystemMaxUse=%s\n", storage, maxUse)
+	if cfg.MaxRetention != "" {
+		fmt.Fprintf(&b, "MaxRetentionSec=%s\n", cfg.MaxRetention)
+	}
+	if forward {
+		b.WriteString("ForwardToSyslog=yes\n")
+	}
+	return b.String()
+}
+
+// rsyslogConfig returns rsyslog.conf. The configured rules replace the
+// default ones. On systemd images messages, kernel ones included, come
+// from the journal through the syslog socket.
+func rsyslogConfig(cfg db.LoggingConfig, systemd bool) string {
+	var b strings.Builder
+	b.WriteString("# rsyslog configuration\n# Generated by Linux Distribution Factory\n\n")
+	b.WriteString("module(load=\"imuxsock\")\n")
+	if !systemd {
+		b.WriteString("module(load=\"imklog\")\n")
+	}
+	b.WriteString("\nglobal(workDirectory=\"/var/lib/rsyslog\")\n")
+	b.WriteString("module(load=\"builtin:omfile\" fileCreateMode=\"0640\")\n\n")
+
+	rules := cfg.Rules
+	if len(rules) == 0 {
+		rules = defaultSyslogRules
+	}
+	for _, rule := range rules {
+		b.WriteString(strings.TrimSpace(rule) + "\n")
+	}
+
+	if remote := cfg.Remote; remote != nil {
+		protocol := strings.ToLower(remote.Protocol)
+		if protocol == "" {
+			protocol = "udp"
+		}
+		fmt.Fprintf(&b, "\n# Forward every message to the log host\n*.* action(type=\"omfwd\" target=\"%s\" port=\"%d\" protocol=\"%s\"",
+			remote.Host, syslogPort(remote), protocol)
+		if protocol == "tcp" {
+			b.WriteString(" queue.type=\"LinkedList\" queue.filename=\"forward\" action.resumeRetryCount=\"-1\"")
+		}
+		b.WriteString(")\n")
+	}
+
+	b.WriteString("\ninclude(file=\"/etc/rsyslog.d/*.conf\" mode=\"optional\")\n")
+	return b.String()
+}
+
+// syslogConfig returns the sysklogd syslog.conf
+func syslogConfig(cfg db.LoggingConfig) string {
+	var b strings.Builder
+	b.WriteString("# syslogd configuration\n# Generated by Linux Distribution Factory\n\n")
+	for _, rule := range defaultSyslogRules {
+		selector, action, _ := strings.Cut(rule, " ")
+		if action == ":omusrmsg:*" {
+			action = "*"
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", selector, action)
+	}
+	if remote := cfg.Remote; remote != nil {
+		fmt.Fprintf(&b, "\n# Forward every message to the log host\n*.*\t@%s:%d\n", remote.Host, syslogPort(remote))
+	}
+	return b.String()
+}
+
+// syslogPort returns the port of the log host
+func syslogPort(remote *db.LogForwardConfig) int {
+	if remote.Port == 0 {
+		return defaultSyslogPort
+	}
+	return remote.Port
+}
+
+// openRCLoggerScript returns the OpenRC service running the syslog daemon
+// in the foreground under supervise-daemon
+func openRCLoggerScript(system db.LoggingSystem) string {
+	command, args := "/usr/sbin/syslogd", "-F"
+	if system == db.LoggingRsyslog {
+		command, args = "/usr/sbin/rsyslogd", "-n"
+	}
+	return fmt.Sprintf(`#!/sbin/openrc-run
+description="System logger"
+supervisor=supervise-daemon
+command="%s"
+command_args="%s"
+
+depend() {
+    need localmount
+    after bootmisc
+    provide logger
+}
+`, command, args)
+}
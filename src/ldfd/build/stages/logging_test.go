@@ -0,0 +1,136 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func loggingConfig(init string, logging db.LoggingConfig) *db.DistributionConfig {
+	return &db.DistributionConfig{System: db.SystemConfig{Init: init, Logging: logging}}
+}
+
+func TestValidateLoggingConfig(t *testing.T) {
+	valid := []*db.DistributionConfig{
+		loggingConfig("systemd", db.LoggingConfig{}),
+		loggingConfig("openrc", db.LoggingConfig{}),
+		loggingConfig("systemd", db.LoggingConfig{Storage: db.JournalStorageVolatile, MaxUse: "1G", MaxRetention: "1week"}),
+		loggingConfig("openrc", db.LoggingConfig{System: db.LoggingSyslog, Remote: &db.LogForwardConfig{Host: "logs.example.com"}}),
+		loggingConfig("systemd", db.LoggingConfig{
+			System: db.LoggingRsyslog,
+			Rules:  []string{"kern.* /var/log/kern.log"},
+			Remote: &db.LogForwardConfig{Host: "10.0.0.5", Port: 6514, Protocol: "tcp"},
+		}),
+	}
+	for _, config := range valid {
+		if err := ValidateLoggingConfig(config); err != nil {
+			t.Errorf("ValidateLoggingConfig(%+v) error = %v", config.System.Logging, err)
+		}
+	}
+
+	invalid := []*db.DistributionConfig{
+		loggingConfig("openrc", db.LoggingConfig{System: db.LoggingJournald}),
+		loggingConfig("systemd", db.LoggingConfig{System: "syslog-ng"}),
+		loggingConfig("openrc", db.LoggingConfig{MaxUse: "1G"}),
+		loggingConfig("systemd", db.LoggingConfig{Storage: "disk"}),
+		loggingConfig("systemd", db.LoggingConfig{Rules: []string{"*.* /var/log/all"}}),
+		loggingConfig("systemd", db.LoggingConfig{System: db.LoggingRsyslog, Rules: []string{"*.* /var/log/all\n*.* /tmp/x"}}),
+		loggingConfig("systemd", db.LoggingConfig{Remote: &db.LogForwardConfig{Host: "logs"}}),
+		loggingConfig("openrc", db.LoggingConfig{System: db.LoggingSyslog, Remote: &db.LogForwardConfig{Host: "logs", Protocol: "tcp"}}),
+		loggingConfig("openrc", db.LoggingConfig{System: db.LoggingRsyslog, Remote: &db.LogForwardConfig{Host: "logs", Port: 70000}}),
+		loggingConfig("openrc", db.LoggingConfig{System: db.LoggingRsyslog, Remote: &db.LogForwardConfig{}}),
+	}
+	for _, config := range invalid {
+		if err := ValidateLoggingConfig(config); err == nil {
+			t.Errorf("expected error for %+v", config.System.Logging)
+		}
+	}
+}
+
+func TestJournaldConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    db.LoggingConfig
+		system db.LoggingSystem
+		want   []string
+		absent []string
+	}{
+		{"journald", db.LoggingConfig{}, db.LoggingJournald, []string{"Storage=persistent\n", "SystemMaxUse=500M\n"}, []string{"ForwardToSyslog"}},
+		{"retention", db.LoggingConfig{MaxUse: "2G", MaxRetention: "1month"}, db.LoggingJournald, []string{"SystemMaxUse=2G\n", "MaxRetentionSec=1month\n"}, nil},
+		{"rsyslog", db.LoggingConfig{}, db.LoggingRsyslog, []string{"Storage=volatile\n", "ForwardToSyslog=yes\n"}, nil},
+		{"none", db.LoggingConfig{}, db.LoggingNone, []string{"Storage=none\n"}, nil},
+	}
+	for _, tt := range tests {
+		conf := journaldConfig(tt.cfg, tt.system)
+		for _, want := range tt.want {
+			if !strings.Contains(conf, want) {
+				t.Errorf("%s: journald.conf missing %q:\n%s", tt.name, want, conf)
+			}
+		}
+		for _, absent := range tt.absent {
+			if strings.Contains(conf, absent) {
+				t.Errorf("%s: journald.conf should not contain %q", tt.name, absent)
+			}
+		}
+	}
+}
+
+func TestRsyslogConfig(t *testing.T) {
+	cfg := db.LoggingConfig{
+		Rules:  []string{"kern.* /var/log/kern.log"},
+		Remote: &db.LogForwardConfig{Host: "logs.example.com", Protocol: "TCP"},
+	}
+	conf := rsyslogConfig(cfg, true)
+	for _, want := range []string{
+		"kern.* /var/log/kern.log\n",
+		`*.* action(type="omfwd" target="logs.example.com" port="514" protocol="tcp"`,
+		`include(file="/etc/rsyslog.d/*.conf" mode="optional")`,
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("rsyslog.conf missing %q:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(conf, "/var/log/messages") || strings.Contains(conf, "imklog") {
+		t.Errorf("rules should replace the defaults and the journal provide kernel messages:\n%s", conf)
+	}
+
+	if conf := rsyslogConfig(db.LoggingConfig{}, false); !strings.Contains(conf, "imklog") || !strings.Contains(conf, "/var/log/messages") {
+		t.Errorf("unexpected default rsyslog.conf:\n%s", conf)
+	}
+}
+
+func TestConfigureLogging_OpenRCSyslog(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc", "init.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sc := &build.StageContext{
+		RootfsDir: rootfs,
+		Config:    loggingConfig("openrc", db.LoggingConfig{System: db.LoggingSyslog, Remote: &db.LogForwardConfig{Host: "logs", Port: 1514}}),
+	}
+	if err := (&AssembleStage{}).configureLogging(sc); err != nil {
+		t.Fatalf("configureLogging() error = %v", err)
+	}
+
+	conf, err := os.ReadFile(filepath.Join(rootfs, "etc", "syslog.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(conf), "*.*\t@logs:1514\n") || !strings.Contains(string(conf), "*.emerg\t*\n") {
+		t.Errorf("unexpected syslog.conf:\n%s", conf)
+	}
+	script, err := os.ReadFile(filepath.Join(rootfs, "etc", "init.d", "syslogd"))
+	if err != nil || !strings.Contains(string(script), `command="/usr/sbin/syslogd"`) {
+		t.Errorf("unexpected syslogd init script: %q, %v", script, err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "etc", "runlevels", "default", "syslogd")); err != nil {
+		t.Errorf("syslogd not enabled: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "etc", "systemd", "journald.conf")); !os.IsNotExist(err) {
+		t.Error("journald.conf written for an OpenRC image")
+	}
+}
@@ -0,0 +1,270 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/archive"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// netbootDir is the output directory the bundle is staged in, and the
+	// directory its files are published under next to the build's image
+	netbootDir = "netboot"
+	// netbootLatestDir is the distribution artifact path always holding
+	// the most recent netboot files, so boot servers can point at it once
+	netbootLatestDir = "netboot/latest"
+	// netbootArchiveName is the published bundle archive
+	netbootArchiveName = "ldf-linux-netboot.tar"
+	// netbootRootfsName is the squashfs root fetched by the initramfs
+	netbootRootfsName = "rootfs.squashfs"
+)
+
+// netbootBootFiles are the bundle files served unchanged from every path
+var netbootBootFiles = []string{"vmlinuz", "initramfs.img", netbootRootfsName}
+
+// netbootConfigFiles are the boot configurations, rendered for the URL
+// they are published under
+var netbootConfigFiles = []string{"boot.ipxe", "pxelinux.cfg/default", "grub.cfg"}
+
+// NetbootImageGenerator creates network boot bundles: a kernel, an
+// initramfs that fetches its root over HTTP or NFS, a squashfs root and
+// iPXE, PXELINUX and GRUB configurations pointing at ldfd
+type NetbootImageGenerator struct{}
+
+// NewNetbootImageGenerator creates a new netboot bundle generator
+func NewNetbootImageGenerator() *NetbootImageGenerator {
+	return &NetbootImageGenerator{}
+}
+
+// Name returns the generator name
+func (g *NetbootImageGenerator) Name() string {
+	return "netboot"
+}
+
+// Format returns the output image format
+func (g *NetbootImageGenerator) Format() db.ImageFormat {
+	return db.ImageFormatNetboot
+}
+
+// Generate stages the bundle and archives it. The configurations in the
+// archive reference the files published with this build.
+func (g *NetbootImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	bundleDir := filepath.Join(sc.OutputDir, netbootDir)
+	if err := os.RemoveAll(bundleDir); err != nil {
+		return "", fmt.Errorf("failed to clean netboot directory: %w", err)
+	}
+	if err := os.MkdirAll(bundleDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create netboot directory: %w", err)
+	}
+
+	progress(5, "Copying kernel and initramfs")
+	if err := copyKernelFiles(sc.RootfsDir, bundleDir); err != nil {
+		return "", fmt.Errorf("failed to copy boot files: %w", err)
+	}
+	if sc.SecureBoot != nil {
+		if err := signKernels(ctx, sc.SecureBoot, bundleDir, sc.SourceDateEpoch); err != nil {
+			return "", fmt.Errorf("failed to sign kernel: %w", err)
+		}
+	}
+
+	progress(15, "Creating squashfs root")
+	if err := makeSquashfs(ctx, sc.RootfsDir, filepath.Join(bundleDir, netbootRootfsName), sc.SourceDateEpoch); err != nil {
+		return "", fmt.Errorf("failed to create squashfs: %w", err)
+	}
+
+	progress(85, "Writing boot configurations")
+	buildURL := netbootURL(netbootBaseURL(sc), sc.DistributionID, path.Join("builds", sc.BuildID, netbootDir))
+	if err := writeNetbootConfigs(bundleDir, buildURL, sc.Config.Build.Netboot); err != nil {
+		return "", err
+	}
+
+	progress(90, "Archiving netboot bundle")
+	archivePath := filepath.Join(sc.OutputDir, netbootArchiveName)
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create netboot archive: %w", err)
+	}
+	err = archive.WriteTar(f, bundleDir, archiveOptions(sc, nil))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to archive netboot bundle: %w", err)
+	}
+
+	progress(100, "Netboot bundle created successfully")
+	return archivePath, nil
+}
+
+// ValidateNetbootConfig reports netboot settings that cannot produce a
+// bootable bundle. publicURL is the server-wide ldfd URL used when the
+// distribution does not set its own.
+func ValidateNetbootConfig(config *db.DistributionConfig, format db.ImageFormat, publicURL string) error {
+	cfg := config.Build.Netboot
+	switch cfg.Root {
+	case "", db.NetbootRootHTTP:
+	case db.NetbootRootNFS:
+		if !strings.Contains(cfg.NFSExport, ":/") {
+			return fmt.Errorf("NFS netboot root requires an export of the form server:/path")
+		}
+	default:
+		return fmt.Errorf("unsupported netboot root %q (use http or nfs)", cfg.Root)
+	}
+
+	if format != db.ImageFormatNetboot {
+		return nil
+	}
+	base := cfg.BaseURL
+	if base == "" {
+		base = publicURL
+	}
+	if base == "" {
+		return fmt.Errorf("netboot bundles require a base URL: set server.public_url or the distribution's netboot base_url")
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid netboot base URL %q", base)
+	}
+	return nil
+}
+
+// netbootBaseURL returns the ldfd URL booting machines fetch files from
+func netbootBaseURL(sc *build.StageContext) string {
+	if sc.Config.Build.Netboot.BaseURL != "" {
+		return sc.Config.Build.Netboot.BaseURL
+	}
+	return sc.PublicURL
+}
+
+// netbootURL returns the artifacts API URL of a distribution artifact
+// directory. Netboot clients cannot authenticate, so the distribution
+// must be public for them to download it.
+func netbootURL(baseURL, distributionID, dir string) string {
+	return fmt.Sprintf("%s/v1/distributions/%s/artifacts/%s", strings.TrimRight(baseURL, "/"), distributionID, dir)
+}
+
+// netbootKernelArgs returns the kernel command line booting the root
+// published under dirURL
+func netbootKernelArgs(cfg db.NetbootConfig, dirURL string) string {
+	args := "root=live:" + dirURL + "/" + netbootRootfsName
+	if cfg.Root == db.NetbootRootNFS {
+		args = "root=nfs:" + cfg.NFSExport
+	}
+	args += " rw quiet"
+	if cfg.KernelArgs != "" {
+		args += " " + cfg.KernelArgs
+	}
+	return args
+}
+
+// writeNetbootConfigs writes the iPXE, PXELINUX and GRUB configurations
+// loading the bundle from dirURL into dir
+func writeNetbootConfigs(dir, dirURL string, cfg db.NetbootConfig) error {
+	kernelArgs := netbootKernelArgs(cfg, dirURL)
+
+	u, err := url.Parse(dirURL)
+	if err != nil {
+		return fmt.Errorf("invalid netboot URL: %w", err)
+	}
+
+	configs := map[string]string{
+		"boot.ipxe": fmt.Sprintf(`#!ipxe
+# LDF Linux network boot
+kernel %[1]s/vmlinuz initrd=initramfs.img %[2]s
+initrd %[1]s/initramfs.img
+boot
+`, dirURL, kernelArgs),
+
+		// lpxelinux.0 is required to fetch over HTTP
+		"pxelinux.cfg/default": fmt.Sprintf(`# LDF Linux network boot
+DEFAULT ldf
+PROMPT 0
+TIMEOUT 0
+
+LABEL ldf
+    KERNEL %[1]s/vmlinuz
+    INITRD %[1]s/initramfs.img
+    APPEND %[2]s
+`, dirURL, kernelArgs),
+
+		// GRUB's http module only speaks plain HTTP
+		"grub.cfg": fmt.Sprintf(`# GRUB configuration for LDF Linux network boot
+
+set timeout=5
+set default=0
+
+insmod http
+
+menuentry "LDF Linux (Network)" {
+    linux (http,%[1]s)%[2]s/vmlinuz %[3]s
+    initrd (http,%[1]s)%[2]s/initramfs.img
+}
+`, u.Host, u.Path, kernelArgs),
+	}
+
+	for _, name := range netbootConfigFiles {
+		configPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", name, err)
+		}
+		if err := os.WriteFile(configPath, []byte(configs[name]), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// publishNetboot uploads the staged bundle files individually under
+// storageDir so machines can boot from them
+func (s *PackageStage) publishNetboot(ctx context.Context, sc *build.StageContext, storageDir string) ([]publishedFile, error) {
+	bundleDir := filepath.Join(sc.OutputDir, netbootDir)
+
+	var files []publishedFile
+	for _, name := range append(append([]string{}, netbootBootFiles...), netbootConfigFiles...) {
+		f := publishedFile{
+			localPath:  filepath.Join(bundleDir, filepath.FromSlash(name)),
+			storageKey: path.Join(storageDir, name),
+		}
+		if err := s.uploadToStorage(ctx, f.localPath, f.storageKey, nil); err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %w", name, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// promoteNetboot makes the files published under buildDir the
+// distribution's latest netboot files. Boot files are copied in storage
+// and the configurations rendered again for the stable path.
+func (s *PackageStage) promoteNetboot(ctx context.Context, sc *build.StageContext, buildDir string) error {
+	latestDir := fmt.Sprintf("distribution/%s/%s/%s", sc.OwnerID, sc.DistributionID, netbootLatestDir)
+
+	for _, name := range netbootBootFiles {
+		if err := s.storage.Copy(ctx, path.Join(buildDir, name), path.Join(latestDir, name)); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+
+	configDir := filepath.Join(sc.OutputDir, "netboot-latest")
+	if err := os.RemoveAll(configDir); err != nil {
+		return err
+	}
+	latestURL := netbootURL(netbootBaseURL(sc), sc.DistributionID, netbootLatestDir)
+	if err := writeNetbootConfigs(configDir, latestURL, sc.Config.Build.Netboot); err != nil {
+		return err
+	}
+	for _, name := range netbootConfigFiles {
+		if err := s.uploadToStorage(ctx, filepath.Join(configDir, filepath.FromSlash(name)), path.Join(latestDir, name), nil); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", name, err)
+		}
+	}
+	return nil
+}
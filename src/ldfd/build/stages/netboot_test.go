@@ -0,0 +1,144 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateNetbootConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    db.NetbootConfig
+		format    db.ImageFormat
+		publicURL string
+		wantErr   string
+	}{
+		{
+			name:      "server public URL",
+			format:    db.ImageFormatNetboot,
+			publicURL: "http://ldfd.lab:8443",
+		},
+		{
+			name:   "distribution base URL",
+			config: db.NetbootConfig{BaseURL: "https://ldfd.lab"},
+			format: db.ImageFormatNetboot,
+		},
+		{
+			name:   "no base URL on a disk image",
+			format: db.ImageFormatRaw,
+		},
+		{
+			name:    "no base URL",
+			format:  db.ImageFormatNetboot,
+			wantErr: "base URL",
+		},
+		{
+			name:    "invalid base URL",
+			config:  db.NetbootConfig{BaseURL: "tftp://ldfd.lab"},
+			format:  db.ImageFormatNetboot,
+			wantErr: "invalid netboot base URL",
+		},
+		{
+			name:      "NFS root",
+			config:    db.NetbootConfig{Root: db.NetbootRootNFS, NFSExport: "nfs.lab:/srv/ldf"},
+			format:    db.ImageFormatNetboot,
+			publicURL: "http://ldfd.lab:8443",
+		},
+		{
+			name:    "NFS root without export",
+			config:  db.NetbootConfig{Root: db.NetbootRootNFS},
+			format:  db.ImageFormatNetboot,
+			wantErr: "server:/path",
+		},
+		{
+			name:    "unknown root",
+			config:  db.NetbootConfig{Root: "iscsi"},
+			format:  db.ImageFormatNetboot,
+			wantErr: "unsupported netboot root",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &db.DistributionConfig{Build: db.BuildConfig{Netboot: tt.config}}
+			err := ValidateNetbootConfig(config, tt.format, tt.publicURL)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWriteNetbootConfigs(t *testing.T) {
+	dir := t.TempDir()
+	dirURL := netbootURL("http://ldfd.lab:8443/", "dist-1", netbootLatestDir)
+	if dirURL != "http://ldfd.lab:8443/v1/distributions/dist-1/artifacts/netboot/latest" {
+		t.Fatalf("netbootURL() = %s", dirURL)
+	}
+
+	if err := writeNetbootConfigs(dir, dirURL, db.NetbootConfig{KernelArgs: "console=ttyS0"}); err != nil {
+		t.Fatalf("writeNetbootConfigs() error = %v", err)
+	}
+
+	args := "root=live:" + dirURL + "/rootfs.squashfs rw quiet console=ttyS0"
+	for name, want := range map[string][]string{
+		"boot.ipxe": {
+			"kernel " + dirURL + "/vmlinuz initrd=initramfs.img " + args,
+			"initrd " + dirURL + "/initramfs.img",
+		},
+		"pxelinux.cfg/default": {
+			"KERNEL " + dirURL + "/vmlinuz",
+			"APPEND " + args,
+		},
+		"grub.cfg": {
+			"linux (http,ldfd.lab:8443)/v1/distributions/dist-1/artifacts/netboot/latest/vmlinuz " + args,
+		},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(data), w) {
+				t.Errorf("%s missing %q:\n%s", name, w, data)
+			}
+		}
+	}
+
+	nfs := netbootKernelArgs(db.NetbootConfig{Root: db.NetbootRootNFS, NFSExport: "nfs.lab:/srv/ldf"}, dirURL)
+	if nfs != "root=nfs:nfs.lab:/srv/ldf rw quiet" {
+		t.Errorf("NFS kernel args = %q", nfs)
+	}
+}
+
+func TestInitramfsGenerator_NetbootInit(t *testing.T) {
+	gen := NewInitramfsGenerator(t.TempDir(), "", &db.DistributionConfig{}, db.ArchX86_64)
+	if block := gen.netbootInitBlock(); block != "" {
+		t.Error("expected no network root setup for disk images")
+	}
+
+	gen.SetNetboot(true)
+	block := gen.netbootInitBlock()
+	for _, want := range []string{
+		`wget -O /run/netroot/rootfs.squashfs "${ROOT#live:}"`,
+		`mount -t nfs -o ro,nolock "${ROOT#nfs:}" /run/netroot/lower`,
+		"mount --move /run /mnt/root/run",
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("init script missing %q", want)
+		}
+	}
+	if modules := strings.Join(gen.getRequiredModules(), " "); !strings.Contains(modules, "kernel/fs/overlayfs/") {
+		t.Errorf("netboot modules missing overlayfs: %s", modules)
+	}
+}
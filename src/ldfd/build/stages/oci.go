@@ -0,0 +1,208 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/oci"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// ociLayoutDir is the output directory the image layout is written to
+	ociLayoutDir = "oci"
+	// ociArchiveName is the published layout archive
+	ociArchiveName = "ldf-linux-oci.tar"
+)
+
+// kernelContents are the rootfs directories holding the kernel, its modules
+// and the bootloader, which containers and chroots run without
+var kernelContents = []string{"boot", "lib/modules", "usr/lib/modules"}
+
+// OCIImageGenerator creates OCI container images from the rootfs
+type OCIImageGenerator struct{}
+
+// NewOCIImageGenerator creates a new OCI image generator
+func NewOCIImageGenerator() *OCIImageGenerator {
+	return &OCIImageGenerator{}
+}
+
+// Name returns the generator name
+func (g *OCIImageGenerator) Name() string {
+	return "oci"
+}
+
+// Format returns the output image format
+func (g *OCIImageGenerator) Format() db.ImageFormat {
+	return db.ImageFormatOCI
+}
+
+// Generate writes the rootfs as a single-layer image and archives the
+// image layout
+func (g *OCIImageGenerator) Generate(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	layoutDir := filepath.Join(sc.OutputDir, ociLayoutDir)
+	if err := os.RemoveAll(layoutDir); err != nil {
+		return "", fmt.Errorf("failed to clean image layout: %w", err)
+	}
+
+	created := time.Now()
+	if sc.SourceDateEpoch != 0 {
+		created = time.Unix(sc.SourceDateEpoch, 0)
+	}
+	tags := ociTags(sc)
+
+	progress(10, "Writing container image layer")
+	img, err := oci.WriteLayout(layoutDir, sc.RootfsDir, oci.Options{
+		Architecture:    ociArchitecture(sc.TargetArch),
+		Entrypoint:      containerEntrypoint(sc.Config.System.Init),
+		Env:             containerEnv(sc.Config.System.Init),
+		Labels:          ociLabels(sc, created),
+		StopSignal:      containerStopSignal(sc.Config.System.Init),
+		CreatedBy:       "ldf build " + sc.BuildID,
+		Tag:             tags[0],
+		Created:         created,
+		Reproducible:    sc.SourceDateEpoch != 0,
+		ExcludeContents: kernelContents,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write image layout: %w", err)
+	}
+	log.Info("Container image written", "manifest", img.Manifest.Digest, "layer_size", img.Layers[0].Size)
+
+	progress(80, "Archiving image layout")
+	archivePath := filepath.Join(sc.OutputDir, ociArchiveName)
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create image archive: %w", err)
+	}
+	err = oci.Archive(f, layoutDir, created)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to archive image layout: %w", err)
+	}
+
+	progress(100, fmt.Sprintf("Container image created (%s)", img.Manifest.Digest))
+	return archivePath, nil
+}
+
+// ValidateOCIConfig reports settings that container images cannot honour
+func ValidateOCIConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	if format == db.ImageFormatOCI {
+		switch {
+		case config.Security.Verity.Enabled:
+			return fmt.Errorf("dm-verity roots are not supported for OCI images")
+		case config.Update.ABSlots:
+			return fmt.Errorf("A/B slot layout is not supported for OCI images")
+		}
+	}
+
+	if config.Build.OCI.Repository != "" {
+		if _, _, err := oci.ParseRepository(config.Build.OCI.Repository); err != nil {
+			return err
+		}
+	}
+	for _, tag := range config.Build.OCI.Tags {
+		if !oci.ValidTag(tag) {
+			return fmt.Errorf("invalid OCI image tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// pushOCIImage pushes the image layout written by the OCI generator to the
+// configured repository and returns the pushed references
+func pushOCIImage(ctx context.Context, sc *build.StageContext) ([]string, error) {
+	img, err := oci.Open(filepath.Join(sc.OutputDir, ociLayoutDir))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := sc.Config.Build.OCI
+	registry := &oci.Registry{
+		Username:  sc.Registry.Username,
+		Password:  sc.Registry.Password,
+		PlainHTTP: cfg.PlainHTTP,
+	}
+	tags := ociTags(sc)
+	if err := registry.Push(ctx, img, cfg.Repository, tags); err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, len(tags))
+	for i, tag := range tags {
+		refs[i] = cfg.Repository + ":" + tag
+	}
+	return refs, nil
+}
+
+// ociTags returns the tags an image is published under
+func ociTags(sc *build.StageContext) []string {
+	if len(sc.Config.Build.OCI.Tags) > 0 {
+		return sc.Config.Build.OCI.Tags
+	}
+	if sc.DistVersion != "" && oci.ValidTag(sc.DistVersion) {
+		return []string{sc.DistVersion}
+	}
+	return []string{"latest"}
+}
+
+// ociLabels returns the labels identifying the build an image came from
+func ociLabels(sc *build.StageContext, created time.Time) map[string]string {
+	labels := map[string]string{
+		"org.opencontainers.image.created": created.UTC().Format(time.RFC3339),
+		"org.opencontainers.image.vendor":  "LDF",
+		"io.ldf.distribution.id":           sc.DistributionID,
+		"io.ldf.build.id":                  sc.BuildID,
+	}
+	if sc.DistName != "" {
+		labels["org.opencontainers.image.title"] = sc.DistName
+	}
+	if sc.DistVersion != "" {
+		labels["org.opencontainers.image.version"] = sc.DistVersion
+		labels["io.ldf.distribution.version"] = sc.DistVersion
+	}
+	return labels
+}
+
+// ociArchitecture maps a target architecture to its OCI name
+func ociArchitecture(arch db.TargetArch) string {
+	if arch == db.ArchAARCH64 {
+		return "arm64"
+	}
+	return "amd64"
+}
+
+// containerEntrypoint returns the init binary containers boot the image
+// with, matching the init installer's layout
+func containerEntrypoint(initSystem string) []string {
+	if strings.EqualFold(initSystem, "openrc") {
+		return []string{"/sbin/openrc-init"}
+	}
+	return []string{"/usr/lib/systemd/systemd"}
+}
+
+// containerEnv returns the default environment of containers. systemd
+// reads the container variable to adapt to running without a kernel.
+func containerEnv(initSystem string) []string {
+	env := []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}
+	if !strings.EqualFold(initSystem, "openrc") {
+		env = append(env, "container=oci")
+	}
+	return env
+}
+
+// containerStopSignal returns the signal that shuts the init system down
+// cleanly
+func containerStopSignal(initSystem string) string {
+	if strings.EqualFold(initSystem, "openrc") {
+		return "SIGTERM"
+	}
+	return "SIGRTMIN+3"
+}
@@ -0,0 +1,129 @@
+package stages
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/oci"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateOCIConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  db.DistributionConfig
+		format  db.ImageFormat
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			config: db.DistributionConfig{},
+			format: db.ImageFormatOCI,
+		},
+		{
+			name: "push settings on a disk image",
+			config: db.DistributionConfig{
+				Build: db.BuildConfig{OCI: db.OCIConfig{Repository: "localhost:5000/ldf/base", Tags: []string{"1.0"}}},
+			},
+			format: db.ImageFormatRaw,
+		},
+		{
+			name:    "verity",
+			config:  db.DistributionConfig{Security: db.SecurityConfig{Verity: db.VerityConfig{Enabled: true}}},
+			format:  db.ImageFormatOCI,
+			wantErr: "dm-verity",
+		},
+		{
+			name:    "A/B slots",
+			config:  db.DistributionConfig{Update: db.UpdateConfig{ABSlots: true}},
+			format:  db.ImageFormatOCI,
+			wantErr: "A/B",
+		},
+		{
+			name:    "repository without registry",
+			config:  db.DistributionConfig{Build: db.BuildConfig{OCI: db.OCIConfig{Repository: "ldf/base"}}},
+			format:  db.ImageFormatOCI,
+			wantErr: "registry host",
+		},
+		{
+			name:    "invalid tag",
+			config:  db.DistributionConfig{Build: db.BuildConfig{OCI: db.OCIConfig{Tags: []string{"v1/beta"}}}},
+			format:  db.ImageFormatOCI,
+			wantErr: "invalid OCI image tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOCIConfig(&tt.config, tt.format)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOCIImageGenerator(t *testing.T) {
+	rootfs := t.TempDir()
+	for _, path := range []string{"boot/vmlinuz", "etc/os-release", "usr/lib/modules/6.12/modules.dep"} {
+		full := filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc := &build.StageContext{
+		BuildID:         "build-1",
+		DistributionID:  "dist-1",
+		DistName:        "ldf-base",
+		DistVersion:     "1.2.0",
+		Config:          &db.DistributionConfig{System: db.SystemConfig{Init: "openrc"}},
+		TargetArch:      db.ArchAARCH64,
+		ImageFormat:     db.ImageFormatOCI,
+		RootfsDir:       rootfs,
+		OutputDir:       t.TempDir(),
+		SourceDateEpoch: 1700000000,
+	}
+
+	archive, err := NewOCIImageGenerator().Generate(context.Background(), sc, func(int, string) {})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if filepath.Base(archive) != ociArchiveName {
+		t.Errorf("archive = %s", archive)
+	}
+
+	img, err := oci.Open(filepath.Join(sc.OutputDir, ociLayoutDir))
+	if err != nil {
+		t.Fatalf("oci.Open() error = %v", err)
+	}
+	data, err := os.ReadFile(img.BlobPath(img.Config.Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"architecture":"arm64"`,
+		`"Entrypoint":["/sbin/openrc-init"]`,
+		`"io.ldf.build.id":"build-1"`,
+		`"io.ldf.distribution.id":"dist-1"`,
+		`"io.ldf.distribution.version":"1.2.0"`,
+		`"created":"2023-11-14T22:13:20Z"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("image config missing %s: %s", want, data)
+		}
+	}
+}
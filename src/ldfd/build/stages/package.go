@@ -2,11 +2,22 @@ package stages
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/bitswalk/ldf/src/common/attestation"
 	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/bundle"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
+	"github.com/bitswalk/ldf/src/ldfd/build/firmware"
+	"github.com/bitswalk/ldf/src/ldfd/build/sbom"
 	"github.com/bitswalk/ldf/src/ldfd/db"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
 )
@@ -42,6 +53,37 @@ func (s *PackageStage) Validate(ctx context.Context, sc *build.StageContext) err
 		return fmt.Errorf("output directory not set")
 	}
 
+	if err := ValidateVerityConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateUpdateConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateBootTestConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateOCIConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateEncryptionConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateNetbootConfig(sc.Config, sc.ImageFormat, sc.PublicURL); err != nil {
+		return err
+	}
+	if err := ValidateVMConfig(sc.Config); err != nil {
+		return err
+	}
+	if err := ValidateCloudConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if err := ValidateLiveConfig(sc.Config, sc.ImageFormat); err != nil {
+		return err
+	}
+	if sc.Config.Update.Bundle && sc.Signer == nil {
+		return fmt.Errorf("update bundles must be signed but no signing key is configured")
+	}
+
 	// Verify rootfs exists
 	if _, err := os.Stat(sc.RootfsDir); os.IsNotExist(err) {
 		return fmt.Errorf("rootfs directory does not exist: %s", sc.RootfsDir)
@@ -90,7 +132,53 @@ func (s *PackageStage) Execute(ctx context.Context, sc *build.StageContext, prog
 	}
 
 	log.Info("Image generated", "path", imagePath)
+	sc.ImagePath = imagePath
+
+	return s.finish(ctx, sc, imagePath, progress)
+}
+
+// finish publishes a generated image, or only records it when the build is
+// a verification rebuild
+func (s *PackageStage) finish(ctx context.Context, sc *build.StageContext, imagePath string, progress build.ProgressFunc) error {
+	if sc.VerifyOf != "" {
+		return s.packageVerification(sc, imagePath, progress)
+	}
+	return s.publish(ctx, sc, imagePath, progress)
+}
+
+// packageVerification records the checksum and rootfs manifest of a
+// verification rebuild without publishing anything: a reproducibility check
+// must not push tags, move the latest netboot files or add a release
+func (s *PackageStage) packageVerification(sc *build.StageContext, imagePath string, progress build.ProgressFunc) error {
+	progress(72, "Calculating checksum")
+	checksum, err := CalculateChecksum(imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	size, err := GetFileSize(imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to get image size: %w", err)
+	}
+
+	progress(90, "Writing rootfs manifest")
+	entries, err := build.BuildManifest(sc.RootfsDir)
+	if err != nil {
+		return fmt.Errorf("failed to build manifest: %w", err)
+	}
+	if err := build.WriteManifest(filepath.Join(sc.OutputDir, build.RootfsManifestName), entries); err != nil {
+		return err
+	}
+
+	sc.ArtifactChecksum = checksum
+	sc.ArtifactSize = size
+
+	progress(100, fmt.Sprintf("Verification image packaged, not published: %s", filepath.Base(imagePath)))
+	return nil
+}
 
+// publish uploads a generated image with its checksum, SBOMs and companion
+// files, signs them and pushes or promotes the image where configured
+func (s *PackageStage) publish(ctx context.Context, sc *build.StageContext, imagePath string, progress build.ProgressFunc) error {
 	progress(72, "Calculating checksum")
 
 	// Calculate checksum
@@ -129,6 +217,7 @@ func (s *PackageStage) Execute(ctx context.Context, sc *build.StageContext, prog
 	if err := s.uploadToStorage(ctx, imagePath, storageKey, progress); err != nil {
 		return fmt.Errorf("failed to upload to storage: %w", err)
 	}
+	published := []publishedFile{{localPath: imagePath, storageKey: storageKey}}
 
 	progress(95, "Writing checksum file")
 
@@ -142,6 +231,181 @@ func (s *PackageStage) Execute(ctx context.Context, sc *build.StageContext, prog
 		checksumKey := storageKey + ".sha256"
 		if err := s.uploadToStorage(ctx, checksumPath, checksumKey, nil); err != nil {
 			log.Warn("Failed to upload checksum file", "error", err)
+		} else {
+			published = append(published, publishedFile{localPath: checksumPath, storageKey: checksumKey})
+		}
+	}
+
+	// Publish the dm-verity root hash so deployments can pin it
+	if sc.VerityRootHash != "" {
+		rootHashPath := imagePath + ".roothash"
+		if err := os.WriteFile(rootHashPath, []byte(sc.VerityRootHash+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write root hash: %w", err)
+		}
+		rootHashKey := storageKey + ".roothash"
+		if err := s.uploadToStorage(ctx, rootHashPath, rootHashKey, nil); err != nil {
+			return fmt.Errorf("failed to upload root hash: %w", err)
+		}
+		published = append(published, publishedFile{localPath: rootHashPath, storageKey: rootHashKey})
+	}
+
+	// The recovery key is a secret: it is only exported on request, to a
+	// private path outside the distribution's artifacts, and left out of
+	// the signed artifact set
+	if sc.DiskKey != nil && sc.Config.Security.Encryption.ExportRecovery {
+		recoveryPath := filepath.Join(sc.OutputDir, "recovery-key")
+		if err := os.WriteFile(recoveryPath, []byte(sc.DiskKey.RecoveryKey+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write recovery key: %w", err)
+		}
+		recoveryKey := build.RecoveryArtifactKey(sc.OwnerID, sc.DistributionID, sc.BuildID)
+		if err := s.uploadToStorage(ctx, recoveryPath, recoveryKey, nil); err != nil {
+			return fmt.Errorf("failed to upload recovery key: %w", err)
+		}
+	}
+
+	// Publish SBOMs alongside the image
+	progress(96, "Generating SBOMs")
+	if err := s.publishSBOMs(ctx, sc, path.Dir(storageKey), filename, checksum); err != nil {
+		return fmt.Errorf("failed to publish SBOM: %w", err)
+	}
+	for _, format := range sbom.Formats {
+		published = append(published, publishedFile{
+			localPath:  filepath.Join(sc.OutputDir, format.FileName()),
+			storageKey: path.Join(path.Dir(storageKey), format.FileName()),
+		})
+	}
+
+	// The firmware report lists installed blobs and modules missing firmware
+	reportPath := filepath.Join(sc.OutputDir, firmware.ReportName)
+	if _, err := os.Stat(reportPath); err == nil {
+		reportKey := path.Join(path.Dir(storageKey), firmware.ReportName)
+		if err := s.uploadToStorage(ctx, reportPath, reportKey, nil); err != nil {
+			return fmt.Errorf("failed to upload firmware report: %w", err)
+		}
+		published = append(published, publishedFile{localPath: reportPath, storageKey: reportKey})
+	}
+
+	// Cloud images ship a NoCloud seed for local boots and, for Compute
+	// Engine, the tarball it imports
+	if cloudSeedEnabled(sc.Config) {
+		seedPath, err := writeCloudSeed(ctx, sc, sc.OutputDir)
+		if err != nil {
+			return fmt.Errorf("failed to write NoCloud seed: %w", err)
+		}
+		seedKey := path.Join(path.Dir(storageKey), cloud.SeedName)
+		if err := s.uploadToStorage(ctx, seedPath, seedKey, nil); err != nil {
+			return fmt.Errorf("failed to upload NoCloud seed: %w", err)
+		}
+		published = append(published, publishedFile{localPath: seedPath, storageKey: seedKey})
+	}
+	if cloud.Enabled(sc.Config) && cloud.Settings(sc.Config).Provider == db.CloudProviderGCE {
+		progress(96, "Packing Compute Engine image")
+		tarball, err := writeGCETarball(sc, imagePath)
+		if err != nil {
+			return err
+		}
+		tarballKey := storageKey + cloud.GCETarballSuffix
+		if err := s.uploadToStorage(ctx, tarball, tarballKey, nil); err != nil {
+			return fmt.Errorf("failed to upload Compute Engine image: %w", err)
+		}
+		published = append(published, publishedFile{localPath: tarball, storageKey: tarballKey})
+	}
+
+	// Launch descriptors boot the image in a local virtual machine
+	if vmDescriptorsSupported(sc) {
+		files, err := writeVMDescriptors(sc, imagePath, sc.OutputDir)
+		if err != nil {
+			return fmt.Errorf("failed to write VM launch descriptors: %w", err)
+		}
+		for _, f := range files {
+			key := path.Join(path.Dir(storageKey), filepath.Base(f))
+			if err := s.uploadToStorage(ctx, f, key, nil); err != nil {
+				return fmt.Errorf("failed to upload %s: %w", filepath.Base(f), err)
+			}
+			published = append(published, publishedFile{localPath: f, storageKey: key})
+		}
+	}
+
+	// Enrollment files let users put the build's Secure Boot keys into firmware
+	if sc.SecureBoot != nil && sc.Config.Security.SecureBoot.ExportEnrollment {
+		progress(97, "Exporting Secure Boot enrollment files")
+		files, err := exportEnrollment(ctx, sc.SecureBoot, filepath.Join(sc.OutputDir, build.SecureBootDir), sc.SourceDateEpoch)
+		if err != nil {
+			return fmt.Errorf("failed to export Secure Boot enrollment files: %w", err)
+		}
+		for _, f := range files {
+			key := path.Join(path.Dir(storageKey), build.SecureBootDir, filepath.Base(f))
+			if err := s.uploadToStorage(ctx, f, key, nil); err != nil {
+				return fmt.Errorf("failed to upload %s: %w", filepath.Base(f), err)
+			}
+			published = append(published, publishedFile{localPath: f, storageKey: key})
+		}
+	}
+
+	// A/B devices update from a signed bundle of the same root filesystem
+	if sc.Config.Update.Bundle {
+		progress(97, "Creating update bundle")
+		f, err := s.publishBundle(ctx, sc, path.Dir(storageKey))
+		if err != nil {
+			return fmt.Errorf("failed to publish update bundle: %w", err)
+		}
+		published = append(published, f)
+	}
+
+	// Reproducible builds publish a rootfs manifest so verification
+	// rebuilds can report which files differ
+	if sc.SourceDateEpoch != 0 {
+		progress(97, "Writing rootfs manifest")
+		if err := s.uploadManifest(ctx, sc, path.Join(path.Dir(storageKey), build.RootfsManifestName)); err != nil {
+			log.Warn("Failed to publish rootfs manifest", "error", err)
+		}
+	}
+
+	// A cpio archive is booted from RAM by the kernel published with it
+	if sc.ImageFormat == db.ImageFormatCpio {
+		f, err := s.publishCpioKernel(ctx, sc, imagePath, storageKey)
+		if err != nil {
+			return err
+		}
+		published = append(published, f)
+	}
+
+	// Netboot files are served individually so machines can boot from them
+	if sc.ImageFormat == db.ImageFormatNetboot {
+		progress(97, "Publishing netboot files")
+		files, err := s.publishNetboot(ctx, sc, path.Join(path.Dir(storageKey), netbootDir))
+		if err != nil {
+			return fmt.Errorf("failed to publish netboot files: %w", err)
+		}
+		published = append(published, files...)
+	}
+
+	// Sign everything a download portal offers. A configured signer that
+	// fails must not leave unsigned images looking like signed releases.
+	if sc.Signer != nil {
+		progress(98, "Signing artifacts")
+		for _, f := range published {
+			if err := s.signArtifact(ctx, sc, f); err != nil {
+				return fmt.Errorf("failed to sign %s: %w", filepath.Base(f.localPath), err)
+			}
+		}
+	}
+
+	// Container images are pushed once everything else is published
+	if sc.ImageFormat == db.ImageFormatOCI && sc.Config.Build.OCI.Repository != "" {
+		progress(99, "Pushing container image to "+sc.Config.Build.OCI.Repository)
+		refs, err := pushOCIImage(ctx, sc)
+		if err != nil {
+			return fmt.Errorf("failed to push container image: %w", err)
+		}
+		progress(99, "Pushed "+strings.Join(refs, ", "))
+	}
+
+	// The stable netboot path only moves to a fully published build
+	if sc.ImageFormat == db.ImageFormatNetboot {
+		progress(99, "Updating latest netboot files")
+		if err := s.promoteNetboot(ctx, sc, path.Join(path.Dir(storageKey), netbootDir)); err != nil {
+			return fmt.Errorf("failed to update latest netboot files: %w", err)
 		}
 	}
 
@@ -154,6 +418,113 @@ func (s *PackageStage) Execute(ctx context.Context, sc *build.StageContext, prog
 	return nil
 }
 
+// publishSBOMs generates an SBOM in every supported format and uploads each
+// into storageDir next to the image
+func (s *PackageStage) publishSBOMs(ctx context.Context, sc *build.StageContext, storageDir, imageName, imageChecksum string) error {
+	in := &sbom.Input{
+		BuildID:        sc.BuildID,
+		DistributionID: sc.DistributionID,
+		TargetArch:     string(sc.TargetArch),
+		ImageFormat:    string(sc.ImageFormat),
+		ImageName:      imageName,
+		ImageSHA256:    imageChecksum,
+		Created:        time.Now(),
+	}
+	if sc.SourceDateEpoch != 0 {
+		in.Created = time.Unix(sc.SourceDateEpoch, 0)
+	}
+
+	for _, rc := range sc.Components {
+		in.Components = append(in.Components, sbom.Component{
+			Name:            rc.Component.Name,
+			Version:         rc.Version,
+			Category:        rc.Component.Category,
+			Description:     rc.Component.Description,
+			SourceURL:       rc.SourceURL,
+			SHA256:          rc.SourceChecksum,
+			RetrievalMethod: rc.RetrievalMethod,
+		})
+	}
+
+	kernelConfig := filepath.Join(sc.ConfigDir, ".config")
+	if data, err := os.ReadFile(kernelConfig); err == nil {
+		sum1 := sha1.Sum(data)
+		sum256 := sha256.Sum256(data)
+		in.KernelConfig = &sbom.File{
+			Name:   "kernel/.config",
+			SHA1:   hex.EncodeToString(sum1[:]),
+			SHA256: hex.EncodeToString(sum256[:]),
+		}
+	}
+
+	for _, format := range sbom.Formats {
+		data, err := sbom.Generate(format, in)
+		if err != nil {
+			return err
+		}
+
+		localPath := filepath.Join(sc.OutputDir, format.FileName())
+		if err := os.WriteFile(localPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", format.FileName(), err)
+		}
+		if err := s.uploadToStorage(ctx, localPath, path.Join(storageDir, format.FileName()), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishedFile pairs a local output file with the storage key it was uploaded to
+type publishedFile struct {
+	localPath  string
+	storageKey string
+}
+
+// signArtifact writes a minisign signature of a published file and uploads
+// it next to the file
+func (s *PackageStage) signArtifact(ctx context.Context, sc *build.StageContext, f publishedFile) error {
+	file, err := os.Open(f.localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	timestamp := time.Now().Unix()
+	if sc.SourceDateEpoch != 0 {
+		timestamp = sc.SourceDateEpoch
+	}
+	comment := fmt.Sprintf("timestamp:%d\tfile:%s\tbuild:%s", timestamp, filepath.Base(f.localPath), sc.BuildID)
+
+	sig, err := sc.Signer.SignDetached(file, comment)
+	if err != nil {
+		return err
+	}
+
+	sigPath := f.localPath + attestation.SignatureSuffix
+	if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return s.uploadToStorage(ctx, sigPath, f.storageKey+attestation.SignatureSuffix, nil)
+}
+
+// uploadManifest writes the rootfs manifest to the output directory and
+// uploads it under storageKey
+func (s *PackageStage) uploadManifest(ctx context.Context, sc *build.StageContext, storageKey string) error {
+	entries, err := build.BuildManifest(sc.RootfsDir)
+	if err != nil {
+		return fmt.Errorf("failed to build manifest: %w", err)
+	}
+
+	manifestPath := filepath.Join(sc.OutputDir, build.RootfsManifestName)
+	if err := build.WriteManifest(manifestPath, entries); err != nil {
+		return err
+	}
+
+	return s.uploadToStorage(ctx, manifestPath, storageKey, nil)
+}
+
 // uploadToStorage uploads a file to the storage backend
 func (s *PackageStage) uploadToStorage(ctx context.Context, localPath, storageKey string, progress build.ProgressFunc) error {
 	file, err := os.Open(localPath)
@@ -177,8 +548,27 @@ func (s *PackageStage) uploadToStorage(ctx context.Context, localPath, storageKe
 		contentType = "application/x-qemu-disk"
 	case ".img":
 		contentType = "application/x-raw-disk-image"
-	case ".sha256":
+	case ".tar":
+		contentType = "application/x-tar"
+	case ".gz":
+		contentType = "application/gzip"
+	case ".sha256", ".roothash", attestation.SignatureSuffix:
 		contentType = "text/plain"
+	case bundle.Extension:
+		contentType = bundle.ContentType
+	case ".crt":
+		contentType = "application/x-pem-file"
+	case ".xml":
+		contentType = "application/xml"
+	case ".sh":
+		contentType = "text/x-shellscript"
+	case ".json":
+		contentType = "application/json"
+		for _, format := range sbom.Formats {
+			if strings.HasSuffix(localPath, format.FileName()) {
+				contentType = format.ContentType()
+			}
+		}
 	}
 
 	log.Info("Uploading artifact",
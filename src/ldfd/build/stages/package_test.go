@@ -0,0 +1,119 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/storage"
+)
+
+func TestPackageVerificationPublishesNothing(t *testing.T) {
+	var registryHits atomic.Int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryHits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer registry.Close()
+
+	backend, err := storage.NewLocal(storage.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+
+	latestDir := path.Join("distribution/owner/dist", netbootLatestDir)
+	latest := map[string]string{}
+	for _, name := range netbootBootFiles {
+		key := path.Join(latestDir, name)
+		latest[key] = "original " + name
+		if err := backend.Upload(ctx, key, strings.NewReader(latest[key]), int64(len(latest[key])), "application/octet-stream"); err != nil {
+			t.Fatalf("Upload %s: %v", key, err)
+		}
+	}
+
+	for _, format := range []db.ImageFormat{db.ImageFormatOCI, db.ImageFormatNetboot} {
+		t.Run(string(format), func(t *testing.T) {
+			rootfs := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(rootfs, "etc/os-release"), []byte("ID=ldf\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			outputDir := t.TempDir()
+			imagePath := filepath.Join(outputDir, "image")
+			if err := os.WriteFile(imagePath, []byte("image"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			sc := &build.StageContext{
+				BuildID:        "verify-1",
+				DistributionID: "dist",
+				OwnerID:        "owner",
+				VerifyOf:       "build-1",
+				ImageFormat:    format,
+				RootfsDir:      rootfs,
+				OutputDir:      outputDir,
+				Config: &db.DistributionConfig{
+					Build: db.BuildConfig{OCI: db.OCIConfig{
+						Repository: strings.TrimPrefix(registry.URL, "http://") + "/ldf/base",
+						Tags:       []string{"latest"},
+						PlainHTTP:  true,
+					}},
+				},
+			}
+
+			stage := NewPackageStage(backend, 0)
+			if err := stage.finish(ctx, sc, imagePath, noProgress); err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+
+			if sc.ArtifactPath != "" {
+				t.Errorf("verification rebuild published %s", sc.ArtifactPath)
+			}
+			if sc.ArtifactChecksum == "" {
+				t.Error("verification rebuild recorded no checksum")
+			}
+			if _, err := os.Stat(filepath.Join(outputDir, build.RootfsManifestName)); err != nil {
+				t.Errorf("rootfs manifest not written: %v", err)
+			}
+		})
+	}
+
+	if n := registryHits.Load(); n != 0 {
+		t.Errorf("verification rebuilds sent %d requests to the registry", n)
+	}
+
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != len(latest) {
+		t.Errorf("storage holds %d objects, want only the %d latest netboot files", len(objects), len(latest))
+	}
+	for key, want := range latest {
+		r, _, err := backend.Download(ctx, key)
+		if err != nil {
+			t.Fatalf("Download %s: %v", key, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, []byte(want)) {
+			t.Errorf("%s changed to %q", key, got)
+		}
+	}
+}
@@ -22,11 +22,12 @@ func DefaultStages(
 		NewCompileStage(),
 		NewAssembleStage(),
 		NewPackageStage(storage, 4), // 4GB default image size
+		NewBootTestStage(storage),
 	}
 
 	log.Info("Created default build stages",
 		"count", len(stageList),
-		"stages", []string{"resolve", "download", "prepare", "compile", "assemble", "package"})
+		"stages", []string{"resolve", "download", "prepare", "compile", "assemble", "package", "test"})
 
 	return stageList
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
 	"github.com/bitswalk/ldf/src/ldfd/build/kernel"
 	"github.com/bitswalk/ldf/src/ldfd/db"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
@@ -57,12 +58,9 @@ func (s *ResolveStage) Execute(ctx context.Context, sc *build.StageContext, prog
 	// Load board profile if configured
 	if sc.Config.BoardProfileID != "" && s.boardProfileRepo != nil {
 		progress(2, "Loading board profile")
-		profile, err := s.boardProfileRepo.GetByID(sc.Config.BoardProfileID)
+		profile, err := s.loadBoardProfile(ctx, sc)
 		if err != nil {
-			return fmt.Errorf("failed to load board profile: %w", err)
-		}
-		if profile == nil {
-			return fmt.Errorf("board profile not found: %s", sc.Config.BoardProfileID)
+			return err
 		}
 		if profile.Arch != sc.TargetArch {
 			return fmt.Errorf("board profile architecture mismatch: profile requires %s but build targets %s", profile.Arch, sc.TargetArch)
@@ -77,6 +75,11 @@ func (s *ResolveStage) Execute(ctx context.Context, sc *build.StageContext, prog
 		return fmt.Errorf("no components required for this distribution configuration")
 	}
 
+	// Firmware selected by the board profile needs the linux-firmware tree too
+	if sc.BoardProfile != nil && !sc.BoardProfile.Config.LinuxFirmware.IsEmpty() && !containsString(componentNames, linuxFirmwareComponent) {
+		componentNames = append(componentNames, linuxFirmwareComponent)
+	}
+
 	progress(10, fmt.Sprintf("Found %d required components", len(componentNames)))
 
 	// Resolve each component to its concrete version and download artifact
@@ -149,10 +152,13 @@ func (s *ResolveStage) Execute(ctx context.Context, sc *build.StageContext, prog
 		}
 
 		resolved = append(resolved, build.ResolvedComponent{
-			Component:    *component,
-			Version:      version,
-			ArtifactPath: downloadJob.ArtifactPath,
-			LocalPath:    "", // Will be set by prepare stage after extraction
+			Component:       *component,
+			Version:         version,
+			ArtifactPath:    downloadJob.ArtifactPath,
+			LocalPath:       "", // Will be set by prepare stage after extraction
+			SourceURL:       downloadJob.ResolvedURL,
+			SourceChecksum:  downloadJob.Checksum,
+			RetrievalMethod: downloadJob.RetrievalMethod,
 		})
 	}
 
@@ -189,7 +195,12 @@ func (s *ResolveStage) Execute(ctx context.Context, sc *build.StageContext, prog
 		}
 	}
 
-	// Validate build toolchain availability (non-container mode only)
+	// Fetch the SELinux modules or AppArmor profiles uploaded with the distribution
+	if err := s.fetchSecurityFiles(ctx, sc); err != nil {
+		return fmt.Errorf("failed to fetch security policy files: %w", err)
+	}
+
+	// Validate build toolchain availability on the host or in the builder image
 	progress(98, "Validating build toolchain")
 	toolchain := db.ResolveToolchain(&sc.Config.Core)
 	crossPrefix := ""
@@ -215,6 +226,17 @@ func (s *ResolveStage) Execute(ctx context.Context, sc *build.StageContext, prog
 			return fmt.Errorf("missing build toolchain dependencies: %v (install them or use a container-based executor)", missing)
 		}
 		log.Info("Build toolchain validated", "toolchain", toolchain, "deps", len(deps.All()))
+	} else if sc.Executor != nil && sc.BuildEnv != nil {
+		deps := build.GetToolchainDeps(toolchain, crossPrefix)
+		missing, err := build.CheckBuilderImageTools(ctx, sc.Executor, sc.BuildEnv.ContainerImage, sc.BuildEnv.ContainerPlatformFlag, deps)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("builder image %s is missing toolchain dependencies: %v (rebuild it via POST /v1/builder-images)",
+				sc.BuildEnv.ContainerImage, missing)
+		}
+		log.Info("Builder image toolchain validated", "toolchain", toolchain, "image", sc.BuildEnv.ContainerImage, "deps", len(deps.All()))
 	} else {
 		log.Info("Skipping toolchain validation (container mode)", "toolchain", toolchain)
 	}
@@ -332,7 +354,7 @@ func (s *ResolveStage) getRequiredComponents(config *db.DistributionConfig, targ
 
 	// Bootloader
 	if config.Core.Bootloader != "" {
-		findComponent("bootloader", config.Core.Bootloader)
+		findComponent("bootloader", bootloaderComponentName(config))
 	}
 
 	// Init system
@@ -340,6 +362,11 @@ func (s *ResolveStage) getRequiredComponents(config *db.DistributionConfig, targ
 		findComponent("init", config.System.Init)
 	}
 
+	// System logger (journald ships with systemd)
+	if name := loggingComponentName(config); name != "" {
+		findComponent("logging", name)
+	}
+
 	// Filesystem userspace tools (only if userspace flag is set)
 	if config.System.Filesystem.Type != "" && config.System.FilesystemUserspace {
 		findComponent("filesystem", config.System.Filesystem.Type)
@@ -355,16 +382,36 @@ func (s *ResolveStage) getRequiredComponents(config *db.DistributionConfig, targ
 		findComponent("runtime", config.Runtime.Container)
 	}
 
-	// Security userspace tools (only if userspace flag is set)
-	if config.Security.System != "" && config.Security.System != "none" && config.Security.SystemUserspace {
+	// Security userspace tools (only if userspace flag is set), and the
+	// AppArmor source tree when its profile sets are installed
+	if config.Security.System != "" && config.Security.System != "none" &&
+		(config.Security.SystemUserspace || needsAppArmorProfiles(config)) {
 		findComponent("security", config.Security.System)
 	}
 
+	// SELinux reference policy the targeted and mls policies are compiled from
+	if needsRefpolicy(config) {
+		findComponent("security", refpolicyComponent)
+	}
+
 	// Desktop (only if target is desktop)
 	if config.Target.Type == "desktop" && config.Target.Desktop != nil && config.Target.Desktop.Environment != "" {
 		findComponent("desktop", config.Target.Desktop.Environment)
 	}
 
+	// linux-firmware tree for the distribution's firmware selection
+	if !config.Core.Firmware.IsEmpty() {
+		findComponent("firmware", linuxFirmwareComponent)
+	}
+
+	// cloud-init, and growpart from cloud-utils, for cloud images
+	if cloud.Enabled(config) {
+		findComponent("cloud", "cloud-init")
+		if !cloud.Settings(config).NoGrowpart {
+			findComponent("cloud", "cloud-utils")
+		}
+	}
+
 	// Board profile firmware components (resolved via board profile on StageContext)
 	// Note: This is handled separately since we need the board profile loaded first.
 	// Firmware with ComponentID references will be resolved during Execute after
@@ -388,6 +435,15 @@ func (s *ResolveStage) getRequiredComponents(config *db.DistributionConfig, targ
 	return components
 }
 
+// bootloaderComponentName returns the name the bootloader component is
+// registered under; the uboot bootloader is built from the u-boot component
+func bootloaderComponentName(config *db.DistributionConfig) string {
+	if usesUBoot(config) {
+		return "u-boot"
+	}
+	return strings.ToLower(config.Core.Bootloader)
+}
+
 // getComponentVersion resolves the version for a component from config or default
 func (s *ResolveStage) getComponentVersion(config *db.DistributionConfig, component *db.Component) string {
 	// First check distribution config for explicit version override
@@ -404,13 +460,28 @@ func (s *ResolveStage) getComponentVersion(config *db.DistributionConfig, compon
 func (s *ResolveStage) getDistributionVersionOverride(config *db.DistributionConfig, componentName string) string {
 	lowerName := strings.ToLower(componentName)
 
+	// linux-firmware release
+	if lowerName == linuxFirmwareComponent {
+		return config.Core.FirmwareVersion
+	}
+
+	// cloud-init release
+	if lowerName == "cloud-init" && config.Target.Cloud != nil {
+		return config.Target.Cloud.CloudInitVersion
+	}
+
+	// SELinux reference policy release
+	if lowerName == refpolicyComponent {
+		return config.Security.SELinux.RefpolicyVersion
+	}
+
 	// Kernel version
 	if strings.Contains(lowerName, "kernel") {
 		return config.Core.Kernel.Version
 	}
 
 	// Bootloader version
-	if config.Core.Bootloader != "" && strings.Contains(lowerName, strings.ToLower(config.Core.Bootloader)) {
+	if config.Core.Bootloader != "" && strings.Contains(lowerName, bootloaderComponentName(config)) {
 		return config.Core.BootloaderVersion
 	}
 
@@ -419,6 +490,11 @@ func (s *ResolveStage) getDistributionVersionOverride(config *db.DistributionCon
 		return config.System.InitVersion
 	}
 
+	// System logger version
+	if name := loggingComponentName(config); name != "" && lowerName == name {
+		return config.System.Logging.Version
+	}
+
 	// Filesystem version
 	if config.System.Filesystem.Type != "" && strings.Contains(lowerName, strings.ToLower(config.System.Filesystem.Type)) {
 		return config.System.FilesystemVersion
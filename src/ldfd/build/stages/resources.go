@@ -0,0 +1,129 @@
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// cgroupAccountingPath is the systemd drop-in enabling resource accounting
+const cgroupAccountingPath = "/etc/systemd/system.conf.d/50-ldf-resources.conf"
+
+// resourceManager returns the configured resource manager, "" for the
+// kernel's and init system's defaults
+func resourceManager(config *db.DistributionConfig) string {
+	return strings.ToLower(config.System.Resources.Manager)
+}
+
+// cgroupHierarchy returns the cgroup hierarchy of images managed with
+// cgroups, unified unless configured otherwise
+func cgroupHierarchy(config *db.DistributionConfig) db.CgroupHierarchy {
+	if config.System.Resources.Hierarchy == "" {
+		return db.CgroupUnified
+	}
+	return config.System.Resources.Hierarchy
+}
+
+// ValidateResourceConfig reports resource management settings the init
+// system and container runtime cannot run with
+func ValidateResourceConfig(config *db.DistributionConfig) error {
+	cfg := config.System.Resources
+	switch resourceManager(config) {
+	case "":
+		if cfg.Hierarchy != "" {
+			return fmt.Errorf("a cgroup hierarchy requires the cgroups resource manager")
+		}
+	case "cgroups":
+		switch cfg.Hierarchy {
+		case "", db.CgroupUnified, db.CgroupHybrid, db.CgroupLegacy:
+		default:
+			return fmt.Errorf("unsupported cgroup hierarchy %q (supported: unified, hybrid, legacy)", cfg.Hierarchy)
+		}
+	case "none":
+		if cfg.Hierarchy != "" {
+			return fmt.Errorf("a cgroup hierarchy requires the cgroups resource manager")
+		}
+		if GetInitInstaller(config.System.Init).Name() == "systemd" {
+			return fmt.Errorf("the systemd init system requires cgroups")
+		}
+		if config.Runtime.Container != "" {
+			return fmt.Errorf("container runtime %s requires cgroups", config.Runtime.Container)
+		}
+	default:
+		return fmt.Errorf("unsupported resource manager %q (supported: cgroups, none)", cfg.Manager)
+	}
+	return nil
+}
+
+// cgroupKernelArgs returns the kernel arguments, with a leading space,
+// selecting the cgroup hierarchy. systemd releases dropping cgroup v1
+// only mount it when forced.
+func cgroupKernelArgs(config *db.DistributionConfig) string {
+	if resourceManager(config) != "cgroups" {
+		return ""
+	}
+	hierarchy := cgroupHierarchy(config)
+	if GetInitInstaller(config.System.Init).Name() != "systemd" {
+		if hierarchy == db.CgroupUnified {
+			return " cgroup_no_v1=all"
+		}
+		return ""
+	}
+	switch hierarchy {
+	case db.CgroupHybrid:
+		return " systemd.unified_cgroup_hierarchy=0 systemd.legacy_systemd_cgroup_controller=0 SYSTEMD_CGROUP_ENABLE_LEGACY_FORCE=1"
+	case db.CgroupLegacy:
+		return " systemd.unified_cgroup_hierarchy=0 systemd.legacy_systemd_cgroup_controller=1 SYSTEMD_CGROUP_ENABLE_LEGACY_FORCE=1"
+	default:
+		return " systemd.unified_cgroup_hierarchy=1 cgroup_no_v1=all"
+	}
+}
+
+// configureResources configures the init system for the resource
+// manager: systemd accounts every unit's resources, OpenRC mounts the
+// selected hierarchy and places services in their own cgroups
+func (s *AssembleStage) configureResources(sc *build.StageContext) error {
+	manager := resourceManager(sc.Config)
+	if manager == "" {
+		return nil
+	}
+
+	if GetInitInstaller(sc.Config.System.Init).Name() == "systemd" {
+		accounting := `# Resource accounting
+# Generated by Linux Distribution Factory
+
+[Manager]
+DefaultCPUAccounting=yes
+DefaultIOAccounting=yes
+DefaultMemoryAccounting=yes
+DefaultTasksAccounting=yes
+`
+		if err := writeRootfsFile(sc.RootfsDir, cgroupAccountingPath, []byte(accounting)); err != nil {
+			return fmt.Errorf("failed to write systemd resource accounting: %w", err)
+		}
+	} else {
+		settings := "\n# Resource management\nrc_controller_cgroups=\"NO\"\n"
+		if manager == "cgroups" {
+			settings = fmt.Sprintf("\n# Resource management\nrc_cgroup_mode=\"%s\"\nrc_controller_cgroups=\"YES\"\n", cgroupHierarchy(sc.Config))
+		}
+		rcConf := filepath.Join(sc.RootfsDir, "etc", "rc.conf")
+		f, err := os.OpenFile(rcConf, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open rc.conf: %w", err)
+		}
+		_, err = f.WriteString(settings)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write rc.conf: %w", err)
+		}
+	}
+
+	log.Info("Configured resource management", "manager", manager, "hierarchy", cgroupHierarchy(sc.Config))
+	return nil
+}
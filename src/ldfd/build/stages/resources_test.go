@@ -0,0 +1,96 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func resourceConfig(init string, resources db.ResourceConfig) *db.DistributionConfig {
+	return &db.DistributionConfig{System: db.SystemConfig{Init: init, Resources: resources}}
+}
+
+func TestValidateResourceConfig(t *testing.T) {
+	valid := []*db.DistributionConfig{
+		resourceConfig("systemd", db.ResourceConfig{}),
+		resourceConfig("systemd", db.ResourceConfig{Manager: "cgroups", Hierarchy: db.CgroupHybrid}),
+		resourceConfig("openrc", db.ResourceConfig{Manager: "none"}),
+	}
+	for _, config := range valid {
+		if err := ValidateResourceConfig(config); err != nil {
+			t.Errorf("ValidateResourceConfig(%+v) error = %v", config.System.Resources, err)
+		}
+	}
+
+	withContainers := resourceConfig("openrc", db.ResourceConfig{Manager: "none"})
+	withContainers.Runtime.Container = "podman"
+	invalid := []*db.DistributionConfig{
+		resourceConfig("systemd", db.ResourceConfig{Manager: "none"}),
+		resourceConfig("systemd", db.ResourceConfig{Manager: "rctl"}),
+		resourceConfig("systemd", db.ResourceConfig{Manager: "cgroups", Hierarchy: "v3"}),
+		resourceConfig("openrc", db.ResourceConfig{Hierarchy: db.CgroupLegacy}),
+		withContainers,
+	}
+	for _, config := range invalid {
+		if err := ValidateResourceConfig(config); err == nil {
+			t.Errorf("expected error for %+v", config.System.Resources)
+		}
+	}
+}
+
+func TestCgroupKernelArgs(t *testing.T) {
+	tests := []struct {
+		config *db.DistributionConfig
+		want   string
+	}{
+		{resourceConfig("systemd", db.ResourceConfig{}), ""},
+		{resourceConfig("systemd", db.ResourceConfig{Manager: "cgroups"}), " systemd.unified_cgroup_hierarchy=1 cgroup_no_v1=all"},
+		{resourceConfig("systemd", db.ResourceConfig{Manager: "cgroups", Hierarchy: db.CgroupLegacy}),
+			" systemd.unified_cgroup_hierarchy=0 systemd.legacy_systemd_cgroup_controller=1 SYSTEMD_CGROUP_ENABLE_LEGACY_FORCE=1"},
+		{resourceConfig("openrc", db.ResourceConfig{Manager: "cgroups"}), " cgroup_no_v1=all"},
+		{resourceConfig("openrc", db.ResourceConfig{Manager: "cgroups", Hierarchy: db.CgroupHybrid}), ""},
+	}
+	for _, tt := range tests {
+		if got := cgroupKernelArgs(tt.config); got != tt.want {
+			t.Errorf("cgroupKernelArgs(%s, %+v) = %q, want %q", tt.config.System.Init, tt.config.System.Resources, got, tt.want)
+		}
+	}
+
+	sc := &build.StageContext{Config: resourceConfig("systemd", db.ResourceConfig{Manager: "cgroups"}), TargetArch: db.ArchX86_64}
+	if got := imageKernelArgs(sc); got != " systemd.unified_cgroup_hierarchy=1 cgroup_no_v1=all" {
+		t.Errorf("imageKernelArgs() = %q", got)
+	}
+}
+
+func TestConfigureResources(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "etc", "rc.conf"), []byte("rc_parallel=\"YES\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sc := &build.StageContext{RootfsDir: rootfs, Config: resourceConfig("openrc", db.ResourceConfig{Manager: "cgroups", Hierarchy: db.CgroupHybrid})}
+	if err := (&AssembleStage{}).configureResources(sc); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(rootfs, "etc", "rc.conf"))
+	for _, want := range []string{"rc_parallel=\"YES\"\n", "rc_cgroup_mode=\"hybrid\"\n", "rc_controller_cgroups=\"YES\"\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("rc.conf missing %q:\n%s", want, data)
+		}
+	}
+
+	sc = &build.StageContext{RootfsDir: t.TempDir(), Config: resourceConfig("systemd", db.ResourceConfig{Manager: "cgroups"})}
+	if err := (&AssembleStage{}).configureResources(sc); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(sc.RootfsDir, filepath.FromSlash(cgroupAccountingPath)))
+	if err != nil || !strings.Contains(string(data), "DefaultMemoryAccounting=yes") {
+		t.Errorf("unexpected systemd accounting drop-in: %q, %v", data, err)
+	}
+}
@@ -247,13 +247,17 @@ func (b *RootfsBuilder) GenerateHostname(hostname string) error {
 		return fmt.Errorf("failed to write hostname: %w", err)
 	}
 
-	// Also update /etc/hosts
+	// Also update /etc/hosts, with the short name of a fully qualified one
+	names := hostname
+	if short, _, ok := strings.Cut(hostname, "."); ok {
+		names += " " + short
+	}
 	hosts := fmt.Sprintf(`127.0.0.1   localhost
 127.0.1.1   %s
 ::1         localhost ip6-localhost ip6-loopback
 ff02::1     ip6-allnodes
 ff02::2     ip6-allrouters
-`, hostname)
+`, names)
 
 	hostsPath := filepath.Join(b.rootfsPath, "etc", "hosts")
 	if err := os.WriteFile(hostsPath, []byte(hosts), 0644); err != nil {
@@ -264,27 +268,52 @@ ff02::2     ip6-allrouters
 	return nil
 }
 
-// ConfigureNetworking sets up basic networking configuration
+// ConfigureNetworking renders the distribution's network settings for
+// its init system: systemd-networkd and systemd-resolved, or netifrc on
+// OpenRC. Without declared interfaces every link uses DHCP.
 func (b *RootfsBuilder) ConfigureNetworking() error {
-	// Create resolv.conf with common public DNS
-	resolvConf := `# Generated by Linux Distribution Factory
-# Replace with your preferred DNS servers
-nameserver 1.1.1.1
-nameserver 8.8.8.8
-nameserver 9.9.9.9
-`
-	resolvPath := filepath.Join(b.rootfsPath, "etc", "resolv.conf")
-	if err := os.WriteFile(resolvPath, []byte(resolvConf), 0644); err != nil {
+	network := b.config.Settings.Network
+	if err := writeRootfsFile(b.rootfsPath, "/etc/resolv.conf", []byte(resolvConf(network))); err != nil {
 		return fmt.Errorf("failed to write resolv.conf: %w", err)
 	}
 
-	// Create basic network interface configuration
-	interfacesDir := filepath.Join(b.rootfsPath, "etc", "network")
-	if err := os.MkdirAll(interfacesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create network dir: %w", err)
+	initInstaller := GetInitInstaller(b.config.System.Init)
+	if initInstaller.Name() == "systemd" {
+		for name, data := range networkdFiles(network) {
+			if err := writeRootfsFile(b.rootfsPath, "/etc/systemd/network/"+name, []byte(data)); err != nil {
+				return fmt.Errorf("failed to write network config: %w", err)
+			}
+		}
+		if conf := resolvedConf(network); conf != "" {
+			if err := writeRootfsFile(b.rootfsPath, "/etc/systemd/resolved.conf.d/50-ldf-dns.conf", []byte(conf)); err != nil {
+				return fmt.Errorf("failed to write resolved config: %w", err)
+			}
+		}
+	} else if len(network.Interfaces) > 0 {
+		if err := writeRootfsFile(b.rootfsPath, "/etc/conf.d/net", []byte(netifrcConf(network))); err != nil {
+			return fmt.Errorf("failed to write netifrc config: %w", err)
+		}
+		// netifrc replaces the DHCP-only network service
+		os.Remove(filepath.Join(b.rootfsPath, "etc", "runlevels", "boot", "network"))
+		if err := os.MkdirAll(filepath.Join(b.rootfsPath, "etc", "init.d"), 0755); err != nil {
+			return fmt.Errorf("failed to create init.d: %w", err)
+		}
+		for _, name := range netifrcServices(network) {
+			service := "net." + name
+			link := filepath.Join(b.rootfsPath, "etc", "init.d", service)
+			os.Remove(link)
+			if err := os.Symlink("net.lo", link); err != nil {
+				return fmt.Errorf("failed to create %s: %w", service, err)
+			}
+			if err := initInstaller.EnableService(b.rootfsPath, service); err != nil {
+				return err
+			}
+		}
 	}
 
-	interfaces := `# Generated by Linux Distribution Factory
+	if len(network.Interfaces) == 0 {
+		// Create basic network interface configuration
+		interfaces := `# Generated by Linux Distribution Factory
 # Loopback interface
 auto lo
 iface lo inet loopback
@@ -293,12 +322,86 @@ iface lo inet loopback
 auto eth0
 iface eth0 inet dhcp
 `
-	interfacesPath := filepath.Join(interfacesDir, "interfaces")
-	if err := os.WriteFile(interfacesPath, []byte(interfaces), 0644); err != nil {
-		return fmt.Errorf("failed to write interfaces: %w", err)
+		if err := writeRootfsFile(b.rootfsPath, "/etc/network/interfaces", []byte(interfaces)); err != nil {
+			return fmt.Errorf("failed to write interfaces: %w", err)
+		}
+	}
+
+	log.Info("Configured networking", "interfaces", len(network.Interfaces), "dns", len(network.DNS))
+	return nil
+}
+
+// ConfigureLocalization sets the system locale, console keymap and time
+// zone, read by systemd-localed on systemd images and by the login
+// shell and keymaps service on OpenRC images
+func (b *RootfsBuilder) ConfigureLocalization() error {
+	settings := b.config.Settings
+	locale := defaultLocaleOf(settings)
+	keymap := settings.Keymap
+	if keymap == "" {
+		keymap = defaultKeymap
+	}
+	timezone := settings.Timezone
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+
+	files := map[string]string{
+		"/etc/locale.conf": "LANG=" + locale + "\n",
+		"/etc/timezone":    timezone + "\n",
+	}
+	if len(settings.Locales) > 0 {
+		files["/etc/locale.gen"] = localeGen(settings.Locales)
+	}
+	initInstaller := GetInitInstaller(b.config.System.Init)
+	if initInstaller.Name() == "systemd" {
+		files["/etc/vconsole.conf"] = "KEYMAP=" + keymap + "\n"
+	} else {
+		files["/etc/profile.d/locale.sh"] = "export LANG=" + locale + "\n"
+		files["/etc/conf.d/keymaps"] = fmt.Sprintf("keymap=\"%s\"\n", keymap)
+	}
+	for name, data := range files {
+		if err := writeRootfsFile(b.rootfsPath, name, []byte(data)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if initInstaller.Name() != "systemd" {
+		if err := initInstaller.EnableService(b.rootfsPath, "keymaps"); err != nil {
+			return err
+		}
+	}
+
+	localtime := filepath.Join(b.rootfsPath, "etc", "localtime")
+	os.Remove(localtime)
+	if err := os.Symlink("../usr/share/zoneinfo/"+timezone, localtime); err != nil {
+		return fmt.Errorf("failed to link localtime: %w", err)
+	}
+
+	log.Info("Configured localization", "locale", locale, "keymap", keymap, "timezone", timezone)
+	return nil
+}
+
+// ConfigureTimeSync points systemd-timesyncd, or ntpd on OpenRC images,
+// at the configured NTP servers
+func (b *RootfsBuilder) ConfigureTimeSync() error {
+	servers := b.config.Settings.NTPServers
+	if len(servers) == 0 {
+		return nil
+	}
+
+	initInstaller := GetInitInstaller(b.config.System.Init)
+	path, conf, service := "/etc/systemd/timesyncd.conf", timesyncdConf(servers), "systemd-timesyncd.service"
+	if initInstaller.Name() != "systemd" {
+		path, conf, service = "/etc/ntp.conf", ntpConf(servers), "ntpd"
+	}
+	if err := writeRootfsFile(b.rootfsPath, path, []byte(conf)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := initInstaller.EnableService(b.rootfsPath, service); err != nil {
+		return err
 	}
 
-	log.Info("Configured basic networking")
+	log.Info("Configured time synchronization", "servers", servers)
 	return nil
 }
 
@@ -453,7 +556,9 @@ func copyFile(src, dst string) error {
 	return err
 }
 
-// copyDir recursively copies a directory
+// copyDir recursively copies a directory. filepath.Walk visits entries in
+// lexical order, so the copy order is deterministic; copied files get fresh
+// mtimes, which reproducible builds reset with build.NormalizeTree.
 func copyDir(src, dst string) error {
 	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -0,0 +1,362 @@
+package stages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/google/uuid"
+)
+
+const (
+	// rpiBootDir is where the assemble stage stages the Raspberry Pi boot
+	// partition; the running system mounts the partition there
+	rpiBootDir = "boot/firmware"
+	// rpiDefaultKernelImage is the 64-bit kernel the firmware loads
+	rpiDefaultKernelImage = "kernel8.img"
+	// rpiInitramfsImage is the initramfs name on the boot partition
+	rpiInitramfsImage = "initramfs8"
+	// rootPartUUIDPlaceholder is replaced by the root partition's PARTUUID
+	// once the image's partition table exists
+	rootPartUUIDPlaceholder = "ROOT_PARTUUID"
+)
+
+// boardImageLayout returns the image layout of board, gpt by default
+func boardImageLayout(board *db.BoardProfile) db.BoardImageLayout {
+	if board == nil || board.Config.ImageLayout == "" {
+		return db.BoardImageLayoutGPT
+	}
+	return board.Config.ImageLayout
+}
+
+// ValidateBoardImageLayout reports board image layouts the configuration
+// cannot be packaged in. The Raspberry Pi layout is booted by the board
+// firmware, so the distribution's bootloader is not installed to it.
+func ValidateBoardImageLayout(config *db.DistributionConfig, board *db.BoardProfile, format db.ImageFormat) error {
+	switch boardImageLayout(board) {
+	case db.BoardImageLayoutGPT:
+		return nil
+	case db.BoardImageLayoutRPi:
+	default:
+		return fmt.Errorf("unsupported board image layout %q (use gpt or rpi)", board.Config.ImageLayout)
+	}
+
+	if format != "" && format != db.ImageFormatRaw {
+		return fmt.Errorf("the Raspberry Pi image layout requires the raw image format, got %s", format)
+	}
+	if config.Security.SecureBoot.Enabled || config.Security.Encryption.Enabled || config.Security.Verity.Enabled {
+		return fmt.Errorf("Secure Boot, disk encryption and dm-verity are not supported with the Raspberry Pi image layout")
+	}
+	if config.Update.ABSlots {
+		return fmt.Errorf("the A/B slot layout is not supported with the Raspberry Pi image layout")
+	}
+	if config.Build.BootTest.Enabled {
+		return fmt.Errorf("boot tests are not supported with the Raspberry Pi image layout")
+	}
+	if usesUBoot(config) {
+		return fmt.Errorf("the uboot bootloader is not supported with the Raspberry Pi image layout")
+	}
+	return nil
+}
+
+// rpiFirmwareDir maps a board firmware install path into the rootfs. The
+// Raspberry Pi layout moves /boot firmware onto the boot partition.
+func rpiFirmwareDir(board *db.BoardProfile, path string) string {
+	if boardImageLayout(board) == db.BoardImageLayoutRPi && filepath.Clean("/"+path) == "/boot" {
+		return rpiBootDir
+	}
+	return path
+}
+
+// stageRPiBootPartition fills the rootfs boot/firmware directory with what
+// the Raspberry Pi firmware loads: the kernel, initramfs, device trees and
+// overlays, config.txt and cmdline.txt. Board firmware blobs are already
+// installed there.
+func (s *AssembleStage) stageRPiBootPartition(sc *build.StageContext) error {
+	if boardImageLayout(sc.BoardProfile) != db.BoardImageLayoutRPi {
+		return nil
+	}
+	bootParams := sc.BoardProfile.Config.BootParams
+	bootDir := filepath.Join(sc.RootfsDir, rpiBootDir)
+	if err := os.MkdirAll(filepath.Join(bootDir, "overlays"), 0755); err != nil {
+		return fmt.Errorf("failed to create boot partition directory: %w", err)
+	}
+
+	kernelImage := bootParams.KernelImage
+	if kernelImage == "" {
+		kernelImage = rpiDefaultKernelImage
+	}
+	if err := copyFile(filepath.Join(sc.RootfsDir, "boot", "vmlinuz"), filepath.Join(bootDir, kernelImage)); err != nil {
+		return fmt.Errorf("failed to stage kernel: %w", err)
+	}
+	initramfs := false
+	if _, err := os.Stat(filepath.Join(sc.RootfsDir, "boot", "initramfs.img")); err == nil {
+		if err := copyFile(filepath.Join(sc.RootfsDir, "boot", "initramfs.img"), filepath.Join(bootDir, rpiInitramfsImage)); err != nil {
+			return fmt.Errorf("failed to stage initramfs: %w", err)
+		}
+		initramfs = true
+	}
+
+	// The firmware looks for device trees at the top of the partition and
+	// for overlays/<name>.dtbo without the kernel's -overlay suffix
+	dtbs, _ := filepath.Glob(filepath.Join(sc.RootfsDir, "boot", "dtbs", "*.dtb"))
+	for _, dtb := range dtbs {
+		if err := copyFile(dtb, filepath.Join(bootDir, filepath.Base(dtb))); err != nil {
+			return fmt.Errorf("failed to stage device tree %s: %w", filepath.Base(dtb), err)
+		}
+	}
+	overlays, _ := filepath.Glob(filepath.Join(sc.RootfsDir, "boot", "dtbs", "overlays", "*.dtbo"))
+	for _, overlay := range overlays {
+		name := strings.TrimSuffix(filepath.Base(overlay), "-overlay.dtbo")
+		name = strings.TrimSuffix(name, ".dtbo") + ".dtbo"
+		if err := copyFile(overlay, filepath.Join(bootDir, "overlays", name)); err != nil {
+			return fmt.Errorf("failed to stage overlay %s: %w", name, err)
+		}
+	}
+	if len(dtbs) == 0 {
+		log.Warn("No device trees staged on the boot partition, the firmware falls back to its own")
+	}
+
+	if err := os.WriteFile(filepath.Join(bootDir, "config.txt"), []byte(rpiConfigTxt(bootParams, kernelImage, initramfs)), 0644); err != nil {
+		return fmt.Errorf("failed to write config.txt: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(bootDir, "cmdline.txt"), []byte(rpiCmdline(sc.BoardProfile.Config.KernelCmdline)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write cmdline.txt: %w", err)
+	}
+
+	log.Info("Staged Raspberry Pi boot partition", "kernel", kernelImage, "dtbs", len(dtbs), "overlays", len(overlays))
+	return nil
+}
+
+// rpiConfigTxt returns the board's config.txt pointing the firmware at the
+// staged kernel and initramfs, unless it already names them
+func rpiConfigTxt(bootParams db.BoardBootParams, kernelImage string, initramfs bool) string {
+	conf := bootParams.ConfigTxt
+	if conf != "" && !strings.HasSuffix(conf, "\n") {
+		conf += "\n"
+	}
+
+	var extra []string
+	if !strings.Contains(conf, "kernel=") && kernelImage != rpiDefaultKernelImage {
+		extra = append(extra, "kernel="+kernelImage)
+	}
+	if initramfs && !strings.Contains(conf, "initramfs ") {
+		extra = append(extra, "initramfs "+rpiInitramfsImage+" followkernel")
+	}
+	if len(extra) == 0 {
+		return conf
+	}
+	return conf + "\n# Added by Linux Distribution Factory\n" + strings.Join(extra, "\n") + "\n"
+}
+
+// rpiCmdline returns the board's kernel command line with the root device
+// replaced by the root partition's PARTUUID
+func rpiCmdline(cmdline string) string {
+	args := []string{"root=PARTUUID=" + rootPartUUIDPlaceholder}
+	rootwait := false
+	for _, arg := range strings.Fields(cmdline) {
+		switch {
+		case strings.HasPrefix(arg, "root="):
+			continue
+		case arg == "rootwait":
+			rootwait = true
+		}
+		args = append(args, arg)
+	}
+	if !rootwait {
+		args = append(args, "rootwait")
+	}
+	return strings.Join(args, " ")
+}
+
+// generateRPi creates an SD card image the Raspberry Pi boot ROM reads: an
+// MBR with a bootable FAT32 partition holding boot/firmware and the root
+// partition, referenced by PARTUUID
+func (g *RawImageGenerator) generateRPi(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	imagePath := filepath.Join(sc.OutputDir, "disk.img")
+
+	progress(5, "Creating sparse disk image")
+	if err := g.createSparseImage(imagePath, g.sizeGB*1024); err != nil {
+		return "", fmt.Errorf("failed to create image: %w", err)
+	}
+
+	progress(10, "Creating partition table")
+	diskID := rpiDiskID(sc.SourceDateEpoch)
+	if err := createMBRPartitionTable(ctx, imagePath, diskID); err != nil {
+		return "", fmt.Errorf("failed to create partitions: %w", err)
+	}
+
+	// Point fstab and cmdline.txt at the partitions before the root
+	// filesystem is populated
+	rootUUID := uuid.NewString()
+	if sc.SourceDateEpoch != 0 {
+		rootUUID = build.DeterministicUUID(sc.SourceDateEpoch, "rootfs")
+	}
+	if err := SubstituteRootUUID(sc.RootfsDir, rootUUID); err != nil {
+		return "", fmt.Errorf("failed to set root UUID: %w", err)
+	}
+	if err := writeRPiFstab(sc.RootfsDir, diskID); err != nil {
+		return "", fmt.Errorf("failed to write fstab: %w", err)
+	}
+	if err := replaceInFiles([]string{filepath.Join(sc.RootfsDir, rpiBootDir, "cmdline.txt")}, rootPartUUIDPlaceholder, diskID+"-02"); err != nil {
+		return "", fmt.Errorf("failed to set root PARTUUID: %w", err)
+	}
+
+	progress(20, "Setting up loop device")
+	loopDev, err := g.setupLoopDevice(ctx, imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to setup loop device: %w", err)
+	}
+	defer func() {
+		if err := g.detachLoopDevice(ctx, loopDev); err != nil {
+			log.Warn("Failed to detach loop device", "device", loopDev, "error", err)
+		}
+	}()
+
+	progress(25, "Formatting partitions")
+	if err := g.formatPartitions(ctx, loopDev+"p1", loopDev+"p2", sc.RootfsDir, rootUUID, sc.SourceDateEpoch); err != nil {
+		return "", fmt.Errorf("failed to format partitions: %w", err)
+	}
+
+	progress(30, "Mounting partitions")
+	mountPoint, err := os.MkdirTemp("", "ldf-mount-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create mount point: %w", err)
+	}
+	defer os.RemoveAll(mountPoint)
+
+	bootMount := filepath.Join(mountPoint, rpiBootDir)
+	mounted := []string{}
+	unmount := func() error {
+		for len(mounted) > 0 {
+			target := mounted[len(mounted)-1]
+			if output, err := exec.CommandContext(ctx, "umount", target).CombinedOutput(); err != nil {
+				return fmt.Errorf("umount %s failed: %s: %s", target, err, output)
+			}
+			mounted = mounted[:len(mounted)-1]
+		}
+		return nil
+	}
+	defer func() {
+		if err := unmount(); err != nil {
+			log.Warn("Failed to unmount partitions", "error", err)
+		}
+	}()
+
+	// Reproducible builds populated the root at mkfs time and leave it
+	// unmounted, as a mount records mount counts, times and journal state
+	// in its superblock
+	if sc.SourceDateEpoch != 0 {
+		bootMount = mountPoint
+	} else {
+		if output, err := exec.CommandContext(ctx, "mount", loopDev+"p2", mountPoint).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("mount root failed: %s: %s", err, output)
+		}
+		mounted = append(mounted, mountPoint)
+
+		progress(40, "Copying root filesystem")
+		if err := g.copyRootfs(ctx, sc.RootfsDir, mountPoint); err != nil {
+			return "", fmt.Errorf("failed to copy rootfs: %w", err)
+		}
+	}
+
+	progress(70, "Populating boot partition")
+	if err := os.MkdirAll(bootMount, 0755); err != nil {
+		return "", fmt.Errorf("failed to create boot mount point: %w", err)
+	}
+	if output, err := exec.CommandContext(ctx, "mount", loopDev+"p1", bootMount).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("mount boot partition failed: %s: %s", err, output)
+	}
+	mounted = append(mounted, bootMount)
+	if err := copyDir(filepath.Join(sc.RootfsDir, rpiBootDir), bootMount); err != nil {
+		return "", fmt.Errorf("failed to populate boot partition: %w", err)
+	}
+	if sc.SourceDateEpoch != 0 {
+		if err := build.NormalizeTree(bootMount, sc.SourceDateEpoch); err != nil {
+			return "", fmt.Errorf("failed to normalize boot partition: %w", err)
+		}
+	}
+
+	progress(85, "Syncing and unmounting")
+	if err := g.syncFilesystem(ctx, mountPoint); err != nil {
+		log.Warn("Failed to sync filesystem", "error", err)
+	}
+	if err := unmount(); err != nil {
+		return "", fmt.Errorf("failed to unmount: %w", err)
+	}
+
+	progress(100, "Raspberry Pi image created successfully")
+	return imagePath, nil
+}
+
+// rpiDiskID returns the MBR disk identifier, which the partitions'
+// PARTUUIDs derive from
+func rpiDiskID(epoch int64) string {
+	if epoch != 0 {
+		return build.DeterministicVolumeID(epoch, "disk")
+	}
+	id := uuid.New()
+	return hex.EncodeToString(id[:4])
+}
+
+// createMBRPartitionTable creates the MBR with a bootable 512 MiB FAT32
+// partition and the root partition filling the rest
+func createMBRPartitionTable(ctx context.Context, imagePath, diskID string) error {
+	script := fmt.Sprintf(`label: dos
+label-id: 0x%s
+start=2048, size=512MiB, type=c, bootable
+type=83
+`, diskID)
+
+	cmd := exec.CommandContext(ctx, "sfdisk", "--no-reread", "--no-tell-kernel", imagePath)
+	cmd.Stdin = strings.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sfdisk failed: %s: %s", err, output)
+	}
+	return nil
+}
+
+// writeRPiFstab points the root entry at the root PARTUUID and mounts the
+// boot partition on /boot/firmware in place of the ESP
+func writeRPiFstab(rootfsDir, diskID string) error {
+	fstabPath := filepath.Join(rootfsDir, "etc", "fstab")
+	data, err := os.ReadFile(fstabPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") {
+			switch fields[1] {
+			case "/boot/efi", "/boot/firmware":
+				continue
+			case "/":
+				line = strings.Replace(line, fields[0], fmt.Sprintf("PARTUUID=%s-02", diskID), 1)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines,
+		"",
+		"# Raspberry Pi boot partition",
+		fmt.Sprintf("PARTUUID=%s-01 /boot/firmware vfat defaults,noatime 0 2", diskID),
+	)
+
+	if err := os.MkdirAll(filepath.Dir(fstabPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fstabPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,123 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateBoardImageLayout(t *testing.T) {
+	rpi := &db.BoardProfile{Config: db.BoardConfig{ImageLayout: db.BoardImageLayoutRPi}}
+
+	tests := []struct {
+		name    string
+		config  db.DistributionConfig
+		board   *db.BoardProfile
+		format  db.ImageFormat
+		wantErr string
+	}{
+		{name: "no board", format: db.ImageFormatQCOW2},
+		{name: "rpi raw", board: rpi, format: db.ImageFormatRaw},
+		{name: "rpi qcow2", board: rpi, format: db.ImageFormatQCOW2, wantErr: "requires the raw image format"},
+		{
+			name:    "unknown layout",
+			board:   &db.BoardProfile{Config: db.BoardConfig{ImageLayout: "mbr"}},
+			format:  db.ImageFormatRaw,
+			wantErr: "unsupported board image layout",
+		},
+		{
+			name:    "rpi encrypted",
+			config:  db.DistributionConfig{Security: db.SecurityConfig{Encryption: db.EncryptionConfig{Enabled: true}}},
+			board:   rpi,
+			format:  db.ImageFormatRaw,
+			wantErr: "not supported with the Raspberry Pi image layout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBoardImageLayout(&tt.config, tt.board, tt.format)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStageRPiBootPartition(t *testing.T) {
+	rootfs := t.TempDir()
+	for path, content := range map[string]string{
+		"boot/vmlinuz":                                    "kernel",
+		"boot/initramfs.img":                              "initramfs",
+		"boot/dtbs/bcm2712-rpi-5-b.dtb":                   "dtb",
+		"boot/dtbs/overlays/vc4-kms-v3d-pi5-overlay.dtbo": "overlay",
+		"etc/fstab":                                       "UUID=ROOT_UUID   /              ext4     defaults,noatime     0       1\nUUID=EFI_UUID    /boot/efi      vfat    umask=0077        0       2\n",
+	} {
+		full := filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sc := &build.StageContext{
+		RootfsDir: rootfs,
+		BoardProfile: &db.BoardProfile{Config: db.BoardConfig{
+			ImageLayout:   db.BoardImageLayoutRPi,
+			KernelCmdline: "console=serial0,115200 root=/dev/mmcblk0p2 rootfstype=ext4",
+			BootParams: db.BoardBootParams{
+				ConfigTxt:   "arm_64bit=1",
+				KernelImage: "kernel_2712.img",
+			},
+		}},
+	}
+	if err := (&AssembleStage{}).stageRPiBootPartition(sc); err != nil {
+		t.Fatalf("stageRPiBootPartition() error = %v", err)
+	}
+
+	bootDir := filepath.Join(rootfs, rpiBootDir)
+	for _, want := range []string{"kernel_2712.img", "initramfs8", "bcm2712-rpi-5-b.dtb", "overlays/vc4-kms-v3d-pi5.dtbo"} {
+		if _, err := os.Stat(filepath.Join(bootDir, want)); err != nil {
+			t.Errorf("boot partition missing %s", want)
+		}
+	}
+	config, _ := os.ReadFile(filepath.Join(bootDir, "config.txt"))
+	for _, want := range []string{"arm_64bit=1\n", "kernel=kernel_2712.img\n", "initramfs initramfs8 followkernel\n"} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf("config.txt missing %q:\n%s", want, config)
+		}
+	}
+
+	// The image generator fills in the PARTUUIDs once the disk ID is known
+	if err := writeRPiFstab(rootfs, "0a1b2c3d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceInFiles([]string{filepath.Join(bootDir, "cmdline.txt")}, rootPartUUIDPlaceholder, "0a1b2c3d-02"); err != nil {
+		t.Fatal(err)
+	}
+	cmdline, _ := os.ReadFile(filepath.Join(bootDir, "cmdline.txt"))
+	if want := "root=PARTUUID=0a1b2c3d-02 console=serial0,115200 rootfstype=ext4 rootwait\n"; string(cmdline) != want {
+		t.Errorf("cmdline.txt = %q, want %q", cmdline, want)
+	}
+	fstab, _ := os.ReadFile(filepath.Join(rootfs, "etc", "fstab"))
+	for _, want := range []string{"PARTUUID=0a1b2c3d-02   /              ext4", "PARTUUID=0a1b2c3d-01 /boot/firmware vfat"} {
+		if !strings.Contains(string(fstab), want) {
+			t.Errorf("fstab missing %q:\n%s", want, fstab)
+		}
+	}
+	if strings.Contains(string(fstab), "/boot/efi") {
+		t.Errorf("fstab still mounts the ESP:\n%s", fstab)
+	}
+}
@@ -0,0 +1,169 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// signEFIBinary signs a PE binary in place with the db key
+func signEFIBinary(ctx context.Context, keys *build.SecureBootKeys, path string, epoch int64) error {
+	signed := path + ".signed"
+	cmd := exec.CommandContext(ctx, "sbsign",
+		"--key", keys.DBKey,
+		"--cert", keys.DBCert,
+		"--output", signed,
+		path)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(signed)
+		return fmt.Errorf("sbsign %s failed: %s: %s", filepath.Base(path), err, output)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(signed, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(signed, path)
+}
+
+// signKernels signs every kernel image in bootDir so shim and systemd-stub
+// accept it with Secure Boot enforcing
+func signKernels(ctx context.Context, keys *build.SecureBootKeys, bootDir string, epoch int64) error {
+	kernels, _ := filepath.Glob(filepath.Join(bootDir, "vmlinuz*"))
+	for _, kernel := range kernels {
+		info, err := os.Lstat(kernel)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if err := signEFIBinary(ctx, keys, kernel, epoch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signESP signs every EFI executable on the mounted ESP, covering
+// systemd-boot, GRUB, the fallback loader and UKIs
+func signESP(ctx context.Context, keys *build.SecureBootKeys, espDir string, epoch int64) ([]string, error) {
+	var signed []string
+	err := filepath.WalkDir(espDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !strings.EqualFold(filepath.Ext(path), ".efi") {
+			return nil
+		}
+		if err := signEFIBinary(ctx, keys, path, epoch); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(espDir, path)
+		signed = append(signed, rel)
+		return nil
+	})
+	return signed, err
+}
+
+// assembleUKI builds the unified kernel image on the host from rootfsDir
+// with the command line in cmdlinePath, after the root UUID or verity root
+// hash is known, and installs it on espDir together with a copy as the
+// removable-media fallback loader
+func assembleUKI(ctx context.Context, sc *build.StageContext, uki *UKIInstaller, rootfsDir, cmdlinePath, espDir string) error {
+	output := filepath.Join(espDir, uki.UKIPath())
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create UKI directory: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "ukify", uki.UKIArgs(rootfsDir, cmdlinePath, output)...)
+	cmd.Env = reproducibleCmdEnv(sc.SourceDateEpoch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ukify failed: %s: %s", err, out)
+	}
+
+	fallback := efiFallbackName(sc.TargetArch)
+	if fallback == "" {
+		return nil
+	}
+	bootDir := filepath.Join(espDir, "EFI", "BOOT")
+	if err := os.MkdirAll(bootDir, 0755); err != nil {
+		return fmt.Errorf("failed to create EFI boot directory: %w", err)
+	}
+	return copyFile(output, filepath.Join(bootDir, fallback))
+}
+
+// efiFallbackName returns the removable-media loader name for the target
+// architecture, or an empty string when it has none
+func efiFallbackName(arch db.TargetArch) string {
+	switch arch {
+	case db.ArchX86_64:
+		return "BOOTX64.EFI"
+	case db.ArchAARCH64:
+		return "BOOTAA64.EFI"
+	default:
+		return ""
+	}
+}
+
+// enrollmentRoles lists the key hierarchy levels in enrollment order
+var enrollmentRoles = []string{"PK", "KEK", "db"}
+
+// exportEnrollment writes the certificates, EFI signature lists and signed
+// authenticated variable updates needed to enroll the key set into firmware
+// (for example with KeyTool, efi-updatevar or sbctl). Returns the written paths.
+func exportEnrollment(ctx context.Context, keys *build.SecureBootKeys, outDir string, epoch int64) ([]string, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create enrollment directory: %w", err)
+	}
+
+	certs := map[string]string{"PK": keys.PKCert, "KEK": keys.KEKCert, "db": keys.DBCert}
+	// PK and KEK updates are authorized by PK, db updates by KEK
+	signers := map[string][2]string{
+		"PK":  {keys.PKKey, keys.PKCert},
+		"KEK": {keys.PKKey, keys.PKCert},
+		"db":  {keys.KEKKey, keys.KEKCert},
+	}
+
+	var files []string
+	for _, role := range enrollmentRoles {
+		crt := filepath.Join(outDir, role+".crt")
+		esl := filepath.Join(outDir, role+".esl")
+		auth := filepath.Join(outDir, role+".auth")
+
+		if err := copyFile(certs[role], crt); err != nil {
+			return nil, fmt.Errorf("failed to copy %s certificate: %w", role, err)
+		}
+
+		cmd := exec.CommandContext(ctx, "cert-to-efi-sig-list", "-g", keys.OwnerGUID, crt, esl)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("cert-to-efi-sig-list %s failed: %s: %s", role, err, out)
+		}
+
+		args := []string{}
+		if epoch != 0 {
+			// The timestamp is part of the signed data
+			args = append(args, "-t", time.Unix(epoch, 0).UTC().Format(time.ANSIC))
+		}
+		args = append(args, "-g", keys.OwnerGUID,
+			"-k", signers[role][0], "-c", signers[role][1],
+			role, esl, auth)
+		cmd = exec.CommandContext(ctx, "sign-efi-sig-list", args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("sign-efi-sig-list %s failed: %s: %s", role, err, out)
+		}
+
+		files = append(files, crt, esl, auth)
+	}
+
+	return files, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
 )
 
 // SecuritySetup defines the interface for security framework setup
@@ -22,11 +23,13 @@ type SecuritySetup interface {
 }
 
 // SELinuxSetup configures SELinux
-type SELinuxSetup struct{}
+type SELinuxSetup struct {
+	config db.SELinuxConfig
+}
 
 // NewSELinuxSetup creates a new SELinux setup
-func NewSELinuxSetup() *SELinuxSetup {
-	return &SELinuxSetup{}
+func NewSELinuxSetup(config db.SELinuxConfig) *SELinuxSetup {
+	return &SELinuxSetup{config: config}
 }
 
 // Name returns the security framework name
@@ -37,17 +40,16 @@ func (s *SELinuxSetup) Name() string {
 // Install installs SELinux files
 func (s *SELinuxSetup) Install(rootfsPath string, component *build.ResolvedComponent) error {
 	// Create SELinux directories
+	policy := selinuxPolicy(s.config)
 	dirs := []string{
 		"/etc/selinux",
-		"/etc/selinux/targeted",
-		"/etc/selinux/targeted/policy",
-		"/etc/selinux/targeted/contexts",
-		"/etc/selinux/targeted/contexts/files",
-		"/etc/selinux/targeted/contexts/users",
-		"/etc/selinux/targeted/modules",
-		"/etc/selinux/targeted/modules/active",
+		"/etc/selinux/" + policy,
+		"/etc/selinux/" + policy + "/policy",
+		"/etc/selinux/" + policy + "/contexts",
+		"/etc/selinux/" + policy + "/contexts/files",
+		"/etc/selinux/" + policy + "/contexts/users",
 		"/var/lib/selinux",
-		"/var/lib/selinux/targeted",
+		"/var/lib/selinux/" + policy,
 	}
 
 	for _, dir := range dirs {
@@ -66,59 +68,53 @@ func (s *SELinuxSetup) Install(rootfsPath string, component *build.ResolvedCompo
 	return nil
 }
 
-// Configure configures SELinux
+// Configure configures SELinux. The policy, its file contexts and the
+// labels are produced later by applySecurityPolicy.
 func (s *SELinuxSetup) Configure(rootfsPath string) error {
+	policy := selinuxPolicy(s.config)
+	mode := "permissive"
+	if s.config.Enforcing {
+		mode = "enforcing"
+	}
+
 	// Create main SELinux config
-	selinuxConfig := `# SELinux configuration
+	selinuxConfig := fmt.Sprintf(`# SELinux configuration
 # Generated by Linux Distribution Factory
 
 # SELINUX can take one of these values:
 #     enforcing - SELinux security policy is enforced
 #     permissive - SELinux prints warnings instead of enforcing
 #     disabled - No SELinux policy is loaded
-SELINUX=permissive
+SELINUX=%s
 
-# SELINUXTYPE can take one of these values:
+# SELINUXTYPE names the policy under /etc/selinux:
 #     targeted - Targeted processes are protected
-#     minimum - Modification of targeted policy
 #     mls - Multi Level Security protection
-SELINUXTYPE=targeted
-`
+#     custom - Policy modules provided with the distribution
+SELINUXTYPE=%s
+`, mode, policy)
 	configPath := filepath.Join(rootfsPath, "etc", "selinux", "config")
 	if err := os.WriteFile(configPath, []byte(selinuxConfig), 0644); err != nil {
 		return fmt.Errorf("failed to write SELinux config: %w", err)
 	}
 
-	// Create targeted policy config
-	targetedConfig := `# Targeted policy configuration
-policy_version = 33
-`
-	targetedPath := filepath.Join(rootfsPath, "etc", "selinux", "targeted", "setrans.conf")
-	if err := os.WriteFile(targetedPath, []byte(targetedConfig), 0644); err != nil {
-		return fmt.Errorf("failed to write targeted config: %w", err)
-	}
-
 	// Create seusers file
 	seusers := `# SELinux user mapping
 __default__:unconfined_u:s0-s0:c0.c1023
 root:unconfined_u:s0-s0:c0.c1023
 `
-	seusersPath := filepath.Join(rootfsPath, "etc", "selinux", "targeted", "seusers")
+	if policy == string(db.SELinuxPolicyMLS) {
+		seusers = `# SELinux user mapping
+__default__:user_u:s0
+root:root:s0-s15:c0.c1023
+`
+	}
+	seusersPath := filepath.Join(rootfsPath, "etc", "selinux", policy, "seusers")
 	if err := os.WriteFile(seusersPath, []byte(seusers), 0644); err != nil {
 		return fmt.Errorf("failed to write seusers: %w", err)
 	}
 
-	// Create file_contexts placeholder
-	fileContexts := `# SELinux file contexts
-# This file needs to be populated with proper contexts
-/.*     system_u:object_r:default_t:s0
-`
-	fcPath := filepath.Join(rootfsPath, "etc", "selinux", "targeted", "contexts", "files", "file_contexts")
-	if err := os.WriteFile(fcPath, []byte(fileContexts), 0644); err != nil {
-		return fmt.Errorf("failed to write file_contexts: %w", err)
-	}
-
-	log.Info("Configured SELinux")
+	log.Info("Configured SELinux", "policy", policy, "mode", mode)
 	return nil
 }
 
@@ -128,11 +124,20 @@ func (s *SELinuxSetup) GetKernelParams() string {
 }
 
 // AppArmorSetup configures AppArmor
-type AppArmorSetup struct{}
+type AppArmorSetup struct {
+	config db.AppArmorConfig
+}
 
 // NewAppArmorSetup creates a new AppArmor setup
-func NewAppArmorSetup() *AppArmorSetup {
-	return &AppArmorSetup{}
+func NewAppArmorSetup(config db.AppArmorConfig) *AppArmorSetup {
+	return &AppArmorSetup{config: config}
+}
+
+// appArmorProfileDirs are the directories of the AppArmor source tree
+// holding each profile set
+var appArmorProfileDirs = map[db.AppArmorProfileSet]string{
+	db.AppArmorProfilesBase:   "profiles/apparmor.d",
+	db.AppArmorProfilesExtras: "profiles/apparmor/profiles/extras",
 }
 
 // Name returns the security framework name
@@ -168,31 +173,41 @@ func (a *AppArmorSetup) Install(rootfsPath string, component *build.ResolvedComp
 		log.Info("Installing AppArmor from source", "path", component.LocalPath)
 	}
 
+	for _, set := range a.config.ProfileSets {
+		if component == nil || component.LocalPath == "" {
+			return fmt.Errorf("AppArmor profile set %s requires the apparmor component", set)
+		}
+		src := filepath.Join(component.LocalPath, filepath.FromSlash(appArmorProfileDirs[set]))
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("AppArmor %s has no %s profile set: %w", component.Version, set, err)
+		}
+		if err := copyDir(src, filepath.Join(rootfsPath, "etc", "apparmor.d")); err != nil {
+			return fmt.Errorf("failed to install AppArmor %s profiles: %w", set, err)
+		}
+		log.Info("Installed AppArmor profile set", "set", set)
+	}
+
 	log.Info("Installed AppArmor structure")
 	return nil
 }
 
-// Configure configures AppArmor
+// Configure configures AppArmor. Profiles are precompiled later by
+// applySecurityPolicy into the cache named here.
 func (a *AppArmorSetup) Configure(rootfsPath string) error {
 	// Create main AppArmor config
-	apparmorConfig := `# AppArmor configuration
+	apparmorConfig := `# AppArmor parser configuration
 # Generated by Linux Distribution Factory
 
-# Enable AppArmor
-APPARMOR_ENABLE=yes
-
-# Write cache for faster loading
-APPARMOR_WRITE_CACHE=yes
-
-# Enable additional profiling features
-APPARMOR_ADDITIONAL_PROFILING=no
+# Profiles are precompiled at build time; keep the cache current
+write-cache
+cache-loc ` + appArmorCacheDir + `
 `
 	configPath := filepath.Join(rootfsPath, "etc", "apparmor", "parser.conf")
 	if err := os.WriteFile(configPath, []byte(apparmorConfig), 0644); err != nil {
 		return fmt.Errorf("failed to write AppArmor config: %w", err)
 	}
 
-	// Create tunables/global
+	// Create tunables/global, unless a profile set provides it
 	tunablesGlobal := `# AppArmor global tunables
 @{HOME}=@{HOMEDIRS}/*/ /root/
 @{HOMEDIRS}=/home/
@@ -201,11 +216,11 @@ APPARMOR_ADDITIONAL_PROFILING=no
 @{RUN}=/run/ /var/run/
 `
 	tunablesPath := filepath.Join(rootfsPath, "etc", "apparmor.d", "tunables", "global")
-	if err := os.WriteFile(tunablesPath, []byte(tunablesGlobal), 0644); err != nil {
+	if err := writeFileIfMissing(tunablesPath, []byte(tunablesGlobal)); err != nil {
 		return fmt.Errorf("failed to write tunables: %w", err)
 	}
 
-	// Create base abstraction
+	// Create base abstraction, unless a profile set provides it
 	abstractionBase := `# AppArmor base abstraction
   /etc/ld.so.cache r,
   /etc/ld.so.conf r,
@@ -222,14 +237,22 @@ APPARMOR_ADDITIONAL_PROFILING=no
   @{PROC}/sys/kernel/random/uuid r,
 `
 	basePath := filepath.Join(rootfsPath, "etc", "apparmor.d", "abstractions", "base")
-	if err := os.WriteFile(basePath, []byte(abstractionBase), 0644); err != nil {
+	if err := writeFileIfMissing(basePath, []byte(abstractionBase)); err != nil {
 		return fmt.Errorf("failed to write base abstraction: %w", err)
 	}
 
-	log.Info("Configured AppArmor")
+	log.Info("Configured AppArmor", "profile_sets", a.config.ProfileSets, "complain", a.config.Complain)
 	return nil
 }
 
+// writeFileIfMissing writes data to path unless the file exists
+func writeFileIfMissing(path string, data []byte) error {
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
 // GetKernelParams returns AppArmor kernel parameters
 func (a *AppArmorSetup) GetKernelParams() string {
 	return "apparmor=1 security=apparmor"
@@ -265,12 +288,12 @@ func (n *NoSecuritySetup) GetKernelParams() string {
 }
 
 // GetSecuritySetup returns the appropriate security setup for the config
-func GetSecuritySetup(securitySystem string) SecuritySetup {
-	switch strings.ToLower(securitySystem) {
+func GetSecuritySetup(security db.SecurityConfig) SecuritySetup {
+	switch strings.ToLower(security.System) {
 	case "selinux":
-		return NewSELinuxSetup()
+		return NewSELinuxSetup(security.SELinux)
 	case "apparmor":
-		return NewAppArmorSetup()
+		return NewAppArmorSetup(security.AppArmor)
 	case "none", "":
 		return NewNoSecuritySetup()
 	default:
@@ -0,0 +1,408 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/common/paths"
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/kernel"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// securityFilesDir is the workspace directory holding the SELinux
+	// modules or AppArmor profiles uploaded with the distribution
+	securityFilesDir = "security-files"
+	// refpolicyComponent is the component providing the SELinux reference
+	// policy the targeted and mls policies are compiled from
+	refpolicyComponent = "refpolicy"
+	// securityPolicyScript is the workspace script compiling the policy
+	securityPolicyScript = "security-policy.sh"
+	// appArmorCacheDir is where the precompiled AppArmor profiles are kept
+	appArmorCacheDir = "/var/cache/apparmor"
+)
+
+// SecurityArtifactPrefix returns the storage prefix of the policy files
+// uploaded as artifacts of a distribution for a security system. SELinux
+// takes modules as .pp, .cil or .te with an optional .fc of the same
+// name; AppArmor takes profiles laid out as in /etc/apparmor.d.
+func SecurityArtifactPrefix(ownerID, distributionID, system string) string {
+	return fmt.Sprintf("distribution/%s/%s/security/%s/", ownerID, distributionID, strings.ToLower(system))
+}
+
+// selinuxPolicy returns the name of the SELinux policy, its directory
+// under /etc/selinux
+func selinuxPolicy(config db.SELinuxConfig) string {
+	if config.Policy == "" {
+		return string(db.SELinuxPolicyTargeted)
+	}
+	return string(config.Policy)
+}
+
+// ValidateSecurityConfig reports SELinux and AppArmor settings that do not
+// match the security system or name unknown policies and profile sets
+func ValidateSecurityConfig(config *db.DistributionConfig) error {
+	security := config.Security
+	system := strings.ToLower(security.System)
+	if security.SELinux != (db.SELinuxConfig{}) && system != "selinux" {
+		return fmt.Errorf("SELinux settings require the selinux security system")
+	}
+	if (len(security.AppArmor.ProfileSets) > 0 || security.AppArmor.Complain) && system != "apparmor" {
+		return fmt.Errorf("AppArmor settings require the apparmor security system")
+	}
+
+	switch db.SELinuxPolicy(selinuxPolicy(security.SELinux)) {
+	case db.SELinuxPolicyTargeted, db.SELinuxPolicyMLS, db.SELinuxPolicyCustom:
+	default:
+		return fmt.Errorf("unsupported SELinux policy %q (supported: targeted, mls, custom)", security.SELinux.Policy)
+	}
+	for _, set := range security.AppArmor.ProfileSets {
+		if _, ok := appArmorProfileDirs[set]; !ok {
+			return fmt.Errorf("unknown AppArmor profile set %q (supported: base, extras)", set)
+		}
+	}
+	return nil
+}
+
+// fetchSecurityFiles downloads the policy files uploaded for the
+// distribution's security system into the workspace
+func (s *ResolveStage) fetchSecurityFiles(ctx context.Context, sc *build.StageContext) error {
+	system := strings.ToLower(sc.Config.Security.System)
+	if s.storage == nil || (system != "selinux" && system != "apparmor") {
+		return nil
+	}
+	prefix := SecurityArtifactPrefix(sc.OwnerID, sc.DistributionID, system)
+	objects, err := s.storage.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(sc.WorkspacePath, securityFilesDir, system)
+	for _, obj := range objects {
+		rel, err := paths.CleanRelative(strings.TrimPrefix(obj.Key, prefix))
+		if err != nil {
+			return err
+		}
+		localPath := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return err
+		}
+		if err := s.downloadToFile(ctx, obj.Key, localPath); err != nil {
+			return err
+		}
+	}
+	if len(objects) > 0 {
+		log.Info("Fetched security policy files", "system", system, "files", len(objects))
+	}
+	return nil
+}
+
+// securityFiles returns the workspace directory of the policy files
+// uploaded for system, or "" when there are none
+func securityFiles(sc *build.StageContext, system string) string {
+	dir := filepath.Join(sc.WorkspacePath, securityFilesDir, system)
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return ""
+	}
+	return dir
+}
+
+// needsRefpolicy reports whether the SELinux policy is compiled from the
+// reference policy
+func needsRefpolicy(config *db.DistributionConfig) bool {
+	return strings.EqualFold(config.Security.System, "selinux") && config.Security.SELinux.Policy != db.SELinuxPolicyCustom
+}
+
+// needsAppArmorProfiles reports whether AppArmor profile sets are
+// installed from the AppArmor source tree
+func needsAppArmorProfiles(config *db.DistributionConfig) bool {
+	return strings.EqualFold(config.Security.System, "apparmor") && len(config.Security.AppArmor.ProfileSets) > 0
+}
+
+// findRefpolicyComponent returns the resolved reference policy component
+func findRefpolicyComponent(components []build.ResolvedComponent) *build.ResolvedComponent {
+	for i := range components {
+		if components[i].Component.Name == refpolicyComponent {
+			return &components[i]
+		}
+	}
+	return nil
+}
+
+// verifySecurityKernelOptions checks that the image's kernel has the
+// security system built in. Kernels installed without their .config are
+// not checked.
+func verifySecurityKernelOptions(rootfsPath, system string) error {
+	options, err := kernel.ParseConfigFile(filepath.Join(rootfsPath, "boot", "config"))
+	if err != nil {
+		log.Warn("Kernel config not found, skipping security option check", "system", system, "error", err)
+		return nil
+	}
+	var missing []string
+	for _, key := range kernel.RequiredSecurityOptions(system) {
+		if options[key] != "y" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("kernel lacks options required by %s: %s", system, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// applySecurityPolicy compiles the SELinux policy and labels the root
+// filesystem with its file contexts, or precompiles the AppArmor
+// profiles, with the tools of the build executor. It runs once the root
+// filesystem holds its final files.
+func (s *AssembleStage) applySecurityPolicy(ctx context.Context, sc *build.StageContext) error {
+	system := strings.ToLower(sc.Config.Security.System)
+	if system != "selinux" && system != "apparmor" {
+		return nil
+	}
+	if err := verifySecurityKernelOptions(sc.RootfsDir, system); err != nil {
+		return err
+	}
+	if sc.Executor == nil {
+		return fmt.Errorf("build executor not available - no executor configured")
+	}
+
+	local := securityFiles(sc, system)
+	var refpolicy, script string
+	switch system {
+	case "selinux":
+		cfg := sc.Config.Security.SELinux
+		if cfg.Policy != db.SELinuxPolicyCustom {
+			comp := findRefpolicyComponent(sc.Components)
+			if comp == nil || comp.LocalPath == "" {
+				return fmt.Errorf("the %s SELinux policy requires the %s component", selinuxPolicy(cfg), refpolicyComponent)
+			}
+			refpolicy = comp.LocalPath
+		} else if local == "" {
+			return fmt.Errorf("the custom SELinux policy requires policy modules uploaded under security/selinux/")
+		}
+		script = selinuxPolicyScript(cfg)
+
+	case "apparmor":
+		profilesDir := filepath.Join(sc.RootfsDir, "etc", "apparmor.d")
+		if local != "" {
+			if err := copyDir(local, profilesDir); err != nil {
+				return fmt.Errorf("failed to install AppArmor profiles: %w", err)
+			}
+			local = ""
+		}
+		if sc.Config.Security.AppArmor.Complain {
+			if err := forceComplain(profilesDir); err != nil {
+				return err
+			}
+		}
+		script = appArmorPolicyScript(sc.Config.Security.AppArmor)
+	}
+
+	scriptsDir := filepath.Join(sc.WorkspacePath, "scripts")
+	if err := os.MkdirAll(scriptsDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(scriptsDir, securityPolicyScript), []byte(script), 0755); err != nil {
+		return fmt.Errorf("failed to write security policy script: %w", err)
+	}
+	env := map[string]string{"ROOTFS": sc.RootfsDir}
+	if refpolicy != "" {
+		env["REFPOLICY"] = refpolicy
+	}
+	if local != "" {
+		env["LOCAL_MODULES"] = local
+	}
+	applyReproducibleEnv(env, sc.SourceDateEpoch)
+
+	var output bytes.Buffer
+	var logOutput io.Writer = &output
+	if sc.LogWriter != nil {
+		logOutput = io.MultiWriter(&output, sc.LogWriter)
+	}
+	opts := build.ContainerRunOpts{
+		Env:     env,
+		Command: []string{"/bin/sh", filepath.Join(scriptsDir, securityPolicyScript)},
+		Stdout:  logOutput,
+		Stderr:  logOutput,
+	}
+	// Writing security.* extended attributes needs CAP_SYS_ADMIN
+	if sc.Executor.RuntimeType().IsContainerRuntime() {
+		opts.Image = sc.Executor.DefaultImage()
+		if sc.BuildEnv != nil {
+			opts.Image = sc.BuildEnv.ContainerImage
+			opts.Platform = sc.BuildEnv.ContainerPlatformFlag
+		}
+		opts.Mounts = []build.Mount{
+			{Source: sc.RootfsDir, Target: "/rootfs"},
+			{Source: scriptsDir, Target: "/scripts", ReadOnly: true},
+		}
+		if refpolicy != "" {
+			opts.Mounts = append(opts.Mounts, build.Mount{Source: refpolicy, Target: "/src/refpolicy"})
+			env["REFPOLICY"] = "/src/refpolicy"
+		}
+		if local != "" {
+			opts.Mounts = append(opts.Mounts, build.Mount{Source: local, Target: "/security-files", ReadOnly: true})
+			env["LOCAL_MODULES"] = "/security-files"
+		}
+		opts.Privileged = true
+		env["ROOTFS"] = "/rootfs"
+		opts.Command = []string{"/bin/sh", "/scripts/" + securityPolicyScript}
+	}
+
+	if err := sc.Executor.Run(ctx, opts); err != nil {
+		return fmt.Errorf("%s policy build failed: %w: %s", system, err, strings.TrimSpace(output.String()))
+	}
+
+	if system == "selinux" {
+		policy := selinuxPolicy(sc.Config.Security.SELinux)
+		binaries, _ := filepath.Glob(filepath.Join(sc.RootfsDir, "etc", "selinux", policy, "policy", "policy.*"))
+		if len(binaries) == 0 {
+			return fmt.Errorf("SELinux policy build did not produce /etc/selinux/%s/policy", policy)
+		}
+		log.Info("Compiled SELinux policy and labeled the root filesystem", "policy", policy)
+	} else {
+		log.Info("Precompiled AppArmor profiles", "cache", appArmorCacheDir)
+	}
+	return nil
+}
+
+// forceComplain links every profile in profilesDir into force-complain,
+// which makes the boot-time loader keep them in complain mode
+func forceComplain(profilesDir string) error {
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil {
+		return err
+	}
+	complainDir := filepath.Join(profilesDir, "force-complain")
+	if err := os.MkdirAll(complainDir, 0755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		link := filepath.Join(complainDir, e.Name())
+		os.Remove(link)
+		if err := os.Symlink("../"+e.Name(), link); err != nil {
+			return fmt.Errorf("failed to put %s in complain mode: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+// selinuxPolicyScript returns the script compiling the SELinux policy into
+// the rootfs at $ROOTFS and labeling it. $REFPOLICY is the reference
+// policy source and $LOCAL_MODULES the uploaded modules, when set. The
+// reference policy modules are installed at priority 100 and the uploaded
+// ones at 400, so the latter replace modules of the same name.
+func selinuxPolicyScript(config db.SELinuxConfig) string {
+	policy := selinuxPolicy(config)
+	policyType := "mcs"
+	if config.Policy == db.SELinuxPolicyMLS {
+		policyType = "mls"
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# Generated by LDF: compiles the SELinux policy into the rootfs and labels it
+set -e
+
+POLICY=%s
+STORE="$ROOTFS/etc/selinux/$POLICY"
+MODULE_DIR="$ROOTFS/usr/share/selinux/$POLICY"
+
+if [ -n "${REFPOLICY:-}" ]; then
+    echo "Compiling the reference policy as $POLICY..."
+    REFPOLICY_ARGS="NAME=$POLICY TYPE=%s MONOLITHIC=n UBAC=n UNK_PERMS=allow"
+    make -C "$REFPOLICY" $REFPOLICY_ARGS conf
+    make -C "$REFPOLICY" $REFPOLICY_ARGS DESTDIR="$ROOTFS" install
+fi
+
+set --
+if [ -d "$MODULE_DIR" ]; then
+    set -- -X 100
+    for module in "$MODULE_DIR"/*.pp; do
+        [ -f "$module" ] && set -- "$@" -i "$module"
+    done
+fi
+
+if [ -n "${LOCAL_MODULES:-}" ]; then
+    BUILD_DIR=$(mktemp -d)
+    trap 'rm -rf "$BUILD_DIR"' EXIT
+    for te in "$LOCAL_MODULES"/*.te; do
+        [ -f "$te" ] || continue
+        name=$(basename "$te" .te)
+        checkmodule -M -m -o "$BUILD_DIR/$name.mod" "$te"
+        if [ -f "$LOCAL_MODULES/$name.fc" ]; then
+            semodule_package -o "$BUILD_DIR/$name.pp" -m "$BUILD_DIR/$name.mod" -f "$LOCAL_MODULES/$name.fc"
+        else
+            semodule_package -o "$BUILD_DIR/$name.pp" -m "$BUILD_DIR/$name.mod"
+        fi
+    done
+    set -- "$@" -X 400
+    for module in "$LOCAL_MODULES"/*.pp "$LOCAL_MODULES"/*.cil "$BUILD_DIR"/*.pp; do
+        [ -f "$module" ] && set -- "$@" -i "$module"
+    done
+fi
+
+echo "Building the $POLICY policy store..."
+mkdir -p "$STORE" "$ROOTFS/var/lib/selinux"
+semodule -p "$ROOTFS" -s "$POLICY" -n "$@"
+
+for POLICY_FILE in "$STORE"/policy/policy.*; do :; done
+FILE_CONTEXTS="$STORE/contexts/files/file_contexts"
+if [ ! -f "$FILE_CONTEXTS" ]; then
+    echo "The $POLICY policy has no file contexts" >&2
+    exit 1
+fi
+
+echo "Labeling the root filesystem..."
+setfiles -F -r "$ROOTFS" -c "$POLICY_FILE" "$FILE_CONTEXTS" "$ROOTFS"
+rm -f "$ROOTFS/.autorelabel"
+`, policy, policyType)
+}
+
+// appArmorPolicyScript returns the script precompiling the profiles of
+// the rootfs at $ROOTFS into its cache, so that boot loads them without
+// running the compiler. A cache built for other kernel features is
+// rebuilt by the parser at boot.
+func appArmorPolicyScript(config db.AppArmorConfig) string {
+	complain := ""
+	if config.Complain {
+		complain = " --Complain"
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+# Generated by LDF: precompiles the AppArmor profiles of the rootfs
+set -e
+
+PROFILES="$ROOTFS/etc/apparmor.d"
+CACHE="$ROOTFS%s"
+
+set --
+for profile in "$PROFILES"/*; do
+    [ -f "$profile" ] || continue
+    case "$(basename "$profile")" in
+        README|*~|*.dpkg-*|*.rpmnew|*.rpmsave) continue ;;
+    esac
+    set -- "$@" "$profile"
+done
+if [ $# -eq 0 ]; then
+    echo "No AppArmor profiles to compile"
+    exit 0
+fi
+
+echo "Compiling $# AppArmor profiles..."
+mkdir -p "$CACHE"
+apparmor_parser --skip-kernel-load --skip-read-cache --write-cache --cache-loc "$CACHE" \
+    --base "$PROFILES" --Include "$PROFILES"%s "$@"
+`, appArmorCacheDir, complain)
+}
@@ -0,0 +1,195 @@
+package stages
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateSecurityConfig(t *testing.T) {
+	valid := []db.SecurityConfig{
+		{},
+		{System: "selinux"},
+		{System: "selinux", SELinux: db.SELinuxConfig{Policy: db.SELinuxPolicyMLS, Enforcing: true}},
+		{System: "apparmor", AppArmor: db.AppArmorConfig{ProfileSets: []db.AppArmorProfileSet{db.AppArmorProfilesBase}, Complain: true}},
+	}
+	for _, security := range valid {
+		if err := ValidateSecurityConfig(&db.DistributionConfig{Security: security}); err != nil {
+			t.Errorf("ValidateSecurityConfig(%+v) error = %v", security, err)
+		}
+	}
+
+	invalid := []db.SecurityConfig{
+		{System: "apparmor", SELinux: db.SELinuxConfig{Enforcing: true}},
+		{System: "selinux", AppArmor: db.AppArmorConfig{Complain: true}},
+		{System: "selinux", SELinux: db.SELinuxConfig{Policy: "strict"}},
+		{System: "apparmor", AppArmor: db.AppArmorConfig{ProfileSets: []db.AppArmorProfileSet{"all"}}},
+	}
+	for _, security := range invalid {
+		if err := ValidateSecurityConfig(&db.DistributionConfig{Security: security}); err == nil {
+			t.Errorf("expected error for %+v", security)
+		}
+	}
+}
+
+func TestSELinuxSetup_Configure(t *testing.T) {
+	rootfs := t.TempDir()
+	setup := NewSELinuxSetup(db.SELinuxConfig{Policy: db.SELinuxPolicyMLS, Enforcing: true})
+	if err := setup.Install(rootfs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.Configure(rootfs); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootfs, "etc", "selinux", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\nSELINUX=enforcing\n", "\nSELINUXTYPE=mls\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("selinux config missing %q", want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "etc", "selinux", "mls", "seusers")); err != nil {
+		t.Errorf("seusers not written to the policy directory: %v", err)
+	}
+}
+
+func TestAppArmorSetup_ProfileSets(t *testing.T) {
+	src := t.TempDir()
+	base := filepath.Join(src, "profiles", "apparmor.d")
+	for name, content := range map[string]string{
+		"usr.sbin.ntpd":   "profile ntpd {}\n",
+		"tunables/global": "# upstream tunables\n",
+	} {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rootfs := t.TempDir()
+	setup := NewAppArmorSetup(db.AppArmorConfig{ProfileSets: []db.AppArmorProfileSet{db.AppArmorProfilesBase}})
+	comp := &build.ResolvedComponent{Version: "4.0.3", LocalPath: src}
+	if err := setup.Install(rootfs, comp); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if err := setup.Configure(rootfs); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(rootfs, "etc", "apparmor.d", "usr.sbin.ntpd")); err != nil {
+		t.Errorf("base profile not installed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(rootfs, "etc", "apparmor.d", "tunables", "global"))
+	if string(data) != "# upstream tunables\n" {
+		t.Errorf("upstream tunables overwritten: %q", data)
+	}
+	conf, _ := os.ReadFile(filepath.Join(rootfs, "etc", "apparmor", "parser.conf"))
+	if !strings.Contains(string(conf), "cache-loc "+appArmorCacheDir) {
+		t.Errorf("parser.conf missing cache location: %q", conf)
+	}
+
+	extras := NewAppArmorSetup(db.AppArmorConfig{ProfileSets: []db.AppArmorProfileSet{db.AppArmorProfilesExtras}})
+	if err := extras.Install(t.TempDir(), comp); err == nil {
+		t.Error("expected error for a profile set missing from the source")
+	}
+	if err := extras.Install(t.TempDir(), nil); err == nil {
+		t.Error("expected error without the apparmor component")
+	}
+}
+
+func TestVerifySecurityKernelOptions(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := verifySecurityKernelOptions(rootfs, "selinux"); err != nil {
+		t.Errorf("missing kernel config should be skipped: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "boot"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := "CONFIG_SECURITY=y\nCONFIG_SECURITY_NETWORK=y\nCONFIG_AUDIT=y\n# CONFIG_SECURITY_SELINUX is not set\n"
+	if err := os.WriteFile(filepath.Join(rootfs, "boot", "config"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := verifySecurityKernelOptions(rootfs, "selinux")
+	if err == nil || !strings.Contains(err.Error(), "SECURITY_SELINUX") {
+		t.Errorf("expected missing SECURITY_SELINUX, got %v", err)
+	}
+
+	config += "CONFIG_SECURITY_SELINUX=y\n"
+	if err := os.WriteFile(filepath.Join(rootfs, "boot", "config"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySecurityKernelOptions(rootfs, "selinux"); err != nil {
+		t.Errorf("verifySecurityKernelOptions() error = %v", err)
+	}
+}
+
+func TestSecurityPolicyScripts(t *testing.T) {
+	scripts := map[string]string{
+		"targeted": selinuxPolicyScript(db.SELinuxConfig{}),
+		"mls":      selinuxPolicyScript(db.SELinuxConfig{Policy: db.SELinuxPolicyMLS}),
+		"apparmor": appArmorPolicyScript(db.AppArmorConfig{Complain: true}),
+	}
+	for name, want := range map[string]string{
+		"targeted": "POLICY=targeted",
+		"mls":      "TYPE=mls",
+		"apparmor": "--Include \"$PROFILES\" --Complain",
+	} {
+		if !strings.Contains(scripts[name], want) {
+			t.Errorf("%s script missing %q", name, want)
+		}
+	}
+	if !strings.Contains(scripts["targeted"], `setfiles -F -r "$ROOTFS"`) {
+		t.Error("SELinux script does not label the rootfs")
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return
+	}
+	for name, script := range scripts {
+		path := filepath.Join(t.TempDir(), name+".sh")
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(sh, "-n", path).CombinedOutput(); err != nil {
+			t.Errorf("%s script has syntax errors: %v\n%s", name, err, out)
+		}
+	}
+}
+
+func TestForceComplain(t *testing.T) {
+	profiles := t.TempDir()
+	if err := os.WriteFile(filepath.Join(profiles, "usr.bin.ping"), []byte("profile ping {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(profiles, "abstractions"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forceComplain(profiles); err != nil {
+		t.Fatal(err)
+	}
+	// Running twice replaces the existing links
+	if err := forceComplain(profiles); err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(filepath.Join(profiles, "force-complain", "usr.bin.ping"))
+	if err != nil || target != "../usr.bin.ping" {
+		t.Errorf("unexpected complain link %q, %v", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(profiles, "force-complain", "abstractions")); !os.IsNotExist(err) {
+		t.Error("directories should not be put in complain mode")
+	}
+}
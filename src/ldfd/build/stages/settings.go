@@ -0,0 +1,283 @@
+package stages
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	defaultLocale   = "en_US.UTF-8"
+	defaultKeymap   = "us"
+	defaultTimezone = "UTC"
+	defaultBondMode = "active-backup"
+)
+
+// defaultNameservers are the public resolvers used without configured DNS
+var defaultNameservers = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}
+
+// defaultLocaleOf returns the system locale: the first configured one
+func defaultLocaleOf(settings db.SystemSettings) string {
+	if len(settings.Locales) == 0 {
+		return defaultLocale
+	}
+	return settings.Locales[0]
+}
+
+// localeGen returns /etc/locale.gen, listing the locales to generate with
+// their character sets
+func localeGen(locales []string) string {
+	var b strings.Builder
+	b.WriteString("# Locales to generate\n# Generated by Linux Distribution Factory\n")
+	for _, locale := range locales {
+		charset := "ISO-8859-1"
+		if _, rest, ok := strings.Cut(locale, "."); ok {
+			charset, _, _ = strings.Cut(rest, "@")
+			if strings.EqualFold(charset, "utf8") {
+				charset = "UTF-8"
+			}
+		}
+		fmt.Fprintf(&b, "%s %s\n", locale, charset)
+	}
+	return b.String()
+}
+
+// resolvConf returns /etc/resolv.conf with the configured name servers
+// and search domains, or the public resolvers
+func resolvConf(network db.NetworkConfig) string {
+	var b strings.Builder
+	b.WriteString("# Generated by Linux Distribution Factory\n")
+	servers := network.DNS
+	if len(servers) == 0 {
+		b.WriteString("# Replace with your preferred DNS servers\n")
+		servers = defaultNameservers
+	}
+	if len(network.SearchDomains) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(network.SearchDomains, " "))
+	}
+	for _, server := range servers {
+		fmt.Fprintf(&b, "nameserver %s\n", server)
+	}
+	return b.String()
+}
+
+// resolvedConf returns the systemd-resolved drop-in with the configured
+// name servers and search domains, or "" when there are none
+func resolvedConf(network db.NetworkConfig) string {
+	if len(network.DNS) == 0 && len(network.SearchDomains) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("# Generated by Linux Distribution Factory\n[Resolve]\n")
+	if len(network.DNS) > 0 {
+		fmt.Fprintf(&b, "DNS=%s\n", strings.Join(network.DNS, " "))
+	}
+	if len(network.SearchDomains) > 0 {
+		fmt.Fprintf(&b, "Domains=%s\n", strings.Join(network.SearchDomains, " "))
+	}
+	return b.String()
+}
+
+// interfaceTopology indexes the VLANs carried by each link and the bond
+// each member belongs to
+type interfaceTopology struct {
+	vlans    map[string][]string // parent -> VLAN interfaces
+	bonds    map[string]string   // member -> bond
+	declared map[string]bool
+	// implicit are VLAN parents and bond members not declared themselves
+	implicit []string
+}
+
+func newInterfaceTopology(interfaces []db.NetworkInterface) *interfaceTopology {
+	t := &interfaceTopology{
+		vlans:    make(map[string][]string),
+		bonds:    make(map[string]string),
+		declared: make(map[string]bool),
+	}
+	for _, iface := range interfaces {
+		t.declared[iface.Name] = true
+	}
+	seen := make(map[string]bool)
+	addImplicit := func(name string) {
+		if !t.declared[name] && !seen[name] {
+			seen[name] = true
+			t.implicit = append(t.implicit, name)
+		}
+	}
+	for _, iface := range interfaces {
+		switch iface.Type {
+		case db.InterfaceVLAN:
+			t.vlans[iface.Parent] = append(t.vlans[iface.Parent], iface.Name)
+			addImplicit(iface.Parent)
+		case db.InterfaceBond:
+			for _, member := range iface.Members {
+				t.bonds[member] = iface.Name
+				addImplicit(member)
+			}
+		}
+	}
+	return t
+}
+
+// networkdFiles returns the systemd-networkd .netdev and .network files,
+// by file name under /etc/systemd/network
+func networkdFiles(network db.NetworkConfig) map[string]string {
+	files := make(map[string]string)
+	if len(network.Interfaces) == 0 {
+		files["80-dhcp.network"] = "[Match]\nName=*\n\n[Network]\nDHCP=yes\n"
+		return files
+	}
+
+	topology := newInterfaceTopology(network.Interfaces)
+	for i, iface := range network.Interfaces {
+		prefix := fmt.Sprintf("%02d-%s", 10+i, iface.Name)
+		switch iface.Type {
+		case db.InterfaceVLAN:
+			files[prefix+".netdev"] = fmt.Sprintf("[NetDev]\nName=%s\nKind=vlan\n\n[VLAN]\nId=%d\n", iface.Name, iface.VLANID)
+		case db.InterfaceBond:
+			mode := iface.BondMode
+			if mode == "" {
+				mode = defaultBondMode
+			}
+			files[prefix+".netdev"] = fmt.Sprintf("[NetDev]\nName=%s\nKind=bond\n\n[Bond]\nMode=%s\n", iface.Name, mode)
+		}
+		files[prefix+".network"] = networkdNetwork(iface, topology)
+	}
+	for i, name := range topology.implicit {
+		files[fmt.Sprintf("%02d-%s.network", 70+i, name)] = networkdNetwork(db.NetworkInterface{Name: name}, topology)
+	}
+	return files
+}
+
+// networkdNetwork returns the .network file of an interface
+func networkdNetwork(iface db.NetworkInterface, topology *interfaceTopology) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Match]\nName=%s\n", iface.Name)
+	if iface.MTU != 0 {
+		fmt.Fprintf(&b, "\n[Link]\nMTUBytes=%d\n", iface.MTU)
+	}
+	b.WriteString("\n[Network]\n")
+	if iface.DHCP {
+		b.WriteString("DHCP=yes\n")
+	}
+	for _, addr := range iface.Addresses {
+		fmt.Fprintf(&b, "Address=%s\n", addr)
+	}
+	if iface.Gateway != "" {
+		fmt.Fprintf(&b, "Gateway=%s\n", iface.Gateway)
+	}
+	for _, vlan := range topology.vlans[iface.Name] {
+		fmt.Fprintf(&b, "VLAN=%s\n", vlan)
+	}
+	if bond, ok := topology.bonds[iface.Name]; ok {
+		fmt.Fprintf(&b, "Bond=%s\n", bond)
+	} else if !iface.DHCP && len(iface.Addresses) == 0 {
+		b.WriteString("LinkLocalAddressing=no\n")
+	}
+	return b.String()
+}
+
+// netifrcVar returns the variable suffix netifrc uses for an interface
+func netifrcVar(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// netifrcConf returns the OpenRC netifrc /etc/conf.d/net
+func netifrcConf(network db.NetworkConfig) string {
+	topology := newInterfaceTopology(network.Interfaces)
+	var b strings.Builder
+	b.WriteString("# Network configuration\n# Generated by Linux Distribution Factory\n")
+
+	write := func(iface db.NetworkInterface) {
+		v := netifrcVar(iface.Name)
+		b.WriteString("\n")
+
+		var config []string
+		if iface.DHCP {
+			config = append(config, "dhcp")
+		}
+		config = append(config, iface.Addresses...)
+		if len(config) == 0 {
+			config = []string{"null"}
+		}
+		fmt.Fprintf(&b, "config_%s=\"%s\"\n", v, strings.Join(config, "\n"))
+		if iface.Gateway != "" {
+			fmt.Fprintf(&b, "routes_%s=\"default via %s\"\n", v, iface.Gateway)
+		}
+		if iface.MTU != 0 {
+			fmt.Fprintf(&b, "mtu_%s=\"%d\"\n", v, iface.MTU)
+		}
+		if iface.Type == db.InterfaceBond {
+			mode := iface.BondMode
+			if mode == "" {
+				mode = defaultBondMode
+			}
+			fmt.Fprintf(&b, "slaves_%s=\"%s\"\n", v, strings.Join(iface.Members, " "))
+			fmt.Fprintf(&b, "mode_%s=\"%s\"\n", v, mode)
+		}
+		if vlans := topology.vlans[iface.Name]; len(vlans) > 0 {
+			var ids []string
+			for _, vlan := range vlans {
+				for _, other := range network.Interfaces {
+					if other.Name == vlan {
+						id := fmt.Sprintf("%d", other.VLANID)
+						ids = append(ids, id)
+						fmt.Fprintf(&b, "%s_vlan%s_name=\"%s\"\n", v, id, vlan)
+					}
+				}
+			}
+			fmt.Fprintf(&b, "vlans_%s=\"%s\"\n", v, strings.Join(ids, " "))
+		}
+	}
+
+	for _, iface := range network.Interfaces {
+		write(iface)
+	}
+	for _, name := range topology.implicit {
+		write(db.NetworkInterface{Name: name})
+	}
+	return b.String()
+}
+
+// netifrcServices returns the interfaces started by their own net.*
+// service. VLANs are started with their parent and bond members with
+// their bond.
+func netifrcServices(network db.NetworkConfig) []string {
+	topology := newInterfaceTopology(network.Interfaces)
+	var services []string
+	for _, iface := range network.Interfaces {
+		if _, member := topology.bonds[iface.Name]; iface.Type == db.InterfaceVLAN || member {
+			continue
+		}
+		services = append(services, iface.Name)
+	}
+	for _, name := range topology.implicit {
+		if _, member := topology.bonds[name]; !member {
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// timesyncdConf returns systemd-timesyncd's configuration
+func timesyncdConf(servers []string) string {
+	return fmt.Sprintf("# Generated by Linux Distribution Factory\n[Time]\nNTP=%s\n", strings.Join(servers, " "))
+}
+
+// ntpConf returns the ntpd configuration of OpenRC images
+func ntpConf(servers []string) string {
+	var b strings.Builder
+	b.WriteString("# Generated by Linux Distribution Factory\ndriftfile /var/lib/ntp/ntp.drift\n\n")
+	for _, server := range servers {
+		fmt.Fprintf(&b, "server %s iburst\n", server)
+	}
+	return b.String()
+}
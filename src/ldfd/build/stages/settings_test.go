@@ -0,0 +1,146 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// bondedNetwork is a bond of two links carrying a tagged VLAN
+var bondedNetwork = db.NetworkConfig{
+	DNS:           []string{"10.0.0.53"},
+	SearchDomains: []string{"example.com"},
+	Interfaces: []db.NetworkInterface{
+		{Name: "bond0", Type: db.InterfaceBond, Members: []string{"eth0", "eth1"}, BondMode: "802.3ad", MTU: 9000},
+		{Name: "bond0.20", Type: db.InterfaceVLAN, Parent: "bond0", VLANID: 20, Addresses: []string{"192.168.20.10/24"}, Gateway: "192.168.20.1"},
+	},
+}
+
+func TestNetworkdFiles(t *testing.T) {
+	files := networkdFiles(db.NetworkConfig{})
+	if _, ok := files["80-dhcp.network"]; !ok || len(files) != 1 {
+		t.Errorf("expected the DHCP fallback only, got %v", files)
+	}
+
+	files = networkdFiles(bondedNetwork)
+	for name, want := range map[string]string{
+		"10-bond0.netdev":     "Kind=bond\n\n[Bond]\nMode=802.3ad\n",
+		"10-bond0.network":    "MTUBytes=9000\n",
+		"11-bond0.20.netdev":  "Kind=vlan\n\n[VLAN]\nId=20\n",
+		"11-bond0.20.network": "Address=192.168.20.10/24\nGateway=192.168.20.1\n",
+		"70-eth0.network":     "Bond=bond0\n",
+		"71-eth1.network":     "Bond=bond0\n",
+	} {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("%s missing %q:\n%s", name, want, files[name])
+		}
+	}
+	if !strings.Contains(files["10-bond0.network"], "VLAN=bond0.20\nLinkLocalAddressing=no\n") {
+		t.Errorf("bond does not carry the VLAN:\n%s", files["10-bond0.network"])
+	}
+}
+
+func TestNetifrcConf(t *testing.T) {
+	conf := netifrcConf(bondedNetwork)
+	for _, want := range []string{
+		"config_bond0=\"null\"\n",
+		"slaves_bond0=\"eth0 eth1\"\nmode_bond0=\"802.3ad\"\n",
+		"bond0_vlan20_name=\"bond0.20\"\nvlans_bond0=\"20\"\n",
+		"config_bond0_20=\"192.168.20.10/24\"\nroutes_bond0_20=\"default via 192.168.20.1\"\n",
+		"config_eth0=\"null\"\n",
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("conf.d/net missing %q:\n%s", want, conf)
+		}
+	}
+
+	if got := netifrcServices(bondedNetwork); !reflect.DeepEqual(got, []string{"bond0"}) {
+		t.Errorf("netifrcServices() = %v, want [bond0]", got)
+	}
+}
+
+func TestResolvConf(t *testing.T) {
+	if conf := resolvConf(db.NetworkConfig{}); !strings.Contains(conf, "nameserver 1.1.1.1\n") {
+		t.Errorf("expected the public resolvers:\n%s", conf)
+	}
+	conf := resolvConf(bondedNetwork)
+	if !strings.Contains(conf, "search example.com\nnameserver 10.0.0.53\n") || strings.Contains(conf, "1.1.1.1") {
+		t.Errorf("unexpected resolv.conf:\n%s", conf)
+	}
+	if resolvedConf(db.NetworkConfig{}) != "" {
+		t.Error("expected no resolved drop-in without DNS settings")
+	}
+}
+
+func TestLocaleGen(t *testing.T) {
+	got := localeGen([]string{"en_US.UTF-8", "de_DE.utf8@euro", "fr_FR"})
+	for _, want := range []string{"en_US.UTF-8 UTF-8\n", "de_DE.utf8@euro UTF-8\n", "fr_FR ISO-8859-1\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("locale.gen missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRootfsBuilder_ConfigureSettings(t *testing.T) {
+	for _, init := range []string{"systemd", "openrc"} {
+		t.Run(init, func(t *testing.T) {
+			rootfs := t.TempDir()
+			config := &db.DistributionConfig{
+				System: db.SystemConfig{Init: init},
+				Settings: db.SystemSettings{
+					Locales:    []string{"fr_FR.UTF-8"},
+					Timezone:   "Europe/Paris",
+					Keymap:     "fr",
+					NTPServers: []string{"ntp.example.com"},
+					Network:    bondedNetwork,
+				},
+			}
+			builder := NewRootfsBuilder(rootfs, "test", "1.0", config)
+			for _, step := range []func() error{builder.ConfigureNetworking, builder.ConfigureLocalization, builder.ConfigureTimeSync} {
+				if err := step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			target, err := os.Readlink(filepath.Join(rootfs, "etc", "localtime"))
+			if err != nil || target != "../usr/share/zoneinfo/Europe/Paris" {
+				t.Errorf("unexpected localtime link %q, %v", target, err)
+			}
+
+			want := map[string]string{
+				"etc/locale.conf": "LANG=fr_FR.UTF-8\n",
+				"etc/timezone":    "Europe/Paris\n",
+			}
+			if init == "systemd" {
+				want["etc/vconsole.conf"] = "KEYMAP=fr\n"
+				want["etc/systemd/timesyncd.conf"] = "NTP=ntp.example.com\n"
+				want["etc/systemd/resolved.conf.d/50-ldf-dns.conf"] = "DNS=10.0.0.53\n"
+			} else {
+				want["etc/conf.d/keymaps"] = "keymap=\"fr\"\n"
+				want["etc/ntp.conf"] = "server ntp.example.com iburst\n"
+				want["etc/conf.d/net"] = "slaves_bond0=\"eth0 eth1\"\n"
+			}
+			for name, content := range want {
+				data, err := os.ReadFile(filepath.Join(rootfs, name))
+				if err != nil || !strings.Contains(string(data), content) {
+					t.Errorf("%s missing %q: %v", name, content, err)
+				}
+			}
+
+			if init == "openrc" {
+				for _, link := range []string{"etc/runlevels/boot/keymaps", "etc/runlevels/default/net.bond0", "etc/runlevels/default/ntpd"} {
+					if _, err := os.Lstat(filepath.Join(rootfs, link)); err != nil {
+						t.Errorf("%s not enabled: %v", link, err)
+					}
+				}
+				if _, err := os.Lstat(filepath.Join(rootfs, "etc", "network", "interfaces")); !os.IsNotExist(err) {
+					t.Error("interfaces file written alongside netifrc")
+				}
+			}
+		})
+	}
+}
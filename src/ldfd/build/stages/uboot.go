@@ -0,0 +1,343 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// ubootOutputDir is the workspace directory U-Boot is built into
+	ubootOutputDir = "uboot-output"
+	// ubootInstallDir holds the board's loader images in the rootfs, where
+	// the image generator and on-device updates pick them up
+	ubootInstallDir = "usr/lib/u-boot"
+	// gptReservedSectors covers the protective MBR, the GPT header and its
+	// 128 partition entries, which loader images must not overwrite
+	gptReservedSectors = 34
+	// defaultFirstSector is where the first partition starts (1 MiB)
+	defaultFirstSector = 2048
+	// sectorSize is the sector unit of loader image offsets
+	sectorSize = 512
+)
+
+// UBootInstaller configures U-Boot distro boot: U-Boot scans the bootable
+// partition for extlinux/extlinux.conf and loads the kernel, initramfs and
+// device tree it lists. The loader itself is written to raw disk offsets
+// by the image generator.
+type UBootInstaller struct {
+	timeout     int
+	distName    string
+	distVersion string
+	fdt         string // Board device tree under /boot/dtbs; empty lets U-Boot pick one
+	cmdline     string // Board kernel arguments
+}
+
+// NewUBootInstaller creates a new U-Boot installer
+func NewUBootInstaller(distName, distVersion string) *UBootInstaller {
+	return &UBootInstaller{
+		timeout:     5,
+		distName:    distName,
+		distVersion: distVersion,
+	}
+}
+
+// Name returns the bootloader name
+func (i *UBootInstaller) Name() string {
+	return "uboot"
+}
+
+// SetBoard points the boot entry at the board's primary device tree and
+// appends its kernel command line
+func (i *UBootInstaller) SetBoard(profile *db.BoardProfile) {
+	if profile == nil {
+		return
+	}
+	if len(profile.Config.DeviceTrees) > 0 {
+		i.fdt = strings.TrimSuffix(filepath.Base(profile.Config.DeviceTrees[0].Source), ".dts") + ".dtb"
+	}
+	i.cmdline = profile.Config.KernelCmdline
+}
+
+// Install creates the extlinux configuration directory
+func (i *UBootInstaller) Install(rootfsPath string, component *build.ResolvedComponent) error {
+	if err := os.MkdirAll(filepath.Join(rootfsPath, "boot", "extlinux"), 0755); err != nil {
+		return fmt.Errorf("failed to create extlinux directory: %w", err)
+	}
+
+	log.Info("Installed U-Boot structure")
+	return nil
+}
+
+// Configure generates extlinux.conf. Paths are relative to the root
+// partition U-Boot loads them from.
+func (i *UBootInstaller) Configure(rootfsPath string, kernelVersion string, arch db.TargetArch, initramfs bool) error {
+	var extra string
+	if initramfs {
+		extra += "\n    INITRD /boot/initramfs.img"
+	}
+	if i.fdt != "" {
+		extra += "\n    FDT /boot/dtbs/" + i.fdt
+	} else {
+		extra += "\n    FDTDIR /boot/dtbs"
+	}
+	var cmdline string
+	if i.cmdline != "" {
+		cmdline = " " + i.cmdline
+	}
+
+	conf := fmt.Sprintf(`# extlinux.conf for U-Boot distro boot
+# Generated by Linux Distribution Factory
+
+DEFAULT ldf
+TIMEOUT %d
+MENU TITLE %[2]s %[3]s
+
+LABEL ldf
+    MENU LABEL %[2]s %[3]s
+    LINUX /boot/vmlinuz%[4]s
+    APPEND root=UUID=ROOT_UUID ro quiet rootwait%[5]s
+
+LABEL recovery
+    MENU LABEL %[2]s %[3]s (recovery mode)
+    LINUX /boot/vmlinuz%[4]s
+    APPEND root=UUID=ROOT_UUID ro single rootwait%[5]s
+`, i.timeout*10, i.distName, i.distVersion, extra, cmdline)
+
+	confPath := filepath.Join(rootfsPath, "boot", "extlinux", "extlinux.conf")
+	if err := os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		return fmt.Errorf("failed to write extlinux.conf: %w", err)
+	}
+
+	log.Info("Configured U-Boot", "kernel", kernelVersion, "fdt", i.fdt)
+	return nil
+}
+
+// GetInstallCommands returns no chroot commands; the image generator
+// writes the loader images at the board's offsets
+func (i *UBootInstaller) GetInstallCommands(devicePath string, arch db.TargetArch) []string {
+	return nil
+}
+
+// usesUBoot reports whether the distribution boots with U-Boot
+func usesUBoot(config *db.DistributionConfig) bool {
+	_, ok := GetBootloaderInstaller(config.Core.Bootloader, "", "").(*UBootInstaller)
+	return ok
+}
+
+// ValidateUBootConfig reports U-Boot settings that cannot produce a
+// bootable image. U-Boot is built for the board profile's uboot_board.
+func ValidateUBootConfig(config *db.DistributionConfig, board *db.BoardProfile, arch db.TargetArch) error {
+	if !usesUBoot(config) {
+		return nil
+	}
+	if arch != db.ArchAARCH64 {
+		return fmt.Errorf("the uboot bootloader is only supported for aarch64 targets")
+	}
+	if board == nil || board.Config.BootParams.UBootBoard == "" {
+		return fmt.Errorf("the uboot bootloader requires a board profile with uboot_board set")
+	}
+	if config.Security.SecureBoot.Enabled {
+		return fmt.Errorf("Secure Boot is not supported with the uboot bootloader")
+	}
+	// U-Boot loads the kernel from the root filesystem and the images are
+	// only written by the standard raw layout
+	if config.Security.Encryption.Enabled {
+		return fmt.Errorf("encrypted roots are not supported with the uboot bootloader")
+	}
+	if config.Security.Verity.Enabled || config.Update.ABSlots {
+		return fmt.Errorf("dm-verity and A/B slot layouts are not supported with the uboot bootloader")
+	}
+	for _, img := range board.Config.BootParams.UBootImages {
+		if img.File == "" || filepath.IsAbs(img.File) || strings.HasPrefix(filepath.Clean(img.File), "..") {
+			return fmt.Errorf("invalid U-Boot image path %q", img.File)
+		}
+		if img.Sector < gptReservedSectors {
+			return fmt.Errorf("U-Boot image %s at sector %d overlaps the GPT (first free sector is %d)", img.File, img.Sector, gptReservedSectors)
+		}
+	}
+	return nil
+}
+
+// findUBootComponent returns the resolved U-Boot source component
+func findUBootComponent(components []build.ResolvedComponent) *build.ResolvedComponent {
+	for i := range components {
+		name := strings.ToLower(components[i].Component.Name)
+		if strings.Contains(name, "u-boot") || strings.Contains(name, "uboot") {
+			return &components[i]
+		}
+	}
+	return nil
+}
+
+// compileUBoot builds U-Boot for the board profile's uboot_board with the
+// cross toolchain, out of tree into the workspace
+func (s *CompileStage) compileUBoot(ctx context.Context, sc *build.StageContext, crossCompile string, progress build.ProgressFunc) error {
+	comp := findUBootComponent(sc.Components)
+	if comp == nil || comp.LocalPath == "" {
+		return fmt.Errorf("U-Boot source component not resolved")
+	}
+	bootParams := sc.BoardProfile.Config.BootParams
+
+	outputDir := filepath.Join(sc.WorkspacePath, ubootOutputDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create U-Boot output directory: %w", err)
+	}
+	scriptsDir := filepath.Join(sc.WorkspacePath, "scripts")
+	scriptPath := filepath.Join(scriptsDir, "compile-uboot.sh")
+	if err := os.WriteFile(scriptPath, []byte(ubootBuildScript(bootParams)), 0755); err != nil {
+		return fmt.Errorf("failed to write U-Boot build script: %w", err)
+	}
+
+	logFile, err := os.Create(filepath.Join(sc.WorkspacePath, "logs", "uboot-compile.log"))
+	if err != nil {
+		return fmt.Errorf("failed to create U-Boot log file: %w", err)
+	}
+	defer logFile.Close()
+
+	env := build.ToolchainEnvVars(db.ResolveToolchain(&sc.Config.Core), crossCompile)
+	if _, ok := env["CROSS_COMPILE"]; !ok && crossCompile != "" {
+		env["CROSS_COMPILE"] = crossCompile
+	}
+	applyReproducibleEnv(env, sc.SourceDateEpoch)
+
+	opts := build.ContainerRunOpts{
+		Env:     env,
+		Command: []string{"/bin/bash", scriptPath},
+		Stdout:  logFile,
+		Stderr:  logFile,
+	}
+	env["UBOOT_SRC"] = comp.LocalPath
+	env["UBOOT_OUT"] = outputDir
+	if sc.Executor.RuntimeType().IsContainerRuntime() {
+		opts.Image = sc.Executor.DefaultImage()
+		if sc.BuildEnv != nil {
+			opts.Image = sc.BuildEnv.ContainerImage
+			opts.Platform = sc.BuildEnv.ContainerPlatformFlag
+		}
+		opts.Mounts = []build.Mount{
+			{Source: comp.LocalPath, Target: "/src/u-boot"},
+			{Source: outputDir, Target: "/output"},
+			{Source: scriptsDir, Target: "/scripts", ReadOnly: true},
+		}
+		if sc.ToolchainDir != "" {
+			opts.Mounts = append(opts.Mounts, build.Mount{Source: filepath.Dir(sc.ToolchainDir), Target: "/opt/toolchain", ReadOnly: true})
+			env["TOOLCHAIN_PATH"] = "/opt/toolchain/bin"
+		}
+		env["UBOOT_SRC"] = "/src/u-boot"
+		env["UBOOT_OUT"] = "/output"
+		opts.Command = []string{"/bin/bash", "/scripts/compile-uboot.sh"}
+	} else if sc.ToolchainDir != "" {
+		env["TOOLCHAIN_PATH"] = sc.ToolchainDir
+	}
+
+	progress(97, fmt.Sprintf("Building U-Boot (%s)", bootParams.UBootBoard))
+	if err := sc.Executor.Run(ctx, opts); err != nil {
+		return fmt.Errorf("U-Boot build failed: %w", err)
+	}
+
+	for _, img := range bootParams.UBootImages {
+		if _, err := os.Stat(filepath.Join(outputDir, img.File)); err != nil {
+			return fmt.Errorf("U-Boot build did not produce %s", img.File)
+		}
+	}
+	return nil
+}
+
+// ubootBuildScript returns the script building U-Boot from $UBOOT_SRC into
+// $UBOOT_OUT with the board's defconfig and extra make variables
+func ubootBuildScript(bootParams db.BoardBootParams) string {
+	vars := make([]string, 0, len(bootParams.UBootMakeVars))
+	for k, v := range bootParams.UBootMakeVars {
+		vars = append(vars, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(vars)
+
+	return fmt.Sprintf(`#!/bin/bash
+set -e
+
+# Prepend downloaded toolchain to PATH if available
+if [ -n "${TOOLCHAIN_PATH}" ]; then
+    export PATH="${TOOLCHAIN_PATH}:${PATH}"
+fi
+
+echo "=== LDF U-Boot Build (%[1]s) ==="
+cd "${UBOOT_SRC}"
+make CROSS_COMPILE="${CROSS_COMPILE}" O="${UBOOT_OUT}" %[1]s_defconfig
+make CROSS_COMPILE="${CROSS_COMPILE}" O="${UBOOT_OUT}" -j"$(nproc)" %[2]s
+
+echo "=== U-Boot build complete ==="
+ls -la "${UBOOT_OUT}"
+`, bootParams.UBootBoard, strings.Join(vars, " "))
+}
+
+// installUBoot copies the board's loader images from the U-Boot build into
+// the rootfs
+func (s *AssembleStage) installUBoot(sc *build.StageContext) error {
+	if !usesUBoot(sc.Config) || sc.BoardProfile == nil {
+		return nil
+	}
+	bootParams := sc.BoardProfile.Config.BootParams
+
+	srcDir := filepath.Join(sc.WorkspacePath, ubootOutputDir)
+	destDir := filepath.Join(sc.RootfsDir, ubootInstallDir, bootParams.UBootBoard)
+	for _, img := range bootParams.UBootImages {
+		dest := filepath.Join(destDir, img.File)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(srcDir, img.File), dest); err != nil {
+			return fmt.Errorf("failed to install U-Boot image %s: %w", img.File, err)
+		}
+	}
+
+	log.Info("Installed U-Boot images", "board", bootParams.UBootBoard, "count", len(bootParams.UBootImages))
+	return nil
+}
+
+// ubootFirstSector returns the sector the first partition starts at so
+// that the loader images in dir fit in front of it, aligned to 1 MiB
+func ubootFirstSector(dir string, images []db.UBootImage) (int64, error) {
+	first := int64(defaultFirstSector)
+	for _, img := range images {
+		info, err := os.Stat(filepath.Join(dir, img.File))
+		if err != nil {
+			return 0, fmt.Errorf("U-Boot image %s not found: %w", img.File, err)
+		}
+		end := img.Sector + (info.Size()+sectorSize-1)/sectorSize
+		if aligned := (end + defaultFirstSector - 1) / defaultFirstSector * defaultFirstSector; aligned > first {
+			first = aligned
+		}
+	}
+	return first, nil
+}
+
+// writeUBootImages writes the loader images in dir into the disk image at
+// their sector offsets
+func writeUBootImages(imagePath, dir string, images []db.UBootImage) error {
+	f, err := os.OpenFile(imagePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, img := range images {
+		data, err := os.ReadFile(filepath.Join(dir, img.File))
+		if err != nil {
+			return fmt.Errorf("failed to read U-Boot image %s: %w", img.File, err)
+		}
+		if _, err := f.WriteAt(data, img.Sector*sectorSize); err != nil {
+			return fmt.Errorf("failed to write U-Boot image %s: %w", img.File, err)
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,155 @@
+package stages
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestValidateUBootConfig(t *testing.T) {
+	board := &db.BoardProfile{Config: db.BoardConfig{BootParams: db.BoardBootParams{
+		UBootBoard:  "rock5b-rk3588",
+		UBootImages: []db.UBootImage{{File: "u-boot-rockchip.bin", Sector: 64}},
+	}}}
+	uboot := db.DistributionConfig{Core: db.CoreConfig{Bootloader: "uboot"}}
+
+	tests := []struct {
+		name    string
+		config  db.DistributionConfig
+		board   *db.BoardProfile
+		arch    db.TargetArch
+		wantErr string
+	}{
+		{name: "other bootloader", config: db.DistributionConfig{Core: db.CoreConfig{Bootloader: "grub"}}, arch: db.ArchX86_64},
+		{name: "rk3588", config: uboot, board: board, arch: db.ArchAARCH64},
+		{name: "x86_64", config: uboot, board: board, arch: db.ArchX86_64, wantErr: "only supported for aarch64"},
+		{name: "no board", config: uboot, arch: db.ArchAARCH64, wantErr: "uboot_board"},
+		{
+			name:    "encrypted root",
+			config:  db.DistributionConfig{Core: uboot.Core, Security: db.SecurityConfig{Encryption: db.EncryptionConfig{Enabled: true}}},
+			board:   board,
+			arch:    db.ArchAARCH64,
+			wantErr: "encrypted roots",
+		},
+		{
+			name:   "image over the GPT",
+			config: uboot,
+			board: &db.BoardProfile{Config: db.BoardConfig{BootParams: db.BoardBootParams{
+				UBootBoard:  "imx8mp_evk",
+				UBootImages: []db.UBootImage{{File: "flash.bin", Sector: 0}},
+			}}},
+			arch:    db.ArchAARCH64,
+			wantErr: "overlaps the GPT",
+		},
+		{
+			name:   "image outside the build",
+			config: uboot,
+			board: &db.BoardProfile{Config: db.BoardConfig{BootParams: db.BoardBootParams{
+				UBootBoard:  "imx8mp_evk",
+				UBootImages: []db.UBootImage{{File: "../flash.bin", Sector: 64}},
+			}}},
+			arch:    db.ArchAARCH64,
+			wantErr: "invalid U-Boot image path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUBootConfig(&tt.config, tt.board, tt.arch)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUBootInstaller_Configure(t *testing.T) {
+	rootfs := t.TempDir()
+	installer, ok := GetBootloaderInstaller("u-boot", "LDF", "1.0").(*UBootInstaller)
+	if !ok {
+		t.Fatal("u-boot did not select the U-Boot installer")
+	}
+	installer.SetBoard(&db.BoardProfile{Config: db.BoardConfig{
+		DeviceTrees:   []db.DeviceTreeSpec{{Source: "arch/arm64/boot/dts/rockchip/rk3588-rock-5b.dts"}},
+		KernelCmdline: "console=ttyS2,1500000",
+	}})
+	if err := installer.Install(rootfs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := installer.Configure(rootfs, "6.12.1", db.ArchAARCH64, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SubstituteRootUUID(rootfs, "1234-abcd"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootfs, "boot", "extlinux", "extlinux.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"INITRD /boot/initramfs.img",
+		"FDT /boot/dtbs/rk3588-rock-5b.dtb",
+		"APPEND root=UUID=1234-abcd ro quiet rootwait console=ttyS2,1500000",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("extlinux.conf missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestUBootImages(t *testing.T) {
+	dir := t.TempDir()
+	idbloader := bytes.Repeat([]byte{0xaa}, 1000)
+	uboot := bytes.Repeat([]byte{0xbb}, 9*1024*1024)
+	if err := os.WriteFile(filepath.Join(dir, "idbloader.img"), idbloader, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "u-boot.itb"), uboot, 0644); err != nil {
+		t.Fatal(err)
+	}
+	images := []db.UBootImage{{File: "idbloader.img", Sector: 64}, {File: "u-boot.itb", Sector: 16384}}
+
+	// u-boot.itb ends at sector 16384+18432, rounded up to the next MiB
+	first, err := ubootFirstSector(dir, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 34816 {
+		t.Errorf("ubootFirstSector() = %d, want 34816", first)
+	}
+	if first, _ := ubootFirstSector(dir, images[:1]); first != defaultFirstSector {
+		t.Errorf("small loaders should keep the default first sector, got %d", first)
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(imagePath, make([]byte, first*sectorSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeUBootImages(imagePath, dir, images); err != nil {
+		t.Fatalf("writeUBootImages() error = %v", err)
+	}
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[64*sectorSize:64*sectorSize+len(idbloader)], idbloader) {
+		t.Error("idbloader.img not written at sector 64")
+	}
+	if !bytes.Equal(data[16384*sectorSize:16384*sectorSize+len(uboot)], uboot) {
+		t.Error("u-boot.itb not written at sector 16384")
+	}
+	if int64(len(data)) != first*sectorSize {
+		t.Errorf("image grew to %d bytes", len(data))
+	}
+}
@@ -0,0 +1,582 @@
+package stages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/google/uuid"
+)
+
+const (
+	// verityDeviceName is the device-mapper name the initramfs opens the root as
+	verityDeviceName = "root"
+	// espSizeMB is the size of the EFI System Partition
+	espSizeMB = 512
+	// defaultVarSizeMB is the minimum /var size when none is configured
+	defaultVarSizeMB = 1024
+	// varPartitionType is the Discoverable Partitions type of /var
+	varPartitionType = "4D21B016-B534-45C2-A9FB-5C16E091FD2D"
+)
+
+// verityPartitionTypes maps architectures to the Discoverable Partitions
+// types of their root and root verity partitions
+var verityPartitionTypes = map[db.TargetArch][2]string{
+	db.ArchX86_64:  {"4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709", "2C7357ED-EBD2-46D9-AEC1-23D437EC2BF5"},
+	db.ArchAARCH64: {"B921B045-1DF0-41C3-AF44-4C6F280D3FAE", "DF3300CE-D69F-4C92-978C-9BFB0F38D820"},
+}
+
+// verityLayout identifies the filesystems and partitions of a dm-verity image
+type verityLayout struct {
+	fsType       db.VerityFilesystem
+	rootHash     string
+	rootPartUUID string
+	hashPartUUID string
+	varFSUUID    string
+	varPartUUID  string
+	espPartUUID  string
+	diskGUID     string
+}
+
+// newVerityLayout picks the identifiers that do not depend on the root hash
+func newVerityLayout(fsType db.VerityFilesystem, epoch int64) *verityLayout {
+	id := func(label string) string {
+		if epoch != 0 {
+			return build.DeterministicUUID(epoch, label)
+		}
+		return uuid.NewString()
+	}
+	return &verityLayout{
+		fsType:      fsType,
+		varFSUUID:   id("var"),
+		varPartUUID: id("var-part"),
+		espPartUUID: id("esp"),
+		diskGUID:    id("disk"),
+	}
+}
+
+// setRootHash records the root hash and derives the root and hash partition
+// UUIDs from it as the Discoverable Partitions Specification recommends, so
+// systemd-gpt-auto-generator can match them without configuration
+func (l *verityLayout) setRootHash(rootHash string) error {
+	if len(rootHash) < 64 {
+		return fmt.Errorf("unexpected root hash %q", rootHash)
+	}
+	l.rootHash = rootHash
+	l.rootPartUUID = hexToUUID(rootHash[:32])
+	l.hashPartUUID = hexToUUID(rootHash[32:64])
+	return nil
+}
+
+// kernelArgs returns the kernel arguments that open and mount the verity
+// root. They use the systemd-veritysetup-generator names so systemd based
+// initramfs images work as well as the LDF init script.
+func (l *verityLayout) kernelArgs() string {
+	return fmt.Sprintf("root=/dev/mapper/%s rootfstype=%s roothash=%s systemd.verity_root_data=PARTUUID=%s systemd.verity_root_hash=PARTUUID=%s",
+		verityDeviceName, l.fsType, l.rootHash, l.rootPartUUID, l.hashPartUUID)
+}
+
+// hexToUUID formats 32 hex digits as a UUID string
+func hexToUUID(h string) string {
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+}
+
+// verityFilesystem returns the configured read-only filesystem, defaulting to erofs
+func verityFilesystem(cfg db.VerityConfig) db.VerityFilesystem {
+	if cfg.Filesystem == db.VerityFilesystemSquashFS {
+		return db.VerityFilesystemSquashFS
+	}
+	return db.VerityFilesystemEROFS
+}
+
+// ValidateVerityConfig reports configurations the dm-verity image layout cannot boot
+func ValidateVerityConfig(config *db.DistributionConfig, format db.ImageFormat) error {
+	verity := config.Security.Verity
+	if !verity.Enabled {
+		return nil
+	}
+	if !isDiskImageFormat(format) {
+		return fmt.Errorf("dm-verity root is not supported for %s images", strings.ToUpper(string(format)))
+	}
+	switch fs := verity.Filesystem; fs {
+	case "", db.VerityFilesystemEROFS, db.VerityFilesystemSquashFS:
+	default:
+		return fmt.Errorf("unsupported dm-verity filesystem %q (use erofs or squashfs)", fs)
+	}
+	// The root hash is only known after the root filesystem is sealed, so
+	// the command line must live outside it: on the ESP or inside the UKI
+	switch GetBootloaderInstaller(config.Core.Bootloader, "", "").(type) {
+	case *SystemdBootInstaller, *UKIInstaller:
+		return nil
+	default:
+		return fmt.Errorf("dm-verity root requires the systemd-boot or uki bootloader")
+	}
+}
+
+// generateVerity creates a raw disk image with a read-only root protected
+// by dm-verity. Partitions: ESP, root, root verity hash tree, writable /var.
+func (g *RawImageGenerator) generateVerity(ctx context.Context, sc *build.StageContext, progress build.ProgressFunc) (string, error) {
+	verity := sc.Config.Security.Verity
+	layout := newVerityLayout(verityFilesystem(verity), sc.SourceDateEpoch)
+
+	workDir := filepath.Join(sc.WorkspacePath, "verity")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create verity work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	progress(5, "Preparing read-only root filesystem")
+
+	if err := writeVerityFstab(sc.RootfsDir, layout); err != nil {
+		return "", fmt.Errorf("failed to write fstab: %w", err)
+	}
+
+	// /var moves to its own partition; the root keeps an empty mount point
+	varDir, restoreVar, err := splitVar(sc.RootfsDir, workDir, sc.SourceDateEpoch)
+	if err != nil {
+		return "", fmt.Errorf("failed to separate /var: %w", err)
+	}
+	defer restoreVar()
+
+	progress(10, fmt.Sprintf("Creating %s root image", layout.fsType))
+
+	rootImg := filepath.Join(workDir, "root.img")
+	if err := makeReadOnlyRoot(ctx, layout.fsType, sc.RootfsDir, rootImg, sc.SourceDateEpoch); err != nil {
+		return "", fmt.Errorf("failed to create root image: %w", err)
+	}
+
+	progress(25, "Computing dm-verity hash tree")
+
+	hashImg := filepath.Join(workDir, "root.verity")
+	rootHash, err := formatVerity(ctx, rootImg, hashImg, sc.SourceDateEpoch)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute verity hash tree: %w", err)
+	}
+	if err := layout.setRootHash(rootHash); err != nil {
+		return "", err
+	}
+	sc.VerityRootHash = rootHash
+	log.Info("Computed dm-verity root hash", "root_hash", rootHash)
+
+	progress(30, "Creating partitioned disk image")
+
+	rootMB, err := fileSizeMB(rootImg)
+	if err != nil {
+		return "", err
+	}
+	hashMB, err := fileSizeMB(hashImg)
+	if err != nil {
+		return "", err
+	}
+	minVarMB := verity.VarSizeMB
+	if minVarMB <= 0 {
+		minVarMB = defaultVarSizeMB
+	}
+	// 1 MiB alignment at the start plus the backup GPT at the end
+	totalMB := g.sizeGB * 1024
+	if varMB := totalMB - 2 - espSizeMB - rootMB - hashMB; varMB < minVarMB {
+		return "", fmt.Errorf("image size %d GB leaves %d MB for /var, need at least %d MB", g.sizeGB, varMB, minVarMB)
+	}
+
+	imagePath := filepath.Join(sc.OutputDir, "disk.img")
+	if err := g.createSparseImage(imagePath, totalMB); err != nil {
+		return "", fmt.Errorf("failed to create image: %w", err)
+	}
+	if err := createVerityPartitionTable(ctx, imagePath, sc.TargetArch, layout, rootMB, hashMB); err != nil {
+		return "", fmt.Errorf("failed to create partitions: %w", err)
+	}
+
+	loopDev, err := g.setupLoopDevice(ctx, imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to setup loop device: %w", err)
+	}
+	defer func() {
+		if err := g.detachLoopDevice(ctx, loopDev); err != nil {
+			log.Warn("Failed to detach loop device", "device", loopDev, "error", err)
+		}
+	}()
+
+	progress(40, "Writing root and hash tree partitions")
+
+	if err := writeToDevice(rootImg, loopDev+"p2"); err != nil {
+		return "", fmt.Errorf("failed to write root partition: %w", err)
+	}
+	if err := writeToDevice(hashImg, loopDev+"p3"); err != nil {
+		return "", fmt.Errorf("failed to write verity partition: %w", err)
+	}
+
+	progress(50, "Formatting ESP and /var")
+
+	if err := formatVerityPartitions(ctx, loopDev, varDir, layout, sc.SourceDateEpoch); err != nil {
+		return "", fmt.Errorf("failed to format partitions: %w", err)
+	}
+
+	progress(60, "Installing bootloader to ESP")
+
+	espMount, err := os.MkdirTemp("", "ldf-esp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create mount point: %w", err)
+	}
+	defer os.RemoveAll(espMount)
+
+	if output, err := exec.CommandContext(ctx, "mount", loopDev+"p1", espMount).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("mount ESP failed: %s: %s", err, output)
+	}
+	mounted := true
+	defer func() {
+		if mounted {
+			if err := exec.CommandContext(ctx, "umount", espMount).Run(); err != nil {
+				log.Warn("Failed to unmount ESP", "mount_point", espMount, "error", err)
+			}
+		}
+	}()
+
+	if err := installVerityBoot(ctx, sc, espMount, workDir, layout); err != nil {
+		return "", fmt.Errorf("failed to install bootloader: %w", err)
+	}
+
+	progress(85, "Syncing and unmounting")
+
+	if err := g.syncFilesystem(ctx, espMount); err != nil {
+		log.Warn("Failed to sync filesystem", "error", err)
+	}
+	if err := exec.CommandContext(ctx, "umount", espMount).Run(); err != nil {
+		return "", fmt.Errorf("failed to unmount ESP: %w", err)
+	}
+	mounted = false
+
+	progress(100, "dm-verity image created successfully")
+	return imagePath, nil
+}
+
+// writeVerityFstab points the root entry at the verity device mounted
+// read-only and adds the writable /var partition
+func writeVerityFstab(rootfsDir string, layout *verityLayout) error {
+	fstabPath := filepath.Join(rootfsDir, "etc", "fstab")
+	data, err := os.ReadFile(fstabPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && (fields[1] == "/" || fields[1] == "/var") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines,
+		"",
+		"# dm-verity protected root and writable state",
+		fmt.Sprintf("/dev/mapper/%s /    %s ro,noatime       0 0", verityDeviceName, layout.fsType),
+		fmt.Sprintf("UUID=%s /var ext4 defaults,noatime 0 2", layout.varFSUUID),
+	)
+
+	if err := os.MkdirAll(filepath.Dir(fstabPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fstabPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// splitVar moves rootfsDir/var into workDir, leaving an empty mount point,
+// and returns the moved directory with a function restoring the original tree
+func splitVar(rootfsDir, workDir string, epoch int64) (string, func(), error) {
+	src := filepath.Join(rootfsDir, "var")
+	dst := filepath.Join(workDir, "var")
+
+	if err := os.Rename(src, dst); err != nil {
+		if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := os.Mkdir(src, 0755); err != nil {
+		return "", nil, err
+	}
+	if epoch != 0 {
+		if err := build.NormalizeTree(src, epoch); err != nil {
+			return "", nil, err
+		}
+	}
+
+	restore := func() {
+		if err := os.Remove(src); err != nil {
+			log.Warn("Failed to remove /var mount point", "error", err)
+			return
+		}
+		if err := os.Rename(dst, src); err != nil {
+			log.Warn("Failed to restore /var", "error", err)
+		}
+	}
+	return dst, restore, nil
+}
+
+// makeReadOnlyRoot packs rootfsDir into an erofs or squashfs image
+func makeReadOnlyRoot(ctx context.Context, fsType db.VerityFilesystem, rootfsDir, outputPath string, epoch int64) error {
+	if fsType == db.VerityFilesystemSquashFS {
+		return makeSquashfs(ctx, rootfsDir, outputPath, epoch)
+	}
+
+	args := []string{"-zlz4hc"}
+	if epoch != 0 {
+		args = append(args, "--all-root",
+			"-T", strconv.FormatInt(epoch, 10),
+			"-U", build.DeterministicUUID(epoch, "erofs"))
+	}
+	args = append(args, outputPath, rootfsDir)
+
+	cmd := exec.CommandContext(ctx, "mkfs.erofs", args...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.erofs failed: %s: %s", err, output)
+	}
+	return nil
+}
+
+// formatVerity computes the hash tree of dataImg into hashImg and returns
+// the root hash. Reproducible builds pin the salt and superblock UUID.
+func formatVerity(ctx context.Context, dataImg, hashImg string, epoch int64) (string, error) {
+	args := []string{"format"}
+	if epoch != 0 {
+		args = append(args,
+			"--salt="+strings.ReplaceAll(build.DeterministicUUID(epoch, "verity-salt"), "-", ""),
+			"--uuid="+build.DeterministicUUID(epoch, "verity"))
+	}
+	args = append(args, dataImg, hashImg)
+
+	cmd := exec.CommandContext(ctx, "veritysetup", args...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("veritysetup format failed: %s: %s", err, output)
+	}
+
+	return parseVerityRootHash(string(output))
+}
+
+// parseVerityRootHash extracts the root hash from veritysetup format output
+func parseVerityRootHash(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(key) == "Root hash" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("root hash not found in veritysetup output")
+}
+
+// createVerityPartitionTable lays out ESP, root, verity and /var partitions
+// with Discoverable Partitions types and the layout's partition UUIDs
+func createVerityPartitionTable(ctx context.Context, imagePath string, arch db.TargetArch, layout *verityLayout, rootMB, hashMB int) error {
+	types, ok := verityPartitionTypes[arch]
+	if !ok {
+		types = [2]string{"8300", "8300"}
+	}
+
+	args := []string{
+		"--zap-all",
+		"--new=1:2048:+" + strconv.Itoa(espSizeMB) + "M", "--typecode=1:EF00", "--change-name=1:ESP",
+		"--partition-guid=1:" + layout.espPartUUID,
+		"--new=2:0:+" + strconv.Itoa(rootMB) + "M", "--typecode=2:" + types[0], "--change-name=2:root",
+		"--partition-guid=2:" + layout.rootPartUUID,
+		"--new=3:0:+" + strconv.Itoa(hashMB) + "M", "--typecode=3:" + types[1], "--change-name=3:root-verity",
+		"--partition-guid=3:" + layout.hashPartUUID,
+		"--new=4:0:0", "--typecode=4:" + varPartitionType, "--change-name=4:var",
+		"--partition-guid=4:" + layout.varPartUUID,
+		"--disk-guid=" + layout.diskGUID,
+		imagePath,
+	}
+
+	if output, err := exec.CommandContext(ctx, "sgdisk", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("sgdisk failed: %s: %s", err, output)
+	}
+	return nil
+}
+
+// formatVerityPartitions formats the ESP and the /var partition, populating
+// /var from varDir
+func formatVerityPartitions(ctx context.Context, loopDev, varDir string, layout *verityLayout, epoch int64) error {
+	fatArgs := []string{"-F32", "-n", "ESP"}
+	if epoch != 0 {
+		fatArgs = append(fatArgs, "-i", build.DeterministicVolumeID(epoch, "esp"), "--invariant")
+	}
+	cmd := exec.CommandContext(ctx, "mkfs.fat", append(fatArgs, loopDev+"p1")...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.fat failed: %s: %s", err, output)
+	}
+
+	extArgs := []string{"-L", "var", "-F", "-U", layout.varFSUUID, "-d", varDir}
+	if epoch != 0 {
+		extArgs = append(extArgs, "-E", "hash_seed="+layout.varFSUUID+",root_owner=0:0")
+	}
+	cmd = exec.CommandContext(ctx, "mkfs.ext4", append(extArgs, loopDev+"p4")...)
+	cmd.Env = reproducibleCmdEnv(epoch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.ext4 failed: %s: %s", err, output)
+	}
+
+	return nil
+}
+
+// installVerityBoot populates the ESP. The root filesystem is sealed at
+// this point, so the kernel, initramfs and command line carrying the root
+// hash are staged outside it.
+func installVerityBoot(ctx context.Context, sc *build.StageContext, espDir, workDir string, layout *verityLayout) error {
+	rootArg := "root=UUID=" + rootUUIDPlaceholder
+
+	// Kernel, initramfs and os-release in the layout UKIArgs expects
+	stageDir := filepath.Join(workDir, "boot-staging")
+	for _, rel := range []string{"boot/vmlinuz", "boot/initramfs.img", "etc/os-release"} {
+		src := filepath.Join(sc.RootfsDir, rel)
+		if _, err := os.Stat(src); os.IsNotExist(err) && rel != "boot/vmlinuz" {
+			continue
+		}
+		dst := filepath.Join(stageDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", rel, err)
+		}
+	}
+	if sc.SecureBoot != nil {
+		if err := signKernels(ctx, sc.SecureBoot, filepath.Join(stageDir, "boot"), sc.SourceDateEpoch); err != nil {
+			return fmt.Errorf("failed to sign kernel: %w", err)
+		}
+	}
+
+	bootloader := GetBootloaderInstaller(sc.Config.Core.Bootloader, "LDF Linux", "1.0")
+	switch bl := bootloader.(type) {
+	case *UKIInstaller:
+		cmdline, err := os.ReadFile(filepath.Join(sc.RootfsDir, "etc", "kernel", "cmdline"))
+		if err != nil {
+			return fmt.Errorf("failed to read kernel cmdline: %w", err)
+		}
+		cmdlinePath := filepath.Join(workDir, "cmdline")
+		if err := os.WriteFile(cmdlinePath, []byte(strings.ReplaceAll(string(cmdline), rootArg, layout.kernelArgs())), 0644); err != nil {
+			return err
+		}
+		if err := assembleUKI(ctx, sc, bl, stageDir, cmdlinePath, espDir); err != nil {
+			return err
+		}
+
+	case *SystemdBootInstaller:
+		// loader.conf and entries were generated under /boot/efi in the rootfs
+		if err := copyDir(filepath.Join(sc.RootfsDir, "boot", "efi"), espDir); err != nil {
+			return fmt.Errorf("failed to copy loader configuration: %w", err)
+		}
+		entries, _ := filepath.Glob(filepath.Join(espDir, "loader", "entries", "*.conf"))
+		if err := replaceInFiles(entries, rootArg, layout.kernelArgs()); err != nil {
+			return err
+		}
+		for _, name := range []string{"vmlinuz", "initramfs.img"} {
+			src := filepath.Join(stageDir, "boot", name)
+			if _, err := os.Stat(src); os.IsNotExist(err) {
+				continue
+			}
+			if err := copyFile(src, filepath.Join(espDir, name)); err != nil {
+				return fmt.Errorf("failed to install %s: %w", name, err)
+			}
+		}
+		if err := installSystemdBootBinary(sc, espDir); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("bootloader %s cannot boot a dm-verity root", bootloader.Name())
+	}
+
+	if sc.SecureBoot != nil {
+		signed, err := signESP(ctx, sc.SecureBoot, espDir, sc.SourceDateEpoch)
+		if err != nil {
+			return fmt.Errorf("failed to sign EFI binaries: %w", err)
+		}
+		log.Info("Signed EFI binaries", "files", signed)
+	}
+
+	if sc.SourceDateEpoch != 0 {
+		if err := build.NormalizeTree(espDir, sc.SourceDateEpoch); err != nil {
+			return fmt.Errorf("failed to normalize ESP: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// installSystemdBootBinary copies the target's systemd-boot EFI binary to
+// the ESP, the host-side equivalent of bootctl install
+func installSystemdBootBinary(sc *build.StageContext, espDir string) error {
+	var suffix string
+	switch sc.TargetArch {
+	case db.ArchX86_64:
+		suffix = "x64"
+	case db.ArchAARCH64:
+		suffix = "aa64"
+	default:
+		return fmt.Errorf("systemd-boot does not support %s", sc.TargetArch)
+	}
+
+	src := filepath.Join(sc.RootfsDir, "usr", "lib", "systemd", "boot", "efi", "systemd-boot"+suffix+".efi")
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("systemd-boot binary not found in rootfs: %w", err)
+	}
+
+	targets := []string{
+		filepath.Join(espDir, "EFI", "systemd", "systemd-boot"+suffix+".efi"),
+		filepath.Join(espDir, "EFI", "BOOT", efiFallbackName(sc.TargetArch)),
+	}
+	for _, dst := range targets {
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("failed to install systemd-boot: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeToDevice copies an image file onto a block device
+func writeToDevice(src, device string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// fileSizeMB returns the size of a file rounded up to whole MiB
+func fileSizeMB(path string) (int, error) {
+	size, err := GetFileSize(path)
+	if err != nil {
+		return 0, err
+	}
+	return int((size + 1<<20 - 1) >> 20), nil
+}
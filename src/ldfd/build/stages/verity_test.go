@@ -0,0 +1,144 @@
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestParseVerityRootHash(t *testing.T) {
+	output := `VERITY header information for root.verity
+UUID:            	3e2b0c4e-7a4b-4f64-9a63-3f4f1b6f0c11
+Hash type:       	1
+Data blocks:     	25600
+Data block size: 	4096
+Hash algorithm:  	sha256
+Salt:            	2f8b1c0e
+Root hash:      	4d9c6b8e1f7a2c3d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5
+`
+	hash, err := parseVerityRootHash(output)
+	if err != nil {
+		t.Fatalf("parseVerityRootHash failed: %v", err)
+	}
+	if hash != "4d9c6b8e1f7a2c3d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5" {
+		t.Errorf("unexpected root hash %q", hash)
+	}
+
+	if _, err := parseVerityRootHash("no hash here"); err == nil {
+		t.Error("expected error for output without a root hash")
+	}
+}
+
+func TestVerityLayout_KernelArgs(t *testing.T) {
+	layout := newVerityLayout(db.VerityFilesystemEROFS, 1700000000)
+	rootHash := "4d9c6b8e1f7a2c3d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5"
+	if err := layout.setRootHash(rootHash); err != nil {
+		t.Fatalf("setRootHash failed: %v", err)
+	}
+
+	if layout.rootPartUUID != "4d9c6b8e-1f7a-2c3d-5e6f-708192a3b4c5" {
+		t.Errorf("root partition UUID not derived from root hash: %s", layout.rootPartUUID)
+	}
+	if layout.hashPartUUID != "d6e7f809-1a2b-3c4d-5e6f-708192a3b4c5" {
+		t.Errorf("hash partition UUID not derived from root hash: %s", layout.hashPartUUID)
+	}
+
+	args := layout.kernelArgs()
+	for _, want := range []string{
+		"root=/dev/mapper/root",
+		"rootfstype=erofs",
+		"roothash=" + rootHash,
+		"systemd.verity_root_data=PARTUUID=" + layout.rootPartUUID,
+		"systemd.verity_root_hash=PARTUUID=" + layout.hashPartUUID,
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("kernel args %q missing %q", args, want)
+		}
+	}
+
+	// Reproducible layouts pick the same identifiers every time
+	again := newVerityLayout(db.VerityFilesystemEROFS, 1700000000)
+	if again.varFSUUID != layout.varFSUUID || again.diskGUID != layout.diskGUID {
+		t.Error("expected deterministic identifiers for a fixed epoch")
+	}
+}
+
+func TestWriteVerityFstab(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fstab := `# <file system>  <mount point>  <type>  <options>         <dump>  <pass>
+UUID=ROOT_UUID   /              ext4     defaults,noatime     0       1
+proc             /proc          proc    defaults          0       0
+`
+	if err := os.WriteFile(filepath.Join(rootfs, "etc", "fstab"), []byte(fstab), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	layout := newVerityLayout(db.VerityFilesystemSquashFS, 1700000000)
+	if err := writeVerityFstab(rootfs, layout); err != nil {
+		t.Fatalf("writeVerityFstab failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootfs, "etc", "fstab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if strings.Contains(content, "ROOT_UUID") {
+		t.Error("expected the writable root entry to be removed")
+	}
+	if !strings.Contains(content, "/dev/mapper/root /    squashfs ro,noatime") {
+		t.Errorf("missing read-only verity root entry:\n%s", content)
+	}
+	if !strings.Contains(content, "UUID="+layout.varFSUUID+" /var ext4") {
+		t.Errorf("missing /var entry:\n%s", content)
+	}
+	if !strings.Contains(content, "/proc") {
+		t.Error("expected unrelated entries to be kept")
+	}
+}
+
+func TestValidateVerityConfig(t *testing.T) {
+	config := &db.DistributionConfig{}
+	config.Security.Verity.Enabled = true
+
+	config.Core.Bootloader = "grub"
+	if err := ValidateVerityConfig(config, db.ImageFormatRaw); err == nil {
+		t.Error("expected GRUB to be rejected")
+	}
+
+	config.Core.Bootloader = "systemd-boot"
+	if err := ValidateVerityConfig(config, db.ImageFormatQCOW2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateVerityConfig(config, db.ImageFormatISO); err == nil {
+		t.Error("expected ISO images to be rejected")
+	}
+
+	config.Security.Verity.Filesystem = "ext4"
+	if err := ValidateVerityConfig(config, db.ImageFormatRaw); err == nil {
+		t.Error("expected unsupported filesystem to be rejected")
+	}
+}
+
+func TestInitramfsGenerator_VerityInit(t *testing.T) {
+	config := &db.DistributionConfig{}
+	gen := NewInitramfsGenerator(t.TempDir(), "", config, db.ArchX86_64)
+	if block := gen.verityInitBlock(); block != "" {
+		t.Error("expected no verity setup without verity enabled")
+	}
+
+	config.Security.Verity.Enabled = true
+	block := gen.verityInitBlock()
+	if !strings.Contains(block, `veritysetup open "$DATA_DEV" root "$HASH_DEV" "$ROOTHASH"`) {
+		t.Errorf("expected veritysetup open in init script:\n%s", block)
+	}
+	if !strings.Contains(block, "modprobe erofs") {
+		t.Error("expected erofs module to be loaded by default")
+	}
+}
@@ -0,0 +1,522 @@
+package stages
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/build/cloud"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+const (
+	// vmDomainName is the name the libvirt domain XML is published under
+	vmDomainName = "libvirt-domain.xml"
+	// vmScriptName is the name the QEMU launch script is published under
+	vmScriptName = "run-qemu.sh"
+
+	defaultVMMemoryMB = 2048
+	defaultVMCPUs     = 2
+
+	// libvirtImageDir is where the libvirt domain expects the image, the
+	// default storage pool of most distributions
+	libvirtImageDir = "/var/lib/libvirt/images"
+)
+
+// vmLaunch describes how an image is booted in a virtual machine. The
+// launch descriptors and the boot test are both derived from it.
+type vmLaunch struct {
+	arch          db.TargetArch
+	format        db.ImageFormat
+	memoryMB      int
+	cpus          int
+	diskBus       db.VMDiskBus
+	serialConsole bool
+	// seed attaches the NoCloud seed ISO published next to the image
+	seed bool
+}
+
+// newVMLaunch returns the virtual machine settings of the build's image
+func newVMLaunch(sc *build.StageContext) vmLaunch {
+	cfg := sc.Config.Build.VM
+	l := vmLaunch{
+		arch:          sc.TargetArch,
+		format:        sc.ImageFormat,
+		memoryMB:      cfg.MemoryMB,
+		cpus:          cfg.CPUs,
+		diskBus:       cfg.DiskBus,
+		serialConsole: serialConsoleEnabled(sc.Config),
+		seed:          cloudSeedEnabled(sc.Config),
+	}
+	if l.memoryMB <= 0 {
+		l.memoryMB = defaultVMMemoryMB
+	}
+	if l.cpus <= 0 {
+		l.cpus = defaultVMCPUs
+	}
+	if l.diskBus == "" {
+		l.diskBus = db.VMDiskBusVirtio
+	}
+	return l
+}
+
+// ValidateVMConfig reports virtual machine settings that cannot be used
+func ValidateVMConfig(config *db.DistributionConfig) error {
+	cfg := config.Build.VM
+	switch cfg.DiskBus {
+	case "", db.VMDiskBusVirtio, db.VMDiskBusSCSI, db.VMDiskBusSATA:
+	default:
+		return fmt.Errorf("unsupported VM disk bus %q (supported: virtio, scsi, sata)", cfg.DiskBus)
+	}
+	if cfg.MemoryMB < 0 || cfg.CPUs < 0 {
+		return fmt.Errorf("VM memory and CPU count must not be negative")
+	}
+	return nil
+}
+
+// vmDescriptorsSupported reports whether the build's image boots in a
+// generic UEFI virtual machine. Raspberry Pi images need the board's boot ROM.
+func vmDescriptorsSupported(sc *build.StageContext) bool {
+	switch sc.ImageFormat {
+	case db.ImageFormatRaw, db.ImageFormatQCOW2, db.ImageFormatVMDK, db.ImageFormatVHDX, db.ImageFormatISO:
+	default:
+		return false
+	}
+	return boardImageLayout(sc.BoardProfile) != db.BoardImageLayoutRPi
+}
+
+// serialConsoleEnabled reports whether boot entries mirror the kernel
+// console on the serial port. Cloud images always log to it.
+func serialConsoleEnabled(config *db.DistributionConfig) bool {
+	return config.Build.BootTest.Enabled || config.Build.VM.SerialConsole || cloud.Enabled(config)
+}
+
+// writeVMDescriptors writes the libvirt domain XML and QEMU launch script
+// of the image at imagePath into dir and returns their paths
+func writeVMDescriptors(sc *build.StageContext, imagePath, dir string) ([]string, error) {
+	l := newVMLaunch(sc)
+	imageName := filepath.Base(imagePath)
+
+	domain, err := l.libvirtDomain(vmDomainNameFor(sc), filepath.Join(libvirtImageDir, imageName))
+	if err != nil {
+		return nil, err
+	}
+	domainPath := filepath.Join(dir, vmDomainName)
+	if err := os.WriteFile(domainPath, domain, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write libvirt domain: %w", err)
+	}
+
+	scriptPath := filepath.Join(dir, vmScriptName)
+	if err := os.WriteFile(scriptPath, []byte(l.launchScript(imageName, sc.BuildID)), 0755); err != nil {
+		return nil, fmt.Errorf("failed to write QEMU launch script: %w", err)
+	}
+
+	return []string{domainPath, scriptPath}, nil
+}
+
+// domainNameInvalid matches the characters left out of libvirt domain names
+var domainNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// vmDomainNameFor returns the libvirt domain name of a build: the
+// distribution name and the start of the build ID
+func vmDomainNameFor(sc *build.StageContext) string {
+	name := strings.Trim(domainNameInvalid.ReplaceAllString(sc.DistName, "-"), "-")
+	if name == "" {
+		name = "ldf"
+	}
+	id := sc.BuildID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	if id == "" {
+		return name
+	}
+	return name + "-" + id
+}
+
+// qemuCPU returns the CPU model to emulate under accel
+func qemuCPU(accel string) string {
+	if accel == "kvm" {
+		return "host"
+	}
+	return "max"
+}
+
+// machineArgs returns the QEMU machine, CPU and memory arguments
+func (l vmLaunch) machineArgs(accel, cpu string) []string {
+	machine := "q35"
+	if l.arch == db.ArchAARCH64 {
+		machine = "virt"
+	}
+	return []string{
+		"-machine", machine,
+		"-accel", accel,
+		"-cpu", cpu,
+		"-m", strconv.Itoa(l.memoryMB),
+		"-smp", strconv.Itoa(l.cpus),
+	}
+}
+
+// firmwareArgs returns the QEMU arguments loading the UEFI firmware
+func firmwareArgs(fw uefiFirmware) []string {
+	if fw.vars == "" {
+		return []string{"-bios", fw.code}
+	}
+	return []string{
+		"-drive", "if=pflash,format=raw,unit=0,readonly=on,file=" + fw.code,
+		"-drive", "if=pflash,format=raw,unit=1,file=" + fw.vars,
+	}
+}
+
+// diskArgs returns the QEMU arguments attaching the image on the
+// configured bus. Snapshot mode discards the guest's writes.
+func (l vmLaunch) diskArgs(imagePath string, snapshot bool) []string {
+	if l.format == db.ImageFormatISO {
+		drive := "if=none,id=cd0,media=cdrom,readonly=on,file=" + imagePath
+		if l.diskBus == db.VMDiskBusSATA {
+			return []string{"-device", "ich9-ahci,id=ahci0", "-drive", drive, "-device", "ide-cd,drive=cd0,bus=ahci0.0"}
+		}
+		return []string{"-device", "virtio-scsi-pci,id=scsi0", "-drive", drive, "-device", "scsi-cd,drive=cd0,bus=scsi0.0"}
+	}
+
+	opts := "format=" + string(l.format)
+	if snapshot {
+		opts += ",snapshot=on"
+	}
+	opts += ",file=" + imagePath
+
+	switch l.diskBus {
+	case db.VMDiskBusSCSI:
+		return []string{"-device", "virtio-scsi-pci,id=scsi0", "-drive", "if=none,id=disk0," + opts, "-device", "scsi-hd,drive=disk0,bus=scsi0.0"}
+	case db.VMDiskBusSATA:
+		return []string{"-device", "ich9-ahci,id=ahci0", "-drive", "if=none,id=disk0," + opts, "-device", "ide-hd,drive=disk0,bus=ahci0.0"}
+	default:
+		return []string{"-drive", "if=virtio," + opts}
+	}
+}
+
+// seedArgs returns the QEMU arguments attaching a NoCloud seed ISO as a
+// read-only disk, where cloud-init finds it by its volume label
+func seedArgs(seedPath string) []string {
+	return []string{"-drive", "if=virtio,format=raw,readonly=on,file=" + seedPath}
+}
+
+// netArgs returns the QEMU arguments of a user-mode network interface
+func netArgs() []string {
+	return []string{"-netdev", "user,id=net0", "-device", "virtio-net-pci,netdev=net0"}
+}
+
+// displayArgs returns the QEMU console arguments of an interactive launch:
+// headless on the serial port, or a display with the serial port on the
+// terminal. The virt machine has no default display device.
+func (l vmLaunch) displayArgs() []string {
+	if l.serialConsole {
+		return []string{"-display", "none", "-serial", "mon:stdio"}
+	}
+	args := []string{"-serial", "mon:stdio"}
+	if l.arch == db.ArchAARCH64 {
+		args = append(args, "-device", "virtio-gpu-pci", "-device", "qemu-xhci", "-device", "usb-kbd", "-device", "usb-tablet")
+	}
+	return args
+}
+
+// launchScript returns a shell script booting the image in QEMU on the
+// host it runs on. It picks KVM when the host can run the guest natively
+// and searches the usual OVMF/AAVMF locations for the firmware.
+func (l vmLaunch) launchScript(imageName, buildID string) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	fmt.Fprintf(&b, "# Boots the %s %s image of LDF build %s in QEMU under UEFI.\n", l.arch, l.format, buildID)
+	b.WriteString("#\n")
+	b.WriteString("# Usage: run-qemu.sh [image] [qemu options...]\n")
+	b.WriteString("#\n")
+	fmt.Fprintf(&b, "# The image defaults to %s next to this script. UEFI variables are\n", imageName)
+	b.WriteString("# kept in <image>.efivars.fd. Set QEMU_ACCEL to force an accelerator.\n")
+	b.WriteString("set -euo pipefail\n\n")
+
+	fmt.Fprintf(&b, "IMAGE=\"$(dirname \"$0\")\"/%s\n", shellLiteral(imageName))
+	b.WriteString("if [ $# -gt 0 ] && [ \"${1#-}\" = \"$1\" ]; then\n\tIMAGE=\"$1\"\n\tshift\nfi\n")
+	b.WriteString("if [ ! -f \"$IMAGE\" ]; then\n\techo \"image not found: $IMAGE\" >&2\n\texit 1\nfi\n\n")
+	if l.seed {
+		fmt.Fprintf(&b, "# cloud-init reads the default user's SSH keys from the NoCloud seed\nSEED=\"$(dirname \"$IMAGE\")\"/%s\nSEED_ARGS=()\n", cloud.SeedName)
+		fmt.Fprintf(&b, "if [ -f \"$SEED\" ]; then\n\tSEED_ARGS=(%s)\nfi\n\n", shellArgs(seedArgs("$SEED")))
+	}
+
+	fmt.Fprintf(&b, "ACCEL=\"${QEMU_ACCEL:-}\"\nif [ -z \"$ACCEL\" ]; then\n\tACCEL=tcg\n\tif [ \"$(uname -m)\" = %s ] && [ -w /dev/kvm ]; then\n\t\tACCEL=kvm\n\tfi\nfi\n", hostMachine(l.arch))
+	fmt.Fprintf(&b, "CPU=%s\nif [ \"$ACCEL\" = kvm ]; then\n\tCPU=%s\nfi\n\n", qemuCPU("tcg"), qemuCPU("kvm"))
+
+	b.WriteString("find_firmware() {\n")
+	b.WriteString("\twhile read -r code vars; do\n")
+	b.WriteString("\t\t[ -f \"$code\" ] || continue\n")
+	b.WriteString("\t\tif [ -n \"$vars\" ] && [ -f \"$vars\" ]; then\n")
+	b.WriteString("\t\t\t[ -f \"$IMAGE.efivars.fd\" ] || cp \"$vars\" \"$IMAGE.efivars.fd\"\n")
+	fmt.Fprintf(&b, "\t\t\tFIRMWARE=(%s)\n", shellArgs(firmwareArgs(uefiFirmware{code: "$code", vars: "$IMAGE.efivars.fd"})))
+	b.WriteString("\t\telse\n")
+	fmt.Fprintf(&b, "\t\t\tFIRMWARE=(%s)\n", shellArgs(firmwareArgs(uefiFirmware{code: "$code"})))
+	b.WriteString("\t\tfi\n\t\treturn 0\n")
+	b.WriteString("\tdone <<'EOF'\n")
+	for _, fw := range uefiFirmwareCandidates[l.arch] {
+		b.WriteString(strings.TrimSpace(fw.code + " " + fw.vars))
+		b.WriteString("\n")
+	}
+	b.WriteString("EOF\n\treturn 1\n}\n\n")
+	fmt.Fprintf(&b, "if ! find_firmware; then\n\techo \"UEFI firmware (%s) for %s not found\" >&2\n\texit 1\nfi\n\n", firmwareName(l.arch), l.arch)
+
+	args := l.machineArgs("$ACCEL", "$CPU")
+	args = append(args, l.diskArgs("$IMAGE", false)...)
+	args = append(args, netArgs()...)
+	args = append(args, "-device", "virtio-rng-pci")
+	args = append(args, l.displayArgs()...)
+
+	fmt.Fprintf(&b, "exec %s \\\n", qemuBinary(l.arch))
+	b.WriteString("\t\"${FIRMWARE[@]}\" \\\n")
+	if l.seed {
+		// Older bash treats an empty array as unset under set -u
+		b.WriteString("\t${SEED_ARGS[@]+\"${SEED_ARGS[@]}\"} \\\n")
+	}
+	for i := 0; i < len(args); i++ {
+		// Keep options on one line with their value
+		line := shellArgs(args[i : i+1])
+		if strings.HasPrefix(args[i], "-") && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			line = shellArgs(args[i : i+2])
+			i++
+		}
+		fmt.Fprintf(&b, "\t%s \\\n", line)
+	}
+	b.WriteString("\t\"$@\"\n")
+	return b.String()
+}
+
+// hostMachine returns the uname -m of hosts that run arch natively
+func hostMachine(arch db.TargetArch) string {
+	if arch == db.ArchAARCH64 {
+		return "aarch64"
+	}
+	return "x86_64"
+}
+
+// firmwareName returns the name of the UEFI firmware build for arch
+func firmwareName(arch db.TargetArch) string {
+	if arch == db.ArchAARCH64 {
+		return "AAVMF"
+	}
+	return "OVMF"
+}
+
+// shellArgs quotes generated QEMU arguments for the launch script. The
+// arguments are double-quoted so the script's own variables expand.
+func shellArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,=:/") == "" {
+			quoted[i] = a
+			continue
+		}
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`")
+		quoted[i] = `"` + r.Replace(a) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellLiteral single-quotes s for a shell
+func shellLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// libvirtDomain is the subset of the libvirt domain XML schema the
+// published domains use
+type libvirtDomain struct {
+	XMLName  xml.Name        `xml:"domain"`
+	Type     string          `xml:"type,attr"`
+	Name     string          `xml:"name"`
+	Memory   libvirtMemory   `xml:"memory"`
+	VCPU     int             `xml:"vcpu"`
+	OS       libvirtOS       `xml:"os"`
+	Features libvirtFeatures `xml:"features"`
+	CPU      libvirtCPU      `xml:"cpu"`
+	Devices  libvirtDevices  `xml:"devices"`
+}
+
+type libvirtMemory struct {
+	Unit  string `xml:"unit,attr"`
+	Value int    `xml:",chardata"`
+}
+
+type libvirtOS struct {
+	Firmware string        `xml:"firmware,attr"`
+	Type     libvirtOSType `xml:"type"`
+}
+
+type libvirtOSType struct {
+	Arch    string `xml:"arch,attr"`
+	Machine string `xml:"machine,attr"`
+	Value   string `xml:",chardata"`
+}
+
+type libvirtFeatures struct {
+	ACPI *struct{} `xml:"acpi,omitempty"`
+	APIC *struct{} `xml:"apic,omitempty"`
+}
+
+type libvirtCPU struct {
+	Mode string `xml:"mode,attr"`
+}
+
+type libvirtDevices struct {
+	Disks       []libvirtDisk       `xml:"disk"`
+	Controllers []libvirtController `xml:"controller,omitempty"`
+	Interfaces  []libvirtInterface  `xml:"interface"`
+	Serials     []libvirtChar       `xml:"serial"`
+	Consoles    []libvirtChar       `xml:"console"`
+	RNG         libvirtRNG          `xml:"rng"`
+	Graphics    *libvirtGraphics    `xml:"graphics,omitempty"`
+	Video       *libvirtVideo       `xml:"video,omitempty"`
+}
+
+type libvirtDisk struct {
+	Type     string            `xml:"type,attr"`
+	Device   string            `xml:"device,attr"`
+	Driver   libvirtDiskDriver `xml:"driver"`
+	Source   libvirtSource     `xml:"source"`
+	Target   libvirtTarget     `xml:"target"`
+	ReadOnly *struct{}         `xml:"readonly,omitempty"`
+}
+
+type libvirtDiskDriver struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type libvirtSource struct {
+	File    string `xml:"file,attr,omitempty"`
+	Network string `xml:"network,attr,omitempty"`
+}
+
+type libvirtTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+type libvirtController struct {
+	Type  string `xml:"type,attr"`
+	Model string `xml:"model,attr"`
+}
+
+type libvirtInterface struct {
+	Type   string        `xml:"type,attr"`
+	Source libvirtSource `xml:"source"`
+	Model  libvirtModel  `xml:"model"`
+}
+
+type libvirtModel struct {
+	Type string `xml:"type,attr"`
+}
+
+type libvirtChar struct {
+	Type string `xml:"type,attr"`
+}
+
+type libvirtRNG struct {
+	Model   string         `xml:"model,attr"`
+	Backend libvirtBackend `xml:"backend"`
+}
+
+type libvirtBackend struct {
+	Model string `xml:"model,attr"`
+	Value string `xml:",chardata"`
+}
+
+type libvirtGraphics struct {
+	Type     string `xml:"type,attr"`
+	AutoPort string `xml:"autoport,attr"`
+}
+
+type libvirtVideo struct {
+	Model libvirtModel `xml:"model"`
+}
+
+// libvirtDomain returns the libvirt domain XML booting the image at
+// imagePath on the host's KVM with the launch settings
+func (l vmLaunch) libvirtDomain(name, imagePath string) ([]byte, error) {
+	machine := "q35"
+	features := libvirtFeatures{ACPI: &struct{}{}, APIC: &struct{}{}}
+	if l.arch == db.ArchAARCH64 {
+		machine = "virt"
+		features.APIC = nil
+	}
+
+	disk := libvirtDisk{
+		Type:   "file",
+		Device: "disk",
+		Driver: libvirtDiskDriver{Name: "qemu", Type: string(l.format)},
+		Source: libvirtSource{File: imagePath},
+	}
+	var controllers []libvirtController
+	switch {
+	case l.format == db.ImageFormatISO && l.diskBus != db.VMDiskBusSATA, l.diskBus == db.VMDiskBusSCSI:
+		disk.Target = libvirtTarget{Dev: "sda", Bus: "scsi"}
+		controllers = append(controllers, libvirtController{Type: "scsi", Model: "virtio-scsi"})
+	case l.diskBus == db.VMDiskBusSATA:
+		disk.Target = libvirtTarget{Dev: "sda", Bus: "sata"}
+	default:
+		disk.Target = libvirtTarget{Dev: "vda", Bus: "virtio"}
+	}
+	if l.format == db.ImageFormatISO {
+		disk.Device = "cdrom"
+		disk.Driver.Type = "raw"
+		disk.ReadOnly = &struct{}{}
+	}
+
+	disks := []libvirtDisk{disk}
+	if l.seed {
+		seed := libvirtDisk{
+			Type:     "file",
+			Device:   "disk",
+			Driver:   libvirtDiskDriver{Name: "qemu", Type: "raw"},
+			Source:   libvirtSource{File: filepath.Join(filepath.Dir(imagePath), cloud.SeedName)},
+			Target:   libvirtTarget{Dev: "vdb", Bus: "virtio"},
+			ReadOnly: &struct{}{},
+		}
+		if disk.Target.Bus != "virtio" {
+			seed.Target.Dev = "vda"
+		}
+		disks = append(disks, seed)
+	}
+
+	domain := libvirtDomain{
+		Type:     "kvm",
+		Name:     name,
+		Memory:   libvirtMemory{Unit: "MiB", Value: l.memoryMB},
+		VCPU:     l.cpus,
+		OS:       libvirtOS{Firmware: "efi", Type: libvirtOSType{Arch: string(l.arch), Machine: machine, Value: "hvm"}},
+		Features: features,
+		CPU:      libvirtCPU{Mode: "host-passthrough"},
+		Devices: libvirtDevices{
+			Disks:       disks,
+			Controllers: controllers,
+			Interfaces: []libvirtInterface{{
+				Type:   "network",
+				Source: libvirtSource{Network: "default"},
+				Model:  libvirtModel{Type: "virtio"},
+			}},
+			Serials:  []libvirtChar{{Type: "pty"}},
+			Consoles: []libvirtChar{{Type: "pty"}},
+			RNG:      libvirtRNG{Model: "virtio", Backend: libvirtBackend{Model: "random", Value: "/dev/urandom"}},
+		},
+	}
+	if !l.serialConsole {
+		domain.Devices.Graphics = &libvirtGraphics{Type: "vnc", AutoPort: "yes"}
+		domain.Devices.Video = &libvirtVideo{Model: libvirtModel{Type: "virtio"}}
+	}
+
+	data, err := xml.MarshalIndent(domain, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode libvirt domain: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,146 @@
+package stages
+
+import (
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+func TestWriteVMDescriptors(t *testing.T) {
+	sc := &build.StageContext{
+		BuildID:     "0123456789abcdef",
+		DistName:    "LDF Base",
+		TargetArch:  db.ArchX86_64,
+		ImageFormat: db.ImageFormatQCOW2,
+		Config: &db.DistributionConfig{Build: db.BuildConfig{
+			VM: db.VMConfig{MemoryMB: 4096, CPUs: 4, DiskBus: db.VMDiskBusSCSI, SerialConsole: true},
+		}},
+	}
+	dir := t.TempDir()
+
+	files, err := writeVMDescriptors(sc, "/out/ldf-base.qcow2", dir)
+	if err != nil {
+		t.Fatalf("writeVMDescriptors() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 descriptors, got %v", files)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, vmDomainName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var domain libvirtDomain
+	if err := xml.Unmarshal(data, &domain); err != nil {
+		t.Fatalf("domain XML does not parse: %v", err)
+	}
+	if domain.Name != "LDF-Base-01234567" {
+		t.Errorf("domain name = %q", domain.Name)
+	}
+	if domain.OS.Firmware != "efi" || domain.OS.Type.Machine != "q35" || domain.Memory.Value != 4096 || domain.VCPU != 4 {
+		t.Errorf("unexpected domain settings: %+v", domain)
+	}
+	disk := domain.Devices.Disks[0]
+	if disk.Target.Bus != "scsi" || disk.Driver.Type != "qcow2" || disk.Source.File != "/var/lib/libvirt/images/ldf-base.qcow2" {
+		t.Errorf("unexpected disk: %+v", disk)
+	}
+	if len(domain.Devices.Controllers) != 1 || domain.Devices.Controllers[0].Model != "virtio-scsi" {
+		t.Errorf("expected a virtio-scsi controller, got %+v", domain.Devices.Controllers)
+	}
+	if domain.Devices.Graphics != nil {
+		t.Error("serial console domains should be headless")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, vmScriptName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&0111 == 0 {
+		t.Error("launch script is not executable")
+	}
+	script, _ := os.ReadFile(filepath.Join(dir, vmScriptName))
+	for _, want := range []string{
+		`IMAGE="$(dirname "$0")"/'ldf-base.qcow2'`,
+		"/usr/share/OVMF/OVMF_CODE_4M.fd /usr/share/OVMF/OVMF_VARS_4M.fd",
+		"exec qemu-system-x86_64",
+		`-cpu "$CPU"`,
+		"-m 4096",
+		`-drive "if=none,id=disk0,format=qcow2,file=$IMAGE"`,
+		"-device scsi-hd,drive=disk0,bus=scsi0.0",
+		"-display none",
+	} {
+		if !strings.Contains(string(script), want) {
+			t.Errorf("launch script missing %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(string(script), "snapshot=on") {
+		t.Error("launch script should boot the image writable")
+	}
+
+	if bash, err := exec.LookPath("bash"); err == nil {
+		if out, err := exec.Command(bash, "-n", filepath.Join(dir, vmScriptName)).CombinedOutput(); err != nil {
+			t.Errorf("launch script has syntax errors: %v\n%s", err, out)
+		}
+	}
+}
+
+func TestLibvirtDomain_AArch64ISO(t *testing.T) {
+	l := vmLaunch{arch: db.ArchAARCH64, format: db.ImageFormatISO, memoryMB: 2048, cpus: 2, diskBus: db.VMDiskBusVirtio}
+	data, err := l.libvirtDomain("ldf", "/images/ldf.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var domain libvirtDomain
+	if err := xml.Unmarshal(data, &domain); err != nil {
+		t.Fatalf("domain XML does not parse: %v", err)
+	}
+	disk := domain.Devices.Disks[0]
+	if disk.Device != "cdrom" || disk.Target.Bus != "scsi" || disk.ReadOnly == nil || disk.Driver.Type != "raw" {
+		t.Errorf("unexpected ISO disk: %+v", disk)
+	}
+	if domain.OS.Type.Arch != "aarch64" || domain.OS.Type.Machine != "virt" || domain.Features.APIC != nil {
+		t.Errorf("unexpected aarch64 domain: %+v", domain)
+	}
+	if domain.Devices.Graphics == nil || domain.Devices.Video == nil {
+		t.Error("expected a display without the serial console")
+	}
+}
+
+func TestVMDescriptorsSupported(t *testing.T) {
+	sc := &build.StageContext{Config: &db.DistributionConfig{}, ImageFormat: db.ImageFormatRaw}
+	if !vmDescriptorsSupported(sc) {
+		t.Error("expected descriptors for raw images")
+	}
+	sc.BoardProfile = &db.BoardProfile{Config: db.BoardConfig{ImageLayout: db.BoardImageLayoutRPi}}
+	if vmDescriptorsSupported(sc) {
+		t.Error("expected no descriptors for Raspberry Pi images")
+	}
+	sc.BoardProfile = nil
+	for _, format := range []db.ImageFormat{db.ImageFormatOCI, db.ImageFormatCpio, db.ImageFormatNetboot} {
+		sc.ImageFormat = format
+		if vmDescriptorsSupported(sc) {
+			t.Errorf("expected no descriptors for %s", format)
+		}
+	}
+}
+
+func TestValidateVMConfig(t *testing.T) {
+	config := &db.DistributionConfig{}
+	if err := ValidateVMConfig(config); err != nil {
+		t.Errorf("default config: %v", err)
+	}
+	config.Build.VM.DiskBus = "nvme"
+	if err := ValidateVMConfig(config); err == nil {
+		t.Error("expected error for unsupported disk bus")
+	}
+	config.Build.VM = db.VMConfig{CPUs: -1}
+	if err := ValidateVMConfig(config); err == nil {
+		t.Error("expected error for negative CPU count")
+	}
+}
@@ -0,0 +1,140 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// Reproducibility verification results
+const (
+	VerifyResultMatch    = "match"
+	VerifyResultMismatch = "mismatch"
+)
+
+// SubmitVerification queues a rebuild of a completed reproducible build from
+// its config snapshot, pinned to the builder image digest the original ran
+// in. The worker compares the new artifact with the original once the
+// rebuild completes.
+func (m *Manager) SubmitVerification(buildID, userID string) (*db.BuildJob, error) {
+	orig, err := m.buildJobRepo.GetByID(buildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build: %w", err)
+	}
+	if orig == nil {
+		return nil, fmt.Errorf("build not found: %s", buildID)
+	}
+	if orig.Status != db.BuildStatusCompleted {
+		return nil, fmt.Errorf("can only verify completed builds")
+	}
+
+	var config db.DistributionConfig
+	if err := json.Unmarshal([]byte(orig.ConfigSnapshot), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config snapshot: %w", err)
+	}
+	if !config.Build.Reproducible {
+		return nil, ErrNotReproducible
+	}
+
+	job := &db.BuildJob{
+		DistributionID: orig.DistributionID,
+		OwnerID:        userID,
+		TargetArch:     orig.TargetArch,
+		ImageFormat:    orig.ImageFormat,
+		Status:         db.BuildStatusPending,
+		MaxRetries:     m.config.MaxRetries,
+		ClearCache:     true,
+		ConfigSnapshot: orig.ConfigSnapshot,
+		BuilderImage:   orig.BuilderImage,
+		BuilderDigest:  orig.BuilderDigest,
+		VerifyOf:       orig.ID,
+	}
+
+	if err := m.buildJobRepo.Create(job); err != nil {
+		return nil, fmt.Errorf("failed to create build job: %w", err)
+	}
+
+	log.Info("Reproducibility verification submitted",
+		"build_id", job.ID,
+		"verify_of", orig.ID,
+	)
+
+	select {
+	case m.jobQueue <- job:
+		log.Debug("Build job dispatched immediately", "build_id", job.ID)
+	default:
+		log.Debug("Build job queued for later dispatch", "build_id", job.ID)
+	}
+
+	return job, nil
+}
+
+// verifyReproducible compares a completed verification build with the build
+// it reproduces and records the result
+func (w *Worker) verifyReproducible(ctx context.Context, job *db.BuildJob, sc *StageContext) {
+	orig, err := w.manager.buildJobRepo.GetByID(job.VerifyOf)
+	if err != nil || orig == nil {
+		log.Warn("Failed to load original build for verification", "build_id", job.ID, "verify_of", job.VerifyOf, "error", err)
+		return
+	}
+
+	result := VerifyResultMatch
+	var diff []string
+	if orig.ArtifactChecksum != sc.ArtifactChecksum {
+		result = VerifyResultMismatch
+		diff, err = w.diffRootfsManifests(ctx, orig.ArtifactPath, filepath.Join(sc.OutputDir, RootfsManifestName))
+		if err != nil {
+			log.Warn("Failed to compare rootfs manifests", "build_id", job.ID, "error", err)
+		}
+	}
+
+	if err := w.manager.buildJobRepo.SetVerifyResult(job.ID, result, diff); err != nil {
+		log.Warn("Failed to record verify result", "build_id", job.ID, "error", err)
+	}
+
+	message := fmt.Sprintf("Reproducibility check against %s: %s", orig.ID, result)
+	if result == VerifyResultMismatch {
+		message = fmt.Sprintf("%s (%s vs %s, %d differing files)", message, orig.ArtifactChecksum, sc.ArtifactChecksum, len(diff))
+	}
+	if err := w.manager.buildJobRepo.AppendLog(job.ID, "", "info", message); err != nil {
+		log.Warn("Failed to append build log", "build_id", job.ID, "error", err)
+	}
+}
+
+// diffRootfsManifests compares the rootfs manifest stored next to the
+// original artifact with the local manifest of the verification rebuild,
+// which publishes nothing, and returns the paths that differ
+func (w *Worker) diffRootfsManifests(ctx context.Context, origArtifact, newManifest string) ([]string, error) {
+	origEntries, err := w.loadManifest(ctx, origArtifact)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(newManifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", newManifest, err)
+	}
+	defer f.Close()
+	newEntries, err := ReadManifest(f)
+	if err != nil {
+		return nil, err
+	}
+	return DiffManifests(origEntries, newEntries), nil
+}
+
+// loadManifest downloads the rootfs manifest stored next to an artifact
+func (w *Worker) loadManifest(ctx context.Context, artifactPath string) ([]ManifestEntry, error) {
+	key := path.Join(path.Dir(artifactPath), RootfsManifestName)
+	reader, _, err := w.manager.storage.Download(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	return ReadManifest(reader)
+}
@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 
 	"github.com/bitswalk/ldf/src/common/paths"
 	"github.com/bitswalk/ldf/src/ldfd/db"
-	"github.com/spf13/viper"
 )
 
 // Worker processes build jobs from the queue
@@ -78,14 +78,18 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 	defer w.manager.unregisterCancel(job.ID)
 
 	// Mark job as started
+	run := provenanceRun{StartedAt: time.Now()}
 	if err := w.manager.buildJobRepo.MarkStarted(job.ID); err != nil {
 		log.Error("Failed to mark build started", "build_id", job.ID, "error", err)
 		return
 	}
 
-	// Update distribution status to building
-	if err := w.manager.distRepo.UpdateStatus(job.DistributionID, db.StatusBuilding, ""); err != nil {
-		log.Warn("Failed to update distribution status to building", "distribution_id", job.DistributionID, "error", err)
+	// Update distribution status to building. Verification rebuilds leave
+	// the distribution untouched.
+	if job.VerifyOf == "" {
+		if err := w.manager.distRepo.UpdateStatus(job.DistributionID, db.StatusBuilding, ""); err != nil {
+			log.Warn("Failed to update distribution status to building", "distribution_id", job.DistributionID, "error", err)
+		}
 	}
 
 	// Parse the config snapshot
@@ -98,17 +102,10 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 	}
 
 	// Validate build environment (architecture, toolchain, container image)
-	// Read live config from viper so Settings changes take effect without restart
-	liveRuntime := viper.GetString("build.container_runtime")
-	if liveRuntime == "" {
-		liveRuntime = w.manager.config.ContainerRuntime
-	}
-	liveImage := viper.GetString("build.container_image")
-	if liveImage == "" {
-		liveImage = w.manager.config.ContainerImage
-	}
-	runtime := RuntimeType(liveRuntime)
-	buildEnv, err := ValidateBuildEnvironment(runtime, liveImage, job.TargetArch)
+	// Read live config from viper so Settings changes take effect without
+	// restart; the executor below is created from the same values
+	runtime, containerImage := w.manager.liveBuilderConfig()
+	buildEnv, err := ValidateBuildEnvironment(runtime, containerImage, job.TargetArch)
 	if err != nil {
 		w.handleFailure(job, fmt.Sprintf("Build environment validation failed: %v", err), "")
 		return
@@ -140,33 +137,57 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 		}
 	}
 
-	// Create executor from current config (reads live viper values so
-	// runtime changes via the Settings API take effect immediately)
-	runtimeName := viper.GetString("build.container_runtime")
-	if runtimeName == "" {
-		runtimeName = w.manager.config.ContainerRuntime
-	}
-	containerImage := viper.GetString("build.container_image")
-	if containerImage == "" {
-		containerImage = w.manager.config.ContainerImage
-	}
-
-	execRuntime := RuntimeType(runtimeName)
-
 	// For chroot mode, use direct host execution (empty sysroot).
 	// The compile and package stages handle path translation internally.
-	if execRuntime == RuntimeChroot {
+	if runtime == RuntimeChroot {
 		containerImage = ""
 	}
 
-	executor, err := NewExecutor(execRuntime, containerImage, nil)
+	run.Runtime = runtime
+
+	// Pin the builder image to its current digest so every stage runs in the
+	// same image even if the tag is rebuilt while the job is in progress. The
+	// executor is created from the digest, not the tag.
+	if runtime.IsContainerRuntime() {
+		// Verification rebuilds run in the exact image the original build
+		// used, whatever the tag points to now
+		pinRef := buildEnv.ContainerImage
+		if job.VerifyOf != "" && job.BuilderDigest != "" {
+			buildEnv.ContainerImage = job.BuilderImage
+			pinRef = job.BuilderDigest
+		}
+
+		digest, err := ImageDigest(jobCtx, runtime, pinRef)
+		if err != nil {
+			w.handleFailure(job, fmt.Sprintf("Builder image %s is not available (build it via POST /v1/builder-images): %v",
+				pinRef, err), "")
+			w.cleanup(workspacePath)
+			return
+		}
+
+		if err := w.manager.buildJobRepo.SetBuilderImage(job.ID, buildEnv.ContainerImage, digest); err != nil {
+			log.Warn("Failed to record builder image", "build_id", job.ID, "error", err)
+		}
+		if err := w.manager.buildJobRepo.AppendLog(job.ID, "", "info",
+			fmt.Sprintf("Using builder image %s (%s)", buildEnv.ContainerImage, digest)); err != nil {
+			log.Warn("Failed to append build log", "build_id", job.ID, "error", err)
+		}
+
+		run.BuilderImage = buildEnv.ContainerImage
+		run.BuilderDigest = digest
+		buildEnv.ContainerImage = digest
+		containerImage = digest
+	}
+
+	executor, err := NewExecutor(runtime, containerImage, nil)
 	if err != nil {
 		w.handleFailure(job, fmt.Sprintf("Failed to create build executor: %v", err), "")
+		w.cleanup(workspacePath)
 		return
 	}
 
 	log.Info("Build executor created from live config",
-		"runtime", execRuntime,
+		"runtime", runtime,
 		"image", containerImage,
 		"build_id", job.ID,
 	)
@@ -176,6 +197,7 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 		BuildID:        job.ID,
 		DistributionID: job.DistributionID,
 		OwnerID:        job.OwnerID,
+		VerifyOf:       job.VerifyOf,
 		Config:         &config,
 		TargetArch:     job.TargetArch,
 		ImageFormat:    job.ImageFormat,
@@ -186,6 +208,81 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 		ConfigDir:      configDir,
 		BuildEnv:       buildEnv,
 		Executor:       executor,
+		Signer:         w.manager.signer,
+		Registry: RegistryCredentials{
+			Username: w.manager.config.RegistryUsername,
+			Password: w.manager.config.RegistryPassword,
+		},
+		PublicURL: w.manager.config.PublicURL,
+	}
+
+	if dist, err := w.manager.distRepo.GetByID(job.DistributionID); err != nil {
+		log.Warn("Failed to load distribution", "distribution_id", job.DistributionID, "error", err)
+	} else if dist != nil {
+		sc.DistName = dist.Name
+		sc.DistVersion = dist.Version
+	}
+
+	if config.Build.Reproducible {
+		sc.SourceDateEpoch = SourceDateEpoch(&config)
+		if err := w.manager.buildJobRepo.AppendLog(job.ID, "", "info",
+			fmt.Sprintf("Reproducible build enabled (SOURCE_DATE_EPOCH=%d)", sc.SourceDateEpoch)); err != nil {
+			log.Warn("Failed to append build log", "build_id", job.ID, "error", err)
+		}
+	}
+
+	// Secure Boot keys are decrypted into the workspace only for the
+	// lifetime of the build
+	if config.Security.SecureBoot.Enabled {
+		if w.manager.secureBoot == nil {
+			w.handleFailure(job, "Secure Boot signing requested but no key store is configured", "")
+			w.cleanup(workspacePath)
+			return
+		}
+		keys, err := w.manager.secureBoot.Materialize(config.Security.SecureBoot.KeySetID,
+			filepath.Join(workspacePath, SecureBootDir))
+		if err != nil {
+			w.handleFailure(job, fmt.Sprintf("Failed to load Secure Boot keys: %v", err), "")
+			w.cleanup(workspacePath)
+			return
+		}
+		defer func() {
+			if err := os.RemoveAll(keys.Dir); err != nil {
+				log.Warn("Failed to remove Secure Boot keys", "build_id", job.ID, "error", err)
+			}
+		}()
+		sc.SecureBoot = keys
+		if err := w.manager.buildJobRepo.AppendLog(job.ID, "", "info",
+			fmt.Sprintf("Secure Boot signing enabled (key set %s)", keys.KeySetID)); err != nil {
+			log.Warn("Failed to append build log", "build_id", job.ID, "error", err)
+		}
+	}
+
+	// Encrypted roots get a fresh key per build; only its key file is
+	// written to the workspace
+	if config.Security.Encryption.Enabled {
+		if w.manager.diskKeys == nil {
+			w.handleFailure(job, "Root encryption requested but no key store is configured", "")
+			w.cleanup(workspacePath)
+			return
+		}
+		key, err := w.manager.diskKeys.CreateDiskKey(job.ID, job.DistributionID,
+			filepath.Join(workspacePath, DiskKeyDir))
+		if err != nil {
+			w.handleFailure(job, fmt.Sprintf("Failed to create disk encryption key: %v", err), "")
+			w.cleanup(workspacePath)
+			return
+		}
+		defer func() {
+			if err := os.RemoveAll(key.Dir); err != nil {
+				log.Warn("Failed to remove disk encryption key", "build_id", job.ID, "error", err)
+			}
+		}()
+		sc.DiskKey = key
+		if err := w.manager.buildJobRepo.AppendLog(job.ID, "", "info",
+			fmt.Sprintf("Root encryption enabled (LUKS UUID %s)", key.LUKSUUID)); err != nil {
+			log.Warn("Failed to append build log", "build_id", job.ID, "error", err)
+		}
 	}
 
 	// Create stage records in database
@@ -275,6 +372,7 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 
 		// Mark stage as completed
 		durationMs := time.Since(stageStart).Milliseconds()
+		run.Stages = append(run.Stages, StageTiming{Stage: stageName, StartedAt: stageStart, DurationMs: durationMs})
 		if err := w.manager.buildJobRepo.MarkStageCompleted(job.ID, stageName, durationMs); err != nil {
 			log.Warn("Failed to mark stage completed", "build_id", job.ID, "stage", stageName, "error", err)
 		}
@@ -285,6 +383,26 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 		}
 	}
 
+	// Sign provenance before the build is reported as completed so clients
+	// never see a finished build without its attestation. As with artifact
+	// signing, a configured signer that fails fails the build. Verification
+	// rebuilds publish nothing to attest.
+	if w.manager.signer != nil && job.VerifyOf == "" {
+		run.FinishedAt = time.Now()
+		if err := w.publishProvenance(jobCtx, job, sc, run); err != nil {
+			// The image, SBOMs and signatures are already published; a build
+			// without its attestation must not stay available as a release
+			if sc.ArtifactPath != "" {
+				if _, werr := WithdrawArtifacts(jobCtx, w.manager.storage, path.Dir(sc.ArtifactPath)); werr != nil {
+					log.Warn("Failed to withdraw published artifacts", "build_id", job.ID, "error", werr)
+				}
+			}
+			w.handleFailure(job, fmt.Sprintf("Failed to publish build provenance: %v", err), string(db.StagePackage))
+			w.cleanup(workspacePath)
+			return
+		}
+	}
+
 	// Build completed successfully
 	log.Info("Build completed successfully",
 		"worker_id", w.id,
@@ -298,9 +416,26 @@ func (w *Worker) processJob(ctx context.Context, job *db.BuildJob) {
 		log.Error("Failed to mark build completed", "build_id", job.ID, "error", err)
 	}
 
+	// Record the update bundle so devices can discover it. Verification
+	// rebuilds reproduce a bundle that is already recorded.
+	if sc.UpdateBundle != nil && job.VerifyOf == "" {
+		sc.UpdateBundle.BuildID = job.ID
+		sc.UpdateBundle.DistributionID = job.DistributionID
+		sc.UpdateBundle.TargetArch = job.TargetArch
+		if err := w.manager.updateBundleRepo.Create(sc.UpdateBundle); err != nil {
+			log.Error("Failed to record update bundle", "build_id", job.ID, "error", err)
+		}
+	}
+
+	if job.VerifyOf != "" {
+		w.verifyReproducible(jobCtx, job, sc)
+	}
+
 	// Update distribution status to ready
-	if err := w.manager.distRepo.UpdateStatus(job.DistributionID, db.StatusReady, ""); err != nil {
-		log.Warn("Failed to update distribution status to ready", "distribution_id", job.DistributionID, "error", err)
+	if job.VerifyOf == "" {
+		if err := w.manager.distRepo.UpdateStatus(job.DistributionID, db.StatusReady, ""); err != nil {
+			log.Warn("Failed to update distribution status to ready", "distribution_id", job.DistributionID, "error", err)
+		}
 	}
 
 	if err := w.manager.buildJobRepo.AppendLog(job.ID, "", "info",
@@ -333,8 +468,10 @@ func (w *Worker) handleFailure(job *db.BuildJob, errorMsg, errorStage string) {
 	}
 
 	// Update distribution status to failed
-	if err := w.manager.distRepo.UpdateStatus(job.DistributionID, db.StatusFailed, errorMsg); err != nil {
-		log.Warn("Failed to update distribution status to failed", "distribution_id", job.DistributionID, "error", err)
+	if job.VerifyOf == "" {
+		if err := w.manager.distRepo.UpdateStatus(job.DistributionID, db.StatusFailed, errorMsg); err != nil {
+			log.Warn("Failed to update distribution status to failed", "distribution_id", job.DistributionID, "error", err)
+		}
 	}
 }
 
@@ -15,10 +15,13 @@ import (
 	"github.com/bitswalk/ldf/src/ldfd/build/stages"
 	"github.com/bitswalk/ldf/src/ldfd/db"
 	"github.com/bitswalk/ldf/src/ldfd/db/migrations"
+	"github.com/bitswalk/ldf/src/ldfd/diskenc"
 	_ "github.com/bitswalk/ldf/src/ldfd/docs"
 	"github.com/bitswalk/ldf/src/ldfd/download"
 	"github.com/bitswalk/ldf/src/ldfd/forge"
+	"github.com/bitswalk/ldf/src/ldfd/secureboot"
 	"github.com/bitswalk/ldf/src/ldfd/security"
+	"github.com/bitswalk/ldf/src/ldfd/signing"
 	"github.com/bitswalk/ldf/src/ldfd/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
@@ -130,7 +133,25 @@ func NewServer(database *db.Database, storageBackend storage.Backend, secretMgr
 	if image := viper.GetString("build.container_image"); image != "" {
 		buildCfg.ContainerImage = image
 	}
+	buildCfg.RegistryUsername = viper.GetString("build.registry.username")
+	buildCfg.RegistryPassword = viper.GetString("build.registry.password")
+	buildCfg.PublicURL = viper.GetString("server.public_url")
+	buildCfg.Version = VersionInfo.Version
 	buildManager := build.NewManager(database, storageBackend, downloadManager, buildCfg)
+
+	// Attestation, Secure Boot and disk encryption keys are encrypted by the secret manager,
+	// so signing is only available when one was initialized
+	var signingService *signing.Service
+	var secureBootService *secureboot.Service
+	var diskKeyService *diskenc.Service
+	if secretMgr != nil {
+		signingService = signing.NewService(db.NewSigningKeyRepository(database), secretMgr)
+		buildManager.SetSigner(signingService)
+		secureBootService = secureboot.NewService(db.NewSecureBootKeyRepository(database), secretMgr)
+		buildManager.SetSecureBootProvider(secureBootService)
+		diskKeyService = diskenc.NewService(db.NewDiskEncryptionKeyRepository(database), secretMgr)
+		buildManager.SetDiskKeyProvider(diskKeyService)
+	}
 	buildManager.RegisterStages(stages.DefaultStages(
 		buildManager.ComponentRepo(),
 		buildManager.DownloadJobRepo(),
@@ -173,6 +194,9 @@ func NewServer(database *db.Database, storageBackend storage.Backend, secretMgr
 		BuildManager:         buildManager,
 		VersionDiscovery:     versionDiscovery,
 		ForgeRegistry:        forgeRegistry,
+		SigningService:       signingService,
+		SecureBootService:    secureBootService,
+		DiskKeyService:       diskKeyService,
 	})
 
 	// Register all routes
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/bitswalk/ldf/src/common/paths"
+)
+
+// MaxBoardProfileDepth bounds board profile inheritance chains
+const MaxBoardProfileDepth = 8
+
+// BoardProfileFilesPrefix returns the storage prefix of the files attached
+// to a board profile, such as firmware blobs and device tree overlays
+func BoardProfileFilesPrefix(profileID string) string {
+	return fmt.Sprintf("board-profiles/%s/files/", profileID)
+}
+
+// BoardProfileFileKey returns the storage key of a file attached to a
+// board profile
+func BoardProfileFileKey(profileID, filePath string) string {
+	return BoardProfileFilesPrefix(profileID) + filePath
+}
+
+// CleanBoardProfileFilePath normalizes the path of a file attached to a
+// board profile, rejecting absolute paths and paths leaving the profile
+func CleanBoardProfileFilePath(filePath string) (string, error) {
+	cleaned, err := paths.CleanRelative(filePath)
+	if err != nil {
+		return "", fmt.Errorf("invalid board profile file path %q", filePath)
+	}
+	return cleaned, nil
+}
+
+// ResolveBoardProfile returns the first profile of chain, a profile
+// followed by its ancestors nearest first, with the ancestors'
+// configuration merged under its own
+func ResolveBoardProfile(chain []BoardProfile) *BoardProfile {
+	if len(chain) == 0 {
+		return nil
+	}
+	resolved := chain[0]
+	config := chain[len(chain)-1].Config
+	for i := len(chain) - 2; i >= 0; i-- {
+		config = MergeBoardConfig(config, chain[i].Config)
+	}
+	resolved.Config = config
+	return &resolved
+}
+
+// MergeBoardConfig deep-merges a child board configuration over its
+// parent's. Device trees merge by source, adding the child's overlays;
+// firmware merges by name with the child's entry winning; kernel overlay
+// options and boot parameter maps merge key by key; linux-firmware
+// selections add up. Scalar settings and U-Boot images the child sets
+// replace the parent's.
+func MergeBoardConfig(parent, child BoardConfig) BoardConfig {
+	merged := BoardConfig{
+		KernelDefconfig: overrideString(parent.KernelDefconfig, child.KernelDefconfig),
+		KernelCmdline:   overrideString(parent.KernelCmdline, child.KernelCmdline),
+		ImageLayout:     BoardImageLayout(overrideString(string(parent.ImageLayout), string(child.ImageLayout))),
+		KernelOverlay:   mergeStringMaps(parent.KernelOverlay, child.KernelOverlay),
+		LinuxFirmware:   MergeFirmwareSelection(parent.LinuxFirmware, child.LinuxFirmware),
+	}
+
+	for _, dt := range parent.DeviceTrees {
+		merged.DeviceTrees = append(merged.DeviceTrees, DeviceTreeSpec{
+			Source:   dt.Source,
+			Overlays: append([]string(nil), dt.Overlays...),
+		})
+	}
+	for _, dt := range child.DeviceTrees {
+		found := false
+		for i := range merged.DeviceTrees {
+			if merged.DeviceTrees[i].Source == dt.Source {
+				for _, overlay := range dt.Overlays {
+					if !containsString(merged.DeviceTrees[i].Overlays, overlay) {
+						merged.DeviceTrees[i].Overlays = append(merged.DeviceTrees[i].Overlays, overlay)
+					}
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.DeviceTrees = append(merged.DeviceTrees, dt)
+		}
+	}
+
+	merged.Firmware = append(merged.Firmware, parent.Firmware...)
+	for _, fw := range child.Firmware {
+		found := false
+		for i := range merged.Firmware {
+			if merged.Firmware[i].Name == fw.Name {
+				merged.Firmware[i] = fw
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Firmware = append(merged.Firmware, fw)
+		}
+	}
+
+	merged.BootParams = BoardBootParams{
+		BootloaderOverride: overrideString(parent.BootParams.BootloaderOverride, child.BootParams.BootloaderOverride),
+		UBootBoard:         overrideString(parent.BootParams.UBootBoard, child.BootParams.UBootBoard),
+		UBootImages:        parent.BootParams.UBootImages,
+		UBootMakeVars:      mergeStringMaps(parent.BootParams.UBootMakeVars, child.BootParams.UBootMakeVars),
+		ExtraFiles:         mergeStringMaps(parent.BootParams.ExtraFiles, child.BootParams.ExtraFiles),
+		ConfigTxt:          overrideString(parent.BootParams.ConfigTxt, child.BootParams.ConfigTxt),
+		KernelImage:        overrideString(parent.BootParams.KernelImage, child.BootParams.KernelImage),
+	}
+	if len(child.BootParams.UBootImages) > 0 {
+		merged.BootParams.UBootImages = child.BootParams.UBootImages
+	}
+
+	return merged
+}
+
+// MergeFirmwareSelection returns the union of two firmware selections
+func MergeFirmwareSelection(a, b FirmwareSelection) FirmwareSelection {
+	return FirmwareSelection{
+		Drivers: unionStrings(a.Drivers, b.Drivers),
+		Modules: unionStrings(a.Modules, b.Modules),
+		Files:   unionStrings(a.Files, b.Files),
+	}
+}
+
+// unionStrings appends the entries of b missing from a
+func unionStrings(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, s := range b {
+		if !containsString(merged, s) {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// overrideString returns child when set, parent otherwise
+func overrideString(parent, child string) string {
+	if child != "" {
+		return child
+	}
+	return parent
+}
+
+// mergeStringMaps returns the union of two maps, child values winning
+func mergeStringMaps(parent, child map[string]string) map[string]string {
+	if len(parent) == 0 && len(child) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(parent)+len(child))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range child {
+		merged[k] = v
+	}
+	return merged
+}
+
+// containsString reports whether list includes s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
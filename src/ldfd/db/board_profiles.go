@@ -22,7 +22,7 @@ func NewBoardProfileRepository(db *Database) *BoardProfileRepository {
 // List retrieves all board profiles ordered by name
 func (r *BoardProfileRepository) List() ([]BoardProfile, error) {
 	query := `
-		SELECT id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
 		FROM board_profiles
 		ORDER BY name ASC
 	`
@@ -38,7 +38,7 @@ func (r *BoardProfileRepository) List() ([]BoardProfile, error) {
 // ListSystem retrieves all system board profiles
 func (r *BoardProfileRepository) ListSystem() ([]BoardProfile, error) {
 	query := `
-		SELECT id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
 		FROM board_profiles
 		WHERE is_system = 1
 		ORDER BY name ASC
@@ -55,7 +55,7 @@ func (r *BoardProfileRepository) ListSystem() ([]BoardProfile, error) {
 // ListByArch retrieves all board profiles for a specific architecture
 func (r *BoardProfileRepository) ListByArch(arch TargetArch) ([]BoardProfile, error) {
 	query := `
-		SELECT id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
 		FROM board_profiles
 		WHERE arch = ?
 		ORDER BY name ASC
@@ -72,7 +72,7 @@ func (r *BoardProfileRepository) ListByArch(arch TargetArch) ([]BoardProfile, er
 // ListByOwner retrieves all board profiles for a specific owner
 func (r *BoardProfileRepository) ListByOwner(ownerID string) ([]BoardProfile, error) {
 	query := `
-		SELECT id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
 		FROM board_profiles
 		WHERE is_system = 0 AND owner_id = ?
 		ORDER BY name ASC
@@ -89,7 +89,7 @@ func (r *BoardProfileRepository) ListByOwner(ownerID string) ([]BoardProfile, er
 // GetByID retrieves a board profile by ID
 func (r *BoardProfileRepository) GetByID(id string) (*BoardProfile, error) {
 	query := `
-		SELECT id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
 		FROM board_profiles
 		WHERE id = ?
 	`
@@ -109,7 +109,7 @@ func (r *BoardProfileRepository) GetByID(id string) (*BoardProfile, error) {
 // GetByName retrieves a board profile by unique name
 func (r *BoardProfileRepository) GetByName(name string) (*BoardProfile, error) {
 	query := `
-		SELECT id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
 		FROM board_profiles
 		WHERE name = ?
 	`
@@ -126,6 +126,64 @@ func (r *BoardProfileRepository) GetByName(name string) (*BoardProfile, error) {
 	return bp, nil
 }
 
+// ListChildren retrieves the board profiles extending the given profile
+func (r *BoardProfileRepository) ListChildren(parentID string) ([]BoardProfile, error) {
+	query := `
+		SELECT id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at
+		FROM board_profiles
+		WHERE parent_id = ?
+		ORDER BY name ASC
+	`
+	rows, err := r.db.DB().Query(query, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list child board profiles: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanProfiles(rows)
+}
+
+// GetChain retrieves a board profile followed by its ancestors, nearest
+// parent first. It returns nil when the profile does not exist, and an
+// error when a parent is missing or the chain loops.
+func (r *BoardProfileRepository) GetChain(id string) ([]BoardProfile, error) {
+	var chain []BoardProfile
+	seen := make(map[string]bool)
+	for id != "" {
+		if seen[id] {
+			return nil, fmt.Errorf("board profile inheritance loops at %s", id)
+		}
+		if len(chain) == MaxBoardProfileDepth {
+			return nil, fmt.Errorf("board profile inheritance deeper than %d levels", MaxBoardProfileDepth)
+		}
+		seen[id] = true
+
+		bp, err := r.GetByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if bp == nil {
+			if len(chain) == 0 {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("parent board profile not found: %s", id)
+		}
+		chain = append(chain, *bp)
+		id = bp.ParentID
+	}
+	return chain, nil
+}
+
+// Resolve retrieves a board profile with the configuration of its
+// ancestors merged in, or nil when it does not exist
+func (r *BoardProfileRepository) Resolve(id string) (*BoardProfile, error) {
+	chain, err := r.GetChain(id)
+	if err != nil || chain == nil {
+		return nil, err
+	}
+	return ResolveBoardProfile(chain), nil
+}
+
 // Create inserts a new board profile
 func (r *BoardProfileRepository) Create(bp *BoardProfile) error {
 	if bp.ID == "" {
@@ -142,11 +200,11 @@ func (r *BoardProfileRepository) Create(bp *BoardProfile) error {
 	}
 
 	query := `
-		INSERT INTO board_profiles (id, name, display_name, description, arch, config, is_system, owner_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO board_profiles (id, name, display_name, description, arch, config, is_system, owner_id, parent_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	_, err = r.db.DB().Exec(query, bp.ID, bp.Name, bp.DisplayName, bp.Description,
-		string(bp.Arch), string(configJSON), bp.IsSystem, nullString(bp.OwnerID), bp.CreatedAt, bp.UpdatedAt)
+		string(bp.Arch), string(configJSON), bp.IsSystem, nullString(bp.OwnerID), bp.ParentID, bp.CreatedAt, bp.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create board profile: %w", err)
 	}
@@ -165,11 +223,11 @@ func (r *BoardProfileRepository) Update(bp *BoardProfile) error {
 
 	query := `
 		UPDATE board_profiles
-		SET name = ?, display_name = ?, description = ?, config = ?, updated_at = ?
+		SET name = ?, display_name = ?, description = ?, parent_id = ?, config = ?, updated_at = ?
 		WHERE id = ?
 	`
 	result, err := r.db.DB().Exec(query, bp.Name, bp.DisplayName, bp.Description,
-		string(configJSON), bp.UpdatedAt, bp.ID)
+		bp.ParentID, string(configJSON), bp.UpdatedAt, bp.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update board profile: %w", err)
 	}
@@ -208,14 +266,15 @@ func (r *BoardProfileRepository) scanProfiles(rows *sql.Rows) ([]BoardProfile, e
 	var profiles []BoardProfile
 	for rows.Next() {
 		var bp BoardProfile
-		var configJSON, ownerID sql.NullString
+		var configJSON, ownerID, parentID sql.NullString
 		var arch string
 		if err := rows.Scan(&bp.ID, &bp.Name, &bp.DisplayName, &bp.Description, &arch,
-			&configJSON, &bp.IsSystem, &ownerID, &bp.CreatedAt, &bp.UpdatedAt); err != nil {
+			&configJSON, &bp.IsSystem, &ownerID, &parentID, &bp.CreatedAt, &bp.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan board profile: %w", err)
 		}
 		bp.Arch = TargetArch(arch)
 		bp.OwnerID = ownerID.String
+		bp.ParentID = parentID.String
 		if configJSON.Valid && configJSON.String != "" {
 			if err := json.Unmarshal([]byte(configJSON.String), &bp.Config); err != nil {
 				return nil, fmt.Errorf("failed to deserialize board config: %w", err)
@@ -234,15 +293,16 @@ func (r *BoardProfileRepository) scanProfiles(rows *sql.Rows) ([]BoardProfile, e
 // scanProfile scans a single board profile row
 func (r *BoardProfileRepository) scanProfile(row *sql.Row) (*BoardProfile, error) {
 	var bp BoardProfile
-	var configJSON, ownerID sql.NullString
+	var configJSON, ownerID, parentID sql.NullString
 	var arch string
 	err := row.Scan(&bp.ID, &bp.Name, &bp.DisplayName, &bp.Description, &arch,
-		&configJSON, &bp.IsSystem, &ownerID, &bp.CreatedAt, &bp.UpdatedAt)
+		&configJSON, &bp.IsSystem, &ownerID, &parentID, &bp.CreatedAt, &bp.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	bp.Arch = TargetArch(arch)
 	bp.OwnerID = ownerID.String
+	bp.ParentID = parentID.String
 	if configJSON.Valid && configJSON.String != "" {
 		if err := json.Unmarshal([]byte(configJSON.String), &bp.Config); err != nil {
 			return nil, fmt.Errorf("failed to deserialize board config: %w", err)
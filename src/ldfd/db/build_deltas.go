@@ -0,0 +1,167 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BuildDeltaRepository handles binary delta database operations
+type BuildDeltaRepository struct {
+	db *Database
+}
+
+// NewBuildDeltaRepository creates a new build delta repository
+func NewBuildDeltaRepository(db *Database) *BuildDeltaRepository {
+	return &BuildDeltaRepository{db: db}
+}
+
+// selectBuildDeltasQuery is the base SELECT query for build deltas
+const selectBuildDeltasQuery = `
+	SELECT id, distribution_id, source_build_id, target_build_id, status,
+		artifact_path, checksum, size_bytes, source_checksum, target_checksum,
+		error_message, created_at, completed_at
+	FROM build_deltas
+`
+
+// Create inserts a new pending build delta
+func (r *BuildDeltaRepository) Create(delta *BuildDelta) error {
+	if delta.ID == "" {
+		delta.ID = uuid.New().String()
+	}
+	if delta.Status == "" {
+		delta.Status = DeltaStatusPending
+	}
+	delta.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO build_deltas (id, distribution_id, source_build_id, target_build_id, status,
+			source_checksum, target_checksum, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.DB().Exec(query, delta.ID, delta.DistributionID, delta.SourceBuildID,
+		delta.TargetBuildID, delta.Status, delta.SourceChecksum, delta.TargetChecksum, delta.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create build delta: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a build delta by ID
+func (r *BuildDeltaRepository) GetByID(id string) (*BuildDelta, error) {
+	row := r.db.DB().QueryRow(selectBuildDeltasQuery+` WHERE id = ?`, id)
+	return r.scanDelta(row)
+}
+
+// GetByBuilds retrieves the delta from one build to another
+func (r *BuildDeltaRepository) GetByBuilds(sourceBuildID, targetBuildID string) (*BuildDelta, error) {
+	row := r.db.DB().QueryRow(selectBuildDeltasQuery+` WHERE source_build_id = ? AND target_build_id = ?`,
+		sourceBuildID, targetBuildID)
+	return r.scanDelta(row)
+}
+
+// ListByDistribution retrieves the deltas of a distribution, newest first
+func (r *BuildDeltaRepository) ListByDistribution(distributionID string) ([]BuildDelta, error) {
+	rows, err := r.db.DB().Query(selectBuildDeltasQuery+` WHERE distribution_id = ? ORDER BY created_at DESC`, distributionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list build deltas: %w", err)
+	}
+	defer rows.Close()
+
+	var deltas []BuildDelta
+	for rows.Next() {
+		delta, err := r.scanDelta(rows)
+		if err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, *delta)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating build deltas: %w", err)
+	}
+
+	return deltas, nil
+}
+
+// Reset returns a failed delta to pending so it can be computed again
+func (r *BuildDeltaRepository) Reset(id string) error {
+	query := `
+		UPDATE build_deltas
+		SET status = ?, error_message = '', completed_at = NULL
+		WHERE id = ?
+	`
+	return r.update(query, "reset build delta", id, DeltaStatusPending, id)
+}
+
+// MarkRunning marks a build delta as being computed
+func (r *BuildDeltaRepository) MarkRunning(id string) error {
+	query := `UPDATE build_deltas SET status = ? WHERE id = ?`
+	return r.update(query, "mark build delta running", id, DeltaStatusRunning, id)
+}
+
+// MarkCompleted records the stored delta artifact
+func (r *BuildDeltaRepository) MarkCompleted(id, artifactPath, checksum string, size int64) error {
+	query := `
+		UPDATE build_deltas
+		SET status = ?, artifact_path = ?, checksum = ?, size_bytes = ?,
+			error_message = '', completed_at = ?
+		WHERE id = ?
+	`
+	return r.update(query, "mark build delta completed", id,
+		DeltaStatusCompleted, artifactPath, checksum, size, time.Now(), id)
+}
+
+// MarkFailed marks a build delta as failed
+func (r *BuildDeltaRepository) MarkFailed(id, errorMsg string) error {
+	query := `UPDATE build_deltas SET status = ?, error_message = ?, completed_at = ? WHERE id = ?`
+	return r.update(query, "mark build delta failed", id, DeltaStatusFailed, errorMsg, time.Now(), id)
+}
+
+// update runs a single-row UPDATE and reports a missing delta
+func (r *BuildDeltaRepository) update(query, action, id string, args ...interface{}) error {
+	result, err := r.db.DB().Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("build delta not found: %s", id)
+	}
+
+	return nil
+}
+
+func (r *BuildDeltaRepository) scanDelta(s scanner) (*BuildDelta, error) {
+	var delta BuildDelta
+	var completedAt sql.NullTime
+	var artifactPath, checksum, sourceChecksum, targetChecksum, errorMsg sql.NullString
+
+	err := s.Scan(&delta.ID, &delta.DistributionID, &delta.SourceBuildID, &delta.TargetBuildID,
+		&delta.Status, &artifactPath, &checksum, &delta.SizeBytes, &sourceChecksum,
+		&targetChecksum, &errorMsg, &delta.CreatedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan build delta: %w", err)
+	}
+
+	if completedAt.Valid {
+		delta.CompletedAt = &completedAt.Time
+	}
+	delta.ArtifactPath = artifactPath.String
+	delta.Checksum = checksum.String
+	delta.SourceChecksum = sourceChecksum.String
+	delta.TargetChecksum = targetChecksum.String
+	delta.ErrorMessage = errorMsg.String
+
+	return &delta, nil
+}
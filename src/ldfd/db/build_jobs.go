@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -43,15 +44,17 @@ func (r *BuildJobRepository) Create(job *BuildJob) error {
 			target_arch, image_format, progress_percent, workspace_path,
 			artifact_path, artifact_checksum, artifact_size,
 			error_message, error_stage, retry_count, max_retries,
-			clear_cache, config_snapshot, created_at, started_at, completed_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			clear_cache, config_snapshot, builder_image, builder_image_digest,
+			verify_of, created_at, started_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	_, err := r.db.DB().Exec(query,
 		job.ID, job.DistributionID, job.OwnerID, job.Status, job.CurrentStage,
 		job.TargetArch, job.ImageFormat, job.ProgressPercent, job.WorkspacePath,
 		job.ArtifactPath, job.ArtifactChecksum, job.ArtifactSize,
 		job.ErrorMessage, job.ErrorStage, job.RetryCount, job.MaxRetries,
-		job.ClearCache, job.ConfigSnapshot, job.CreatedAt, job.StartedAt, job.CompletedAt,
+		job.ClearCache, job.ConfigSnapshot, job.BuilderImage, job.BuilderDigest,
+		job.VerifyOf, job.CreatedAt, job.StartedAt, job.CompletedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create build job: %w", err)
@@ -66,7 +69,9 @@ const selectBuildJobsQuery = `
 		target_arch, image_format, progress_percent, workspace_path,
 		artifact_path, artifact_checksum, artifact_size,
 		error_message, error_stage, retry_count, max_retries,
-		clear_cache, config_snapshot, created_at, started_at, completed_at
+		clear_cache, config_snapshot, builder_image, builder_image_digest,
+		verify_of, verify_result, verify_diff,
+		created_at, started_at, completed_at
 	FROM build_jobs
 `
 
@@ -120,10 +125,11 @@ func (r *BuildJobRepository) ListPending() ([]BuildJob, error) {
 
 // ListActive retrieves all active build jobs
 func (r *BuildJobRepository) ListActive() ([]BuildJob, error) {
-	query := selectBuildJobsQuery + ` WHERE status IN (?, ?, ?, ?, ?, ?) ORDER BY created_at ASC`
+	query := selectBuildJobsQuery + ` WHERE status IN (?, ?, ?, ?, ?, ?, ?) ORDER BY created_at ASC`
 	rows, err := r.db.DB().Query(query,
 		BuildStatusPending, BuildStatusResolving, BuildStatusPreparing,
 		BuildStatusCompiling, BuildStatusAssembling, BuildStatusPackaging,
+		BuildStatusTesting,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list active build jobs: %w", err)
@@ -180,6 +186,49 @@ func (r *BuildJobRepository) MarkStarted(id string) error {
 	return nil
 }
 
+// SetBuilderImage records the builder image and digest a build job is pinned to
+func (r *BuildJobRepository) SetBuilderImage(id, image, digest string) error {
+	query := `UPDATE build_jobs SET builder_image = ?, builder_image_digest = ? WHERE id = ?`
+	result, err := r.db.DB().Exec(query, image, digest, id)
+	if err != nil {
+		return fmt.Errorf("failed to set builder image: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("build job not found: %s", id)
+	}
+
+	return nil
+}
+
+// SetVerifyResult records the outcome of a reproducibility verification
+func (r *BuildJobRepository) SetVerifyResult(id, result string, diff []string) error {
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("failed to encode verify diff: %w", err)
+	}
+
+	query := `UPDATE build_jobs SET verify_result = ?, verify_diff = ? WHERE id = ?`
+	res, err := r.db.DB().Exec(query, result, string(diffJSON), id)
+	if err != nil {
+		return fmt.Errorf("failed to set verify result: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("build job not found: %s", id)
+	}
+
+	return nil
+}
+
 // UpdateStage updates the current stage and progress of a build job
 func (r *BuildJobRepository) UpdateStage(id string, stage string, progressPercent int) error {
 	query := `UPDATE build_jobs SET current_stage = ?, progress_percent = ?, status = ? WHERE id = ?`
@@ -197,6 +246,8 @@ func (r *BuildJobRepository) UpdateStage(id string, stage string, progressPercen
 		status = BuildStatusAssembling
 	case StagePackage:
 		status = BuildStatusPackaging
+	case StageTest:
+		status = BuildStatusTesting
 	}
 
 	result, err := r.db.DB().Exec(query, stage, progressPercent, status, id)
@@ -494,13 +545,17 @@ func (r *BuildJobRepository) scanJob(row *sql.Row) (*BuildJob, error) {
 	var startedAt, completedAt sql.NullTime
 	var workspacePath, artifactPath, artifactChecksum sql.NullString
 	var errorMsg, errorStage, configSnapshot, currentStage sql.NullString
+	var builderImage, builderDigest sql.NullString
+	var verifyOf, verifyResult, verifyDiff sql.NullString
 
 	err := row.Scan(
 		&job.ID, &job.DistributionID, &job.OwnerID, &job.Status, &currentStage,
 		&job.TargetArch, &job.ImageFormat, &job.ProgressPercent, &workspacePath,
 		&artifactPath, &artifactChecksum, &job.ArtifactSize,
 		&errorMsg, &errorStage, &job.RetryCount, &job.MaxRetries,
-		&job.ClearCache, &configSnapshot, &job.CreatedAt, &startedAt, &completedAt,
+		&job.ClearCache, &configSnapshot, &builderImage, &builderDigest,
+		&verifyOf, &verifyResult, &verifyDiff,
+		&job.CreatedAt, &startedAt, &completedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -522,6 +577,13 @@ func (r *BuildJobRepository) scanJob(row *sql.Row) (*BuildJob, error) {
 	job.ErrorMessage = errorMsg.String
 	job.ErrorStage = errorStage.String
 	job.ConfigSnapshot = configSnapshot.String
+	job.BuilderImage = builderImage.String
+	job.BuilderDigest = builderDigest.String
+	job.VerifyOf = verifyOf.String
+	job.VerifyResult = verifyResult.String
+	if verifyDiff.Valid && verifyDiff.String != "" {
+		_ = json.Unmarshal([]byte(verifyDiff.String), &job.VerifyDiff)
+	}
 
 	return &job, nil
 }
@@ -535,13 +597,17 @@ func (r *BuildJobRepository) scanJobs(rows *sql.Rows) ([]BuildJob, error) {
 		var startedAt, completedAt sql.NullTime
 		var workspacePath, artifactPath, artifactChecksum sql.NullString
 		var errorMsg, errorStage, configSnapshot, currentStage sql.NullString
+		var builderImage, builderDigest sql.NullString
+		var verifyOf, verifyResult, verifyDiff sql.NullString
 
 		if err := rows.Scan(
 			&job.ID, &job.DistributionID, &job.OwnerID, &job.Status, &currentStage,
 			&job.TargetArch, &job.ImageFormat, &job.ProgressPercent, &workspacePath,
 			&artifactPath, &artifactChecksum, &job.ArtifactSize,
 			&errorMsg, &errorStage, &job.RetryCount, &job.MaxRetries,
-			&job.ClearCache, &configSnapshot, &job.CreatedAt, &startedAt, &completedAt,
+			&job.ClearCache, &configSnapshot, &builderImage, &builderDigest,
+			&verifyOf, &verifyResult, &verifyDiff,
+			&job.CreatedAt, &startedAt, &completedAt,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan build job: %w", err)
 		}
@@ -559,6 +625,13 @@ func (r *BuildJobRepository) scanJobs(rows *sql.Rows) ([]BuildJob, error) {
 		job.ErrorMessage = errorMsg.String
 		job.ErrorStage = errorStage.String
 		job.ConfigSnapshot = configSnapshot.String
+		job.BuilderImage = builderImage.String
+		job.BuilderDigest = builderDigest.String
+		job.VerifyOf = verifyOf.String
+		job.VerifyResult = verifyResult.String
+		if verifyDiff.Valid && verifyDiff.String != "" {
+			_ = json.Unmarshal([]byte(verifyDiff.String), &job.VerifyDiff)
+		}
 
 		jobs = append(jobs, job)
 	}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DiskEncryptionKeyRepository handles LUKS2 recovery key database operations
+type DiskEncryptionKeyRepository struct {
+	db *Database
+}
+
+// NewDiskEncryptionKeyRepository creates a new disk encryption key repository
+func NewDiskEncryptionKeyRepository(db *Database) *DiskEncryptionKeyRepository {
+	return &DiskEncryptionKeyRepository{db: db}
+}
+
+// Create inserts the key of a build
+func (r *DiskEncryptionKeyRepository) Create(key *DiskEncryptionKey) error {
+	key.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO disk_encryption_keys (build_id, distribution_id, luks_uuid, recovery_key, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := r.db.DB().Exec(query, key.BuildID, key.DistributionID, key.LUKSUUID, key.RecoveryKey, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create disk encryption key: %w", err)
+	}
+
+	return nil
+}
+
+// GetByBuild retrieves the key a build formatted its root with
+func (r *DiskEncryptionKeyRepository) GetByBuild(buildID string) (*DiskEncryptionKey, error) {
+	row := r.db.DB().QueryRow(`
+		SELECT build_id, distribution_id, luks_uuid, recovery_key, created_at
+		FROM disk_encryption_keys WHERE build_id = ?
+	`, buildID)
+
+	var key DiskEncryptionKey
+	err := row.Scan(&key.BuildID, &key.DistributionID, &key.LUKSUUID, &key.RecoveryKey, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk encryption key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// DeleteByBuild removes the key of a build, e.g. when its build is retried
+func (r *DiskEncryptionKeyRepository) DeleteByBuild(buildID string) error {
+	if _, err := r.db.DB().Exec(`DELETE FROM disk_encryption_keys WHERE build_id = ?`, buildID); err != nil {
+		return fmt.Errorf("failed to delete disk encryption key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration021BuildBuilderImage() Migration {
+	return Migration{
+		Version:     21,
+		Description: "Add builder image columns to build_jobs table",
+		Up: func(tx *sql.Tx) error {
+			// Add builder_image column - image name resolved for the build
+			_, err := tx.Exec(`ALTER TABLE build_jobs ADD COLUMN builder_image TEXT`)
+			if err != nil {
+				return err
+			}
+
+			// Add builder_image_digest column - digest the build was pinned to
+			_, err = tx.Exec(`ALTER TABLE build_jobs ADD COLUMN builder_image_digest TEXT`)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
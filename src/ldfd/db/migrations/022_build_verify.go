@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration022BuildVerify() Migration {
+	return Migration{
+		Version:     22,
+		Description: "Add reproducibility verification columns to build_jobs table",
+		Up: func(tx *sql.Tx) error {
+			// Add verify_of column - build this job rebuilds for verification
+			_, err := tx.Exec(`ALTER TABLE build_jobs ADD COLUMN verify_of TEXT`)
+			if err != nil {
+				return err
+			}
+
+			// Add verify_result column - match or mismatch once completed
+			_, err = tx.Exec(`ALTER TABLE build_jobs ADD COLUMN verify_result TEXT`)
+			if err != nil {
+				return err
+			}
+
+			// Add verify_diff column - JSON list of differing rootfs paths
+			_, err = tx.Exec(`ALTER TABLE build_jobs ADD COLUMN verify_diff TEXT`)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
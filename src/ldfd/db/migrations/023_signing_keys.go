@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration023SigningKeys() Migration {
+	return Migration{
+		Version:     23,
+		Description: "Add signing_keys table for build attestations",
+		Up: func(tx *sql.Tx) error {
+			// Create signing_keys table - private_key holds SecretManager-encrypted material
+			_, err := tx.Exec(`
+				CREATE TABLE signing_keys (
+					id TEXT PRIMARY KEY,
+					name TEXT NOT NULL,
+					algorithm TEXT NOT NULL,
+					public_key TEXT NOT NULL,
+					private_key TEXT NOT NULL,
+					active INTEGER NOT NULL DEFAULT 0,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					retired_at DATETIME
+				)
+			`)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE INDEX idx_signing_keys_active ON signing_keys(active)`)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
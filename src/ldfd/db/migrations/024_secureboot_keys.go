@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration024SecureBootKeys() Migration {
+	return Migration{
+		Version:     24,
+		Description: "Add secureboot_keys table for UEFI Secure Boot key sets",
+		Up: func(tx *sql.Tx) error {
+			// Create secureboot_keys table - one row per PK/KEK/db hierarchy,
+			// *_key columns hold SecretManager-encrypted material
+			_, err := tx.Exec(`
+				CREATE TABLE secureboot_keys (
+					id TEXT PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					owner_guid TEXT NOT NULL,
+					pk_cert TEXT NOT NULL,
+					pk_key TEXT NOT NULL,
+					kek_cert TEXT NOT NULL,
+					kek_key TEXT NOT NULL,
+					db_cert TEXT NOT NULL,
+					db_key TEXT NOT NULL,
+					active INTEGER NOT NULL DEFAULT 0,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)
+			`)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE INDEX idx_secureboot_keys_active ON secureboot_keys(active)`)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
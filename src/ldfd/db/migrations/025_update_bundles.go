@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration025UpdateBundles() Migration {
+	return Migration{
+		Version:     25,
+		Description: "Add update_bundles table for OTA update bundles",
+		Up: func(tx *sql.Tx) error {
+			// One bundle per build; removed together with its build job
+			_, err := tx.Exec(`
+				CREATE TABLE update_bundles (
+					id TEXT PRIMARY KEY,
+					build_id TEXT NOT NULL UNIQUE,
+					distribution_id TEXT NOT NULL,
+					target_arch TEXT NOT NULL,
+					compatible TEXT NOT NULL,
+					version TEXT DEFAULT '',
+					artifact_path TEXT NOT NULL,
+					checksum TEXT NOT NULL,
+					size_bytes INTEGER DEFAULT 0,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (build_id) REFERENCES build_jobs(id) ON DELETE CASCADE
+				)
+			`)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE INDEX idx_update_bundles_distribution ON update_bundles(distribution_id, compatible)`)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration026BuildDeltas() Migration {
+	return Migration{
+		Version:     26,
+		Description: "Add build_deltas table for binary deltas between builds",
+		Up: func(tx *sql.Tx) error {
+			// One delta per build pair; removed when either build is deleted
+			_, err := tx.Exec(`
+				CREATE TABLE build_deltas (
+					id TEXT PRIMARY KEY,
+					distribution_id TEXT NOT NULL,
+					source_build_id TEXT NOT NULL,
+					target_build_id TEXT NOT NULL,
+					status TEXT NOT NULL DEFAULT 'pending',
+					artifact_path TEXT DEFAULT '',
+					checksum TEXT DEFAULT '',
+					size_bytes INTEGER DEFAULT 0,
+					source_checksum TEXT DEFAULT '',
+					target_checksum TEXT DEFAULT '',
+					error_message TEXT DEFAULT '',
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					completed_at DATETIME,
+					UNIQUE (source_build_id, target_build_id),
+					FOREIGN KEY (source_build_id) REFERENCES build_jobs(id) ON DELETE CASCADE,
+					FOREIGN KEY (target_build_id) REFERENCES build_jobs(id) ON DELETE CASCADE
+				)
+			`)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE INDEX idx_build_deltas_distribution ON build_deltas(distribution_id)`)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
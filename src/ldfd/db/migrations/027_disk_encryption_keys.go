@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration027DiskEncryptionKeys() Migration {
+	return Migration{
+		Version:     27,
+		Description: "Add disk_encryption_keys table for LUKS2 root recovery keys",
+		Up: func(tx *sql.Tx) error {
+			// One key per build; recovery_key holds SecretManager-encrypted material
+			_, err := tx.Exec(`
+				CREATE TABLE disk_encryption_keys (
+					build_id TEXT PRIMARY KEY,
+					distribution_id TEXT NOT NULL,
+					luks_uuid TEXT NOT NULL,
+					recovery_key TEXT NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (build_id) REFERENCES build_jobs(id) ON DELETE CASCADE
+				)
+			`)
+			return err
+		},
+	}
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+func migration028RPiImageLayout() Migration {
+	return Migration{
+		Version:     28,
+		Description: "Switch Raspberry Pi board profiles to the rpi image layout and seed rpi5",
+		Up: func(tx *sql.Tx) error {
+			// rpi4: the firmware boot partition replaces the ESP and the root
+			// is referenced by PARTUUID instead of /dev/mmcblk0p2
+			_, err := tx.Exec(`
+				UPDATE board_profiles SET config = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE name = 'rpi4' AND is_system = 1
+			`, `{"device_trees":[{"source":"arch/arm64/boot/dts/broadcom/bcm2711-rpi-4-b.dts","overlays":["arch/arm64/boot/dts/overlays/vc4-kms-v3d-pi4-overlay.dts"]}],"kernel_overlay":{"CONFIG_ARCH_BCM2835":"y","CONFIG_BCM2835_WDT":"y","CONFIG_DRM_VC4":"m","CONFIG_SND_BCM2835_SOC_I2S":"m","CONFIG_MMC_BCM2835":"y","CONFIG_SERIAL_8250_BCM2835AUX":"y","CONFIG_USB_DWC2":"m","CONFIG_USB_XHCI_PCI":"y","CONFIG_BRCMFMAC":"m","CONFIG_BT_HCIUART_BCM":"y","CONFIG_I2C_BCM2835":"y","CONFIG_SPI_BCM2835":"y","CONFIG_GPIO_BCM_VIRT":"y","CONFIG_THERMAL_BCM2835":"y"},"kernel_defconfig":"bcm2711_defconfig","boot_params":{"config_txt":"# Raspberry Pi 4 boot configuration\narm_64bit=1\ndtoverlay=vc4-kms-v3d-pi4\ndisable_overscan=1\ngpu_mem=256\nenable_uart=1\n","kernel_image":"kernel8.img"},"firmware":[{"name":"rpi-firmware","path":"/boot","description":"Raspberry Pi boot firmware (start4.elf, fixup4.dat, bootcode.bin)"}],"kernel_cmdline":"console=serial0,115200 console=tty1 rootfstype=ext4 rootwait","image_layout":"rpi"}`)
+			if err != nil {
+				return err
+			}
+
+			// rpi5: the EEPROM bootloader needs no firmware blobs on the boot
+			// partition, and bcm2712_defconfig builds the 16K page kernel
+			_, err = tx.Exec(`
+				INSERT INTO board_profiles (id, name, display_name, description, arch, config, is_system, owner_id)
+				SELECT ?, 'rpi5', 'Raspberry Pi 5', 'Raspberry Pi 5 (BCM2712, Cortex-A76, 2-16GB RAM)', 'aarch64', ?, 1, ''
+				WHERE NOT EXISTS (SELECT 1 FROM board_profiles WHERE name = 'rpi5')
+			`, uuid.New().String(), `{"device_trees":[{"source":"arch/arm64/boot/dts/broadcom/bcm2712-rpi-5-b.dts"}],"kernel_overlay":{"CONFIG_ARCH_BCM2835":"y","CONFIG_ARM64_16K_PAGES":"y","CONFIG_MMC_SDHCI_BRCMSTB":"y","CONFIG_PCIE_BRCMSTB":"y","CONFIG_MFD_RP1":"y","CONFIG_DRM_VC4":"m","CONFIG_BCM2835_WDT":"y","CONFIG_SERIAL_AMBA_PL011":"y","CONFIG_USB_XHCI_PCI":"y","CONFIG_BRCMFMAC":"m"},"kernel_defconfig":"bcm2712_defconfig","boot_params":{"config_txt":"# Raspberry Pi 5 boot configuration\narm_64bit=1\nenable_uart=1\n","kernel_image":"kernel_2712.img"},"kernel_cmdline":"console=serial0,115200 console=tty1 rootfstype=ext4 rootwait","image_layout":"rpi"}`)
+			return err
+		},
+	}
+}
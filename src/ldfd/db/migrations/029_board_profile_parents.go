@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func migration029BoardProfileParents() Migration {
+	return Migration{
+		Version:     29,
+		Description: "Add parent_id to board_profiles for profile inheritance",
+		Up: func(tx *sql.Tx) error {
+			// Children are kept from dangling by the API, which refuses to
+			// delete a profile other profiles extend
+			_, err := tx.Exec(`ALTER TABLE board_profiles ADD COLUMN parent_id TEXT DEFAULT ''`)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE INDEX idx_board_profiles_parent ON board_profiles(parent_id)`)
+			return err
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func migration030LinuxFirmware() Migration {
+	return Migration{
+		Version:     30,
+		Description: "Seed the linux-firmware component",
+		Up:          migration030Up,
+	}
+}
+
+func migration030Up(tx *sql.Tx) error {
+	now := time.Now().UTC()
+
+	// The firmware tree is installed file by file, never built
+	_, err := tx.Exec(`
+		INSERT INTO components (id, name, category, display_name, description, artifact_pattern,
+			default_url_template, github_normalized_template, is_optional, is_system,
+			is_kernel_module, is_userspace, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, 1, 0, 0, ?, ?)
+	`,
+		uuid.New().String(),
+		"linux-firmware",
+		"firmware",
+		"linux-firmware",
+		"Firmware blobs for Linux kernel drivers, with WHENCE licence metadata",
+		"linux-firmware-{version}.tar.xz",
+		"{base_url}/linux-firmware-{version}.tar.xz",
+		"",
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert linux-firmware component: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func migration031CloudComponents() Migration {
+	return Migration{
+		Version:     31,
+		Description: "Seed cloud image components (cloud-init, cloud-utils)",
+		Up:          migration031Up,
+	}
+}
+
+func migration031Up(tx *sql.Tx) error {
+	now := time.Now().UTC()
+
+	components := []struct {
+		Name                     string
+		DisplayName              string
+		Description              string
+		ArtifactPattern          string
+		DefaultURLTemplate       string
+		GithubNormalizedTemplate string
+	}{
+		{
+			Name:                     "cloud-init",
+			DisplayName:              "cloud-init",
+			Description:              "Instance initialization from cloud provider metadata",
+			ArtifactPattern:          "cloud-init-{version}.tar.gz",
+			DefaultURLTemplate:       "{base_url}/archive/refs/tags/{version}.tar.gz",
+			GithubNormalizedTemplate: "{base_url}/archive/refs/tags/{version}.tar.gz",
+		},
+		{
+			Name:                     "cloud-utils",
+			DisplayName:              "cloud-utils",
+			Description:              "Cloud image utilities, including growpart",
+			ArtifactPattern:          "cloud-utils-{version}.tar.gz",
+			DefaultURLTemplate:       "{base_url}/archive/refs/tags/{version}.tar.gz",
+			GithubNormalizedTemplate: "{base_url}/archive/refs/tags/{version}.tar.gz",
+		},
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO components (id, name, category, display_name, description, artifact_pattern,
+			default_url_template, github_normalized_template, is_optional, is_system,
+			is_kernel_module, is_userspace, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, 1, 0, 1, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare cloud component insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range components {
+		if _, err := stmt.Exec(
+			uuid.New().String(),
+			c.Name,
+			"cloud",
+			c.DisplayName,
+			c.Description,
+			c.ArtifactPattern,
+			c.DefaultURLTemplate,
+			c.GithubNormalizedTemplate,
+			now,
+			now,
+		); err != nil {
+			return fmt.Errorf("failed to insert cloud component %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func migration032SELinuxRefpolicy() Migration {
+	return Migration{
+		Version:     32,
+		Description: "Seed the SELinux reference policy component",
+		Up:          migration032Up,
+	}
+}
+
+func migration032Up(tx *sql.Tx) error {
+	now := time.Now().UTC()
+
+	// The targeted and mls policies are compiled from the reference policy
+	// source when SELinux images are assembled
+	_, err := tx.Exec(`
+		INSERT INTO components (id, name, category, display_name, description, artifact_pattern,
+			default_url_template, github_normalized_template, is_optional, is_system,
+			is_kernel_module, is_userspace, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, 1, 0, 1, ?, ?)
+	`,
+		uuid.New().String(),
+		"refpolicy",
+		"security",
+		"SELinux Reference Policy",
+		"SELinux policy source the targeted and mls policies are compiled from",
+		"refpolicy-{version}.tar.gz",
+		"{base_url}/archive/refs/tags/RELEASE_{version}.tar.gz",
+		"{base_url}/archive/refs/tags/RELEASE_{version}.tar.gz",
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert refpolicy component: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func migration033LoggingComponents() Migration {
+	return Migration{
+		Version:     33,
+		Description: "Seed system logger components (sysklogd, rsyslog)",
+		Up:          migration033Up,
+	}
+}
+
+func migration033Up(tx *sql.Tx) error {
+	now := time.Now().UTC()
+
+	components := []struct {
+		Name                     string
+		DisplayName              string
+		Description              string
+		ArtifactPattern          string
+		DefaultURLTemplate       string
+		GithubNormalizedTemplate string
+	}{
+		{
+			Name:                     "sysklogd",
+			DisplayName:              "sysklogd",
+			Description:              "Classic BSD-style syslog daemon",
+			ArtifactPattern:          "sysklogd-{version}.tar.gz",
+			DefaultURLTemplate:       "{base_url}/releases/download/v{version}/sysklogd-{version}.tar.gz",
+			GithubNormalizedTemplate: "{base_url}/archive/refs/tags/v{version}.tar.gz",
+		},
+		{
+			Name:                     "rsyslog",
+			DisplayName:              "rsyslog",
+			Description:              "Syslog daemon with filtering rules and remote forwarding",
+			ArtifactPattern:          "rsyslog-{version}.tar.gz",
+			DefaultURLTemplate:       "{base_url}/rsyslog-{version}.tar.gz",
+			GithubNormalizedTemplate: "{base_url}/archive/refs/tags/v{version}.tar.gz",
+		},
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO components (id, name, category, display_name, description, artifact_pattern,
+			default_url_template, github_normalized_template, is_optional, is_system,
+			is_kernel_module, is_userspace, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, 1, 0, 1, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare logging component insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range components {
+		if _, err := stmt.Exec(
+			uuid.New().String(),
+			c.Name,
+			"logging",
+			c.DisplayName,
+			c.Description,
+			c.ArtifactPattern,
+			c.DefaultURLTemplate,
+			c.GithubNormalizedTemplate,
+			now,
+			now,
+		); err != nil {
+			return fmt.Errorf("failed to insert logging component %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -66,6 +66,19 @@ func (r *Runner) registerAll() {
 		migration018ToolchainComponents(),
 		migration019ToolchainComponentsCross(),
 		migration020ProfileUUIDIDs(),
+		migration021BuildBuilderImage(),
+		migration022BuildVerify(),
+		migration023SigningKeys(),
+		migration024SecureBootKeys(),
+		migration025UpdateBundles(),
+		migration026BuildDeltas(),
+		migration027DiskEncryptionKeys(),
+		migration028RPiImageLayout(),
+		migration029BoardProfileParents(),
+		migration030LinuxFirmware(),
+		migration031CloudComponents(),
+		migration032SELinuxRefpolicy(),
+		migration033LoggingComponents(),
 	}
 
 	// Sort by version to ensure correct order
@@ -9,9 +9,55 @@ type DistributionConfig struct {
 	Security       SecurityConfig `json:"security"`
 	Runtime        RuntimeConfig  `json:"runtime"`
 	Target         TargetConfig   `json:"target"`
+	Build          BuildConfig    `json:"build"`
+	Update         UpdateConfig   `json:"update"`
+	Settings       SystemSettings `json:"settings"`
 	BoardProfileID string         `json:"board_profile_id,omitempty"`
 }
 
+// SystemSettings are the declarative settings of the installed system,
+// rendered for its init system. Unset fields keep the defaults.
+type SystemSettings struct {
+	Hostname   string        `json:"hostname,omitempty"`    // Defaults to the distribution name
+	Locales    []string      `json:"locales,omitempty"`     // Generated locales; the first is the default, e.g. "en_US.UTF-8"
+	Timezone   string        `json:"timezone,omitempty"`    // IANA time zone, e.g. "Europe/Paris"; defaults to UTC
+	Keymap     string        `json:"keymap,omitempty"`      // Console keymap; defaults to "us"
+	NTPServers []string      `json:"ntp_servers,omitempty"` // Time servers; the init system's defaults when empty
+	Network    NetworkConfig `json:"network"`
+}
+
+// NetworkConfig declares name resolution and network interfaces
+type NetworkConfig struct {
+	DNS           []string           `json:"dns,omitempty"`            // Name server addresses
+	SearchDomains []string           `json:"search_domains,omitempty"` // DNS search domains
+	Interfaces    []NetworkInterface `json:"interfaces,omitempty"`     // Without interfaces every link is configured with DHCP
+}
+
+// NetworkInterfaceType is the kind of a network interface
+type NetworkInterfaceType string
+
+const (
+	InterfaceEthernet NetworkInterfaceType = "ethernet"
+	InterfaceVLAN     NetworkInterfaceType = "vlan"
+	InterfaceBond     NetworkInterfaceType = "bond"
+)
+
+// NetworkInterface configures a link with DHCP or static addresses.
+// VLANs are created on their parent link and bonds aggregate their
+// members, which carry no addresses of their own.
+type NetworkInterface struct {
+	Name      string               `json:"name"`                // e.g. "eth0", "eth0.100", "bond0"
+	Type      NetworkInterfaceType `json:"type,omitempty"`      // Defaults to ethernet
+	DHCP      bool                 `json:"dhcp,omitempty"`      // Also take an address from DHCP
+	Addresses []string             `json:"addresses,omitempty"` // Static addresses in CIDR notation, e.g. "192.168.1.10/24"
+	Gateway   string               `json:"gateway,omitempty"`   // Default gateway of the static addresses
+	MTU       int                  `json:"mtu,omitempty"`
+	Parent    string               `json:"parent,omitempty"`    // vlan: link carrying the VLAN
+	VLANID    int                  `json:"vlan_id,omitempty"`   // vlan: 802.1Q VLAN ID
+	Members   []string             `json:"members,omitempty"`   // bond: aggregated links
+	BondMode  string               `json:"bond_mode,omitempty"` // bond: e.g. "802.3ad"; defaults to active-backup
+}
+
 // CoreConfig contains core system configuration
 type CoreConfig struct {
 	Kernel            KernelConfig       `json:"kernel"`
@@ -19,6 +65,62 @@ type CoreConfig struct {
 	BootloaderVersion string             `json:"bootloader_version,omitempty"`
 	Toolchain         string             `json:"toolchain,omitempty"`
 	Partitioning      PartitioningConfig `json:"partitioning"`
+	Initramfs         InitramfsConfig    `json:"initramfs"`
+	Firmware          FirmwareSelection  `json:"firmware"`
+	FirmwareVersion   string             `json:"firmware_version,omitempty"` // linux-firmware release, e.g. "20240909"
+}
+
+// FirmwareSelection picks blobs from the linux-firmware tree. Only the
+// selected files, the links pointing at them and their licences are
+// installed to /lib/firmware.
+type FirmwareSelection struct {
+	Drivers []string `json:"drivers,omitempty"` // WHENCE driver names, e.g. "iwlwifi", "amdgpu"
+	Modules []string `json:"modules,omitempty"` // kernel modules whose modinfo firmware references are installed
+	Files   []string `json:"files,omitempty"`   // paths or glob patterns relative to /lib/firmware
+}
+
+// IsEmpty reports whether the selection picks no firmware
+func (f FirmwareSelection) IsEmpty() bool {
+	return len(f.Drivers) == 0 && len(f.Modules) == 0 && len(f.Files) == 0
+}
+
+// InitramfsGeneratorType selects the tool building the initramfs
+type InitramfsGeneratorType string
+
+const (
+	InitramfsGeneratorBuiltin    InitramfsGeneratorType = "builtin"    // busybox initramfs assembled by ldfd
+	InitramfsGeneratorDracut     InitramfsGeneratorType = "dracut"     // dracut from the rootfs, run in the build executor
+	InitramfsGeneratorMkinitcpio InitramfsGeneratorType = "mkinitcpio" // mkinitcpio from the rootfs, run in the build executor
+)
+
+// InitramfsHook names an optional initramfs module
+type InitramfsHook string
+
+const (
+	InitramfsHookLVM      InitramfsHook = "lvm"
+	InitramfsHookMDRAID   InitramfsHook = "mdraid"
+	InitramfsHookLUKS     InitramfsHook = "luks"
+	InitramfsHookNFS      InitramfsHook = "nfs"
+	InitramfsHookNetwork  InitramfsHook = "network"
+	InitramfsHookPlymouth InitramfsHook = "plymouth"
+)
+
+// InitramfsCompression is the compressor applied to the initramfs archive
+type InitramfsCompression string
+
+const (
+	InitramfsCompressionGzip InitramfsCompression = "gzip"
+	InitramfsCompressionXZ   InitramfsCompression = "xz"
+	InitramfsCompressionZstd InitramfsCompression = "zstd"
+	InitramfsCompressionLZ4  InitramfsCompression = "lz4"
+)
+
+// InitramfsConfig controls how the initramfs is built
+type InitramfsConfig struct {
+	Generator   InitramfsGeneratorType `json:"generator,omitempty"`    // Defaults to builtin
+	Hooks       []InitramfsHook        `json:"hooks,omitempty"`        // Added to the hooks the configuration implies (luks, network, nfs)
+	Compression InitramfsCompression   `json:"compression,omitempty"`  // Defaults to gzip; the kernel must support it
+	NoMicrocode bool                   `json:"no_microcode,omitempty"` // Skip prepending early CPU microcode
 }
 
 // ToolchainType represents the build toolchain selection
@@ -77,6 +179,64 @@ type SystemConfig struct {
 	FilesystemUserspace   bool             `json:"filesystem_userspace,omitempty"` // Include userspace tools for hybrid filesystem components
 	PackageManager        string           `json:"packageManager"`
 	PackageManagerVersion string           `json:"package_manager_version,omitempty"`
+	Logging               LoggingConfig    `json:"logging"`
+	Resources             ResourceConfig   `json:"resources"`
+}
+
+// LoggingSystem is the service collecting system logs
+type LoggingSystem string
+
+const (
+	LoggingJournald LoggingSystem = "journald" // systemd's journal; requires systemd
+	LoggingSyslog   LoggingSystem = "syslog"   // sysklogd
+	LoggingRsyslog  LoggingSystem = "rsyslog"
+	LoggingNone     LoggingSystem = "none"
+)
+
+// JournalStorage is where journald keeps the journal
+type JournalStorage string
+
+const (
+	JournalStoragePersistent JournalStorage = "persistent" // /var/log/journal
+	JournalStorageVolatile   JournalStorage = "volatile"   // /run/log/journal, lost on reboot
+	JournalStorageAuto       JournalStorage = "auto"       // persistent once /var/log/journal exists
+)
+
+// LoggingConfig selects and configures the system logger. Without a
+// system, systemd images log to a persistent journal and OpenRC images
+// to rc.log only. Syslog daemons on systemd read the journal, which is
+// then kept in memory.
+type LoggingConfig struct {
+	System       LoggingSystem     `json:"system,omitempty"`
+	Version      string            `json:"version,omitempty"`       // sysklogd or rsyslog version
+	Storage      JournalStorage    `json:"storage,omitempty"`       // journald; defaults to persistent
+	MaxUse       string            `json:"max_use,omitempty"`       // journald SystemMaxUse, e.g. "500M"
+	MaxRetention string            `json:"max_retention,omitempty"` // journald MaxRetentionSec, e.g. "1month"
+	Rules        []string          `json:"rules,omitempty"`         // rsyslog rules, e.g. "kern.* /var/log/kern.log"
+	Remote       *LogForwardConfig `json:"remote,omitempty"`        // Forward every message to a log host (syslog, rsyslog)
+}
+
+// LogForwardConfig is the log host syslog daemons forward messages to
+type LogForwardConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`     // Defaults to 514
+	Protocol string `json:"protocol,omitempty"` // udp or tcp (rsyslog only); defaults to udp
+}
+
+// CgroupHierarchy is the cgroup hierarchy the init system mounts
+type CgroupHierarchy string
+
+const (
+	CgroupUnified CgroupHierarchy = "unified" // cgroup v2 only
+	CgroupHybrid  CgroupHierarchy = "hybrid"  // v1 controllers with the v2 hierarchy for process tracking
+	CgroupLegacy  CgroupHierarchy = "legacy"  // cgroup v1 only
+)
+
+// ResourceConfig selects resource management. Without a manager images
+// keep the kernel's and init system's defaults.
+type ResourceConfig struct {
+	Manager   string          `json:"manager,omitempty"`   // cgroups or none
+	Hierarchy CgroupHierarchy `json:"hierarchy,omitempty"` // cgroups; defaults to unified
 }
 
 // FilesystemConfig contains filesystem configuration
@@ -87,9 +247,83 @@ type FilesystemConfig struct {
 
 // SecurityConfig contains security configuration
 type SecurityConfig struct {
-	System          string `json:"system"`
-	SystemVersion   string `json:"system_version,omitempty"`
-	SystemUserspace bool   `json:"system_userspace,omitempty"` // Include userspace tools for hybrid security components (SELinux, AppArmor)
+	System          string           `json:"system"`
+	SystemVersion   string           `json:"system_version,omitempty"`
+	SystemUserspace bool             `json:"system_userspace,omitempty"` // Include userspace tools for hybrid security components (SELinux, AppArmor)
+	SecureBoot      SecureBootConfig `json:"secure_boot"`
+	Verity          VerityConfig     `json:"verity"`
+	Encryption      EncryptionConfig `json:"encryption"`
+	SELinux         SELinuxConfig    `json:"selinux"`
+	AppArmor        AppArmorConfig   `json:"apparmor"`
+}
+
+// SELinuxPolicy is the SELinux policy an image is built and labeled with
+type SELinuxPolicy string
+
+const (
+	SELinuxPolicyTargeted SELinuxPolicy = "targeted"
+	SELinuxPolicyMLS      SELinuxPolicy = "mls"
+	SELinuxPolicyCustom   SELinuxPolicy = "custom" // Only the policy modules uploaded with the distribution, base module included
+)
+
+// SELinuxConfig controls the policy of SELinux images. targeted and mls
+// are compiled from the reference policy; modules uploaded as distribution
+// artifacts under security/selinux/ are added to any policy. The root
+// filesystem is labeled at build time.
+type SELinuxConfig struct {
+	Policy           SELinuxPolicy `json:"policy,omitempty"`            // Defaults to targeted
+	Enforcing        bool          `json:"enforcing,omitempty"`         // Boot enforcing instead of permissive
+	RefpolicyVersion string        `json:"refpolicy_version,omitempty"` // Reference policy release the policy is compiled from
+}
+
+// AppArmorProfileSet is a set of profiles shipped with AppArmor
+type AppArmorProfileSet string
+
+const (
+	AppArmorProfilesBase   AppArmorProfileSet = "base"   // profiles/apparmor.d, the profiles distributions enable
+	AppArmorProfilesExtras AppArmorProfileSet = "extras" // profiles/apparmor/profiles/extras, less mature profiles
+)
+
+// AppArmorConfig controls the profiles of AppArmor images. Profiles
+// uploaded as distribution artifacts under security/apparmor/ are always
+// installed. Profiles are precompiled into the image's cache.
+type AppArmorConfig struct {
+	ProfileSets []AppArmorProfileSet `json:"profile_sets,omitempty"`
+	Complain    bool                 `json:"complain,omitempty"` // Load every profile in complain mode
+}
+
+// SecureBootConfig controls UEFI Secure Boot signing of boot binaries
+type SecureBootConfig struct {
+	Enabled          bool   `json:"enabled,omitempty"`
+	KeySetID         string `json:"key_set_id,omitempty"`        // Key set to sign with; empty uses the active set
+	ExportEnrollment bool   `json:"export_enrollment,omitempty"` // Publish PK/KEK/db .esl and .auth files with the build
+}
+
+// VerityFilesystem is the read-only filesystem a dm-verity root is built with
+type VerityFilesystem string
+
+const (
+	VerityFilesystemEROFS    VerityFilesystem = "erofs"
+	VerityFilesystemSquashFS VerityFilesystem = "squashfs"
+)
+
+// VerityConfig controls read-only root images protected by dm-verity.
+// Writable state lives on a separate /var partition.
+type VerityConfig struct {
+	Enabled    bool             `json:"enabled,omitempty"`
+	Filesystem VerityFilesystem `json:"filesystem,omitempty"`  // Defaults to erofs
+	VarSizeMB  int              `json:"var_size_mb,omitempty"` // Minimum /var size; the partition takes the rest of the disk
+}
+
+// EncryptionConfig controls LUKS2 encrypted root partitions. Each build
+// formats the root with its own recovery key, kept encrypted by ldfd and
+// only handed out to the distribution's owner through the builds API.
+type EncryptionConfig struct {
+	Enabled        bool   `json:"enabled,omitempty"`
+	ExportRecovery bool   `json:"export_recovery,omitempty"` // Export the recovery key as a private artifact only the owner and admins can download
+	TPM2           bool   `json:"tpm2,omitempty"`            // Enroll a TPM2 key slot with systemd-cryptenroll on first boot
+	TPM2PCRs       string `json:"tpm2_pcrs,omitempty"`       // PCRs the TPM2 slot is bound to; defaults to 7
+	Reencrypt      bool   `json:"reencrypt,omitempty"`       // Unlock the first boot with an embedded key, then replace the volume key and the build (recovery) key
 }
 
 // RuntimeConfig contains runtime configuration
@@ -104,6 +338,97 @@ type RuntimeConfig struct {
 type TargetConfig struct {
 	Type    string         `json:"type"`
 	Desktop *DesktopConfig `json:"desktop,omitempty"`
+	Cloud   *CloudConfig   `json:"cloud,omitempty"`
+}
+
+// BuildConfig contains options controlling how images are produced
+type BuildConfig struct {
+	// Reproducible pins timestamps, ownership, ordering and filesystem
+	// identifiers so identical configurations yield identical images
+	Reproducible bool `json:"reproducible"`
+	// SourceDateEpoch overrides the epoch derived from the configuration
+	SourceDateEpoch int64 `json:"source_date_epoch,omitempty"`
+	// BootTest boots the packaged image in QEMU before the build completes
+	BootTest BootTestConfig `json:"boot_test"`
+	// OCI controls container images produced with the oci image format
+	OCI OCIConfig `json:"oci"`
+	// Netboot controls network boot bundles produced with the netboot image format
+	Netboot NetbootConfig `json:"netboot"`
+	// VM controls the virtual machine launch descriptors published with disk images
+	VM VMConfig `json:"vm"`
+	// Live controls the installer and persistence of live ISO images
+	Live LiveConfig `json:"live"`
+}
+
+// LiveConfig controls live ISO images. The installer writes the system to
+// a disk with the single-root partition layout of raw images.
+type LiveConfig struct {
+	Installer   bool   `json:"installer,omitempty"`   // Embed ldf-install, the text-mode installer, and add an install boot entry
+	Answers     string `json:"answers,omitempty"`     // Answer file baked into the ISO for unattended installs
+	Persistence bool   `json:"persistence,omitempty"` // Add a boot entry keeping session changes on a partition labelled LDF_PERSIST
+}
+
+// VMDiskBus is the bus a virtual machine attaches the image disk to
+type VMDiskBus string
+
+const (
+	VMDiskBusVirtio VMDiskBus = "virtio" // virtio-blk
+	VMDiskBusSCSI   VMDiskBus = "scsi"   // virtio-scsi
+	VMDiskBusSATA   VMDiskBus = "sata"   // AHCI, for guests without virtio drivers
+)
+
+// VMConfig controls the libvirt domain and QEMU launch script published
+// with disk images. The boot test boots the image with the same settings.
+type VMConfig struct {
+	MemoryMB      int       `json:"memory_mb,omitempty"`      // Guest memory; defaults to 2048
+	CPUs          int       `json:"cpus,omitempty"`           // Virtual CPUs; defaults to 2
+	DiskBus       VMDiskBus `json:"disk_bus,omitempty"`       // Defaults to virtio
+	SerialConsole bool      `json:"serial_console,omitempty"` // Put the kernel console on the first serial port and launch headless
+}
+
+// NetbootRoot is how network-booted machines reach their root filesystem
+type NetbootRoot string
+
+const (
+	NetbootRootHTTP NetbootRoot = "http" // Download the squashfs root into RAM
+	NetbootRootNFS  NetbootRoot = "nfs"  // Mount an exported copy of the rootfs
+)
+
+// NetbootConfig controls the boot configurations generated for netboot
+// bundles. The kernel, initramfs and squashfs root are served by ldfd.
+type NetbootConfig struct {
+	BaseURL    string      `json:"base_url,omitempty"`    // ldfd URL booting machines fetch from; defaults to the server's public URL
+	Root       NetbootRoot `json:"root,omitempty"`        // Defaults to http
+	NFSExport  string      `json:"nfs_export,omitempty"`  // server:/path of the rootfs export when root is nfs
+	KernelArgs string      `json:"kernel_args,omitempty"` // Extra kernel command line arguments
+}
+
+// OCIConfig controls where container images built in the oci format are
+// pushed. Images are always published to storage as an OCI layout archive.
+type OCIConfig struct {
+	Repository string   `json:"repository,omitempty"` // Registry repository, e.g. registry.example.com/team/base; empty disables pushing
+	Tags       []string `json:"tags,omitempty"`       // Tags pushed; defaults to the distribution version
+	PlainHTTP  bool     `json:"plain_http,omitempty"` // Talk to the registry over HTTP, for local registries
+}
+
+// BootTestConfig controls the QEMU smoke test run after packaging
+type BootTestConfig struct {
+	Enabled        bool     `json:"enabled"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // Time allowed to reach the success marker; defaults to 300
+	SuccessMarker  string   `json:"success_marker,omitempty"`  // Regular expression marking a successful boot; defaults to a login prompt
+	MemoryMB       int      `json:"memory_mb,omitempty"`       // Guest memory; defaults to 1024
+	Commands       []string `json:"commands,omitempty"`        // Shell commands run as root over the serial console once booted; any non-zero exit fails the build
+}
+
+// UpdateConfig controls A/B disk layouts and the OTA update bundles
+// published for devices running them
+type UpdateConfig struct {
+	ABSlots    bool   `json:"ab_slots,omitempty"`     // Two root slots plus a shared /data partition
+	SlotSizeMB int    `json:"slot_size_mb,omitempty"` // Size of each root slot; derived from the image size when 0
+	DataSizeMB int    `json:"data_size_mb,omitempty"` // Minimum /data size; the partition takes the rest of the disk
+	Bundle     bool   `json:"bundle,omitempty"`       // Publish a signed update bundle with each build
+	Compatible string `json:"compatible,omitempty"`   // Devices a bundle installs on; defaults to the board profile or distribution name
+	Hooks      string `json:"hooks,omitempty"`        // Shell script the updater runs around slot installation
 }
 
 // DesktopConfig contains desktop environment configuration
@@ -114,6 +439,28 @@ type DesktopConfig struct {
 	DisplayServerVersion string `json:"display_server_version,omitempty"`
 }
 
+// CloudProvider selects the conventions a cloud image follows: the
+// cloud-init datasources, kernel modules, console and image formats
+type CloudProvider string
+
+const (
+	CloudProviderGeneric CloudProvider = "generic" // OpenStack, NoCloud and other KVM clouds
+	CloudProviderAWS     CloudProvider = "aws"     // EC2-compatible clouds
+	CloudProviderGCE     CloudProvider = "gce"     // Google Compute Engine
+)
+
+// CloudConfig contains cloud image configuration, used when the target
+// type is cloud. Images install cloud-init, which configures instances
+// from the provider's metadata on first boot.
+type CloudConfig struct {
+	Provider         CloudProvider `json:"provider,omitempty"`           // Defaults to generic
+	Datasources      []string      `json:"datasources,omitempty"`        // Overrides the provider's cloud-init datasource list
+	DefaultUser      string        `json:"default_user,omitempty"`       // Account cloud-init creates with the instance's SSH keys; defaults to "ldf"
+	NoGrowpart       bool          `json:"no_growpart,omitempty"`        // Keep the root partition and filesystem at their image size
+	SeedSSHKeys      []string      `json:"seed_ssh_keys,omitempty"`      // Authorized keys of the published NoCloud seed ISO
+	CloudInitVersion string        `json:"cloud_init_version,omitempty"` // cloud-init release
+}
+
 // DistributionStatus represents the status of a distribution
 type DistributionStatus string
 
@@ -315,6 +662,7 @@ const (
 	BuildStatusCompiling  BuildJobStatus = "compiling"
 	BuildStatusAssembling BuildJobStatus = "assembling"
 	BuildStatusPackaging  BuildJobStatus = "packaging"
+	BuildStatusTesting    BuildJobStatus = "testing"
 	BuildStatusCompleted  BuildJobStatus = "completed"
 	BuildStatusFailed     BuildJobStatus = "failed"
 	BuildStatusCancelled  BuildJobStatus = "cancelled"
@@ -330,6 +678,7 @@ const (
 	StageCompile  BuildStageName = "compile"
 	StageAssemble BuildStageName = "assemble"
 	StagePackage  BuildStageName = "package"
+	StageTest     BuildStageName = "test"
 )
 
 // TargetArch represents a supported target architecture
@@ -344,9 +693,15 @@ const (
 type ImageFormat string
 
 const (
-	ImageFormatRaw   ImageFormat = "raw"
-	ImageFormatQCOW2 ImageFormat = "qcow2"
-	ImageFormatISO   ImageFormat = "iso"
+	ImageFormatRaw     ImageFormat = "raw"
+	ImageFormatQCOW2   ImageFormat = "qcow2"
+	ImageFormatISO     ImageFormat = "iso"
+	ImageFormatOCI     ImageFormat = "oci"
+	ImageFormatVMDK    ImageFormat = "vmdk"
+	ImageFormatVHDX    ImageFormat = "vhdx"
+	ImageFormatTarZst  ImageFormat = "tar.zst"
+	ImageFormatCpio    ImageFormat = "cpio"
+	ImageFormatNetboot ImageFormat = "netboot"
 )
 
 // BuildJob represents a build task for a distribution
@@ -369,11 +724,67 @@ type BuildJob struct {
 	MaxRetries       int            `json:"max_retries"`
 	ClearCache       bool           `json:"clear_cache"`
 	ConfigSnapshot   string         `json:"config_snapshot,omitempty"`
+	BuilderImage     string         `json:"builder_image,omitempty"`
+	BuilderDigest    string         `json:"builder_image_digest,omitempty"`
+	VerifyOf         string         `json:"verify_of,omitempty"`
+	VerifyResult     string         `json:"verify_result,omitempty"`
+	VerifyDiff       []string       `json:"verify_diff,omitempty"`
 	CreatedAt        time.Time      `json:"created_at"`
 	StartedAt        *time.Time     `json:"started_at,omitempty"`
 	CompletedAt      *time.Time     `json:"completed_at,omitempty"`
 }
 
+// UpdateBundle records the OTA update bundle published by a completed build
+type UpdateBundle struct {
+	ID             string     `json:"id"`
+	BuildID        string     `json:"build_id"`
+	DistributionID string     `json:"distribution_id"`
+	TargetArch     TargetArch `json:"target_arch"`
+	Compatible     string     `json:"compatible"`
+	Version        string     `json:"version"`
+	ArtifactPath   string     `json:"artifact_path"`
+	Checksum       string     `json:"checksum"`
+	SizeBytes      int64      `json:"size_bytes"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// DiskEncryptionKey records the LUKS2 recovery key a build formatted its
+// encrypted root with. The key is encrypted by the security.SecretManager.
+type DiskEncryptionKey struct {
+	BuildID        string    `json:"build_id"`
+	DistributionID string    `json:"distribution_id"`
+	LUKSUUID       string    `json:"luks_uuid"`
+	RecoveryKey    string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// BuildDeltaStatus represents the status of a binary delta job
+type BuildDeltaStatus string
+
+const (
+	DeltaStatusPending   BuildDeltaStatus = "pending"
+	DeltaStatusRunning   BuildDeltaStatus = "running"
+	DeltaStatusCompleted BuildDeltaStatus = "completed"
+	DeltaStatusFailed    BuildDeltaStatus = "failed"
+)
+
+// BuildDelta records a binary delta turning one build's image into another's
+type BuildDelta struct {
+	ID             string           `json:"id"`
+	DistributionID string           `json:"distribution_id"`
+	SourceBuildID  string           `json:"source_build_id"`
+	TargetBuildID  string           `json:"target_build_id"`
+	Status         BuildDeltaStatus `json:"status"`
+	ArtifactPath   string           `json:"artifact_path,omitempty"`
+	Checksum       string           `json:"checksum,omitempty"`
+	SizeBytes      int64            `json:"size_bytes"`
+	SourceChecksum string           `json:"source_checksum,omitempty"`
+	TargetChecksum string           `json:"target_checksum,omitempty"`
+	ErrorMessage   string           `json:"error_message,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	CompletedAt    *time.Time       `json:"completed_at,omitempty"`
+}
+
 // BuildStage represents a single stage in the build pipeline
 type BuildStage struct {
 	ID              int64          `json:"id"`
@@ -425,7 +836,8 @@ type BoardProfile struct {
 	Name        string      `json:"name"` // unique slug: "rpi4", "generic-x86_64"
 	DisplayName string      `json:"display_name"`
 	Description string      `json:"description,omitempty"`
-	Arch        TargetArch  `json:"arch"` // architecture constraint
+	Arch        TargetArch  `json:"arch"`                // architecture constraint
+	ParentID    string      `json:"parent_id,omitempty"` // profile whose config this one extends
 	Config      BoardConfig `json:"config"`
 	IsSystem    bool        `json:"is_system"`
 	OwnerID     string      `json:"owner_id,omitempty"`
@@ -441,8 +853,19 @@ type BoardConfig struct {
 	BootParams      BoardBootParams   `json:"boot_params,omitempty"`
 	Firmware        []BoardFirmware   `json:"firmware,omitempty"`
 	KernelCmdline   string            `json:"kernel_cmdline,omitempty"`
+	ImageLayout     BoardImageLayout  `json:"image_layout,omitempty"`   // disk image layout, gpt by default
+	LinuxFirmware   FirmwareSelection `json:"linux_firmware,omitempty"` // blobs added to the distribution's firmware selection
 }
 
+// BoardImageLayout selects the partition layout of raw board images
+type BoardImageLayout string
+
+// Board image layouts
+const (
+	BoardImageLayoutGPT BoardImageLayout = "gpt" // GPT with an EFI System Partition
+	BoardImageLayoutRPi BoardImageLayout = "rpi" // MBR with a FAT32 firmware boot partition, for the Raspberry Pi boot ROM
+)
+
 // DeviceTreeSpec defines a device tree source to compile and include
 type DeviceTreeSpec struct {
 	Source   string   `json:"source"`             // path relative to kernel source tree
@@ -453,8 +876,18 @@ type DeviceTreeSpec struct {
 type BoardBootParams struct {
 	BootloaderOverride string            `json:"bootloader_override,omitempty"` // override distro bootloader choice
 	UBootBoard         string            `json:"uboot_board,omitempty"`         // U-Boot board config name
+	UBootImages        []UBootImage      `json:"uboot_images,omitempty"`        // U-Boot build outputs written to raw disk offsets
+	UBootMakeVars      map[string]string `json:"uboot_make_vars,omitempty"`     // extra U-Boot make variables (e.g. BL31, ROCKCHIP_TPL)
 	ExtraFiles         map[string]string `json:"extra_files,omitempty"`         // extra files to place (dest -> content)
 	ConfigTxt          string            `json:"config_txt,omitempty"`          // RPi config.txt content
+	KernelImage        string            `json:"kernel_image,omitempty"`        // RPi kernel file on the boot partition (default kernel8.img)
+}
+
+// UBootImage is a U-Boot build output the boot ROM loads from a fixed
+// disk offset, such as idbloader.img, u-boot.itb or flash.bin
+type UBootImage struct {
+	File   string `json:"file"`   // path relative to the U-Boot build directory
+	Sector int64  `json:"sector"` // offset in 512-byte sectors
 }
 
 // BoardFirmware describes firmware blobs required by the board
@@ -462,6 +895,7 @@ type BoardFirmware struct {
 	Name        string `json:"name"`
 	ComponentID string `json:"component_id,omitempty"` // optional reference to component registry
 	Path        string `json:"path,omitempty"`         // install path in rootfs
+	Source      string `json:"source,omitempty"`       // optional profile file or directory installed to path
 	Description string `json:"description,omitempty"`
 }
 
@@ -485,3 +919,38 @@ type ToolchainConfig struct {
 	ExtraEnv           map[string]string `json:"extra_env,omitempty"`            // additional env vars for make
 	CompilerFlags      string            `json:"compiler_flags,omitempty"`       // extra CFLAGS/LDFLAGS
 }
+
+// Signing key algorithms
+const (
+	SigningAlgorithmEd25519 = "ed25519"
+)
+
+// SigningKey is a server-managed key used to sign build attestations.
+// The private key is stored encrypted by the security.SecretManager.
+type SigningKey struct {
+	ID         string     `json:"id"` // key fingerprint, used as the DSSE keyid
+	Name       string     `json:"name"`
+	Algorithm  string     `json:"algorithm"`
+	PublicKey  string     `json:"public_key"` // PEM-encoded
+	PrivateKey string     `json:"-"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+}
+
+// SecureBootKeySet is a PK/KEK/db hierarchy used to sign EFI binaries.
+// Certificates are PEM-encoded; private keys are stored encrypted by the
+// security.SecretManager.
+type SecureBootKeySet struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerGUID string    `json:"owner_guid"` // EFI signature owner for enrollment lists
+	PKCert    string    `json:"pk_cert"`
+	PKKey     string    `json:"-"`
+	KEKCert   string    `json:"kek_cert"`
+	KEKKey    string    `json:"-"`
+	DBCert    string    `json:"db_cert"`
+	DBKey     string    `json:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
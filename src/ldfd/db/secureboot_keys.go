@@ -0,0 +1,163 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SecureBootKeyRepository handles Secure Boot key set database operations
+type SecureBootKeyRepository struct {
+	db *Database
+}
+
+// NewSecureBootKeyRepository creates a new Secure Boot key set repository
+func NewSecureBootKeyRepository(db *Database) *SecureBootKeyRepository {
+	return &SecureBootKeyRepository{db: db}
+}
+
+// selectSecureBootKeysQuery is the base SELECT query for Secure Boot key sets
+const selectSecureBootKeysQuery = `
+	SELECT id, name, owner_guid, pk_cert, pk_key, kek_cert, kek_key, db_cert, db_key, active, created_at
+	FROM secureboot_keys
+`
+
+// Create inserts a new Secure Boot key set
+func (r *SecureBootKeyRepository) Create(set *SecureBootKeySet) error {
+	set.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO secureboot_keys (id, name, owner_guid, pk_cert, pk_key, kek_cert, kek_key, db_cert, db_key, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.DB().Exec(query, set.ID, set.Name, set.OwnerGUID,
+		set.PKCert, set.PKKey, set.KEKCert, set.KEKKey, set.DBCert, set.DBKey,
+		set.Active, set.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create secure boot key set: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a Secure Boot key set by ID
+func (r *SecureBootKeyRepository) GetByID(id string) (*SecureBootKeySet, error) {
+	row := r.db.DB().QueryRow(selectSecureBootKeysQuery+` WHERE id = ?`, id)
+
+	set, err := r.scanSet(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secure boot key set: %w", err)
+	}
+
+	return set, nil
+}
+
+// GetByName retrieves a Secure Boot key set by name
+func (r *SecureBootKeyRepository) GetByName(name string) (*SecureBootKeySet, error) {
+	row := r.db.DB().QueryRow(selectSecureBootKeysQuery+` WHERE name = ?`, name)
+
+	set, err := r.scanSet(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secure boot key set: %w", err)
+	}
+
+	return set, nil
+}
+
+// GetActive retrieves the active Secure Boot key set
+func (r *SecureBootKeyRepository) GetActive() (*SecureBootKeySet, error) {
+	row := r.db.DB().QueryRow(selectSecureBootKeysQuery + ` WHERE active = 1 ORDER BY created_at DESC LIMIT 1`)
+
+	set, err := r.scanSet(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active secure boot key set: %w", err)
+	}
+
+	return set, nil
+}
+
+// List retrieves all Secure Boot key sets, newest first
+func (r *SecureBootKeyRepository) List() ([]SecureBootKeySet, error) {
+	rows, err := r.db.DB().Query(selectSecureBootKeysQuery + ` ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secure boot key sets: %w", err)
+	}
+	defer rows.Close()
+
+	var sets []SecureBootKeySet
+	for rows.Next() {
+		var set SecureBootKeySet
+		if err := rows.Scan(&set.ID, &set.Name, &set.OwnerGUID,
+			&set.PKCert, &set.PKKey, &set.KEKCert, &set.KEKKey, &set.DBCert, &set.DBKey,
+			&set.Active, &set.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan secure boot key set: %w", err)
+		}
+		sets = append(sets, set)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secure boot key sets: %w", err)
+	}
+
+	return sets, nil
+}
+
+// SetActive makes a key set the default used by builds that do not name one
+func (r *SecureBootKeyRepository) SetActive(id string) error {
+	return r.db.WithTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE secureboot_keys SET active = 0 WHERE active = 1 AND id != ?`, id); err != nil {
+			return fmt.Errorf("failed to deactivate secure boot key sets: %w", err)
+		}
+
+		result, err := tx.Exec(`UPDATE secureboot_keys SET active = 1 WHERE id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("failed to activate secure boot key set: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("secure boot key set not found: %s", id)
+		}
+		return nil
+	})
+}
+
+// Delete removes a Secure Boot key set
+func (r *SecureBootKeyRepository) Delete(id string) error {
+	result, err := r.db.DB().Exec(`DELETE FROM secureboot_keys WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete secure boot key set: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("secure boot key set not found: %s", id)
+	}
+
+	return nil
+}
+
+// scanSet scans a single Secure Boot key set row
+func (r *SecureBootKeyRepository) scanSet(row *sql.Row) (*SecureBootKeySet, error) {
+	var set SecureBootKeySet
+	if err := row.Scan(&set.ID, &set.Name, &set.OwnerGUID,
+		&set.PKCert, &set.PKKey, &set.KEKCert, &set.KEKKey, &set.DBCert, &set.DBKey,
+		&set.Active, &set.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SigningKeyRepository handles signing key database operations
+type SigningKeyRepository struct {
+	db *Database
+}
+
+// NewSigningKeyRepository creates a new signing key repository
+func NewSigningKeyRepository(db *Database) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+// selectSigningKeysQuery is the base SELECT query for signing keys
+const selectSigningKeysQuery = `
+	SELECT id, name, algorithm, public_key, private_key, active, created_at, retired_at
+	FROM signing_keys
+`
+
+// Create inserts a new signing key
+func (r *SigningKeyRepository) Create(key *SigningKey) error {
+	key.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO signing_keys (id, name, algorithm, public_key, private_key, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.DB().Exec(query, key.ID, key.Name, key.Algorithm,
+		key.PublicKey, key.PrivateKey, key.Active, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create signing key: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a signing key by ID
+func (r *SigningKeyRepository) GetByID(id string) (*SigningKey, error) {
+	row := r.db.DB().QueryRow(selectSigningKeysQuery+` WHERE id = ?`, id)
+
+	key, err := r.scanKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetActive retrieves the most recently created active signing key
+func (r *SigningKeyRepository) GetActive() (*SigningKey, error) {
+	row := r.db.DB().QueryRow(selectSigningKeysQuery + ` WHERE active = 1 ORDER BY created_at DESC LIMIT 1`)
+
+	key, err := r.scanKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active signing key: %w", err)
+	}
+
+	return key, nil
+}
+
+// List retrieves all signing keys, newest first
+func (r *SigningKeyRepository) List() ([]SigningKey, error) {
+	rows, err := r.db.DB().Query(selectSigningKeysQuery + ` ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		var retiredAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Name, &key.Algorithm, &key.PublicKey,
+			&key.PrivateKey, &key.Active, &key.CreatedAt, &retiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan signing key: %w", err)
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating signing keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// SetActive makes a key the active signing key and retires the previously
+// active one. Retired keys are kept so older signatures still verify.
+func (r *SigningKeyRepository) SetActive(id string) error {
+	return r.db.WithTransaction(func(tx *sql.Tx) error {
+		now := time.Now()
+		if _, err := tx.Exec(`UPDATE signing_keys SET active = 0, retired_at = ? WHERE active = 1 AND id != ?`, now, id); err != nil {
+			return fmt.Errorf("failed to retire signing keys: %w", err)
+		}
+
+		result, err := tx.Exec(`UPDATE signing_keys SET active = 1, retired_at = NULL WHERE id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("failed to activate signing key: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("signing key not found: %s", id)
+		}
+		return nil
+	})
+}
+
+// scanKey scans a single signing key row
+func (r *SigningKeyRepository) scanKey(row *sql.Row) (*SigningKey, error) {
+	var key SigningKey
+	var retiredAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.Algorithm, &key.PublicKey,
+		&key.PrivateKey, &key.Active, &key.CreatedAt, &retiredAt); err != nil {
+		return nil, err
+	}
+	if retiredAt.Valid {
+		key.RetiredAt = &retiredAt.Time
+	}
+	return &key, nil
+}
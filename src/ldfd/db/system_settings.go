@@ -0,0 +1,169 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+	// Time zones are checked against the embedded database so validation
+	// does not depend on the host's zoneinfo
+	_ "time/tzdata"
+)
+
+var (
+	hostnameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	localePattern        = regexp.MustCompile(`^([a-z]{2,3}(_[A-Z]{2})?|C)(\.[A-Za-z0-9-]+)?(@[a-z]+)?$`)
+	keymapPattern        = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	interfaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,14}$`)
+)
+
+// bondModes are the Linux bonding modes
+var bondModes = map[string]bool{
+	"balance-rr": true, "active-backup": true, "balance-xor": true, "broadcast": true,
+	"802.3ad": true, "balance-tlb": true, "balance-alb": true,
+}
+
+// ValidateSystemSettings reports invalid system settings: malformed host
+// names, locales and keymaps, unknown time zones, bad addresses or CIDRs
+// and inconsistent VLANs and bonds
+func ValidateSystemSettings(settings SystemSettings) error {
+	if settings.Hostname != "" && !validHostname(settings.Hostname) {
+		return fmt.Errorf("invalid hostname %q", settings.Hostname)
+	}
+	for _, locale := range settings.Locales {
+		if locale != "POSIX" && !localePattern.MatchString(locale) {
+			return fmt.Errorf("invalid locale %q (expected e.g. en_US.UTF-8)", locale)
+		}
+	}
+	if settings.Timezone != "" {
+		if settings.Timezone == "Local" {
+			return fmt.Errorf("unknown timezone %q", settings.Timezone)
+		}
+		if _, err := time.LoadLocation(settings.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", settings.Timezone)
+		}
+	}
+	if settings.Keymap != "" && !keymapPattern.MatchString(settings.Keymap) {
+		return fmt.Errorf("invalid keymap %q", settings.Keymap)
+	}
+	for _, server := range settings.NTPServers {
+		if _, err := netip.ParseAddr(server); err != nil && !validHostname(server) {
+			return fmt.Errorf("invalid NTP server %q", server)
+		}
+	}
+	return validateNetwork(settings.Network)
+}
+
+// validHostname reports whether name is an RFC 1123 host name
+func validHostname(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateNetwork checks name servers, search domains and interfaces
+func validateNetwork(network NetworkConfig) error {
+	for _, server := range network.DNS {
+		if _, err := netip.ParseAddr(server); err != nil {
+			return fmt.Errorf("invalid DNS server %q: not an IP address", server)
+		}
+	}
+	for _, domain := range network.SearchDomains {
+		if !validHostname(domain) {
+			return fmt.Errorf("invalid search domain %q", domain)
+		}
+	}
+
+	names := make(map[string]bool, len(network.Interfaces))
+	for _, iface := range network.Interfaces {
+		if !interfaceNamePattern.MatchString(iface.Name) {
+			return fmt.Errorf("invalid interface name %q", iface.Name)
+		}
+		if names[iface.Name] {
+			return fmt.Errorf("interface %s is declared twice", iface.Name)
+		}
+		names[iface.Name] = true
+	}
+
+	members := make(map[string]string)
+	for _, iface := range network.Interfaces {
+		if err := validateInterface(iface); err != nil {
+			return fmt.Errorf("interface %s: %w", iface.Name, err)
+		}
+		for _, member := range iface.Members {
+			if bond, ok := members[member]; ok {
+				return fmt.Errorf("interface %s is a member of both %s and %s", member, bond, iface.Name)
+			}
+			members[member] = iface.Name
+		}
+	}
+	for _, iface := range network.Interfaces {
+		if bond, ok := members[iface.Name]; ok && (iface.DHCP || len(iface.Addresses) > 0) {
+			return fmt.Errorf("interface %s is a member of %s and cannot have addresses", iface.Name, bond)
+		}
+	}
+	return nil
+}
+
+// validateInterface checks the addresses of an interface and the
+// settings of its type
+func validateInterface(iface NetworkInterface) error {
+	for _, addr := range iface.Addresses {
+		if _, err := netip.ParsePrefix(addr); err != nil {
+			return fmt.Errorf("invalid address %q: expected CIDR notation, e.g. 192.168.1.10/24", addr)
+		}
+	}
+	if iface.Gateway != "" {
+		if _, err := netip.ParseAddr(iface.Gateway); err != nil {
+			return fmt.Errorf("invalid gateway %q", iface.Gateway)
+		}
+		if len(iface.Addresses) == 0 {
+			return fmt.Errorf("a gateway requires a static address")
+		}
+	}
+	if iface.MTU != 0 && (iface.MTU < 68 || iface.MTU > 65535) {
+		return fmt.Errorf("invalid MTU %d", iface.MTU)
+	}
+
+	switch iface.Type {
+	case "", InterfaceEthernet:
+		if iface.Parent != "" || iface.VLANID != 0 || len(iface.Members) > 0 || iface.BondMode != "" {
+			return fmt.Errorf("VLAN and bond settings require the vlan or bond type")
+		}
+	case InterfaceVLAN:
+		if iface.Parent == "" || !interfaceNamePattern.MatchString(iface.Parent) {
+			return fmt.Errorf("a VLAN requires a parent link")
+		}
+		if iface.VLANID < 1 || iface.VLANID > 4094 {
+			return fmt.Errorf("invalid VLAN ID %d (1-4094)", iface.VLANID)
+		}
+		if len(iface.Members) > 0 || iface.BondMode != "" {
+			return fmt.Errorf("bond settings require the bond type")
+		}
+	case InterfaceBond:
+		if len(iface.Members) == 0 {
+			return fmt.Errorf("a bond requires members")
+		}
+		for _, member := range iface.Members {
+			if member == iface.Name || !interfaceNamePattern.MatchString(member) {
+				return fmt.Errorf("invalid bond member %q", member)
+			}
+		}
+		if iface.BondMode != "" && !bondModes[iface.BondMode] {
+			return fmt.Errorf("unsupported bond mode %q", iface.BondMode)
+		}
+		if iface.Parent != "" || iface.VLANID != 0 {
+			return fmt.Errorf("VLAN settings require the vlan type")
+		}
+	default:
+		return fmt.Errorf("unsupported interface type %q (supported: ethernet, vlan, bond)", iface.Type)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UpdateBundleRepository handles OTA update bundle database operations
+type UpdateBundleRepository struct {
+	db *Database
+}
+
+// NewUpdateBundleRepository creates a new update bundle repository
+func NewUpdateBundleRepository(db *Database) *UpdateBundleRepository {
+	return &UpdateBundleRepository{db: db}
+}
+
+// selectUpdateBundlesQuery is the base SELECT query for update bundles
+const selectUpdateBundlesQuery = `
+	SELECT id, build_id, distribution_id, target_arch, compatible, version,
+		artifact_path, checksum, size_bytes, created_at
+	FROM update_bundles
+`
+
+// Create inserts a new update bundle
+func (r *UpdateBundleRepository) Create(bundle *UpdateBundle) error {
+	if bundle.ID == "" {
+		bundle.ID = uuid.New().String()
+	}
+	bundle.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO update_bundles (id, build_id, distribution_id, target_arch, compatible, version,
+			artifact_path, checksum, size_bytes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.DB().Exec(query, bundle.ID, bundle.BuildID, bundle.DistributionID,
+		bundle.TargetArch, bundle.Compatible, bundle.Version,
+		bundle.ArtifactPath, bundle.Checksum, bundle.SizeBytes, bundle.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create update bundle: %w", err)
+	}
+
+	return nil
+}
+
+// GetByBuild retrieves the update bundle published by a build
+func (r *UpdateBundleRepository) GetByBuild(buildID string) (*UpdateBundle, error) {
+	row := r.db.DB().QueryRow(selectUpdateBundlesQuery+` WHERE build_id = ?`, buildID)
+
+	var bundle UpdateBundle
+	err := row.Scan(&bundle.ID, &bundle.BuildID, &bundle.DistributionID, &bundle.TargetArch,
+		&bundle.Compatible, &bundle.Version, &bundle.ArtifactPath, &bundle.Checksum,
+		&bundle.SizeBytes, &bundle.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get update bundle: %w", err)
+	}
+
+	return &bundle, nil
+}
+
+// ListByDistribution retrieves the update bundles of a distribution, newest
+// first. An empty arch or compatible string and a zero after time match
+// every bundle.
+func (r *UpdateBundleRepository) ListByDistribution(distributionID string, arch TargetArch, compatible string, after time.Time) ([]UpdateBundle, error) {
+	query := selectUpdateBundlesQuery + ` WHERE distribution_id = ?`
+	args := []interface{}{distributionID}
+	if arch != "" {
+		query += ` AND target_arch = ?`
+		args = append(args, arch)
+	}
+	if compatible != "" {
+		query += ` AND compatible = ?`
+		args = append(args, compatible)
+	}
+	if !after.IsZero() {
+		query += ` AND created_at > ?`
+		args = append(args, after)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := r.db.DB().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list update bundles: %w", err)
+	}
+	defer rows.Close()
+
+	var bundles []UpdateBundle
+	for rows.Next() {
+		var bundle UpdateBundle
+		if err := rows.Scan(&bundle.ID, &bundle.BuildID, &bundle.DistributionID, &bundle.TargetArch,
+			&bundle.Compatible, &bundle.Version, &bundle.ArtifactPath, &bundle.Checksum,
+			&bundle.SizeBytes, &bundle.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan update bundle: %w", err)
+		}
+		bundles = append(bundles, bundle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating update bundles: %w", err)
+	}
+
+	return bundles, nil
+}
@@ -0,0 +1,119 @@
+// Package diskenc manages the LUKS2 keys encrypted root partitions are formatted with.
+package diskenc
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/security"
+	"github.com/google/uuid"
+)
+
+const (
+	// modhex is the alphabet of systemd recovery keys, chosen to type the
+	// same on most keyboard layouts
+	modhex = "cbdefghijklnrtuv"
+	// recoveryKeyBytes is the entropy of a recovery key (256 bits)
+	recoveryKeyBytes = 32
+	// keyFileName is the key file written into the build workspace
+	keyFileName = "root.key"
+)
+
+// ErrKeyNotFound is returned when a build has no recorded disk key
+var ErrKeyNotFound = errors.New("disk encryption key not found")
+
+// Service stores per-build disk keys encrypted by the SecretManager
+type Service struct {
+	repo    *db.DiskEncryptionKeyRepository
+	secrets *security.SecretManager
+}
+
+// NewService creates a new disk encryption key service
+func NewService(repo *db.DiskEncryptionKeyRepository, secrets *security.SecretManager) *Service {
+	return &Service{repo: repo, secrets: secrets}
+}
+
+// CreateDiskKey generates a recovery key and LUKS UUID for a build, stores
+// them and writes the key file into dir. The recovery key is the LUKS
+// passphrase itself, so it can be typed at the unlock prompt. A retried
+// build replaces its previous key.
+func (s *Service) CreateDiskKey(buildID, distributionID, dir string) (*build.DiskKey, error) {
+	recoveryKey, err := generateRecoveryKey()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.secrets.Encrypt(recoveryKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt recovery key: %w", err)
+	}
+
+	record := &db.DiskEncryptionKey{
+		BuildID:        buildID,
+		DistributionID: distributionID,
+		LUKSUUID:       uuid.NewString(),
+		RecoveryKey:    encrypted,
+	}
+	if err := s.repo.DeleteByBuild(buildID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(record); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	key := &build.DiskKey{
+		Dir:         dir,
+		KeyFile:     filepath.Join(dir, keyFileName),
+		LUKSUUID:    record.LUKSUUID,
+		RecoveryKey: recoveryKey,
+	}
+	// No trailing newline: cryptsetup hashes key files byte for byte
+	if err := os.WriteFile(key.KeyFile, []byte(recoveryKey), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	return key, nil
+}
+
+// RecoveryKey returns the decrypted recovery key of a build
+func (s *Service) RecoveryKey(buildID string) (*db.DiskEncryptionKey, string, error) {
+	record, err := s.repo.GetByBuild(buildID)
+	if err != nil {
+		return nil, "", err
+	}
+	if record == nil {
+		return nil, "", ErrKeyNotFound
+	}
+	recoveryKey, err := s.secrets.Decrypt(record.RecoveryKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt recovery key: %w", err)
+	}
+	return record, recoveryKey, nil
+}
+
+// generateRecoveryKey returns a random key in the systemd-cryptenroll
+// recovery key format: eight dash-separated groups of eight modhex digits
+func generateRecoveryKey() (string, error) {
+	buf := make([]byte, recoveryKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate recovery key: %w", err)
+	}
+
+	var sb strings.Builder
+	for i, b := range buf {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(modhex[b>>4])
+		sb.WriteByte(modhex[b&0x0f])
+	}
+	return sb.String(), nil
+}
@@ -599,6 +599,14 @@ func (m *Manager) getRequiredComponents(config *db.DistributionConfig) []string
 		findComponent("init", config.System.Init)
 	}
 
+	// System logger - journald ships with systemd, syslog is provided by sysklogd
+	switch strings.ToLower(string(config.System.Logging.System)) {
+	case string(db.LoggingSyslog):
+		findComponent("logging", "sysklogd")
+	case string(db.LoggingRsyslog):
+		findComponent("logging", "rsyslog")
+	}
+
 	// Filesystem userspace tools - only download if userspace is enabled for hybrid components
 	// Kernel module configuration is handled separately; this is for userspace tools like btrfs-progs, xfsprogs, etc.
 	if config.System.Filesystem.Type != "" && config.System.FilesystemUserspace {
@@ -617,15 +625,30 @@ func (m *Manager) getRequiredComponents(config *db.DistributionConfig) []string
 
 	// Security userspace tools - only download if userspace is enabled for hybrid components
 	// Kernel module configuration is handled separately; this is for userspace tools like libselinux, etc.
-	if config.Security.System != "" && config.Security.System != "none" && config.Security.SystemUserspace {
+	// AppArmor profile sets are installed from the AppArmor source tree
+	if config.Security.System != "" && config.Security.System != "none" &&
+		(config.Security.SystemUserspace || (strings.EqualFold(config.Security.System, "apparmor") && len(config.Security.AppArmor.ProfileSets) > 0)) {
 		findComponent("security", config.Security.System)
 	}
 
+	// SELinux reference policy (targeted and mls policies are compiled from it)
+	if strings.EqualFold(config.Security.System, "selinux") && config.Security.SELinux.Policy != db.SELinuxPolicyCustom {
+		findComponent("security", "refpolicy")
+	}
+
 	// Desktop (only if target is desktop)
 	if config.Target.Type == "desktop" && config.Target.Desktop != nil && config.Target.Desktop.Environment != "" {
 		findComponent("desktop", config.Target.Desktop.Environment)
 	}
 
+	// cloud-init, and growpart from cloud-utils (only if target is cloud)
+	if config.Target.Type == "cloud" {
+		findComponent("cloud", "cloud-init")
+		if config.Target.Cloud == nil || !config.Target.Cloud.NoGrowpart {
+			findComponent("cloud", "cloud-utils")
+		}
+	}
+
 	// Toolchain components -- determine target arch from board profile
 	toolchain := db.ResolveToolchain(&config.Core)
 	var targetArch db.TargetArch
@@ -687,6 +710,10 @@ func (m *Manager) getDistributionVersionOverride(config *db.DistributionConfig,
 		if config.System.Init != "" && containsIgnoreCase(componentName, config.System.Init) {
 			return config.System.InitVersion
 		}
+		// Check system logger version
+		if containsIgnoreCase(componentName, "sysklogd") || containsIgnoreCase(componentName, "rsyslog") {
+			return config.System.Logging.Version
+		}
 		// Check filesystem version
 		if config.System.Filesystem.Type != "" && containsIgnoreCase(componentName, config.System.Filesystem.Type) {
 			return config.System.FilesystemVersion
@@ -707,6 +734,14 @@ func (m *Manager) getDistributionVersionOverride(config *db.DistributionConfig,
 		if config.Runtime.Virtualization != "" && containsIgnoreCase(componentName, config.Runtime.Virtualization) {
 			return config.Runtime.VirtualizationVersion
 		}
+		// Check SELinux reference policy version
+		if containsIgnoreCase(componentName, "refpolicy") {
+			return config.Security.SELinux.RefpolicyVersion
+		}
+		// Check cloud-init version
+		if config.Target.Cloud != nil && containsIgnoreCase(componentName, "cloud-init") {
+			return config.Target.Cloud.CloudInitVersion
+		}
 		// Check desktop environment version
 		if config.Target.Desktop != nil && config.Target.Desktop.Environment != "" &&
 			containsIgnoreCase(componentName, config.Target.Desktop.Environment) {
@@ -0,0 +1,310 @@
+// Package secureboot manages the UEFI Secure Boot key sets ldfd signs EFI binaries with.
+package secureboot
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/build"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/security"
+	"github.com/google/uuid"
+)
+
+const (
+	// keyBits is the RSA modulus size of generated keys; UEFI firmware
+	// is only required to support RSA-2048
+	keyBits = 2048
+	// certValidity is the lifetime of generated certificates
+	certValidity = 10 * 365 * 24 * time.Hour
+)
+
+var (
+	// ErrKeySetExists is returned when a key set name is already taken
+	ErrKeySetExists = errors.New("secure boot key set already exists")
+	// ErrKeySetNotFound is returned when no matching key set is stored
+	ErrKeySetNotFound = errors.New("secure boot key set not found")
+	// ErrInvalidKeySet is returned when imported certificates or keys cannot be used
+	ErrInvalidKeySet = errors.New("invalid secure boot key set")
+)
+
+// KeyPair is a PEM-encoded certificate and its RSA private key
+type KeyPair struct {
+	Certificate string
+	PrivateKey  string
+}
+
+// Service stores Secure Boot key sets with their private keys encrypted by
+// the SecretManager and hands them to builds on demand
+type Service struct {
+	repo    *db.SecureBootKeyRepository
+	secrets *security.SecretManager
+}
+
+// NewService creates a new Secure Boot key service
+func NewService(repo *db.SecureBootKeyRepository, secrets *security.SecretManager) *Service {
+	return &Service{repo: repo, secrets: secrets}
+}
+
+// List returns all key sets; private keys are never serialized
+func (s *Service) List() ([]db.SecureBootKeySet, error) {
+	return s.repo.List()
+}
+
+// Get returns a key set by ID
+func (s *Service) Get(id string) (*db.SecureBootKeySet, error) {
+	set, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, ErrKeySetNotFound
+	}
+	return set, nil
+}
+
+// Generate creates a new self-signed PK/KEK/db hierarchy
+func (s *Service) Generate(name string, activate bool) (*db.SecureBootKeySet, error) {
+	var pairs [3]KeyPair
+	for i, role := range []string{"PK", "KEK", "db"} {
+		pair, err := generateKeyPair(fmt.Sprintf("%s %s", name, role))
+		if err != nil {
+			return nil, err
+		}
+		pairs[i] = pair
+	}
+
+	return s.store(name, uuid.NewString(), pairs[0], pairs[1], pairs[2], activate)
+}
+
+// Import stores an existing hierarchy. An empty ownerGUID is replaced by a
+// new random GUID.
+func (s *Service) Import(name, ownerGUID string, pk, kek, dbKey KeyPair, activate bool) (*db.SecureBootKeySet, error) {
+	if ownerGUID == "" {
+		ownerGUID = uuid.NewString()
+	} else if _, err := uuid.Parse(ownerGUID); err != nil {
+		return nil, fmt.Errorf("%w: owner GUID: %v", ErrInvalidKeySet, err)
+	}
+
+	for role, pair := range map[string]KeyPair{"PK": pk, "KEK": kek, "db": dbKey} {
+		if err := validateKeyPair(pair); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKeySet, role, err)
+		}
+	}
+
+	return s.store(name, ownerGUID, pk, kek, dbKey, activate)
+}
+
+// Activate makes a key set the default for builds that do not name one
+func (s *Service) Activate(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.repo.SetActive(id)
+}
+
+// Delete removes a key set
+func (s *Service) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+// Materialize decrypts a key set into dir for sbsign and efitools. The
+// active set is used when keySetID is empty.
+func (s *Service) Materialize(keySetID, dir string) (*build.SecureBootKeys, error) {
+	var set *db.SecureBootKeySet
+	var err error
+	if keySetID == "" {
+		set, err = s.repo.GetActive()
+	} else {
+		set, err = s.repo.GetByID(keySetID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, ErrKeySetNotFound
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	keys := &build.SecureBootKeys{
+		KeySetID:  set.ID,
+		Dir:       dir,
+		OwnerGUID: set.OwnerGUID,
+		PKKey:     filepath.Join(dir, "PK.key"),
+		PKCert:    filepath.Join(dir, "PK.crt"),
+		KEKKey:    filepath.Join(dir, "KEK.key"),
+		KEKCert:   filepath.Join(dir, "KEK.crt"),
+		DBKey:     filepath.Join(dir, "db.key"),
+		DBCert:    filepath.Join(dir, "db.crt"),
+	}
+
+	files := []struct {
+		path      string
+		value     string
+		encrypted bool
+	}{
+		{keys.PKKey, set.PKKey, true},
+		{keys.PKCert, set.PKCert, false},
+		{keys.KEKKey, set.KEKKey, true},
+		{keys.KEKCert, set.KEKCert, false},
+		{keys.DBKey, set.DBKey, true},
+		{keys.DBCert, set.DBCert, false},
+	}
+	for _, f := range files {
+		data := f.value
+		if f.encrypted {
+			if data, err = s.secrets.Decrypt(f.value); err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %w", filepath.Base(f.path), err)
+			}
+		}
+		if err := os.WriteFile(f.path, []byte(data), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", filepath.Base(f.path), err)
+		}
+	}
+
+	return keys, nil
+}
+
+// store encrypts the private keys and persists the key set
+func (s *Service) store(name, ownerGUID string, pk, kek, dbKey KeyPair, activate bool) (*db.SecureBootKeySet, error) {
+	existing, err := s.repo.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrKeySetExists
+	}
+
+	set := &db.SecureBootKeySet{
+		ID:        uuid.NewString(),
+		Name:      name,
+		OwnerGUID: ownerGUID,
+		PKCert:    pk.Certificate,
+		KEKCert:   kek.Certificate,
+		DBCert:    dbKey.Certificate,
+	}
+	for _, f := range []struct {
+		dst   *string
+		plain string
+	}{
+		{&set.PKKey, pk.PrivateKey},
+		{&set.KEKKey, kek.PrivateKey},
+		{&set.DBKey, dbKey.PrivateKey},
+	} {
+		if *f.dst, err = s.secrets.Encrypt(f.plain); err != nil {
+			return nil, fmt.Errorf("failed to encrypt secure boot key: %w", err)
+		}
+	}
+
+	if err := s.repo.Create(set); err != nil {
+		return nil, err
+	}
+
+	if activate {
+		if err := s.repo.SetActive(set.ID); err != nil {
+			return nil, err
+		}
+		set.Active = true
+	}
+
+	return set, nil
+}
+
+// generateKeyPair creates an RSA key and a self-signed certificate for it
+func generateKeyPair(commonName string) (KeyPair, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	return KeyPair{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+	}, nil
+}
+
+// validateKeyPair checks that a PEM certificate and RSA private key belong together
+func validateKeyPair(pair KeyPair) error {
+	certBlock, _ := pem.Decode([]byte(pair.Certificate))
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return errors.New("certificate is not PEM-encoded")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode([]byte(pair.PrivateKey))
+	if keyBlock == nil {
+		return errors.New("private key is not PEM-encoded")
+	}
+	var priv crypto.Signer
+	switch keyBlock.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err == nil {
+			var ok bool
+			if priv, ok = parsed.(*rsa.PrivateKey); !ok {
+				return errors.New("private key is not an RSA key")
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported private key type %q", keyBlock.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || !pub.Equal(priv.Public()) {
+		return errors.New("private key does not match certificate")
+	}
+
+	return nil
+}
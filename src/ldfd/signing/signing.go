@@ -0,0 +1,216 @@
+// Package signing manages the ed25519 keys ldfd signs build attestations and artifacts with.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bitswalk/ldf/src/common/attestation"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/security"
+)
+
+// defaultKeyName is the name given to automatically generated keys
+const defaultKeyName = "ldfd-default"
+
+var (
+	// ErrKeyExists is returned when importing a key that is already stored
+	ErrKeyExists = errors.New("signing key already exists")
+	// ErrInvalidKey is returned when an imported private key cannot be parsed
+	ErrInvalidKey = errors.New("invalid ed25519 private key")
+)
+
+// Service signs payloads with the active server key, generating one on
+// first use. Private keys are stored encrypted by the SecretManager.
+type Service struct {
+	repo    *db.SigningKeyRepository
+	secrets *security.SecretManager
+	mu      sync.Mutex
+}
+
+// NewService creates a new signing service
+func NewService(repo *db.SigningKeyRepository, secrets *security.SecretManager) *Service {
+	return &Service{repo: repo, secrets: secrets}
+}
+
+// ActiveKey returns the active signing key, generating one if none exists
+func (s *Service) ActiveKey() (*db.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.repo.GetActive()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		return key, nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return s.store(defaultKeyName, priv, true)
+}
+
+// Generate creates a new signing key, making it the active key when activate is set
+func (s *Service) Generate(name string, activate bool) (*db.SigningKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store(name, priv, activate)
+}
+
+// Import stores an existing PKCS#8 PEM-encoded ed25519 private key
+func (s *Service) Import(name, privateKeyPEM string, activate bool) (*db.SigningKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, ErrInvalidKey
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.repo.GetByID(attestation.KeyID(priv.Public().(ed25519.PublicKey)))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrKeyExists
+	}
+
+	return s.store(name, priv, activate)
+}
+
+// Rotate generates a new active key and retires the current one
+func (s *Service) Rotate(name string) (*db.SigningKey, error) {
+	return s.Generate(name, true)
+}
+
+// Sign wraps payload in a DSSE envelope signed with the active key
+func (s *Service) Sign(payloadType string, payload []byte) (*attestation.Envelope, error) {
+	key, priv, err := s.activePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return attestation.Sign(priv, key.ID, payloadType, payload), nil
+}
+
+// SignDetached returns a minisign signature of r made with the active key
+func (s *Service) SignDetached(r io.Reader, trustedComment string) ([]byte, error) {
+	_, priv, err := s.activePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return attestation.SignDetached(priv, r, trustedComment)
+}
+
+// VerifyDetached checks a minisign signature of r against every known key,
+// including retired ones, and returns the key that made it along with the
+// signature's trusted comment
+func (s *Service) VerifyDetached(r io.Reader, sig []byte) (*db.SigningKey, string, error) {
+	parsed, err := attestation.ParseDetachedSignature(sig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys, err := s.repo.List()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range keys {
+		pub, err := attestation.ParsePublicKeyPEM([]byte(keys[i].PublicKey))
+		if err != nil || attestation.MinisignKeyID(pub) != parsed.KeyID {
+			continue
+		}
+		comment, err := attestation.VerifyDetached(pub, r, sig)
+		if err != nil {
+			return nil, "", err
+		}
+		return &keys[i], comment, nil
+	}
+
+	return nil, "", fmt.Errorf("signature was not made by a known key: %w", attestation.ErrInvalidSignature)
+}
+
+// PublicKeys lists all signing keys without generating one; private key
+// material is never serialized
+func (s *Service) PublicKeys() ([]db.SigningKey, error) {
+	return s.repo.List()
+}
+
+// store encrypts and persists a private key. Callers must hold s.mu.
+func (s *Service) store(name string, priv ed25519.PrivateKey, activate bool) (*db.SigningKey, error) {
+	pub := priv.Public().(ed25519.PublicKey)
+	pubPEM, err := attestation.MarshalPublicKeyPEM(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.secrets.Encrypt(base64.StdEncoding.EncodeToString(priv.Seed()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+
+	key := &db.SigningKey{
+		ID:         attestation.KeyID(pub),
+		Name:       name,
+		Algorithm:  db.SigningAlgorithmEd25519,
+		PublicKey:  pubPEM,
+		PrivateKey: encrypted,
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, err
+	}
+
+	if activate {
+		if err := s.repo.SetActive(key.ID); err != nil {
+			return nil, err
+		}
+		key.Active = true
+	}
+
+	return key, nil
+}
+
+// activePrivateKey returns the active key along with its decrypted private half
+func (s *Service) activePrivateKey() (*db.SigningKey, ed25519.PrivateKey, error) {
+	key, err := s.ActiveKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plain, err := s.secrets.Decrypt(key.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt signing key %s: %w", key.ID, err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(plain)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, nil, fmt.Errorf("signing key %s is corrupt", key.ID)
+	}
+
+	return key, ed25519.NewKeyFromSeed(seed), nil
+}
@@ -1224,6 +1224,52 @@ func TestAPI_HandleDistributionUpdate_Forbidden(t *testing.T) {
 	}
 }
 
+func TestAPI_HandleDistribution_InvalidSettings(t *testing.T) {
+	ta := setupTestAPI(t)
+
+	user, token := ta.createTestUser(t, "settingsuser", "settingsuser@example.com", auth.RoleIDDeveloper)
+
+	body := map[string]interface{}{
+		"name":    "settings-distro",
+		"version": "1.0.0",
+		"config": map[string]interface{}{
+			"settings": map[string]interface{}{"timezone": "Mars/Olympus"},
+		},
+	}
+	rec := ta.makeRequest("POST", "/v1/distributions", body, token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for unknown timezone, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	distRepo := db.NewDistributionRepository(ta.database)
+	dist := &db.Distribution{
+		Name:       "settings-update-distro",
+		Version:    "1.0.0",
+		Status:     db.StatusPending,
+		Visibility: db.VisibilityPrivate,
+		OwnerID:    user.ID,
+	}
+	if err := distRepo.Create(dist); err != nil {
+		t.Fatalf("failed to create distribution: %v", err)
+	}
+
+	body = map[string]interface{}{
+		"config": map[string]interface{}{
+			"settings": map[string]interface{}{
+				"network": map[string]interface{}{
+					"interfaces": []map[string]interface{}{
+						{"name": "eth0", "addresses": []string{"192.168.1.10"}},
+					},
+				},
+			},
+		},
+	}
+	rec = ta.makeRequest("PUT", "/v1/distributions/"+dist.ID, body, token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an address without prefix, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestAPI_HandleDistributionDelete(t *testing.T) {
 	ta := setupTestAPI(t)
 
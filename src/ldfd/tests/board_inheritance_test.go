@@ -0,0 +1,376 @@
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/auth"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// =============================================================================
+// Board Profile Inheritance Tests
+// =============================================================================
+
+func createInheritedProfiles(t *testing.T, repo *db.BoardProfileRepository, ownerID string) (*db.BoardProfile, *db.BoardProfile) {
+	t.Helper()
+
+	parent := &db.BoardProfile{
+		Name:        "base-board",
+		DisplayName: "Base Board",
+		Arch:        db.ArchAARCH64,
+		OwnerID:     ownerID,
+		Config: db.BoardConfig{
+			DeviceTrees: []db.DeviceTreeSpec{
+				{Source: "arch/arm64/boot/dts/vendor/base.dts", Overlays: []string{"arch/arm64/boot/dts/vendor/uart.dts"}},
+			},
+			KernelOverlay:   map[string]string{"CONFIG_SERIAL": "y", "CONFIG_DRM": "m"},
+			KernelDefconfig: "base_defconfig",
+			KernelCmdline:   "console=ttyS0",
+			Firmware: []db.BoardFirmware{
+				{Name: "wifi", Path: "/lib/firmware/wifi", Source: "firmware/wifi-v1.bin"},
+				{Name: "gpu", Path: "/lib/firmware/gpu"},
+			},
+			BootParams: db.BoardBootParams{ConfigTxt: "arm_64bit=1", KernelImage: "kernel8.img"},
+		},
+	}
+	if err := repo.Create(parent); err != nil {
+		t.Fatalf("failed to create parent: %v", err)
+	}
+
+	child := &db.BoardProfile{
+		Name:        "base-board-hat",
+		DisplayName: "Base Board with HAT",
+		Arch:        db.ArchAARCH64,
+		OwnerID:     ownerID,
+		ParentID:    parent.ID,
+		Config: db.BoardConfig{
+			DeviceTrees: []db.DeviceTreeSpec{
+				{Source: "arch/arm64/boot/dts/vendor/base.dts", Overlays: []string{"overlays/sensor-hat.dts"}},
+			},
+			KernelOverlay: map[string]string{"CONFIG_DRM": "y", "CONFIG_IIO": "m"},
+			KernelCmdline: "console=ttyS0 quiet",
+			Firmware: []db.BoardFirmware{
+				{Name: "wifi", Path: "/lib/firmware/wifi", Source: "firmware/wifi-v2.bin"},
+			},
+		},
+	}
+	if err := repo.Create(child); err != nil {
+		t.Fatalf("failed to create child: %v", err)
+	}
+
+	return parent, child
+}
+
+func TestBoardProfileRepository_Resolve(t *testing.T) {
+	database, cleanup := setupBoardProfileTestDB(t)
+	defer cleanup()
+
+	repo := db.NewBoardProfileRepository(database)
+	parent, child := createInheritedProfiles(t, repo, "")
+
+	chain, err := repo.GetChain(child.ID)
+	if err != nil {
+		t.Fatalf("failed to get chain: %v", err)
+	}
+	if len(chain) != 2 || chain[0].ID != child.ID || chain[1].ID != parent.ID {
+		t.Fatalf("expected chain [child, parent], got %d entries", len(chain))
+	}
+
+	resolved, err := repo.Resolve(child.ID)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	cfg := resolved.Config
+
+	if resolved.Name != "base-board-hat" {
+		t.Fatalf("expected resolved profile to keep the child's name, got %s", resolved.Name)
+	}
+	if len(cfg.DeviceTrees) != 1 || len(cfg.DeviceTrees[0].Overlays) != 2 {
+		t.Fatalf("expected one device tree with merged overlays, got %+v", cfg.DeviceTrees)
+	}
+	if cfg.KernelOverlay["CONFIG_SERIAL"] != "y" || cfg.KernelOverlay["CONFIG_DRM"] != "y" || cfg.KernelOverlay["CONFIG_IIO"] != "m" {
+		t.Fatalf("unexpected merged kernel overlay: %v", cfg.KernelOverlay)
+	}
+	if cfg.KernelDefconfig != "base_defconfig" {
+		t.Fatalf("expected inherited defconfig, got %s", cfg.KernelDefconfig)
+	}
+	if cfg.KernelCmdline != "console=ttyS0 quiet" {
+		t.Fatalf("expected child cmdline, got %s", cfg.KernelCmdline)
+	}
+	if len(cfg.Firmware) != 2 || cfg.Firmware[0].Source != "firmware/wifi-v2.bin" {
+		t.Fatalf("expected child wifi firmware to replace parent's, got %+v", cfg.Firmware)
+	}
+	if cfg.BootParams.ConfigTxt != "arm_64bit=1" || cfg.BootParams.KernelImage != "kernel8.img" {
+		t.Fatalf("expected inherited boot params, got %+v", cfg.BootParams)
+	}
+
+	// The parent itself is left untouched
+	stored, _ := repo.GetByID(parent.ID)
+	if len(stored.Config.DeviceTrees[0].Overlays) != 1 || stored.Config.KernelOverlay["CONFIG_DRM"] != "m" {
+		t.Fatal("expected resolving to leave the parent config unchanged")
+	}
+}
+
+func TestBoardProfileRepository_GetChain_Loop(t *testing.T) {
+	database, cleanup := setupBoardProfileTestDB(t)
+	defer cleanup()
+
+	repo := db.NewBoardProfileRepository(database)
+	parent, child := createInheritedProfiles(t, repo, "")
+
+	parent.ParentID = child.ID
+	if err := repo.Update(parent); err != nil {
+		t.Fatalf("failed to update parent: %v", err)
+	}
+
+	if _, err := repo.GetChain(child.ID); err == nil {
+		t.Fatal("expected an error for a looping chain")
+	}
+}
+
+func TestAPI_HandleBoardProfileResolve(t *testing.T) {
+	ta := setupTestAPI(t)
+
+	repo := db.NewBoardProfileRepository(ta.database)
+	_, child := createInheritedProfiles(t, repo, "")
+
+	rec := ta.makeRequest("GET", "/v1/board/profiles/"+child.ID+"/resolved", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Profile db.BoardProfile `json:"profile"`
+		Chain   []string        `json:"chain"`
+	}
+	parseJSON(t, rec, &response)
+
+	if len(response.Chain) != 2 || response.Chain[0] != "base-board-hat" || response.Chain[1] != "base-board" {
+		t.Fatalf("unexpected chain: %v", response.Chain)
+	}
+	if response.Profile.Config.KernelDefconfig != "base_defconfig" {
+		t.Fatalf("expected inherited defconfig, got %s", response.Profile.Config.KernelDefconfig)
+	}
+}
+
+func TestAPI_HandleBoardProfileCreate_ParentArchMismatch(t *testing.T) {
+	ta := setupTestAPI(t)
+
+	_, token := ta.createTestUser(t, "boardparent", "boardparent@example.com", auth.RoleIDDeveloper)
+
+	repo := db.NewBoardProfileRepository(ta.database)
+	parent, _ := createInheritedProfiles(t, repo, "")
+
+	body := map[string]interface{}{
+		"name":         "x86-child",
+		"display_name": "x86 Child",
+		"arch":         "x86_64",
+		"parent_id":    parent.ID,
+	}
+
+	rec := ta.makeRequest("POST", "/v1/board/profiles", body, token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPI_HandleBoardProfileUpdate_ParentLoop(t *testing.T) {
+	ta := setupTestAPI(t)
+
+	user, token := ta.createTestUser(t, "boardloop", "boardloop@example.com", auth.RoleIDDeveloper)
+
+	repo := db.NewBoardProfileRepository(ta.database)
+	parent, child := createInheritedProfiles(t, repo, user.ID)
+
+	body := map[string]interface{}{"parent_id": child.ID}
+	rec := ta.makeRequest("PUT", "/v1/board/profiles/"+parent.ID, body, token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPI_HandleBoardProfileDelete_HasChildren(t *testing.T) {
+	ta := setupTestAPI(t)
+
+	user, token := ta.createTestUser(t, "boardchildren", "boardchildren@example.com", auth.RoleIDDeveloper)
+
+	repo := db.NewBoardProfileRepository(ta.database)
+	parent, _ := createInheritedProfiles(t, repo, user.ID)
+
+	rec := ta.makeRequest("DELETE", "/v1/board/profiles/"+parent.ID, nil, token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// =============================================================================
+// Board Profile Bundle Tests
+// =============================================================================
+
+func TestAPI_HandleBoardProfileExportImport(t *testing.T) {
+	ta := setupTestAPIWithStorage(t)
+
+	user, token := ta.createTestUser(t, "boardbundle", "boardbundle@example.com", auth.RoleIDDeveloper)
+
+	repo := db.NewBoardProfileRepository(ta.database)
+	parent, child := createInheritedProfiles(t, repo, user.ID)
+
+	overlay := []byte("/dts-v1/;\n/plugin/;\n")
+	rec := ta.makeMultipartRequest(t, "PUT", "/v1/board/profiles/"+child.ID+"/files/overlays/sensor-hat.dts", "file", "sensor-hat.dts", overlay, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = ta.makeMultipartRequest(t, "PUT", "/v1/board/profiles/"+parent.ID+"/files/firmware/wifi-v1.bin", "file", "wifi-v1.bin", []byte{0x01, 0x02}, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = ta.makeRequest("GET", "/v1/board/profiles/"+child.ID+"/export", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	bundle := rec.Body.Bytes()
+
+	// Importing over the existing profile is refused
+	rec = ta.makeMultipartRequest(t, "POST", "/v1/board/profiles/import", "file", "bundle.tar.gz", bundle, token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = ta.makeRequest("DELETE", "/v1/board/profiles/"+child.ID, nil, token)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = ta.makeMultipartRequest(t, "POST", "/v1/board/profiles/import", "file", "bundle.tar.gz", bundle, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Profile db.BoardProfile `json:"profile"`
+		Created []string        `json:"created"`
+		Reused  []string        `json:"reused"`
+	}
+	parseJSON(t, rec, &response)
+
+	if response.Profile.Name != "base-board-hat" || response.Profile.ParentID != parent.ID {
+		t.Fatalf("expected imported child extending the existing parent, got %+v", response.Profile)
+	}
+	if len(response.Reused) != 1 || response.Reused[0] != "base-board" {
+		t.Fatalf("expected parent to be reused, got %v", response.Reused)
+	}
+	if len(response.Profile.Config.DeviceTrees) != 1 || response.Profile.Config.DeviceTrees[0].Overlays[0] != "overlays/sensor-hat.dts" {
+		t.Fatalf("expected child config to be imported unresolved, got %+v", response.Profile.Config.DeviceTrees)
+	}
+
+	rec = ta.makeRequest("GET", "/v1/board/profiles/"+response.Profile.ID+"/files", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var files struct {
+		Files []struct {
+			Path string `json:"path"`
+			Size int64  `json:"size"`
+		} `json:"files"`
+	}
+	parseJSON(t, rec, &files)
+	if len(files.Files) != 1 || files.Files[0].Path != "overlays/sensor-hat.dts" || files.Files[0].Size != int64(len(overlay)) {
+		t.Fatalf("expected imported overlay file, got %+v", files.Files)
+	}
+}
+
+func TestAPI_HandleBoardProfileImport_DivergedAncestor(t *testing.T) {
+	ta := setupTestAPIWithStorage(t)
+
+	user, token := ta.createTestUser(t, "boarddiverged", "boarddiverged@example.com", auth.RoleIDDeveloper)
+
+	repo := db.NewBoardProfileRepository(ta.database)
+	parent, child := createInheritedProfiles(t, repo, user.ID)
+
+	rec := ta.makeRequest("GET", "/v1/board/profiles/"+child.ID+"/export", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	bundle := rec.Body.Bytes()
+
+	rec = ta.makeRequest("DELETE", "/v1/board/profiles/"+child.ID, nil, token)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A file attached since the export makes the parent a different profile
+	rec = ta.makeMultipartRequest(t, "PUT", "/v1/board/profiles/"+parent.ID+"/files/firmware/wifi-v2.bin", "file", "wifi-v2.bin", []byte{0x02}, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = ta.makeMultipartRequest(t, "POST", "/v1/board/profiles/import", "file", "bundle.tar.gz", bundle, token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a diverged file set, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = ta.makeRequest("DELETE", "/v1/board/profiles/"+parent.ID+"/files/firmware/wifi-v2.bin", nil, token)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	parent.Config.KernelCmdline = "console=ttyAMA0"
+	if err := repo.Update(parent); err != nil {
+		t.Fatalf("failed to update parent: %v", err)
+	}
+	rec = ta.makeMultipartRequest(t, "POST", "/v1/board/profiles/import", "file", "bundle.tar.gz", bundle, token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a diverged configuration, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	found, _ := repo.GetByName("base-board-hat")
+	if found != nil {
+		t.Fatal("expected no profile to be grafted onto a diverged ancestor")
+	}
+}
+
+func TestAPI_HandleBoardProfileImport_ChecksumMismatch(t *testing.T) {
+	ta := setupTestAPIWithStorage(t)
+
+	_, token := ta.createTestUser(t, "boardtamper", "boardtamper@example.com", auth.RoleIDDeveloper)
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"format_version": 1,
+		"profile":        "tampered",
+		"profiles": []map[string]interface{}{{
+			"name":         "tampered",
+			"display_name": "Tampered",
+			"arch":         "aarch64",
+			"files": []map[string]interface{}{
+				{"path": "firmware/blob.bin", "size": 4, "sha256": "0000"},
+			},
+		}},
+	})
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	writeEntry := func(name string, data []byte) {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		_, _ = io.Copy(tw, bytes.NewReader(data))
+	}
+	writeEntry("manifest.json", manifest)
+	writeEntry("files/tampered/firmware/blob.bin", []byte("blob"))
+	_ = tw.Close()
+	_ = gz.Close()
+
+	rec := ta.makeMultipartRequest(t, "POST", "/v1/board/profiles/import", "file", "bundle.tar.gz", buf.Bytes(), token)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	found, _ := db.NewBoardProfileRepository(ta.database).GetByName("tampered")
+	if found != nil {
+		t.Fatal("expected no profile to be created from a tampered bundle")
+	}
+}
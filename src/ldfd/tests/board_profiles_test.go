@@ -38,8 +38,8 @@ func TestBoardProfileRepository_SeededProfiles(t *testing.T) {
 		t.Fatalf("failed to list profiles: %v", err)
 	}
 
-	if len(profiles) != 2 {
-		t.Fatalf("expected 2 seeded profiles, got %d", len(profiles))
+	if len(profiles) != 3 {
+		t.Fatalf("expected 3 seeded profiles, got %d", len(profiles))
 	}
 
 	// Verify generic-x86_64
@@ -83,6 +83,24 @@ func TestBoardProfileRepository_SeededProfiles(t *testing.T) {
 	if rpi.Config.BootParams.ConfigTxt == "" {
 		t.Fatal("expected rpi4 to have config.txt boot params")
 	}
+	if rpi.Config.ImageLayout != db.BoardImageLayoutRPi {
+		t.Fatalf("expected rpi4 to use the rpi image layout, got %q", rpi.Config.ImageLayout)
+	}
+
+	// Verify rpi5
+	rpi5, err := repo.GetByName("rpi5")
+	if err != nil {
+		t.Fatalf("failed to get rpi5: %v", err)
+	}
+	if rpi5 == nil {
+		t.Fatal("expected rpi5 profile to exist")
+	}
+	if rpi5.Config.KernelDefconfig != "bcm2712_defconfig" {
+		t.Fatalf("expected bcm2712_defconfig, got %s", rpi5.Config.KernelDefconfig)
+	}
+	if rpi5.Config.BootParams.KernelImage != "kernel_2712.img" || rpi5.Config.ImageLayout != db.BoardImageLayoutRPi {
+		t.Fatalf("expected rpi5 to boot kernel_2712.img from the rpi image layout, got %+v", rpi5.Config)
+	}
 }
 
 func TestBoardProfileRepository_Create(t *testing.T) {
@@ -223,13 +241,13 @@ func TestBoardProfileRepository_ListByArch(t *testing.T) {
 		t.Fatalf("failed to create profile: %v", err)
 	}
 
-	// List aarch64 profiles (seeded rpi4 + our custom one)
+	// List aarch64 profiles (seeded rpi4 and rpi5 + our custom one)
 	aarch64List, err := repo.ListByArch(db.ArchAARCH64)
 	if err != nil {
 		t.Fatalf("failed to list by arch: %v", err)
 	}
-	if len(aarch64List) != 2 {
-		t.Fatalf("expected 2 aarch64 profiles, got %d", len(aarch64List))
+	if len(aarch64List) != 3 {
+		t.Fatalf("expected 3 aarch64 profiles, got %d", len(aarch64List))
 	}
 
 	// List x86_64 profiles (only seeded generic-x86_64)
@@ -265,9 +283,9 @@ func TestBoardProfileRepository_ListSystem(t *testing.T) {
 		t.Fatalf("failed to list system profiles: %v", err)
 	}
 
-	// Should be exactly 2 (seeded profiles)
-	if len(systemList) != 2 {
-		t.Fatalf("expected 2 system profiles, got %d", len(systemList))
+	// Should be exactly 3 (seeded profiles)
+	if len(systemList) != 3 {
+		t.Fatalf("expected 3 system profiles, got %d", len(systemList))
 	}
 
 	for _, p := range systemList {
@@ -542,16 +560,16 @@ func TestAPI_HandleBoardProfileList(t *testing.T) {
 	parseJSON(t, rec, &response)
 
 	count := int(response["count"].(float64))
-	if count != 2 {
-		t.Fatalf("expected 2 seeded profiles, got %d", count)
+	if count != 3 {
+		t.Fatalf("expected 3 seeded profiles, got %d", count)
 	}
 
 	profiles, ok := response["profiles"].([]interface{})
 	if !ok {
 		t.Fatal("expected profiles array")
 	}
-	if len(profiles) != 2 {
-		t.Fatalf("expected 2 profiles, got %d", len(profiles))
+	if len(profiles) != 3 {
+		t.Fatalf("expected 3 profiles, got %d", len(profiles))
 	}
 }
 
@@ -568,8 +586,8 @@ func TestAPI_HandleBoardProfileList_FilterByArch(t *testing.T) {
 	parseJSON(t, rec, &response)
 
 	count := int(response["count"].(float64))
-	if count != 1 {
-		t.Fatalf("expected 1 aarch64 profile, got %d", count)
+	if count != 2 {
+		t.Fatalf("expected 2 aarch64 profiles, got %d", count)
 	}
 
 	profiles := response["profiles"].([]interface{})
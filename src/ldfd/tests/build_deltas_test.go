@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// =============================================================================
+// Build Delta Repository Tests
+// =============================================================================
+
+func setupBuildDeltaTest(t *testing.T) (*db.Database, *db.Distribution, func()) {
+	t.Helper()
+	database, err := db.New(db.Config{PersistPath: "", LoadOnStart: false})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	dist := &db.Distribution{
+		Name:       "delta-distro",
+		Version:    "1.0.0",
+		Status:     db.StatusReady,
+		Visibility: db.VisibilityPrivate,
+	}
+	if err := db.NewDistributionRepository(database).Create(dist); err != nil {
+		t.Fatalf("failed to create distribution: %v", err)
+	}
+
+	return database, dist, func() { _ = database.Shutdown() }
+}
+
+// createDeltaBuilds records the two builds a delta connects
+func createDeltaBuilds(t *testing.T, database *db.Database, distID string) (*db.BuildJob, *db.BuildJob) {
+	t.Helper()
+	repo := db.NewBuildJobRepository(database)
+	source := &db.BuildJob{DistributionID: distID, OwnerID: "owner-1", TargetArch: db.ArchX86_64}
+	target := &db.BuildJob{DistributionID: distID, OwnerID: "owner-1", TargetArch: db.ArchX86_64}
+	for _, job := range []*db.BuildJob{source, target} {
+		if err := repo.Create(job); err != nil {
+			t.Fatalf("failed to create build job: %v", err)
+		}
+	}
+	return source, target
+}
+
+func TestBuildDeltaRepository_Lifecycle(t *testing.T) {
+	database, dist, cleanup := setupBuildDeltaTest(t)
+	defer cleanup()
+	repo := db.NewBuildDeltaRepository(database)
+	source, target := createDeltaBuilds(t, database, dist.ID)
+
+	delta := &db.BuildDelta{
+		DistributionID: dist.ID,
+		SourceBuildID:  source.ID,
+		TargetBuildID:  target.ID,
+		SourceChecksum: "aaa",
+		TargetChecksum: "bbb",
+	}
+	if err := repo.Create(delta); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if delta.Status != db.DeltaStatusPending {
+		t.Errorf("expected pending status, got %s", delta.Status)
+	}
+
+	if err := repo.MarkRunning(delta.ID); err != nil {
+		t.Fatalf("MarkRunning() error = %v", err)
+	}
+	if err := repo.MarkFailed(delta.ID, "source image missing"); err != nil {
+		t.Fatalf("MarkFailed() error = %v", err)
+	}
+	got, err := repo.GetByID(delta.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.Status != db.DeltaStatusFailed || got.ErrorMessage != "source image missing" || got.CompletedAt == nil {
+		t.Errorf("after MarkFailed() = %+v", got)
+	}
+
+	if err := repo.Reset(delta.ID); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if err := repo.MarkCompleted(delta.ID, "deltas/a.ldfdelta", "ccc", 4096); err != nil {
+		t.Fatalf("MarkCompleted() error = %v", err)
+	}
+
+	got, err = repo.GetByBuilds(source.ID, target.ID)
+	if err != nil {
+		t.Fatalf("GetByBuilds() error = %v", err)
+	}
+	if got == nil || got.Status != db.DeltaStatusCompleted || got.Checksum != "ccc" ||
+		got.SizeBytes != 4096 || got.ErrorMessage != "" || got.SourceChecksum != "aaa" {
+		t.Errorf("after MarkCompleted() = %+v", got)
+	}
+
+	reverse, err := repo.GetByBuilds(target.ID, source.ID)
+	if err != nil {
+		t.Fatalf("GetByBuilds() error = %v", err)
+	}
+	if reverse != nil {
+		t.Errorf("deltas are directional, got %+v", reverse)
+	}
+
+	if err := repo.MarkRunning("no-such-delta"); err == nil {
+		t.Error("expected error for unknown delta")
+	}
+}
+
+func TestBuildDeltaRepository_UniquePair(t *testing.T) {
+	database, dist, cleanup := setupBuildDeltaTest(t)
+	defer cleanup()
+	repo := db.NewBuildDeltaRepository(database)
+	source, target := createDeltaBuilds(t, database, dist.ID)
+
+	first := &db.BuildDelta{DistributionID: dist.ID, SourceBuildID: source.ID, TargetBuildID: target.ID}
+	if err := repo.Create(first); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second := &db.BuildDelta{DistributionID: dist.ID, SourceBuildID: source.ID, TargetBuildID: target.ID}
+	if err := repo.Create(second); err == nil {
+		t.Error("expected error for duplicate build pair")
+	}
+
+	deltas, err := repo.ListByDistribution(dist.ID)
+	if err != nil {
+		t.Fatalf("ListByDistribution() error = %v", err)
+	}
+	if len(deltas) != 1 {
+		t.Errorf("expected 1 delta, got %d", len(deltas))
+	}
+}
+
+func TestBuildDeltaRepository_DeletedWithBuild(t *testing.T) {
+	database, dist, cleanup := setupBuildDeltaTest(t)
+	defer cleanup()
+	repo := db.NewBuildDeltaRepository(database)
+	source, target := createDeltaBuilds(t, database, dist.ID)
+
+	delta := &db.BuildDelta{DistributionID: dist.ID, SourceBuildID: source.ID, TargetBuildID: target.ID}
+	if err := repo.Create(delta); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db.NewBuildJobRepository(database).Delete(source.ID); err != nil {
+		t.Fatalf("failed to delete build job: %v", err)
+	}
+
+	got, err := repo.GetByID(delta.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got != nil {
+		t.Error("expected delta to be removed with its source build")
+	}
+}
@@ -3202,3 +3202,54 @@ func TestLanguagePackRepository_WithNullAuthor(t *testing.T) {
 		t.Fatalf("expected empty author, got '%s'", found.Author)
 	}
 }
+
+// =============================================================================
+// System Settings Validation Tests
+// =============================================================================
+
+func TestValidateSystemSettings(t *testing.T) {
+	valid := db.SystemSettings{
+		Hostname:   "node1.example.com",
+		Locales:    []string{"en_US.UTF-8", "de_DE@euro", "POSIX"},
+		Timezone:   "America/New_York",
+		Keymap:     "de-latin1",
+		NTPServers: []string{"pool.ntp.org", "192.0.2.123"},
+		Network: db.NetworkConfig{
+			DNS:           []string{"192.0.2.53", "2001:db8::53"},
+			SearchDomains: []string{"example.com"},
+			Interfaces: []db.NetworkInterface{
+				{Name: "bond0", Type: db.InterfaceBond, Members: []string{"eth0", "eth1"}, BondMode: "802.3ad"},
+				{Name: "vlan20", Type: db.InterfaceVLAN, Parent: "bond0", VLANID: 20, Addresses: []string{"192.168.20.10/24"}, Gateway: "192.168.20.1"},
+				{Name: "eth2", DHCP: true, MTU: 9000},
+			},
+		},
+	}
+	if err := db.ValidateSystemSettings(valid); err != nil {
+		t.Fatalf("expected valid settings, got %v", err)
+	}
+	if err := db.ValidateSystemSettings(db.SystemSettings{}); err != nil {
+		t.Fatalf("expected empty settings to be valid, got %v", err)
+	}
+
+	invalid := map[string]db.SystemSettings{
+		"hostname":      {Hostname: "-node_1"},
+		"locale":        {Locales: []string{"english"}},
+		"timezone":      {Timezone: "Mars/Olympus"},
+		"local":         {Timezone: "Local"},
+		"ntp server":    {NTPServers: []string{"ntp server"}},
+		"dns hostname":  {Network: db.NetworkConfig{DNS: []string{"dns.example.com"}}},
+		"cidr":          {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "eth0", Addresses: []string{"192.168.1.10"}}}}},
+		"gateway only":  {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "eth0", DHCP: true, Gateway: "192.168.1.1"}}}},
+		"duplicate":     {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "eth0"}, {Name: "eth0"}}}},
+		"vlan id":       {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "vlan0", Type: db.InterfaceVLAN, Parent: "eth0", VLANID: 4095}}}},
+		"bond mode":     {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "bond0", Type: db.InterfaceBond, Members: []string{"eth0"}, BondMode: "fastest"}}}},
+		"member in two": {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "bond0", Type: db.InterfaceBond, Members: []string{"eth0"}}, {Name: "bond1", Type: db.InterfaceBond, Members: []string{"eth0"}}}}},
+		"member addr":   {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "bond0", Type: db.InterfaceBond, Members: []string{"eth0"}}, {Name: "eth0", DHCP: true}}}},
+		"type":          {Network: db.NetworkConfig{Interfaces: []db.NetworkInterface{{Name: "br0", Type: "bridge"}}}},
+	}
+	for name, settings := range invalid {
+		if err := db.ValidateSystemSettings(settings); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
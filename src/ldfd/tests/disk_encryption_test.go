@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/diskenc"
+	"github.com/bitswalk/ldf/src/ldfd/security"
+)
+
+// =============================================================================
+// Disk Encryption Key Service Tests
+// =============================================================================
+
+func setupDiskKeyService(t *testing.T) (*diskenc.Service, *db.DiskEncryptionKeyRepository, *db.Database, func()) {
+	t.Helper()
+	database, err := db.New(db.Config{PersistPath: "", LoadOnStart: false})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	secrets, err := security.NewSecretManager(filepath.Join(t.TempDir(), "master.key"))
+	if err != nil {
+		t.Fatalf("failed to create secret manager: %v", err)
+	}
+
+	repo := db.NewDiskEncryptionKeyRepository(database)
+	return diskenc.NewService(repo, secrets), repo, database, func() { _ = database.Shutdown() }
+}
+
+func TestDiskKeyService_CreateAndRecover(t *testing.T) {
+	svc, repo, database, cleanup := setupDiskKeyService(t)
+	defer cleanup()
+
+	dist := &db.Distribution{
+		Name:       "encrypted-distro",
+		Version:    "1.0.0",
+		Status:     db.StatusReady,
+		Visibility: db.VisibilityPrivate,
+	}
+	if err := db.NewDistributionRepository(database).Create(dist); err != nil {
+		t.Fatalf("failed to create distribution: %v", err)
+	}
+	job := &db.BuildJob{DistributionID: dist.ID, OwnerID: "owner-1"}
+	if err := db.NewBuildJobRepository(database).Create(job); err != nil {
+		t.Fatalf("failed to create build job: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "diskkey")
+	key, err := svc.CreateDiskKey(job.ID, dist.ID, dir)
+	if err != nil {
+		t.Fatalf("failed to create disk key: %v", err)
+	}
+
+	if !regexp.MustCompile(`^([cbdefghijklnrtuv]{8}-){7}[cbdefghijklnrtuv]{8}$`).MatchString(key.RecoveryKey) {
+		t.Errorf("unexpected recovery key format: %q", key.RecoveryKey)
+	}
+	data, err := os.ReadFile(key.KeyFile)
+	if err != nil {
+		t.Fatalf("failed to read key file: %v", err)
+	}
+	if string(data) != key.RecoveryKey {
+		t.Error("key file must hold the recovery key without a trailing newline")
+	}
+	if info, _ := os.Stat(key.KeyFile); info.Mode().Perm() != 0600 {
+		t.Errorf("expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	stored, err := repo.GetByBuild(job.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("failed to load disk key: %v", err)
+	}
+	if !strings.HasPrefix(stored.RecoveryKey, "enc:") {
+		t.Errorf("expected encrypted recovery key, got %q", stored.RecoveryKey)
+	}
+
+	record, recoveryKey, err := svc.RecoveryKey(job.ID)
+	if err != nil {
+		t.Fatalf("failed to recover key: %v", err)
+	}
+	if recoveryKey != key.RecoveryKey || record.LUKSUUID != key.LUKSUUID {
+		t.Error("recovered key does not match the created key")
+	}
+
+	// A retried build gets a fresh key
+	again, err := svc.CreateDiskKey(job.ID, dist.ID, dir)
+	if err != nil {
+		t.Fatalf("failed to recreate disk key: %v", err)
+	}
+	if again.RecoveryKey == key.RecoveryKey {
+		t.Error("expected a new recovery key")
+	}
+}
+
+func TestDiskKeyService_NotFound(t *testing.T) {
+	svc, _, _, cleanup := setupDiskKeyService(t)
+	defer cleanup()
+
+	if _, _, err := svc.RecoveryKey("missing"); !errors.Is(err, diskenc.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
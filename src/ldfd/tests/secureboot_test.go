@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/secureboot"
+	"github.com/bitswalk/ldf/src/ldfd/security"
+)
+
+// =============================================================================
+// Secure Boot Key Service Tests
+// =============================================================================
+
+func setupSecureBootService(t *testing.T) (*secureboot.Service, *db.SecureBootKeyRepository, func()) {
+	t.Helper()
+	database, err := db.New(db.Config{PersistPath: "", LoadOnStart: false})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	secrets, err := security.NewSecretManager(filepath.Join(t.TempDir(), "master.key"))
+	if err != nil {
+		t.Fatalf("failed to create secret manager: %v", err)
+	}
+
+	repo := db.NewSecureBootKeyRepository(database)
+	return secureboot.NewService(repo, secrets), repo, func() { _ = database.Shutdown() }
+}
+
+func TestSecureBootService_GenerateAndMaterialize(t *testing.T) {
+	svc, repo, cleanup := setupSecureBootService(t)
+	defer cleanup()
+
+	set, err := svc.Generate("ldf-test", true)
+	if err != nil {
+		t.Fatalf("failed to generate key set: %v", err)
+	}
+	if !set.Active {
+		t.Error("expected generated key set to be active")
+	}
+
+	stored, err := repo.GetByID(set.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("failed to load key set: %v", err)
+	}
+	if !strings.HasPrefix(stored.PKKey, "enc:") {
+		t.Errorf("expected encrypted PK key, got %q", stored.PKKey)
+	}
+
+	// Empty key set ID selects the active set
+	dir := filepath.Join(t.TempDir(), "keys")
+	keys, err := svc.Materialize("", dir)
+	if err != nil {
+		t.Fatalf("failed to materialize key set: %v", err)
+	}
+	if keys.KeySetID != set.ID || keys.OwnerGUID != set.OwnerGUID {
+		t.Errorf("materialized wrong key set: %+v", keys)
+	}
+
+	for _, path := range []string{keys.PKKey, keys.KEKKey, keys.DBKey} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("missing key file: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %o, want 0600", filepath.Base(path), info.Mode().Perm())
+		}
+	}
+
+	data, err := os.ReadFile(keys.DBCert)
+	if err != nil {
+		t.Fatalf("failed to read db certificate: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("db certificate is not PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse db certificate: %v", err)
+	}
+	if cert.Subject.CommonName != "ldf-test db" {
+		t.Errorf("unexpected db certificate subject %q", cert.Subject.CommonName)
+	}
+}
+
+func TestSecureBootService_Import(t *testing.T) {
+	svc, _, cleanup := setupSecureBootService(t)
+	defer cleanup()
+
+	// Reuse a generated hierarchy as import material
+	source, err := svc.Generate("source", false)
+	if err != nil {
+		t.Fatalf("failed to generate key set: %v", err)
+	}
+	keys, err := svc.Materialize(source.ID, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to materialize key set: %v", err)
+	}
+	pair := func(cert, key string) secureboot.KeyPair {
+		c, _ := os.ReadFile(cert)
+		k, _ := os.ReadFile(key)
+		return secureboot.KeyPair{Certificate: string(c), PrivateKey: string(k)}
+	}
+	pk := pair(keys.PKCert, keys.PKKey)
+	kek := pair(keys.KEKCert, keys.KEKKey)
+	dbPair := pair(keys.DBCert, keys.DBKey)
+
+	imported, err := svc.Import("imported", "", pk, kek, dbPair, false)
+	if err != nil {
+		t.Fatalf("failed to import key set: %v", err)
+	}
+	if imported.OwnerGUID == "" {
+		t.Error("expected an owner GUID to be assigned")
+	}
+
+	// A key that does not match its certificate is rejected
+	mismatched := secureboot.KeyPair{Certificate: pk.Certificate, PrivateKey: kek.PrivateKey}
+	if _, err := svc.Import("mismatched", "", mismatched, kek, dbPair, false); !errors.Is(err, secureboot.ErrInvalidKeySet) {
+		t.Errorf("expected ErrInvalidKeySet, got %v", err)
+	}
+
+	if _, err := svc.Generate("imported", false); !errors.Is(err, secureboot.ErrKeySetExists) {
+		t.Errorf("expected ErrKeySetExists, got %v", err)
+	}
+}
+
+func TestSecureBootService_Activate(t *testing.T) {
+	svc, repo, cleanup := setupSecureBootService(t)
+	defer cleanup()
+
+	first, err := svc.Generate("first", true)
+	if err != nil {
+		t.Fatalf("failed to generate key set: %v", err)
+	}
+	second, err := svc.Generate("second", false)
+	if err != nil {
+		t.Fatalf("failed to generate key set: %v", err)
+	}
+
+	if err := svc.Activate(second.ID); err != nil {
+		t.Fatalf("failed to activate key set: %v", err)
+	}
+
+	active, err := repo.GetActive()
+	if err != nil || active == nil {
+		t.Fatalf("failed to get active key set: %v", err)
+	}
+	if active.ID != second.ID {
+		t.Errorf("expected %s to be active, got %s", second.ID, active.ID)
+	}
+	if prev, _ := repo.GetByID(first.ID); prev.Active {
+		t.Error("expected previous key set to be deactivated")
+	}
+
+	if err := svc.Activate("missing"); !errors.Is(err, secureboot.ErrKeySetNotFound) {
+		t.Errorf("expected ErrKeySetNotFound, got %v", err)
+	}
+}
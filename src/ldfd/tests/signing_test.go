@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitswalk/ldf/src/common/attestation"
+	"github.com/bitswalk/ldf/src/ldfd/db"
+	"github.com/bitswalk/ldf/src/ldfd/security"
+	"github.com/bitswalk/ldf/src/ldfd/signing"
+)
+
+// =============================================================================
+// Signing Service Tests
+// =============================================================================
+
+func setupSigningService(t *testing.T) (*signing.Service, *db.SigningKeyRepository, func()) {
+	t.Helper()
+	database, err := db.New(db.Config{PersistPath: "", LoadOnStart: false})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	secrets, err := security.NewSecretManager(filepath.Join(t.TempDir(), "master.key"))
+	if err != nil {
+		t.Fatalf("failed to create secret manager: %v", err)
+	}
+
+	repo := db.NewSigningKeyRepository(database)
+	return signing.NewService(repo, secrets), repo, func() { _ = database.Shutdown() }
+}
+
+func TestSigningService_GeneratesKeyOnce(t *testing.T) {
+	svc, repo, cleanup := setupSigningService(t)
+	defer cleanup()
+
+	first, err := svc.ActiveKey()
+	if err != nil {
+		t.Fatalf("failed to get active key: %v", err)
+	}
+	second, err := svc.ActiveKey()
+	if err != nil {
+		t.Fatalf("failed to get active key: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("expected the generated key to be reused, got %s then %s", first.ID, second.ID)
+	}
+
+	stored, err := repo.GetByID(first.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("expected key to be stored: %v", err)
+	}
+	if stored.PrivateKey == "" || stored.PrivateKey[:7] != "enc:v1:" {
+		t.Error("expected private key to be stored encrypted")
+	}
+}
+
+func TestSigningService_PublicKeysDoesNotGenerate(t *testing.T) {
+	svc, _, cleanup := setupSigningService(t)
+	defer cleanup()
+
+	keys, err := svc.PublicKeys()
+	if err != nil {
+		t.Fatalf("failed to list public keys: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected listing keys not to generate one, got %d", len(keys))
+	}
+}
+
+func TestSigningService_SignVerifies(t *testing.T) {
+	svc, _, cleanup := setupSigningService(t)
+	defer cleanup()
+
+	env, err := svc.Sign(attestation.PayloadTypeInToto, []byte(`{"hello":"world"}`))
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	keys, err := svc.PublicKeys()
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected one public key, got %d (%v)", len(keys), err)
+	}
+	if env.Signatures[0].KeyID != keys[0].ID {
+		t.Errorf("expected signature keyid %s, got %s", keys[0].ID, env.Signatures[0].KeyID)
+	}
+
+	pub, err := attestation.ParsePublicKeyPEM([]byte(keys[0].PublicKey))
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	payload, err := attestation.Verify(env, pub)
+	if err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	if string(payload) != `{"hello":"world"}` {
+		t.Errorf("unexpected payload %s", payload)
+	}
+
+	env.Payload = "e30=" // "{}"
+	if _, err := attestation.Verify(env, pub); err == nil {
+		t.Error("expected a modified payload to fail verification")
+	}
+}
+
+func TestSigningService_RotateKeepsRetiredKeysForVerification(t *testing.T) {
+	svc, repo, cleanup := setupSigningService(t)
+	defer cleanup()
+
+	sig, err := svc.SignDetached(strings.NewReader("image"), "file:disk.img")
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	original, _ := svc.ActiveKey()
+
+	rotated, err := svc.Rotate("release-2027")
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if !rotated.Active || rotated.ID == original.ID {
+		t.Fatalf("expected a new active key, got %+v", rotated)
+	}
+
+	retired, err := repo.GetByID(original.ID)
+	if err != nil || retired == nil {
+		t.Fatalf("expected retired key to be kept: %v", err)
+	}
+	if retired.Active || retired.RetiredAt == nil {
+		t.Errorf("expected original key to be retired, got %+v", retired)
+	}
+
+	signer, comment, err := svc.VerifyDetached(strings.NewReader("image"), sig)
+	if err != nil {
+		t.Fatalf("expected signature by retired key to verify: %v", err)
+	}
+	if signer.ID != original.ID || comment != "file:disk.img" {
+		t.Errorf("unexpected signer %s / comment %q", signer.ID, comment)
+	}
+
+	if _, _, err := svc.VerifyDetached(strings.NewReader("other"), sig); err == nil {
+		t.Error("expected signature over different content to fail")
+	}
+}
+
+func TestSigningService_Import(t *testing.T) {
+	svc, _, cleanup := setupSigningService(t)
+	defer cleanup()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	key, err := svc.Import("imported", keyPEM, true)
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+	if key.ID != attestation.KeyID(priv.Public().(ed25519.PublicKey)) {
+		t.Errorf("unexpected key id %s", key.ID)
+	}
+
+	active, _ := svc.ActiveKey()
+	if active.ID != key.ID {
+		t.Errorf("expected imported key to be active, got %s", active.ID)
+	}
+
+	if _, err := svc.Import("again", keyPEM, false); !errors.Is(err, signing.ErrKeyExists) {
+		t.Errorf("expected ErrKeyExists, got %v", err)
+	}
+	if _, err := svc.Import("bad", "not a key", false); !errors.Is(err, signing.ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
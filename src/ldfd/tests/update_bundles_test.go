@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitswalk/ldf/src/ldfd/db"
+)
+
+// =============================================================================
+// Update Bundle Repository Tests
+// =============================================================================
+
+func setupUpdateBundleTest(t *testing.T) (*db.Database, *db.Distribution, func()) {
+	t.Helper()
+	database, err := db.New(db.Config{PersistPath: "", LoadOnStart: false})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	dist := &db.Distribution{
+		Name:       "ota-distro",
+		Version:    "1.0.0",
+		Status:     db.StatusReady,
+		Visibility: db.VisibilityPrivate,
+	}
+	if err := db.NewDistributionRepository(database).Create(dist); err != nil {
+		t.Fatalf("failed to create distribution: %v", err)
+	}
+
+	return database, dist, func() { _ = database.Shutdown() }
+}
+
+// createBundledBuild records a build job and the bundle it published
+func createBundledBuild(t *testing.T, database *db.Database, distID string, arch db.TargetArch, compatible, version string) *db.UpdateBundle {
+	t.Helper()
+	job := &db.BuildJob{DistributionID: distID, OwnerID: "owner-1", TargetArch: arch}
+	if err := db.NewBuildJobRepository(database).Create(job); err != nil {
+		t.Fatalf("failed to create build job: %v", err)
+	}
+
+	bundle := &db.UpdateBundle{
+		BuildID:        job.ID,
+		DistributionID: distID,
+		TargetArch:     arch,
+		Compatible:     compatible,
+		Version:        version,
+		ArtifactPath:   "distribution/owner-1/" + distID + "/builds/" + job.ID + "/update.ldfb",
+		Checksum:       "abc123",
+		SizeBytes:      1024,
+	}
+	if err := db.NewUpdateBundleRepository(database).Create(bundle); err != nil {
+		t.Fatalf("failed to create update bundle: %v", err)
+	}
+	// Keep creation times distinct at the storage resolution
+	time.Sleep(10 * time.Millisecond)
+	return bundle
+}
+
+func TestUpdateBundleRepository_GetByBuild(t *testing.T) {
+	database, dist, cleanup := setupUpdateBundleTest(t)
+	defer cleanup()
+	repo := db.NewUpdateBundleRepository(database)
+
+	created := createBundledBuild(t, database, dist.ID, db.ArchX86_64, "board-a", "1.0.0")
+
+	got, err := repo.GetByBuild(created.BuildID)
+	if err != nil {
+		t.Fatalf("GetByBuild() error = %v", err)
+	}
+	if got == nil || got.ID != created.ID || got.Compatible != "board-a" || got.SizeBytes != 1024 {
+		t.Errorf("GetByBuild() = %+v", got)
+	}
+
+	missing, err := repo.GetByBuild("no-such-build")
+	if err != nil {
+		t.Fatalf("GetByBuild() error = %v", err)
+	}
+	if missing != nil {
+		t.Errorf("GetByBuild() of unknown build = %+v, want nil", missing)
+	}
+}
+
+func TestUpdateBundleRepository_ListByDistribution(t *testing.T) {
+	database, dist, cleanup := setupUpdateBundleTest(t)
+	defer cleanup()
+	repo := db.NewUpdateBundleRepository(database)
+
+	v1 := createBundledBuild(t, database, dist.ID, db.ArchX86_64, "board-a", "1.0.0")
+	createBundledBuild(t, database, dist.ID, db.ArchX86_64, "board-b", "1.1.0")
+	createBundledBuild(t, database, dist.ID, db.ArchAARCH64, "board-a", "1.1.0")
+	v2 := createBundledBuild(t, database, dist.ID, db.ArchX86_64, "board-a", "1.2.0")
+
+	all, err := repo.ListByDistribution(dist.ID, "", "", time.Time{})
+	if err != nil {
+		t.Fatalf("ListByDistribution() error = %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected 4 bundles, got %d", len(all))
+	}
+	if all[0].ID != v2.ID {
+		t.Errorf("expected newest bundle first, got version %s", all[0].Version)
+	}
+
+	// A device on v1 only sees newer bundles for its board and architecture
+	newer, err := repo.ListByDistribution(dist.ID, db.ArchX86_64, "board-a", v1.CreatedAt)
+	if err != nil {
+		t.Fatalf("ListByDistribution() error = %v", err)
+	}
+	if len(newer) != 1 || newer[0].ID != v2.ID {
+		t.Errorf("expected only the 1.2.0 bundle, got %+v", newer)
+	}
+}
+
+func TestUpdateBundleRepository_DeletedWithBuild(t *testing.T) {
+	database, dist, cleanup := setupUpdateBundleTest(t)
+	defer cleanup()
+	repo := db.NewUpdateBundleRepository(database)
+
+	bundle := createBundledBuild(t, database, dist.ID, db.ArchX86_64, "board-a", "1.0.0")
+	if err := db.NewBuildJobRepository(database).Delete(bundle.BuildID); err != nil {
+		t.Fatalf("failed to delete build job: %v", err)
+	}
+
+	got, err := repo.GetByBuild(bundle.BuildID)
+	if err != nil {
+		t.Fatalf("GetByBuild() error = %v", err)
+	}
+	if got != nil {
+		t.Error("expected bundle to be removed with its build")
+	}
+}
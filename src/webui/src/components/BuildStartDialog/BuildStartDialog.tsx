@@ -28,7 +28,17 @@ export const BuildStartDialog: Component<BuildStartDialogProps> = (props) => {
   const [error, setError] = createSignal<string | null>(null);
 
   const architectures: TargetArch[] = ["x86_64", "aarch64"];
-  const formats: ImageFormat[] = ["raw", "qcow2", "iso"];
+  const formats: ImageFormat[] = [
+    "raw",
+    "qcow2",
+    "vmdk",
+    "vhdx",
+    "iso",
+    "oci",
+    "tar.zst",
+    "cpio",
+    "netboot",
+  ];
 
   const handleSubmit = async (e: Event) => {
     e.preventDefault();
@@ -120,9 +130,13 @@ export const BuildStartDialog: Component<BuildStartDialogProps> = (props) => {
                     name={
                       f === "iso"
                         ? "disc"
-                        : f === "qcow2"
+                        : f === "qcow2" || f === "vmdk" || f === "vhdx"
                           ? "hard-drives"
-                          : "file"
+                          : f === "oci"
+                            ? "package"
+                            : f === "netboot"
+                              ? "network"
+                              : "file"
                     }
                     size="sm"
                     class="text-muted-foreground"
@@ -133,6 +147,14 @@ export const BuildStartDialog: Component<BuildStartDialogProps> = (props) => {
                       {f === "raw" && t("build.startDialog.formatDesc.raw")}
                       {f === "qcow2" && t("build.startDialog.formatDesc.qcow2")}
                       {f === "iso" && t("build.startDialog.formatDesc.iso")}
+                      {f === "oci" && t("build.startDialog.formatDesc.oci")}
+                      {f === "vmdk" && t("build.startDialog.formatDesc.vmdk")}
+                      {f === "vhdx" && t("build.startDialog.formatDesc.vhdx")}
+                      {f === "tar.zst" &&
+                        t("build.startDialog.formatDesc.tarZst")}
+                      {f === "cpio" && t("build.startDialog.formatDesc.cpio")}
+                      {f === "netboot" &&
+                        t("build.startDialog.formatDesc.netboot")}
                     </div>
                   </div>
                 </div>
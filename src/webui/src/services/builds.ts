@@ -10,6 +10,7 @@ export type BuildJobStatus =
   | "compiling"
   | "assembling"
   | "packaging"
+  | "testing"
   | "completed"
   | "failed"
   | "cancelled";
@@ -20,11 +21,21 @@ export type BuildStageName =
   | "prepare"
   | "compile"
   | "assemble"
-  | "package";
+  | "package"
+  | "test";
 
 export type TargetArch = "x86_64" | "aarch64";
 
-export type ImageFormat = "raw" | "qcow2" | "iso";
+export type ImageFormat =
+  | "raw"
+  | "qcow2"
+  | "iso"
+  | "oci"
+  | "vmdk"
+  | "vhdx"
+  | "tar.zst"
+  | "cpio"
+  | "netboot";
 
 export interface BuildStage {
   id: number;
@@ -756,6 +767,7 @@ export function getStatusDisplayText(status: BuildJobStatus): string {
     compiling: "Compiling",
     assembling: "Assembling",
     packaging: "Packaging",
+    testing: "Testing",
     completed: "Completed",
     failed: "Failed",
     cancelled: "Cancelled",
@@ -777,6 +789,7 @@ export function getStatusColor(
     compiling: "primary",
     assembling: "primary",
     packaging: "primary",
+    testing: "primary",
     completed: "success",
     failed: "danger",
     cancelled: "warning",
@@ -793,6 +806,7 @@ export function getStageDisplayText(stage: BuildStageName): string {
     compile: "Compile",
     assemble: "Assemble",
     package: "Package",
+    test: "Boot Test",
   };
   return texts[stage] || stage;
 }
@@ -812,6 +826,12 @@ export function getFormatDisplayText(format: ImageFormat): string {
     raw: "Raw Disk Image",
     qcow2: "QCOW2 (QEMU)",
     iso: "ISO (Bootable)",
+    oci: "OCI (Container)",
+    vmdk: "VMDK (VMware)",
+    vhdx: "VHDX (Hyper-V)",
+    "tar.zst": "Rootfs Tarball",
+    cpio: "CPIO (RAM Boot)",
+    netboot: "Netboot (PXE/iPXE)",
   };
   return texts[format] || format;
 }
@@ -824,7 +844,8 @@ export function isBuildActive(status: BuildJobStatus): boolean {
     status === "preparing" ||
     status === "compiling" ||
     status === "assembling" ||
-    status === "packaging"
+    status === "packaging" ||
+    status === "testing"
   );
 }
 